@@ -0,0 +1,23 @@
+package main
+
+import (
+	"net/http"
+)
+
+// drainHandler handles requests for "POST /v1/admin/drain". It flips the readiness probe to
+// failing straight away, then shuts the server down once the drain delay has passed, so that a
+// deploy can take the instance out of rotation without dropping any requests.
+func (app *application) drainHandler(w http.ResponseWriter, r *http.Request) {
+	app.draining.Store(true)
+	app.requestDrain()
+
+	env := envelope{
+		"message": "server is draining and will shut down after the drain delay",
+		"delay":   app.config.drainDelay.String(),
+	}
+
+	err := app.writeJSON(w, http.StatusAccepted, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
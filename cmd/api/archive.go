@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/walkccc/greenlight/internal/data"
+)
+
+// startArchiver starts the goroutine that moves the old soft-deleted movies and expired tokens to
+// the archive tables every interval, which keeps the hot tables and their indexes small. A
+// shutdown hook stops it, after the batch it's archiving (if any) is done.
+func (app *application) startArchiver() {
+	stop := make(chan struct{})
+	done := make(chan struct{})
+
+	app.onShutdown("archiver", func(ctx context.Context) error {
+		close(stop)
+		select {
+		case <-done:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+
+	go func() {
+		defer close(done)
+
+		ticker := time.NewTicker(app.config.archive.interval)
+		defer ticker.Stop()
+
+		for {
+			app.archive("movies", app.archiveMovies, stop)
+			app.archive("tokens", app.models.Archive.ArchiveTokens, stop)
+
+			select {
+			case <-ticker.C:
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+// archiveMovies moves a batch of the old soft-deleted movies to the archive table, and deletes
+// the files of their posters from the storage.
+func (app *application) archiveMovies(
+	ctx context.Context,
+	olderThan time.Duration,
+	limit int,
+) (int64, error) {
+	moved, keys, err := app.models.Archive.ArchiveMovies(ctx, olderThan, limit)
+	if err != nil {
+		return 0, err
+	}
+
+	if app.storage != nil {
+		for _, key := range keys {
+			app.deletePosterFiles(ctx, &data.Poster{Key: key})
+		}
+	}
+
+	return moved, nil
+}
+
+// archive moves the table's rows that are past the retention period in batches, until a batch
+// comes back short or the archiver is stopped, and logs how many rows were moved.
+func (app *application) archive(
+	table string,
+	move func(ctx context.Context, olderThan time.Duration, limit int) (int64, error),
+	stop <-chan struct{},
+) {
+	ctx := context.Background()
+	batchSize := app.config.archive.batchSize
+
+	var total int64
+	defer func() {
+		if total > 0 {
+			app.logger.PrintInfo("archived old rows", map[string]string{
+				"table": table,
+				"rows":  strconv.FormatInt(total, 10),
+			})
+		}
+	}()
+
+	for {
+		moved, err := move(ctx, app.config.archive.retention, batchSize)
+		if err != nil {
+			app.logger.PrintError(err, map[string]string{"table": table})
+			return
+		}
+		total += moved
+
+		if moved < int64(batchSize) {
+			return
+		}
+
+		select {
+		case <-stop:
+			return
+		default:
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/walkccc/greenlight/internal/data"
+	"github.com/walkccc/greenlight/internal/jsonlog"
+	"github.com/walkccc/greenlight/internal/storage"
+)
+
+// stubArchiveModel archives a single batch of movies, with the given posters.
+type stubArchiveModel struct {
+	data.ArchiveModelInterface
+	moved int64
+	keys  []string
+}
+
+func (m stubArchiveModel) ArchiveMovies(
+	ctx context.Context,
+	olderThan time.Duration,
+	limit int,
+) (int64, []string, error) {
+	return m.moved, m.keys, nil
+}
+
+func TestArchiveMovies(t *testing.T) {
+	local, err := storage.NewLocal(t.TempDir(), "https://api.example.com/assets", "secret")
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	poster := &data.Poster{MovieID: 1, Key: "posters/7/1/a/original"}
+	for _, name := range []string{data.PosterOriginal, "thumb", "medium"} {
+		key := poster.VariantKey(name)
+		require.NoError(t, local.Put(ctx, key, strings.NewReader(name), "image/webp"))
+	}
+
+	app := &application{
+		logger: jsonlog.New(io.Discard, jsonlog.LevelOff),
+		models: data.Models{
+			Archive: stubArchiveModel{moved: 2, keys: []string{poster.Key}},
+		},
+		storage: local,
+	}
+
+	moved, err := app.archiveMovies(ctx, time.Hour, 100)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), moved)
+
+	for _, name := range []string{data.PosterOriginal, "thumb", "medium"} {
+		_, err := local.Get(ctx, poster.VariantKey(name))
+		assert.ErrorIs(t, err, storage.ErrNotFound, name)
+	}
+
+	// Without a storage, the movies are archived all the same.
+	app.storage = nil
+	moved, err = app.archiveMovies(ctx, time.Hour, 100)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), moved)
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/walkccc/greenlight/internal/storage"
+)
+
+func TestAssetsHandler(t *testing.T) {
+	ctx := context.Background()
+	local, err := storage.NewLocal(t.TempDir(), "/assets", "secret")
+	require.NoError(t, err)
+	require.NoError(t, local.Put(ctx, "posters/1/original", strings.NewReader("0123456789"), ""))
+
+	app := &application{storage: local}
+	router := app.newRouter()
+
+	request := func(target string, header http.Header) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, target, nil)
+		for name, values := range header {
+			r.Header[name] = values
+		}
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, r)
+		return rr
+	}
+
+	signed, err := local.SignedURL(ctx, "posters/1/original", 10*time.Minute)
+	require.NoError(t, err)
+
+	rr := request(signed, nil)
+	require.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "0123456789", rr.Body.String())
+	assert.Equal(t, "bytes", rr.Header().Get("Accept-Ranges"))
+	assert.Equal(t, "nosniff", rr.Header().Get("X-Content-Type-Options"))
+	assert.Regexp(t, `^private, max-age=(599|600)$`, rr.Header().Get("Cache-Control"))
+	etag := rr.Header().Get("ETag")
+	assert.NotEmpty(t, etag)
+
+	rr = request(signed, http.Header{"Range": {"bytes=2-4"}})
+	assert.Equal(t, http.StatusPartialContent, rr.Code)
+	assert.Equal(t, "234", rr.Body.String())
+	assert.Equal(t, "bytes 2-4/10", rr.Header().Get("Content-Range"))
+
+	rr = request(signed, http.Header{"If-None-Match": {etag}})
+	assert.Equal(t, http.StatusNotModified, rr.Code)
+
+	// The signature is of another key.
+	u, err := url.Parse(signed)
+	require.NoError(t, err)
+	rr = request("/assets/posters/2/original?"+u.RawQuery, nil)
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+
+	expired, err := local.SignedURL(ctx, "posters/1/original", -time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusForbidden, request(expired, nil).Code)
+
+	missing, err := local.SignedURL(ctx, "posters/2/original", time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, request(missing, nil).Code)
+
+	// The keys that could escape the directory are never signed, nor served.
+	assert.Equal(t, http.StatusForbidden, request("/assets/../../etc/passwd", nil).Code)
+	_, err = local.SignedURL(ctx, "../secret", time.Minute)
+	assert.ErrorIs(t, err, storage.ErrInvalidKey)
+
+	// Only the local storage is served.
+	app.storage = nil
+	router = app.newRouter()
+	assert.Equal(t, http.StatusNotFound, request(signed, nil).Code)
+}
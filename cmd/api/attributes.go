@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/walkccc/greenlight/internal/data"
+	"github.com/walkccc/greenlight/internal/dto"
+	"github.com/walkccc/greenlight/internal/validator"
+)
+
+// attributeParamPrefix prefixes the names of the query parameters that filter the movie listings
+// by an attribute, e.g. attr.studio=A24.
+const attributeParamPrefix = "attr."
+
+// listAttributesHandler handles requests for "GET /v1/attributes".
+func (app *application) listAttributesHandler(w http.ResponseWriter, r *http.Request) {
+	attributes, err := app.models.Attributes.GetAll(r.Context())
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"attributes": attributes}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// createAttributeHandler handles requests for "POST /v1/admin/attributes". The attribute applies
+// to the movies of every organization, which can hold a value of it from then on.
+func (app *application) createAttributeHandler(w http.ResponseWriter, r *http.Request) {
+	var input dto.CreateAttributeRequest
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	if v.Struct(input); !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	attribute := input.Attribute()
+
+	if data.ValidateAttribute(v, attribute); !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	err = app.models.Attributes.Insert(r.Context(), attribute)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateAttribute):
+			v.AddError(
+				"name",
+				validator.CodeAlreadyExists,
+				"an attribute with this name already exists",
+			)
+			app.failedValidationResponse(w, r, v)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"attribute": attribute}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// deleteAttributeHandler handles requests for "DELETE /v1/admin/attributes/:name".
+func (app *application) deleteAttributeHandler(w http.ResponseWriter, r *http.Request) {
+	name := httprouter.ParamsFromContext(r.Context()).ByName("name")
+
+	err := app.models.Attributes.Delete(r.Context(), name)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(
+		w,
+		http.StatusOK,
+		envelope{"message": "attribute successfully deleted"},
+		nil,
+	)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// validateMovieAttributes checks the movie's attributes against the registered ones, adding any
+// errors to v. It only returns an error if the attributes couldn't be loaded.
+func (app *application) validateMovieAttributes(
+	ctx context.Context,
+	v *validator.Validator,
+	movie *data.Movie,
+) error {
+	definitions, err := app.models.Attributes.GetAll(ctx)
+	if err != nil {
+		return err
+	}
+
+	data.ValidateMovieAttributes(v, definitions, movie.Attributes)
+	return nil
+}
+
+// readAttributeFilter reads the attr.<name> parameters of a movie listing's query string. Only the
+// searchable attributes can be filtered by, and the values must parse as the attributes' types;
+// the errors are recorded in v. The attributes are only loaded if there are any such parameters.
+func (app *application) readAttributeFilter(
+	r *http.Request,
+	v *validator.Validator,
+) (data.AttributeFilter, error) {
+	qs := r.URL.Query()
+
+	var names []string
+	for key := range qs {
+		if name, ok := strings.CutPrefix(key, attributeParamPrefix); ok {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	definitions, err := app.models.Attributes.GetAll(r.Context())
+	if err != nil {
+		return nil, err
+	}
+	byName := make(map[string]*data.Attribute, len(definitions))
+	for _, definition := range definitions {
+		byName[definition.Name] = definition
+	}
+
+	filter := make(data.AttributeFilter, len(names))
+	for _, name := range names {
+		key := attributeParamPrefix + name
+
+		definition, ok := byName[name]
+		if !ok || !definition.Searchable {
+			v.AddError(key, validator.CodeNotPermitted, "is not a searchable attribute")
+			continue
+		}
+
+		value, ok := definition.ParseValue(qs.Get(key))
+		if !ok {
+			v.AddError(key, validator.CodeInvalid, "must be a "+definition.Type)
+			continue
+		}
+		filter[name] = value
+	}
+
+	return filter, nil
+}
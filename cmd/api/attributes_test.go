@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/walkccc/greenlight/internal/data"
+	"github.com/walkccc/greenlight/internal/validator"
+)
+
+// stubAttributeModel returns the attributes it holds from GetAll(), and panics on the other
+// methods.
+type stubAttributeModel struct {
+	data.AttributeModelInterface
+	attributes []*data.Attribute
+}
+
+func (m stubAttributeModel) GetAll(ctx context.Context) ([]*data.Attribute, error) {
+	return m.attributes, nil
+}
+
+func TestReadAttributeFilter(t *testing.T) {
+	app := &application{models: data.Models{Attributes: stubAttributeModel{
+		attributes: []*data.Attribute{
+			{Name: "studio", Type: data.AttributeString, Searchable: true},
+			{Name: "rating", Type: data.AttributeNumber, Searchable: true},
+			{Name: "budget", Type: data.AttributeNumber},
+		},
+	}}}
+
+	r := httptest.NewRequest("GET", "/v1/movies?attr.studio=A24&attr.rating=4.5&title=up", nil)
+	v := validator.New()
+	filter, err := app.readAttributeFilter(r, v)
+	require.NoError(t, err)
+	assert.True(t, v.Valid())
+	assert.Equal(t, data.AttributeFilter{"studio": "A24", "rating": 4.5}, filter)
+
+	r = httptest.NewRequest("GET", "/v1/movies?attr.rating=high&attr.budget=1&attr.color=red", nil)
+	v = validator.New()
+	_, err = app.readAttributeFilter(r, v)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"attr.rating": "attr.rating.invalid",
+		"attr.budget": "attr.budget.not_permitted",
+		"attr.color":  "attr.color.not_permitted",
+	}, v.Codes)
+
+	// The attributes aren't loaded at all without an attr.<name> parameter.
+	app.models.Attributes = nil
+	filter, err = app.readAttributeFilter(httptest.NewRequest("GET", "/v1/movies?title=up", nil), v)
+	require.NoError(t, err)
+	assert.Nil(t, filter)
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/walkccc/greenlight/internal/dto"
+	"github.com/walkccc/greenlight/internal/validator"
+)
+
+// batchResponseWriter buffers the response to one of the requests of a batch.
+type batchResponseWriter struct {
+	header     http.Header
+	statusCode int
+	buf        bytes.Buffer
+}
+
+func (bw *batchResponseWriter) Header() http.Header {
+	return bw.header
+}
+
+func (bw *batchResponseWriter) WriteHeader(statusCode int) {
+	if bw.statusCode == 0 {
+		bw.statusCode = statusCode
+	}
+}
+
+func (bw *batchResponseWriter) Write(b []byte) (int, error) {
+	if bw.statusCode == 0 {
+		bw.statusCode = http.StatusOK
+	}
+	return bw.buf.Write(b)
+}
+
+// batchHandler handles requests for "POST /v1/batch". It runs the requests one after another, with
+// the batch's authentication, so that clients on high-latency links can save round trips. Each
+// request succeeds or fails on its own, so the batch itself responds with 200 OK unless it's
+// invalid.
+func (app *application) batchHandler(w http.ResponseWriter, r *http.Request) {
+	var input dto.BatchRequest
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	if v.Struct(input); !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	for i, sub := range input.Requests {
+		v.Check(
+			isBatchablePath(sub.Path),
+			validator.Path(validator.Path("requests", i), "path"),
+			validator.CodeInvalid,
+			"must be an API path other than the batch endpoint's, e.g. /v1/movies",
+		)
+	}
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	responses := make([]dto.BatchSubResponse, 0, len(input.Requests))
+	for _, sub := range input.Requests {
+		responses = append(responses, app.runSubrequest(r, sub))
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"responses": responses}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// runSubrequest serves one of the requests of a batch, with the batch's context (and so its
+// authenticated user) and credentials.
+func (app *application) runSubrequest(
+	r *http.Request,
+	sub dto.BatchSubRequest,
+) dto.BatchSubResponse {
+	req, err := http.NewRequestWithContext(
+		r.Context(),
+		sub.Method,
+		sub.Path,
+		bytes.NewReader(sub.Body),
+	)
+	if err != nil {
+		return dto.BatchSubResponse{Status: http.StatusBadRequest, Headers: http.Header{}}
+	}
+	req.RemoteAddr = r.RemoteAddr
+	req.Header.Set("Accept", "application/json")
+	if len(sub.Body) > 0 {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if authorization := r.Header.Get("Authorization"); authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+
+	// Give the request its own route info, so that it doesn't relabel the batch in the metrics.
+	req, _ = contextSetRouteInfo(req)
+
+	bw := &batchResponseWriter{header: make(http.Header)}
+	app.subrequests.ServeHTTP(bw, req)
+
+	if bw.statusCode == 0 {
+		bw.statusCode = http.StatusOK
+	}
+
+	return dto.BatchSubResponse{
+		Status:  bw.statusCode,
+		Headers: bw.header,
+		Body:    batchBody(bw.header.Get("Content-Type"), bw.buf.Bytes()),
+	}
+}
+
+// batchBody returns a response body to embed in the batch's response: JSON bodies as they are, and
+// other bodies as JSON strings.
+func batchBody(contentType string, body []byte) json.RawMessage {
+	if len(body) == 0 {
+		return nil
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	if (mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")) &&
+		json.Valid(body) {
+		return bytes.TrimSpace(body)
+	}
+
+	js, _ := json.Marshal(string(body))
+	return js
+}
+
+// isBatchablePath reports whether the path is one of the versioned API's, other than the batch
+// endpoint itself (batches can't be nested).
+func isBatchablePath(path string) bool {
+	u, err := url.ParseRequestURI(path)
+	if err != nil || u.IsAbs() || u.Host != "" {
+		return false
+	}
+
+	for _, version := range []string{apiV1, apiV2} {
+		if rest, ok := strings.CutPrefix(u.Path, "/"+version+"/"); ok {
+			return strings.TrimSuffix(rest, "/") != "batch"
+		}
+	}
+	return false
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBatchHandler(t *testing.T) {
+	app := &application{}
+
+	router := httprouter.New()
+	router.NotFound = http.HandlerFunc(app.notFoundResponse)
+	getMovie := func(w http.ResponseWriter, r *http.Request) {
+		id := httprouter.ParamsFromContext(r.Context()).ByName("id")
+		app.writeJSON(w, http.StatusOK, envelope{"id": id}, nil)
+	}
+	createMovie := func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "text/plain")
+		w.WriteHeader(http.StatusCreated)
+		w.Write(body)
+	}
+	router.HandlerFunc(http.MethodGet, "/v1/movies/:id", getMovie)
+	router.HandlerFunc(http.MethodPost, "/v1/movies", createMovie)
+	app.subrequests = router
+
+	tests := []struct {
+		name       string
+		body       string
+		statusCode int
+		response   string
+	}{
+		{
+			name: "Success",
+			body: `{"requests": [
+				{"method": "GET", "path": "/v1/movies/1"},
+				{"method": "POST", "path": "/v1/movies", "body": {"title": "Moana"}},
+				{"method": "GET", "path": "/v2/shows"}
+			]}`,
+			statusCode: http.StatusOK,
+			response: `{"responses": [
+				{"status": 200, "headers": {"Content-Type": ["application/json"]},
+					"body": {"id": "1"}},
+				{"status": 201, "headers": {"Content-Type": ["text/plain"]},
+					"body": "{\"title\": \"Moana\"}"},
+				{"status": 404, "headers": {"Content-Type": ["application/json"]},
+					"body": {"error": "the requested resource could not be found"}}
+			]}`,
+		},
+		{
+			name: "NestedBatch",
+			body: `{"requests": [
+				{"method": "GET", "path": "/v1/movies/1"},
+				{"method": "POST", "path": "/v1/batch"}
+			]}`,
+			statusCode: http.StatusUnprocessableEntity,
+			response: `{"error": {"requests[1].path":
+				"must be an API path other than the batch endpoint's, e.g. /v1/movies"},
+				"error_codes": {"requests[1].path": "requests[1].path.invalid"}}`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, "/v1/batch", strings.NewReader(test.body))
+
+			app.batchHandler(rr, r)
+
+			assert.Equal(t, test.statusCode, rr.Code)
+			assert.JSONEq(t, test.response, rr.Body.String())
+		})
+	}
+}
+
+func TestIsBatchablePath(t *testing.T) {
+	assert.True(t, isBatchablePath("/v1/movies?page=2"))
+	assert.True(t, isBatchablePath("/v2/users/me/searches/1/movies"))
+	assert.False(t, isBatchablePath("/v1/batch"))
+	assert.False(t, isBatchablePath("/debug/vars"))
+	assert.False(t, isBatchablePath("https://example.com/v1/movies"))
+	assert.False(t, isBatchablePath("v1/movies"))
+}
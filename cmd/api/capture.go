@@ -0,0 +1,285 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// captureHeader is the request header with which an admin asks for their request to be captured.
+const captureHeader = "X-Debug-Capture"
+
+// redacted replaces the values of the sensitive headers and JSON fields in captured exchanges.
+const redacted = "[REDACTED]"
+
+// redactedHeaders holds the headers whose values are never captured.
+var redactedHeaders = []string{"Authorization", "Cookie", "Set-Cookie"}
+
+// capturedExchange is a request and its response, as recorded by the captureRequests middleware.
+// Bodies that aren't JSON, or are larger than the capture limit, are summarized rather than
+// recorded, since their secrets couldn't be redacted.
+type capturedExchange struct {
+	ID              int64       `json:"id"`
+	Time            time.Time   `json:"time"`
+	Duration        string      `json:"duration"`
+	Method          string      `json:"method"`
+	URL             string      `json:"url"`
+	UserID          int64       `json:"user_id,omitempty"`
+	Country         string      `json:"country,omitempty"`
+	ASN             uint32      `json:"asn,omitempty"`
+	RequestHeaders  http.Header `json:"request_headers"`
+	RequestBody     string      `json:"request_body,omitempty"`
+	StatusCode      int         `json:"status_code"`
+	ResponseHeaders http.Header `json:"response_headers"`
+	ResponseBody    string      `json:"response_body,omitempty"`
+}
+
+// captureRing holds the most recently captured exchanges, overwriting the oldest once it's full.
+type captureRing struct {
+	mtx     sync.Mutex
+	entries []*capturedExchange
+	next    int
+	lastID  int64
+}
+
+func newCaptureRing(size int) *captureRing {
+	return &captureRing{entries: make([]*capturedExchange, size)}
+}
+
+// add numbers the exchange and stores it in place of the oldest one.
+func (c *captureRing) add(exchange *capturedExchange) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	c.lastID++
+	exchange.ID = c.lastID
+	c.entries[c.next] = exchange
+	c.next = (c.next + 1) % len(c.entries)
+}
+
+// list returns the captured exchanges, from the newest.
+func (c *captureRing) list() []*capturedExchange {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	exchanges := []*capturedExchange{}
+	for i := 1; i <= len(c.entries); i++ {
+		exchange := c.entries[(c.next-i+len(c.entries))%len(c.entries)]
+		if exchange == nil {
+			break
+		}
+		exchanges = append(exchanges, exchange)
+	}
+	return exchanges
+}
+
+// limitedBuffer keeps the first limit bytes written to it, and notes whether anything was dropped.
+// Writes never fail, so that it can sit behind an io.TeeReader.
+type limitedBuffer struct {
+	bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	n := len(p)
+	if room := b.limit - b.Len(); n > room {
+		b.truncated = true
+		if room < 0 {
+			room = 0
+		}
+		p = p[:room]
+	}
+	b.Buffer.Write(p)
+	return n, nil
+}
+
+// captureResponseWriter copies the response it writes, up to the capture limit.
+type captureResponseWriter struct {
+	http.ResponseWriter
+	statusCode int
+	body       limitedBuffer
+}
+
+func (cw *captureResponseWriter) WriteHeader(statusCode int) {
+	if cw.statusCode == 0 {
+		cw.statusCode = statusCode
+	}
+	cw.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (cw *captureResponseWriter) Write(b []byte) (int, error) {
+	if cw.statusCode == 0 {
+		cw.statusCode = http.StatusOK
+	}
+	cw.body.Write(b)
+	return cw.ResponseWriter.Write(b)
+}
+
+func (cw *captureResponseWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+// captureRequests records requests and their responses, redacted, in the ring buffer served by
+// "GET /debug/captures", to help diagnose client integrations. With the -debug-capture flag every
+// request is captured; otherwise only those sent by an admin with the X-Debug-Capture: true header
+// are. It has to run after authenticate(), so requests rejected by it aren't captured.
+func (app *application) captureRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if app.captures == nil || !app.shouldCapture(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		start := time.Now()
+
+		requestBody := &limitedBuffer{limit: app.config.capture.maxBody}
+		r.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.TeeReader(r.Body, requestBody), r.Body}
+
+		cw := &captureResponseWriter{
+			ResponseWriter: w,
+			body:           limitedBuffer{limit: app.config.capture.maxBody},
+		}
+		next.ServeHTTP(cw, r)
+
+		if cw.statusCode == 0 {
+			cw.statusCode = http.StatusOK
+		}
+
+		location := contextGetLocation(r)
+		app.captures.add(&capturedExchange{
+			Time:            start.UTC(),
+			Duration:        time.Since(start).String(),
+			Method:          r.Method,
+			URL:             r.URL.String(),
+			UserID:          app.contextGetUser(r).ID,
+			Country:         location.Country,
+			ASN:             location.ASN,
+			RequestHeaders:  redactHeaders(r.Header),
+			RequestBody:     redactBody(r.Header.Get("Content-Type"), requestBody),
+			StatusCode:      cw.statusCode,
+			ResponseHeaders: redactHeaders(w.Header()),
+			ResponseBody:    redactBody(w.Header().Get("Content-Type"), &cw.body),
+		})
+	})
+}
+
+// shouldCapture reports whether the request is to be captured. The header is only honored for
+// users with the admin:read permission, who can already read the captures. The probes' requests
+// are never captured.
+func (app *application) shouldCapture(r *http.Request) bool {
+	if app.probes.exempt(r) {
+		return false
+	}
+	if app.config.capture.all {
+		return true
+	}
+
+	user := app.contextGetUser(r)
+	if r.Header.Get(captureHeader) != "true" || user.IsAnonymous() {
+		return false
+	}
+
+	permissions, err := app.models.Permissions.GetAllForUser(r.Context(), user.ID)
+	if err != nil {
+		app.logger.PrintError(err, nil)
+		return false
+	}
+	return permissions.Include("admin:read")
+}
+
+// listCapturesHandler handles requests for "GET /debug/captures".
+func (app *application) listCapturesHandler(w http.ResponseWriter, r *http.Request) {
+	captures := []*capturedExchange{}
+	if app.captures != nil {
+		captures = app.captures.list()
+	}
+
+	err := app.writeJSON(w, http.StatusOK, envelope{"captures": captures}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// redactHeaders returns a copy of the headers with the credentials redacted.
+func redactHeaders(header http.Header) http.Header {
+	header = header.Clone()
+	for _, name := range redactedHeaders {
+		if _, found := header[name]; found {
+			header[name] = []string{redacted}
+		}
+	}
+	return header
+}
+
+// redactBody returns the captured JSON body with its sensitive fields redacted, or a summary of the
+// body if it can't be redacted.
+func redactBody(contentType string, body *limitedBuffer) string {
+	if body.Len() == 0 && !body.truncated {
+		return ""
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	isJSON := mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+
+	switch {
+	case body.truncated:
+		return fmt.Sprintf("[more than %d bytes, not captured]", body.limit)
+	case !isJSON:
+		return fmt.Sprintf("[%d bytes of %q, not captured]", body.Len(), mediaType)
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(body.Bytes()))
+	decoder.UseNumber()
+
+	var doc any
+	if err := decoder.Decode(&doc); err != nil {
+		return fmt.Sprintf("[%d bytes of invalid JSON, not captured]", body.Len())
+	}
+
+	js, err := json.Marshal(redactJSON(doc))
+	if err != nil {
+		return fmt.Sprintf("[%d bytes, not captured]", body.Len())
+	}
+	return string(js)
+}
+
+// redactJSON walks the decoded JSON value, replacing the values held under keys that name a
+// secret (passwords and tokens) with the redacted marker.
+func redactJSON(value any) any {
+	switch value := value.(type) {
+	case map[string]any:
+		for k, v := range value {
+			if isSecretKey(k) {
+				value[k] = redacted
+			} else {
+				value[k] = redactJSON(v)
+			}
+		}
+	case []any:
+		for i, v := range value {
+			value[i] = redactJSON(v)
+		}
+	}
+	return value
+}
+
+// isSecretKey reports whether a JSON key names a secret, e.g. "password" or "token".
+func isSecretKey(key string) bool {
+	key = strings.ToLower(key)
+	for _, secret := range []string{"password", "token", "secret"} {
+		if strings.Contains(key, secret) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/walkccc/greenlight/internal/dto"
+	"github.com/walkccc/greenlight/internal/validator"
+	"github.com/walkccc/greenlight/webhook"
+)
+
+// catalogJob is a catalog update event received from an upstream provider, waiting to be
+// reconciled with the movies.
+type catalogJob struct {
+	source string
+	event  dto.CatalogEvent
+}
+
+// catalogReconciler brings the movies in line with an upstream provider's catalog, once it has
+// reported a change, e.g. by fetching the changed entry from the provider.
+type catalogReconciler interface {
+	Reconcile(ctx context.Context, source string, event dto.CatalogEvent) error
+}
+
+// logReconciler only logs the catalog updates, until a provider's reconciler is configured.
+type logReconciler struct {
+	app *application
+}
+
+func (r logReconciler) Reconcile(ctx context.Context, source string, event dto.CatalogEvent) error {
+	r.app.logger.PrintInfo("catalog update received", map[string]string{
+		"source":      source,
+		"event_id":    event.ID,
+		"event_kind":  event.Kind,
+		"external_id": event.ExternalID,
+	})
+	return nil
+}
+
+// startCatalogPool starts the workers reconciling the queued catalog updates.
+func (app *application) startCatalogPool(
+	reconciler catalogReconciler,
+	workers, queueSize int,
+) *workerPool[catalogJob] {
+	return startWorkerPool(app, "catalog pool", workers, queueSize, func(job catalogJob) {
+		err := reconciler.Reconcile(context.Background(), job.source, job.event)
+		if err != nil {
+			app.logger.PrintError(err, map[string]string{
+				"source":      job.source,
+				"event_id":    job.event.ID,
+				"external_id": job.event.ExternalID,
+			})
+		}
+	})
+}
+
+// catalogWebhookHandler handles requests for "POST /v1/webhooks/catalog/:source". Each source
+// is configured with the secret that its deliveries are signed with, in the scheme of the webhook
+// package; the unknown sources get a 404. The events are queued for reconciliation, and the
+// request is answered straight away. If the queue can't take them all, the request fails with a
+// 503 so that the provider retries it.
+func (app *application) catalogWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	source := httprouter.ParamsFromContext(r.Context()).ByName("source")
+
+	secret, ok := app.config.catalog.secrets[source]
+	if !ok || app.catalog == nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxSignedBodyBytes))
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	header := r.Header.Get(webhook.SignatureHeader)
+	err = webhook.Verify([]byte(secret), header, body, webhook.DefaultTolerance)
+	if err != nil {
+		app.invalidSignatureResponse(w, r)
+		return
+	}
+
+	var input dto.CatalogUpdateRequest
+
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	if v.Struct(input); !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	for i, event := range input.Events {
+		if !app.catalog.enqueue(catalogJob{source: source, event: event}) {
+			// The events before it were queued, and are reconciled again when the provider
+			// retries, which the reconcilers allow for.
+			app.logger.PrintInfo("catalog queue full", map[string]string{
+				"source": source,
+				"queued": fmt.Sprint(i),
+			})
+			app.serviceUnavailableResponse(w, r)
+			return
+		}
+	}
+
+	err = app.writeJSON(w, http.StatusAccepted, envelope{"accepted": len(input.Events)}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
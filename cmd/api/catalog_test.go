@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/walkccc/greenlight/greenlighttest"
+	"github.com/walkccc/greenlight/internal/dto"
+	"github.com/walkccc/greenlight/internal/jsonlog"
+	"github.com/walkccc/greenlight/webhook"
+)
+
+// recordingReconciler records the external IDs of the events it reconciles.
+type recordingReconciler struct {
+	mu  sync.Mutex
+	ids []string
+}
+
+func (r *recordingReconciler) Reconcile(
+	ctx context.Context,
+	source string,
+	event dto.CatalogEvent,
+) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.ids = append(r.ids, source+":"+event.ExternalID)
+	return nil
+}
+
+func TestCatalogWebhookHandler(t *testing.T) {
+	app := &application{logger: jsonlog.New(io.Discard, jsonlog.LevelOff)}
+	app.config.catalog.secrets = map[string]string{"tmdb": "whsec_tmdb"}
+	app.catalog = &workerPool[catalogJob]{jobs: make(chan catalogJob, 2)}
+
+	router := httprouter.New()
+	router.HandlerFunc(http.MethodPost, "/v1/webhooks/catalog/:source", app.catalogWebhookHandler)
+	client := greenlighttest.New(t, router)
+
+	body := `{"events": [
+		{"id": "evt_1", "kind": "movie.updated", "external_id": "550"},
+		{"id": "evt_2", "kind": "movie.deleted", "external_id": "551"}
+	]}`
+	signed := func(secret, body string) *greenlighttest.Client {
+		header := webhook.Sign([]byte(secret), time.Now(), []byte(body))
+		return client.WithHeader(webhook.SignatureHeader, header)
+	}
+
+	client.Post("/v1/webhooks/catalog/cms", body).AssertStatus(http.StatusNotFound)
+	client.Post("/v1/webhooks/catalog/tmdb", body).AssertStatus(http.StatusUnauthorized)
+	signed("whsec_other", body).Post("/v1/webhooks/catalog/tmdb", body).
+		AssertStatus(http.StatusUnauthorized)
+
+	invalid := `{"events": [{"kind": "movie.renamed", "external_id": "550"}]}`
+	signed("whsec_tmdb", invalid).Post("/v1/webhooks/catalog/tmdb", invalid).
+		AssertStatus(http.StatusUnprocessableEntity)
+
+	var accepted int
+	signed("whsec_tmdb", body).Post("/v1/webhooks/catalog/tmdb", body).
+		AssertStatus(http.StatusAccepted).
+		Decode("accepted", &accepted)
+	assert.Equal(t, 2, accepted)
+	assert.Equal(t, "550", (<-app.catalog.jobs).event.ExternalID)
+	assert.Equal(t, "551", (<-app.catalog.jobs).event.ExternalID)
+
+	// The provider retries the request once the queue can take it.
+	app.catalog.enqueue(catalogJob{})
+	signed("whsec_tmdb", body).Post("/v1/webhooks/catalog/tmdb", body).
+		AssertStatus(http.StatusServiceUnavailable)
+}
+
+func TestCatalogPool_Shutdown(t *testing.T) {
+	app := &application{logger: jsonlog.New(io.Discard, jsonlog.LevelOff)}
+	reconciler := &recordingReconciler{}
+	pool := app.startCatalogPool(reconciler, 2, 10)
+
+	for _, id := range []string{"550", "551", "552"} {
+		job := catalogJob{source: "tmdb", event: dto.CatalogEvent{ExternalID: id}}
+		require.True(t, pool.enqueue(job))
+	}
+
+	// The queued jobs are reconciled before the shutdown hook returns.
+	require.NoError(t, app.runShutdownHooks(context.Background()))
+	assert.ElementsMatch(t, []string{"tmdb:550", "tmdb:551", "tmdb:552"}, reconciler.ids)
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/justinas/alice"
+)
+
+// middlewareSpec declares a middleware of the standard chain that wraps the router.
+type middlewareSpec struct {
+	name  string
+	build func(app *application, next http.Handler) http.Handler
+	// required middleware can't be disabled, e.g. because the handlers rely on what they add to
+	// the request's context.
+	required bool
+	// after holds the middleware which have to run before this one if they're enabled.
+	after []string
+}
+
+// middlewareSpecs holds every middleware of the standard chain, in their default order. The
+// -middleware flag can reorder and disable them, within the constraints declared here.
+var middlewareSpecs = []middlewareSpec{
+	{name: "metrics", build: (*application).metrics},
+	{name: "request-context", build: (*application).requestContext},
+	{name: "recover-panic", build: (*application).recoverPanic},
+	{name: "method-override", build: (*application).methodOverride},
+	{name: "cors", build: (*application).enableCORS},
+	{name: "geolocate", build: (*application).geolocate},
+	{name: "rate-limit", build: (*application).rateLimit},
+	{name: "honeypot", build: (*application).honeypot},
+	{name: "authenticate-certificate", build: (*application).authenticateCertificate},
+	{name: "authenticate-signature", build: (*application).authenticateSignature},
+	{
+		name:     "authenticate",
+		build:    (*application).authenticate,
+		required: true,
+		after:    []string{"authenticate-certificate", "authenticate-signature"},
+	},
+	{
+		name:  "capture-requests",
+		build: (*application).captureRequests,
+		after: []string{"authenticate"},
+	},
+	{
+		name:  "tenant-rate-limit",
+		build: (*application).tenantRateLimit,
+		after: []string{"authenticate"},
+	},
+	{name: "pretty", build: (*application).pretty},
+	{name: "timestamps", build: (*application).timestamps},
+}
+
+// defaultMiddleware returns the names of every middleware, in their default order.
+func defaultMiddleware() []string {
+	names := make([]string, len(middlewareSpecs))
+	for i, spec := range middlewareSpecs {
+		names[i] = spec.name
+	}
+	return names
+}
+
+// validateMiddleware checks that the middleware are known, listed once, include the required ones
+// and are in an order that satisfies their constraints.
+func validateMiddleware(names []string) error {
+	specs := make(map[string]middlewareSpec, len(middlewareSpecs))
+	for _, spec := range middlewareSpecs {
+		specs[spec.name] = spec
+	}
+
+	position := make(map[string]int, len(names))
+	for i, name := range names {
+		if _, ok := specs[name]; !ok {
+			return fmt.Errorf("unknown middleware %q", name)
+		}
+		if _, ok := position[name]; ok {
+			return fmt.Errorf("middleware %q is listed twice", name)
+		}
+		position[name] = i
+	}
+
+	for _, spec := range middlewareSpecs {
+		i, enabled := position[spec.name]
+		if !enabled {
+			if spec.required {
+				return fmt.Errorf("middleware %q can't be disabled", spec.name)
+			}
+			continue
+		}
+		for _, before := range spec.after {
+			if j, ok := position[before]; ok && j > i {
+				return fmt.Errorf("middleware %q must come after %q", spec.name, before)
+			}
+		}
+	}
+
+	return nil
+}
+
+// chain returns the standard middleware chain, made of the middleware configured with the
+// -middleware flag, outermost first.
+func (app *application) chain() alice.Chain {
+	var constructors []alice.Constructor
+	for _, name := range app.config.middleware {
+		for _, spec := range middlewareSpecs {
+			if spec.name == name {
+				build := spec.build
+				constructors = append(constructors, func(next http.Handler) http.Handler {
+					return build(app, next)
+				})
+			}
+		}
+	}
+	return alice.New(constructors...)
+}
+
+// middlewareStatus is the JSON representation of a middleware, as listed by
+// "GET /debug/middleware".
+type middlewareStatus struct {
+	Name     string   `json:"name"`
+	Enabled  bool     `json:"enabled"`
+	Position int      `json:"position,omitempty"` // from 1, the outermost
+	Required bool     `json:"required,omitempty"`
+	After    []string `json:"after,omitempty"`
+}
+
+// listMiddlewareHandler handles requests for "GET /debug/middleware". The enabled middleware are
+// listed first, in their order in the chain, followed by the disabled ones.
+func (app *application) listMiddlewareHandler(w http.ResponseWriter, r *http.Request) {
+	position := make(map[string]int, len(app.config.middleware))
+	for i, name := range app.config.middleware {
+		position[name] = i + 1
+	}
+
+	middleware := make([]middlewareStatus, 0, len(middlewareSpecs))
+	for _, spec := range middlewareSpecs {
+		middleware = append(middleware, middlewareStatus{
+			Name:     spec.name,
+			Enabled:  position[spec.name] > 0,
+			Position: position[spec.name],
+			Required: spec.required,
+			After:    spec.after,
+		})
+	}
+	sort.SliceStable(middleware, func(i, j int) bool {
+		pi, pj := middleware[i].Position, middleware[j].Position
+		return pi != 0 && (pj == 0 || pi < pj)
+	})
+
+	err := app.writeJSON(w, http.StatusOK, envelope{"middleware": middleware}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
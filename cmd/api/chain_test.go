@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateMiddleware(t *testing.T) {
+	assert.NoError(t, validateMiddleware(defaultMiddleware()))
+	assert.NoError(t, validateMiddleware([]string{"recover-panic", "authenticate", "metrics"}))
+
+	tests := []struct {
+		names []string
+		err   string
+	}{
+		{[]string{"authenticate", "gzip"}, `unknown middleware "gzip"`},
+		{[]string{"authenticate", "metrics", "metrics"}, `middleware "metrics" is listed twice`},
+		{[]string{"metrics"}, `middleware "authenticate" can't be disabled`},
+		{
+			[]string{"tenant-rate-limit", "authenticate"},
+			`middleware "tenant-rate-limit" must come after "authenticate"`,
+		},
+		{
+			[]string{"authenticate", "authenticate-signature"},
+			`middleware "authenticate" must come after "authenticate-signature"`,
+		},
+	}
+	for _, tt := range tests {
+		assert.EqualError(t, validateMiddleware(tt.names), tt.err)
+	}
+}
+
+func TestListMiddlewareHandler(t *testing.T) {
+	app := &application{}
+	app.config.middleware = []string{"timestamps", "authenticate"}
+
+	rr := httptest.NewRecorder()
+	app.listMiddlewareHandler(rr, httptest.NewRequest(http.MethodGet, "/debug/middleware", nil))
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	var body struct {
+		Middleware []middlewareStatus `json:"middleware"`
+	}
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &body))
+	require.Len(t, body.Middleware, len(middlewareSpecs))
+
+	assert.Equal(t, middlewareStatus{Name: "timestamps", Enabled: true, Position: 1},
+		body.Middleware[0])
+	assert.Equal(t, "authenticate", body.Middleware[1].Name)
+	assert.Equal(t, 2, body.Middleware[1].Position)
+	assert.True(t, body.Middleware[1].Required)
+	assert.Equal(t, "metrics", body.Middleware[2].Name)
+	assert.False(t, body.Middleware[2].Enabled)
+}
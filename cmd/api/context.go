@@ -1,28 +1,103 @@
 package main
 
 import (
-	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
 
 	"github.com/walkccc/greenlight/internal/data"
+	"github.com/walkccc/greenlight/internal/reqctx"
 )
 
-type contextKey string
+// requestIDHeader is the request and response header carrying the request's ID, with which the
+// clients and the proxies in front of the API can correlate their logs with ours.
+const requestIDHeader = "X-Request-ID"
 
-const userContextKey = contextKey("user")
+var (
+	// requestIDRX matches the request IDs accepted from the clients.
+	requestIDRX = regexp.MustCompile(`^[a-zA-Z0-9._-]{1,64}$`)
+	// languageTagRX matches a BCP 47 language tag, e.g. "fr" or "zh-Hant-TW".
+	languageTagRX = regexp.MustCompile(`^[a-zA-Z]{2,8}(-[a-zA-Z0-9]{1,8})*$`)
+)
 
 // contextSetUser returns a new copy of the request with the provided User struct added to the
-// context. Note that we use our userContextKey constant as the key.
+// context.
 func (app *application) contextSetUser(r *http.Request, user *data.User) *http.Request {
-	ctx := context.WithValue(r.Context(), userContextKey, user)
-	return r.WithContext(ctx)
+	return r.WithContext(reqctx.SetUser(r.Context(), user))
+}
+
+// contextHasUser reports whether a user was already added to the request's context, e.g. by one of
+// the authentication middleware that runs before authenticate().
+func (app *application) contextHasUser(r *http.Request) bool {
+	_, ok := reqctx.User(r.Context())
+	return ok
 }
 
 // contextGetUser retrieves the User struct from the request.
 func (app *application) contextGetUser(r *http.Request) *data.User {
-	user, ok := r.Context().Value(userContextKey).(*data.User)
+	user, ok := reqctx.User(r.Context())
 	if !ok {
 		panic("missing user value in request context")
 	}
 	return user
 }
+
+// requestContext adds the request's ID and locale to its context. The ID is the client's
+// X-Request-ID header if it's a valid one, or a random one otherwise, and is sent back in the
+// response. The locale is the client's preferred language in its Accept-Language header, if any.
+func (app *application) requestContext(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if !requestIDRX.MatchString(id) {
+			id = newRequestID()
+		}
+		w.Header().Set(requestIDHeader, id)
+
+		ctx := reqctx.SetRequestID(r.Context(), id)
+		if locale := preferredLocale(r.Header.Get("Accept-Language")); locale != "" {
+			ctx = reqctx.SetLocale(ctx, locale)
+		}
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// newRequestID returns a random request ID of 32 hex digits.
+func newRequestID() string {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// preferredLocale returns the language with the highest quality in an Accept-Language header, the
+// first one listed winning a tie, or an empty string if there's none.
+func preferredLocale(header string) string {
+	var locale string
+	best := -1.0
+	for _, item := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(item), ";")
+		if !languageTagRX.MatchString(tag) {
+			continue
+		}
+
+		quality := 1.0
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			var err error
+			quality, err = strconv.ParseFloat(q, 64)
+			if err != nil {
+				continue
+			}
+		}
+
+		if quality > 0 && quality > best {
+			locale, best = tag, quality
+		}
+	}
+	return locale
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/walkccc/greenlight/internal/reqctx"
+)
+
+func TestRequestContext(t *testing.T) {
+	app := &application{}
+
+	var id, locale string
+	handler := app.requestContext(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, locale = reqctx.RequestID(r.Context()), reqctx.Locale(r.Context())
+	}))
+
+	serve := func(header http.Header) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/v1/movies", nil)
+		r.Header = header
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, r)
+		return rr
+	}
+
+	rr := serve(http.Header{
+		"X-Request-Id":    {"req-42"},
+		"Accept-Language": {"de;q=0.7, fr-CA, en;q=0.8"},
+	})
+	assert.Equal(t, "req-42", id)
+	assert.Equal(t, "req-42", rr.Header().Get(requestIDHeader))
+	assert.Equal(t, "fr-CA", locale)
+
+	// An invalid ID is replaced by a random one.
+	rr = serve(http.Header{"X-Request-Id": {"not a valid id"}})
+	assert.Len(t, id, 32)
+	assert.Equal(t, id, rr.Header().Get(requestIDHeader))
+	assert.Empty(t, locale)
+}
+
+func TestPreferredLocale(t *testing.T) {
+	tests := map[string]string{
+		"":                         "",
+		"*":                        "",
+		"fr":                       "fr",
+		"en-US,en;q=0.9":           "en-US",
+		"de;q=0.5, ja;q=0.5":       "de",
+		"es;q=0, it;q=0.1":         "it",
+		"zh-Hant-TW;q=0.9, bad q!": "zh-Hant-TW",
+		"pt;q=abc, nl;q=0.2":       "nl",
+	}
+	for header, want := range tests {
+		assert.Equal(t, want, preferredLocale(header), header)
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// debugRoutes registers the expvar metrics, the captured requests, the registered routes and
+// middleware, and the pprof profiles under /debug/ with handle, which may wrap the handlers (e.g.
+// to require a permission) before adding them to a router.
+func (app *application) debugRoutes(handle func(method, pattern string, handler http.HandlerFunc)) {
+	handle(http.MethodGet, "/debug/vars", expvar.Handler().ServeHTTP)
+	handle(http.MethodGet, "/debug/captures", app.listCapturesHandler)
+	handle(http.MethodGet, "/debug/routes", app.listRoutesHandler)
+	handle(http.MethodGet, "/debug/middleware", app.listMiddlewareHandler)
+
+	// httprouter doesn't allow a catch-all parameter next to static routes, so a single route
+	// dispatches to the pprof handlers.
+	handle(http.MethodGet, "/debug/pprof/*item", app.pprofHandler)
+	handle(http.MethodPost, "/debug/pprof/*item", app.pprofHandler)
+}
+
+// pprofHandler serves the pprof endpoints. Note that CPU profiles and traces can't last longer
+// than the server's WriteTimeout, so pass a short ?seconds= value or use the debug listener, which
+// has no write timeout.
+func (app *application) pprofHandler(w http.ResponseWriter, r *http.Request) {
+	switch httprouter.ParamsFromContext(r.Context()).ByName("item") {
+	case "/cmdline":
+		pprof.Cmdline(w, r)
+	case "/profile":
+		pprof.Profile(w, r)
+	case "/symbol":
+		pprof.Symbol(w, r)
+	case "/trace":
+		pprof.Trace(w, r)
+	default:
+		// Index() serves both the index page and the named profiles (heap, goroutine, etc.).
+		pprof.Index(w, r)
+	}
+}
+
+// serveDebug starts a separate listener that serves the /debug/ endpoints without authentication.
+// Since anyone who can reach it can capture profiles, it refuses to listen on anything other than a
+// loopback address.
+func (app *application) serveDebug() error {
+	host, _, err := net.SplitHostPort(app.config.debugAddr)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+		return fmt.Errorf("debug listener must use a loopback address, got %q", host)
+	}
+
+	router := httprouter.New()
+	app.debugRoutes(router.HandlerFunc)
+
+	server := &http.Server{
+		Addr:        app.config.debugAddr,
+		Handler:     router,
+		IdleTimeout: time.Minute,
+		ReadTimeout: 5 * time.Second,
+	}
+
+	listener, err := net.Listen("tcp", server.Addr)
+	if err != nil {
+		return err
+	}
+
+	app.onShutdown("debug server", func(ctx context.Context) error {
+		return server.Shutdown(ctx)
+	})
+
+	go func() {
+		app.logger.PrintInfo("starting debug server", map[string]string{
+			"addr": listener.Addr().String(),
+		})
+
+		err := server.Serve(listener)
+		if !errors.Is(err, http.ErrServerClosed) {
+			app.logger.PrintError(err, nil)
+		}
+	}()
+
+	return nil
+}
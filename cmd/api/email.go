@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"net"
+	"os"
+
+	"github.com/walkccc/greenlight/internal/validator"
+)
+
+// loadDenylist returns the domains that the signups are rejected for: the disposable ones, if they
+// are blocked, along with those in the denylist file, if any. It returns nil if none are.
+func loadDenylist(cfg config) (validator.Denylist, error) {
+	denylist := make(validator.Denylist)
+	if cfg.email.blockDisposable {
+		for domain := range validator.DisposableDomains {
+			denylist[domain] = true
+		}
+	}
+
+	if cfg.email.denylist != "" {
+		f, err := os.Open(cfg.email.denylist)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+
+		extra, err := validator.ParseDenylist(f)
+		if err != nil {
+			return nil, err
+		}
+		for domain := range extra {
+			denylist[domain] = true
+		}
+	}
+
+	if len(denylist) == 0 {
+		return nil, nil
+	}
+	return denylist, nil
+}
+
+// validateEmailDomain checks that the domain of a well-formed email isn't denylisted, and if the MX
+// verification is enabled, that it accepts email. A lookup that fails or times out doesn't reject
+// the email, so that a slow DNS server doesn't stop the signups.
+func (app *application) validateEmailDomain(
+	ctx context.Context,
+	v *validator.Validator,
+	email string,
+) {
+	if _, invalid := v.Errors["email"]; invalid {
+		return
+	}
+
+	domain := validator.EmailDomain(email)
+	if app.denylist.Contains(domain) {
+		v.AddError("email", validator.CodeDisposable, "must not be a disposable email address")
+		return
+	}
+
+	if !app.config.email.verifyMX {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, app.config.email.mxTimeout)
+	defer cancel()
+
+	ok, err := validator.HasMailServer(ctx, net.DefaultResolver, domain)
+	if err != nil {
+		app.logger.PrintError(err, map[string]string{"domain": domain})
+		return
+	}
+	v.Check(ok, "email", validator.CodeUndeliverable, "must be an address that can receive email")
+}
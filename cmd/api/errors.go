@@ -1,16 +1,44 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/walkccc/greenlight/internal/data"
+	"github.com/walkccc/greenlight/internal/dto"
+	"github.com/walkccc/greenlight/internal/reqctx"
+	"github.com/walkccc/greenlight/internal/validator"
 )
 
-// logError is a generic helper for logging an error message.
+// logError is a generic helper for logging an error message. It includes the ID of the
+// authenticated user (if any), so that the error reporter can tell who was affected.
 func (app *application) logError(r *http.Request, err error) {
-	app.logger.PrintError(err, map[string]string{
+	properties := map[string]string{
 		"request_method": r.Method,
 		"request_url":    r.URL.String(),
-	})
+	}
+
+	if id := reqctx.RequestID(r.Context()); id != "" {
+		properties["request_id"] = id
+	}
+
+	user, ok := reqctx.User(r.Context())
+	if ok && !user.IsAnonymous() {
+		properties["user_id"] = strconv.FormatInt(user.ID, 10)
+	}
+
+	location := contextGetLocation(r)
+	if location.Country != "" {
+		properties["country"] = location.Country
+	}
+	if location.ASN != 0 {
+		properties["asn"] = strconv.FormatUint(uint64(location.ASN), 10)
+	}
+
+	app.logger.PrintError(err, properties)
 }
 
 // errorResponse method is a generic helper for sending JSON-formatted error messages to the client
@@ -22,9 +50,41 @@ func (app *application) errorResponse(
 	statusCode int,
 	message any,
 ) {
-	env := envelope{"error": message}
+	app.errorResponseWithExtra(w, r, statusCode, message, nil)
+}
 
-	err := app.writeJSON(w, statusCode, env, nil)
+// errorResponseWithExtra sends the error message with the extra members, if any, next to it (or in
+// the meta of a JSON:API document). They're left out of XML responses.
+func (app *application) errorResponseWithExtra(
+	w http.ResponseWriter,
+	r *http.Request,
+	statusCode int,
+	message any,
+	extra envelope,
+) {
+	var err error
+	switch {
+	case app.acceptsJSONAPI(r):
+		jsonAPIErr := jsonAPIError{
+			Status: strconv.Itoa(statusCode),
+			Title:  http.StatusText(statusCode),
+			Detail: fmt.Sprint(message),
+		}
+		env := envelope{"errors": []jsonAPIError{jsonAPIErr}}
+		if extra != nil {
+			env["meta"] = extra
+		}
+		err = app.writeJSONAPI(w, statusCode, env, nil)
+	case app.acceptsXML(r):
+		env := xmlErrorEnvelope{Errors: []xmlError{{Message: fmt.Sprint(message)}}}
+		err = app.writeXML(w, statusCode, env, nil)
+	default:
+		env := envelope{"error": message}
+		for key, value := range extra {
+			env[key] = value
+		}
+		err = app.writeJSON(w, statusCode, env, nil)
+	}
 	if err != nil {
 		app.logError(r, err)
 		w.WriteHeader(http.StatusInternalServerError)
@@ -33,14 +93,29 @@ func (app *application) errorResponse(
 
 // serverErrorResponse logs the detailed error message when our application encounters an unexpected
 // problem at runtime. It uses the errorResponse() helper to send a 500 Internal Server Error status
-// code and JSON response (containing a generic error message) to the client.
+// code and JSON response (containing a generic error message) to the client. If the error is
+// because the database circuit breaker is open, we send a 503 Service Unavailable instead.
 func (app *application) serverErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, data.ErrDatabaseUnavailable) {
+		app.serviceUnavailableResponse(w, r)
+		return
+	}
+
 	app.logError(r, err)
 
 	message := "the server encountered a problem and could not process your request"
 	app.errorResponse(w, r, http.StatusInternalServerError, message)
 }
 
+// serviceUnavailableResponse sends a 503 Service Unavailable status code and JSON response to the
+// client. We don't log anything here: while the database is down, logging every request that fails
+// fast would only drown out the errors that tripped the breaker in the first place.
+func (app *application) serviceUnavailableResponse(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(app.config.db.breakerCooldown.Seconds())))
+	message := "the server is temporarily unable to handle your request, please try again later"
+	app.errorResponse(w, r, http.StatusServiceUnavailable, message)
+}
+
 // notFoundResponse sends a 404 Not Found status code and JSON response to the client.
 func (app *application) notFoundResponse(w http.ResponseWriter, r *http.Request) {
 	message := "the requested resource could not be found"
@@ -48,9 +123,13 @@ func (app *application) notFoundResponse(w http.ResponseWriter, r *http.Request)
 }
 
 // methodNotAllowedResponse sends a 405 Method Not Allowed status code and JSON response to the
-// client.
+// client. The router has set the Allow header to the methods of the resource, which the message
+// lists too.
 func (app *application) methodNotAllowedResponse(w http.ResponseWriter, r *http.Request) {
 	message := fmt.Sprintf("the %s method is not supported for this resource", r.Method)
+	if allow := w.Header().Get("Allow"); allow != "" {
+		message += fmt.Sprintf(" (supported methods: %s)", allow)
+	}
 	app.errorResponse(w, r, http.StatusMethodNotAllowed, message)
 }
 
@@ -60,13 +139,62 @@ func (app *application) badRequestResponse(w http.ResponseWriter, r *http.Reques
 }
 
 // failedValidationResponse sends a 422 Unprocessable Entity status code and JSON response to the
-// client. Note that the errors has the same type as Validator.Errors.
+// client. Alongside the error message for each field, it includes the stable error codes (e.g.
+// "title.required") so that clients can show their own text for them.
 func (app *application) failedValidationResponse(
 	w http.ResponseWriter,
 	r *http.Request,
-	errors map[string]string,
+	v *validator.Validator,
+) {
+	app.validationErrorResponse(w, r, v, nil)
+}
+
+// pageOutOfRangeResponse sends a 422 Unprocessable Entity status code and JSON response to the
+// client, for a page past the last one. The last page is included, so that clients can jump to it.
+func (app *application) pageOutOfRangeResponse(
+	w http.ResponseWriter,
+	r *http.Request,
+	lastPage int,
 ) {
-	app.errorResponse(w, r, http.StatusUnprocessableEntity, errors)
+	v := validator.New()
+	v.AddError(
+		"page",
+		validator.CodeTooLarge,
+		fmt.Sprintf("must be a maximum of %d, the last page", lastPage),
+	)
+	app.validationErrorResponse(w, r, v, envelope{"last_page": lastPage})
+}
+
+// validationErrorResponse sends the failed validation's errors, with the extra members, if any,
+// next to them (or in the meta of a JSON:API document). They're left out of XML responses.
+func (app *application) validationErrorResponse(
+	w http.ResponseWriter,
+	r *http.Request,
+	v *validator.Validator,
+	extra envelope,
+) {
+	var err error
+	switch {
+	case app.acceptsJSONAPI(r):
+		env := envelope{"errors": jsonAPIErrors(r, v)}
+		if extra != nil {
+			env["meta"] = extra
+		}
+		err = app.writeJSONAPI(w, http.StatusUnprocessableEntity, env, nil)
+	case app.acceptsXML(r):
+		env := xmlErrorEnvelope{Errors: xmlValidationErrors(v)}
+		err = app.writeXML(w, http.StatusUnprocessableEntity, env, nil)
+	default:
+		env := envelope{"error": v.Errors, "error_codes": v.Codes}
+		for key, value := range extra {
+			env[key] = value
+		}
+		err = app.writeJSON(w, http.StatusUnprocessableEntity, env, nil)
+	}
+	if err != nil {
+		app.logError(r, err)
+		w.WriteHeader(http.StatusInternalServerError)
+	}
 }
 
 // editConflictResponse sends a 409 Conflict status code and JSON response to the client.
@@ -75,6 +203,47 @@ func (app *application) editConflictResponse(w http.ResponseWriter, r *http.Requ
 	app.errorResponse(w, r, http.StatusConflict, message)
 }
 
+// movieEditConflictResponse sends a 409 Conflict status code and JSON response to the client, with
+// the movie's current state and the fields of the client's update that conflict with it, so that
+// clients can merge the changes rather than blindly retrying.
+func (app *application) movieEditConflictResponse(
+	w http.ResponseWriter,
+	r *http.Request,
+	current *data.Movie,
+	conflicts map[string]dto.FieldConflict,
+) {
+	app.formatRuntimes(w, r, current)
+	app.addMovieLinks(r, current)
+
+	message := "unable to update the record due to an edit conflict, please try again"
+	app.errorResponseWithExtra(w, r, http.StatusConflict, message, envelope{
+		"current_version": current.Version,
+		"current":         current,
+		"conflicts":       conflicts,
+	})
+}
+
+// preconditionFailedResponse sends a 412 Precondition Failed status code and JSON response to the
+// client, with the movie's current ETag if it's known.
+func (app *application) preconditionFailedResponse(
+	w http.ResponseWriter,
+	r *http.Request,
+	current *data.Movie,
+) {
+	if current != nil {
+		w.Header().Set("ETag", movieETag(current))
+	}
+	message := "the movie has been modified since you last fetched it, please fetch it again"
+	app.errorResponse(w, r, http.StatusPreconditionFailed, message)
+}
+
+// preconditionRequiredResponse sends a 428 Precondition Required status code and JSON response to
+// the client.
+func (app *application) preconditionRequiredResponse(w http.ResponseWriter, r *http.Request) {
+	message := "this request must be made conditional with an If-Match header"
+	app.errorResponse(w, r, http.StatusPreconditionRequired, message)
+}
+
 // rateLimitExceededResponse sends a 429 Too Many Requests status code and JSON response to the
 // client.
 func (app *application) rateLimitExceededResponse(w http.ResponseWriter, r *http.Request) {
@@ -82,6 +251,25 @@ func (app *application) rateLimitExceededResponse(w http.ResponseWriter, r *http
 	app.errorResponse(w, r, http.StatusTooManyRequests, message)
 }
 
+// quotaExceededResponse sends a 429 Too Many Requests status code and JSON response to the client,
+// with a Retry-After header set to when the daily quotas reset.
+func (app *application) quotaExceededResponse(w http.ResponseWriter, r *http.Request) {
+	retryAfter := untilNextUTCDay(time.Now())
+	w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter.Seconds())+1))
+	message := "your organization has used up its daily request quota"
+	app.errorResponse(w, r, http.StatusTooManyRequests, message)
+}
+
+// movieLimitReachedResponse sends a 403 Forbidden status code and JSON response to the client.
+func (app *application) movieLimitReachedResponse(
+	w http.ResponseWriter,
+	r *http.Request,
+	maxMovies int64,
+) {
+	message := fmt.Sprintf("your organization has reached its limit of %d movies", maxMovies)
+	app.errorResponse(w, r, http.StatusForbidden, message)
+}
+
 // invalidCredentialsResponse sends a 401 Unauthorized status code and JSON response to the client.
 func (app *application) invalidCredentialsResponse(w http.ResponseWriter, r *http.Request) {
 	message := "invalid authentication credentials"
@@ -96,6 +284,25 @@ func (app *application) invalidAuthenticationTokenResponse(w http.ResponseWriter
 	app.errorResponse(w, r, http.StatusUnauthorized, message)
 }
 
+// invalidSignatureResponse sends a 401 Unauthorized status code and JSON response to the client.
+func (app *application) invalidSignatureResponse(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("WWW-Authenticate", signatureScheme)
+	message := "invalid or expired request signature"
+	app.errorResponse(w, r, http.StatusUnauthorized, message)
+}
+
+// unknownCertificateResponse sends a 401 Unauthorized status code and JSON response to the client.
+func (app *application) unknownCertificateResponse(w http.ResponseWriter, r *http.Request) {
+	message := "your client certificate isn't mapped to a service account"
+	app.errorResponse(w, r, http.StatusUnauthorized, message)
+}
+
+// geoBlockedResponse sends a 403 Forbidden status code and JSON response to the client.
+func (app *application) geoBlockedResponse(w http.ResponseWriter, r *http.Request) {
+	message := "requests from your location or network aren't allowed"
+	app.errorResponse(w, r, http.StatusForbidden, message)
+}
+
 // authenticationRequiredResponse sends a 401 Unauthorized status code and JSON response to the
 // client.
 func (app *application) authenticationRequiredResponse(w http.ResponseWriter, r *http.Request) {
@@ -109,6 +316,12 @@ func (app *application) inactiveAccountResponse(w http.ResponseWriter, r *http.R
 	app.errorResponse(w, r, http.StatusForbidden, message)
 }
 
+// organizationRequiredResponse sends a 403 Forbidden status code and JSON response to the client.
+func (app *application) organizationRequiredResponse(w http.ResponseWriter, r *http.Request) {
+	message := "your authentication token must be scoped to an organization to access this resource"
+	app.errorResponse(w, r, http.StatusForbidden, message)
+}
+
 // notPermittedResponse sends a 403 Forbidden status code and JSON response to the client.
 func (app *application) notPermittedResponse(w http.ResponseWriter, r *http.Request) {
 	message := "your user account doesn't have the necessary permissions to access this resource"
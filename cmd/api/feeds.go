@@ -0,0 +1,228 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/walkccc/greenlight/internal/data"
+)
+
+// Constants for the feeds of the newest movies. httprouter doesn't allow static routes next to the
+// /movies/:id parameter, so the movie handler dispatches these IDs to movieFeedHandler().
+const (
+	atomFeedID = "feed.atom"
+	rssFeedID  = "feed.rss"
+)
+
+// atomFeed is an Atom 1.0 feed (RFC 4287).
+type atomFeed struct {
+	XMLName  xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title    string      `xml:"title"`
+	Subtitle string      `xml:"subtitle,omitempty"`
+	ID       string      `xml:"id"`
+	Updated  string      `xml:"updated"`
+	Links    []atomLink  `xml:"link"`
+	Entries  []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+	Href string `xml:"href,attr"`
+}
+
+type atomEntry struct {
+	Title      string         `xml:"title"`
+	ID         string         `xml:"id"`
+	Published  string         `xml:"published"`
+	Updated    string         `xml:"updated"`
+	Link       atomLink       `xml:"link"`
+	Summary    string         `xml:"summary"`
+	Categories []atomCategory `xml:"category"`
+}
+
+type atomCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+// rssFeed is an RSS 2.0 feed.
+type rssFeed struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	LastBuildDate string    `xml:"lastBuildDate"`
+	TTL           int       `xml:"ttl,omitempty"` // minutes
+	Items         []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title       string   `xml:"title"`
+	Link        string   `xml:"link"`
+	GUID        rssGUID  `xml:"guid"`
+	PubDate     string   `xml:"pubDate"`
+	Description string   `xml:"description"`
+	Categories  []string `xml:"category"`
+}
+
+type rssGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+// movieFeedHandler handles requests for "GET /v1/movies/feed.atom" and "GET /v1/movies/feed.rss",
+// which list the organization's newest movies. Feed readers poll, so the response can be cached
+// for the configured max age, and is revalidated against the newest movie's update time.
+func (app *application) movieFeedHandler(w http.ResponseWriter, r *http.Request, feedID string) {
+	filters := data.Filters{
+		Page:           1,
+		PageSize:       app.config.feed.limit,
+		Sort:           "-id",
+		SortSafeValues: []string{"-id"},
+		CountStrategy:  data.CountNone,
+	}
+
+	movies, _, err := app.models.Movies.GetAll(
+		r.Context(),
+		app.contextGetUser(r).OrganizationID,
+		"",
+		[]string{},
+		data.YearRange{},
+		nil,
+		filters,
+	)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// The feed was last updated when its most recently updated movie was.
+	var updated time.Time
+	for _, movie := range movies {
+		if movie.UpdatedAt.After(updated) {
+			updated = movie.UpdatedAt
+		}
+	}
+
+	w.Header().Set(
+		"Cache-Control",
+		fmt.Sprintf("private, max-age=%d", int(app.config.feed.maxAge.Seconds())),
+	)
+	if !updated.IsZero() {
+		updated = updated.Truncate(time.Second)
+		w.Header().Set("Last-Modified", updated.Format(http.TimeFormat))
+
+		since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+		if err == nil && !updated.After(since) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	} else {
+		updated = time.Now().UTC().Truncate(time.Second)
+	}
+
+	baseURL := app.feedBaseURL(r)
+	self := baseURL + app.link(r, http.MethodGet, "/movies/:id", feedID).Href
+	collection := baseURL + app.link(r, http.MethodGet, "/movies").Href
+
+	var feed any
+	contentType := "application/atom+xml; charset=utf-8"
+
+	if feedID == atomFeedID {
+		atom := atomFeed{
+			Title:    app.config.feed.title,
+			Subtitle: app.config.feed.description,
+			ID:       self,
+			Updated:  updated.Format(time.RFC3339),
+			Links: []atomLink{
+				{Rel: "self", Type: "application/atom+xml", Href: self},
+				{Rel: "alternate", Type: "application/json", Href: collection},
+			},
+		}
+		for _, movie := range movies {
+			href := baseURL + app.link(r, http.MethodGet, "/movies/:id", movie.ID).Href
+			entry := atomEntry{
+				Title:     movie.Title,
+				ID:        href,
+				Published: movie.CreatedAt.Format(time.RFC3339),
+				Updated:   movie.UpdatedAt.Format(time.RFC3339),
+				Link:      atomLink{Rel: "alternate", Type: "application/json", Href: href},
+				Summary:   movieSummary(movie),
+			}
+			for _, genre := range movie.Genres {
+				entry.Categories = append(entry.Categories, atomCategory{Term: genre})
+			}
+			atom.Entries = append(atom.Entries, entry)
+		}
+		feed = atom
+	} else {
+		rss := rssFeed{
+			Version: "2.0",
+			Channel: rssChannel{
+				Title:         app.config.feed.title,
+				Link:          collection,
+				Description:   app.config.feed.description,
+				LastBuildDate: updated.Format(time.RFC1123Z),
+				TTL:           int(app.config.feed.maxAge.Minutes()),
+			},
+		}
+		for _, movie := range movies {
+			href := baseURL + app.link(r, http.MethodGet, "/movies/:id", movie.ID).Href
+			rss.Channel.Items = append(rss.Channel.Items, rssItem{
+				Title:       movie.Title,
+				Link:        href,
+				GUID:        rssGUID{IsPermaLink: true, Value: href},
+				PubDate:     movie.CreatedAt.Format(time.RFC1123Z),
+				Description: movieSummary(movie),
+				Categories:  movie.Genres,
+			})
+		}
+		feed = rss
+		contentType = "application/rss+xml; charset=utf-8"
+	}
+
+	headers := make(http.Header)
+	headers.Set("Content-Type", contentType)
+
+	err = app.writeXML(w, http.StatusOK, feed, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// feedBaseURL returns the scheme and host that the feeds' absolute links start with. Unless it's
+// configured, it's taken from the request.
+func (app *application) feedBaseURL(r *http.Request) string {
+	if app.config.feed.baseURL != "" {
+		return strings.TrimSuffix(app.config.feed.baseURL, "/")
+	}
+
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
+
+// movieSummary returns a one-line description of the movie for its feed entry, e.g.
+// "1942, 102 mins, drama, romance".
+func movieSummary(movie *data.Movie) string {
+	var parts []string
+	if movie.Year != 0 {
+		parts = append(parts, strconv.Itoa(int(movie.Year)))
+	}
+	if movie.Runtime != 0 {
+		parts = append(parts, strconv.Itoa(int(movie.Runtime))+" mins")
+	}
+	parts = append(parts, movie.Genres...)
+	return strings.Join(parts, ", ")
+}
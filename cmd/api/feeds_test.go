@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/walkccc/greenlight/internal/data"
+)
+
+// stubMovieModel returns the same movies from GetAll(), and finds them by ID for Get(). It panics
+// on the other methods.
+type stubMovieModel struct {
+	data.MovieModelInterface
+	movies []*data.Movie
+}
+
+func (m stubMovieModel) GetAll(
+	ctx context.Context,
+	organizationID int64,
+	title string,
+	genres []string,
+	years data.YearRange,
+	attributes data.AttributeFilter,
+	filters data.Filters,
+) ([]*data.Movie, data.Metadata, error) {
+	return m.movies, data.Metadata{}, nil
+}
+
+func (m stubMovieModel) Get(ctx context.Context, organizationID, id int64) (*data.Movie, error) {
+	for _, movie := range m.movies {
+		if movie.ID == id && movie.OrganizationID == organizationID {
+			return movie, nil
+		}
+	}
+	return nil, data.ErrRecordNotFound
+}
+
+func TestMovieFeedHandler(t *testing.T) {
+	updatedAt := time.Date(2022, 1, 2, 0, 0, 0, 0, time.UTC)
+	movie := &data.Movie{
+		ID:        1,
+		CreatedAt: time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC),
+		UpdatedAt: updatedAt,
+		Title:     "Casablanca",
+		Year:      1942,
+		Runtime:   102,
+		Genres:    []string{"drama"},
+	}
+
+	app := &application{models: data.Models{Movies: stubMovieModel{movies: []*data.Movie{movie}}}}
+	app.config.feed.title = "Movies"
+	app.config.feed.limit = 20
+	app.config.feed.maxAge = 5 * time.Minute
+
+	request := func(feedID string, header http.Header) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "http://api.example.com/v1/movies/"+feedID, nil)
+		for key, value := range header {
+			r.Header[key] = value
+		}
+		r = app.contextSetUser(r, &data.User{ID: 1, OrganizationID: 1})
+
+		rr := httptest.NewRecorder()
+		app.movieFeedHandler(rr, r, feedID)
+		return rr
+	}
+
+	t.Run("Atom", func(t *testing.T) {
+		rr := request(atomFeedID, nil)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, "application/atom+xml; charset=utf-8", rr.Header().Get("Content-Type"))
+		assert.Equal(t, "private, max-age=300", rr.Header().Get("Cache-Control"))
+		assert.Equal(t, "Sun, 02 Jan 2022 00:00:00 GMT", rr.Header().Get("Last-Modified"))
+		assert.True(t, strings.Contains(rr.Body.String(), `<entry><title>Casablanca</title>`+
+			`<id>http://api.example.com/v1/movies/1</id>`+
+			`<published>2022-01-01T00:00:00Z</published><updated>2022-01-02T00:00:00Z</updated>`+
+			`<link rel="alternate" type="application/json" `+
+			`href="http://api.example.com/v1/movies/1"></link>`+
+			`<summary>1942, 102 mins, drama</summary><category term="drama"></category></entry>`),
+			rr.Body.String())
+	})
+
+	t.Run("RSS", func(t *testing.T) {
+		rr := request(rssFeedID, nil)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, "application/rss+xml; charset=utf-8", rr.Header().Get("Content-Type"))
+		assert.True(t, strings.Contains(rr.Body.String(), `<item><title>Casablanca</title>`+
+			`<link>http://api.example.com/v1/movies/1</link>`+
+			`<guid isPermaLink="true">http://api.example.com/v1/movies/1</guid>`+
+			`<pubDate>Sat, 01 Jan 2022 00:00:00 +0000</pubDate>`+
+			`<description>1942, 102 mins, drama</description><category>drama</category></item>`),
+			rr.Body.String())
+	})
+
+	t.Run("NotModified", func(t *testing.T) {
+		header := http.Header{"If-Modified-Since": {updatedAt.Format(http.TimeFormat)}}
+		rr := request(atomFeedID, header)
+
+		assert.Equal(t, http.StatusNotModified, rr.Code)
+		assert.Empty(t, rr.Body.String())
+	})
+}
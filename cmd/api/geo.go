@@ -0,0 +1,79 @@
+package main
+
+import (
+	"expvar"
+	"net"
+	"net/http"
+	"os"
+
+	"github.com/tomasen/realip"
+	"github.com/walkccc/greenlight/internal/geoip"
+	"github.com/walkccc/greenlight/internal/reqctx"
+)
+
+var locationContextKey = reqctx.NewKey[geoip.Location]("location")
+
+// loadGeoResolver returns the resolver reading the -geoip-db table, or nil if it isn't set.
+func loadGeoResolver(cfg config) (geoip.Resolver, error) {
+	if cfg.geo.database == "" {
+		return nil, nil
+	}
+
+	f, err := os.Open(cfg.geo.database)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	table, err := geoip.ParseTable(f)
+	if err != nil {
+		return nil, err
+	}
+	return table, nil
+}
+
+// geolocate tags the requests with the country and the ASN of the client's IP address, which the
+// error logs and the captured requests include, and rejects those that the blocklist blocks. The
+// requests are counted by country, and the rejected ones by the rule that blocked them; the ASNs
+// aren't counted, as there are far too many of them. It does nothing without a resolver.
+func (app *application) geolocate(next http.Handler) http.Handler {
+	var (
+		totalRequestsByCountry = expvar.NewMap("total_requests_by_country")
+		totalRequestsBlocked   = expvar.NewMap("total_requests_geo_blocked")
+	)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if app.geo == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// A failed lookup leaves the request untagged rather than rejecting it, so that a broken
+		// resolver doesn't take the API down.
+		location, err := app.geo.Lookup(net.ParseIP(realip.FromRequest(r)))
+		if err != nil {
+			app.logError(r, err)
+		}
+
+		country := location.Country
+		if country == "" {
+			country = "unknown"
+		}
+		totalRequestsByCountry.Add(country, 1)
+
+		if rule, blocked := app.geoBlocklist.Blocks(location); blocked {
+			totalRequestsBlocked.Add(rule, 1)
+			app.geoBlockedResponse(w, r)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(locationContextKey.Set(r.Context(), location)))
+	})
+}
+
+// contextGetLocation returns the location that geolocate() tagged the request with, which is empty
+// if it didn't.
+func contextGetLocation(r *http.Request) geoip.Location {
+	location, _ := locationContextKey.Get(r.Context())
+	return location
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/walkccc/greenlight/greenlighttest"
+	"github.com/walkccc/greenlight/internal/data"
+	"github.com/walkccc/greenlight/internal/jsonlog"
+)
+
+// goldenSearchIndex returns the same movies from every search, as a single page.
+type goldenSearchIndex struct {
+	data.SearchIndex
+	movies []*data.Movie
+}
+
+func (s goldenSearchIndex) Search(
+	ctx context.Context,
+	organizationID int64,
+	title string,
+	genres []string,
+	years data.YearRange,
+	attributes data.AttributeFilter,
+	filters data.Filters,
+) ([]*data.Movie, data.Metadata, error) {
+	metadata := data.Metadata{
+		CurrentPage:  1,
+		PageSize:     filters.PageSize,
+		FirstPage:    1,
+		LastPage:     1,
+		TotalRecords: len(s.movies),
+	}
+	return s.movies, metadata, nil
+}
+
+// TestGoldenResponses sends requests through the API server's routes, with the models stubbed,
+// and compares the responses with their golden files in testdata/golden, so that the changes to
+// the envelopes and to the encoding of the resources show up in review. The IDs and timestamps
+// are normalized. Run it with -update to rewrite the files.
+func TestGoldenResponses(t *testing.T) {
+	createdAt := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	movie := &data.Movie{
+		ID:             1,
+		OrganizationID: 7,
+		CreatedAt:      createdAt,
+		UpdatedAt:      createdAt,
+		Title:          "Moana",
+		Year:           2016,
+		Runtime:        107,
+		Genres:         []string{"animation", "adventure"},
+		Attributes:     map[string]any{"studio": "Disney"},
+		Version:        1,
+	}
+
+	app := &application{
+		logger: jsonlog.New(io.Discard, jsonlog.LevelOff),
+		models: data.Models{
+			Movies:    stubMovieModel{movies: []*data.Movie{movie}},
+			Search:    goldenSearchIndex{movies: []*data.Movie{movie}},
+			Redirects: stubRedirectModel{},
+			Permissions: stubPermissionModel{
+				permissions: data.Permissions{"movies:read"},
+				lookups:     new(int),
+			},
+			Attributes: stubAttributeModel{attributes: []*data.Attribute{{
+				Name:       "studio",
+				Type:       data.AttributeString,
+				Searchable: true,
+				CreatedAt:  createdAt,
+			}}},
+			SavedSearches: stubSavedSearchModel{searches: make(map[int64]*data.SavedSearch)},
+			Notifications: stubNotificationModel{
+				notifications: map[int64]*data.Notification{
+					3: {
+						ID:             3,
+						UserID:         1,
+						OrganizationID: 7,
+						CreatedAt:      createdAt,
+						Kind:           data.NotificationMovieAdded,
+						Message:        "Moana (2016) was added in animation, adventure",
+						MovieID:        &movie.ID,
+					},
+				},
+				unreadOnly: new(bool),
+			},
+		},
+		tenants: newTenantLimiters(),
+	}
+	app.config.env = "testing"
+	app.config.pagination.defaultPageSize = 20
+	app.config.pagination.maxPageSize = 100
+	app.config.pagination.maxPage = 100
+	app.config.pagination.countStrategy = "exact"
+
+	router := app.newRouter()
+	user := &data.User{ID: 1, OrganizationID: 7, Name: "Alice", Activated: true}
+	client := greenlighttest.New(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		router.ServeHTTP(w, app.contextSetUser(r, user))
+	}))
+
+	tests := []struct {
+		method  string
+		pattern string
+		path    string
+		body    any
+		status  int
+		variant string
+	}{
+		{http.MethodGet, "/healthcheck", "/v1/healthcheck", nil, http.StatusOK, ""},
+		{http.MethodGet, "/openapi.json", "/v1/openapi.json", nil, http.StatusOK, ""},
+		{http.MethodGet, "/movies", "/v1/movies", nil, http.StatusOK, ""},
+		{
+			http.MethodGet, "/movies", "/v1/movies?page_size=0", nil,
+			http.StatusUnprocessableEntity, "_invalid",
+		},
+		{http.MethodGet, "/movies/:id", "/v1/movies/1", nil, http.StatusOK, ""},
+		{http.MethodGet, "/movies/:id", "/v1/movies/2", nil, http.StatusNotFound, "_not_found"},
+		{http.MethodGet, "/attributes", "/v1/attributes", nil, http.StatusOK, ""},
+		{
+			http.MethodPost, "/users/me/searches", "/v1/users/me/searches",
+			map[string]any{"name": "Animation", "genres": []string{"animation"}, "notify": true},
+			http.StatusCreated, "",
+		},
+		{
+			http.MethodPost, "/users/me/searches", "/v1/users/me/searches",
+			map[string]any{"name": "Animation"}, http.StatusUnprocessableEntity, "_duplicate",
+		},
+		{
+			http.MethodGet, "/users/me/searches/:id", "/v1/users/me/searches/1", nil,
+			http.StatusOK, "",
+		},
+		{
+			http.MethodDelete, "/users/me/searches/:id", "/v1/users/me/searches/1", nil,
+			http.StatusOK, "",
+		},
+		{
+			http.MethodGet, "/users/me/notifications", "/v1/users/me/notifications", nil,
+			http.StatusOK, "",
+		},
+		{
+			http.MethodPatch, "/users/me/notifications/:id", "/v1/users/me/notifications/3",
+			map[string]any{"read": true}, http.StatusOK, "",
+		},
+	}
+
+	// The requests run in order, since some of them depend on the previous ones.
+	for _, tt := range tests {
+		name := greenlighttest.GoldenName(tt.method, tt.pattern) + tt.variant
+		t.Run(name, func(t *testing.T) {
+			client.WithT(t).
+				Do(tt.method, tt.path, tt.body).
+				AssertStatus(tt.status).
+				AssertGolden(name)
+		})
+	}
+}
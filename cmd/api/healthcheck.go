@@ -2,6 +2,8 @@ package main
 
 import (
 	"net/http"
+
+	"github.com/walkccc/greenlight/internal/data"
 )
 
 func (app *application) healthcheckHandler(w http.ResponseWriter, r *http.Request) {
@@ -18,3 +20,33 @@ func (app *application) healthcheckHandler(w http.ResponseWriter, r *http.Reques
 		app.serverErrorResponse(w, r, err)
 	}
 }
+
+// readinessHandler tells load balancers and orchestrators whether we're able to handle traffic. It
+// fails while the server is draining or while the database circuit breaker is open, whereas the
+// healthcheck (liveness) endpoint keeps reporting the server as available. The mailer's health is
+// reported too, but doesn't fail the check, since the emails are sent in the background and the
+// requests can still be handled without them; so is the storage's, if any, since only the uploads
+// and the downloads need it.
+func (app *application) readinessHandler(w http.ResponseWriter, r *http.Request) {
+	status := "ready"
+	statusCode := http.StatusOK
+
+	switch {
+	case app.draining.Load():
+		status = "draining"
+		statusCode = http.StatusServiceUnavailable
+	case app.models.BreakerState() == data.BreakerOpen:
+		status = "database unavailable"
+		statusCode = http.StatusServiceUnavailable
+	}
+
+	env := envelope{"status": status, "mailer": app.mailer.Health()}
+	if app.storageHealth != nil {
+		env["storage"] = app.storageHealth.Health()
+	}
+
+	err := app.writeJSON(w, statusCode, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -1,29 +1,50 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
-	"net/url"
 	"strconv"
 	"strings"
+	"sync"
+	"unicode/utf8"
 
 	"github.com/julienschmidt/httprouter"
-	"github.com/walkccc/greenlight/internal/validator"
+	"github.com/walkccc/greenlight/internal/data"
+	"github.com/walkccc/greenlight/internal/dto"
 )
 
 type envelope map[string]any
 
+// maxPooledBufferSize is the capacity above which writeJSON() drops a buffer instead of returning
+// it to the pool, so that a single huge response doesn't pin a large allocation forever.
+const maxPooledBufferSize = 1 << 20
+
+// bufferPool holds the buffers writeJSON() encodes responses into, to avoid allocating (and growing)
+// a fresh buffer for every response.
+var bufferPool = sync.Pool{
+	New: func() any {
+		return new(bytes.Buffer)
+	},
+}
+
 // readIDParam retrieves the "id" URL parameter from the current request context, then converts it
 // to an integer and returns it. If the operation isn't successful, return 0 and an error.
 func (app *application) readIDParam(r *http.Request) (int64, error) {
+	return app.readIDParamNamed(r, "id")
+}
+
+// readIDParamNamed is like readIDParam but reads the named URL parameter, for routes with more
+// than one ID (e.g. /admin/organizations/:id/members/:user_id).
+func (app *application) readIDParamNamed(r *http.Request, name string) (int64, error) {
 	params := httprouter.ParamsFromContext(r.Context())
 
-	id, err := strconv.ParseInt(params.ByName("id"), 10, 64)
+	id, err := strconv.ParseInt(params.ByName(name), 10, 64)
 	if err != nil || id < 1 {
-		return 0, errors.New("invalid id parameter")
+		return 0, fmt.Errorf("invalid %s parameter", name)
 	}
 
 	return id, nil
@@ -31,27 +52,73 @@ func (app *application) readIDParam(r *http.Request) (int64, error) {
 
 // writeJSON takes the destination http.ResponseWriter, the HTTP status code to send, the data to
 // encode to JSON, and a header map containing any additional HTTP headers we want to include in the
-// response.
+// response. The envelopes of the successful responses are reshaped as the deployment configured,
+// while the error responses always keep theirs.
 func (app *application) writeJSON(
 	w http.ResponseWriter,
 	statusCode int,
 	data envelope,
 	headers http.Header,
 ) error {
-	js, err := json.MarshalIndent(data, "", "\t")
+	if statusCode >= http.StatusBadRequest || app.config.envelope.IsZero() {
+		return app.encodeJSON(w, statusCode, data, headers)
+	}
+
+	body, metadata := app.config.envelope.Reshape(data)
+	if metadata != nil {
+		js, err := json.Marshal(metadata)
+		if err != nil {
+			return err
+		}
+		headers = headers.Clone()
+		if headers == nil {
+			headers = make(http.Header)
+		}
+		headers.Set(dto.PaginationHeader, string(js))
+	}
+	return app.encodeJSON(w, statusCode, body, headers)
+}
+
+// encodeJSON is like writeJSON(), but encodes the data as it is, e.g. for the documents whose
+// shape is fixed by a specification. The data is streamed by a json.Encoder into a pooled buffer,
+// and only written to the client once encoding succeeded, so that we can still send an error
+// response if it fails. The output is only indented in the development environment, unless the
+// client overrides it with the pretty query parameter.
+func (app *application) encodeJSON(
+	w http.ResponseWriter,
+	statusCode int,
+	data any,
+	headers http.Header,
+) error {
+	buf := bufferPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	defer func() {
+		if buf.Cap() <= maxPooledBufferSize {
+			bufferPool.Put(buf)
+		}
+	}()
+
+	encoder := json.NewEncoder(buf)
+	if app.indentsJSON() {
+		encoder.SetIndent("", "\t")
+	}
+
+	// Note that Encode() terminates the JSON with a newline character.
+	err := encoder.Encode(data)
 	if err != nil {
 		return err
 	}
 
-	js = append(js, '\n')
-
 	for key, value := range headers {
 		w.Header()[key] = value
 	}
 
-	w.Header().Set("Content-Type", "application/json")
+	// The headers can override the content type, e.g. for JSON:API documents.
+	if w.Header().Get("Content-Type") == "" {
+		w.Header().Set("Content-Type", "application/json")
+	}
 	w.WriteHeader(statusCode)
-	w.Write(js)
+	w.Write(buf.Bytes())
 	return nil
 }
 
@@ -62,16 +129,33 @@ func (app *application) readJSON(w http.ResponseWriter, r *http.Request, dst any
 	maxBytes := 1_048_576
 	r.Body = http.MaxBytesReader(w, r.Body, int64(maxBytes))
 
-	decoder := json.NewDecoder(r.Body)
+	// The body is read in full, which the limit above bounds, so that it can be checked before
+	// it's decoded: the decoder would silently replace invalid UTF-8 with U+FFFD.
+	body, err := io.ReadAll(r.Body)
+	var maxBytesError *http.MaxBytesError
+	if errors.As(err, &maxBytesError) {
+		return fmt.Errorf("body must not be larger than %d bytes", maxBytesError.Limit)
+	}
+	if err != nil {
+		return err
+	}
+	if !utf8.Valid(body) {
+		return errors.New("body contains invalid UTF-8")
+	}
+	err = app.bodyLimits().check(body)
+	if err != nil {
+		return err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(body))
 	decoder.DisallowUnknownFields()
 
-	err := decoder.Decode(dst)
+	err = decoder.Decode(dst)
 	if err != nil {
 		// If there's an error during decoding, start the triage.
 		var syntaxError *json.SyntaxError
 		var unmarshalTypeError *json.UnmarshalTypeError
 		var invalidUnmarshalError *json.InvalidUnmarshalError
-		var maxBytesError *http.MaxBytesError
 
 		switch {
 		// Check whether the error has the type *json.SyntaxError.
@@ -113,10 +197,6 @@ func (app *application) readJSON(w http.ResponseWriter, r *http.Request, dst any
 			fieldName := strings.TrimPrefix(err.Error(), "json: unknown field")
 			return fmt.Errorf("body contains unknown key %s", fieldName)
 
-		// Check whether the error has type *http.MaxBytesError.
-		case errors.As(err, &maxBytesError):
-			return fmt.Errorf("body must not be larger than %d bytes", maxBytesError.Limit)
-
 		// A json.InvalidUnmarshalError error will be returned if we pass something that is not a
 		// non-nil pointer to Decode(). panic(), rather than return an error to our handler.
 		case errors.As(err, &invalidUnmarshalError):
@@ -139,49 +219,6 @@ func (app *application) readJSON(w http.ResponseWriter, r *http.Request, dst any
 	return nil
 }
 
-// readString returns a string value from the query string. If no matching key can be found, it
-// returns the `defaultValue`.
-func (app *application) readString(qs url.Values, key string, defaultValue string) string {
-	s := qs.Get(key)
-	if s == "" {
-		return defaultValue
-	}
-	return s
-}
-
-// readCSV reads a string value from the query string and then splits it into a slice on the comma
-// character. If no matching key can be found, it returns the `defaultValue`.
-func (app *application) readCSV(qs url.Values, key string, defaultValue []string) []string {
-	csv := qs.Get(key)
-	if csv == "" {
-		return defaultValue
-	}
-	return strings.Split(csv, ",")
-}
-
-// readInt reads a string value from the query string and converts it to an integer. If no matching
-// key can be found, it returns the `defaultValue`. If the value can't be converted to an integer,
-// then it records an error message in the provided Validator instance.
-func (app *application) readInt(
-	qs url.Values,
-	key string,
-	defaultValue int,
-	v *validator.Validator,
-) int {
-	s := qs.Get(key)
-	if s == "" {
-		return defaultValue
-	}
-
-	i, err := strconv.Atoi(s)
-	if err != nil {
-		v.AddError(key, "must be an integer value")
-		return defaultValue
-	}
-
-	return i
-}
-
 // background accepts an arbitrary function as a parameter and launches a background goroutine that
 // is capable of recovering from any panics that may occur.
 func (app *application) background(fn func()) {
@@ -200,3 +237,55 @@ func (app *application) background(fn func()) {
 		fn()
 	}()
 }
+
+// paginate sets the configured pagination limits on the listing's filters, to be checked by
+// data.ValidateFilters().
+func (app *application) paginate(filters data.Filters) data.Filters {
+	filters.MaxPage = app.config.pagination.maxPage
+	filters.MaxPageSize = app.config.pagination.maxPageSize
+	return filters
+}
+
+// checkPageInRange checks that the listing's page isn't past the last page of a known total, so
+// that clients aren't sent an empty page with misleading metadata. Totals that are estimated, or
+// weren't counted, aren't known. If the page is past the last one, it sends the error response
+// and returns false.
+func (app *application) checkPageInRange(
+	w http.ResponseWriter,
+	r *http.Request,
+	filters data.Filters,
+	metadata data.Metadata,
+) bool {
+	if filters.Page <= 1 || filters.CountStrategy == data.CountEstimated {
+		return true
+	}
+
+	var lastPage int
+	switch {
+	case metadata.LastPage > 0:
+		lastPage = metadata.LastPage
+	case metadata.CurrentPage == 0:
+		// Nothing matched, so the first page is the only one.
+		lastPage = 1
+	default:
+		return true
+	}
+
+	if filters.Page <= lastPage {
+		return true
+	}
+
+	app.pageOutOfRangeResponse(w, r, lastPage)
+	return false
+}
+
+// splitList splits a comma-separated flag value, dropping the blank items.
+func splitList(val string) []string {
+	var items []string
+	for _, item := range strings.Split(val, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/walkccc/greenlight/internal/data"
+	"github.com/walkccc/greenlight/internal/dto"
+)
+
+// discardResponseWriter is a http.ResponseWriter that throws away everything written to it, so
+// that the benchmarks below only measure the encoding work.
+type discardResponseWriter struct {
+	header http.Header
+}
+
+func (w *discardResponseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *discardResponseWriter) Write(b []byte) (int, error) {
+	return len(b), nil
+}
+
+func (w *discardResponseWriter) WriteHeader(statusCode int) {}
+
+// moviesListEnvelope returns an envelope shaped like a full page of the movies list endpoint.
+func moviesListEnvelope() envelope {
+	movies := make([]*data.Movie, 100)
+	for i := range movies {
+		movies[i] = &data.Movie{
+			ID:        int64(i + 1),
+			CreatedAt: time.Now(),
+			Title:     fmt.Sprintf("Movie %d", i+1),
+			Year:      2000 + int32(i%20),
+			Runtime:   data.Runtime(90 + i%60),
+			Genres:    []string{"action", "drama", "sci-fi"},
+			Version:   1,
+		}
+	}
+
+	return envelope{
+		"movies": movies,
+		"metadata": data.Metadata{
+			CurrentPage:  1,
+			PageSize:     100,
+			FirstPage:    1,
+			LastPage:     10,
+			TotalRecords: 1000,
+		},
+	}
+}
+
+func BenchmarkWriteJSON_MoviesList(b *testing.B) {
+	env := moviesListEnvelope()
+
+	for _, environment := range []string{"production", "development"} {
+		b.Run(environment, func(b *testing.B) {
+			app := &application{config: config{env: environment}}
+			w := &discardResponseWriter{header: make(http.Header)}
+
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if err := app.writeJSON(w, http.StatusOK, env, nil); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkWriteMsgpack_MoviesList(b *testing.B) {
+	env := moviesListEnvelope()
+	app := &application{}
+	w := &discardResponseWriter{header: make(http.Header)}
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if err := app.writeMsgpack(w, http.StatusOK, env, nil); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestWriteJSON_EnvelopeShape(t *testing.T) {
+	app := &application{}
+	app.config.envelope = dto.EnvelopeShape{Keys: map[string]string{"movies": "data"}, Bare: true}
+
+	env := envelope{
+		"movies":   []string{"Moana"},
+		"metadata": data.Metadata{CurrentPage: 1, PageSize: 20},
+	}
+	rr := httptest.NewRecorder()
+	err := app.writeJSON(rr, http.StatusOK, env, nil)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `["Moana"]`, rr.Body.String())
+	assert.JSONEq(t, `{"current_page": 1, "page_size": 20}`, rr.Header().Get(dto.PaginationHeader))
+
+	env["facets"] = map[string]any{}
+	rr = httptest.NewRecorder()
+	err = app.writeJSON(rr, http.StatusOK, env, nil)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"data": ["Moana"], "metadata": {"current_page": 1, "page_size": 20},
+		"facets": {}}`, rr.Body.String())
+	assert.Empty(t, rr.Header().Get(dto.PaginationHeader))
+
+	// The error responses keep their envelope.
+	rr = httptest.NewRecorder()
+	err = app.writeJSON(rr, http.StatusNotFound, envelope{"error": "not found"}, nil)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"error": "not found"}`, rr.Body.String())
+}
+
+func TestCheckPageInRange(t *testing.T) {
+	tests := []struct {
+		name     string
+		filters  data.Filters
+		metadata data.Metadata
+		lastPage int // 0 if the page is in range
+	}{
+		{
+			name:     "LastPage",
+			filters:  data.Filters{Page: 3, PageSize: 20},
+			metadata: data.Metadata{CurrentPage: 3, PageSize: 20, FirstPage: 1, LastPage: 3},
+		},
+		{
+			name:     "PastLastPage",
+			filters:  data.Filters{Page: 5000, PageSize: 20},
+			metadata: data.Metadata{CurrentPage: 5000, PageSize: 20, FirstPage: 1, LastPage: 3},
+			lastPage: 3,
+		},
+		{
+			name:     "NoRecords",
+			filters:  data.Filters{Page: 2, PageSize: 20},
+			metadata: data.Metadata{},
+			lastPage: 1,
+		},
+		{
+			name:     "Uncounted",
+			filters:  data.Filters{Page: 5000, PageSize: 20, CountStrategy: data.CountNone},
+			metadata: data.Metadata{CurrentPage: 5000, PageSize: 20, FirstPage: 1},
+		},
+		{
+			name:     "Estimated",
+			filters:  data.Filters{Page: 2, PageSize: 20, CountStrategy: data.CountEstimated},
+			metadata: data.Metadata{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			app := &application{}
+			r := httptest.NewRequest(http.MethodGet, "/v1/movies", nil)
+			rr := httptest.NewRecorder()
+
+			ok := app.checkPageInRange(rr, r, test.filters, test.metadata)
+			assert.Equal(t, test.lastPage == 0, ok)
+			if ok {
+				return
+			}
+
+			var body struct {
+				LastPage int `json:"last_page"`
+			}
+			assert.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+			assert.Nil(t, json.NewDecoder(rr.Body).Decode(&body))
+			assert.Equal(t, test.lastPage, body.LastPage)
+		})
+	}
+}
+
+// FuzzReadJSON checks that readJSON() turns every malformed body into an error, rather than
+// panicking, and only accepts the bodies holding a single JSON object of valid UTF-8.
+func FuzzReadJSON(f *testing.F) {
+	for _, seed := range []string{
+		`{"title": "Moana", "year": 2016, "runtime": "107 mins", "genres": ["animation"]}`,
+		`{"title": "Moana"} {"title": "Moana"}`,
+		`{"year": 1e999}`,
+		`{"year": 99999999999999999999}`,
+		`{"runtime": "PT99999999999999999999M"}`,
+		`{"title": "\xff\xfe"}`,
+		`{"genres": [[[[[[[[[[[[[[[[]]]]]]]]]]]]]]]]}`,
+		`{"unknown": true}`,
+		`{"title": `,
+		``,
+	} {
+		f.Add([]byte(seed))
+	}
+
+	app := &application{}
+	f.Fuzz(func(t *testing.T, body []byte) {
+		var input dto.CreateMovieRequest
+		r := httptest.NewRequest(http.MethodPost, "/v1/movies", bytes.NewReader(body))
+
+		err := app.readJSON(httptest.NewRecorder(), r, &input)
+		if err != nil {
+			if err.Error() == "" {
+				t.Fatalf("readJSON(%q) failed with an empty message", body)
+			}
+			return
+		}
+		if !utf8.Valid(body) {
+			t.Fatalf("readJSON(%q) accepted invalid UTF-8", body)
+		}
+		if !json.Valid(body) {
+			t.Fatalf("readJSON(%q) accepted invalid JSON", body)
+		}
+	})
+}
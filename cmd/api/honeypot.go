@@ -0,0 +1,186 @@
+package main
+
+import (
+	"expvar"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tomasen/realip"
+)
+
+// defaultHoneypotPaths are the paths probed by the scanners looking for vulnerable software, which
+// the API never serves. The ones ending with a slash match every path under them.
+var defaultHoneypotPaths = []string{
+	"/.env",
+	"/.git/",
+	"/.aws/credentials",
+	"/wp-login.php",
+	"/wp-admin/",
+	"/xmlrpc.php",
+	"/phpmyadmin/",
+	"/config.php",
+	"/server-status",
+}
+
+// maxTarpitted is how many requests the honeypot holds at once. Beyond that, the scanners are
+// answered straight away, so that they can't tie up the server's goroutines.
+const maxTarpitted = 100
+
+// honeypotMatcher reports whether a path is a honeypot path, ignoring its case.
+type honeypotMatcher struct {
+	exact    map[string]bool
+	prefixes []string
+}
+
+func newHoneypotMatcher(paths []string) honeypotMatcher {
+	m := honeypotMatcher{exact: make(map[string]bool)}
+	for _, path := range paths {
+		path = strings.ToLower(path)
+		if strings.HasSuffix(path, "/") {
+			m.prefixes = append(m.prefixes, path)
+			m.exact[strings.TrimSuffix(path, "/")] = true
+		} else {
+			m.exact[path] = true
+		}
+	}
+	return m
+}
+
+func (m honeypotMatcher) match(path string) bool {
+	path = strings.ToLower(path)
+	if m.exact[path] {
+		return true
+	}
+	for _, prefix := range m.prefixes {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// bannedIPs is a temporary denylist of client IP addresses, which the rate limiter rejects. It
+// holds at most maxSize addresses, and ignores the new bans once it's full of unexpired ones.
+//
+// A nil *bannedIPs bans nobody.
+type bannedIPs struct {
+	ttl     time.Duration
+	maxSize int
+
+	mtx  sync.Mutex
+	bans map[string]time.Time // when each ban expires
+}
+
+func newBannedIPs(ttl time.Duration, maxSize int) *bannedIPs {
+	return &bannedIPs{ttl: ttl, maxSize: maxSize, bans: make(map[string]time.Time)}
+}
+
+// ban bans the IP address for the TTL, from now.
+func (b *bannedIPs) ban(ip string) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	now := time.Now()
+	if _, found := b.bans[ip]; !found && len(b.bans) >= b.maxSize {
+		b.pruneLocked(now)
+		if len(b.bans) >= b.maxSize {
+			return
+		}
+	}
+	b.bans[ip] = now.Add(b.ttl)
+}
+
+// banned returns true if the IP address is banned.
+func (b *bannedIPs) banned(ip string) bool {
+	if b == nil {
+		return false
+	}
+
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	expiry, found := b.bans[ip]
+	return found && time.Now().Before(expiry)
+}
+
+// prune forgets the expired bans.
+func (b *bannedIPs) prune() {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	b.pruneLocked(time.Now())
+}
+
+func (b *bannedIPs) pruneLocked(now time.Time) {
+	for ip, expiry := range b.bans {
+		if !now.Before(expiry) {
+			delete(b.bans, ip)
+		}
+	}
+}
+
+func (b *bannedIPs) len() int {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	return len(b.bans)
+}
+
+// honeypot answers the requests for the honeypot paths with a 404 Not Found response, after a
+// delay that slows the scanners down, and bans their IP addresses from the rest of the API for a
+// while. The hits are counted in the "honeypot" metric. It does nothing unless it's enabled.
+func (app *application) honeypot(next http.Handler) http.Handler {
+	if app.banned == nil {
+		return next
+	}
+
+	var (
+		paths     = newHoneypotMatcher(app.config.honeypot.paths)
+		tarpit    = make(chan struct{}, maxTarpitted)
+		hits      = new(expvar.Int)
+		tarpitted = new(expvar.Int)
+	)
+	expvar.Publish("honeypot", expvar.Func(func() any {
+		return map[string]int64{
+			"hits":      hits.Value(),
+			"tarpitted": tarpitted.Value(),
+			"banned":    int64(app.banned.len()),
+		}
+	}))
+
+	// A background goroutine which forgets the expired bans, once every minute.
+	go func() {
+		for {
+			time.Sleep(time.Minute)
+			app.banned.prune()
+		}
+	}()
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !paths.match(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		hits.Add(1)
+		app.banned.ban(realip.FromRequest(r))
+
+		select {
+		case tarpit <- struct{}{}:
+			tarpitted.Add(1)
+			timer := time.NewTimer(app.config.honeypot.delay)
+			select {
+			case <-timer.C:
+			case <-r.Context().Done():
+				timer.Stop()
+			}
+			tarpitted.Add(-1)
+			<-tarpit
+		default:
+		}
+
+		app.notFoundResponse(w, r)
+	})
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHoneypot(t *testing.T) {
+	app := &application{banned: newBannedIPs(time.Hour, 10)}
+	app.config.honeypot.paths = defaultHoneypotPaths
+	app.config.honeypot.delay = 20 * time.Millisecond
+	app.config.limiter.rps = 100
+	app.config.limiter.burst = 100
+	app.config.limiter.maxClients = 10
+
+	handler := app.rateLimit(app.honeypot(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {},
+	)))
+
+	serve := func(ip, path string) (int, time.Duration) {
+		r := httptest.NewRequest(http.MethodGet, path, nil)
+		r.RemoteAddr = ip + ":1234"
+		rr := httptest.NewRecorder()
+		start := time.Now()
+		handler.ServeHTTP(rr, r)
+		return rr.Code, time.Since(start)
+	}
+
+	code, _ := serve("192.0.2.1", "/v1/movies")
+	assert.Equal(t, http.StatusOK, code)
+
+	// Each scanner is only tarpitted once, as it's banned straight after.
+	for i, path := range []string{"/.env", "/.git/config", "/WP-LOGIN.php", "/wp-admin"} {
+		code, elapsed := serve("198.51.100."+strconv.Itoa(i), path)
+		assert.Equal(t, http.StatusNotFound, code, path)
+		assert.GreaterOrEqual(t, elapsed, app.config.honeypot.delay, path)
+	}
+
+	// The scanner is banned from the rest of the API, but not the other clients.
+	code, _ = serve("198.51.100.0", "/v1/movies")
+	assert.Equal(t, http.StatusTooManyRequests, code)
+	code, _ = serve("192.0.2.1", "/v1/movies")
+	assert.Equal(t, http.StatusOK, code)
+
+	code, _ = serve("192.0.2.1", "/.envelope")
+	assert.Equal(t, http.StatusOK, code)
+}
+
+func TestBannedIPs(t *testing.T) {
+	banned := newBannedIPs(time.Hour, 2)
+	banned.ban("192.0.2.1")
+	banned.ban("192.0.2.2")
+	banned.ban("192.0.2.3") // ignored, as the denylist is full
+
+	assert.True(t, banned.banned("192.0.2.1"))
+	assert.True(t, banned.banned("192.0.2.2"))
+	assert.False(t, banned.banned("192.0.2.3"))
+
+	expired := newBannedIPs(-time.Second, 2)
+	expired.ban("192.0.2.1")
+	assert.False(t, expired.banned("192.0.2.1"))
+	expired.prune()
+	assert.Equal(t, 0, expired.len())
+
+	var disabled *bannedIPs
+	assert.False(t, disabled.banned("192.0.2.1"))
+}
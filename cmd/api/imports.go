@@ -0,0 +1,340 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/walkccc/greenlight/internal/data"
+	"github.com/walkccc/greenlight/internal/dto"
+	"github.com/walkccc/greenlight/internal/validator"
+)
+
+// importChunkSize is the number of valid movies an import inserts at a time, which bounds how
+// many it holds in memory whatever the size of the body.
+const importChunkSize = 500
+
+// maxImportErrors is how many of the rejected movies an import's response details.
+const maxImportErrors = 100
+
+// defaultImportMaxBytes is the default size limit of an import's body.
+const defaultImportMaxBytes = 64 << 20
+
+// movieSource yields the movies of an import's body one at a time. next returns io.EOF once
+// there are none left. An error of type *rowError rejects its movie only; any other error ends the
+// import.
+type movieSource interface {
+	next() (*dto.CreateMovieRequest, error)
+}
+
+// rowError is an error with a single movie of an import, which still lets the import go on.
+type rowError struct {
+	v *validator.Validator
+}
+
+func (e *rowError) Error() string {
+	return fmt.Sprintf("%d invalid fields", len(e.v.Errors))
+}
+
+// jsonMovieSource decodes the elements of a JSON array one at a time.
+type jsonMovieSource struct {
+	decoder *json.Decoder
+	started bool
+}
+
+func (s *jsonMovieSource) next() (*dto.CreateMovieRequest, error) {
+	if !s.started {
+		s.started = true
+		token, err := s.decoder.Token()
+		if errors.Is(err, io.EOF) {
+			return nil, errors.New("body must not be empty")
+		}
+		if err != nil || token != json.Delim('[') {
+			return nil, errors.New("body must be a JSON array of movies")
+		}
+	}
+
+	if !s.decoder.More() {
+		// Consume the closing bracket, and make sure nothing follows it.
+		_, err := s.decoder.Token()
+		if err == nil {
+			_, err = s.decoder.Token()
+			if errors.Is(err, io.EOF) {
+				return nil, io.EOF
+			}
+		}
+		return nil, errors.New("body must only contain a single JSON array")
+	}
+
+	var input dto.CreateMovieRequest
+	err := s.decoder.Decode(&input)
+	if err != nil {
+		// A value of the wrong type is skipped by the decoder, so only that movie is rejected.
+		var unmarshalTypeError *json.UnmarshalTypeError
+		if errors.As(err, &unmarshalTypeError) && unmarshalTypeError.Field != "" {
+			v := validator.New()
+			v.AddError(unmarshalTypeError.Field, validator.CodeInvalid, "must be a valid value")
+			return nil, &rowError{v: v}
+		}
+		if errors.Is(err, data.ErrInvalidRuntimeFormat) {
+			v := validator.New()
+			v.AddError("runtime", validator.CodeInvalid, "must be a valid runtime")
+			return nil, &rowError{v: v}
+		}
+		if field, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+			v := validator.New()
+			v.AddError(strings.Trim(field, `"`), validator.CodeInvalid, "is not a movie field")
+			return nil, &rowError{v: v}
+		}
+		return nil, fmt.Errorf("body contains badly-formed JSON: %w", err)
+	}
+	return &input, nil
+}
+
+// csvMovieSource reads the records of a CSV file one at a time. The first record names the
+// columns, which are title, year, runtime and genres in any order; the genres are separated by
+// "|" and the runtime is a number of minutes or in any format a runtime can be given in JSON.
+type csvMovieSource struct {
+	reader  *csv.Reader
+	columns map[string]int
+}
+
+// csvColumns are the columns an import's CSV file can have.
+var csvColumns = []string{"title", "year", "runtime", "genres"}
+
+func (s *csvMovieSource) next() (*dto.CreateMovieRequest, error) {
+	if s.columns == nil {
+		header, err := s.reader.Read()
+		if errors.Is(err, io.EOF) {
+			return nil, errors.New("body must not be empty")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("body contains badly-formed CSV: %w", err)
+		}
+
+		s.columns = make(map[string]int)
+		for i, name := range header {
+			name = strings.ToLower(strings.TrimSpace(name))
+			if !validator.PermittedValue(name, csvColumns...) {
+				return nil, fmt.Errorf("body contains unknown column %q", name)
+			}
+			s.columns[name] = i
+		}
+		if _, ok := s.columns["title"]; !ok {
+			return nil, errors.New("body must have a title column")
+		}
+	}
+
+	record, err := s.reader.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, io.EOF
+		}
+		return nil, fmt.Errorf("body contains badly-formed CSV: %w", err)
+	}
+
+	field := func(name string) string {
+		i, ok := s.columns[name]
+		if !ok {
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+
+	input := &dto.CreateMovieRequest{Title: field("title")}
+	v := validator.New()
+
+	if year := field("year"); year != "" {
+		n, err := strconv.ParseInt(year, 10, 32)
+		v.Check(err == nil, "year", validator.CodeInvalid, "must be a valid year")
+		input.Year = int32(n)
+	}
+	if runtime := field("runtime"); runtime != "" {
+		if _, err := strconv.Atoi(runtime); err != nil {
+			runtime = strconv.Quote(runtime)
+		}
+		err := input.Runtime.UnmarshalJSON([]byte(runtime))
+		v.Check(err == nil, "runtime", validator.CodeInvalid, "must be a valid runtime")
+	}
+	if genres := field("genres"); genres != "" {
+		for _, genre := range strings.Split(genres, "|") {
+			input.Genres = append(input.Genres, strings.TrimSpace(genre))
+		}
+	}
+
+	if !v.Valid() {
+		return nil, &rowError{v: v}
+	}
+	return input, nil
+}
+
+// importMoviesHandler handles requests for "POST /v1/imports/movies". The body is a JSON array of
+// movies, or a CSV file of them with the text/csv content type. It's streamed rather than read in
+// full: each movie is validated as it's read, and the valid ones are inserted in chunks. The
+// invalid movies are skipped and reported, by their position from 1, along with how many were
+// imported.
+func (app *application) importMoviesHandler(w http.ResponseWriter, r *http.Request) {
+	organizationID := app.contextGetUser(r).OrganizationID
+
+	remaining, maxMovies, err := app.remainingMovies(r.Context(), organizationID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if maxMovies != 0 && remaining <= 0 {
+		app.movieLimitReachedResponse(w, r, maxMovies)
+		return
+	}
+
+	attributes, err := app.models.Attributes.GetAll(r.Context())
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	maxBytes := app.config.body.maxImportBytes
+	if maxBytes <= 0 {
+		maxBytes = defaultImportMaxBytes
+	}
+	body := http.MaxBytesReader(w, r.Body, maxBytes)
+
+	var source movieSource
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType == "text/csv" {
+		reader := csv.NewReader(body)
+		reader.ReuseRecord = true
+		source = &csvMovieSource{reader: reader}
+	} else {
+		decoder := json.NewDecoder(body)
+		decoder.DisallowUnknownFields()
+		source = &jsonMovieSource{decoder: decoder}
+	}
+
+	result := dto.ImportResult{Errors: []dto.ImportError{}}
+	chunk := make([]*data.Movie, 0, importChunkSize)
+	rows := make([]int, 0, importChunkSize) // the row of each movie in the chunk
+
+	rejectTooMany := func(row int) {
+		v := validator.New()
+		v.AddError("movie", validator.CodeTooMany, fmt.Sprintf(
+			"your organization has reached its limit of %d movies",
+			maxMovies,
+		))
+		app.rejectImportRow(&result, row, v)
+	}
+
+	// flush inserts the chunk. The remaining count is only an estimate, so the insert may still
+	// leave out the last movies of the chunk for the limit, in which case their rows are rejected,
+	// and so are all those that follow.
+	flush := func() error {
+		if len(chunk) == 0 {
+			return nil
+		}
+		inserted, err := app.models.Movies.InsertMany(r.Context(), chunk)
+		result.Imported += inserted
+
+		var limitErr *data.MovieLimitError
+		if errors.As(err, &limitErr) {
+			maxMovies = limitErr.MaxMovies
+			remaining = int64(result.Imported)
+			for _, row := range rows[inserted:] {
+				rejectTooMany(row)
+			}
+			err = nil
+		}
+
+		chunk = chunk[:0]
+		rows = rows[:0]
+		return err
+	}
+
+	for row := 1; ; row++ {
+		input, err := source.next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		var rowErr *rowError
+		var maxBytesError *http.MaxBytesError
+		switch {
+		case errors.As(err, &rowErr):
+			app.rejectImportRow(&result, row, rowErr.v)
+			continue
+		case errors.As(err, &maxBytesError):
+			err = fmt.Errorf("body must not be larger than %d bytes", maxBytesError.Limit)
+			fallthrough
+		case err != nil:
+			// The chunks already inserted stay, so the response says how many there were.
+			if flushErr := flush(); flushErr != nil {
+				app.serverErrorResponse(w, r, flushErr)
+				return
+			}
+			message := fmt.Sprintf("row %d: %s", row, err)
+			app.errorResponseWithExtra(w, r, http.StatusBadRequest, message, envelope{
+				"imported": result.Imported,
+			})
+			return
+		}
+
+		v := validator.New()
+		v.Struct(input)
+		movie := input.Movie(organizationID)
+		if v.Valid() {
+			data.ValidateMovie(v, movie)
+			data.ValidateMovieAttributes(v, attributes, movie.Attributes)
+		}
+		if !v.Valid() {
+			app.rejectImportRow(&result, row, v)
+			continue
+		}
+
+		if maxMovies != 0 && int64(result.Imported+len(chunk)) >= remaining {
+			rejectTooMany(row)
+			continue
+		}
+
+		chunk = append(chunk, movie)
+		rows = append(rows, row)
+		if len(chunk) == importChunkSize {
+			err := flush()
+			if err != nil {
+				app.serverErrorResponse(w, r, err)
+				return
+			}
+		}
+	}
+
+	err = flush()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"import": result}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// rejectImportRow records that the movie at the row was rejected, detailing the first
+// maxImportErrors of them.
+func (app *application) rejectImportRow(
+	result *dto.ImportResult,
+	row int,
+	v *validator.Validator,
+) {
+	result.Rejected++
+	if len(result.Errors) < maxImportErrors {
+		result.Errors = append(result.Errors, dto.ImportError{
+			Row:        row,
+			Error:      v.Errors,
+			ErrorCodes: v.Codes,
+		})
+	}
+}
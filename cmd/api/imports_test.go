@@ -0,0 +1,236 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/walkccc/greenlight/greenlighttest"
+	"github.com/walkccc/greenlight/internal/data"
+	"github.com/walkccc/greenlight/internal/dto"
+)
+
+// importMovieModel records the chunks InsertMany() is called with, and panics on the other
+// methods. If room isn't nil, it's how many more movies fit under the limit of 10 movies.
+type importMovieModel struct {
+	data.MovieModelInterface
+	chunks *[][]*data.Movie
+	room   *int
+}
+
+func (m importMovieModel) InsertMany(ctx context.Context, movies []*data.Movie) (int, error) {
+	var err error
+	if m.room != nil {
+		if len(movies) > *m.room {
+			movies = movies[:*m.room]
+			err = &data.MovieLimitError{MaxMovies: 10}
+		}
+		*m.room -= len(movies)
+	}
+	*m.chunks = append(*m.chunks, append([]*data.Movie(nil), movies...))
+	return len(movies), err
+}
+
+// importOrganizationModel reports the limits and usage it holds, and panics on the other methods.
+type importOrganizationModel struct {
+	data.OrganizationModelInterface
+	maxMovies, movies int64
+}
+
+func (m importOrganizationModel) GetLimits(
+	ctx context.Context,
+	organizationID int64,
+) (*data.OrganizationLimits, error) {
+	return &data.OrganizationLimits{OrganizationID: organizationID, MaxMovies: m.maxMovies}, nil
+}
+
+func (m importOrganizationModel) GetUsage(
+	ctx context.Context,
+	organizationID int64,
+) (*data.Usage, error) {
+	return &data.Usage{Movies: m.movies}, nil
+}
+
+func TestImportMoviesHandler(t *testing.T) {
+	newApp := func(maxMovies, movies int64) (*application, *[][]*data.Movie) {
+		chunks := new([][]*data.Movie)
+		app := &application{
+			models: data.Models{
+				Movies:        importMovieModel{chunks: chunks},
+				Organizations: importOrganizationModel{maxMovies: maxMovies, movies: movies},
+				Attributes:    stubAttributeModel{},
+			},
+			tenants: newTenantLimiters(),
+		}
+		return app, chunks
+	}
+
+	client := func(app *application) *greenlighttest.Client {
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r = app.contextSetUser(r, &data.User{ID: 1, OrganizationID: 7})
+			app.importMoviesHandler(w, r)
+		})
+		return greenlighttest.New(t, handler)
+	}
+
+	imported := func(chunks [][]*data.Movie) []string {
+		var titles []string
+		for _, chunk := range chunks {
+			for _, movie := range chunk {
+				titles = append(titles, movie.Title)
+			}
+		}
+		return titles
+	}
+
+	t.Run("JSON", func(t *testing.T) {
+		app, chunks := newApp(0, 0)
+
+		var result dto.ImportResult
+		client(app).WithT(t).Post("/v1/imports/movies", `[
+			{"title": "Moana", "year": 2016, "runtime": "107 mins", "genres": ["animation"]},
+			{"title": "", "year": 2016, "runtime": 107, "genres": ["animation"]},
+			{"title": "Up", "year": "2009", "runtime": 96, "genres": ["animation"]},
+			{"title": "Heat", "year": 1995, "runtime": "PT2H50M", "genres": ["crime"]},
+			{"title": "Jaws", "year": 1975, "runtime": 124, "genres": ["horror"], "rating": 5}
+		]`).AssertStatus(http.StatusOK).Decode("import", &result)
+
+		assert.Equal(t, 2, result.Imported)
+		assert.Equal(t, 3, result.Rejected)
+		assert.Equal(t, []string{"Moana", "Heat"}, imported(*chunks))
+		assert.Equal(t, int64(7), (*chunks)[0][0].OrganizationID)
+		assert.Equal(t, data.Runtime(170), (*chunks)[0][1].Runtime)
+		if assert.Len(t, result.Errors, 3) {
+			assert.Equal(t, 2, result.Errors[0].Row)
+			assert.Equal(t, "title.required", result.Errors[0].ErrorCodes["title"])
+			assert.Equal(t, 3, result.Errors[1].Row)
+			assert.Equal(t, "year.invalid", result.Errors[1].ErrorCodes["year"])
+			assert.Equal(t, 5, result.Errors[2].Row)
+			assert.Equal(t, "rating.invalid", result.Errors[2].ErrorCodes["rating"])
+		}
+	})
+
+	t.Run("CSV", func(t *testing.T) {
+		app, chunks := newApp(0, 0)
+
+		body := "Title,year,runtime,genres\n" +
+			"Moana,2016,107,animation|adventure\n" +
+			"Up,20o9,96,animation\n" +
+			"Heat,1995,2h50m,crime\n"
+		var result dto.ImportResult
+		client(app).WithT(t).WithHeader("Content-Type", "text/csv; charset=utf-8").
+			Post("/v1/imports/movies", body).
+			AssertStatus(http.StatusOK).
+			Decode("import", &result)
+
+		assert.Equal(t, 2, result.Imported)
+		assert.Equal(t, []string{"Moana", "Heat"}, imported(*chunks))
+		assert.Equal(t, []string{"animation", "adventure"}, (*chunks)[0][0].Genres)
+		if assert.Len(t, result.Errors, 1) {
+			assert.Equal(t, 2, result.Errors[0].Row)
+			assert.Equal(t, "year.invalid", result.Errors[0].ErrorCodes["year"])
+		}
+	})
+
+	t.Run("Chunks", func(t *testing.T) {
+		app, chunks := newApp(0, 0)
+
+		var body strings.Builder
+		body.WriteString("title,year,runtime,genres\n")
+		for i := 0; i < importChunkSize*2+1; i++ {
+			fmt.Fprintf(&body, "Movie %d,2000,90,drama\n", i)
+		}
+		var result dto.ImportResult
+		client(app).WithT(t).WithHeader("Content-Type", "text/csv").
+			Post("/v1/imports/movies", body.String()).
+			AssertStatus(http.StatusOK).
+			Decode("import", &result)
+
+		assert.Equal(t, importChunkSize*2+1, result.Imported)
+		if assert.Len(t, *chunks, 3) {
+			assert.Len(t, (*chunks)[0], importChunkSize)
+			assert.Len(t, (*chunks)[2], 1)
+		}
+	})
+
+	t.Run("MovieLimit", func(t *testing.T) {
+		app, chunks := newApp(10, 9)
+
+		var result dto.ImportResult
+		client(app).WithT(t).Post("/v1/imports/movies", `[
+			{"title": "Moana", "year": 2016, "runtime": 107, "genres": ["animation"]},
+			{"title": "Heat", "year": 1995, "runtime": 170, "genres": ["crime"]}
+		]`).AssertStatus(http.StatusOK).Decode("import", &result)
+
+		assert.Equal(t, []string{"Moana"}, imported(*chunks))
+		if assert.Len(t, result.Errors, 1) {
+			assert.Equal(t, "movie.too_many", result.Errors[0].ErrorCodes["movie"])
+		}
+
+		app, _ = newApp(10, 10)
+		client(app).WithT(t).Post("/v1/imports/movies", `[]`).
+			AssertStatus(http.StatusForbidden).
+			AssertError("your organization has reached its limit of 10 movies")
+	})
+
+	t.Run("MovieLimitReachedMeanwhile", func(t *testing.T) {
+		// There seemed to be room for five more movies, but other movies were created since, so
+		// the insert only takes one.
+		app, chunks := newApp(10, 5)
+		room := 1
+		app.models.Movies = importMovieModel{chunks: chunks, room: &room}
+
+		var result dto.ImportResult
+		client(app).WithT(t).Post("/v1/imports/movies", `[
+			{"title": "Moana", "year": 2016, "runtime": 107, "genres": ["animation"]},
+			{"title": "Heat", "year": 1995, "runtime": 170, "genres": ["crime"]},
+			{"title": "Up", "year": 2009, "runtime": 96, "genres": ["animation"]}
+		]`).AssertStatus(http.StatusOK).Decode("import", &result)
+
+		assert.Equal(t, 1, result.Imported)
+		assert.Equal(t, 2, result.Rejected)
+		assert.Equal(t, []string{"Moana"}, imported(*chunks))
+		if assert.Len(t, result.Errors, 2) {
+			assert.Equal(t, 2, result.Errors[0].Row)
+			assert.Equal(t, "movie.too_many", result.Errors[0].ErrorCodes["movie"])
+			assert.Equal(t, 3, result.Errors[1].Row)
+		}
+	})
+
+	t.Run("BadlyFormed", func(t *testing.T) {
+		app, chunks := newApp(0, 0)
+
+		response := client(app).WithT(t).Post("/v1/imports/movies", `[
+			{"title": "Moana", "year": 2016, "runtime": 107, "genres": ["animation"]},
+			{"title": "Heat",
+		`).AssertStatus(http.StatusBadRequest)
+
+		var count int
+		response.Decode("imported", &count)
+		assert.Equal(t, 1, count)
+		assert.Equal(t, []string{"Moana"}, imported(*chunks))
+
+		for _, body := range []string{``, `{"title": "Moana"}`, `[] []`} {
+			client(app).WithT(t).Post("/v1/imports/movies", body).
+				AssertStatus(http.StatusBadRequest)
+		}
+	})
+
+	t.Run("TooLarge", func(t *testing.T) {
+		app, _ := newApp(0, 0)
+		app.config.body.maxImportBytes = 16
+
+		r := httptest.NewRequest(http.MethodPost, "/v1/imports/movies",
+			strings.NewReader(`[{"title": "Moana", "year": 2016}]`))
+		r = app.contextSetUser(r, &data.User{ID: 1, OrganizationID: 7})
+		rr := httptest.NewRecorder()
+		app.importMoviesHandler(rr, r)
+
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		assert.Contains(t, rr.Body.String(), "body must not be larger than 16 bytes")
+	})
+}
@@ -0,0 +1,65 @@
+//go:build integration
+
+package main
+
+import (
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/walkccc/greenlight/greenlighttest"
+	"github.com/walkccc/greenlight/internal/jsonlog"
+	"github.com/walkccc/greenlight/internal/testdb"
+)
+
+func TestMoviesIntegration(t *testing.T) {
+	fixtures := testdb.New(t)
+
+	app := &application{
+		config:  config{middleware: []string{"request-context", "recover-panic", "authenticate"}},
+		logger:  jsonlog.New(io.Discard, jsonlog.LevelError),
+		models:  fixtures.Models,
+		tenants: newTenantLimiters(),
+	}
+	// The background tasks finish before the schema is dropped.
+	t.Cleanup(app.wg.Wait)
+
+	client := greenlighttest.New(t, app.chain().Then(app.newRouter()))
+	reader := client.WithToken(fixtures.Token(fixtures.User("movies:read")))
+	writer := client.WithToken(fixtures.Token(fixtures.User("movies:read", "movies:write")))
+
+	moana := map[string]any{
+		"title":   "Moana",
+		"year":    2016,
+		"runtime": "107 mins",
+		"genres":  []string{"animation", "adventure"},
+	}
+
+	client.Get("/v1/movies").
+		AssertStatus(http.StatusUnauthorized).
+		AssertError("you must be authenticated to access this resource")
+	reader.Post("/v1/movies", moana).AssertStatus(http.StatusForbidden)
+	writer.Post("/v1/movies", map[string]any{"year": 2016}).
+		AssertValidationError("title", "required")
+
+	var created struct {
+		ID      int64  `json:"id"`
+		Title   string `json:"title"`
+		Runtime string `json:"runtime"`
+	}
+	response := writer.Post("/v1/movies", moana).
+		AssertStatus(http.StatusCreated).
+		Decode("movie", &created)
+	assert.Equal(t, "Moana", created.Title)
+	assert.Equal(t, "107 mins", created.Runtime)
+	assert.NotEmpty(t, response.Header.Get("Location"))
+
+	var listed []struct {
+		ID int64 `json:"id"`
+	}
+	reader.Get("/v1/movies?title=moana").AssertStatus(http.StatusOK).Decode("movies", &listed)
+	if assert.Len(t, listed, 1) {
+		assert.Equal(t, created.ID, listed[0].ID)
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/json"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/walkccc/greenlight/internal/data"
+	"github.com/walkccc/greenlight/internal/validator"
+)
+
+// jsonAPIMediaType is the media type of JSON:API documents (https://jsonapi.org), which clients can
+// ask for with the Accept header instead of the API's own envelopes.
+const jsonAPIMediaType = "application/vnd.api+json"
+
+// jsonAPIResource is a JSON:API resource object. Its attributes are the model's JSON encoding,
+// without the id and the links.
+type jsonAPIResource struct {
+	Type       string            `json:"type"`
+	ID         string            `json:"id"`
+	Attributes map[string]any    `json:"attributes"`
+	Links      map[string]string `json:"links,omitempty"`
+}
+
+// jsonAPIError is a JSON:API error object.
+type jsonAPIError struct {
+	Status string            `json:"status"`
+	Code   string            `json:"code,omitempty"`
+	Title  string            `json:"title"`
+	Detail string            `json:"detail,omitempty"`
+	Source map[string]string `json:"source,omitempty"`
+}
+
+// acceptsJSONAPI reports whether the client asked for a JSON:API document. Media type parameters
+// are allowed, so that e.g. the runtime format can still be chosen.
+func (app *application) acceptsJSONAPI(r *http.Request) bool {
+	for _, mediaRange := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, _, err := mime.ParseMediaType(mediaRange)
+		if err == nil && mediaType == jsonAPIMediaType {
+			return true
+		}
+	}
+	return false
+}
+
+// newJSONAPIResource returns the resource object of the model with the given type and ID. Its links
+// are the model's GET links; the others don't fit JSON:API's links, which are always fetched.
+func newJSONAPIResource(
+	resourceType string,
+	id int64,
+	links data.Links,
+	model any,
+) (jsonAPIResource, error) {
+	js, err := json.Marshal(model)
+	if err != nil {
+		return jsonAPIResource{}, err
+	}
+
+	var attributes map[string]any
+	err = json.Unmarshal(js, &attributes)
+	if err != nil {
+		return jsonAPIResource{}, err
+	}
+	delete(attributes, "id")
+	delete(attributes, "_links")
+
+	resource := jsonAPIResource{
+		Type:       resourceType,
+		ID:         strconv.FormatInt(id, 10),
+		Attributes: attributes,
+	}
+
+	for rel, link := range links {
+		if link.Method == "" {
+			if resource.Links == nil {
+				resource.Links = make(map[string]string)
+			}
+			resource.Links[rel] = link.Href
+		}
+	}
+
+	return resource, nil
+}
+
+// writeJSONAPI writes a JSON:API document with the given top-level members (e.g. data and meta).
+func (app *application) writeJSONAPI(
+	w http.ResponseWriter,
+	statusCode int,
+	doc envelope,
+	headers http.Header,
+) error {
+	if headers == nil {
+		headers = make(http.Header)
+	}
+	headers.Set("Content-Type", jsonAPIMediaType)
+
+	doc["jsonapi"] = map[string]string{"version": "1.1"}
+	return app.encodeJSON(w, statusCode, doc, headers)
+}
+
+// jsonAPIErrors returns the JSON:API error objects for the failed validation. The errors point to
+// the query parameters for GET requests, and to the attributes of the request body otherwise.
+func jsonAPIErrors(r *http.Request, v *validator.Validator) []jsonAPIError {
+	keys := make([]string, 0, len(v.Errors))
+	for key := range v.Errors {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	pointer := strings.NewReplacer(".", "/", "[", "/", "]", "")
+
+	errs := make([]jsonAPIError, len(keys))
+	for i, key := range keys {
+		errs[i] = jsonAPIError{
+			Status: strconv.Itoa(http.StatusUnprocessableEntity),
+			Code:   v.Codes[key],
+			Title:  http.StatusText(http.StatusUnprocessableEntity),
+			Detail: key + " " + v.Errors[key],
+		}
+		if r.Method == http.MethodGet {
+			errs[i].Source = map[string]string{"parameter": key}
+		} else {
+			errs[i].Source = map[string]string{
+				"pointer": "/data/attributes/" + pointer.Replace(key),
+			}
+		}
+	}
+
+	return errs
+}
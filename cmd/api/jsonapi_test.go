@@ -0,0 +1,89 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/walkccc/greenlight/internal/data"
+	"github.com/walkccc/greenlight/internal/validator"
+)
+
+func TestWriteMovie_JSONAPI(t *testing.T) {
+	app := &application{}
+	createdAt := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	movie := &data.Movie{
+		ID:        7,
+		CreatedAt: createdAt,
+		UpdatedAt: createdAt,
+		Title:     "Casablanca",
+		Year:      1942,
+		Runtime:   102,
+		Genres:    []string{"drama"},
+		Version:   1,
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/v1/movies/7", nil)
+	r.Header.Set("Accept", "application/vnd.api+json; runtime=minutes")
+	rr := httptest.NewRecorder()
+
+	require.NoError(t, app.writeMovie(rr, r, http.StatusOK, movie, nil))
+
+	assert.Equal(t, jsonAPIMediaType, rr.Header().Get("Content-Type"))
+	assert.JSONEq(t, `{
+		"jsonapi": {"version": "1.1"},
+		"data": {
+			"type": "movies",
+			"id": "7",
+			"attributes": {
+				"created_at": "2022-01-01T00:00:00Z",
+				"updated_at": "2022-01-01T00:00:00Z",
+				"title": "Casablanca",
+				"year": 1942,
+				"runtime": 102,
+				"genres": ["drama"],
+				"attributes": {},
+				"version": 1
+			},
+			"links": {"self": "/v1/movies/7", "collection": "/v1/movies"}
+		}
+	}`, rr.Body.String())
+}
+
+func TestFailedValidationResponse_JSONAPI(t *testing.T) {
+	app := &application{}
+
+	v := validator.New()
+	v.AddError("title", validator.CodeRequired, "must be provided")
+	v.AddError(validator.Path("genres", 1), validator.CodeDuplicate, "must not be a duplicate")
+
+	r := httptest.NewRequest(http.MethodPost, "/v1/movies", nil)
+	r.Header.Set("Accept", jsonAPIMediaType)
+	rr := httptest.NewRecorder()
+
+	app.failedValidationResponse(rr, r, v)
+
+	assert.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+	assert.JSONEq(t, `{
+		"jsonapi": {"version": "1.1"},
+		"errors": [
+			{
+				"status": "422",
+				"code": "genres[1].duplicate",
+				"title": "Unprocessable Entity",
+				"detail": "genres[1] must not be a duplicate",
+				"source": {"pointer": "/data/attributes/genres/1"}
+			},
+			{
+				"status": "422",
+				"code": "title.required",
+				"title": "Unprocessable Entity",
+				"detail": "title must be provided",
+				"source": {"pointer": "/data/attributes/title"}
+			}
+		]
+	}`, rr.Body.String())
+}
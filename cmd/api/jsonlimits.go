@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"unicode/utf8"
+)
+
+// The default limits on the shape of the JSON request bodies.
+const (
+	defaultBodyMaxDepth        = 32
+	defaultBodyMaxFields       = 10_000
+	defaultBodyMaxStringLength = 65_536
+)
+
+// jsonLimits bounds the shape of a JSON request body, on top of its size: a body well within the
+// size limit can still be nested deeply enough, or hold enough members, to make decoding it cost
+// far more than reading it.
+type jsonLimits struct {
+	maxDepth        int // the deepest nesting of objects and arrays
+	maxFields       int // the number of object members, across the whole body
+	maxStringLength int // the length of the longest string, key or value, in characters
+}
+
+// bodyLimits returns the configured limits on the request bodies, with the defaults for those
+// that aren't set.
+func (app *application) bodyLimits() jsonLimits {
+	limits := jsonLimits{
+		maxDepth:        app.config.body.maxDepth,
+		maxFields:       app.config.body.maxFields,
+		maxStringLength: app.config.body.maxStringLength,
+	}
+	if limits.maxDepth <= 0 {
+		limits.maxDepth = defaultBodyMaxDepth
+	}
+	if limits.maxFields <= 0 {
+		limits.maxFields = defaultBodyMaxFields
+	}
+	if limits.maxStringLength <= 0 {
+		limits.maxStringLength = defaultBodyMaxStringLength
+	}
+	return limits
+}
+
+// check returns an error if the body exceeds a limit. It walks the body's tokens rather than
+// decoding it, so it never holds more than one of them. A body that isn't valid JSON passes, so
+// that the decoder reports its syntax error.
+func (l jsonLimits) check(body []byte) error {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+
+	// The stack holds the open objects and arrays. The objects record whether their next token
+	// is a member's key, which Token() returns as a string like any other.
+	type container struct {
+		object bool
+		key    bool
+	}
+	var stack []container
+	fields := 0
+
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return nil
+		}
+
+		if n := len(stack); n > 0 && stack[n-1].key && token != json.Delim('}') {
+			stack[n-1].key = false
+			fields++
+			if fields > l.maxFields {
+				return fmt.Errorf("body must not contain more than %d fields", l.maxFields)
+			}
+			if err := l.checkString(token.(string)); err != nil {
+				return err
+			}
+			continue
+		}
+
+		switch token := token.(type) {
+		case json.Delim:
+			if token == '{' || token == '[' {
+				stack = append(stack, container{object: token == '{', key: token == '{'})
+				if len(stack) > l.maxDepth {
+					return fmt.Errorf(
+						"body must not be nested more than %d levels deep",
+						l.maxDepth,
+					)
+				}
+				continue
+			}
+			stack = stack[:len(stack)-1]
+		case string:
+			if err := l.checkString(token); err != nil {
+				return err
+			}
+		}
+
+		// A value ended, so the object holding it expects a key next.
+		if n := len(stack); n > 0 && stack[n-1].object {
+			stack[n-1].key = true
+		}
+	}
+}
+
+func (l jsonLimits) checkString(s string) error {
+	if len(s) > l.maxStringLength && utf8.RuneCountInString(s) > l.maxStringLength {
+		return fmt.Errorf(
+			"body must not contain strings longer than %d characters",
+			l.maxStringLength,
+		)
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadJSONLimits(t *testing.T) {
+	app := &application{}
+	app.config.body.maxDepth = 3
+	app.config.body.maxFields = 4
+	app.config.body.maxStringLength = 5
+
+	tests := []struct {
+		name string
+		body string
+		err  string // empty if the body is accepted
+	}{
+		{name: "WithinLimits", body: `{"a": {"b": ["héllo", 1]}, "c": [], "d": {}}`},
+		{
+			name: "TooDeep",
+			body: `{"a": [[{}]]}`,
+			err:  "body must not be nested more than 3 levels deep",
+		},
+		{
+			name: "TooManyFields",
+			body: `{"a": 1, "b": {"c": 2, "d": 3}, "e": 4}`,
+			err:  "body must not contain more than 4 fields",
+		},
+		{
+			name: "ArrayElementsAreNotFields",
+			body: `{"a": ["x", "y", "z", "w", "v"]}`,
+		},
+		{
+			name: "LongValue",
+			body: `{"a": "sixsix"}`,
+			err:  "body must not contain strings longer than 5 characters",
+		},
+		{
+			name: "LongKey",
+			body: `{"sixsix": 1}`,
+			err:  "body must not contain strings longer than 5 characters",
+		},
+		// The decoder reports the syntax errors, even past a limit.
+		{
+			name: "BadlyFormed",
+			body: `{"a": [}`,
+			err:  "body contains badly-formed JSON (at character 8)",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var dst map[string]any
+			r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tt.body))
+
+			err := app.readJSON(httptest.NewRecorder(), r, &dst)
+			if tt.err == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, tt.err)
+			}
+		})
+	}
+
+	// The limits default when they aren't configured.
+	assert.Equal(t, jsonLimits{
+		maxDepth:        defaultBodyMaxDepth,
+		maxFields:       defaultBodyMaxFields,
+		maxStringLength: defaultBodyMaxStringLength,
+	}, (&application{}).bodyLimits())
+}
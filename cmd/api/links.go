@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/walkccc/greenlight/internal/data"
+)
+
+var (
+	apiPatternsOnce sync.Once
+	apiPatterns     map[string]bool // keyed by the method and pattern, e.g. "GET /movies/:id"
+)
+
+// link returns a link to the versioned API route with the given method and pattern (e.g.
+// /movies/:id), under the request's API version. The pattern's parameters are replaced by args, in
+// order. It panics if no route has the pattern, so that a typo can't ship a dead link.
+func (app *application) link(r *http.Request, method, pattern string, args ...any) data.Link {
+	apiPatternsOnce.Do(func() {
+		apiPatterns = make(map[string]bool)
+		app.apiRoutes(func(method, pattern string, handler http.HandlerFunc) {
+			apiPatterns[method+" "+pattern] = true
+		})
+	})
+
+	if !apiPatterns[method+" "+pattern] {
+		panic(fmt.Sprintf("no API route for %s %s", method, pattern))
+	}
+
+	segments := strings.Split(pattern, "/")
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, ":") {
+			if len(args) == 0 {
+				panic(fmt.Sprintf("missing argument for %s in %s", segment, pattern))
+			}
+			segments[i] = fmt.Sprint(args[0])
+			args = args[1:]
+		}
+	}
+
+	link := data.Link{Href: "/" + app.contextGetAPIVersion(r) + strings.Join(segments, "/")}
+	if method != http.MethodGet {
+		link.Method = method
+	}
+	return link
+}
+
+// addMovieLinks sets the links of the movies in the response.
+func (app *application) addMovieLinks(r *http.Request, movies ...*data.Movie) {
+	for _, movie := range movies {
+		movie.Links = data.Links{
+			"self":       app.link(r, http.MethodGet, "/movies/:id", movie.ID),
+			"collection": app.link(r, http.MethodGet, "/movies"),
+			"update":     app.link(r, http.MethodPatch, "/movies/:id", movie.ID),
+			"delete":     app.link(r, http.MethodDelete, "/movies/:id", movie.ID),
+		}
+	}
+}
+
+// addUserLinks sets the links of the user in the response. There's no endpoint that returns a user
+// by ID, so the links point to the next steps of the sign-up flow instead.
+func (app *application) addUserLinks(r *http.Request, user *data.User) {
+	user.Links = data.Links{
+		"authenticate": app.link(r, http.MethodPost, "/tokens/authentication"),
+	}
+	if !user.Activated {
+		user.Links["activate"] = app.link(r, http.MethodPut, "/users/activated")
+	}
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/walkccc/greenlight/internal/data"
+)
+
+func TestAddMovieLinks(t *testing.T) {
+	app := &application{}
+	r := app.contextSetAPIVersion(httptest.NewRequest(http.MethodGet, "/v2/movies/7", nil), apiV2)
+
+	movie := &data.Movie{ID: 7}
+	app.addMovieLinks(r, movie)
+
+	assert.Equal(t, data.Links{
+		"self":       {Href: "/v2/movies/7"},
+		"collection": {Href: "/v2/movies"},
+		"update":     {Href: "/v2/movies/7", Method: http.MethodPatch},
+		"delete":     {Href: "/v2/movies/7", Method: http.MethodDelete},
+	}, movie.Links)
+}
+
+func TestLink_UnknownRoute(t *testing.T) {
+	app := &application{}
+	r := httptest.NewRequest(http.MethodGet, "/v1/movies", nil)
+
+	assert.Panics(t, func() { app.link(r, http.MethodGet, "/movie/:id", 1) })
+	assert.Panics(t, func() { app.link(r, http.MethodPut, "/movies/:id", 1) })
+	assert.Panics(t, func() { app.link(r, http.MethodGet, "/movies/:id") })
+}
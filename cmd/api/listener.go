@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// listenFdsStart is the first file descriptor passed by systemd socket activation (after stdin,
+// stdout and stderr).
+const listenFdsStart = 3
+
+// listenAddress returns the address the server listens on: the -listen flag if it's set (e.g.
+// "unix:/run/greenlight.sock" or "127.0.0.1:4000"), otherwise all interfaces on the -port flag.
+func (app *application) listenAddress() string {
+	if app.config.listen.addr != "" {
+		return app.config.listen.addr
+	}
+	return fmt.Sprintf(":%d", app.config.port)
+}
+
+// listen returns the listener that the server accepts connections on. If the process was started
+// by systemd socket activation, we use the inherited socket, so that systemd keeps accepting (and
+// queueing) connections while the service restarts. Otherwise, we bind the address ourselves:
+// either a Unix domain socket (for deployments behind a local reverse proxy), or a TCP address,
+// optionally with SO_REUSEPORT so that a newly deployed process can bind the same port and start
+// accepting connections before the old one drains and exits.
+func (app *application) listen() (net.Listener, error) {
+	listener, err := systemdListener()
+	if err != nil || listener != nil {
+		return listener, err
+	}
+
+	addr := app.listenAddress()
+	if path, ok := strings.CutPrefix(addr, "unix:"); ok {
+		return app.listenUnix(path)
+	}
+	addr = strings.TrimPrefix(addr, "tcp:")
+
+	lc := net.ListenConfig{}
+	if app.config.reusePort {
+		lc.Control = reusePortControl
+	}
+
+	return lc.Listen(context.Background(), "tcp", addr)
+}
+
+// listenUnix listens on a Unix domain socket at path, with the file permissions set by the
+// -listen-socket-mode flag. A socket file left behind by a previous process that didn't shut down
+// cleanly is removed first (note that the listener removes the file itself when it's closed).
+func (app *application) listenUnix(path string) (net.Listener, error) {
+	mode, err := strconv.ParseUint(app.config.listen.socketMode, 8, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid socket mode %q: %w", app.config.listen.socketMode, err)
+	}
+
+	info, err := os.Stat(path)
+	switch {
+	case err == nil && info.Mode()&os.ModeSocket != 0:
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	case err == nil:
+		return nil, fmt.Errorf("%s already exists and isn't a socket", path)
+	case !errors.Is(err, fs.ErrNotExist):
+		return nil, err
+	}
+
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+
+	err = os.Chmod(path, os.FileMode(mode))
+	if err != nil {
+		listener.Close()
+		return nil, err
+	}
+
+	return listener, nil
+}
+
+// systemdListener returns the listener passed by systemd socket activation, or nil if there isn't
+// one. See sd_listen_fds(3) for the protocol.
+func systemdListener() (net.Listener, error) {
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, nil
+	}
+
+	fds, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || fds < 1 {
+		return nil, nil
+	}
+	if fds > 1 {
+		return nil, fmt.Errorf("expected a single socket from systemd, got %d", fds)
+	}
+
+	// Unset the variables so that they aren't inherited by any child processes.
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+
+	file := os.NewFile(listenFdsStart, "systemd-socket")
+	if file == nil {
+		return nil, errors.New("invalid systemd socket file descriptor")
+	}
+	defer file.Close()
+
+	// FileListener() duplicates the file descriptor, so it's safe to close the file afterwards.
+	return net.FileListener(file)
+}
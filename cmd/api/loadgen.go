@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/walkccc/greenlight/internal/loadgen"
+)
+
+// runLoadgen runs the "loadgen" subcommand, which replays a traffic mix against an instance and
+// reports the latency percentiles of each kind of request, e.g.
+//
+//	api loadgen -target=http://localhost:4000 -scenario=list-heavy -concurrency=50 -duration=1m
+func runLoadgen(args []string, stdout, stderr io.Writer) error {
+	var cfg loadgen.Config
+	var scenario string
+	var asJSON bool
+
+	flags := flag.NewFlagSet("loadgen", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.StringVar(&cfg.Target, "target", "http://localhost:4000", "Base URL of the instance")
+	flags.StringVar(
+		&scenario,
+		"scenario",
+		"list-heavy",
+		"Traffic mix to replay ("+strings.Join(scenarioNames(), "|")+")",
+	)
+	flags.IntVar(&cfg.Concurrency, "concurrency", 10, "Number of concurrent workers")
+	flags.DurationVar(&cfg.Duration, "duration", 30*time.Second, "How long the run lasts")
+	flags.IntVar(
+		&cfg.Requests,
+		"requests",
+		0,
+		"Number of requests after which the run stops, if it's before the duration (0 = no limit)",
+	)
+	flags.StringVar(&cfg.Token, "token", "", "Bearer token of the requests")
+	flags.StringVar(&cfg.Email, "email", "", "Email of the logins (auth-churn)")
+	flags.StringVar(&cfg.Password, "password", "", "Password of the logins (auth-churn)")
+	flags.Int64Var(&cfg.Seed, "seed", time.Now().UnixNano(), "Seed of the random choices")
+	flags.BoolVar(&asJSON, "json", false, "Write the report as JSON")
+
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	var ok bool
+	cfg.Scenario, ok = loadgen.Scenarios[scenario]
+	if !ok {
+		return fmt.Errorf("unknown scenario %q", scenario)
+	}
+
+	// Interrupting the run still reports on the requests sent so far.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	fmt.Fprintf(stderr, "replaying %s (%s) against %s with %d workers, seed %d\n",
+		cfg.Scenario.Name, cfg.Scenario.Description, cfg.Target, cfg.Concurrency, cfg.Seed)
+
+	report, err := loadgen.Run(ctx, cfg)
+	if err != nil {
+		return err
+	}
+
+	if asJSON {
+		encoder := json.NewEncoder(stdout)
+		encoder.SetIndent("", "\t")
+		return encoder.Encode(report)
+	}
+	_, err = report.WriteTo(stdout)
+	return err
+}
+
+func scenarioNames() []string {
+	names := make([]string, 0, len(loadgen.Scenarios))
+	for name := range loadgen.Scenarios {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -3,20 +3,31 @@ package main
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"expvar"
 	"flag"
 	"fmt"
 	"net/http"
+	"net/url"
 	"os"
 	"runtime"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"text/template"
 	"time"
 
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
+	"github.com/walkccc/greenlight/internal/captcha"
 	"github.com/walkccc/greenlight/internal/data"
+	"github.com/walkccc/greenlight/internal/dto"
+	"github.com/walkccc/greenlight/internal/geoip"
 	"github.com/walkccc/greenlight/internal/jsonlog"
 	"github.com/walkccc/greenlight/internal/mailer"
+	"github.com/walkccc/greenlight/internal/reporter"
+	"github.com/walkccc/greenlight/internal/sms"
+	"github.com/walkccc/greenlight/internal/storage"
+	"github.com/walkccc/greenlight/internal/validator"
 	"github.com/walkccc/greenlight/internal/vcs"
 )
 
@@ -26,59 +37,611 @@ var (
 
 // config holds all the configuration settings for our application.
 type config struct {
-	port int
-	env  string
-	db   struct {
-		dsn          string
-		maxOpenConns int
-		maxIdleConns int
-		maxIdleTime  string
+	port      int
+	reusePort bool
+	listen    struct {
+		addr       string
+		socketMode string
 	}
-	limiter struct {
-		rps     float64 // request-per-second
-		burst   int
+	h2c struct {
+		enabled              bool
+		maxConcurrentStreams uint
+	}
+	mtls struct {
+		addr         string // the mTLS listener's address, off if empty
+		certFile     string
+		keyFile      string
+		clientCAFile string // the CAs that the client certificates must be signed by
+	}
+	debugAddr string
+	mock      struct {
+		enabled bool   // serve fixture data, without a database
+		dir     string // of the templates overriding the generated fixtures
+	}
+	env             string
+	shutdownTimeout time.Duration
+	drainDelay      time.Duration
+	db              struct {
+		dsn               string
+		maxOpenConns      int
+		maxIdleConns      int
+		maxIdleTime       time.Duration
+		maxLifetime       time.Duration
+		prepareStatements bool
+		queryTimeout      time.Duration
+		statementTimeout  time.Duration
+		listings          bool
+		permissionTTL     time.Duration
+		breakerThreshold  int
+		breakerCooldown   time.Duration
+		maxRetries        int
+		retryBackoff      time.Duration
+	}
+	email struct {
+		keys     string // comma-separated id:key pairs, in base64
+		indexKey string // in base64
+		decrypt  bool
+
+		blockDisposable bool
+		denylist        string // file of domains rejected along with the disposable ones
+		verifyMX        bool
+		mxTimeout       time.Duration
+	}
+	geo struct {
+		database       string // CSV table of the networks' countries and ASNs, off if empty
+		blockCountries string // comma-separated ISO country codes
+		blockASNs      string
+	}
+	honeypot struct {
 		enabled bool
+		paths   []string
+		delay   time.Duration // before the honeypot paths are answered
+		banTTL  time.Duration // how long the IP addresses hitting them are banned
+	}
+	metrics struct {
+		excludeRoutes []string // route labels or patterns left out of the route metrics
+	}
+	limiter struct {
+		rps            float64 // request-per-second
+		burst          int
+		maxClients     int
+		enabled        bool
+		tenantsEnabled bool
+		probePaths     []string // exempt from the limiter, see probeExemption
+		probeCIDRs     []string
 	}
 	smtp struct {
-		host     string
-		port     int
-		username string
-		password string
-		sender   string
+		host         string
+		port         int
+		username     string
+		password     string
+		sender       string
+		templateDir  string // overrides the embedded templates, if set
+		brand        string
+		supportEmail string
+		frontendURL  string
+		maxIdle      int // idle connections kept open between the emails
+		idleTimeout  time.Duration
+	}
+	twilio struct {
+		accountSID string
+		authToken  string
+		from       string // a phone number, or a messaging service SID
+	}
+	storage struct {
+		storage.Config               // the uploads and exports are disabled without a backend
+		urlTTL         time.Duration // how long the signed download URLs are valid
+	}
+	posters struct {
+		workers   int
+		queueSize int
 	}
 	cors struct {
 		trustedOrigins []string
 	}
+	body struct {
+		maxDepth        int
+		maxFields       int
+		maxStringLength int
+		maxImportBytes  int64
+	}
+	envelope   dto.EnvelopeShape // of the successful JSON responses
+	pagination struct {
+		countStrategy   string
+		defaultPageSize int
+		maxPageSize     int
+		maxPage         int
+	}
+	feed struct {
+		title       string
+		description string
+		limit       int           // the number of movies listed
+		maxAge      time.Duration // how long clients can cache the feeds
+		baseURL     string        // the feeds' absolute links start with it, or the request's host
+	}
+	search struct {
+		backend string
+		url     string // of the Elasticsearch cluster
+		index   string
+	}
+	capture struct {
+		all     bool // capture every request, not just the admins' who ask for it
+		size    int  // the number of captured requests kept
+		maxBody int  // bytes, beyond which the bodies aren't captured
+	}
+	sentry struct {
+		dsn string
+	}
+	outbox struct {
+		webhookURL    string
+		webhookSecret string // signs the deliveries if set, see the webhook package
+		pollInterval  time.Duration
+		batchSize     int
+		retention     time.Duration // how long the delivered events are kept
+	}
+	archive struct {
+		interval  time.Duration // zero disables the archiver
+		retention time.Duration // how long the deleted movies and expired tokens are kept
+		batchSize int
+	}
+	activation struct {
+		redirectURL string // the frontend page that the activation links redirect to, if any
+	}
+	signatures struct {
+		maxSkew time.Duration // how far a signed request's date may be from the server's clock
+	}
+	catalog struct {
+		secrets   map[string]string // the inbound webhook's secret of each source
+		workers   int
+		queueSize int
+	}
+	signup struct {
+		captchaProvider string // "hcaptcha" or "turnstile", off if empty
+		captchaSecret   string
+		perIP           int // signups per hour, 0 disables the limit
+		perDomain       int
+	}
+	tokens struct {
+		activationTTL     time.Duration
+		authenticationTTL time.Duration
+	}
+	panics struct {
+		alertInterval time.Duration // between two alerts for the same panic
+		webhookURL    string
+	}
+	middleware       []string // the standard middleware chain, outermost first
+	runtimeFormat    data.RuntimeFormat
+	requireIfMatch   bool // on the requests deleting movies
+	routeSuggestions bool // the 404 responses suggest the near-miss routes
+	tokenSecret      string
+	deprecations     map[string]deprecationSchedule // keyed by API version
 }
 
 // application holds the dependencies for out HTTP handlers, helpers, and middleware.
 type application struct {
-	config config
-	logger *jsonlog.Logger
-	models data.Models
-	mailer mailer.Mailer
-	wg     sync.WaitGroup
+	config        config
+	logger        *jsonlog.Logger
+	models        data.Models
+	mailer        mailer.Mailer
+	sms           sms.Sender // nil if the SMS alerts are disabled
+	denylist      validator.Denylist
+	captcha       captcha.Verifier // nil if the signups don't need a CAPTCHA
+	geo           geoip.Resolver   // nil if the requests aren't geolocated
+	geoBlocklist  geoip.Blocklist
+	signups       *signupLimiter
+	banned        *bannedIPs // nil if the honeypot is disabled
+	probes        *probeExemption
+	wg            sync.WaitGroup
+	shutdownHooks []shutdownHook
+	tenants       *tenantLimiters
+	captures      *captureRing            // nil if capturing is disabled
+	storage       storage.Storage         // nil if no storage backend is configured
+	storageHealth *storage.Monitor        // nil with the storage
+	catalog       *workerPool[catalogJob] // nil if no catalog source is configured
+	posters       *workerPool[posterJob]  // nil with the storage
+	webhook       *webhookPublisher       // nil if the outbox relay is disabled
+	panics        *panicTracker
+	panicHooks    []panicHook
+	subrequests   http.Handler       // serves the requests of a batch, see routes()
+	mocks         *template.Template // the -mock mode's templates, if any
+
+	// draining is set once the server starts draining, and makes the readiness probe fail.
+	draining       atomic.Bool
+	drainRequested chan struct{}
+	drainOnce      sync.Once
 }
 
 func main() {
+	// The subcommands have flags of their own.
+	if len(os.Args) > 1 && os.Args[1] == "loadgen" {
+		err := runLoadgen(os.Args[2:], os.Stdout, os.Stderr)
+		if err != nil && !errors.Is(err, flag.ErrHelp) {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	var cfg config
 
 	flag.IntVar(&cfg.port, "port", 4000, "API server port")
+	flag.BoolVar(
+		&cfg.reusePort,
+		"reuse-port",
+		false,
+		"Bind the port with SO_REUSEPORT, so a new process can take over during deploys",
+	)
+	flag.StringVar(
+		&cfg.listen.addr,
+		"listen",
+		"",
+		"Listen address, e.g. 127.0.0.1:4000 or unix:/run/greenlight.sock (overrides -port)",
+	)
+	flag.StringVar(
+		&cfg.listen.socketMode,
+		"listen-socket-mode",
+		"0660",
+		"File permissions of the Unix domain socket",
+	)
+	flag.BoolVar(&cfg.h2c.enabled, "h2c", false, "Enable HTTP/2 over cleartext connections (h2c)")
+	flag.UintVar(
+		&cfg.h2c.maxConcurrentStreams,
+		"h2c-max-concurrent-streams",
+		250,
+		"Maximum number of concurrent HTTP/2 streams per h2c connection",
+	)
+	flag.StringVar(
+		&cfg.mtls.addr,
+		"mtls-addr",
+		"",
+		"Address of a listener requiring client certificates, e.g. :4443 (off if empty)",
+	)
+	flag.StringVar(&cfg.mtls.certFile, "mtls-cert", "", "TLS certificate of the mTLS listener")
+	flag.StringVar(&cfg.mtls.keyFile, "mtls-key", "", "TLS private key of the mTLS listener")
+	flag.StringVar(
+		&cfg.mtls.clientCAFile,
+		"mtls-client-ca",
+		"",
+		"PEM bundle of the CAs that the client certificates must be signed by",
+	)
+	flag.BoolVar(
+		&cfg.mock.enabled,
+		"mock",
+		false,
+		"Answer every API route with fixture data, without a database, for contract testing",
+	)
+	flag.StringVar(
+		&cfg.mock.dir,
+		"mock-dir",
+		"",
+		`Directory of *.tmpl files defining mock responses, e.g. {{define "GET /movies/:id"}}`,
+	)
+	flag.StringVar(
+		&cfg.debugAddr,
+		"debug-addr",
+		"",
+		"Loopback address for an unauthenticated pprof/expvar listener, e.g. localhost:6060",
+	)
+	flag.BoolVar(
+		&cfg.capture.all,
+		"debug-capture",
+		false,
+		"Capture every request and response (redacted) for GET /debug/captures",
+	)
+	flag.IntVar(
+		&cfg.capture.size,
+		"debug-capture-size",
+		100,
+		"Number of captured requests kept (0 disables capturing)",
+	)
+	flag.IntVar(
+		&cfg.capture.maxBody,
+		"debug-capture-max-body",
+		64<<10,
+		"Largest request or response body captured, in bytes",
+	)
 	flag.StringVar(&cfg.env, "env", "development", "Environment (development|staging|production)")
+	flag.DurationVar(
+		&cfg.shutdownTimeout,
+		"shutdown-timeout",
+		30*time.Second,
+		"Grace period for in-flight requests and shutdown hooks to complete",
+	)
+	flag.DurationVar(
+		&cfg.drainDelay,
+		"drain-delay",
+		0,
+		"How long readiness fails before shutting down on SIGTERM or an admin drain request",
+	)
 
 	flag.StringVar(&cfg.db.dsn, "db-dsn", "", "PostgreSQL DSN")
 	flag.IntVar(&cfg.db.maxOpenConns, "db-max-open-conns", 25, "PostgreSQL max open connections")
 	flag.IntVar(&cfg.db.maxIdleConns, "db-max-idle-conns", 25, "PostgreSQL max idle connections")
-	flag.StringVar(
+	flag.DurationVar(
 		&cfg.db.maxIdleTime,
 		"db-max-idle-time",
-		"15m",
+		15*time.Minute,
 		"PostgreSQL max connection idle time",
 	)
+	flag.DurationVar(
+		&cfg.db.maxLifetime,
+		"db-max-lifetime",
+		0,
+		"PostgreSQL max connection lifetime (0 means connections are reused forever)",
+	)
+	flag.BoolVar(
+		&cfg.db.prepareStatements,
+		"db-prepare-statements",
+		true,
+		"Cache prepared statements for hot queries",
+	)
+	flag.DurationVar(
+		&cfg.db.queryTimeout,
+		"db-query-timeout",
+		data.DefaultQueryTimeout,
+		"How long a database query may run before it's canceled",
+	)
+	flag.DurationVar(
+		&cfg.db.statementTimeout,
+		"db-statement-timeout",
+		0,
+		"PostgreSQL statement_timeout set on every connection (0 keeps the server's default)",
+	)
+	flag.BoolVar(
+		&cfg.db.listings,
+		"db-listings",
+		true,
+		"Serve the unfiltered movie listings from the denormalized movie_listings table",
+	)
+	flag.DurationVar(
+		&cfg.db.permissionTTL,
+		"db-permission-cache-ttl",
+		10*time.Second,
+		"How long the users' permissions are cached for (disabled if zero)",
+	)
+	flag.IntVar(
+		&cfg.db.breakerThreshold,
+		"db-breaker-threshold",
+		5,
+		"Consecutive database failures before failing fast (0 disables the circuit breaker)",
+	)
+	flag.DurationVar(
+		&cfg.db.breakerCooldown,
+		"db-breaker-cooldown",
+		30*time.Second,
+		"How long the database circuit breaker stays open before retrying",
+	)
+	flag.IntVar(
+		&cfg.db.maxRetries,
+		"db-max-retries",
+		2,
+		"Times a query is retried after a transient database error (0 disables retries)",
+	)
+	flag.DurationVar(
+		&cfg.db.retryBackoff,
+		"db-retry-backoff",
+		50*time.Millisecond,
+		"Most the first retry of a query waits for, doubling with every retry",
+	)
+
+	flag.StringVar(
+		&cfg.email.keys,
+		"email-keys",
+		"",
+		"Comma-separated id:key pairs of base64 keys encrypting the emails (off if empty)",
+	)
+	flag.StringVar(
+		&cfg.email.indexKey,
+		"email-index-key",
+		"",
+		"Base64 key of the blind index the encrypted emails are looked up by",
+	)
+	flag.BoolVar(
+		&cfg.email.decrypt,
+		"email-decrypt",
+		false,
+		"Decrypt the encrypted emails and store them in plaintext again",
+	)
+	flag.BoolVar(
+		&cfg.email.blockDisposable,
+		"email-block-disposable",
+		true,
+		"Reject the signups with an address of a disposable email service",
+	)
+	flag.StringVar(
+		&cfg.email.denylist,
+		"email-denylist",
+		"",
+		"File of email domains to reject along with the disposable ones, one per line",
+	)
+	flag.BoolVar(
+		&cfg.email.verifyMX,
+		"email-verify-mx",
+		false,
+		"Reject the signups whose email domain has no mail server",
+	)
+	flag.DurationVar(
+		&cfg.email.mxTimeout,
+		"email-mx-timeout",
+		2*time.Second,
+		"Most the MX record lookup of a signup takes before the email is accepted anyway",
+	)
+
+	flag.StringVar(
+		&cfg.activation.redirectURL,
+		"activation-redirect-url",
+		"",
+		"Frontend URL that the activation links redirect to (a minimal page is shown if empty)",
+	)
+	flag.DurationVar(
+		&cfg.tokens.activationTTL,
+		"token-activation-ttl",
+		3*24*time.Hour,
+		"How long the activation tokens emailed to the new users are valid",
+	)
+	flag.DurationVar(
+		&cfg.tokens.authenticationTTL,
+		"token-authentication-ttl",
+		24*time.Hour,
+		"How long the authentication tokens are valid",
+	)
+	flag.StringVar(
+		&cfg.tokenSecret,
+		"token-secret",
+		"",
+		"Secret of at least 32 bytes that the tokens are hashed with (SHA-256 if empty)",
+	)
 
 	flag.Float64Var(&cfg.limiter.rps, "limiter-rps", 2, "Rate limiter maximum requests per second")
 	flag.IntVar(&cfg.limiter.burst, "limiter-burst", 4, "Rate limiter maximum burst")
+	flag.IntVar(
+		&cfg.limiter.maxClients,
+		"limiter-max-clients",
+		100_000,
+		"Rate limiter maximum number of tracked clients",
+	)
 	flag.BoolVar(&cfg.limiter.enabled, "limiter-enabled", true, "Enable rate limiter")
+	cfg.limiter.probePaths = defaultProbePaths
+	flag.Func(
+		"limiter-probe-paths",
+		"Paths of the health probes, exempt from the rate limiter (comma separated)",
+		func(val string) error {
+			cfg.limiter.probePaths = splitList(val)
+			return nil
+		},
+	)
+	flag.Func(
+		"limiter-probe-cidrs",
+		"Networks the health probes come from, e.g. 10.0.0.0/8 (comma separated, any if empty)",
+		func(val string) error {
+			cfg.limiter.probeCIDRs = splitList(val)
+			return nil
+		},
+	)
+
+	cfg.middleware = defaultMiddleware()
+	flag.Func(
+		"middleware",
+		"Middleware chain wrapping the router, outermost first (comma separated)",
+		func(val string) error {
+			cfg.middleware = splitList(val)
+			return validateMiddleware(cfg.middleware)
+		},
+	)
+
+	cfg.metrics.excludeRoutes = defaultExcludedRoutes
+	flag.Func(
+		"metrics-exclude-routes",
+		`Routes left out of the route metrics, e.g. "/v1/readyz,GET /v1/movies" (comma separated)`,
+		func(val string) error {
+			cfg.metrics.excludeRoutes = splitList(val)
+			return nil
+		},
+	)
+
+	flag.BoolVar(
+		&cfg.honeypot.enabled,
+		"honeypot",
+		false,
+		"Tarpit the requests for the paths probed by scanners, and ban their IP addresses",
+	)
+	cfg.honeypot.paths = defaultHoneypotPaths
+	flag.Func(
+		"honeypot-paths",
+		"Paths served by the honeypot, replacing the default ones (space separated)",
+		func(val string) error {
+			cfg.honeypot.paths = strings.Fields(val)
+			return nil
+		},
+	)
+	flag.DurationVar(
+		&cfg.honeypot.delay,
+		"honeypot-delay",
+		5*time.Second,
+		"How long the honeypot holds a request before answering it with a 404",
+	)
+	flag.DurationVar(
+		&cfg.honeypot.banTTL,
+		"honeypot-ban-ttl",
+		time.Hour,
+		"How long the IP addresses hitting the honeypot are banned",
+	)
+
+	flag.StringVar(
+		&cfg.geo.database,
+		"geoip-db",
+		"",
+		"CSV file of networks with their country and ASN, to geolocate requests (off if empty)",
+	)
+	flag.StringVar(
+		&cfg.geo.blockCountries,
+		"geo-block-countries",
+		"",
+		"Comma-separated ISO country codes whose requests are rejected, e.g. KP,IR",
+	)
+	flag.StringVar(
+		&cfg.geo.blockASNs,
+		"geo-block-asns",
+		"",
+		"Comma-separated ASNs whose requests are rejected, e.g. AS64496,AS64511",
+	)
+	flag.BoolVar(
+		&cfg.limiter.tenantsEnabled,
+		"limiter-tenants-enabled",
+		true,
+		"Enforce the per-organization rate limits and daily quotas",
+	)
+
+	flag.DurationVar(
+		&cfg.signatures.maxSkew,
+		"signature-max-skew",
+		5*time.Minute,
+		"How far the Date of a signed request may be from the server's clock",
+	)
+
+	flag.Func(
+		"catalog-webhook-secrets",
+		"Sources of the catalog update webhook, as source=secret pairs (space separated)",
+		func(val string) error {
+			cfg.catalog.secrets = make(map[string]string)
+			for _, pair := range strings.Fields(val) {
+				source, secret, ok := strings.Cut(pair, "=")
+				if !ok || source == "" || secret == "" {
+					// The pair isn't quoted in the error, since it may be a secret.
+					return errors.New("invalid catalog webhook secret, must be source=secret")
+				}
+				cfg.catalog.secrets[source] = secret
+			}
+			return nil
+		},
+	)
+	flag.IntVar(
+		&cfg.catalog.workers,
+		"catalog-workers",
+		2,
+		"Number of workers reconciling the catalog updates",
+	)
+	flag.IntVar(
+		&cfg.catalog.queueSize,
+		"catalog-queue-size",
+		1000,
+		"Catalog updates queued for the workers, beyond which the webhook answers 503",
+	)
+
+	flag.StringVar(
+		&cfg.signup.captchaProvider,
+		"signup-captcha-provider",
+		"",
+		"CAPTCHA the signups must solve: hcaptcha or turnstile (off if empty)",
+	)
+	flag.StringVar(&cfg.signup.captchaSecret, "signup-captcha-secret", "", "CAPTCHA secret key")
+	flag.IntVar(&cfg.signup.perIP, "signup-ip-limit", 0, "Signups per hour per IP (0 disables)")
+	flag.IntVar(
+		&cfg.signup.perDomain,
+		"signup-domain-limit",
+		0,
+		"Signups per hour per email domain (0 disables)",
+	)
 
 	flag.StringVar(&cfg.smtp.host, "smtp-host", "sandbox.smtp.mailtrap.io", "SMTP host")
 	flag.IntVar(&cfg.smtp.port, "smtp-port", 2525, "SMTP port")
@@ -90,6 +653,98 @@ func main() {
 		"Greenlight <no-reply@greelight.pengyuc.com>",
 		"SMTP sender",
 	)
+	flag.StringVar(
+		&cfg.smtp.templateDir,
+		"smtp-template-dir",
+		"",
+		"Directory of email templates overriding the embedded ones with the same file names",
+	)
+	flag.StringVar(&cfg.smtp.brand, "smtp-brand", "Greenlight", "Brand name used in the emails")
+	flag.StringVar(
+		&cfg.smtp.supportEmail,
+		"smtp-support-email",
+		"",
+		"Support address given in the emails",
+	)
+	flag.StringVar(
+		&cfg.smtp.frontendURL,
+		"smtp-frontend-url",
+		"",
+		"Frontend URL linked from the emails",
+	)
+	flag.IntVar(
+		&cfg.smtp.maxIdle,
+		"smtp-max-idle",
+		2,
+		"Maximum idle SMTP connections kept open (0 opens one per email)",
+	)
+	flag.DurationVar(
+		&cfg.smtp.idleTimeout,
+		"smtp-idle-timeout",
+		30*time.Second,
+		"How long an idle SMTP connection is kept open",
+	)
+
+	flag.StringVar(
+		&cfg.twilio.accountSID,
+		"twilio-account-sid",
+		"",
+		"Twilio account SID that the SMS alerts are sent with (disabled if empty)",
+	)
+	flag.StringVar(&cfg.twilio.authToken, "twilio-auth-token", "", "Twilio auth token")
+	flag.StringVar(&cfg.twilio.from, "twilio-from", "", "Phone number the SMS alerts are sent from")
+
+	flag.StringVar(
+		&cfg.storage.Backend,
+		"storage-backend",
+		"",
+		"Where the uploads and exports are stored: local, s3 or gcs (disabled if empty)",
+	)
+	flag.StringVar(&cfg.storage.Dir, "storage-dir", "./uploads", "Directory of the local storage")
+	flag.StringVar(
+		&cfg.storage.BaseURL,
+		"storage-base-url",
+		"/assets",
+		"URL of the local storage's files, which the API server serves at /assets",
+	)
+	flag.StringVar(&cfg.storage.Bucket, "storage-bucket", "", "S3 or GCS bucket")
+	flag.StringVar(&cfg.storage.Region, "storage-region", "", "S3 bucket's region")
+	flag.StringVar(
+		&cfg.storage.Endpoint,
+		"storage-endpoint",
+		"",
+		"S3 or GCS endpoint replacing the provider's, e.g. a MinIO server",
+	)
+	flag.StringVar(
+		&cfg.storage.AccessKey,
+		"storage-access-key",
+		"",
+		"S3 access key ID, or GCS HMAC key ID",
+	)
+	flag.StringVar(
+		&cfg.storage.SecretKey,
+		"storage-secret-key",
+		"",
+		"Secret of the S3 or GCS access key, or the key signing the local storage's URLs",
+	)
+	flag.DurationVar(
+		&cfg.storage.urlTTL,
+		"storage-url-ttl",
+		15*time.Minute,
+		"How long the signed URLs that the posters and exports are downloaded from are valid",
+	)
+	flag.IntVar(
+		&cfg.posters.workers,
+		"poster-workers",
+		2,
+		"Number of workers resizing the uploaded posters",
+	)
+	flag.IntVar(
+		&cfg.posters.queueSize,
+		"poster-queue-size",
+		100,
+		"Uploaded posters queued for the workers, beyond which the uploads answer 503",
+	)
 
 	flag.Func(
 		"cors-trusted-origins",
@@ -100,6 +755,222 @@ func main() {
 		},
 	)
 
+	flag.IntVar(
+		&cfg.body.maxDepth,
+		"body-max-depth",
+		defaultBodyMaxDepth,
+		"Deepest nesting of objects and arrays in the JSON request bodies",
+	)
+	flag.IntVar(
+		&cfg.body.maxFields,
+		"body-max-fields",
+		defaultBodyMaxFields,
+		"Largest number of object members in a JSON request body",
+	)
+	flag.IntVar(
+		&cfg.body.maxStringLength,
+		"body-max-string-length",
+		defaultBodyMaxStringLength,
+		"Length of the longest string in the JSON request bodies, in characters",
+	)
+	flag.Int64Var(
+		&cfg.body.maxImportBytes,
+		"body-max-import-bytes",
+		defaultImportMaxBytes,
+		"Size limit of the bodies of the streamed imports, in bytes",
+	)
+
+	flag.Func(
+		"envelope-keys",
+		"Renamed top-level keys of the JSON responses, as old=new pairs (space separated)",
+		func(val string) error {
+			cfg.envelope.Keys = make(map[string]string)
+			for _, pair := range strings.Fields(val) {
+				key, renamed, ok := strings.Cut(pair, "=")
+				if !ok || key == "" || renamed == "" {
+					return fmt.Errorf("invalid envelope key %q", pair)
+				}
+				cfg.envelope.Keys[key] = renamed
+			}
+			return nil
+		},
+	)
+	flag.BoolVar(
+		&cfg.envelope.Bare,
+		"envelope-bare",
+		false,
+		"Answer with the bare value of the JSON responses holding a single member, e.g. an array",
+	)
+
+	flag.StringVar(
+		&cfg.pagination.countStrategy,
+		"pagination-count-strategy",
+		data.CountExact,
+		"Default strategy for counting listing records (exact|estimated|parallel|none)",
+	)
+	flag.IntVar(
+		&cfg.pagination.defaultPageSize,
+		"pagination-default-page-size",
+		20,
+		"Page size of the listings that don't ask for one",
+	)
+	flag.IntVar(
+		&cfg.pagination.maxPageSize,
+		"pagination-max-page-size",
+		data.DefaultMaxPageSize,
+		fmt.Sprintf("Largest page size the listings accept (at most %d)", data.PageSizeCap),
+	)
+	flag.IntVar(
+		&cfg.pagination.maxPage,
+		"pagination-max-page",
+		data.DefaultMaxPage,
+		"Largest page number the listings accept",
+	)
+
+	flag.StringVar(&cfg.feed.title, "feed-title", "Greenlight movies", "Title of the movie feeds")
+	flag.StringVar(
+		&cfg.feed.description,
+		"feed-description",
+		"The newest movies in the catalog",
+		"Description of the movie feeds",
+	)
+	flag.IntVar(&cfg.feed.limit, "feed-limit", 20, "Number of movies listed in the movie feeds")
+	flag.DurationVar(
+		&cfg.feed.maxAge,
+		"feed-max-age",
+		5*time.Minute,
+		"How long clients can cache the movie feeds",
+	)
+	flag.StringVar(
+		&cfg.feed.baseURL,
+		"feed-base-url",
+		"",
+		"Base URL of the movie feeds' links, e.g. https://api.example.com (default: request host)",
+	)
+
+	flag.StringVar(
+		&cfg.search.backend,
+		"search-backend",
+		data.SearchPostgres,
+		"Backend that movie searches run on (postgres|elasticsearch)",
+	)
+	flag.StringVar(
+		&cfg.search.url,
+		"search-elasticsearch-url",
+		"http://localhost:9200",
+		"URL of the Elasticsearch or OpenSearch cluster",
+	)
+	flag.StringVar(
+		&cfg.search.index,
+		"search-elasticsearch-index",
+		"movies",
+		"Name of the Elasticsearch or OpenSearch index of the movies",
+	)
+
+	flag.Func(
+		"runtime-format",
+		"Default format of the movies' runtimes in responses (mins|minutes|duration|iso8601)",
+		func(val string) error {
+			cfg.runtimeFormat = data.RuntimeFormat(val)
+			if !validator.PermittedValue(cfg.runtimeFormat, data.RuntimeFormats...) {
+				return fmt.Errorf("invalid runtime format %q", val)
+			}
+			return nil
+		},
+	)
+
+	flag.BoolVar(
+		&cfg.routeSuggestions,
+		"route-suggestions",
+		false,
+		"Suggest the near-miss routes in the 404 responses, e.g. /v1/movies/1 for /v1/movie/1",
+	)
+	flag.BoolVar(
+		&cfg.requireIfMatch,
+		"require-if-match",
+		false,
+		"Reject the requests deleting movies without an If-Match header",
+	)
+
+	var v1Schedule deprecationSchedule
+	flag.Func(
+		"v1-deprecation-date",
+		"Date the v1 API is deprecated on, sent in the Deprecation header (YYYY-MM-DD or RFC 3339)",
+		func(val string) (err error) {
+			v1Schedule.deprecation, err = parseScheduleDate(val)
+			return err
+		},
+	)
+	flag.Func(
+		"v1-sunset-date",
+		"Date the v1 API will be removed on, sent in the Sunset header (YYYY-MM-DD or RFC 3339)",
+		func(val string) (err error) {
+			v1Schedule.sunset, err = parseScheduleDate(val)
+			return err
+		},
+	)
+	flag.StringVar(
+		&v1Schedule.link,
+		"v1-deprecation-link",
+		"",
+		"URL documenting the v1 deprecation, sent in the Link header",
+	)
+
+	flag.StringVar(&cfg.sentry.dsn, "sentry-dsn", "", "Sentry DSN to report errors to (disabled if empty)")
+
+	flag.StringVar(
+		&cfg.outbox.webhookURL,
+		"outbox-webhook-url",
+		"",
+		"URL that the domain events are posted to (the outbox relay is disabled if empty)",
+	)
+	flag.StringVar(
+		&cfg.outbox.webhookSecret,
+		"outbox-webhook-secret",
+		"",
+		"Secret that the events posted to the webhook are signed with (unsigned if empty)",
+	)
+	flag.DurationVar(
+		&cfg.outbox.pollInterval,
+		"outbox-poll-interval",
+		time.Second,
+		"How often the outbox relay looks for events to publish",
+	)
+	flag.IntVar(&cfg.outbox.batchSize, "outbox-batch-size", 50, "Events published per transaction")
+	flag.DurationVar(
+		&cfg.outbox.retention,
+		"outbox-retention",
+		7*24*time.Hour,
+		"How long the delivered events are kept in the outbox",
+	)
+
+	flag.DurationVar(
+		&cfg.archive.interval,
+		"archive-interval",
+		time.Hour,
+		"How often the old deleted movies and expired tokens are archived (disabled if zero)",
+	)
+	flag.DurationVar(
+		&cfg.archive.retention,
+		"archive-retention",
+		30*24*time.Hour,
+		"How long the deleted movies and expired tokens are kept before they're archived",
+	)
+	flag.IntVar(&cfg.archive.batchSize, "archive-batch-size", 500, "Rows archived per statement")
+
+	flag.DurationVar(
+		&cfg.panics.alertInterval,
+		"panic-alert-interval",
+		time.Hour,
+		"Minimum time between two alerts for the same recovered panic",
+	)
+	flag.StringVar(
+		&cfg.panics.webhookURL,
+		"panic-alert-webhook",
+		"",
+		"URL that the reports of recovered panics are posted to (disabled if empty)",
+	)
+
 	displayVersion := flag.Bool("version", false, "Display version and exit")
 
 	flag.Parse()
@@ -111,11 +982,161 @@ func main() {
 
 	logger := jsonlog.New(os.Stdout, jsonlog.LevelInfo)
 
+	if v1Schedule != (deprecationSchedule{}) {
+		if !v1Schedule.deprecation.IsZero() && !v1Schedule.sunset.IsZero() &&
+			v1Schedule.sunset.Before(v1Schedule.deprecation) {
+			logger.PrintFatal(errors.New("v1 sunset date must not be before its deprecation date"), nil)
+		}
+		cfg.deprecations = map[string]deprecationSchedule{apiV1: v1Schedule}
+	}
+
+	var errorReporter reporter.Reporter = reporter.Nop{}
+	if cfg.sentry.dsn != "" {
+		sentry, err := reporter.NewSentry(cfg.sentry.dsn, cfg.env, version)
+		if err != nil {
+			logger.PrintFatal(err, nil)
+		}
+		errorReporter = sentry
+	}
+	// Forward every ERROR and FATAL entry, which includes the panics recovered by the middleware.
+	logger.AddHook(func(entry jsonlog.Entry) {
+		errorReporter.Report(reporter.Event{
+			Level:      strings.ToLower(entry.Level.String()),
+			Time:       entry.Time,
+			Message:    entry.Message,
+			Properties: entry.Properties,
+			Trace:      entry.Trace,
+		})
+	})
+
+	if !validator.PermittedValue(cfg.pagination.countStrategy, data.CountStrategies...) {
+		logger.PrintFatal(
+			fmt.Errorf("invalid pagination count strategy %q", cfg.pagination.countStrategy),
+			nil,
+		)
+	}
+
+	if cfg.pagination.maxPageSize < 1 || cfg.pagination.maxPageSize > data.PageSizeCap {
+		logger.PrintFatal(
+			fmt.Errorf("pagination max page size must be between 1 and %d", data.PageSizeCap),
+			nil,
+		)
+	}
+	if cfg.pagination.defaultPageSize < 1 ||
+		cfg.pagination.defaultPageSize > cfg.pagination.maxPageSize {
+		logger.PrintFatal(
+			errors.New("pagination default page size must be between 1 and the max page size"),
+			nil,
+		)
+	}
+	if cfg.pagination.maxPage < 1 {
+		logger.PrintFatal(errors.New("pagination max page must be at least 1"), nil)
+	}
+
+	if cfg.capture.size < 0 || cfg.capture.maxBody < 0 {
+		logger.PrintFatal(errors.New("debug capture size and max body must not be negative"), nil)
+	}
+
+	if cfg.twilio.accountSID != "" && (cfg.twilio.authToken == "" || cfg.twilio.from == "") {
+		logger.PrintFatal(errors.New("twilio auth token and sender must be set"), nil)
+	}
+	if cfg.mtls.addr != "" &&
+		(cfg.mtls.certFile == "" || cfg.mtls.keyFile == "" || cfg.mtls.clientCAFile == "") {
+		err := errors.New("the mtls listener needs a certificate, key and client CA")
+		logger.PrintFatal(err, nil)
+	}
+	if cfg.geo.database == "" && (cfg.geo.blockCountries != "" || cfg.geo.blockASNs != "") {
+		logger.PrintFatal(errors.New("the geo blocklist needs a geoip database"), nil)
+	}
+	if cfg.signup.captchaProvider != "" && cfg.signup.captchaSecret == "" {
+		logger.PrintFatal(errors.New("the captcha secret must be set"), nil)
+	}
+
+	if cfg.outbox.pollInterval <= 0 || cfg.outbox.batchSize < 1 {
+		logger.PrintFatal(errors.New("outbox poll interval and batch size must be positive"), nil)
+	}
+
+	// S3 and GCS refuse to sign the URLs for more than a week.
+	if cfg.storage.urlTTL <= 0 || cfg.storage.urlTTL > 7*24*time.Hour {
+		err := errors.New("the storage URL TTL must be positive, and a week at most")
+		logger.PrintFatal(err, nil)
+	}
+
+	if cfg.posters.workers < 1 || cfg.posters.queueSize < 1 {
+		logger.PrintFatal(errors.New("poster workers and queue size must be positive"), nil)
+	}
+
+	if cfg.catalog.workers < 1 || cfg.catalog.queueSize < 1 {
+		logger.PrintFatal(errors.New("catalog workers and queue size must be positive"), nil)
+	}
+
+	if cfg.archive.interval < 0 || cfg.archive.retention < 0 || cfg.archive.batchSize < 1 {
+		logger.PrintFatal(errors.New("archive interval, retention and batch size are invalid"), nil)
+	}
+
+	if cfg.feed.limit < 1 || cfg.feed.limit > 100 {
+		logger.PrintFatal(errors.New("feed limit must be between 1 and 100"), nil)
+	}
+
+	if !validator.PermittedValue(cfg.search.backend, data.SearchBackends...) {
+		logger.PrintFatal(fmt.Errorf("invalid search backend %q", cfg.search.backend), nil)
+	}
+
+	if cfg.activation.redirectURL != "" {
+		u, err := url.Parse(cfg.activation.redirectURL)
+		if err != nil || !u.IsAbs() {
+			logger.PrintFatal(errors.New("activation redirect URL must be an absolute URL"), nil)
+		}
+	}
+
+	if cfg.tokens.activationTTL <= 0 || cfg.tokens.activationTTL > maxTokenTTL {
+		logger.PrintFatal(errors.New("token activation TTL must be between 0 and 30 days"), nil)
+	}
+	if cfg.tokens.authenticationTTL <= 0 || cfg.tokens.authenticationTTL > maxTokenTTL {
+		logger.PrintFatal(errors.New("token authentication TTL must be between 0 and 30 days"), nil)
+	}
+
+	var tokenSecret []byte
+	if cfg.tokenSecret != "" {
+		if len(cfg.tokenSecret) < 32 {
+			logger.PrintFatal(errors.New("token secret must be at least 32 bytes long"), nil)
+		}
+		tokenSecret = []byte(cfg.tokenSecret)
+	}
+
+	emailKeys, err := data.ParseKeyring(cfg.email.keys, cfg.email.indexKey)
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
+	if cfg.email.decrypt {
+		if emailKeys == nil {
+			logger.PrintFatal(errors.New("decrypting the emails requires their keys"), nil)
+		}
+		emailKeys = emailKeys.Decrypting()
+	}
+
+	// The mock mode needs none of the dependencies below.
+	if cfg.mock.enabled {
+		app := &application{
+			config:         cfg,
+			logger:         logger,
+			panics:         newPanicTracker(cfg.panics.alertInterval),
+			drainRequested: make(chan struct{}),
+		}
+		app.mocks, err = loadMockTemplates(cfg.mock.dir)
+		if err != nil {
+			logger.PrintFatal(err, nil)
+		}
+
+		logger.PrintInfo("serving mock responses", map[string]string{"dir": cfg.mock.dir})
+		err = app.serve()
+		logger.PrintFatal(err, nil)
+	}
+
 	db, err := openDB(cfg)
 	if err != nil {
 		logger.PrintFatal(err, nil)
 	}
-	defer db.Close()
 
 	logger.PrintInfo("database connection pool established", nil)
 
@@ -124,27 +1145,177 @@ func main() {
 		return runtime.NumGoroutine()
 	}))
 	expvar.Publish("database", expvar.Func(func() any {
-		return db.Stats()
+		return dbStats(db.Stats())
 	}))
 	expvar.Publish("timestamp", expvar.Func(func() any {
 		return time.Now().Unix()
 	}))
 
+	models := data.NewModels(db, data.Config{
+		PrepareStatements:  cfg.db.prepareStatements,
+		QueryTimeout:       cfg.db.queryTimeout,
+		Listings:           cfg.db.listings,
+		BreakerThreshold:   cfg.db.breakerThreshold,
+		BreakerCooldown:    cfg.db.breakerCooldown,
+		MaxRetries:         cfg.db.maxRetries,
+		RetryBackoff:       cfg.db.retryBackoff,
+		EmailKeys:          emailKeys,
+		TokenSecret:        tokenSecret,
+		PermissionCacheTTL: cfg.db.permissionTTL,
+	})
+
+	expvar.Publish("database_breaker", expvar.Func(func() any {
+		return models.BreakerState()
+	}))
+	expvar.Publish("database_retries", expvar.Func(func() any {
+		return models.RetryStats()
+	}))
+	expvar.Publish("database_queries", expvar.Func(func() any {
+		return models.QueryOutcomes()
+	}))
+	expvar.Publish("permission_cache", expvar.Func(func() any {
+		return models.PermissionCacheStats()
+	}))
+	expvar.Publish("coalesced_movie_reads", expvar.Func(func() any {
+		return models.CoalescedMovieReads()
+	}))
+
+	if cfg.search.backend == data.SearchElasticsearch {
+		index, err := data.NewElasticsearchSearchIndex(cfg.search.url, cfg.search.index)
+		if err != nil {
+			logger.PrintFatal(err, nil)
+		}
+		err = index.CreateIndex(context.Background())
+		if err != nil {
+			logger.PrintFatal(err, nil)
+		}
+		models.Search = index
+
+		logger.PrintInfo("elasticsearch index ready", map[string]string{"index": cfg.search.index})
+	}
+
+	mail := mailer.New(
+		cfg.smtp.host,
+		cfg.smtp.port,
+		cfg.smtp.username,
+		cfg.smtp.password,
+		cfg.smtp.sender,
+	).WithBranding(mailer.Branding{
+		Name:         cfg.smtp.brand,
+		SupportEmail: cfg.smtp.supportEmail,
+		FrontendURL:  cfg.smtp.frontendURL,
+	}).WithPool(cfg.smtp.maxIdle, cfg.smtp.idleTimeout)
+	if cfg.smtp.templateDir != "" {
+		mail, err = mail.WithTemplateDir(cfg.smtp.templateDir)
+		if err != nil {
+			logger.PrintFatal(err, nil)
+		}
+	}
+
+	expvar.Publish("mailer", expvar.Func(func() any {
+		return mail.Stats()
+	}))
+
 	app := &application{
-		config: cfg,
-		logger: logger,
-		models: data.NewModels(db),
-		mailer: mailer.New(
-			cfg.smtp.host,
-			cfg.smtp.port,
-			cfg.smtp.username,
-			cfg.smtp.password,
-			cfg.smtp.sender,
-		),
+		config:         cfg,
+		logger:         logger,
+		models:         models,
+		mailer:         mail,
+		tenants:        newTenantLimiters(),
+		panics:         newPanicTracker(cfg.panics.alertInterval),
+		drainRequested: make(chan struct{}),
+	}
+	app.denylist, err = loadDenylist(cfg)
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
+	if cfg.signup.captchaProvider != "" {
+		app.captcha, err = captcha.New(cfg.signup.captchaProvider, cfg.signup.captchaSecret)
+		if err != nil {
+			logger.PrintFatal(err, nil)
+		}
+	}
+	app.signups = newSignupLimiter(cfg.signup.perIP, cfg.signup.perDomain)
+	app.probes, err = newProbeExemption(cfg.limiter.probePaths, cfg.limiter.probeCIDRs)
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
+	if cfg.honeypot.enabled {
+		app.banned = newBannedIPs(cfg.honeypot.banTTL, cfg.limiter.maxClients)
+	}
+	app.geo, err = loadGeoResolver(cfg)
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
+	app.geoBlocklist, err = geoip.ParseBlocklist(cfg.geo.blockCountries, cfg.geo.blockASNs)
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
+	if cfg.capture.size > 0 {
+		app.captures = newCaptureRing(cfg.capture.size)
+	}
+	if cfg.twilio.accountSID != "" {
+		app.sms = sms.NewTwilio(cfg.twilio.accountSID, cfg.twilio.authToken, cfg.twilio.from)
+	}
+	if cfg.storage.Backend != "" {
+		app.storage, err = storage.New(cfg.storage.Config)
+		if err != nil {
+			logger.PrintFatal(err, nil)
+		}
+		app.storageHealth = storage.NewMonitor(app.storage, time.Minute)
+	}
+	expvar.Publish("panics", expvar.Func(app.panics.snapshot))
+	if cfg.panics.webhookURL != "" {
+		app.onPanic(app.panicWebhook(cfg.panics.webhookURL))
+	}
+
+	// The relay publishes the events written to the outbox along with the changes they describe.
+	// Its shutdown hook is registered first, so that it stops before the database is closed.
+	if cfg.outbox.webhookURL != "" {
+		app.webhook = newWebhookPublisher(cfg.outbox.webhookURL, cfg.outbox.webhookSecret)
+		app.startOutboxRelay(app.webhook)
+	}
+	if len(cfg.catalog.secrets) > 0 {
+		app.catalog = app.startCatalogPool(
+			logReconciler{app: app},
+			cfg.catalog.workers,
+			cfg.catalog.queueSize,
+		)
+	}
+	if app.storage != nil {
+		app.posters = app.startPosterPool(cfg.posters.workers, cfg.posters.queueSize)
+	}
+	if cfg.archive.interval > 0 {
+		app.startArchiver()
+	}
+	if cfg.limiter.tenantsEnabled {
+		app.startUsageFlusher()
+	}
+	if emailKeys != nil {
+		app.background(app.encryptEmails)
 	}
 
-	mux := http.NewServeMux()
-	mux.HandleFunc("/v1/healthcheck", app.healthcheckHandler)
+	// The background tasks may still need the database, so they have to be drained before the
+	// connection pool is closed.
+	app.onShutdown("background tasks", app.waitForBackground)
+	app.onShutdown("mailer", func(ctx context.Context) error {
+		return mail.Close()
+	})
+	app.onShutdown("prepared statements", func(ctx context.Context) error {
+		return models.Close()
+	})
+	app.onShutdown("database", func(ctx context.Context) error {
+		return db.Close()
+	})
+	// Flush the error reporter last, so that it still sends any errors from the hooks above.
+	app.onShutdown("error reporter", errorReporter.Flush)
+
+	if cfg.debugAddr != "" {
+		err = app.serveDebug()
+		if err != nil {
+			logger.PrintFatal(err, nil)
+		}
+	}
 
 	err = app.serve()
 	logger.PrintFatal(err, nil)
@@ -152,19 +1323,20 @@ func main() {
 
 // openDB returns a sql.DB connection pool.
 func openDB(cfg config) (*sql.DB, error) {
-	db, err := sql.Open("postgres", cfg.db.dsn)
+	dsn, err := withStatementTimeout(cfg.db.dsn, cfg.db.statementTimeout)
 	if err != nil {
 		return nil, err
 	}
 
-	db.SetMaxOpenConns(cfg.db.maxIdleConns)
-	db.SetMaxIdleConns(cfg.db.maxIdleConns)
-
-	duration, err := time.ParseDuration(cfg.db.maxIdleTime)
+	db, err := sql.Open("postgres", dsn)
 	if err != nil {
 		return nil, err
 	}
-	db.SetConnMaxIdleTime(duration)
+
+	db.SetMaxOpenConns(cfg.db.maxOpenConns)
+	db.SetMaxIdleConns(cfg.db.maxIdleConns)
+	db.SetConnMaxIdleTime(cfg.db.maxIdleTime)
+	db.SetConnMaxLifetime(cfg.db.maxLifetime)
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
@@ -176,3 +1348,39 @@ func openDB(cfg config) (*sql.DB, error) {
 
 	return db, nil
 }
+
+// withStatementTimeout adds the statement_timeout run-time parameter to the DSN, which lib/pq
+// sends to the server on every new connection, so that the server cancels the queries that run
+// for longer even if the client never gets to. URL DSNs are converted to the key=value form first.
+func withStatementTimeout(dsn string, timeout time.Duration) (string, error) {
+	if timeout <= 0 {
+		return dsn, nil
+	}
+
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		var err error
+		dsn, err = pq.ParseURL(dsn)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return fmt.Sprintf("%s statement_timeout=%d", dsn, timeout.Milliseconds()), nil
+}
+
+// dbStats converts the connection pool statistics into the map published by the metrics endpoint.
+// A steadily growing wait_count (or wait_duration_ms) with in_use pinned at max_open_connections is
+// the telltale sign of pool exhaustion.
+func dbStats(stats sql.DBStats) map[string]any {
+	return map[string]any{
+		"max_open_connections": stats.MaxOpenConnections,
+		"open_connections":     stats.OpenConnections,
+		"in_use":               stats.InUse,
+		"idle":                 stats.Idle,
+		"wait_count":           stats.WaitCount,
+		"wait_duration_ms":     stats.WaitDuration.Milliseconds(),
+		"max_idle_closed":      stats.MaxIdleClosed,
+		"max_idle_time_closed": stats.MaxIdleTimeClosed,
+		"max_lifetime_closed":  stats.MaxLifetimeClosed,
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/walkccc/greenlight/internal/data"
+	"github.com/walkccc/greenlight/internal/dto"
+	"github.com/walkccc/greenlight/internal/validator"
+)
+
+// mergeMovieHandler handles requests for "POST /v1/movies/:id/merge".
+func (app *application) mergeMovieHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input dto.MergeMovieRequest
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	v.Struct(input)
+	v.Check(input.DuplicateID != id, "duplicate_id", validator.CodeInvalid, "must be another movie")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	organizationID := app.contextGetUser(r).OrganizationID
+
+	err = app.models.Movies.Merge(r.Context(), organizationID, input.DuplicateID, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.background(func() {
+		err := app.models.Search.DeleteMovie(
+			context.Background(),
+			organizationID,
+			input.DuplicateID,
+		)
+		if err != nil {
+			app.logger.PrintError(err, nil)
+		}
+	})
+
+	movie, err := app.models.Movies.Get(r.Context(), organizationID, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeMovie(w, r, http.StatusOK, movie, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// methodOverrideHeader is the header with which the clients behind proxies that only let GET and
+// POST requests through send the method they mean.
+const methodOverrideHeader = "X-HTTP-Method-Override"
+
+// overridableMethods are the methods that a POST request can be overridden with.
+var overridableMethods = map[string]bool{
+	http.MethodPut:    true,
+	http.MethodPatch:  true,
+	http.MethodDelete: true,
+}
+
+// methodOverride replaces the method of the POST requests with the one in their
+// X-HTTP-Method-Override header, if it's PUT, PATCH or DELETE. Only POST requests can be
+// overridden, so that a GET request, which may be sent cross-site without a preflight or be cached,
+// can't change anything. The rest of the chain sees the overridden method, so the signed requests
+// sign it rather than POST.
+func (app *application) methodOverride(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		override := strings.ToUpper(r.Header.Get(methodOverrideHeader))
+		if r.Method == http.MethodPost && overridableMethods[override] {
+			r.Method = override
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// optionsHandler answers the OPTIONS requests of every route with a 204 No Content response, once
+// the router has set their Allow header to the route's methods. The CORS preflight requests from
+// the trusted origins are answered by enableCORS() before they reach the router.
+func (app *application) optionsHandler(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// headHandler answers HEAD requests with the handler of the GET route: the response has the same
+// status and headers, including the Content-Length that the body would have had, but no body.
+func headHandler(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		hw := &headResponseWriter{ResponseWriter: w}
+		next(hw, r)
+		hw.flush()
+	}
+}
+
+// headResponseWriter discards the body of a response, holding back its status until the handler
+// is done so that the length of the discarded body can be sent.
+type headResponseWriter struct {
+	http.ResponseWriter
+	statusCode int
+	length     int64
+}
+
+func (hw *headResponseWriter) WriteHeader(statusCode int) {
+	if hw.statusCode == 0 {
+		hw.statusCode = statusCode
+	}
+}
+
+func (hw *headResponseWriter) Write(b []byte) (int, error) {
+	if hw.statusCode == 0 {
+		hw.statusCode = http.StatusOK
+	}
+	hw.length += int64(len(b))
+	return len(b), nil
+}
+
+func (hw *headResponseWriter) Unwrap() http.ResponseWriter {
+	return hw.ResponseWriter
+}
+
+// flush sends the status and headers of the response.
+func (hw *headResponseWriter) flush() {
+	if hw.statusCode == 0 {
+		hw.statusCode = http.StatusOK
+	}
+	if hw.length > 0 && hw.Header().Get("Content-Length") == "" {
+		hw.Header().Set("Content-Length", strconv.FormatInt(hw.length, 10))
+	}
+	hw.ResponseWriter.WriteHeader(hw.statusCode)
+}
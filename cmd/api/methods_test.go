@@ -0,0 +1,89 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMethodOverride(t *testing.T) {
+	app := &application{}
+
+	var method string
+	handler := app.methodOverride(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method = r.Method
+	}))
+
+	tests := []struct {
+		method, override, want string
+	}{
+		{http.MethodPost, "PATCH", http.MethodPatch},
+		{http.MethodPost, "delete", http.MethodDelete},
+		{http.MethodPost, "", http.MethodPost},
+		{http.MethodPost, "GET", http.MethodPost},
+		{http.MethodPost, "CONNECT", http.MethodPost},
+		{http.MethodGet, "DELETE", http.MethodGet},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(tt.method, "/v1/movies/1", nil)
+		r.Header.Set(methodOverrideHeader, tt.override)
+		handler.ServeHTTP(httptest.NewRecorder(), r)
+		assert.Equal(t, tt.want, method, tt.method+" "+tt.override)
+	}
+}
+
+func TestHeadHandler(t *testing.T) {
+	router := httprouter.New()
+	root := newRouteGroup(router.HandlerFunc)
+	root.handle(http.MethodGet, "/movies/:id", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("ETag", `"1"`)
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"movie":{"id":1}}`))
+	})
+	root.handle(http.MethodPost, "/movies", func(w http.ResponseWriter, r *http.Request) {})
+
+	get := httptest.NewRecorder()
+	router.ServeHTTP(get, httptest.NewRequest(http.MethodGet, "/movies/1", nil))
+
+	head := httptest.NewRecorder()
+	router.ServeHTTP(head, httptest.NewRequest(http.MethodHead, "/movies/1", nil))
+
+	assert.Equal(t, http.StatusOK, head.Code)
+	assert.Empty(t, head.Body.String())
+	assert.Equal(t, get.Header().Get("Content-Type"), head.Header().Get("Content-Type"))
+	assert.Equal(t, get.Header().Get("ETag"), head.Header().Get("ETag"))
+	assert.Equal(t, "18", head.Header().Get("Content-Length"))
+
+	// Only the GET routes answer HEAD requests.
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest(http.MethodHead, "/movies", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rr.Code)
+}
+
+func TestAllowHeader(t *testing.T) {
+	app := &application{}
+	router := app.newRouter()
+
+	serve := func(method, path string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, httptest.NewRequest(method, path, nil))
+		return rr
+	}
+
+	rr := serve(http.MethodOptions, "/v1/movies/1")
+	assert.Equal(t, http.StatusNoContent, rr.Code)
+	assert.Equal(t, "DELETE, GET, HEAD, OPTIONS, PATCH", rr.Header().Get("Allow"))
+
+	rr = serve(http.MethodPut, "/v1/movies")
+	assert.Equal(t, http.StatusMethodNotAllowed, rr.Code)
+	assert.Equal(t, "GET, HEAD, OPTIONS, POST", rr.Header().Get("Allow"))
+	assert.Contains(t, rr.Body.String(), "supported methods: GET, HEAD, OPTIONS, POST")
+
+	rr = serve(http.MethodOptions, "/v1/nothing")
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+	assert.Empty(t, rr.Header().Get("Allow"))
+}
@@ -3,36 +3,53 @@ package main
 import (
 	"errors"
 	"expvar"
-	"fmt"
 	"net/http"
+	"runtime"
+	"runtime/debug"
 	"strconv"
 	"strings"
-	"sync"
 	"time"
 
 	"github.com/tomasen/realip"
 	"github.com/walkccc/greenlight/internal/data"
+	"github.com/walkccc/greenlight/internal/dto"
+	"github.com/walkccc/greenlight/internal/ratelimit"
 	"github.com/walkccc/greenlight/internal/validator"
-	"golang.org/x/time/rate"
 )
 
+// recoverPanic recovers the panics raised while handling a request, and sends the client a 500
+// Internal Server Error response. Each panic is fingerprinted by where it was raised, so that
+// repeated occurrences can be told apart from new ones: the panics are counted per fingerprint in
+// the "panics" metric, logged with their fingerprint, and handed to the panic hooks.
 func (app *application) recoverPanic(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// Create a deferred function (which will always be run in the event of a panic as Go
 		// unwinds the stack).
 		defer func() {
 			// Use the built-in recover function to check if there has been a panic or not.
-			if err := recover(); err != nil {
-				// If there was a panic, set a "Connection: close" header on the response. This acts
-				// as a trigger to make Go's HTTP server automatically close the current connection
-				// after a response has been sent.
-				w.Header().Set("Connection", "close")
-				// The value returned by recover() has the type any, so we use fmt.Errorf() to
-				// normalize it into an error and call our serverErrorResponse() helper. In turn,
-				// this will log the error using our custom Logger type at the ERROR level and sent
-				// the client a 500 Internal Server Error response.
-				app.serverErrorResponse(w, r, fmt.Errorf("%s", err))
+			value := recover()
+			if value == nil {
+				return
+			}
+			// http.ErrAbortHandler is how handlers abort a response on purpose, so let the server
+			// deal with it.
+			if value == http.ErrAbortHandler {
+				panic(value)
 			}
+
+			// Capture the stack before it's unwound any further. Deferred functions run on top of
+			// the panicking frames, so they're still there.
+			pcs := make([]uintptr, 64)
+			pcs = pcs[:runtime.Callers(1, pcs)]
+
+			app.reportPanic(r, value, pcs, debug.Stack())
+
+			// Set a "Connection: close" header on the response. This acts as a trigger to make Go's
+			// HTTP server automatically close the current connection after a response has been
+			// sent.
+			w.Header().Set("Connection", "close")
+			message := "the server encountered a problem and could not process your request"
+			app.errorResponse(w, r, http.StatusInternalServerError, message)
 		}()
 
 		next.ServeHTTP(w, r)
@@ -40,74 +57,94 @@ func (app *application) recoverPanic(next http.Handler) http.Handler {
 }
 
 func (app *application) rateLimit(next http.Handler) http.Handler {
-	type client struct {
-		limiter  *rate.Limiter
-		lastSeen time.Time
-	}
-
-	// A mutex and a map to hold the clients' IP addresses and clients.
-	var (
-		mtx     sync.Mutex
-		clients = make(map[string]*client)
+	// The store holds a limiter per client IP address, bounded to maxClients entries.
+	clients := ratelimit.New(
+		app.config.limiter.rps,
+		app.config.limiter.burst,
+		app.config.limiter.maxClients,
 	)
+	expvar.Publish("limiter", expvar.Func(func() any {
+		return clients.Stats()
+	}))
 
-	// A background goroutine which removes old entries from the clients map once every minute.
+	// A background goroutine which removes clients that haven't been seen within the last three
+	// minutes, once every minute.
 	go func() {
 		for {
 			time.Sleep(time.Minute)
-
-			// Lock the mutex to prevent any rate limiter checks from happening while the cleanup is
-			// taking place.
-			mtx.Lock()
-
-			// Loop through all clients. If they haven't been seen within the last three minutes,
-			// delete the corresponding entry from the map.
-			for ip, client := range clients {
-				if time.Since(client.lastSeen) > 3*time.Minute {
-					delete(clients, ip)
-				}
-			}
-
-			// Importantly, unlock the mutex when the cleanup is complete.
-			mtx.Unlock()
+			clients.Cleanup(3 * time.Minute)
 		}
 	}()
 
-	// The function we're returning is a closure, which 'closes over' the limiter variable.
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if app.config.limiter.enabled {
-			// Retrieve the client IP address from any X-Forwarded-For or X-Real-IP headers, falling
-			// back to use r.RemoteAddr if neither of them are present.
-			ip := realip.FromRequest(r)
-
-			// Lock the mutex to prevent this code from being executed concurrently.
-			mtx.Lock()
-
-			if _, found := clients[ip]; !found {
-				// Initialize a new rate limiter which allows an average of 2 requests per second,
-				// with
-				// a maximum of 4 requests in a single 'burst'.
-				clients[ip] = &client{
-					limiter: rate.NewLimiter(
-						rate.Limit(app.config.limiter.rps),
-						app.config.limiter.burst,
-					),
-				}
-			}
+		// The health probes are let through, so that they don't take up room in the store.
+		if app.probes.exempt(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
 
-			clients[ip].lastSeen = time.Now()
+		// Retrieve the client IP address from any X-Forwarded-For or X-Real-IP headers, falling
+		// back to use r.RemoteAddr if neither of them are present.
+		ip := realip.FromRequest(r)
 
-			if !clients[ip].limiter.Allow() {
-				mtx.Unlock()
+		// The IP addresses banned by the honeypot are rejected even if the limiter is disabled.
+		if app.banned.banned(ip) {
+			app.rateLimitExceededResponse(w, r)
+			return
+		}
+
+		if app.config.limiter.enabled {
+			if !clients.Allow(ip) {
 				app.rateLimitExceededResponse(w, r)
 				return
 			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// tenantRateLimit enforces the limits of the organization the user's token is scoped to: its
+// requests per second and its daily request quota. It has to run after authenticate(), and lets
+// anonymous users and tokens that aren't scoped to an organization through untouched (they're
+// still subject to the per-IP rate limiter).
+func (app *application) tenantRateLimit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user := app.contextGetUser(r)
 
-			// Very importantly, unlock the mutex before calling the next handler in the chain.
-			// Notice
-			// that we DON'T use defer to unlock the mutex, as that would mean that the mutex isn't
-			// unlocked until all the handlers downstream of this middleware have also returned.
-			mtx.Unlock()
+		if !app.config.limiter.tenantsEnabled || user.OrganizationID == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		limits, limiter, err := app.tenants.get(
+			r.Context(),
+			user.OrganizationID,
+			app.models.Organizations.GetLimits,
+		)
+		if err != nil {
+			// The limits fail open: an organization isn't locked out because they can't be
+			// loaded.
+			app.logger.PrintError(err, map[string]string{
+				"organization_id": strconv.FormatInt(user.OrganizationID, 10),
+			})
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if limiter != nil && !limiter.Allow() {
+			app.rateLimitExceededResponse(w, r)
+			return
+		}
+
+		// Every request is counted, so that the usage endpoint can report the consumption of
+		// organizations without a quota too. The requests are counted in memory and flushed in
+		// batches, so the quota is enforced a little late.
+		requests := app.tenants.count(user.OrganizationID, time.Now())
+
+		if limits.DailyRequestQuota > 0 && requests > limits.DailyRequestQuota {
+			app.quotaExceededResponse(w, r)
+			return
 		}
 
 		next.ServeHTTP(w, r)
@@ -129,7 +166,15 @@ func (app *application) authenticate(next http.Handler) http.Handler {
 
 		// Retrieve the value of the Authorization header from the request. This will return the
 		// empty string "" if there is no such header found.
+		// The requests authenticated by their client certificate or their signature already have a
+		// user.
+		if app.contextHasUser(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
 		authorizationHeader := r.Header.Get("Authorization")
+
 		if authorizationHeader == "" {
 			r = app.contextSetUser(r, data.AnonymousUser)
 			next.ServeHTTP(w, r)
@@ -154,7 +199,7 @@ func (app *application) authenticate(next http.Handler) http.Handler {
 
 		// Retrieve the details of the user associated with the authentication token. Note that we
 		// are using ScopeAuthentication as the first parameter here.
-		user, err := app.models.Users.GetForToken(data.ScopeAuthentication, token)
+		user, err := app.models.Users.GetForToken(r.Context(), data.ScopeAuthentication, token)
 		if err != nil {
 			switch {
 			case errors.Is(err, data.ErrRecordNotFound):
@@ -205,7 +250,7 @@ func (app *application) requirePermission(code string, next http.HandlerFunc) ht
 	fn := func(w http.ResponseWriter, r *http.Request) {
 		user := app.contextGetUser(r)
 
-		permissions, err := app.models.Permissions.GetAllForUser(user.ID)
+		permissions, err := app.models.Permissions.GetAllForUser(r.Context(), user.ID)
 		if err != nil {
 			app.serverErrorResponse(w, r, err)
 			return
@@ -222,6 +267,66 @@ func (app *application) requirePermission(code string, next http.HandlerFunc) ht
 	return app.requireActivatedUser(fn)
 }
 
+// ownerFunc returns the ID of the user who owns the resource that the request is for, e.g. the
+// author of a review. It returns data.ErrRecordNotFound if there's no such resource.
+type ownerFunc func(r *http.Request) (int64, error)
+
+// requireOwnershipOr checks that the user owns the resource that the request is for, or else that
+// they have the permission code, which lets e.g. the admins update or delete anyone's resources.
+// The user's permissions are only loaded if they aren't the owner.
+func (app *application) requireOwnershipOr(
+	code string,
+	owner ownerFunc,
+	next http.HandlerFunc,
+) http.HandlerFunc {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		user := app.contextGetUser(r)
+
+		ownerID, err := owner(r)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				app.notFoundResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		if ownerID != user.ID {
+			permissions, err := app.models.Permissions.GetAllForUser(r.Context(), user.ID)
+			if err != nil {
+				app.serverErrorResponse(w, r, err)
+				return
+			}
+
+			if !permissions.Include(code) {
+				app.notPermittedResponse(w, r)
+				return
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	}
+
+	return app.requireActivatedUser(fn)
+}
+
+// requireOrganization checks that the user's authentication token is scoped to an organization,
+// which the handlers use to scope their queries.
+func (app *application) requireOrganization(next http.HandlerFunc) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user := app.contextGetUser(r)
+
+		if user.OrganizationID == 0 {
+			app.organizationRequiredResponse(w, r)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
 func (app *application) enableCORS(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Add("Vary", "Origin")
@@ -232,6 +337,7 @@ func (app *application) enableCORS(next http.Handler) http.Handler {
 			for _, trustedOrigin := range app.config.cors.trustedOrigins {
 				if origin == trustedOrigin {
 					w.Header().Set("Access-Control-Allow-Origin", origin)
+					w.Header().Set("Access-Control-Expose-Headers", "ETag, "+dto.PaginationHeader)
 
 					// Treat it as a preflight request.
 					if r.Method == http.MethodOptions &&
@@ -239,8 +345,10 @@ func (app *application) enableCORS(next http.Handler) http.Handler {
 						// Set the necessary preflight response headers.
 						w.Header().
 							Set("Access-Control-Allow-Methods", "OPTIONS, PUT, PATCH, DELETE")
-						w.Header().
-							Set("Access-Control-Allow-Headers", "Authorization, Content-Type")
+						w.Header().Set(
+							"Access-Control-Allow-Headers",
+							"Authorization, Content-Type, If-Match, X-HTTP-Method-Override",
+						)
 
 						// Return from the middleware with no further action.
 						w.WriteHeader(http.StatusOK)
@@ -260,6 +368,7 @@ type metricsResponseWriter struct {
 	wrapped       http.ResponseWriter
 	statusCode    int
 	headerWritten bool
+	bytesWritten  int64
 }
 
 func newMetricsResponseWriter(w http.ResponseWriter) *metricsResponseWriter {
@@ -283,7 +392,9 @@ func (mw *metricsResponseWriter) WriteHeader(statusCode int) {
 
 func (mw *metricsResponseWriter) Write(b []byte) (int, error) {
 	mw.headerWritten = true
-	return mw.wrapped.Write(b)
+	n, err := mw.wrapped.Write(b)
+	mw.bytesWritten += int64(n)
+	return n, err
 }
 
 func (mw *metricsResponseWriter) Unwrap() http.ResponseWriter {
@@ -297,7 +408,10 @@ func (app *application) metrics(next http.Handler) http.Handler {
 		totalResponsesSent              = expvar.NewInt("total_responses_sent")
 		totalProcessingTimeMicroseconds = expvar.NewInt("total_processing_time_μs")
 		totalResponsesSentByStatus      = expvar.NewMap("total_responses_sent_by_status")
+		routes                          = newRouteMetricsRegistry()
+		excludedRoutes                  = newRouteExcluder(app.config.metrics.excludeRoutes)
 	)
+	expvar.Publish("routes", expvar.Func(routes.snapshot))
 
 	// The following code will be run for every request...
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -311,6 +425,12 @@ func (app *application) metrics(next http.Handler) http.Handler {
 		// that the metrics middleware received.
 		mw := newMetricsResponseWriter(w)
 
+		// Count the bytes read from the request body, and add a routeInfo to the context so that
+		// the router can tell us which route handled the request.
+		body := &countingReadCloser{ReadCloser: r.Body}
+		r.Body = body
+		r, route := contextSetRouteInfo(r)
+
 		// Call the next handler in the chain using the new metricsResponseWriter as the
 		// http.ResponseWriter value.
 		next.ServeHTTP(mw, r)
@@ -327,7 +447,19 @@ func (app *application) metrics(next http.Handler) http.Handler {
 
 		// Calculate the number of microseconds since we began to process the request, then
 		// increment the total processing time by this amount.
-		duration := time.Since(start).Microseconds()
-		totalProcessingTimeMicroseconds.Add(duration)
+		duration := time.Since(start)
+		totalProcessingTimeMicroseconds.Add(duration.Microseconds())
+
+		// Record the same request against the route's own metrics, unless the route is excluded
+		// from them.
+		if excludedRoutes.excluded(route.label) {
+			return
+		}
+		routes.get(route.label).observe(
+			mw.statusCode,
+			duration.Seconds(),
+			body.n,
+			mw.bytesWritten,
+		)
 	})
 }
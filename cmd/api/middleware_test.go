@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/walkccc/greenlight/internal/data"
+)
+
+// stubPermissionModel returns the same permissions for every user, and counts the lookups.
+type stubPermissionModel struct {
+	data.PermissionModelInterface
+	permissions data.Permissions
+	lookups     *int
+}
+
+func (m stubPermissionModel) GetAllForUser(
+	ctx context.Context,
+	userID int64,
+) (data.Permissions, error) {
+	*m.lookups++
+	return m.permissions, nil
+}
+
+func TestRequireOwnershipOr(t *testing.T) {
+	owner := func(r *http.Request) (int64, error) {
+		if r.URL.Path == "/missing" {
+			return 0, data.ErrRecordNotFound
+		}
+		return 1, nil
+	}
+
+	tests := []struct {
+		name        string
+		path        string
+		userID      int64
+		permissions data.Permissions
+		status      int
+		lookups     int
+	}{
+		{"owner", "/reviews/1", 1, nil, http.StatusNoContent, 0},
+		{"admin", "/reviews/1", 2, data.Permissions{"admin:write"}, http.StatusNoContent, 1},
+		{"other user", "/reviews/1", 2, data.Permissions{"movies:read"}, http.StatusForbidden, 1},
+		{"missing", "/missing", 1, nil, http.StatusNotFound, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var lookups int
+			app := &application{models: data.Models{
+				Permissions: stubPermissionModel{permissions: tt.permissions, lookups: &lookups},
+			}}
+			noContent := func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusNoContent)
+			}
+			handler := app.requireOwnershipOr("admin:write", owner, noContent)
+
+			r := httptest.NewRequest(http.MethodDelete, tt.path, nil)
+			r = app.contextSetUser(r, &data.User{ID: tt.userID, Activated: true})
+			rr := httptest.NewRecorder()
+			handler(rr, r)
+
+			assert.Equal(t, tt.status, rr.Code)
+			assert.Equal(t, tt.lookups, lookups)
+		})
+	}
+}
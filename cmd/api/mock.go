@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/justinas/alice"
+	"github.com/walkccc/greenlight/internal/dto"
+)
+
+// mockData is what the mock templates are executed with.
+type mockData struct {
+	Version string            // the API version, e.g. "v1"
+	Params  map[string]string // the path parameters, e.g. {"id": "1"}
+	Query   url.Values
+}
+
+// loadMockTemplates parses the *.tmpl files in the directory, which define the mock responses of
+// the routes by the routes' method and pattern, for example:
+//
+//	{{define "GET /movies/:id"}}{"movie": {"id": {{.Params.id}}, "title": "Casablanca"}}{{end}}
+//
+// It returns nil if the directory is empty.
+func loadMockTemplates(dir string) (*template.Template, error) {
+	if dir == "" {
+		return nil, nil
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.tmpl"))
+	if err != nil || len(files) == 0 {
+		return nil, err
+	}
+	return template.ParseFiles(files...)
+}
+
+// mockRoutes returns the handler of the -mock mode, in which every API route answers with fixture
+// data rather than touching the database: its template's output if it has one, or else a
+// deterministic example of its documented response, with its documented status. The requests
+// aren't authenticated or validated, so that the frontends can be developed against the API's
+// contract before a backend environment is up.
+func (app *application) mockRoutes() http.Handler {
+	router := httprouter.New()
+	router.NotFound = http.HandlerFunc(app.notFoundResponse)
+	router.MethodNotAllowed = http.HandlerFunc(app.methodNotAllowedResponse)
+	router.GlobalOPTIONS = http.HandlerFunc(app.optionsHandler)
+
+	root := newRouteGroup(router.HandlerFunc)
+	for _, version := range []string{apiV1, apiV2} {
+		version := version
+		group := root.group(version, "/"+version, handlerMiddleware(
+			func(next http.HandlerFunc) http.HandlerFunc {
+				return app.versioned(version, next)
+			},
+		))
+		for _, endpoint := range dto.Endpoints {
+			group.handle(endpoint.Method, endpoint.Path, app.mockHandler(endpoint))
+		}
+	}
+
+	return alice.New(app.requestContext, app.recoverPanic, app.enableCORS).Then(router)
+}
+
+// mockHandler returns the handler answering the endpoint's requests with fixture data.
+func (app *application) mockHandler(endpoint dto.Endpoint) http.HandlerFunc {
+	var tmpl *template.Template
+	if app.mocks != nil {
+		tmpl = app.mocks.Lookup(endpoint.Method + " " + endpoint.Path)
+	}
+
+	// The documented responses are objects, which writeJSON() takes as an envelope.
+	var example envelope
+	if endpoint.Response != nil {
+		js, err := json.Marshal(dto.Example(endpoint.Response))
+		if err == nil {
+			err = json.Unmarshal(js, &example)
+		}
+		if err != nil {
+			panic(fmt.Sprintf("mock response of %s %s: %v", endpoint.Method, endpoint.Path, err))
+		}
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Mock", "true")
+
+		switch {
+		case tmpl != nil:
+			mock := mockData{
+				Version: app.contextGetAPIVersion(r),
+				Params:  make(map[string]string),
+				Query:   r.URL.Query(),
+			}
+			for _, param := range httprouter.ParamsFromContext(r.Context()) {
+				mock.Params[param.Key] = param.Value
+			}
+
+			var buf bytes.Buffer
+			err := tmpl.Execute(&buf, mock)
+			if err != nil {
+				app.serverErrorResponse(w, r, err)
+				return
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(endpoint.Status)
+			w.Write([]byte(strings.TrimSpace(buf.String()) + "\n"))
+
+		case endpoint.Response != nil:
+			err := app.writeJSON(w, endpoint.Status, example, nil)
+			if err != nil {
+				app.serverErrorResponse(w, r, err)
+			}
+
+		default:
+			w.WriteHeader(endpoint.Status)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMockRoutes(t *testing.T) {
+	dir := t.TempDir()
+	err := os.WriteFile(filepath.Join(dir, "movies.tmpl"), []byte(`
+{{define "GET /movies/:id"}}
+{"movie": {"id": {{.Params.id}}, "title": "Casablanca", "version": 1}, "api": "{{.Version}}"}
+{{end}}
+`), 0o600)
+	require.NoError(t, err)
+
+	app := &application{}
+	app.mocks, err = loadMockTemplates(dir)
+	require.NoError(t, err)
+	handler := app.mockRoutes()
+
+	serve := func(method, path string) (*httptest.ResponseRecorder, map[string]any) {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(method, path, nil))
+
+		var body map[string]any
+		if rr.Body.Len() > 0 {
+			require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &body), rr.Body.String())
+		}
+		return rr, body
+	}
+
+	// The templated route.
+	rr, body := serve(http.MethodGet, "/v2/movies/7")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "true", rr.Header().Get("X-Mock"))
+	assert.Equal(t, map[string]any{"id": 7.0, "title": "Casablanca", "version": 1.0}, body["movie"])
+	assert.Equal(t, "v2", body["api"])
+
+	// The generated fixtures, which are the same on every request.
+	rr, body = serve(http.MethodGet, "/v1/movies")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	movies := body["movies"].([]any)
+	require.Len(t, movies, 1)
+	assert.Equal(t, "title", movies[0].(map[string]any)["title"])
+	assert.Equal(t, "2024-01-01T12:00:00Z", movies[0].(map[string]any)["created_at"])
+
+	_, again := serve(http.MethodGet, "/v1/movies")
+	assert.Equal(t, body, again)
+
+	// The documented status, without authentication or a database.
+	rr, body = serve(http.MethodPost, "/v1/users")
+	assert.Equal(t, http.StatusAccepted, rr.Code)
+	assert.Equal(t, "alice@example.com", body["user"].(map[string]any)["email"])
+
+	rr, _ = serve(http.MethodGet, "/v1/nothing")
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
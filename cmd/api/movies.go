@@ -1,52 +1,90 @@
 package main
 
 import (
+	"context"
 	"errors"
-	"fmt"
+	"mime"
 	"net/http"
+	"strings"
 
+	"github.com/julienschmidt/httprouter"
 	"github.com/walkccc/greenlight/internal/data"
+	"github.com/walkccc/greenlight/internal/dto"
 	"github.com/walkccc/greenlight/internal/validator"
 )
 
 func (app *application) getMoviesHandler(w http.ResponseWriter, r *http.Request) {
-	var input struct {
-		Title  string
-		Genres []string
-		data.Filters
+	input := dto.ListMoviesQuery{
+		Genres:   []string{},
+		Page:     1,
+		PageSize: app.config.pagination.defaultPageSize,
+		Sort:     "id",
+		Count:    app.config.pagination.countStrategy,
 	}
 
 	v := validator.New()
-	qs := r.URL.Query()
+	app.readQuery(r.URL.Query(), &input, v)
 
-	input.Title = app.readString(qs, "title", "")
-	input.Genres = app.readCSV(qs, "genres", []string{})
-	input.Filters.Page = app.readInt(qs, "page", 1, v)
-	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
-	input.Filters.Sort = app.readString(qs, "sort", "id")
-	input.Filters.SortSafeValues = []string{
-		"id",
-		"title",
-		"year",
-		"runtime",
-		"-id",
-		"-title",
-		"-year",
-		"-runtime",
+	filters := app.paginate(input.Filters())
+
+	attributes, err := app.readAttributeFilter(r, v)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
 	}
 
-	if data.ValidateFilters(v, input.Filters); !v.Valid() {
-		app.failedValidationResponse(w, r, v.Errors)
+	data.ValidateYearRange(v, input.Years())
+	if data.ValidateFilters(v, filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v)
 		return
 	}
 
-	movies, metadata, err := app.models.Movies.GetAll(input.Title, input.Genres, input.Filters)
+	movies, metadata, err := app.models.Search.Search(
+		r.Context(),
+		app.contextGetUser(r).OrganizationID,
+		input.Title,
+		input.Genres,
+		input.Years(),
+		attributes,
+		filters,
+	)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
 
-	err = app.writeJSON(w, http.StatusOK, envelope{"movies": movies, "metadata": metadata}, nil)
+	if !app.checkPageInRange(w, r, filters, metadata) {
+		return
+	}
+
+	// Offer "did you mean" corrections for the title searches without any results.
+	if len(movies) == 0 && input.Title != "" && input.Page == 1 {
+		metadata.Suggestions, err = app.models.Movies.SuggestTitles(
+			r.Context(),
+			app.contextGetUser(r).OrganizationID,
+			input.Title,
+		)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	var facets *data.MovieFacets
+	if input.Facets {
+		facets, err = app.models.Search.Facets(
+			r.Context(),
+			app.contextGetUser(r).OrganizationID,
+			input.Title,
+			input.Genres,
+		)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	err = app.writeMovies(w, r, movies, metadata, facets)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -54,12 +92,7 @@ func (app *application) getMoviesHandler(w http.ResponseWriter, r *http.Request)
 
 // createMovieHandler handles requests for "POST /v1/movies".
 func (app *application) createMovieHandler(w http.ResponseWriter, r *http.Request) {
-	var input struct {
-		Title   string       `json:"title"`
-		Year    int32        `json:"year"`
-		Runtime data.Runtime `json:"runtime"`
-		Genres  []string     `json:"genres"`
-	}
+	var input dto.CreateMovieRequest
 
 	err := app.readJSON(w, r, &input)
 	if err != nil {
@@ -67,44 +100,235 @@ func (app *application) createMovieHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	movie := &data.Movie{
-		Title:   input.Title,
-		Year:    input.Year,
-		Runtime: input.Runtime,
-		Genres:  input.Genres,
-	}
-
 	v := validator.New()
 
-	if data.ValidateMovie(v, movie); !v.Valid() {
-		app.failedValidationResponse(w, r, v.Errors)
+	if v.Struct(input); !v.Valid() {
+		app.failedValidationResponse(w, r, v)
 		return
 	}
 
-	err = app.models.Movies.Create(movie)
+	movie := input.Movie(app.contextGetUser(r).OrganizationID)
+
+	data.ValidateMovie(v, movie)
+	err = app.validateMovieAttributes(r.Context(), v, movie)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	// The organization's movie limit is enforced by the insert, so that concurrent creates can't
+	// go past it.
+	err = app.models.Movies.Create(r.Context(), movie)
+	if err != nil {
+		var limitErr *data.MovieLimitError
+		switch {
+		case errors.As(err, &limitErr):
+			app.movieLimitReachedResponse(w, r, limitErr.MaxMovies)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.indexMovie(movie)
+	app.notifyMovieAdded(r, movie)
 
 	headers := make(http.Header)
-	headers.Set("Location", fmt.Sprintf("/v1/movies/%d", movie.ID))
+	headers.Set("Location", app.link(r, http.MethodGet, "/movies/:id", movie.ID).Href)
 
-	err = app.writeJSON(w, http.StatusCreated, envelope{"movie": movie}, headers)
+	err = app.writeMovie(w, r, http.StatusCreated, movie, headers)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
 }
 
-// getMovieHandler handles requests for "GET /v1/movies/:id".
+// formatRuntimes sets the format the movies' runtimes are encoded in. Clients can choose it with a
+// runtime parameter on the JSON media type they accept, e.g.
+// "Accept: application/json; runtime=iso8601", and otherwise get the configured default.
+func (app *application) formatRuntimes(
+	w http.ResponseWriter,
+	r *http.Request,
+	movies ...*data.Movie,
+) {
+	w.Header().Add("Vary", "Accept")
+
+	format := app.config.runtimeFormat
+
+	for _, mediaRange := range strings.Split(r.Header.Get("Accept"), ",") {
+		_, params, err := mime.ParseMediaType(mediaRange)
+		if err != nil {
+			continue
+		}
+
+		requested := data.RuntimeFormat(params["runtime"])
+		if validator.PermittedValue(requested, data.RuntimeFormats...) {
+			format = requested
+			break
+		}
+	}
+
+	for _, movie := range movies {
+		movie.RuntimeFormat = format
+	}
+}
+
+// writeMovie sends a single movie in the movie envelope, as JSON, MessagePack or XML, or as a
+// JSON:API document.
+func (app *application) writeMovie(
+	w http.ResponseWriter,
+	r *http.Request,
+	statusCode int,
+	movie *data.Movie,
+	headers http.Header,
+) error {
+	return app.writeChangedMovie(w, r, statusCode, movie, nil, headers)
+}
+
+// writeChangedMovie is like writeMovie, but lists the fields that were changed in the
+// changed_fields member next to the movie (or in the meta of a JSON:API document), unless they're
+// nil.
+func (app *application) writeChangedMovie(
+	w http.ResponseWriter,
+	r *http.Request,
+	statusCode int,
+	movie *data.Movie,
+	changedFields []string,
+	headers http.Header,
+) error {
+	app.formatRuntimes(w, r, movie)
+	app.addMovieLinks(r, movie)
+	w.Header().Set("ETag", movieETag(movie))
+
+	env := envelope{"movie": movie}
+	if changedFields != nil {
+		env["changed_fields"] = changedFields
+	}
+
+	switch {
+	case app.acceptsMsgpack(r):
+		return app.writeMsgpack(w, statusCode, env, headers)
+	case app.acceptsXML(r):
+		xmlEnv := xmlMovieEnvelope{Movie: movie, ChangedFields: changedFields}
+		return app.writeXML(w, statusCode, xmlEnv, headers)
+	case !app.acceptsJSONAPI(r):
+		return app.writeJSON(w, statusCode, env, headers)
+	}
+
+	resource, err := newJSONAPIResource("movies", movie.ID, movie.Links, movie)
+	if err != nil {
+		return err
+	}
+	doc := envelope{"data": resource}
+	if changedFields != nil {
+		doc["meta"] = envelope{"changed_fields": changedFields}
+	}
+	return app.writeJSONAPI(w, statusCode, doc, headers)
+}
+
+// writeMovies sends a page of movies in the movies envelope, as JSON, MessagePack or XML, or as a
+// JSON:API document with the pagination metadata as its meta. The facets are included if they
+// aren't nil.
+func (app *application) writeMovies(
+	w http.ResponseWriter,
+	r *http.Request,
+	movies []*data.Movie,
+	metadata data.Metadata,
+	facets *data.MovieFacets,
+) error {
+	app.formatRuntimes(w, r, movies...)
+	app.addMovieLinks(r, movies...)
+
+	env := envelope{"movies": movies, "metadata": metadata}
+	if facets != nil {
+		env["facets"] = facets
+	}
+
+	switch {
+	case app.acceptsMsgpack(r):
+		return app.writeMsgpack(w, http.StatusOK, env, nil)
+	case app.acceptsXML(r):
+		xmlEnv := xmlMoviesEnvelope{Movies: movies, Metadata: metadata, Facets: facets}
+		return app.writeXML(w, http.StatusOK, xmlEnv, nil)
+	case !app.acceptsJSONAPI(r):
+		return app.writeJSON(w, http.StatusOK, env, nil)
+	}
+
+	resources := make([]jsonAPIResource, len(movies))
+	for i, movie := range movies {
+		resource, err := newJSONAPIResource("movies", movie.ID, movie.Links, movie)
+		if err != nil {
+			return err
+		}
+		resources[i] = resource
+	}
+
+	// The facets are promoted next to the pagination metadata.
+	meta := struct {
+		data.Metadata
+		Facets *data.MovieFacets `json:"facets,omitempty"`
+	}{metadata, facets}
+
+	return app.writeJSONAPI(w, http.StatusOK, envelope{"data": resources, "meta": meta}, nil)
+}
+
+// remainingMovies returns how many more movies the organization can have, along with its limit.
+// The limit is zero, and the remaining count meaningless, if the organization has no limit. It's
+// an estimate, which the imports use to reject the rows beyond the limit early; the inserts
+// enforce the limit themselves.
+func (app *application) remainingMovies(
+	ctx context.Context,
+	organizationID int64,
+) (remaining, maxMovies int64, err error) {
+	limits, _, err := app.tenants.get(ctx, organizationID, app.models.Organizations.GetLimits)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if limits.MaxMovies == 0 {
+		return 0, 0, nil
+	}
+
+	usage, err := app.models.Organizations.GetUsage(ctx, organizationID)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return limits.MaxMovies - usage.Movies, limits.MaxMovies, nil
+}
+
+// indexMovie updates the search index with the movie that was just written. It runs in the
+// background, so a slow index doesn't hold up the writes; the movie is copied, since the response
+// still changes it.
+func (app *application) indexMovie(movie *data.Movie) {
+	indexed := *movie
+
+	app.background(func() {
+		err := app.models.Search.IndexMovie(context.Background(), &indexed)
+		if err != nil {
+			app.logger.PrintError(err, nil)
+		}
+	})
+}
+
+// getMovieHandler handles requests for "GET /v1/movies/:id", and for the feeds.
 func (app *application) getMovieHandler(w http.ResponseWriter, r *http.Request) {
+	switch feedID := httprouter.ParamsFromContext(r.Context()).ByName("id"); feedID {
+	case atomFeedID, rssFeedID:
+		app.movieFeedHandler(w, r, feedID)
+		return
+	}
+
 	id, err := app.readIDParam(r)
 	if err != nil {
 		app.notFoundResponse(w, r)
 		return
 	}
 
-	movie, err := app.models.Movies.Get(id)
+	movie, err := app.models.Movies.Get(r.Context(), app.contextGetUser(r).OrganizationID, id)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
@@ -115,7 +339,13 @@ func (app *application) getMovieHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	err = app.writeJSON(w, http.StatusOK, envelope{"movie": movie}, nil)
+	movie.Poster, err = app.moviePoster(r.Context(), movie.OrganizationID, movie.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeMovie(w, r, http.StatusOK, movie, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -129,7 +359,7 @@ func (app *application) updateMovieHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	movie, err := app.models.Movies.Get(id)
+	movie, err := app.models.Movies.Get(r.Context(), app.contextGetUser(r).OrganizationID, id)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
@@ -140,12 +370,7 @@ func (app *application) updateMovieHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	var input struct {
-		Title   *string       `json:"title"`
-		Year    *int32        `json:"year"`
-		Runtime *data.Runtime `json:"runtime"`
-		Genres  []string      `json:"genres"`
-	}
+	var input dto.UpdateMovieRequest
 
 	err = app.readJSON(w, r, &input)
 	if err != nil {
@@ -153,27 +378,109 @@ func (app *application) updateMovieHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	if input.Title != nil {
-		movie.Title = *input.Title
+	v := validator.New()
+
+	v.Struct(input)
+	input.Nulls.Check(v, input)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
 	}
-	if input.Year != nil {
-		movie.Year = *input.Year
+
+	if input.Version != nil && *input.Version != movie.Version {
+		app.movieEditConflictResponse(w, r, movie, input.Conflicts(movie))
+		return
+	}
+
+	input.Apply(movie)
+
+	data.ValidateMovie(v, movie)
+	err = app.validateMovieAttributes(r.Context(), v, movie)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
 	}
-	if input.Runtime != nil {
-		movie.Runtime = *input.Runtime
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
 	}
-	if input.Genres != nil {
-		movie.Genres = input.Genres
+
+	changedFields, err := app.models.Movies.Update(r.Context(), movie)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.currentMovieEditConflictResponse(w, r, id, input)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
 	}
 
+	if len(changedFields) > 0 {
+		app.indexMovie(movie)
+	}
+
+	err = app.writeChangedMovie(w, r, http.StatusOK, movie, changedFields, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// revertMovieHandler handles requests for "POST /v1/movies/:id/revert".
+func (app *application) revertMovieHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input dto.RevertMovieQuery
+
 	v := validator.New()
 
-	if data.ValidateMovie(v, movie); !v.Valid() {
-		app.failedValidationResponse(w, r, v.Errors)
+	app.readQuery(r.URL.Query(), &input, v)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	organizationID := app.contextGetUser(r).OrganizationID
+
+	movie, err := app.models.Movies.Get(r.Context(), organizationID, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if input.To >= movie.Version {
+		v.AddError("to", validator.CodeInvalid, "must be a version before the current one")
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	revision, err := app.models.Movies.GetRevision(r.Context(), organizationID, id, input.To)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
 		return
 	}
 
-	err = app.models.Movies.Update(movie)
+	movie.Title = revision.Title
+	movie.Year = revision.Year
+	movie.Runtime = revision.Runtime
+	movie.Genres = revision.Genres
+	movie.Attributes = revision.Attributes
+
+	changedFields, err := app.models.Movies.Revert(r.Context(), movie, input.To)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrEditConflict):
@@ -184,12 +491,39 @@ func (app *application) updateMovieHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	err = app.writeJSON(w, http.StatusOK, envelope{"movie": movie}, nil)
+	if len(changedFields) > 0 {
+		app.indexMovie(movie)
+	}
+
+	err = app.writeChangedMovie(w, r, http.StatusOK, movie, changedFields, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
 }
 
+// currentMovieEditConflictResponse reloads the movie that changed while it was being updated, and
+// sends the edit conflict with its current state. If the movie has been deleted in the meantime,
+// a 404 Not Found is sent instead.
+func (app *application) currentMovieEditConflictResponse(
+	w http.ResponseWriter,
+	r *http.Request,
+	id int64,
+	input dto.UpdateMovieRequest,
+) {
+	current, err := app.models.Movies.Get(r.Context(), app.contextGetUser(r).OrganizationID, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.movieEditConflictResponse(w, r, current, input.Conflicts(current))
+}
+
 // deleteMovieHandler handles requests for "DELETE /v1/movies/:id".
 func (app *application) deleteMovieHandler(w http.ResponseWriter, r *http.Request) {
 	id, err := app.readIDParam(r)
@@ -198,17 +532,56 @@ func (app *application) deleteMovieHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	err = app.models.Movies.Delete(id)
+	organizationID := app.contextGetUser(r).OrganizationID
+
+	condition := readIfMatch(r)
+	if condition == nil && app.config.requireIfMatch {
+		app.preconditionRequiredResponse(w, r)
+		return
+	}
+
+	// With an If-Match header, the movie is only deleted if it's still at the version the
+	// condition was checked against.
+	var version int32
+	if condition != nil {
+		movie, err := app.models.Movies.Get(r.Context(), organizationID, id)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				app.notFoundResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		if !condition.matches(movie) {
+			app.preconditionFailedResponse(w, r, movie)
+			return
+		}
+		version = movie.Version
+	}
+
+	err = app.models.Movies.Delete(r.Context(), organizationID, id, version)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
 			app.notFoundResponse(w, r)
+		case errors.Is(err, data.ErrEditConflict):
+			app.preconditionFailedResponse(w, r, nil)
 		default:
 			app.serverErrorResponse(w, r, err)
 		}
 		return
 	}
 
+	app.background(func() {
+		err := app.models.Search.DeleteMovie(context.Background(), organizationID, id)
+		if err != nil {
+			app.logger.PrintError(err, nil)
+		}
+	})
+
 	err = app.writeJSON(
 		w,
 		http.StatusCreated,
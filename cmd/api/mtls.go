@@ -0,0 +1,106 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/walkccc/greenlight/internal/data"
+)
+
+// serveMTLS starts a second listener, which serves the same routes over TLS and requires the
+// clients to present a certificate signed by the client CA, for internal deployments where the
+// services authenticate each other by their certificates. authenticateCertificate() then makes the
+// requests as the service account that the certificate's identity is mapped to. The caller shuts
+// the returned server down.
+func (app *application) serveMTLS(handler http.Handler) (*http.Server, error) {
+	cert, err := tls.LoadX509KeyPair(app.config.mtls.certFile, app.config.mtls.keyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	pem, err := os.ReadFile(app.config.mtls.clientCAFile)
+	if err != nil {
+		return nil, err
+	}
+	clientCAs := x509.NewCertPool()
+	if !clientCAs.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in %s", app.config.mtls.clientCAFile)
+	}
+
+	server := &http.Server{
+		Addr:         app.config.mtls.addr,
+		Handler:      handler,
+		IdleTimeout:  time.Minute,
+		ReadTimeout:  5 * time.Second,
+		WriteTimeout: 10 * time.Second,
+		TLSConfig: &tls.Config{
+			Certificates: []tls.Certificate{cert},
+			ClientAuth:   tls.RequireAndVerifyClientCert,
+			ClientCAs:    clientCAs,
+			MinVersion:   tls.VersionTLS12,
+		},
+	}
+
+	listener, err := net.Listen("tcp", server.Addr)
+	if err != nil {
+		return nil, err
+	}
+
+	go func() {
+		app.logger.PrintInfo("starting mtls server", map[string]string{
+			"addr": listener.Addr().String(),
+		})
+
+		err := server.ServeTLS(listener, "", "")
+		if !errors.Is(err, http.ErrServerClosed) {
+			app.logger.PrintError(err, map[string]string{"addr": server.Addr})
+		}
+	}()
+
+	return server, nil
+}
+
+// certificateIdentity returns the identity of a client certificate: its first URI SAN if it has
+// one (e.g. a SPIFFE ID such as spiffe://example.org/ns/billing/sa/worker), or its subject's
+// common name otherwise.
+func certificateIdentity(cert *x509.Certificate) string {
+	if len(cert.URIs) > 0 {
+		return cert.URIs[0].String()
+	}
+	return cert.Subject.CommonName
+}
+
+// authenticateCertificate authenticates the requests made over the mTLS listener with a verified
+// client certificate, as the user of the service account that the certificate's identity is
+// mapped to. A certificate that isn't mapped to one is rejected, rather than treated as
+// anonymous. The other requests are left to the following authentication middleware.
+func (app *application) authenticateCertificate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		identity := certificateIdentity(r.TLS.VerifiedChains[0][0])
+
+		user, err := app.models.Users.GetForCertificate(r.Context(), identity)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				app.unknownCertificateResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		r = app.contextSetUser(r, user)
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/walkccc/greenlight/internal/data"
+)
+
+// stubServiceAccountUsers returns a user for the billing worker's certificate.
+type stubServiceAccountUsers struct {
+	data.UserModelInterface
+}
+
+func (m stubServiceAccountUsers) GetForCertificate(
+	ctx context.Context,
+	identity string,
+) (*data.User, error) {
+	if identity != "spiffe://example.org/ns/billing/sa/worker" {
+		return nil, data.ErrRecordNotFound
+	}
+	return &data.User{ID: 9, OrganizationID: 2}, nil
+}
+
+func TestAuthenticateCertificate(t *testing.T) {
+	app := &application{models: data.Models{Users: stubServiceAccountUsers{}}}
+
+	var user *data.User
+	handler := app.authenticateCertificate(app.authenticate(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			user = app.contextGetUser(r)
+		},
+	)))
+
+	serve := func(cert *x509.Certificate) int {
+		r := httptest.NewRequest(http.MethodGet, "/v1/movies", nil)
+		if cert != nil {
+			r.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, r)
+		return rr.Code
+	}
+
+	spiffeID, _ := url.Parse("spiffe://example.org/ns/billing/sa/worker")
+	worker := &x509.Certificate{
+		Subject: pkix.Name{CommonName: "worker"},
+		URIs:    []*url.URL{spiffeID},
+	}
+	assert.Equal(t, http.StatusOK, serve(worker))
+	assert.Equal(t, int64(9), user.ID)
+	assert.Equal(t, int64(2), user.OrganizationID)
+
+	// A certificate that isn't mapped is rejected, while the plain requests are anonymous.
+	assert.Equal(t, http.StatusUnauthorized, serve(&x509.Certificate{
+		Subject: pkix.Name{CommonName: "worker"},
+	}))
+	assert.Equal(t, http.StatusOK, serve(nil))
+	assert.True(t, user.IsAnonymous())
+}
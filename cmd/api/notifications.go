@@ -0,0 +1,322 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/walkccc/greenlight/internal/data"
+	"github.com/walkccc/greenlight/internal/dto"
+	"github.com/walkccc/greenlight/internal/validator"
+)
+
+// listNotificationsHandler handles requests for "GET /v1/users/me/notifications". With
+// ?unread=true, only the unread notifications are listed.
+func (app *application) listNotificationsHandler(w http.ResponseWriter, r *http.Request) {
+	input := dto.ListNotificationsQuery{
+		Page:     1,
+		PageSize: app.config.pagination.defaultPageSize,
+	}
+
+	v := validator.New()
+	app.readQuery(r.URL.Query(), &input, v)
+
+	filters := app.paginate(input.Filters())
+
+	if data.ValidateFilters(v, filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	notifications, metadata, err := app.models.Notifications.GetAllForUser(
+		r.Context(),
+		user.ID,
+		user.OrganizationID,
+		input.Unread,
+		filters,
+	)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if !app.checkPageInRange(w, r, filters, metadata) {
+		return
+	}
+
+	err = app.writeJSON(
+		w,
+		http.StatusOK,
+		envelope{"notifications": notifications, "metadata": metadata},
+		nil,
+	)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// updateNotificationHandler handles requests for "PATCH /v1/users/me/notifications/:id", which
+// mark the notification as read or unread.
+func (app *application) updateNotificationHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input dto.UpdateNotificationRequest
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	if v.Struct(input); !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	notification, err := app.models.Notifications.SetRead(
+		r.Context(),
+		user.ID,
+		user.OrganizationID,
+		id,
+		*input.Read,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"notification": notification}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// getNotificationPreferencesHandler handles requests for
+// "GET /v1/users/me/notification-preferences".
+func (app *application) getNotificationPreferencesHandler(w http.ResponseWriter, r *http.Request) {
+	preferences, err := app.models.Notifications.GetPreferences(
+		r.Context(),
+		app.contextGetUser(r).ID,
+	)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"preferences": preferences}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// updateNotificationPreferencesHandler handles requests for
+// "PATCH /v1/users/me/notification-preferences".
+func (app *application) updateNotificationPreferencesHandler(
+	w http.ResponseWriter,
+	r *http.Request,
+) {
+	preferences, err := app.models.Notifications.GetPreferences(
+		r.Context(),
+		app.contextGetUser(r).ID,
+	)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	var input dto.UpdateNotificationPreferencesRequest
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	v.Struct(input)
+	input.Nulls.Check(v, input)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	input.Apply(preferences)
+
+	if data.ValidateNotificationPreferences(v, preferences); !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	err = app.models.Notifications.UpdatePreferences(r.Context(), preferences)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"preferences": preferences}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// notifyMovieAdded notifies the users of the new movie: the members of its organization who watch
+// one of its genres, on the channels they asked for, and the users whose saved searches asked for
+// notifications and match it. The user who added the movie isn't notified of its genres. It runs
+// in the background, so that the movie's creation isn't held up by the mailer.
+func (app *application) notifyMovieAdded(r *http.Request, movie *data.Movie) {
+	userID := app.contextGetUser(r).ID
+	href := app.feedBaseURL(r) + app.link(r, http.MethodGet, "/movies/:id", movie.ID).Href
+
+	app.background(func() {
+		ctx := context.Background()
+
+		// Either kind of recipient is still notified if the other can't be looked up.
+		subscriptions, err := app.models.SavedSearches.GetSubscriptionsForMovie(ctx, movie)
+		if err != nil {
+			app.logger.PrintError(err, nil)
+		}
+		watchers, err := app.models.Notifications.GetWatchersForMovie(ctx, movie, userID)
+		if err != nil {
+			app.logger.PrintError(err, nil)
+		}
+
+		notifications, emails := movieAddedNotifications(movie, href, subscriptions, watchers)
+
+		for _, notification := range notifications {
+			err = app.models.Notifications.Insert(ctx, notification)
+			if err != nil {
+				app.logger.PrintError(err, nil)
+			}
+		}
+		for _, email := range emails {
+			err = app.mailer.Send(email.recipient, email.template, email.data)
+			if err != nil {
+				app.logger.PrintError(err, nil)
+			}
+		}
+	})
+}
+
+// notificationEmail is an email to send with one of the mailer's templates.
+type notificationEmail struct {
+	recipient string
+	template  string
+	data      map[string]any
+}
+
+// movieAddedNotifications returns the in-app notifications and the emails telling the users about
+// the new movie, in a single pass over its recipients, so that each user is emailed at most once.
+// A user whose saved search matches the movie is emailed about (the first of) their matching
+// searches, rather than about the movie's genres.
+func movieAddedNotifications(
+	movie *data.Movie,
+	href string,
+	subscriptions []*data.SearchSubscription,
+	watchers []*data.NotificationRecipient,
+) ([]*data.Notification, []notificationEmail) {
+	var notifications []*data.Notification
+	var emails []notificationEmail
+	emailed := make(map[int64]bool)
+
+	for _, subscription := range subscriptions {
+		if emailed[subscription.Search.UserID] {
+			continue
+		}
+		emailed[subscription.Search.UserID] = true
+
+		emails = append(emails, notificationEmail{
+			recipient: subscription.UserEmail,
+			template:  "saved_search_match.tmpl",
+			data: map[string]any{
+				"name":       subscription.UserName,
+				"searchName": subscription.Search.Name,
+				"movieTitle": movie.Title,
+				"movieYear":  movie.Year,
+				"movieURL":   href,
+			},
+		})
+	}
+
+	message := fmt.Sprintf(
+		"%s (%d) was added in %s",
+		movie.Title,
+		movie.Year,
+		strings.Join(movie.Genres, ", "),
+	)
+
+	for _, watcher := range watchers {
+		if watcher.InApp {
+			notifications = append(notifications, &data.Notification{
+				UserID:         watcher.UserID,
+				OrganizationID: movie.OrganizationID,
+				Kind:           data.NotificationMovieAdded,
+				Message:        message,
+				MovieID:        &movie.ID,
+			})
+		}
+
+		if watcher.Email && !emailed[watcher.UserID] {
+			emailed[watcher.UserID] = true
+
+			emails = append(emails, notificationEmail{
+				recipient: watcher.UserEmail,
+				template:  "movie_added.tmpl",
+				data: map[string]any{
+					"name":     watcher.UserName,
+					"message":  message,
+					"movieURL": href,
+				},
+			})
+		}
+	}
+
+	return notifications, emails
+}
+
+// sendSecurityAlert sends the message by text message to the user, if they asked for the security
+// alerts and the SMS alerts are enabled. It runs in the background, so that the request isn't held
+// up by the SMS provider.
+func (app *application) sendSecurityAlert(userID int64, message string) {
+	if app.sms == nil {
+		return
+	}
+
+	app.background(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+		defer cancel()
+
+		preferences, err := app.models.Notifications.GetPreferences(ctx, userID)
+		if err != nil {
+			app.logger.PrintError(err, nil)
+			return
+		}
+		if !preferences.SMSAlerts || preferences.Phone == "" {
+			return
+		}
+
+		err = app.sms.Send(ctx, preferences.Phone, message)
+		if err != nil {
+			app.logger.PrintError(err, map[string]string{"user_id": strconv.FormatInt(userID, 10)})
+		}
+	})
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/assert"
+	"github.com/walkccc/greenlight/greenlighttest"
+	"github.com/walkccc/greenlight/internal/data"
+)
+
+// stubNotificationModel holds the user's notifications, records the unread filter of the last
+// listing, and panics on the other methods.
+type stubNotificationModel struct {
+	data.NotificationModelInterface
+	notifications map[int64]*data.Notification
+	unreadOnly    *bool
+}
+
+func (m stubNotificationModel) GetAllForUser(
+	ctx context.Context,
+	userID, organizationID int64,
+	unreadOnly bool,
+	filters data.Filters,
+) ([]*data.Notification, data.Metadata, error) {
+	*m.unreadOnly = unreadOnly
+
+	notifications := []*data.Notification{}
+	for _, notification := range m.notifications {
+		if !unreadOnly || !notification.Read {
+			notifications = append(notifications, notification)
+		}
+	}
+	return notifications, data.Metadata{}, nil
+}
+
+func (m stubNotificationModel) SetRead(
+	ctx context.Context,
+	userID, organizationID, id int64,
+	read bool,
+) (*data.Notification, error) {
+	notification, found := m.notifications[id]
+	if !found || notification.UserID != userID || notification.OrganizationID != organizationID {
+		return nil, data.ErrRecordNotFound
+	}
+	notification.Read = read
+	return notification, nil
+}
+
+func TestNotificationHandlers(t *testing.T) {
+	unreadOnly := new(bool)
+	app := &application{models: data.Models{Notifications: stubNotificationModel{
+		notifications: map[int64]*data.Notification{
+			3: {ID: 3, UserID: 1, OrganizationID: 7, Message: "Moana was added"},
+			4: {ID: 4, UserID: 2, OrganizationID: 7, Message: "Up was added"},
+		},
+		unreadOnly: unreadOnly,
+	}}}
+	app.config.pagination.defaultPageSize = 20
+	app.config.pagination.maxPageSize = 100
+	app.config.pagination.maxPage = 100
+
+	router := httprouter.New()
+	handle := func(method, path string, handler http.HandlerFunc) {
+		router.HandlerFunc(method, path, func(w http.ResponseWriter, r *http.Request) {
+			r = app.contextSetUser(r, &data.User{ID: 1, OrganizationID: 7})
+			handler(w, r)
+		})
+	}
+	handle(http.MethodGet, "/v1/users/me/notifications", app.listNotificationsHandler)
+	handle(http.MethodPatch, "/v1/users/me/notifications/:id", app.updateNotificationHandler)
+	client := greenlighttest.New(t, router)
+
+	var notification data.Notification
+	client.Patch("/v1/users/me/notifications/3", map[string]any{"read": true}).
+		AssertStatus(http.StatusOK).
+		Decode("notification", &notification)
+	assert.True(t, notification.Read)
+
+	client.Patch("/v1/users/me/notifications/3", map[string]any{}).
+		AssertValidationError("read", "required")
+	client.Patch("/v1/users/me/notifications/4", map[string]any{"read": true}).
+		AssertStatus(http.StatusNotFound)
+
+	client.Get("/v1/users/me/notifications").AssertStatus(http.StatusOK)
+	assert.False(t, *unreadOnly)
+	client.Get("/v1/users/me/notifications?unread=true").AssertStatus(http.StatusOK)
+	assert.True(t, *unreadOnly)
+}
+
+func TestMovieAddedNotifications(t *testing.T) {
+	movie := &data.Movie{
+		ID:             5,
+		OrganizationID: 7,
+		Title:          "Moana",
+		Year:           2016,
+		Genres:         []string{"animation", "adventure"},
+	}
+	subscriptions := []*data.SearchSubscription{
+		{Search: &data.SavedSearch{UserID: 1, Name: "Animation"}, UserEmail: "alice@example.com"},
+		{Search: &data.SavedSearch{UserID: 1, Name: "Adventure"}, UserEmail: "alice@example.com"},
+		{Search: &data.SavedSearch{UserID: 2, Name: "Everything"}, UserEmail: "bob@example.com"},
+	}
+	watchers := []*data.NotificationRecipient{
+		{UserID: 1, UserEmail: "alice@example.com", InApp: true, Email: true},
+		{UserID: 3, UserEmail: "carol@example.com", InApp: false, Email: true},
+		{UserID: 4, UserEmail: "dave@example.com", InApp: true, Email: false},
+	}
+
+	notifications, emails := movieAddedNotifications(
+		movie,
+		"https://greenlight.example.com/v1/movies/5",
+		subscriptions,
+		watchers,
+	)
+
+	// A user whose saved searches match, and who watches the movie's genres, is emailed once,
+	// about the first of their searches.
+	type sent struct{ recipient, template string }
+	var got []sent
+	for _, email := range emails {
+		got = append(got, sent{email.recipient, email.template})
+	}
+	assert.Equal(t, []sent{
+		{"alice@example.com", "saved_search_match.tmpl"},
+		{"bob@example.com", "saved_search_match.tmpl"},
+		{"carol@example.com", "movie_added.tmpl"},
+	}, got)
+	assert.Equal(t, "Animation", emails[0].data["searchName"])
+
+	// The in-app notifications go to the watchers who asked for them.
+	if assert.Len(t, notifications, 2) {
+		assert.Equal(t, int64(1), notifications[0].UserID)
+		assert.Equal(t, int64(4), notifications[1].UserID)
+		assert.Equal(t, "Moana (2016) was added in animation, adventure", notifications[1].Message)
+		assert.Equal(t, int64(5), *notifications[1].MovieID)
+	}
+}
@@ -0,0 +1,20 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/walkccc/greenlight/internal/dto"
+)
+
+// openAPIHandler handles requests for "GET /v1/openapi.json". It serves the OpenAPI document of
+// the API version that was requested, generated from the request and response types. The document
+// describes the envelopes in the configured shape, but isn't reshaped itself.
+func (app *application) openAPIHandler(w http.ResponseWriter, r *http.Request) {
+	shape := app.config.envelope
+	document := dto.OpenAPI(version, app.contextGetAPIVersion(r), dto.Endpoints, shape)
+
+	err := app.encodeJSON(w, http.StatusOK, document, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/walkccc/greenlight/internal/dto"
+)
+
+// TestOpenAPIEndpoints checks that the OpenAPI document describes exactly the routes that are
+// registered.
+func TestOpenAPIEndpoints(t *testing.T) {
+	app := &application{}
+
+	var routes []string
+	app.apiRoutes(func(method, pattern string, handler http.HandlerFunc) {
+		routes = append(routes, method+" "+pattern)
+	})
+
+	var documented []string
+	for _, endpoint := range dto.Endpoints {
+		documented = append(documented, endpoint.Method+" "+endpoint.Path)
+	}
+
+	assert.ElementsMatch(t, routes, documented)
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/walkccc/greenlight/internal/data"
+	"github.com/walkccc/greenlight/internal/dto"
+	"github.com/walkccc/greenlight/internal/validator"
+)
+
+// createOrganizationHandler handles requests for "POST /v1/admin/organizations".
+func (app *application) createOrganizationHandler(w http.ResponseWriter, r *http.Request) {
+	var input dto.CreateOrganizationRequest
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	if v.Struct(input); !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	organization := &data.Organization{Name: input.Name}
+
+	err = app.models.Organizations.Create(r.Context(), organization)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set(
+		"Location",
+		app.link(r, http.MethodGet, "/admin/organizations/:id/members", organization.ID).Href,
+	)
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"organization": organization}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// listOrganizationMembersHandler handles requests for "GET /v1/admin/organizations/:id/members".
+func (app *application) listOrganizationMembersHandler(w http.ResponseWriter, r *http.Request) {
+	organization, ok := app.readOrganization(w, r)
+	if !ok {
+		return
+	}
+
+	members, err := app.models.Organizations.GetMembers(r.Context(), organization.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	env := envelope{"organization": organization, "members": members}
+
+	err = app.writeJSON(w, http.StatusOK, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// setOrganizationMemberHandler handles requests for
+// "PUT /v1/admin/organizations/:id/members/:user_id". It adds the user to the organization, or
+// changes their role if they already are a member.
+func (app *application) setOrganizationMemberHandler(w http.ResponseWriter, r *http.Request) {
+	organization, ok := app.readOrganization(w, r)
+	if !ok {
+		return
+	}
+
+	userID, err := app.readIDParamNamed(r, "user_id")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input dto.SetOrganizationMemberRequest
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	if v.Struct(input); !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	if input.Role == "" {
+		input.Role = data.RoleMember
+	}
+
+	err = app.models.Organizations.SetMember(r.Context(), organization.ID, userID, input.Role)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	env := envelope{"message": fmt.Sprintf("user is now a %s of the organization", input.Role)}
+
+	err = app.writeJSON(w, http.StatusOK, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// removeOrganizationMemberHandler handles requests for
+// "DELETE /v1/admin/organizations/:id/members/:user_id".
+func (app *application) removeOrganizationMemberHandler(w http.ResponseWriter, r *http.Request) {
+	organization, ok := app.readOrganization(w, r)
+	if !ok {
+		return
+	}
+
+	userID, err := app.readIDParamNamed(r, "user_id")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.models.Organizations.RemoveMember(r.Context(), organization.ID, userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(
+		w,
+		http.StatusOK,
+		envelope{"message": "user successfully removed from the organization"},
+		nil,
+	)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// setOrganizationLimitsHandler handles requests for "PUT /v1/admin/organizations/:id/limits". It
+// replaces all of the organization's limits, so an omitted limit is removed.
+func (app *application) setOrganizationLimitsHandler(w http.ResponseWriter, r *http.Request) {
+	organization, ok := app.readOrganization(w, r)
+	if !ok {
+		return
+	}
+
+	var input dto.SetOrganizationLimitsRequest
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	if v.Struct(input); !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	limits := input.Limits(organization.ID)
+
+	if data.ValidateOrganizationLimits(v, limits); !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	err = app.models.Organizations.SetLimits(r.Context(), limits)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// Other instances pick up the change once their cached limits expire.
+	app.tenants.invalidate(organization.ID)
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"limits": limits}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// getOrganizationUsageHandler handles requests for "GET /v1/organization/usage". It reports the
+// current consumption of the organization the user's token is scoped to.
+func (app *application) getOrganizationUsageHandler(w http.ResponseWriter, r *http.Request) {
+	organizationID := app.contextGetUser(r).OrganizationID
+
+	usage, err := app.models.Organizations.GetUsage(r.Context(), organizationID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	// The requests that this instance hasn't flushed yet are added.
+	usage.Requests += app.tenants.pending(organizationID, usage.Date)
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"usage": usage}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// readOrganization loads the organization given by the "id" URL parameter. If it can't, it sends
+// the error response and returns false.
+func (app *application) readOrganization(
+	w http.ResponseWriter,
+	r *http.Request,
+) (*data.Organization, bool) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil, false
+	}
+
+	organization, err := app.models.Organizations.Get(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+
+	return organization, true
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/walkccc/greenlight/internal/data"
+	"github.com/walkccc/greenlight/webhook"
+)
+
+// outboxCleanupInterval is how often the relay deletes the delivered events that are past the
+// retention period.
+const outboxCleanupInterval = time.Hour
+
+// eventPublisher publishes the domain events relayed from the outbox, e.g. to a webhook or a
+// message broker.
+type eventPublisher interface {
+	Publish(ctx context.Context, event *data.OutboxEvent) error
+}
+
+// webhookPublisher posts each event as JSON to a URL. The event's ID is sent in the X-Event-ID
+// header, so that the receiver can deduplicate the events that are delivered more than once. If
+// there's a secret, the deliveries are signed with it, which the receiver checks with
+// webhook.Verify().
+type webhookPublisher struct {
+	url    string
+	secret []byte
+	client *http.Client
+}
+
+func newWebhookPublisher(url, secret string) *webhookPublisher {
+	return &webhookPublisher{
+		url:    url,
+		secret: []byte(secret),
+		client: &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+func (p *webhookPublisher) Publish(ctx context.Context, event *data.OutboxEvent) error {
+	status, err := p.deliver(ctx, event)
+	if err != nil {
+		return err
+	}
+
+	if status < 200 || status >= 300 {
+		return fmt.Errorf("webhook: unexpected status %d", status)
+	}
+	return nil
+}
+
+// deliver posts the event to the webhook, and returns the receiver's status code.
+func (p *webhookPublisher) deliver(ctx context.Context, event *data.OutboxEvent) (int, error) {
+	js, err := json.Marshal(event)
+	if err != nil {
+		return 0, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.url, bytes.NewReader(js))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Event-ID", strconv.FormatInt(event.ID, 10))
+	req.Header.Set("X-Event-Kind", event.Kind)
+	if len(p.secret) > 0 {
+		req.Header.Set(webhook.SignatureHeader, webhook.Sign(p.secret, time.Now(), js))
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+
+	return resp.StatusCode, nil
+}
+
+// webhookTestHandler handles requests for "POST /v1/admin/webhooks/test". It sends a sample
+// movie.created event to the outbox's webhook, signed like the relay's deliveries, and reports
+// the receiver's status code, so that a receiver can be checked before any real event is sent.
+// The sample's ID is 0, which no real event has.
+func (app *application) webhookTestHandler(w http.ResponseWriter, r *http.Request) {
+	if app.webhook == nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	now := time.Now().UTC()
+	payload, err := json.Marshal(&data.Movie{
+		ID:        1,
+		CreatedAt: now,
+		UpdatedAt: now,
+		Title:     "Moana",
+		Year:      2016,
+		Runtime:   107,
+		Genres:    []string{"animation", "adventure"},
+		Version:   1,
+	})
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	event := &data.OutboxEvent{
+		CreatedAt:   now,
+		Kind:        data.EventMovieCreated,
+		AggregateID: 1,
+		Payload:     payload,
+	}
+
+	status, err := app.webhook.deliver(r.Context(), event)
+	if err != nil {
+		app.logger.PrintError(err, map[string]string{"request_url": r.URL.String()})
+		app.errorResponse(w, r, http.StatusBadGateway, "the webhook could not be reached")
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"kind": event.Kind, "status": status}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// startOutboxRelay starts the goroutine that publishes the outbox's events every poll interval,
+// and deletes the delivered events once they're past the retention period. A shutdown hook stops
+// it, after the batch it's relaying (if any) is done.
+func (app *application) startOutboxRelay(publisher eventPublisher) {
+	stop := make(chan struct{})
+	done := make(chan struct{})
+
+	app.onShutdown("outbox relay", func(ctx context.Context) error {
+		close(stop)
+		select {
+		case <-done:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+
+	go func() {
+		defer close(done)
+
+		ticker := time.NewTicker(app.config.outbox.pollInterval)
+		defer ticker.Stop()
+
+		var cleanedAt time.Time
+
+		for {
+			app.relayOutbox(publisher)
+
+			if time.Since(cleanedAt) >= outboxCleanupInterval {
+				_, err := app.models.Outbox.DeleteDelivered(
+					context.Background(),
+					app.config.outbox.retention,
+				)
+				if err != nil {
+					app.logger.PrintError(err, nil)
+				}
+				cleanedAt = time.Now()
+			}
+
+			select {
+			case <-ticker.C:
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+// relayOutbox publishes the due events in batches, until a batch comes back short.
+func (app *application) relayOutbox(publisher eventPublisher) {
+	ctx := context.Background()
+	batchSize := app.config.outbox.batchSize
+
+	publish := func(event *data.OutboxEvent) error {
+		ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		defer cancel()
+
+		err := publisher.Publish(ctx, event)
+		if err != nil {
+			app.logger.PrintError(err, map[string]string{
+				"event_id":   strconv.FormatInt(event.ID, 10),
+				"event_kind": event.Kind,
+			})
+		}
+		return err
+	}
+
+	for {
+		delivered, err := app.models.Outbox.Relay(ctx, batchSize, publish)
+		if err != nil {
+			app.logger.PrintError(err, nil)
+			return
+		}
+
+		if delivered < batchSize {
+			return
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/walkccc/greenlight/internal/data"
+	"github.com/walkccc/greenlight/internal/jsonlog"
+	"github.com/walkccc/greenlight/webhook"
+)
+
+func TestWebhookTestHandler(t *testing.T) {
+	secret := []byte("secret")
+	var received data.OutboxEvent
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+
+		header := r.Header.Get(webhook.SignatureHeader)
+		if err := webhook.Verify(secret, header, body, webhook.DefaultTolerance); err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		assert.Equal(t, "0", r.Header.Get("X-Event-ID"))
+		assert.Equal(t, data.EventMovieCreated, r.Header.Get("X-Event-Kind"))
+		require.NoError(t, json.Unmarshal(body, &received))
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer receiver.Close()
+
+	app := &application{
+		logger:  jsonlog.New(io.Discard, jsonlog.LevelOff),
+		webhook: newWebhookPublisher(receiver.URL, string(secret)),
+	}
+
+	send := func() (int, map[string]any) {
+		rr := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/v1/admin/webhooks/test", nil)
+		app.webhookTestHandler(rr, r)
+
+		var body map[string]any
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &body))
+		return rr.Code, body
+	}
+
+	code, body := send()
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, map[string]any{"kind": data.EventMovieCreated, "status": float64(202)}, body)
+	assert.Equal(t, data.EventMovieCreated, received.Kind)
+	var movie struct {
+		Title string `json:"title"`
+	}
+	require.NoError(t, json.Unmarshal(received.Payload, &movie))
+	assert.Equal(t, "Moana", movie.Title)
+
+	// The receiver's failures are reported, rather than failing the request.
+	app.webhook = newWebhookPublisher(receiver.URL, "wrong")
+	code, body = send()
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, float64(http.StatusUnauthorized), body["status"])
+
+	receiver.Close()
+	code, _ = send()
+	assert.Equal(t, http.StatusBadGateway, code)
+
+	app.webhook = nil
+	code, _ = send()
+	assert.Equal(t, http.StatusNotFound, code)
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/walkccc/greenlight/internal/reqctx"
+)
+
+// panicFingerprintFrames is the number of stack frames, from the one that panicked, that the
+// fingerprints are computed from.
+const panicFingerprintFrames = 10
+
+// panicReport holds the details of a panic recovered while handling a request.
+type panicReport struct {
+	Fingerprint string    `json:"fingerprint"`
+	Value       string    `json:"value"`
+	Time        time.Time `json:"time"`
+	Method      string    `json:"request_method"`
+	URL         string    `json:"request_url"`
+	Route       string    `json:"route"`
+	UserID      int64     `json:"user_id,omitempty"`
+	Count       int64     `json:"count"` // of the panics with this fingerprint since startup
+	Stack       string    `json:"stack"`
+}
+
+// panicHook is a function that's called with the report of a recovered panic, e.g. to page
+// someone.
+type panicHook func(report panicReport)
+
+// onPanic registers a hook to be called with the reports of the recovered panics. The hooks are
+// called in the background, at most once per fingerprint and panic alert interval, so that a panic
+// hit by every request doesn't flood them. Hooks should be added before the server starts.
+func (app *application) onPanic(hook panicHook) {
+	app.panicHooks = append(app.panicHooks, hook)
+}
+
+// panicTracker counts the panics by fingerprint, and remembers when each of them was last alerted.
+type panicTracker struct {
+	mtx      sync.Mutex
+	total    int64
+	panics   map[string]*trackedPanic
+	interval time.Duration // between two alerts for the same fingerprint
+}
+
+type trackedPanic struct {
+	count     int64
+	alertedAt time.Time
+}
+
+func newPanicTracker(alertInterval time.Duration) *panicTracker {
+	return &panicTracker{panics: make(map[string]*trackedPanic), interval: alertInterval}
+}
+
+// observe counts an occurrence of the fingerprint. It returns the number of occurrences so far,
+// and whether the hooks are due to be alerted.
+func (pt *panicTracker) observe(fingerprint string, now time.Time) (int64, bool) {
+	pt.mtx.Lock()
+	defer pt.mtx.Unlock()
+
+	p, found := pt.panics[fingerprint]
+	if !found {
+		p = &trackedPanic{}
+		pt.panics[fingerprint] = p
+	}
+	p.count++
+	pt.total++
+
+	alert := p.alertedAt.IsZero() || now.Sub(p.alertedAt) >= pt.interval
+	if alert {
+		p.alertedAt = now
+	}
+	return p.count, alert
+}
+
+// panicTrackerSnapshot is the JSON representation of the panic counts.
+type panicTrackerSnapshot struct {
+	Total         int64            `json:"total"`
+	ByFingerprint map[string]int64 `json:"by_fingerprint"`
+}
+
+// snapshot returns the number of panics, in total and per fingerprint, for publishing with expvar.
+func (pt *panicTracker) snapshot() any {
+	pt.mtx.Lock()
+	defer pt.mtx.Unlock()
+
+	s := panicTrackerSnapshot{
+		Total:         pt.total,
+		ByFingerprint: make(map[string]int64, len(pt.panics)),
+	}
+	for fingerprint, p := range pt.panics {
+		s.ByFingerprint[fingerprint] = p.count
+	}
+	return s
+}
+
+// panicFingerprint identifies a panic by the type of its value and the functions and lines it was
+// raised from, which unlike the value's message (e.g. "index out of range [5] with length 3") stay
+// the same across occurrences. pcs holds the program counters of the panicking goroutine, starting
+// within the deferred function that recovered it.
+func panicFingerprint(value any, pcs []uintptr) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%T\n", value)
+
+	frames := runtime.CallersFrames(pcs)
+	n := 0
+	panicking := false
+	for n < panicFingerprintFrames {
+		frame, more := frames.Next()
+		switch {
+		case frame.Function == "runtime.gopanic":
+			// The frames above runtime.gopanic() are the ones that recovered the panic.
+			panicking = true
+		case panicking && !strings.HasPrefix(frame.Function, "runtime."):
+			fmt.Fprintf(&b, "%s:%d\n", frame.Function, frame.Line)
+			n++
+		}
+		if !more {
+			break
+		}
+	}
+
+	sum := sha256.Sum256([]byte(b.String()))
+	return hex.EncodeToString(sum[:8])
+}
+
+// reportPanic fingerprints and logs a recovered panic, counts it, and calls the panic hooks if
+// they're due to be alerted. stack is the panicking goroutine's stack trace.
+func (app *application) reportPanic(r *http.Request, value any, pcs []uintptr, stack []byte) {
+	report := panicReport{
+		Fingerprint: panicFingerprint(value, pcs),
+		Value:       fmt.Sprint(value),
+		Time:        time.Now().UTC(),
+		Method:      r.Method,
+		URL:         r.URL.String(),
+		Route:       unmatchedRoute,
+		UserID:      app.contextGetUserID(r),
+		Stack:       string(stack),
+	}
+	if info, ok := routeContextKey.Get(r.Context()); ok {
+		report.Route = info.label
+	}
+
+	var alert bool
+	report.Count, alert = app.panics.observe(report.Fingerprint, report.Time)
+
+	properties := map[string]string{
+		"request_method": report.Method,
+		"request_url":    report.URL,
+		"route":          report.Route,
+		"fingerprint":    report.Fingerprint,
+		"panic_count":    strconv.FormatInt(report.Count, 10),
+	}
+	if id := reqctx.RequestID(r.Context()); id != "" {
+		properties["request_id"] = id
+	}
+	if report.UserID != 0 {
+		properties["user_id"] = strconv.FormatInt(report.UserID, 10)
+	}
+	app.logger.PrintError(fmt.Errorf("panic: %s", report.Value), properties)
+
+	if !alert || len(app.panicHooks) == 0 {
+		return
+	}
+
+	app.background(func() {
+		for _, hook := range app.panicHooks {
+			hook(report)
+		}
+	})
+}
+
+// contextGetUserID returns the ID of the authenticated user, or 0 if the request is anonymous or
+// hasn't been authenticated yet (e.g. it panicked in an earlier middleware).
+func (app *application) contextGetUserID(r *http.Request) int64 {
+	user, ok := reqctx.User(r.Context())
+	if !ok || user.IsAnonymous() {
+		return 0
+	}
+	return user.ID
+}
+
+// panicWebhook returns a panic hook which posts the reports as JSON to the URL, e.g. an incoming
+// webhook of the on-call tooling. Failures are logged along with the panic's fingerprint.
+func (app *application) panicWebhook(url string) panicHook {
+	client := &http.Client{Timeout: 5 * time.Second}
+
+	return func(report panicReport) {
+		js, err := json.Marshal(report)
+		if err != nil {
+			app.logger.PrintError(err, map[string]string{"fingerprint": report.Fingerprint})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(js))
+		if err != nil {
+			app.logger.PrintError(err, map[string]string{"fingerprint": report.Fingerprint})
+			return
+		}
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, err := client.Do(req)
+		if err != nil {
+			app.logger.PrintError(err, map[string]string{"fingerprint": report.Fingerprint})
+			return
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode >= 300 {
+			app.logger.PrintError(
+				fmt.Errorf("panic webhook: unexpected status %d", resp.StatusCode),
+				map[string]string{"fingerprint": report.Fingerprint},
+			)
+		}
+	}
+}
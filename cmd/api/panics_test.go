@@ -0,0 +1,67 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/walkccc/greenlight/internal/jsonlog"
+)
+
+func TestRecoverPanic(t *testing.T) {
+	app := &application{
+		logger: jsonlog.New(io.Discard, jsonlog.LevelOff),
+		panics: newPanicTracker(time.Hour),
+	}
+
+	var mtx sync.Mutex
+	var reports []panicReport
+	app.onPanic(func(report panicReport) {
+		mtx.Lock()
+		defer mtx.Unlock()
+		reports = append(reports, report)
+	})
+
+	handler := app.recoverPanic(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var genres []string
+		if r.URL.Query().Has("other") {
+			panic("something else")
+		}
+		w.Write([]byte(genres[len(r.URL.Path)]))
+	}))
+
+	var fingerprints []string
+	for _, url := range []string{"/v1/movies/1", "/v1/movies/12", "/v1/movies?other"} {
+		rr := httptest.NewRecorder()
+		r, _ := contextSetRouteInfo(httptest.NewRequest(http.MethodGet, url, nil))
+		handler.ServeHTTP(rr, r)
+
+		assert.Equal(t, http.StatusInternalServerError, rr.Code)
+		assert.Equal(t, "close", rr.Header().Get("Connection"))
+	}
+	app.wg.Wait()
+
+	snapshot := app.panics.snapshot().(panicTrackerSnapshot)
+	assert.EqualValues(t, 3, snapshot.Total)
+	for fingerprint := range snapshot.ByFingerprint {
+		fingerprints = append(fingerprints, fingerprint)
+	}
+	assert.Len(t, fingerprints, 2)
+
+	// The index out of range panics share a fingerprint despite their messages, so only the first
+	// one is alerted. The hooks run in the background, so the reports can arrive in any order.
+	sort.Slice(reports, func(i, j int) bool { return reports[i].Value < reports[j].Value })
+	assert.Len(t, reports, 2)
+	assert.Equal(t, "/v1/movies/1", reports[0].URL)
+	assert.Contains(t, reports[0].Value, "index out of range [12]")
+	assert.Equal(t, unmatchedRoute, reports[0].Route)
+	assert.EqualValues(t, 1, reports[0].Count)
+	assert.Contains(t, reports[0].Stack, "TestRecoverPanic")
+	assert.Equal(t, "something else", reports[1].Value)
+	assert.EqualValues(t, 2, snapshot.ByFingerprint[reports[0].Fingerprint])
+}
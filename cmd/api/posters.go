@@ -0,0 +1,319 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/walkccc/greenlight/internal/data"
+	"github.com/walkccc/greenlight/internal/dto"
+	"github.com/walkccc/greenlight/internal/images"
+	"github.com/walkccc/greenlight/internal/validator"
+)
+
+// maxPosterBytes is the size limit of an uploaded poster.
+const maxPosterBytes = 10 << 20
+
+// posterSizes are the variants that the posters are resized to, by their largest width, next to
+// the original.
+var posterSizes = []struct {
+	name  string
+	width int
+}{
+	{"thumb", 160},
+	{"medium", 640},
+}
+
+// posterEncoder encodes the resized variants.
+var posterEncoder = images.WebP
+
+// posterJob is an uploaded poster whose variants are to be produced. The files of the poster it
+// replaced, if any, are deleted.
+type posterJob struct {
+	poster   data.Poster
+	previous *data.Poster
+}
+
+// startPosterPool starts the workers producing the variants of the uploaded posters.
+func (app *application) startPosterPool(workers, queueSize int) *workerPool[posterJob] {
+	return startWorkerPool(app, "poster pool", workers, queueSize, app.processPoster)
+}
+
+// processPoster produces the variants of the poster, stores them next to the original, and
+// records them. The poster is marked as failed if they can't be produced, in which case only the
+// original is available.
+func (app *application) processPoster(job posterJob) {
+	ctx := context.Background()
+	poster := job.poster
+	properties := map[string]string{"movie_id": strconv.FormatInt(poster.MovieID, 10)}
+
+	if job.previous != nil {
+		app.deletePosterFiles(ctx, job.previous)
+	}
+
+	variants, err := app.resizePoster(ctx, &poster)
+	if err != nil {
+		app.logger.PrintError(err, properties)
+		poster.Status = data.PosterFailed
+	} else {
+		poster.Status = data.PosterReady
+		poster.Variants = append(poster.Variants, variants...)
+	}
+
+	err = app.models.Posters.Update(ctx, &poster)
+	switch {
+	case errors.Is(err, data.ErrRecordNotFound):
+		// The poster has been replaced in the meantime, or the movie deleted.
+		app.deletePosterFiles(ctx, &poster)
+	case err != nil:
+		app.logger.PrintError(err, properties)
+	}
+}
+
+// resizePoster produces and stores the variants of the poster's original.
+func (app *application) resizePoster(
+	ctx context.Context,
+	poster *data.Poster,
+) ([]data.PosterVariant, error) {
+	body, err := app.storage.Get(ctx, poster.Key)
+	if err != nil {
+		return nil, err
+	}
+	content, err := io.ReadAll(body)
+	body.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	img, err := images.Decode(content)
+	if err != nil {
+		return nil, err
+	}
+
+	variants := make([]data.PosterVariant, 0, len(posterSizes))
+	for _, size := range posterSizes {
+		resized := images.Fit(img, size.width)
+
+		var buf bytes.Buffer
+		err := posterEncoder.Encode(&buf, resized)
+		if err != nil {
+			return nil, err
+		}
+
+		key := poster.VariantKey(size.name)
+		err = app.storage.Put(ctx, key, &buf, posterEncoder.ContentType)
+		if err != nil {
+			return nil, err
+		}
+
+		variants = append(variants, data.PosterVariant{
+			Name:        size.name,
+			Width:       resized.Bounds().Dx(),
+			Height:      resized.Bounds().Dy(),
+			ContentType: posterEncoder.ContentType,
+		})
+	}
+
+	return variants, nil
+}
+
+// deletePosterFiles deletes the original and the variants of a poster from the storage, logging
+// the failures.
+func (app *application) deletePosterFiles(ctx context.Context, poster *data.Poster) {
+	names := []string{data.PosterOriginal}
+	for _, size := range posterSizes {
+		names = append(names, size.name)
+	}
+
+	for _, name := range names {
+		err := app.storage.Delete(ctx, poster.VariantKey(name))
+		if err != nil {
+			app.logger.PrintError(err, map[string]string{"key": poster.VariantKey(name)})
+		}
+	}
+}
+
+// moviePoster returns the poster of the organization's movie, or nil if it has none or no
+// storage is configured.
+func (app *application) moviePoster(
+	ctx context.Context,
+	organizationID, movieID int64,
+) (*data.Poster, error) {
+	if app.storage == nil {
+		return nil, nil
+	}
+
+	poster, err := app.models.Posters.Get(ctx, organizationID, movieID)
+	if errors.Is(err, data.ErrRecordNotFound) {
+		return nil, nil
+	}
+	return poster, err
+}
+
+// putMoviePosterHandler handles requests for "PUT /v1/movies/:id/poster". The body is the image,
+// a JPEG or a PNG, whose original is stored straight away; its variants are produced in the
+// background, and the poster's status tells once they're ready. It's a 404 if no storage is
+// configured, and a 503 if the queue of the posters to process is full.
+func (app *application) putMoviePosterHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil || app.storage == nil || app.posters == nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	organizationID := app.contextGetUser(r).OrganizationID
+
+	_, err = app.models.Movies.Get(r.Context(), organizationID, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	content, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxPosterBytes))
+	if err != nil {
+		var maxBytesError *http.MaxBytesError
+		if errors.As(err, &maxBytesError) {
+			message := fmt.Sprintf("body must not be larger than %d bytes", maxBytesError.Limit)
+			app.errorResponse(w, r, http.StatusRequestEntityTooLarge, message)
+			return
+		}
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	info, err := images.Inspect(content)
+	if err != nil {
+		v := validator.New()
+		switch {
+		case errors.Is(err, images.ErrTooLarge):
+			message := fmt.Sprintf("must have %d pixels at most", images.MaxPixels)
+			v.AddError("poster", validator.CodeTooLarge, message)
+		default:
+			v.AddError("poster", validator.CodeInvalid, "must be a JPEG or a PNG image")
+		}
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	previous, err := app.moviePoster(r.Context(), organizationID, id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// Each upload is stored under a prefix of its own, so that the variants being produced for
+	// the previous one don't overwrite it.
+	key := fmt.Sprintf(
+		"posters/%d/%d/%s/%s",
+		organizationID,
+		id,
+		newRequestID(),
+		data.PosterOriginal,
+	)
+
+	err = app.storage.Put(r.Context(), key, bytes.NewReader(content), info.ContentType)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	poster := &data.Poster{
+		MovieID:        id,
+		OrganizationID: organizationID,
+		Key:            key,
+		ContentType:    info.ContentType,
+		Status:         data.PosterProcessing,
+		Variants: data.PosterVariants{{
+			Name:        data.PosterOriginal,
+			Width:       info.Width,
+			Height:      info.Height,
+			ContentType: info.ContentType,
+		}},
+	}
+
+	err = app.models.Posters.Put(r.Context(), poster)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if !app.posters.enqueue(posterJob{poster: *poster, previous: previous}) {
+		// The original is kept, and the variants are produced if it's uploaded again. The
+		// previous poster has been replaced all the same, so its files go.
+		if previous != nil {
+			app.deletePosterFiles(r.Context(), previous)
+		}
+		poster.Status = data.PosterFailed
+		err = app.models.Posters.Update(r.Context(), poster)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		app.serviceUnavailableResponse(w, r)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusAccepted, envelope{"poster": poster}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// getMoviePosterHandler handles requests for "GET /v1/movies/:id/poster", for the variant named
+// by ?variant (the original by default). Rather than proxying the poster through the API, it
+// redirects to a signed URL of the storage, which is valid for -storage-url-ttl. The redirect may
+// be cached for half of that, so that a cached redirect never points to an expired URL. It's a
+// 404 if the movie has no poster, or the variant isn't ready, or no storage is configured.
+func (app *application) getMoviePosterHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil || app.storage == nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	input := dto.MoviePosterQuery{Variant: data.PosterOriginal}
+
+	v := validator.New()
+
+	app.readQuery(r.URL.Query(), &input, v)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	poster, err := app.models.Posters.Get(r.Context(), app.contextGetUser(r).OrganizationID, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// The original is always there, even if the poster predates the variants.
+	if _, ok := poster.Variant(input.Variant); !ok && input.Variant != data.PosterOriginal {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	ttl := app.config.storage.urlTTL
+	url, err := app.storage.SignedURL(r.Context(), poster.VariantKey(input.Variant), ttl)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	w.Header().Set("Cache-Control", fmt.Sprintf("private, max-age=%d", int(ttl.Seconds()/2)))
+	http.Redirect(w, r, url, http.StatusFound)
+}
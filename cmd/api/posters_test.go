@@ -0,0 +1,220 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/png"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/walkccc/greenlight/internal/data"
+	"github.com/walkccc/greenlight/internal/jsonlog"
+	"github.com/walkccc/greenlight/internal/storage"
+)
+
+// stubPosterModel returns the posters it holds by movie ID, in every organization.
+type stubPosterModel map[int64]*data.Poster
+
+func (m stubPosterModel) Get(
+	ctx context.Context,
+	organizationID, movieID int64,
+) (*data.Poster, error) {
+	poster, ok := m[movieID]
+	if !ok {
+		return nil, data.ErrRecordNotFound
+	}
+	return poster, nil
+}
+
+func (m stubPosterModel) Put(ctx context.Context, poster *data.Poster) error {
+	stored := *poster
+	m[poster.MovieID] = &stored
+	return nil
+}
+
+func (m stubPosterModel) Update(ctx context.Context, poster *data.Poster) error {
+	stored, ok := m[poster.MovieID]
+	if !ok || stored.Key != poster.Key {
+		return data.ErrRecordNotFound
+	}
+	stored.Status = poster.Status
+	stored.Variants = poster.Variants
+	return nil
+}
+
+// posterPNG returns a PNG of the size.
+func posterPNG(t *testing.T, width, height int) []byte {
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, width, height))))
+	return buf.Bytes()
+}
+
+func TestPutMoviePosterHandler(t *testing.T) {
+	local, err := storage.NewLocal(t.TempDir(), "https://api.example.com/assets", "secret")
+	require.NoError(t, err)
+
+	posters := stubPosterModel{}
+	app := &application{
+		logger: jsonlog.New(io.Discard, jsonlog.LevelOff),
+		models: data.Models{
+			Movies:  stubMovieModel{movies: []*data.Movie{{ID: 1, OrganizationID: 7}}},
+			Posters: posters,
+		},
+		storage: local,
+		posters: &workerPool[posterJob]{jobs: make(chan posterJob, 1)},
+	}
+
+	request := func(id string, body []byte) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPut, "/v1/movies/"+id+"/poster", bytes.NewReader(body))
+		r = app.contextSetUser(r, &data.User{ID: 1, OrganizationID: 7})
+		params := httprouter.Params{{Key: "id", Value: id}}
+		r = r.WithContext(context.WithValue(r.Context(), httprouter.ParamsKey, params))
+
+		rr := httptest.NewRecorder()
+		app.putMoviePosterHandler(rr, r)
+		return rr
+	}
+
+	rr := request("1", posterPNG(t, 800, 1200))
+	require.Equal(t, http.StatusAccepted, rr.Code, rr.Body.String())
+	assert.Contains(t, rr.Body.String(), `"status":"processing"`)
+
+	job := <-app.posters.jobs
+	assert.Nil(t, job.previous)
+	assert.Equal(t, "image/png", job.poster.ContentType)
+	assert.True(t, strings.HasPrefix(job.poster.Key, "posters/7/1/"), job.poster.Key)
+	assert.Equal(t, posters[1].Key, job.poster.Key)
+
+	body, err := local.Get(context.Background(), job.poster.Key)
+	require.NoError(t, err)
+	body.Close()
+
+	// Another upload replaces the poster, and its job deletes the previous one's files.
+	rr = request("1", posterPNG(t, 100, 100))
+	require.Equal(t, http.StatusAccepted, rr.Code, rr.Body.String())
+	replaced := <-app.posters.jobs
+	require.NotNil(t, replaced.previous)
+	assert.Equal(t, job.poster.Key, replaced.previous.Key)
+
+	// The queue is full. The poster is still replaced, along with the previous one's files.
+	app.posters.jobs <- replaced
+	rr = request("1", posterPNG(t, 100, 100))
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+	assert.Equal(t, data.PosterFailed, posters[1].Status)
+	assert.NotEqual(t, replaced.poster.Key, posters[1].Key)
+	_, err = local.Get(context.Background(), replaced.poster.Key)
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+	<-app.posters.jobs
+
+	rr = request("1", []byte("GIF89a"))
+	assert.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+	assert.Contains(t, rr.Body.String(), "must be a JPEG or a PNG image")
+
+	assert.Equal(t, http.StatusNotFound, request("2", posterPNG(t, 10, 10)).Code)
+
+	app.storage = nil
+	assert.Equal(t, http.StatusNotFound, request("1", posterPNG(t, 10, 10)).Code)
+}
+
+func TestProcessPoster(t *testing.T) {
+	local, err := storage.NewLocal(t.TempDir(), "https://api.example.com/assets", "secret")
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	previous := &data.Poster{MovieID: 1, Key: "posters/7/1/a/original"}
+	require.NoError(t, local.Put(ctx, previous.Key, strings.NewReader("old"), "image/png"))
+
+	poster := data.Poster{
+		MovieID: 1,
+		Key:     "posters/7/1/b/original",
+		Status:  data.PosterProcessing,
+		Variants: data.PosterVariants{
+			{Name: data.PosterOriginal, Width: 800, Height: 1200, ContentType: "image/png"},
+		},
+	}
+	content := posterPNG(t, 800, 1200)
+	require.NoError(t, local.Put(ctx, poster.Key, bytes.NewReader(content), "image/png"))
+
+	posters := stubPosterModel{}
+	require.NoError(t, posters.Put(ctx, &poster))
+
+	app := &application{
+		logger:  jsonlog.New(io.Discard, jsonlog.LevelOff),
+		models:  data.Models{Posters: posters},
+		storage: local,
+	}
+	app.processPoster(posterJob{poster: poster, previous: previous})
+
+	assert.Equal(t, data.PosterReady, posters[1].Status)
+	thumb, ok := posters[1].Variant("thumb")
+	require.True(t, ok)
+	assert.Equal(t, data.PosterVariant{
+		Name:        "thumb",
+		Width:       160,
+		Height:      240,
+		ContentType: "image/webp",
+	}, thumb)
+	medium, ok := posters[1].Variant("medium")
+	require.True(t, ok)
+	assert.Equal(t, 640, medium.Width)
+
+	body, err := local.Get(ctx, "posters/7/1/b/thumb")
+	require.NoError(t, err)
+	body.Close()
+
+	_, err = local.Get(ctx, previous.Key)
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+
+	// An original that isn't an image fails the poster, which keeps the original only.
+	broken := poster
+	broken.Key = "posters/7/1/c/original"
+	broken.Variants = broken.Variants[:1]
+	require.NoError(t, local.Put(ctx, broken.Key, strings.NewReader("GIF89a"), "image/gif"))
+	require.NoError(t, posters.Put(ctx, &broken))
+	app.processPoster(posterJob{poster: broken})
+	assert.Equal(t, data.PosterFailed, posters[1].Status)
+	assert.Len(t, posters[1].Variants, 1)
+}
+
+func TestGetMoviePosterHandler(t *testing.T) {
+	local, err := storage.NewLocal(t.TempDir(), "https://api.example.com/assets", "secret")
+	require.NoError(t, err)
+
+	app := &application{
+		models:  data.Models{Posters: stubPosterModel{1: {MovieID: 1, Key: "posters/1/original"}}},
+		storage: local,
+	}
+	app.config.storage.urlTTL = 10 * time.Minute
+
+	request := func(id string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/v1/movies/"+id+"/poster", nil)
+		r = app.contextSetUser(r, &data.User{ID: 1, OrganizationID: 7})
+		params := httprouter.Params{{Key: "id", Value: id}}
+		r = r.WithContext(context.WithValue(r.Context(), httprouter.ParamsKey, params))
+
+		rr := httptest.NewRecorder()
+		app.getMoviePosterHandler(rr, r)
+		return rr
+	}
+
+	rr := request("1")
+	assert.Equal(t, http.StatusFound, rr.Code)
+	location := rr.Header().Get("Location")
+	prefix := "https://api.example.com/assets/posters/1/original?expires="
+	assert.True(t, strings.HasPrefix(location, prefix), location)
+	assert.Contains(t, location, "&signature=")
+	assert.Equal(t, "private, max-age=300", rr.Header().Get("Cache-Control"))
+
+	assert.Equal(t, http.StatusNotFound, request("2").Code)
+
+	app.storage = nil
+	assert.Equal(t, http.StatusNotFound, request("1").Code)
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/walkccc/greenlight/internal/data"
+)
+
+// movieETag returns the entity tag of the movie, which changes with its version.
+func movieETag(movie *data.Movie) string {
+	return strconv.Quote(strconv.FormatInt(int64(movie.Version), 10))
+}
+
+// ifMatch holds the entity tags listed in a request's If-Match header, or "*".
+type ifMatch []string
+
+// readIfMatch returns the entity tags of the request's If-Match header, or nil if it has none.
+func readIfMatch(r *http.Request) ifMatch {
+	var tags ifMatch
+	for _, header := range r.Header.Values("If-Match") {
+		for _, tag := range strings.Split(header, ",") {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				tags = append(tags, tag)
+			}
+		}
+	}
+	return tags
+}
+
+// matches reports whether the movie's current version satisfies the condition. Besides the ETags
+// sent with the movies, e.g. "3", bare versions are accepted for convenience. Weak tags (W/"3")
+// never match, since If-Match requires a strong comparison.
+func (tags ifMatch) matches(movie *data.Movie) bool {
+	etag := movieETag(movie)
+	version := strconv.FormatInt(int64(movie.Version), 10)
+
+	for _, tag := range tags {
+		if tag == "*" || tag == etag || tag == version {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/walkccc/greenlight/internal/data"
+)
+
+func TestIfMatch(t *testing.T) {
+	movie := &data.Movie{Version: 3}
+
+	tests := []struct {
+		name    string
+		headers []string
+		want    bool
+	}{
+		{name: "ETag", headers: []string{`"3"`}, want: true},
+		{name: "Version", headers: []string{"3"}, want: true},
+		{name: "Any", headers: []string{"*"}, want: true},
+		{name: "List", headers: []string{`"1", "3"`}, want: true},
+		{name: "SeveralHeaders", headers: []string{`"1"`, `"3"`}, want: true},
+		{name: "OtherVersion", headers: []string{`"2"`}, want: false},
+		{name: "Weak", headers: []string{`W/"3"`}, want: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodDelete, "/v1/movies/1", nil)
+			for _, header := range test.headers {
+				r.Header.Add("If-Match", header)
+			}
+
+			tags := readIfMatch(r)
+			assert.NotNil(t, tags)
+			assert.Equal(t, test.want, tags.matches(movie))
+		})
+	}
+
+	r := httptest.NewRequest(http.MethodDelete, "/v1/movies/1", nil)
+	assert.Nil(t, readIfMatch(r))
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/walkccc/greenlight/internal/validator"
+)
+
+// indentsJSON reports whether the JSON responses are indented by default, which they only are in
+// the development environment: indenting costs measurable CPU on large listings.
+func (app *application) indentsJSON() bool {
+	return app.config.env == "development"
+}
+
+// pretty lets clients override whether the JSON responses are indented, with ?pretty=true (e.g.
+// when reading them with curl) or ?pretty=false. Like timestamps, it buffers the response and
+// reformats its body on the way out, so it only costs anything when the client asks for the
+// format that isn't the default.
+func (app *application) pretty(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		param := r.URL.Query().Get("pretty")
+		if param == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		indent, err := strconv.ParseBool(param)
+		if err != nil {
+			v := validator.New()
+			v.AddError("pretty", validator.CodeInvalid, "must be true or false")
+			app.failedValidationResponse(w, r, v)
+			return
+		}
+		if indent == app.indentsJSON() {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// The buffering writer of the timestamps middleware does what's needed here too.
+		pw := &timestampsResponseWriter{ResponseWriter: w}
+		next.ServeHTTP(pw, r)
+
+		body := pw.buf.Bytes()
+		mediaType, _, _ := mime.ParseMediaType(w.Header().Get("Content-Type"))
+		if mediaType == "application/json" || strings.HasSuffix(mediaType, "+json") {
+			var buf bytes.Buffer
+			if indent {
+				err = json.Indent(&buf, body, "", "\t")
+			} else {
+				err = json.Compact(&buf, body)
+			}
+			if err == nil {
+				// Either way, the body ends with a newline, as Encode() terminates the JSON.
+				body = append(bytes.TrimRight(buf.Bytes(), "\n"), '\n')
+				w.Header().Del("Content-Length")
+			}
+		}
+
+		if pw.statusCode != 0 {
+			w.WriteHeader(pw.statusCode)
+		}
+		w.Write(body)
+	})
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPretty(t *testing.T) {
+	tests := []struct {
+		env        string
+		query      string
+		statusCode int
+		body       string
+	}{
+		{env: "production", query: "", statusCode: http.StatusOK, body: "{\"movies\":[1,2]}\n"},
+		{
+			env:        "production",
+			query:      "?pretty=true",
+			statusCode: http.StatusOK,
+			body:       "{\n\t\"movies\": [\n\t\t1,\n\t\t2\n\t]\n}\n",
+		},
+		{
+			env:        "development",
+			query:      "",
+			statusCode: http.StatusOK,
+			body:       "{\n\t\"movies\": [\n\t\t1,\n\t\t2\n\t]\n}\n",
+		},
+		{
+			env:        "development",
+			query:      "?pretty=false",
+			statusCode: http.StatusOK,
+			body:       "{\"movies\":[1,2]}\n",
+		},
+		{
+			env:        "production",
+			query:      "?pretty=yes",
+			statusCode: http.StatusUnprocessableEntity,
+			body: `{"error":{"pretty":"must be true or false"},` +
+				`"error_codes":{"pretty":"pretty.invalid"}}` + "\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.env+test.query, func(t *testing.T) {
+			app := &application{config: config{env: test.env}}
+			handler := app.pretty(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				app.writeJSON(w, http.StatusOK, envelope{"movies": []int{1, 2}}, nil)
+			}))
+
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/"+test.query, nil))
+
+			assert.Equal(t, test.statusCode, rr.Code)
+			assert.Equal(t, test.body, rr.Body.String())
+		})
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+)
+
+// defaultProbePaths are the paths of the liveness and readiness probes.
+var defaultProbePaths = []string{"/v1/healthcheck", "/v2/healthcheck", "/v1/readyz", "/v2/readyz"}
+
+// probeExemption recognizes the requests of the health probes, which are exempt from the rate
+// limiter and aren't captured, so that a probe polling every second neither gets rate limited nor
+// crowds the clients out of the limiter's store or the captures.
+//
+// A request is a probe if it's for one of the probe paths and, if any source networks are
+// configured, its connection comes from one of them (e.g. the nodes' network, which the kubelet
+// probes from). The connection's address is used rather than the X-Forwarded-For or X-Real-IP
+// headers, since those could be forged to pass a client off as a probe.
+//
+// A nil *probeExemption exempts nothing.
+type probeExemption struct {
+	paths    map[string]bool
+	networks []*net.IPNet
+}
+
+// newProbeExemption returns the exemption of the probe paths from the networks, given in CIDR
+// notation. It returns nil if there are no paths.
+func newProbeExemption(paths, cidrs []string) (*probeExemption, error) {
+	if len(paths) == 0 {
+		return nil, nil
+	}
+
+	p := &probeExemption{paths: make(map[string]bool, len(paths))}
+	for _, path := range paths {
+		p.paths[path] = true
+	}
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid probe network %q: %w", cidr, err)
+		}
+		p.networks = append(p.networks, network)
+	}
+
+	return p, nil
+}
+
+// exempt returns true if the request is a probe's.
+func (p *probeExemption) exempt(r *http.Request) bool {
+	if p == nil || !p.paths[r.URL.Path] {
+		return false
+	}
+	if len(p.networks) == 0 {
+		return true
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, network := range p.networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
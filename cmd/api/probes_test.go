@@ -0,0 +1,44 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProbeExemption(t *testing.T) {
+	probe := func(p *probeExemption, remoteAddr, path string, header http.Header) bool {
+		r := httptest.NewRequest(http.MethodGet, path, nil)
+		r.RemoteAddr = remoteAddr
+		for name, values := range header {
+			r.Header[name] = values
+		}
+		return p.exempt(r)
+	}
+
+	anywhere, err := newProbeExemption(defaultProbePaths, nil)
+	require.NoError(t, err)
+	assert.True(t, probe(anywhere, "203.0.113.7:1234", "/v1/readyz", nil))
+	assert.False(t, probe(anywhere, "203.0.113.7:1234", "/v1/movies", nil))
+
+	nodes, err := newProbeExemption(defaultProbePaths, []string{"10.0.0.0/8", "fd00::/8"})
+	require.NoError(t, err)
+	assert.True(t, probe(nodes, "10.1.2.3:1234", "/v1/healthcheck", nil))
+	assert.True(t, probe(nodes, "[fd00::1]:1234", "/v2/readyz", nil))
+	assert.False(t, probe(nodes, "203.0.113.7:1234", "/v1/healthcheck", nil))
+	assert.False(t, probe(nodes, "10.1.2.3:1234", "/v1/movies", nil))
+
+	// The forwarding headers can't pass a client off as a probe.
+	forged := http.Header{"X-Forwarded-For": {"10.1.2.3"}, "X-Real-Ip": {"10.1.2.3"}}
+	assert.False(t, probe(nodes, "203.0.113.7:1234", "/v1/healthcheck", forged))
+
+	none, err := newProbeExemption(nil, []string{"10.0.0.0/8"})
+	require.NoError(t, err)
+	assert.False(t, probe(none, "10.1.2.3:1234", "/v1/healthcheck", nil))
+
+	_, err = newProbeExemption(defaultProbePaths, []string{"10.0.0.0"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/walkccc/greenlight/internal/validator"
+)
+
+// timeRange is a query parameter holding a range of times, given as "start..end" where either end
+// may be omitted for an open range, e.g. "2024-01-01..2024-06-30" or "2024-01-01T09:00:00Z..". The
+// times use the same formats as parseScheduleDate().
+type timeRange struct {
+	Start time.Time
+	End   time.Time
+}
+
+var (
+	timeType      = reflect.TypeOf(time.Time{})
+	durationType  = reflect.TypeOf(time.Duration(0))
+	timeRangeType = reflect.TypeOf(timeRange{})
+)
+
+// readQuery binds the query string to the fields of the struct pointed to by dst, using the names
+// in their `query` tags. Fields without a tag are left alone, as are fields whose parameter is
+// missing or empty, so dst should hold the defaults beforehand. Strings, integers, floats,
+// booleans, durations, times and timeRanges are supported, as are string slices, which are read as
+// comma separated values. Values that can't be parsed are recorded in the provided Validator instance
+// (and the field keeps its default), after which the struct's `validate` tags are checked too,
+// e.g. `validate:"oneof=asc desc"` for enums.
+func (app *application) readQuery(qs url.Values, dst any, v *validator.Validator) {
+	rv := reflect.ValueOf(dst)
+	if rv.Kind() != reflect.Pointer || rv.Elem().Kind() != reflect.Struct {
+		panic(fmt.Sprintf("readQuery: dst must be a pointer to a struct, not a %T", dst))
+	}
+	rv = rv.Elem()
+
+	for i := 0; i < rv.NumField(); i++ {
+		key, ok := rv.Type().Field(i).Tag.Lookup("query")
+		if !ok || qs.Get(key) == "" {
+			continue
+		}
+
+		if code, message := setQueryField(rv.Field(i), qs[key]); message != "" {
+			v.AddError(key, code, message)
+		}
+	}
+
+	v.Struct(dst)
+}
+
+// setQueryField parses the values of a query parameter into the field, returning the error code
+// and message if they can't be parsed.
+func setQueryField(field reflect.Value, values []string) (string, string) {
+	s := values[0]
+
+	switch field.Type() {
+	case durationType:
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return validator.CodeInvalid, "must be a duration, e.g. 90s or 1h30m"
+		}
+		field.SetInt(int64(d))
+		return "", ""
+	case timeType:
+		t, err := parseScheduleDate(s)
+		if err != nil {
+			return validator.CodeInvalid, "must be a date (YYYY-MM-DD) or an RFC 3339 timestamp"
+		}
+		field.Set(reflect.ValueOf(t))
+		return "", ""
+	case timeRangeType:
+		tr, ok := parseTimeRange(s)
+		if !ok {
+			return validator.CodeInvalid, "must be a range of dates or RFC 3339 timestamps, e.g. " +
+				"2024-01-01..2024-06-30"
+		}
+		if !tr.Start.IsZero() && !tr.End.IsZero() && tr.End.Before(tr.Start) {
+			return validator.CodeInvalid, "must not end before it starts"
+		}
+		field.Set(reflect.ValueOf(tr))
+		return "", ""
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(s)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(s, 10, field.Type().Bits())
+		if err != nil {
+			return validator.CodeInvalid, "must be an integer value"
+		}
+		field.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := strconv.ParseUint(s, 10, field.Type().Bits())
+		if err != nil {
+			return validator.CodeInvalid, "must be a positive integer value"
+		}
+		field.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(s, field.Type().Bits())
+		if err != nil {
+			return validator.CodeInvalid, "must be a number"
+		}
+		field.SetFloat(f)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return validator.CodeInvalid, "must be true or false"
+		}
+		field.SetBool(b)
+	case reflect.Slice:
+		if field.Type().Elem().Kind() != reflect.String {
+			panic("readQuery: unsupported slice type " + field.Type().String())
+		}
+
+		// Accept both "genres=drama,crime" and "genres=drama&genres=crime".
+		var items []string
+		for _, value := range values {
+			if value != "" {
+				items = append(items, strings.Split(value, ",")...)
+			}
+		}
+		slice := reflect.MakeSlice(field.Type(), len(items), len(items))
+		for i, item := range items {
+			slice.Index(i).SetString(item)
+		}
+		field.Set(slice)
+	default:
+		panic("readQuery: unsupported field type " + field.Type().String())
+	}
+
+	return "", ""
+}
+
+// parseTimeRange parses a "start..end" time range.
+func parseTimeRange(s string) (timeRange, bool) {
+	start, end, found := strings.Cut(s, "..")
+	if !found || (start == "" && end == "") {
+		return timeRange{}, false
+	}
+
+	var tr timeRange
+	var err error
+
+	if start != "" {
+		if tr.Start, err = parseScheduleDate(start); err != nil {
+			return timeRange{}, false
+		}
+	}
+	if end != "" {
+		if tr.End, err = parseScheduleDate(end); err != nil {
+			return timeRange{}, false
+		}
+	}
+
+	return tr, true
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/walkccc/greenlight/internal/validator"
+)
+
+func TestReadQuery(t *testing.T) {
+	type query struct {
+		Title    string        `query:"title"`
+		Genres   []string      `query:"genres"`
+		Page     int           `query:"page"`
+		Watched  bool          `query:"watched"`
+		MaxAge   time.Duration `query:"max_age"`
+		Released timeRange     `query:"released"`
+		Order    string        `query:"order" validate:"oneof=asc desc"`
+		PageSize int           `query:"page_size" validate:"gt=0"`
+	}
+
+	app := &application{}
+
+	input := query{Page: 1, Order: "asc", PageSize: 20}
+	v := validator.New()
+	qs, _ := url.ParseQuery(
+		"title=alien&genres=horror,sci-fi&genres=action&watched=true&max_age=1h30m" +
+			"&released=1979-01-01..1986-12-31&order=desc&page=",
+	)
+	app.readQuery(qs, &input, v)
+
+	assert.True(t, v.Valid())
+	assert.Equal(t, query{
+		Title:   "alien",
+		Genres:  []string{"horror", "sci-fi", "action"},
+		Page:    1,
+		Watched: true,
+		MaxAge:  90 * time.Minute,
+		Released: timeRange{
+			Start: time.Date(1979, 1, 1, 0, 0, 0, 0, time.UTC),
+			End:   time.Date(1986, 12, 31, 0, 0, 0, 0, time.UTC),
+		},
+		Order:    "desc",
+		PageSize: 20,
+	}, input)
+
+	// The errors of the validate tags are keyed by the query parameters.
+	input = query{Page: 1, Order: "asc", PageSize: 20}
+	v = validator.New()
+	qs, _ = url.ParseQuery(
+		"page=two&watched=maybe&released=2000-01-01..1999-01-01&order=up&page_size=0",
+	)
+	app.readQuery(qs, &input, v)
+
+	assert.Equal(t, 1, input.Page)
+	assert.Equal(t, map[string]string{
+		"page":      "page.invalid",
+		"watched":   "watched.invalid",
+		"released":  "released.invalid",
+		"order":     "order.not_permitted",
+		"page_size": "page_size.too_small",
+	}, v.Codes)
+}
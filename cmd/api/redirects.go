@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/walkccc/greenlight/internal/data"
+)
+
+// notFoundWriter holds back a 404 Not Found response, so that it can be replaced by a redirect.
+// Any other response is written through.
+type notFoundWriter struct {
+	http.ResponseWriter
+	notFound bool
+	body     bytes.Buffer
+}
+
+func (nw *notFoundWriter) WriteHeader(statusCode int) {
+	if statusCode == http.StatusNotFound {
+		nw.notFound = true
+		return
+	}
+	nw.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (nw *notFoundWriter) Write(b []byte) (int, error) {
+	if nw.notFound {
+		return nw.body.Write(b)
+	}
+	return nw.ResponseWriter.Write(b)
+}
+
+func (nw *notFoundWriter) Unwrap() http.ResponseWriter {
+	return nw.ResponseWriter
+}
+
+// flush writes the 404 Not Found response that was held back.
+func (nw *notFoundWriter) flush() {
+	nw.ResponseWriter.WriteHeader(http.StatusNotFound)
+	nw.ResponseWriter.Write(nw.body.Bytes())
+}
+
+// redirectMoved wraps the handler of a route with an :id parameter, so that the requests for the
+// resources that have moved, e.g. the duplicate movies merged into another one, get a 308
+// Permanent Redirect to the same URL with the new ID rather than a 404 Not Found. The redirects
+// are only looked up once the handler has found nothing, so the other requests don't pay for it.
+// It must run after requireOrganization(), since the redirects are scoped to the organization.
+func (app *application) redirectMoved(resource string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		nw := &notFoundWriter{ResponseWriter: w}
+		next.ServeHTTP(nw, r)
+		if !nw.notFound {
+			return
+		}
+
+		id, err := app.readIDParam(r)
+		if err != nil {
+			nw.flush()
+			return
+		}
+
+		newID, err := app.models.Redirects.Get(
+			r.Context(),
+			resource,
+			app.contextGetUser(r).OrganizationID,
+			id,
+		)
+		if err != nil {
+			if !errors.Is(err, data.ErrRecordNotFound) {
+				app.logError(r, err)
+			}
+			nw.flush()
+			return
+		}
+
+		param := httprouter.ParamsFromContext(r.Context()).ByName("id")
+		location := *r.URL
+		location.Path = strings.Replace(
+			location.Path,
+			"/"+resource+"/"+param,
+			"/"+resource+"/"+strconv.FormatInt(newID, 10),
+			1,
+		)
+		location.RawPath = ""
+
+		headers := make(http.Header)
+		headers.Set("Location", location.RequestURI())
+
+		env := envelope{"message": "the resource has moved", "id": newID}
+		err = app.writeJSON(w, http.StatusPermanentRedirect, env, headers)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+		}
+	}
+}
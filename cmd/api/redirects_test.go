@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/assert"
+	"github.com/walkccc/greenlight/internal/data"
+)
+
+// stubRedirectModel redirects the IDs in its map, in every organization.
+type stubRedirectModel map[int64]int64
+
+func (m stubRedirectModel) Get(
+	ctx context.Context,
+	resource string,
+	organizationID, oldID int64,
+) (int64, error) {
+	newID, found := m[oldID]
+	if !found {
+		return 0, data.ErrRecordNotFound
+	}
+	return newID, nil
+}
+
+func TestRedirectMoved(t *testing.T) {
+	app := &application{models: data.Models{Redirects: stubRedirectModel{2: 1}}}
+
+	handler := app.redirectMoved(data.ResourceMovies, func(w http.ResponseWriter, r *http.Request) {
+		if httprouter.ParamsFromContext(r.Context()).ByName("id") == "1" {
+			w.Write([]byte("found"))
+			return
+		}
+		app.notFoundResponse(w, r)
+	})
+
+	request := func(id string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPatch, "/v1/movies/"+id+"/revert?to=3", nil)
+		params := httprouter.Params{{Key: "id", Value: id}}
+		r = r.WithContext(context.WithValue(r.Context(), httprouter.ParamsKey, params))
+		r = app.contextSetUser(r, &data.User{ID: 1, OrganizationID: 1})
+
+		rr := httptest.NewRecorder()
+		handler(rr, r)
+		return rr
+	}
+
+	rr := request("1")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "found", rr.Body.String())
+
+	rr = request("2")
+	assert.Equal(t, http.StatusPermanentRedirect, rr.Code)
+	assert.Equal(t, "/v1/movies/1/revert?to=3", rr.Header().Get("Location"))
+
+	rr = request("3")
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+	assert.Contains(t, rr.Body.String(), "could not be found")
+}
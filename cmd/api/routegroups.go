@@ -0,0 +1,93 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+
+	"github.com/justinas/alice"
+)
+
+// registeredRoute is a route registered through a routeGroup, as listed by "GET /debug/routes".
+type registeredRoute struct {
+	Method  string `json:"method"`
+	Pattern string `json:"pattern"`
+	Group   string `json:"group"`
+}
+
+// routeGroup registers routes under a common prefix, wrapping their handlers in the group's
+// middleware, and records them so that the registered routes can be listed. Groups nest: a
+// sub-group adds its prefix and middleware to those of its parent.
+//
+// The middleware are applied to each route's handler, so they're built once per route and mustn't
+// hold any state of their own (e.g. a rate limiter should be shared by the routes it applies to).
+type routeGroup struct {
+	name       string
+	prefix     string
+	middleware []alice.Constructor
+	register   func(method, pattern string, handler http.HandlerFunc)
+	routes     *[]registeredRoute
+}
+
+// newRouteGroup returns the root group, which registers the routes with register, e.g. a router's
+// HandlerFunc method.
+func newRouteGroup(register func(method, pattern string, handler http.HandlerFunc)) *routeGroup {
+	return &routeGroup{name: "root", register: register, routes: new([]registeredRoute)}
+}
+
+// group returns a sub-group serving its routes under the prefix, with the middleware applied in
+// order, the first one outermost, inside those of g.
+func (g *routeGroup) group(name, prefix string, middleware ...alice.Constructor) *routeGroup {
+	return &routeGroup{
+		name:       name,
+		prefix:     g.prefix + prefix,
+		middleware: append(append([]alice.Constructor{}, g.middleware...), middleware...),
+		register:   g.register,
+		routes:     g.routes,
+	}
+}
+
+// handle registers the route, along with a HEAD route answered by the handler if it's a GET one.
+// Its signature is that of the functions that apiRoutes() and debugRoutes() register their routes
+// with, so that a group can be mounted with them.
+func (g *routeGroup) handle(method, pattern string, handler http.HandlerFunc) {
+	pattern = g.prefix + pattern
+	*g.routes = append(*g.routes, registeredRoute{Method: method, Pattern: pattern, Group: g.name})
+	handler = alice.New(g.middleware...).ThenFunc(handler).ServeHTTP
+	g.register(method, pattern, handler)
+	if method == http.MethodGet {
+		g.register(http.MethodHead, pattern, headHandler(handler))
+	}
+}
+
+// list returns the routes registered in the group's tree, sorted by pattern and method.
+func (g *routeGroup) list() []registeredRoute {
+	routes := append([]registeredRoute{}, *g.routes...)
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].Pattern != routes[j].Pattern {
+			return routes[i].Pattern < routes[j].Pattern
+		}
+		return routes[i].Method < routes[j].Method
+	})
+	return routes
+}
+
+// handlerMiddleware adapts a middleware wrapping an http.HandlerFunc, like requirePermission() and
+// versioned(), for use in a group.
+func handlerMiddleware(wrap func(next http.HandlerFunc) http.HandlerFunc) alice.Constructor {
+	return func(next http.Handler) http.Handler {
+		return wrap(next.ServeHTTP)
+	}
+}
+
+// listRoutesHandler handles requests for "GET /debug/routes".
+func (app *application) listRoutesHandler(w http.ResponseWriter, r *http.Request) {
+	// The routes are registered again without a router, rather than kept from routes(), so that
+	// the debug listener can list them before the API server is started.
+	root := newRouteGroup(func(method, pattern string, handler http.HandlerFunc) {})
+	app.registerRoutes(root)
+
+	err := app.writeJSON(w, http.StatusOK, envelope{"routes": root.list()}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
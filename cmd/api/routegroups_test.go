@@ -0,0 +1,63 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/justinas/alice"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRouteGroups(t *testing.T) {
+	router := httprouter.New()
+	root := newRouteGroup(router.HandlerFunc)
+
+	// tag appends the name to the X-Middleware header, to show the order the middleware ran in.
+	tag := func(name string) alice.Constructor {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Add("X-Middleware", name)
+				next.ServeHTTP(w, r)
+			})
+		}
+	}
+
+	admin := root.group("admin", "/admin", tag("auth"))
+	reports := admin.group("reports", "/reports", tag("audit"))
+	ok := func(w http.ResponseWriter, r *http.Request) {}
+
+	root.handle(http.MethodGet, "/healthcheck", ok)
+	admin.handle(http.MethodPost, "/drain", ok)
+	reports.handle(http.MethodGet, "/:id", ok)
+
+	serve := func(method, path string) []string {
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, httptest.NewRequest(method, path, nil))
+		assert.Equal(t, http.StatusOK, rr.Code, path)
+		return rr.Header().Values("X-Middleware")
+	}
+
+	assert.Empty(t, serve(http.MethodGet, "/healthcheck"))
+	assert.Equal(t, []string{"auth"}, serve(http.MethodPost, "/admin/drain"))
+	assert.Equal(t, []string{"auth", "audit"}, serve(http.MethodGet, "/admin/reports/1"))
+
+	assert.Equal(t, []registeredRoute{
+		{Method: http.MethodPost, Pattern: "/admin/drain", Group: "admin"},
+		{Method: http.MethodGet, Pattern: "/admin/reports/:id", Group: "reports"},
+		{Method: http.MethodGet, Pattern: "/healthcheck", Group: "root"},
+	}, root.list())
+}
+
+func TestRegisterRoutes(t *testing.T) {
+	app := &application{}
+	root := newRouteGroup(func(method, pattern string, handler http.HandlerFunc) {})
+	app.registerRoutes(root)
+
+	assert.Subset(t, root.list(), []registeredRoute{
+		{Method: http.MethodGet, Pattern: "/v1/movies/:id", Group: apiV1},
+		{Method: http.MethodGet, Pattern: "/v2/movies/:id", Group: apiV2},
+		{Method: http.MethodGet, Pattern: "/debug/routes", Group: "debug"},
+	})
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/walkccc/greenlight/internal/metrics"
+	"github.com/walkccc/greenlight/internal/reqctx"
+)
+
+var routeContextKey = reqctx.NewKey[*routeInfo]("route")
+
+// unmatchedRoute is the label used for requests that didn't reach a route, e.g. 404s or requests
+// rejected by the rate limiter. It deliberately doesn't include the method or path, as those come
+// straight from the client and would make the number of labels unbounded.
+const unmatchedRoute = "unmatched"
+
+// defaultExcludedRoutes are the routes left out of the route metrics by default: the probes and
+// the scrapes of the metrics, which would drown out the traffic of the clients.
+var defaultExcludedRoutes = []string{
+	"/v1/healthcheck",
+	"/v2/healthcheck",
+	"/v1/readyz",
+	"/v2/readyz",
+	"/debug/vars",
+}
+
+// routeExcluder reports whether a route is left out of the route metrics. Each excluded route is
+// either a label, e.g. "GET /v1/healthcheck", or a pattern, which excludes it for every method.
+type routeExcluder map[string]bool
+
+func newRouteExcluder(routes []string) routeExcluder {
+	excluder := make(routeExcluder, len(routes))
+	for _, route := range routes {
+		excluder[route] = true
+	}
+	return excluder
+}
+
+func (e routeExcluder) excluded(label string) bool {
+	if e[label] {
+		return true
+	}
+	_, pattern, _ := strings.Cut(label, " ")
+	return e[pattern]
+}
+
+// routeInfo is added to the request context by the metrics middleware, and filled in with the
+// method and pattern of the matched route by the handler registered with the router, so that the
+// middleware can label the request once it has been handled.
+type routeInfo struct {
+	label string
+}
+
+// withRoute wraps a route's handler so that it records the route's label on the request.
+func withRoute(method, pattern string, next http.HandlerFunc) http.HandlerFunc {
+	label := method + " " + pattern
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		if info, ok := routeContextKey.Get(r.Context()); ok {
+			info.label = label
+		}
+		next(w, r)
+	}
+}
+
+// contextSetRouteInfo returns a new copy of the request with a routeInfo added to the context. The
+// route is labelled as unmatched until a route's handler says otherwise.
+func contextSetRouteInfo(r *http.Request) (*http.Request, *routeInfo) {
+	info := &routeInfo{label: unmatchedRoute}
+	return r.WithContext(routeContextKey.Set(r.Context(), info)), info
+}
+
+// routeMetrics holds the metrics for a single route.
+type routeMetrics struct {
+	requests      atomic.Int64
+	statusClasses [5]atomic.Int64 // 1xx to 5xx
+	duration      *metrics.Histogram
+	requestBytes  metrics.Summary
+	responseBytes metrics.Summary
+}
+
+// routeMetricsSnapshot is the JSON representation of a route's metrics.
+type routeMetricsSnapshot struct {
+	Requests        int64                     `json:"requests"`
+	Status          map[string]int64          `json:"status"`
+	ErrorRate       float64                   `json:"error_rate"`
+	DurationSeconds metrics.HistogramSnapshot `json:"duration_seconds"`
+	RequestBytes    metrics.SummarySnapshot   `json:"request_bytes"`
+	ResponseBytes   metrics.SummarySnapshot   `json:"response_bytes"`
+}
+
+func (m *routeMetrics) observe(statusCode int, seconds float64, requestBytes, responseBytes int64) {
+	m.requests.Add(1)
+	if class := statusCode/100 - 1; class >= 0 && class < len(m.statusClasses) {
+		m.statusClasses[class].Add(1)
+	}
+	m.duration.Observe(seconds)
+	m.requestBytes.Observe(float64(requestBytes))
+	m.responseBytes.Observe(float64(responseBytes))
+}
+
+func (m *routeMetrics) snapshot() routeMetricsSnapshot {
+	s := routeMetricsSnapshot{
+		Requests:        m.requests.Load(),
+		Status:          make(map[string]int64, len(m.statusClasses)),
+		DurationSeconds: m.duration.Snapshot(),
+		RequestBytes:    m.requestBytes.Snapshot(),
+		ResponseBytes:   m.responseBytes.Snapshot(),
+	}
+
+	for i := range m.statusClasses {
+		s.Status[strconv.Itoa(i+1)+"xx"] = m.statusClasses[i].Load()
+	}
+	// The error rate only counts server errors: 4xx responses are the client's fault.
+	if s.Requests > 0 {
+		s.ErrorRate = float64(s.Status["5xx"]) / float64(s.Requests)
+	}
+
+	return s
+}
+
+// routeMetricsRegistry holds the metrics of every route, keyed by label.
+type routeMetricsRegistry struct {
+	mtx    sync.RWMutex
+	routes map[string]*routeMetrics
+}
+
+func newRouteMetricsRegistry() *routeMetricsRegistry {
+	return &routeMetricsRegistry{routes: make(map[string]*routeMetrics)}
+}
+
+// get returns the metrics for the route label, creating them on first use.
+func (reg *routeMetricsRegistry) get(label string) *routeMetrics {
+	reg.mtx.RLock()
+	m, ok := reg.routes[label]
+	reg.mtx.RUnlock()
+	if ok {
+		return m
+	}
+
+	reg.mtx.Lock()
+	defer reg.mtx.Unlock()
+
+	if m, ok := reg.routes[label]; ok {
+		return m
+	}
+	m = &routeMetrics{duration: metrics.NewHistogram(metrics.DefaultLatencyBuckets)}
+	reg.routes[label] = m
+	return m
+}
+
+// snapshot returns the metrics of every route, for publishing with expvar.
+func (reg *routeMetricsRegistry) snapshot() any {
+	reg.mtx.RLock()
+	defer reg.mtx.RUnlock()
+
+	s := make(map[string]routeMetricsSnapshot, len(reg.routes))
+	for label, m := range reg.routes {
+		s[label] = m.snapshot()
+	}
+	return s
+}
+
+// countingReadCloser counts the bytes read from a request body.
+type countingReadCloser struct {
+	io.ReadCloser
+	n int64
+}
+
+func (c *countingReadCloser) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	c.n += int64(n)
+	return n, err
+}
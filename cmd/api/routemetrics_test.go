@@ -0,0 +1,41 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRouteLabels(t *testing.T) {
+	router := httprouter.New()
+	router.HandlerFunc(http.MethodGet, "/v1/movies/:id", withRoute(
+		http.MethodGet,
+		"/v1/movies/:id",
+		func(w http.ResponseWriter, r *http.Request) {},
+	))
+
+	label := func(path string) string {
+		r, route := contextSetRouteInfo(httptest.NewRequest(http.MethodGet, path, nil))
+		router.ServeHTTP(httptest.NewRecorder(), r)
+		return route.label
+	}
+
+	// The requests are labelled by the route's pattern, not by their URL.
+	assert.Equal(t, "GET /v1/movies/:id", label("/v1/movies/1"))
+	assert.Equal(t, "GET /v1/movies/:id", label("/v1/movies/2?fields=title"))
+	assert.Equal(t, unmatchedRoute, label("/v1/movies/1/cast"))
+}
+
+func TestRouteExcluder(t *testing.T) {
+	excluder := newRouteExcluder([]string{"/v1/healthcheck", "POST /v1/movies"})
+
+	assert.True(t, excluder.excluded("GET /v1/healthcheck"))
+	assert.True(t, excluder.excluded("HEAD /v1/healthcheck"))
+	assert.True(t, excluder.excluded("POST /v1/movies"))
+	assert.False(t, excluder.excluded("GET /v1/movies"))
+	assert.False(t, excluder.excluded("GET /v2/healthcheck"))
+	assert.False(t, excluder.excluded(unmatchedRoute))
+}
@@ -1,64 +1,300 @@
 package main
 
 import (
-	"expvar"
 	"net/http"
 
 	"github.com/julienschmidt/httprouter"
-	"github.com/justinas/alice"
+	"github.com/walkccc/greenlight/internal/data"
+	"github.com/walkccc/greenlight/internal/storage"
 )
 
 func (app *application) routes() http.Handler {
+	if app.config.mock.enabled {
+		return app.mockRoutes()
+	}
+
+	router := app.newRouter()
+
+	// The batch endpoint runs its sub-requests through the router. They've already been through
+	// the middleware with the batch, except for the organization's limits, which count each of
+	// them.
+	app.subrequests = app.tenantRateLimit(router)
+
+	// The standard middleware chain is declared in middlewareSpecs.
+	return app.chain().Then(router)
+}
+
+// newRouter returns the router of the API server's routes. The router answers the OPTIONS
+// requests of every route itself, and sends the 405 responses, with an Allow header listing the
+// route's methods. With -route-suggestions, its 404 responses suggest the near-miss routes.
+func (app *application) newRouter() *httprouter.Router {
 	router := httprouter.New()
 
 	router.NotFound = http.HandlerFunc(app.notFoundResponse)
 	router.MethodNotAllowed = http.HandlerFunc(app.methodNotAllowedResponse)
+	router.GlobalOPTIONS = http.HandlerFunc(app.optionsHandler)
+
+	// The routes are labelled with their pattern for the metrics.
+	root := newRouteGroup(func(method, pattern string, handler http.HandlerFunc) {
+		router.HandlerFunc(method, pattern, withRoute(method, pattern, handler))
+	})
+	app.registerRoutes(root)
+
+	if app.config.routeSuggestions {
+		router.NotFound = app.notFoundWithSuggestions(newRouteSuggester(root.list()))
+	}
+
+	return router
+}
+
+// registerRoutes registers every route of the API server in the root group: the API under each
+// version, in a group recording the version (only the v1 routes can carry a deprecation schedule),
+// the debug endpoints in a group requiring the admin:read permission, and the files of the local
+// storage, if it's configured, at /assets where its signed URLs point to.
+func (app *application) registerRoutes(root *routeGroup) {
+	for _, version := range []string{apiV1, apiV2} {
+		version := version
+		group := root.group(version, "/"+version, handlerMiddleware(
+			func(next http.HandlerFunc) http.HandlerFunc {
+				return app.versioned(version, next)
+			},
+		))
+		app.apiRoutes(group.handle)
+	}
 
-	router.HandlerFunc(http.MethodGet, "/v1/healthcheck", app.healthcheckHandler)
+	debug := root.group("debug", "", handlerMiddleware(
+		func(next http.HandlerFunc) http.HandlerFunc {
+			return app.requirePermission("admin:read", next)
+		},
+	))
+	app.debugRoutes(debug.handle)
 
-	router.HandlerFunc(
+	if local, ok := app.storage.(*storage.Local); ok {
+		root.handle(http.MethodGet, "/assets/*key", app.assetsHandler(local))
+	}
+}
+
+// apiRoutes registers the versioned API routes with handle. The patterns are relative to the
+// version's prefix, e.g. /movies is served as /v1/movies and /v2/movies.
+func (app *application) apiRoutes(handle func(method, pattern string, handler http.HandlerFunc)) {
+	handle(http.MethodGet, "/healthcheck", app.healthcheckHandler)
+	handle(http.MethodGet, "/readyz", app.readinessHandler)
+	handle(http.MethodGet, "/openapi.json", app.openAPIHandler)
+
+	handle(
+		http.MethodGet,
+		"/movies",
+		app.requirePermission("movies:read", app.requireOrganization(app.getMoviesHandler)),
+	)
+	handle(
 		http.MethodGet,
-		"/v1/movies",
-		app.requirePermission("movies:read", app.getMoviesHandler),
+		"/attributes",
+		app.requirePermission("movies:read", app.listAttributesHandler),
 	)
-	router.HandlerFunc(
+	handle(
 		http.MethodPost,
-		"/v1/movies",
-		app.requirePermission("movies:write", app.createMovieHandler),
+		"/movies",
+		app.requirePermission("movies:write", app.requireOrganization(app.createMovieHandler)),
+	)
+	handle(
+		http.MethodPost,
+		"/imports/movies",
+		app.requirePermission("movies:write", app.requireOrganization(app.importMoviesHandler)),
+	)
+	handle(
+		http.MethodGet,
+		"/movies/:id",
+		app.requirePermission(
+			"movies:read",
+			app.requireOrganization(app.redirectMoved(data.ResourceMovies, app.getMovieHandler)),
+		),
 	)
-	router.HandlerFunc(
+	handle(
 		http.MethodGet,
-		"/v1/movies/:id",
-		app.requirePermission("movies:read", app.getMovieHandler),
+		"/movies/:id/poster",
+		app.requirePermission(
+			"movies:read",
+			app.requireOrganization(
+				app.redirectMoved(data.ResourceMovies, app.getMoviePosterHandler),
+			),
+		),
 	)
-	router.HandlerFunc(
+	handle(
+		http.MethodPut,
+		"/movies/:id/poster",
+		app.requirePermission(
+			"movies:write",
+			app.requireOrganization(
+				app.redirectMoved(data.ResourceMovies, app.putMoviePosterHandler),
+			),
+		),
+	)
+	handle(
 		http.MethodPatch,
-		"/v1/movies/:id",
-		app.requirePermission("movies:write", app.updateMovieHandler),
+		"/movies/:id",
+		app.requirePermission(
+			"movies:write",
+			app.requireOrganization(app.redirectMoved(data.ResourceMovies, app.updateMovieHandler)),
+		),
 	)
-	router.HandlerFunc(
+	handle(
 		http.MethodDelete,
-		"/v1/movies/:id",
-		app.requirePermission("movies:write", app.deleteMovieHandler),
+		"/movies/:id",
+		app.requirePermission("movies:write", app.requireOrganization(app.deleteMovieHandler)),
+	)
+	handle(
+		http.MethodPost,
+		"/movies/:id/revert",
+		app.requirePermission(
+			"movies:write",
+			app.requireOrganization(app.redirectMoved(data.ResourceMovies, app.revertMovieHandler)),
+		),
+	)
+	handle(
+		http.MethodPost,
+		"/movies/:id/merge",
+		app.requirePermission("admin:write", app.requireOrganization(app.mergeMovieHandler)),
+	)
+
+	handle(http.MethodPost, "/users", app.createUserHandler)
+	handle(http.MethodGet, "/users/activate", app.activateUserLinkHandler)
+	handle(http.MethodPut, "/users/activated", app.activateUserHandler)
+
+	handle(
+		http.MethodGet,
+		"/users/me/searches",
+		app.requirePermission("movies:read", app.requireOrganization(app.listSavedSearchesHandler)),
+	)
+	handle(
+		http.MethodPost,
+		"/users/me/searches",
+		app.requirePermission("movies:read", app.requireOrganization(app.createSavedSearchHandler)),
+	)
+	handle(
+		http.MethodGet,
+		"/users/me/searches/:id",
+		app.requirePermission("movies:read", app.requireOrganization(app.getSavedSearchHandler)),
+	)
+	handle(
+		http.MethodDelete,
+		"/users/me/searches/:id",
+		app.requirePermission("movies:read", app.requireOrganization(app.deleteSavedSearchHandler)),
+	)
+	handle(
+		http.MethodGet,
+		"/users/me/searches/:id/movies",
+		app.requirePermission("movies:read", app.requireOrganization(app.runSavedSearchHandler)),
+	)
+
+	handle(
+		http.MethodGet,
+		"/users/me/notifications",
+		app.requireActivatedUser(app.requireOrganization(app.listNotificationsHandler)),
+	)
+	handle(
+		http.MethodPatch,
+		"/users/me/notifications/:id",
+		app.requireActivatedUser(app.requireOrganization(app.updateNotificationHandler)),
+	)
+	handle(
+		http.MethodGet,
+		"/users/me/notification-preferences",
+		app.requireActivatedUser(app.getNotificationPreferencesHandler),
+	)
+	handle(
+		http.MethodPatch,
+		"/users/me/notification-preferences",
+		app.requireActivatedUser(app.updateNotificationPreferencesHandler),
 	)
 
-	router.HandlerFunc(http.MethodPost, "/v1/users", app.createUserHandler)
-	router.HandlerFunc(http.MethodPut, "/v1/users/activated", app.activateUserHandler)
+	handle(
+		http.MethodGet,
+		"/users/me/signing-keys",
+		app.requireActivatedUser(app.listSigningKeysHandler),
+	)
+	handle(
+		http.MethodPost,
+		"/users/me/signing-keys",
+		app.requireActivatedUser(app.createSigningKeyHandler),
+	)
+	handle(
+		http.MethodDelete,
+		"/users/me/signing-keys/:id",
+		app.requireActivatedUser(app.deleteSigningKeyHandler),
+	)
 
-	router.HandlerFunc(
+	handle(
 		http.MethodPost,
-		"/v1/tokens/authentication",
+		"/tokens/authentication",
 		app.createAuthenticationTokenHandler,
 	)
 
-	router.Handler(http.MethodGet, "/debug/vars", expvar.Handler())
+	handle(http.MethodPost, "/batch", app.batchHandler)
+
+	handle(http.MethodPost, "/webhooks/catalog/:source", app.catalogWebhookHandler)
+
+	handle(
+		http.MethodPost,
+		"/admin/drain",
+		app.requirePermission("admin:write", app.drainHandler),
+	)
+	handle(
+		http.MethodPost,
+		"/admin/webhooks/test",
+		app.requirePermission("admin:write", app.webhookTestHandler),
+	)
+
+	handle(
+		http.MethodGet,
+		"/organization/usage",
+		app.requireActivatedUser(app.requireOrganization(app.getOrganizationUsageHandler)),
+	)
 
-	standard := alice.New(
-		app.metrics,
-		app.recoverPanic,
-		app.enableCORS,
-		app.rateLimit,
-		app.authenticate,
+	handle(
+		http.MethodPost,
+		"/admin/organizations",
+		app.requirePermission("admin:write", app.createOrganizationHandler),
+	)
+	handle(
+		http.MethodPut,
+		"/admin/organizations/:id/limits",
+		app.requirePermission("admin:write", app.setOrganizationLimitsHandler),
+	)
+	handle(
+		http.MethodGet,
+		"/admin/organizations/:id/members",
+		app.requirePermission("admin:read", app.listOrganizationMembersHandler),
+	)
+	handle(
+		http.MethodPut,
+		"/admin/organizations/:id/members/:user_id",
+		app.requirePermission("admin:write", app.setOrganizationMemberHandler),
+	)
+	handle(
+		http.MethodDelete,
+		"/admin/organizations/:id/members/:user_id",
+		app.requirePermission("admin:write", app.removeOrganizationMemberHandler),
+	)
+
+	handle(
+		http.MethodPut,
+		"/admin/service-accounts",
+		app.requirePermission("admin:write", app.setServiceAccountHandler),
+	)
+	handle(
+		http.MethodDelete,
+		"/admin/service-accounts",
+		app.requirePermission("admin:write", app.deleteServiceAccountHandler),
+	)
+
+	handle(
+		http.MethodPost,
+		"/admin/attributes",
+		app.requirePermission("admin:write", app.createAttributeHandler),
+	)
+	handle(
+		http.MethodDelete,
+		"/admin/attributes/:name",
+		app.requirePermission("admin:write", app.deleteAttributeHandler),
 	)
-	return standard.Then(router)
 }
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/walkccc/greenlight/internal/data"
+	"github.com/walkccc/greenlight/internal/dto"
+	"github.com/walkccc/greenlight/internal/validator"
+)
+
+// createSavedSearchHandler handles requests for "POST /v1/users/me/searches".
+func (app *application) createSavedSearchHandler(w http.ResponseWriter, r *http.Request) {
+	var input dto.CreateSavedSearchRequest
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	if v.Struct(input); !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	user := app.contextGetUser(r)
+	search := input.SavedSearch(user.ID, user.OrganizationID)
+
+	if data.ValidateSavedSearch(v, search); !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	err = app.models.SavedSearches.Insert(r.Context(), search)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateSearchName):
+			v.AddError(
+				"name",
+				validator.CodeAlreadyExists,
+				"a saved search with this name already exists",
+			)
+			app.failedValidationResponse(w, r, v)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", app.link(r, http.MethodGet, "/users/me/searches/:id", search.ID).Href)
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"search": search}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// listSavedSearchesHandler handles requests for "GET /v1/users/me/searches".
+func (app *application) listSavedSearchesHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	searches, err := app.models.SavedSearches.GetAllForUser(
+		r.Context(),
+		user.ID,
+		user.OrganizationID,
+	)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"searches": searches}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// getSavedSearchHandler handles requests for "GET /v1/users/me/searches/:id".
+func (app *application) getSavedSearchHandler(w http.ResponseWriter, r *http.Request) {
+	search, ok := app.readSavedSearch(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.writeJSON(w, http.StatusOK, envelope{"search": search}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// deleteSavedSearchHandler handles requests for "DELETE /v1/users/me/searches/:id".
+func (app *application) deleteSavedSearchHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	err = app.models.SavedSearches.Delete(r.Context(), user.ID, user.OrganizationID, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(
+		w,
+		http.StatusOK,
+		envelope{"message": "saved search successfully deleted"},
+		nil,
+	)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// runSavedSearchHandler handles requests for "GET /v1/users/me/searches/:id/movies", which lists
+// the movies matching the saved search like "GET /v1/movies" would.
+func (app *application) runSavedSearchHandler(w http.ResponseWriter, r *http.Request) {
+	search, ok := app.readSavedSearch(w, r)
+	if !ok {
+		return
+	}
+
+	input := dto.RunSavedSearchQuery{
+		Page:     1,
+		PageSize: app.config.pagination.defaultPageSize,
+		Count:    app.config.pagination.countStrategy,
+	}
+
+	v := validator.New()
+	app.readQuery(r.URL.Query(), &input, v)
+
+	filters := app.paginate(input.Filters(search))
+
+	if data.ValidateFilters(v, filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	movies, metadata, err := app.models.Search.Search(
+		r.Context(),
+		search.OrganizationID,
+		search.Title,
+		search.Genres,
+		data.YearRange{},
+		nil,
+		filters,
+	)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if !app.checkPageInRange(w, r, filters, metadata) {
+		return
+	}
+
+	err = app.writeMovies(w, r, movies, metadata, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// readSavedSearch reads the saved search from the :id parameter, among the user's searches in the
+// organization. If it can't, it sends the error response and returns false.
+func (app *application) readSavedSearch(
+	w http.ResponseWriter,
+	r *http.Request,
+) (*data.SavedSearch, bool) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil, false
+	}
+
+	user := app.contextGetUser(r)
+
+	search, err := app.models.SavedSearches.Get(r.Context(), user.ID, user.OrganizationID, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+
+	return search, true
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/assert"
+	"github.com/walkccc/greenlight/greenlighttest"
+	"github.com/walkccc/greenlight/internal/data"
+)
+
+// stubSavedSearchModel keeps the saved searches in memory, and panics on the other methods.
+type stubSavedSearchModel struct {
+	data.SavedSearchModelInterface
+	searches map[int64]*data.SavedSearch
+}
+
+func (m stubSavedSearchModel) Insert(ctx context.Context, search *data.SavedSearch) error {
+	for _, s := range m.searches {
+		if s.UserID == search.UserID &&
+			s.OrganizationID == search.OrganizationID &&
+			s.Name == search.Name {
+			return data.ErrDuplicateSearchName
+		}
+	}
+	search.ID = int64(len(m.searches) + 1)
+	search.Version = 1
+	m.searches[search.ID] = search
+	return nil
+}
+
+func (m stubSavedSearchModel) Get(
+	ctx context.Context,
+	userID, organizationID, id int64,
+) (*data.SavedSearch, error) {
+	search, found := m.searches[id]
+	if !found || search.UserID != userID || search.OrganizationID != organizationID {
+		return nil, data.ErrRecordNotFound
+	}
+	return search, nil
+}
+
+func (m stubSavedSearchModel) Delete(ctx context.Context, userID, organizationID, id int64) error {
+	if _, err := m.Get(ctx, userID, organizationID, id); err != nil {
+		return err
+	}
+	delete(m.searches, id)
+	return nil
+}
+
+// stubSearchIndex records the filters of the last search, and returns no movies.
+type stubSearchIndex struct {
+	data.SearchIndex
+	last *searchCall
+}
+
+type searchCall struct {
+	organizationID int64
+	title          string
+	genres         []string
+	sort           string
+}
+
+func (s stubSearchIndex) Search(
+	ctx context.Context,
+	organizationID int64,
+	title string,
+	genres []string,
+	years data.YearRange,
+	attributes data.AttributeFilter,
+	filters data.Filters,
+) ([]*data.Movie, data.Metadata, error) {
+	*s.last = searchCall{organizationID, title, genres, filters.Sort}
+	return []*data.Movie{}, data.Metadata{}, nil
+}
+
+func TestSavedSearchHandlers(t *testing.T) {
+	index := stubSearchIndex{last: &searchCall{}}
+	app := &application{models: data.Models{
+		SavedSearches: stubSavedSearchModel{searches: make(map[int64]*data.SavedSearch)},
+		Search:        index,
+	}}
+	app.config.pagination.defaultPageSize = 20
+	app.config.pagination.maxPageSize = 100
+	app.config.pagination.maxPage = 100
+	app.config.pagination.countStrategy = "none"
+
+	router := httprouter.New()
+	handle := func(method, path string, handler http.HandlerFunc) {
+		router.HandlerFunc(method, path, func(w http.ResponseWriter, r *http.Request) {
+			r = app.contextSetUser(r, &data.User{ID: 1, OrganizationID: 7})
+			handler(w, r)
+		})
+	}
+	handle(http.MethodPost, "/v1/users/me/searches", app.createSavedSearchHandler)
+	handle(http.MethodDelete, "/v1/users/me/searches/:id", app.deleteSavedSearchHandler)
+	handle(http.MethodGet, "/v1/users/me/searches/:id/movies", app.runSavedSearchHandler)
+	client := greenlighttest.New(t, router)
+
+	var search data.SavedSearch
+	response := client.Post("/v1/users/me/searches", map[string]any{
+		"name":   "New dramas",
+		"title":  "night",
+		"genres": []string{"drama"},
+		"sort":   "-year",
+		"notify": true,
+	}).AssertStatus(http.StatusCreated).Decode("search", &search)
+	assert.Equal(t, "/v1/users/me/searches/1", response.Header.Get("Location"))
+	assert.Equal(t, "New dramas", search.Name)
+	assert.True(t, search.Notify)
+
+	// The names are unique per user and organization.
+	var errs map[string]string
+	client.Post("/v1/users/me/searches", map[string]any{"name": "New dramas"}).
+		AssertValidationError("name", "already_exists").
+		Decode("error", &errs)
+	assert.Equal(t, "a saved search with this name already exists", errs["name"])
+
+	client.Post("/v1/users/me/searches", map[string]any{"name": "Sorted", "sort": "rating"}).
+		AssertValidationError("sort", "not_permitted")
+
+	// Running the search applies its filters and sort, in its organization.
+	client.Get("/v1/users/me/searches/1/movies").AssertStatus(http.StatusOK)
+	assert.Equal(t, int64(7), index.last.organizationID)
+	assert.Equal(t, "night", index.last.title)
+	assert.Equal(t, []string{"drama"}, index.last.genres)
+	assert.Equal(t, "-year", index.last.sort)
+
+	client.Get("/v1/users/me/searches/2/movies").AssertStatus(http.StatusNotFound)
+
+	client.Delete("/v1/users/me/searches/1").AssertStatus(http.StatusOK)
+	client.Delete("/v1/users/me/searches/1").AssertStatus(http.StatusNotFound)
+	client.Get("/v1/users/me/searches/1/movies").AssertStatus(http.StatusNotFound)
+}
@@ -3,72 +3,115 @@ package main
 import (
 	"context"
 	"errors"
-	"fmt"
 	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
 	"time"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
 )
 
 // serve starts a server. When we receive a SIGINT or SIGTERM signal, we instruct our server to stop
-// accepting any new HTTP requests, and give any in-flight requests a 'grace period' of 30 seconds
-// to complete before the application is terminated.
+// accepting any new HTTP requests, and give any in-flight requests a 'grace period' (30 seconds by
+// default, see the -shutdown-timeout flag) to complete, followed by the registered shutdown hooks,
+// before the application is terminated.
 func (app *application) serve() error {
 	server := &http.Server{
-		Addr:         fmt.Sprintf(":%d", app.config.port),
+		Addr:         app.listenAddress(),
 		Handler:      app.routes(),
 		IdleTimeout:  time.Minute,
 		ReadTimeout:  5 * time.Second,
 		WriteTimeout: 10 * time.Second,
 	}
 
+	if app.config.h2c.enabled {
+		err := app.enableH2C(server)
+		if err != nil {
+			return err
+		}
+	}
+
+	// The mTLS listener serves the same routes, and is shut down along with the main one.
+	var mtls *http.Server
+	if app.config.mtls.addr != "" {
+		var err error
+		mtls, err = app.serveMTLS(server.Handler)
+		if err != nil {
+			return err
+		}
+	}
+
 	// shutdownError is a channel that receives any errors returned by the graceful Showtdown().
 	shutdownError := make(chan error)
 
 	go func() {
-		// Intercept the signals.
+		// Intercept the signals, or wait for a drain to be requested via the admin endpoint.
 		quit := make(chan os.Signal, 1)
 		signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
-		s := <-quit
 
-		app.logger.PrintInfo("shutting down server", map[string]string{
-			"signal": s.String(),
-		})
+		select {
+		case s := <-quit:
+			// An interactive SIGINT (i.e. Ctrl+C) shuts down straight away, but a SIGTERM (as sent
+			// by Kubernetes or systemd) gives the load balancers time to stop sending us traffic.
+			if s == syscall.SIGTERM {
+				app.drain()
+			}
+			app.logger.PrintInfo("shutting down server", map[string]string{
+				"signal": s.String(),
+			})
+		case <-app.drainRequested:
+			app.drain()
+			app.logger.PrintInfo("shutting down server", map[string]string{
+				"reason": "drain requested",
+			})
+		}
 
-		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		ctx, cancel := context.WithTimeout(context.Background(), app.config.shutdownTimeout)
 		defer cancel()
 
 		// Call Shutdown() on our server, passing in the context. Shutdown() will return nil if the
 		// graceful shutdown was successful, or an error (which may happen because of a problem
-		// closing the listeners, or because the shutdown didn't complete before the 30-second
-		// context deadline is hit). We relay this return value to the shutdownError channel.
+		// closing the listeners, or because the shutdown didn't complete before the context
+		// deadline is hit).
 		err := server.Shutdown(ctx)
-		if err != nil {
-			shutdownError <- err
+		if mtls != nil {
+			if mtlsErr := mtls.Shutdown(ctx); err == nil {
+				err = mtlsErr
+			}
 		}
 
-		app.logger.PrintInfo("completing background tasks", map[string]string{
+		app.logger.PrintInfo("running shutdown hooks", map[string]string{
 			"addr": server.Addr,
 		})
 
-		// Call Wait() to block until our WaitGroup counter reaches zero -- essentially blocking
-		// until the background goroutines have finished. Then, we return nil on the shutdownError
-		// channel to indicate that the shutdown completed without any issues.
-		app.wg.Wait()
-		shutdownError <- nil
+		// Run the shutdown hooks (draining the background tasks, closing the database, etc.) even
+		// if Shutdown() failed, since we're terminating either way. We relay the first error to
+		// the shutdownError channel, or nil to indicate that the shutdown completed without any
+		// issues.
+		hooksErr := app.runShutdownHooks(ctx)
+		if err == nil {
+			err = hooksErr
+		}
+		shutdownError <- err
 	}()
 
+	listener, err := app.listen()
+	if err != nil {
+		return err
+	}
+
 	app.logger.PrintInfo("starting server", map[string]string{
 		"env":  app.config.env,
-		"addr": server.Addr,
+		"addr": listener.Addr().String(),
 	})
 
-	// Calling Shutdown() on our server will cause ListenAndServe() to immediately return a
+	// Calling Shutdown() on our server will cause Serve() to immediately return a
 	// http.ErrServerClosed error. So if we see this error, it's actually a good thing and an
 	// indication that the graceful shutdown has started. So we check specifically for this, only
 	// returning error if it's NOT http.ErrServerClosed.
-	err := server.ListenAndServe()
+	err = server.Serve(listener)
 	if !errors.Is(err, http.ErrServerClosed) {
 		return err
 	}
@@ -89,3 +132,23 @@ func (app *application) serve() error {
 
 	return nil
 }
+
+// enableH2C lets the server speak HTTP/2 over cleartext connections (h2c), for internal
+// deployments behind proxies that talk HTTP/2 to their upstreams without TLS. Both prior-knowledge
+// connections and HTTP/1.1 Upgrade requests are supported, and plain HTTP/1.1 keeps working.
+func (app *application) enableH2C(server *http.Server) error {
+	h2s := &http2.Server{
+		MaxConcurrentStreams: uint32(app.config.h2c.maxConcurrentStreams),
+		IdleTimeout:          server.IdleTimeout,
+	}
+
+	// ConfigureServer() hooks the HTTP/2 server into server.Shutdown(), so that open h2c
+	// connections are sent a GOAWAY frame during a graceful shutdown.
+	err := http2.ConfigureServer(server, h2s)
+	if err != nil {
+		return err
+	}
+
+	server.Handler = h2c.NewHandler(server.Handler, h2s)
+	return nil
+}
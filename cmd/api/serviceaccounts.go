@@ -0,0 +1,92 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/walkccc/greenlight/internal/data"
+	"github.com/walkccc/greenlight/internal/dto"
+	"github.com/walkccc/greenlight/internal/validator"
+)
+
+// setServiceAccountHandler handles requests for "PUT /v1/admin/service-accounts". It maps a client
+// certificate identity to the user (and organization) that the mTLS requests presenting it are
+// made as, replacing its previous mapping, if any.
+func (app *application) setServiceAccountHandler(w http.ResponseWriter, r *http.Request) {
+	var input dto.SetServiceAccountRequest
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	if v.Struct(input); !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	account := &data.ServiceAccount{
+		Identity:       input.Identity,
+		UserID:         input.UserID,
+		OrganizationID: input.OrganizationID,
+	}
+
+	err = app.models.ServiceAccounts.Set(r.Context(), account)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError(
+				"user_id",
+				validator.CodeInvalid,
+				"must be an existing user, and a member of the organization if one is given",
+			)
+			app.failedValidationResponse(w, r, v)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"service_account": account}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// deleteServiceAccountHandler handles requests for "DELETE /v1/admin/service-accounts". The
+// identity is passed in the query string, since it's usually a URI.
+func (app *application) deleteServiceAccountHandler(w http.ResponseWriter, r *http.Request) {
+	var input dto.ServiceAccountQuery
+
+	v := validator.New()
+
+	app.readQuery(r.URL.Query(), &input, v)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	err := app.models.ServiceAccounts.Delete(r.Context(), input.Identity)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(
+		w,
+		http.StatusOK,
+		envelope{"message": "service account successfully deleted"},
+		nil,
+	)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// shutdownHook is a named function that's run while the application shuts down, such as closing
+// the database connection pool or deregistering from service discovery.
+type shutdownHook struct {
+	name string
+	fn   func(ctx context.Context) error
+}
+
+// onShutdown registers a hook to run once the server has stopped accepting new requests and the
+// in-flight ones have completed. Hooks run in the order they were registered, so register a hook
+// after the hooks for anything it depends on (e.g. drain the background tasks before closing the
+// database they use).
+func (app *application) onShutdown(name string, fn func(ctx context.Context) error) {
+	app.shutdownHooks = append(app.shutdownHooks, shutdownHook{name: name, fn: fn})
+}
+
+// runShutdownHooks runs every registered hook in order, logging how long each of them took. A
+// failing hook doesn't stop the remaining ones from running; the first error is returned once they
+// have all run.
+func (app *application) runShutdownHooks(ctx context.Context) error {
+	var firstErr error
+
+	for _, hook := range app.shutdownHooks {
+		start := time.Now()
+		err := hook.fn(ctx)
+		duration := time.Since(start)
+
+		if err != nil {
+			app.logger.PrintError(err, map[string]string{
+				"hook":     hook.name,
+				"duration": duration.String(),
+			})
+			if firstErr == nil {
+				firstErr = fmt.Errorf("shutdown hook %q: %w", hook.name, err)
+			}
+			continue
+		}
+
+		app.logger.PrintInfo("completed shutdown hook", map[string]string{
+			"hook":     hook.name,
+			"duration": duration.String(),
+		})
+	}
+
+	return firstErr
+}
+
+// waitForBackground blocks until the background goroutines launched by background() have finished,
+// or until the context is done, whichever happens first.
+func (app *application) waitForBackground(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		app.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// requestDrain asks serve() to drain and then shut down the server. It's safe to call more than
+// once.
+func (app *application) requestDrain() {
+	app.drainOnce.Do(func() {
+		close(app.drainRequested)
+	})
+}
+
+// drain marks the application as draining, which makes the readiness probe fail, then waits for
+// the configured drain delay so that the load balancers notice and stop sending us new requests
+// before we stop accepting them.
+func (app *application) drain() {
+	app.draining.Store(true)
+
+	app.logger.PrintInfo("draining server", map[string]string{
+		"delay": app.config.drainDelay.String(),
+	})
+	time.Sleep(app.config.drainDelay)
+}
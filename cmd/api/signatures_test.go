@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/walkccc/greenlight/internal/data"
+)
+
+// stubSigningKeyUsers returns a user for the signing key sk_test.
+type stubSigningKeyUsers struct {
+	data.UserModelInterface
+	secret []byte
+}
+
+func (m stubSigningKeyUsers) GetForSigningKey(
+	ctx context.Context,
+	keyID string,
+) (*data.User, []byte, error) {
+	if keyID != "sk_test" {
+		return nil, nil, data.ErrRecordNotFound
+	}
+	return &data.User{ID: 7, OrganizationID: 3}, m.secret, nil
+}
+
+func TestAuthenticateSignature(t *testing.T) {
+	secret := []byte("0123456789abcdef0123456789abcdef")
+
+	app := &application{models: data.Models{Users: stubSigningKeyUsers{secret: secret}}}
+	app.config.signatures.maxSkew = time.Minute
+
+	var body string
+	handler := app.authenticateSignature(app.authenticate(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			user := app.contextGetUser(r)
+			assert.Equal(t, int64(7), user.ID)
+			assert.Equal(t, int64(3), user.OrganizationID)
+
+			b, _ := io.ReadAll(r.Body)
+			body = string(b)
+		},
+	)))
+
+	sign := func(keyID, nonce string, date time.Time, payload, signedPayload string) *http.Request {
+		const target = "/v1/movies?dry_run=true"
+		r := httptest.NewRequest(http.MethodPost, target, strings.NewReader(payload))
+
+		dateHeader := date.UTC().Format(http.TimeFormat)
+		digest := bodyDigest([]byte(signedPayload))
+		mac := hmac.New(sha256.New, secret)
+		mac.Write([]byte(signingString(http.MethodPost, target, dateHeader, nonce, digest)))
+
+		r.Header.Set("Date", dateHeader)
+		r.Header.Set("Digest", digest)
+		r.Header.Set("Authorization", `Signature keyId="`+keyID+`",nonce="`+nonce+
+			`",signature="`+base64.StdEncoding.EncodeToString(mac.Sum(nil))+`"`)
+		return r
+	}
+
+	serve := func(r *http.Request) int {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, r)
+		return rr.Code
+	}
+
+	payload := `{"title": "Moana"}`
+	assert.Equal(t, http.StatusOK, serve(sign("sk_test", "n1", time.Now(), payload, payload)))
+	assert.Equal(t, payload, body)
+
+	// A replayed request is rejected.
+	r := sign("sk_test", "n1", time.Now(), payload, payload)
+	assert.Equal(t, http.StatusUnauthorized, serve(r))
+
+	for name, r := range map[string]*http.Request{
+		"unknown key":  sign("sk_other", "n2", time.Now(), payload, payload),
+		"stale date":   sign("sk_test", "n3", time.Now().Add(-2*time.Minute), payload, payload),
+		"edited body":  sign("sk_test", "n4", time.Now(), `{"title": "Cars"}`, payload),
+		"missing date": sign("sk_test", "n5", time.Time{}, payload, payload),
+	} {
+		if name == "missing date" {
+			r.Header.Del("Date")
+		}
+		assert.Equal(t, http.StatusUnauthorized, serve(r), name)
+	}
+}
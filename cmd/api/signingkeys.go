@@ -0,0 +1,71 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/walkccc/greenlight/internal/data"
+)
+
+// listSigningKeysHandler handles requests for "GET /v1/users/me/signing-keys".
+func (app *application) listSigningKeysHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	keys, err := app.models.SigningKeys.GetAllForUser(r.Context(), user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"signing_keys": keys}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// createSigningKeyHandler handles requests for "POST /v1/users/me/signing-keys". The key is scoped
+// to the organization that the request's token is scoped to, if any, and its secret is only
+// returned in this response.
+func (app *application) createSigningKeyHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	key, err := app.models.SigningKeys.New(r.Context(), user.ID, user.OrganizationID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"signing_key": key}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// deleteSigningKeyHandler handles requests for "DELETE /v1/users/me/signing-keys/:id", which
+// revokes the key.
+func (app *application) deleteSigningKeyHandler(w http.ResponseWriter, r *http.Request) {
+	id := httprouter.ParamsFromContext(r.Context()).ByName("id")
+	user := app.contextGetUser(r)
+
+	err := app.models.SigningKeys.Delete(r.Context(), user.ID, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(
+		w,
+		http.StatusOK,
+		envelope{"message": "signing key successfully deleted"},
+		nil,
+	)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/tomasen/realip"
+	"github.com/walkccc/greenlight/internal/ratelimit"
+	"github.com/walkccc/greenlight/internal/validator"
+)
+
+// signupLimiter limits how many accounts are created per client IP address and per email domain,
+// which slows down the bots signing up en masse. Each is a token bucket refilled over an hour, so
+// that a limit of 5 lets through 5 signups at once and then one every 12 minutes.
+//
+// A nil *signupLimiter, or a nil store, lets every signup through.
+type signupLimiter struct {
+	ips     *ratelimit.Store
+	domains *ratelimit.Store
+}
+
+// newSignupLimiter returns a limiter of the signups per hour, or nil if both limits are zero.
+func newSignupLimiter(perIP, perDomain int) *signupLimiter {
+	if perIP <= 0 && perDomain <= 0 {
+		return nil
+	}
+
+	perHour := func(limit int) *ratelimit.Store {
+		if limit <= 0 {
+			return nil
+		}
+		return ratelimit.New(float64(limit)/time.Hour.Seconds(), limit, 10000)
+	}
+	return &signupLimiter{ips: perHour(perIP), domains: perHour(perDomain)}
+}
+
+func (l *signupLimiter) allowIP(ip string) bool {
+	return l == nil || l.ips == nil || l.ips.Allow(ip)
+}
+
+func (l *signupLimiter) allowDomain(domain string) bool {
+	return l == nil || l.domains == nil || l.domains.Allow(domain)
+}
+
+// verifyCaptcha checks the CAPTCHA token of a signup if CAPTCHAs are enabled, adding an error to
+// the validator if it's missing or invalid. It returns an error if the provider couldn't check it,
+// in which case the signup is rejected rather than let through.
+func (app *application) verifyCaptcha(r *http.Request, v *validator.Validator, token string) error {
+	if app.captcha == nil {
+		return nil
+	}
+
+	if token == "" {
+		v.AddError("captcha_token", validator.CodeRequired, "must be provided")
+		return nil
+	}
+
+	ok, err := app.captcha.Verify(r.Context(), token, realip.FromRequest(r))
+	if err != nil {
+		return err
+	}
+	v.Check(ok, "captcha_token", validator.CodeInvalid, "must be a solved CAPTCHA")
+	return nil
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// maxSuggestionDistance is the largest edit distance between a path and a route for the route to
+// be suggested, summed over the path's segments.
+const maxSuggestionDistance = 2
+
+// maxSuggestions is how many routes a 404 response suggests at most.
+const maxSuggestions = 3
+
+// routeSuggester suggests the routes whose pattern is a near miss of a path that matched none.
+type routeSuggester struct {
+	patterns [][]string // the segments of each route's pattern
+}
+
+// newRouteSuggester returns a suggester of the API routes. The debug routes and the catch-all
+// patterns are left out.
+func newRouteSuggester(routes []registeredRoute) *routeSuggester {
+	s := &routeSuggester{}
+	seen := make(map[string]bool)
+	for _, route := range routes {
+		if route.Group == "debug" || strings.Contains(route.Pattern, "*") || seen[route.Pattern] {
+			continue
+		}
+		seen[route.Pattern] = true
+		s.patterns = append(s.patterns, strings.Split(route.Pattern, "/"))
+	}
+	return s
+}
+
+// suggest returns the paths of the routes within the maximum edit distance of the path, nearest
+// first, with the path's own values in place of the patterns' parameters: for example, /v1/movie/1
+// suggests /v1/movies/1.
+func (s *routeSuggester) suggest(path string) []string {
+	segments := strings.Split(strings.TrimSuffix(path, "/"), "/")
+
+	type suggestion struct {
+		path     string
+		distance int
+	}
+	var suggestions []suggestion
+
+	for _, pattern := range s.patterns {
+		if len(pattern) != len(segments) {
+			continue
+		}
+
+		distance := 0
+		suggested := make([]string, len(pattern))
+		for i, segment := range pattern {
+			if strings.HasPrefix(segment, ":") {
+				suggested[i] = segments[i]
+				continue
+			}
+			suggested[i] = segment
+			distance += editDistance(strings.ToLower(segments[i]), segment)
+			if distance > maxSuggestionDistance {
+				break
+			}
+		}
+
+		if distance <= maxSuggestionDistance {
+			suggestions = append(suggestions, suggestion{strings.Join(suggested, "/"), distance})
+		}
+	}
+
+	sort.SliceStable(suggestions, func(i, j int) bool {
+		return suggestions[i].distance < suggestions[j].distance
+	})
+
+	paths := []string{}
+	for _, suggestion := range suggestions {
+		if len(paths) == maxSuggestions {
+			break
+		}
+		paths = append(paths, suggestion.path)
+	}
+	return paths
+}
+
+// editDistance returns the Levenshtein distance between a and b, in bytes.
+func editDistance(a, b string) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = minInt(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+
+	return previous[len(b)]
+}
+
+func minInt(values ...int) int {
+	m := values[0]
+	for _, v := range values[1:] {
+		if v < m {
+			m = v
+		}
+	}
+	return m
+}
+
+// notFoundWithSuggestions returns a handler which sends the 404 responses along with the
+// suggested routes, if any, in a "suggestions" member.
+func (app *application) notFoundWithSuggestions(suggester *routeSuggester) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		suggestions := suggester.suggest(r.URL.Path)
+		if len(suggestions) == 0 {
+			app.notFoundResponse(w, r)
+			return
+		}
+
+		message := "the requested resource could not be found"
+		app.errorResponseWithExtra(
+			w,
+			r,
+			http.StatusNotFound,
+			message,
+			envelope{"suggestions": suggestions},
+		)
+	}
+}
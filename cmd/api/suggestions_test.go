@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRouteSuggester(t *testing.T) {
+	suggester := newRouteSuggester([]registeredRoute{
+		{Method: http.MethodGet, Pattern: "/v1/movies", Group: apiV1},
+		{Method: http.MethodPost, Pattern: "/v1/movies", Group: apiV1},
+		{Method: http.MethodGet, Pattern: "/v1/movies/:id", Group: apiV1},
+		{Method: http.MethodGet, Pattern: "/v1/users/me/searches/:id", Group: apiV1},
+		{Method: http.MethodGet, Pattern: "/debug/vars", Group: "debug"},
+		{Method: http.MethodGet, Pattern: "/debug/pprof/*item", Group: "debug"},
+	})
+
+	tests := map[string][]string{
+		"/v1/movie/1":                {"/v1/movies/1"},
+		"/v1/Movies/":                {"/v1/movies"},
+		"/v1/user/me/searches/3":     {"/v1/users/me/searches/3"},
+		"/v1/user/me/search/3":       {},
+		"/v3/movies":                 {"/v1/movies"},
+		"/v1/films/1":                {},
+		"/debug/var":                 {},
+		"/v1/movies/1/cast/and/crew": {},
+	}
+	for path, want := range tests {
+		assert.Equal(t, want, suggester.suggest(path), path)
+	}
+}
+
+func TestEditDistance(t *testing.T) {
+	assert.Equal(t, 0, editDistance("movies", "movies"))
+	assert.Equal(t, 1, editDistance("movie", "movies"))
+	assert.Equal(t, 2, editDistance("moveis", "movies"))
+	assert.Equal(t, 3, editDistance("kitten", "sitting"))
+	assert.Equal(t, 6, editDistance("", "movies"))
+}
+
+func TestNotFoundWithSuggestions(t *testing.T) {
+	app := &application{}
+	app.config.routeSuggestions = true
+	router := app.newRouter()
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/v1/movie/1", nil))
+	require.Equal(t, http.StatusNotFound, rr.Code)
+
+	var body struct {
+		Error       string   `json:"error"`
+		Suggestions []string `json:"suggestions"`
+	}
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &body))
+	assert.Equal(t, "the requested resource could not be found", body.Error)
+	assert.Contains(t, body.Suggestions, "/v1/movies/1")
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/walkccc/greenlight/internal/data"
+	"golang.org/x/time/rate"
+)
+
+// tenantLimitsTTL is how long the organizations' limits are cached for, i.e. how long a change to
+// an organization's limits can take to apply.
+const tenantLimitsTTL = time.Minute
+
+// tenantUsageFlushInterval is how often the requests counted in memory are added to the
+// organizations' usage, i.e. how far behind the usage and the daily quotas can be.
+const tenantUsageFlushInterval = 5 * time.Second
+
+// tenantLimiters caches each organization's limits, along with the token-bucket limiter enforcing
+// its requests per second. There are far fewer organizations than client IP addresses, so unlike
+// the ratelimit.Store the cache isn't bounded.
+//
+// It also counts the organizations' requests in memory, and flush() adds them to the database in
+// a batch, rather than every request writing the usage row.
+type tenantLimiters struct {
+	mtx     sync.Mutex
+	tenants map[int64]*tenant
+	usage   map[usageKey]*usage
+}
+
+// usageKey identifies an organization's usage for a UTC day, given as YYYY-MM-DD.
+type usageKey struct {
+	organizationID int64
+	day            string
+}
+
+type usage struct {
+	flushed int64 // the day's requests in the database as of the last flush
+	pending int64 // the requests counted since, which haven't been flushed yet
+}
+
+type tenant struct {
+	limits    data.OrganizationLimits
+	limiter   *rate.Limiter // nil if the organization has no requests per second limit
+	fetchedAt time.Time
+}
+
+func newTenantLimiters() *tenantLimiters {
+	return &tenantLimiters{
+		tenants: make(map[int64]*tenant),
+		usage:   make(map[usageKey]*usage),
+	}
+}
+
+// get returns the organization's cached limits and limiter, calling fetch to load the limits if
+// they aren't cached or have expired. The limiter is kept across refreshes, so that reloading the
+// limits doesn't hand out a fresh burst.
+func (tl *tenantLimiters) get(
+	ctx context.Context,
+	organizationID int64,
+	fetch func(ctx context.Context, organizationID int64) (*data.OrganizationLimits, error),
+) (data.OrganizationLimits, *rate.Limiter, error) {
+	tl.mtx.Lock()
+	t, found := tl.tenants[organizationID]
+	if found && time.Since(t.fetchedAt) < tenantLimitsTTL {
+		limits, limiter := t.limits, t.limiter
+		tl.mtx.Unlock()
+		return limits, limiter, nil
+	}
+	tl.mtx.Unlock()
+
+	// Fetch the limits without holding the mutex, so that a slow query doesn't hold up the
+	// requests of every other organization.
+	limits, err := fetch(ctx, organizationID)
+	if err != nil {
+		return data.OrganizationLimits{}, nil, err
+	}
+
+	tl.mtx.Lock()
+	defer tl.mtx.Unlock()
+
+	t, found = tl.tenants[organizationID]
+	if !found {
+		t = &tenant{}
+		tl.tenants[organizationID] = t
+	}
+	t.limits = *limits
+	t.fetchedAt = time.Now()
+
+	switch {
+	case limits.RequestsPerSecond == 0:
+		t.limiter = nil
+	case t.limiter == nil:
+		t.limiter = rate.NewLimiter(rate.Limit(limits.RequestsPerSecond), limits.Burst)
+	default:
+		t.limiter.SetLimit(rate.Limit(limits.RequestsPerSecond))
+		t.limiter.SetBurst(limits.Burst)
+	}
+
+	return t.limits, t.limiter, nil
+}
+
+// invalidate expires the organization's cached limits, e.g. after they have been changed, so that
+// the next request reloads them.
+func (tl *tenantLimiters) invalidate(organizationID int64) {
+	tl.mtx.Lock()
+	defer tl.mtx.Unlock()
+
+	if t, found := tl.tenants[organizationID]; found {
+		t.fetchedAt = time.Time{}
+	}
+}
+
+// count counts a request against the organization's usage for the UTC day of now, and returns the
+// estimated number of requests made that day so far. The estimate misses the requests counted
+// since the last flush by the other instances, and until the first flush of the day, those made
+// before this instance started.
+func (tl *tenantLimiters) count(organizationID int64, now time.Time) int64 {
+	tl.mtx.Lock()
+	defer tl.mtx.Unlock()
+
+	key := usageKey{organizationID: organizationID, day: now.UTC().Format(time.DateOnly)}
+	u, found := tl.usage[key]
+	if !found {
+		u = &usage{}
+		tl.usage[key] = u
+	}
+	u.pending++
+	return u.flushed + u.pending
+}
+
+// pending returns the organization's requests for the UTC day that haven't been flushed yet.
+func (tl *tenantLimiters) pending(organizationID int64, day string) int64 {
+	tl.mtx.Lock()
+	defer tl.mtx.Unlock()
+
+	if u, found := tl.usage[usageKey{organizationID: organizationID, day: day}]; found {
+		return u.pending
+	}
+	return 0
+}
+
+// flush adds the pending requests to the organizations' usage with add, which returns the day's
+// total. The requests that fail to be added stay pending until the next flush. The usage of the
+// past days is forgotten once it's flushed.
+func (tl *tenantLimiters) flush(
+	ctx context.Context,
+	add func(ctx context.Context, organizationID int64, day string, n int64) (int64, error),
+) error {
+	tl.mtx.Lock()
+	batch := make(map[usageKey]int64)
+	for key, u := range tl.usage {
+		if u.pending > 0 {
+			batch[key] = u.pending
+			u.pending = 0
+		}
+	}
+	tl.mtx.Unlock()
+
+	// The requests are added without holding the mutex, so that counting the requests doesn't
+	// wait for the database.
+	var errs []error
+	totals := make(map[usageKey]int64, len(batch))
+	for key, n := range batch {
+		total, err := add(ctx, key.organizationID, key.day, n)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		totals[key] = total
+	}
+
+	tl.mtx.Lock()
+	defer tl.mtx.Unlock()
+
+	today := time.Now().UTC().Format(time.DateOnly)
+	for key, n := range batch {
+		u := tl.usage[key]
+		if total, ok := totals[key]; ok {
+			u.flushed = total
+		} else {
+			u.pending += n
+		}
+	}
+	for key, u := range tl.usage {
+		if key.day != today && u.pending == 0 {
+			delete(tl.usage, key)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// startUsageFlusher starts the goroutine that flushes the organizations' requests every
+// tenantUsageFlushInterval. A shutdown hook stops it, after a last flush.
+func (app *application) startUsageFlusher() {
+	stop := make(chan struct{})
+	done := make(chan struct{})
+
+	app.onShutdown("usage flusher", func(ctx context.Context) error {
+		close(stop)
+		select {
+		case <-done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		return app.tenants.flush(ctx, app.models.Organizations.AddRequests)
+	})
+
+	go func() {
+		defer close(done)
+
+		ticker := time.NewTicker(tenantUsageFlushInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+			case <-stop:
+				return
+			}
+
+			err := app.tenants.flush(context.Background(), app.models.Organizations.AddRequests)
+			if err != nil {
+				app.logger.PrintError(err, nil)
+			}
+		}
+	}()
+}
+
+// untilNextUTCDay returns the time left until the daily quotas reset at midnight UTC.
+func untilNextUTCDay(now time.Time) time.Duration {
+	now = now.UTC()
+	tomorrow := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.UTC)
+	return tomorrow.Sub(now)
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/walkccc/greenlight/internal/data"
+	"github.com/walkccc/greenlight/internal/jsonlog"
+)
+
+// stubLimitsModel returns the limits it holds, or err, and panics on the other methods.
+type stubLimitsModel struct {
+	data.OrganizationModelInterface
+	limits data.OrganizationLimits
+	err    error
+}
+
+func (m stubLimitsModel) GetLimits(
+	ctx context.Context,
+	organizationID int64,
+) (*data.OrganizationLimits, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	limits := m.limits
+	return &limits, nil
+}
+
+func TestTenantLimiters_CountAndFlush(t *testing.T) {
+	tl := newTenantLimiters()
+	now := time.Now()
+	today := now.UTC().Format(time.DateOnly)
+
+	assert.Equal(t, int64(1), tl.count(7, now))
+	assert.Equal(t, int64(2), tl.count(7, now))
+	assert.Equal(t, int64(1), tl.count(8, now))
+
+	// Another instance made 100 requests, which the flush returns with the total.
+	added := make(map[int64]int64)
+	add := func(ctx context.Context, organizationID int64, day string, n int64) (int64, error) {
+		if day != today {
+			return n, nil
+		}
+		added[organizationID] += n
+		return added[organizationID] + 100, nil
+	}
+	require.NoError(t, tl.flush(context.Background(), add))
+	assert.Equal(t, map[int64]int64{7: 2, 8: 1}, added)
+	assert.Zero(t, tl.pending(7, today))
+
+	assert.Equal(t, int64(103), tl.count(7, now))
+	assert.Equal(t, int64(1), tl.pending(7, today))
+
+	// The requests that fail to be added are added by the next flush.
+	failing := func(ctx context.Context, organizationID int64, day string, n int64) (int64, error) {
+		return 0, errors.New("boom")
+	}
+	assert.EqualError(t, tl.flush(context.Background(), failing), "boom")
+	assert.Equal(t, int64(1), tl.pending(7, today))
+
+	require.NoError(t, tl.flush(context.Background(), add))
+	assert.Equal(t, int64(3), added[7])
+	assert.Zero(t, tl.pending(7, today))
+
+	// The usage of the past days is forgotten once it's flushed.
+	yesterday := now.Add(-24 * time.Hour)
+	tl.count(7, yesterday)
+	require.NoError(t, tl.flush(context.Background(), add))
+	assert.Len(t, tl.usage, 2)
+}
+
+func TestTenantRateLimit(t *testing.T) {
+	newApp := func(organizations data.OrganizationModelInterface) *application {
+		app := &application{
+			logger:  jsonlog.New(io.Discard, jsonlog.LevelOff),
+			models:  data.Models{Organizations: organizations},
+			tenants: newTenantLimiters(),
+		}
+		app.config.limiter.tenantsEnabled = true
+		return app
+	}
+
+	request := func(app *application) *httptest.ResponseRecorder {
+		next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNoContent)
+		})
+		r := httptest.NewRequest(http.MethodGet, "/v1/movies", nil)
+		r = app.contextSetUser(r, &data.User{ID: 1, OrganizationID: 7})
+		rr := httptest.NewRecorder()
+		app.tenantRateLimit(next).ServeHTTP(rr, r)
+		return rr
+	}
+
+	t.Run("Quota", func(t *testing.T) {
+		app := newApp(stubLimitsModel{limits: data.OrganizationLimits{DailyRequestQuota: 2}})
+
+		assert.Equal(t, http.StatusNoContent, request(app).Code)
+		assert.Equal(t, http.StatusNoContent, request(app).Code)
+
+		rr := request(app)
+		assert.Equal(t, http.StatusTooManyRequests, rr.Code)
+		assert.Contains(t, rr.Body.String(), "has used up its daily request quota")
+		assert.NotEmpty(t, rr.Header().Get("Retry-After"))
+	})
+
+	t.Run("FailsOpen", func(t *testing.T) {
+		app := newApp(stubLimitsModel{err: errors.New("connection refused")})
+
+		assert.Equal(t, http.StatusNoContent, request(app).Code)
+	})
+}
+
+// limitedMovieModel refuses to create movies, as the organization has reached its limit.
+type limitedMovieModel struct {
+	data.MovieModelInterface
+}
+
+func (m limitedMovieModel) Create(ctx context.Context, movie *data.Movie) error {
+	return &data.MovieLimitError{MaxMovies: 10}
+}
+
+func TestCreateMovieHandler_MovieLimit(t *testing.T) {
+	app := &application{models: data.Models{
+		Movies:     limitedMovieModel{},
+		Attributes: stubAttributeModel{},
+	}}
+
+	body := `{"title": "Moana", "year": 2016, "runtime": "107 mins", "genres": ["animation"]}`
+	r := httptest.NewRequest(http.MethodPost, "/v1/movies", strings.NewReader(body))
+	r = app.contextSetUser(r, &data.User{ID: 1, OrganizationID: 7})
+	rr := httptest.NewRecorder()
+	app.createMovieHandler(rr, r)
+
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+	assert.Contains(t, rr.Body.String(), "your organization has reached its limit of 10 movies")
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/walkccc/greenlight/internal/validator"
+)
+
+// Constants for the timestamp formats that clients can ask for with the timestamps query
+// parameter. The API returns RFC 3339 timestamps in UTC by default.
+const (
+	timestampsRFC3339 = "rfc3339"
+	timestampsUnix    = "unix"
+)
+
+// timestampsResponseWriter buffers a response, so that its timestamps can be rewritten before it's
+// sent to the client.
+type timestampsResponseWriter struct {
+	http.ResponseWriter
+	statusCode int
+	buf        bytes.Buffer
+}
+
+func (tw *timestampsResponseWriter) WriteHeader(statusCode int) {
+	if tw.statusCode == 0 {
+		tw.statusCode = statusCode
+	}
+}
+
+func (tw *timestampsResponseWriter) Write(b []byte) (int, error) {
+	if tw.statusCode == 0 {
+		tw.statusCode = http.StatusOK
+	}
+	return tw.buf.Write(b)
+}
+
+// timestamps lets clients (e.g. mobile apps) ask for the timestamps in JSON responses as Unix
+// epoch seconds, with ?timestamps=unix. Since the handlers always encode RFC 3339 timestamps, the
+// response is buffered and its timestamps (the string fields named "*_at" or "expiry") are
+// converted on the way out.
+func (app *application) timestamps(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		format := r.URL.Query().Get("timestamps")
+
+		switch format {
+		case "", timestampsRFC3339:
+			next.ServeHTTP(w, r)
+			return
+		case timestampsUnix:
+		default:
+			v := validator.New()
+			v.AddError(
+				"timestamps",
+				validator.CodeNotPermitted,
+				"must be one of "+timestampsRFC3339+", "+timestampsUnix,
+			)
+			app.failedValidationResponse(w, r, v)
+			return
+		}
+
+		tw := &timestampsResponseWriter{ResponseWriter: w}
+		next.ServeHTTP(tw, r)
+
+		body := tw.buf.Bytes()
+		mediaType, _, _ := mime.ParseMediaType(w.Header().Get("Content-Type"))
+		if mediaType == "application/json" || strings.HasSuffix(mediaType, "+json") {
+			if converted, err := app.unixTimestamps(body); err == nil {
+				body = converted
+				w.Header().Del("Content-Length")
+			}
+		}
+
+		if tw.statusCode != 0 {
+			w.WriteHeader(tw.statusCode)
+		}
+		w.Write(body)
+	})
+}
+
+// unixTimestamps returns the JSON document with its timestamps converted to Unix epoch seconds.
+// Note that the objects' keys come out sorted, since they're re-encoded from maps.
+func (app *application) unixTimestamps(js []byte) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(js))
+	decoder.UseNumber()
+
+	var doc any
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	if app.indentsJSON() {
+		encoder.SetIndent("", "\t")
+	}
+	if err := encoder.Encode(convertTimestamps("", doc)); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// convertTimestamps walks the decoded JSON value, replacing the RFC 3339 strings held under
+// timestamp keys with their Unix epoch seconds.
+func convertTimestamps(key string, value any) any {
+	switch value := value.(type) {
+	case map[string]any:
+		for k, v := range value {
+			value[k] = convertTimestamps(k, v)
+		}
+	case []any:
+		for i, v := range value {
+			value[i] = convertTimestamps(key, v)
+		}
+	case string:
+		if !strings.HasSuffix(key, "_at") && key != "expiry" {
+			break
+		}
+		if t, err := time.Parse(time.RFC3339Nano, value); err == nil {
+			return json.Number(strconv.FormatInt(t.Unix(), 10))
+		}
+	}
+	return value
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/walkccc/greenlight/internal/data"
+)
+
+func TestTimestamps(t *testing.T) {
+	app := &application{config: config{env: "production"}}
+	createdAt := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	handler := app.timestamps(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		movie := &data.Movie{
+			ID:        1,
+			CreatedAt: createdAt,
+			UpdatedAt: createdAt,
+			Title:     "Casablanca",
+			Year:      1942,
+			Runtime:   102,
+			Genres:    []string{"drama"},
+			Version:   1,
+		}
+		app.writeJSON(w, http.StatusCreated, envelope{"movie": movie, "starts_at": "soon"}, nil)
+	}))
+
+	tests := []struct {
+		query      string
+		statusCode int
+		body       string
+	}{
+		{
+			query:      "",
+			statusCode: http.StatusCreated,
+			body: `{"movie": {"id": 1, "created_at": "2022-01-01T00:00:00Z",
+				"updated_at": "2022-01-01T00:00:00Z", "title": "Casablanca", "year": 1942,
+				"runtime": "102 mins", "genres": ["drama"], "attributes": {}, "version": 1},
+				"starts_at": "soon"}`,
+		},
+		{
+			query:      "?timestamps=unix",
+			statusCode: http.StatusCreated,
+			body: `{"movie": {"id": 1, "created_at": 1640995200, "updated_at": 1640995200,
+				"title": "Casablanca", "year": 1942, "runtime": "102 mins", "genres": ["drama"],
+				"attributes": {}, "version": 1}, "starts_at": "soon"}`,
+		},
+		{
+			query:      "?timestamps=epoch",
+			statusCode: http.StatusUnprocessableEntity,
+			body: `{"error": {"timestamps": "must be one of rfc3339, unix"},
+				"error_codes": {"timestamps": "timestamps.not_permitted"}}`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.query, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/"+test.query, nil))
+
+			assert.Equal(t, test.statusCode, rr.Code)
+			assert.JSONEq(t, test.body, rr.Body.String())
+		})
+	}
+}
@@ -2,20 +2,23 @@ package main
 
 import (
 	"errors"
+	"fmt"
 	"net/http"
 	"time"
 
 	"github.com/walkccc/greenlight/internal/data"
+	"github.com/walkccc/greenlight/internal/dto"
 	"github.com/walkccc/greenlight/internal/validator"
 )
 
+// maxTokenTTL is the longest that the tokens can be configured to be valid for.
+const maxTokenTTL = 30 * 24 * time.Hour
+
 // createAuthenticationTokenHandler exchanges the user's email address and password for an
-// authentication token.
+// authentication token. The token is scoped to the organization given by organization_id, or to
+// the oldest organization the user belongs to if it's omitted.
 func (app *application) createAuthenticationTokenHandler(w http.ResponseWriter, r *http.Request) {
-	var input struct {
-		Email    string `json:"email"`
-		Password string `json:"password"`
-	}
+	var input dto.CreateAuthenticationTokenRequest
 
 	err := app.readJSON(w, r, &input)
 	if err != nil {
@@ -25,15 +28,12 @@ func (app *application) createAuthenticationTokenHandler(w http.ResponseWriter,
 
 	v := validator.New()
 
-	data.ValidateEmail(v, input.Email)
-	data.ValidatePasswordPlaintext(v, input.Password)
-
-	if !v.Valid() {
-		app.failedValidationResponse(w, r, v.Errors)
+	if v.Struct(input); !v.Valid() {
+		app.failedValidationResponse(w, r, v)
 		return
 	}
 
-	user, err := app.models.Users.GetByEmail(input.Email)
+	user, err := app.models.Users.GetByEmail(r.Context(), input.Email)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
@@ -55,12 +55,50 @@ func (app *application) createAuthenticationTokenHandler(w http.ResponseWriter,
 		return
 	}
 
-	token, err := app.models.Tokens.New(user.ID, 24*time.Hour, data.ScopeAuthentication)
+	organizations, err := app.models.Organizations.GetAllForUser(r.Context(), user.ID)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
 
+	// A user who doesn't belong to any organization still gets a token, which they can use to
+	// access the resources that aren't scoped to an organization.
+	var organizationID int64
+	for _, organization := range organizations {
+		if input.OrganizationID == 0 || input.OrganizationID == organization.ID {
+			organizationID = organization.ID
+			break
+		}
+	}
+
+	if input.OrganizationID != 0 && organizationID == 0 {
+		v.AddError(
+			"organization_id",
+			validator.CodeNotPermitted,
+			"you are not a member of this organization",
+		)
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	token, err := app.models.Tokens.NewForOrganization(
+		r.Context(),
+		user.ID,
+		organizationID,
+		app.config.tokens.authenticationTTL,
+		data.ScopeAuthentication,
+	)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.sendSecurityAlert(user.ID, fmt.Sprintf(
+		"%s: new sign-in to your account at %s. If this wasn't you, please contact support.",
+		app.config.smtp.brand,
+		time.Now().UTC().Format("2006-01-02 15:04 MST"),
+	))
+
 	err = app.writeJSON(w, http.StatusCreated, envelope{"authentication_token": token}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
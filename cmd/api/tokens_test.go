@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/walkccc/greenlight/internal/data"
+)
+
+// stubCredentialsUserModel finds its user by email, and panics on the other methods.
+type stubCredentialsUserModel struct {
+	data.UserModelInterface
+	user *data.User
+}
+
+func (m stubCredentialsUserModel) GetByEmail(
+	ctx context.Context,
+	email string,
+) (*data.User, error) {
+	if email != m.user.Email {
+		return nil, data.ErrRecordNotFound
+	}
+	return m.user, nil
+}
+
+// stubMembershipModel holds the organizations of each user.
+type stubMembershipModel struct {
+	data.OrganizationModelInterface
+	organizations map[int64][]*data.Organization
+}
+
+func (m stubMembershipModel) GetAllForUser(
+	ctx context.Context,
+	userID int64,
+) ([]*data.Organization, error) {
+	return m.organizations[userID], nil
+}
+
+// stubIssuingTokenModel records the organization of the last token it issued.
+type stubIssuingTokenModel struct {
+	data.TokenModelInterface
+	organizationID *int64
+}
+
+func (m stubIssuingTokenModel) NewForOrganization(
+	ctx context.Context,
+	userID int64,
+	organizationID int64,
+	ttl time.Duration,
+	scope string,
+) (*data.Token, error) {
+	*m.organizationID = organizationID
+	return &data.Token{Plaintext: "Y3QMGX3PJ3WLRL2YRTQGQ6KRHU", OrganizationID: organizationID}, nil
+}
+
+func TestCreateAuthenticationTokenHandler_Organizations(t *testing.T) {
+	user := &data.User{ID: 1, Email: "alice@example.com"}
+	require.NoError(t, user.Password.Set("pa55word"))
+
+	var issuedFor int64
+	app := &application{models: data.Models{
+		Users: stubCredentialsUserModel{user: user},
+		Organizations: stubMembershipModel{organizations: map[int64][]*data.Organization{
+			1: {{ID: 3}, {ID: 7}},
+		}},
+		Tokens: stubIssuingTokenModel{organizationID: &issuedFor},
+	}}
+
+	request := func(body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(
+			http.MethodPost,
+			"/v1/tokens/authentication",
+			strings.NewReader(body),
+		)
+		rr := httptest.NewRecorder()
+		app.createAuthenticationTokenHandler(rr, r)
+		return rr
+	}
+
+	// Without an organization, the token is scoped to the oldest one the user belongs to.
+	rr := request(`{"email": "alice@example.com", "password": "pa55word"}`)
+	assert.Equal(t, http.StatusCreated, rr.Code, rr.Body.String())
+	assert.Equal(t, int64(3), issuedFor)
+
+	rr = request(`{"email": "alice@example.com", "password": "pa55word", "organization_id": 7}`)
+	assert.Equal(t, http.StatusCreated, rr.Code, rr.Body.String())
+	assert.Equal(t, int64(7), issuedFor)
+
+	// Another tenant's organization is refused, and no token is issued for it.
+	issuedFor = 0
+	rr = request(`{"email": "alice@example.com", "password": "pa55word", "organization_id": 9}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+	assert.Contains(t, rr.Body.String(), "you are not a member of this organization")
+	assert.Zero(t, issuedFor)
+}
+
+func TestRequireOrganization(t *testing.T) {
+	app := &application{}
+	next := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusNoContent) }
+
+	request := func(user *data.User) int {
+		r := httptest.NewRequest(http.MethodGet, "/v1/movies", nil)
+		r = app.contextSetUser(r, user)
+		rr := httptest.NewRecorder()
+		app.requireOrganization(next)(rr, r)
+		return rr.Code
+	}
+
+	assert.Equal(t, http.StatusNoContent, request(&data.User{ID: 1, OrganizationID: 7}))
+	assert.Equal(t, http.StatusForbidden, request(&data.User{ID: 1}))
+}
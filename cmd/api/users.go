@@ -1,20 +1,23 @@
 package main
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"html"
 	"net/http"
+	"net/url"
+	"strconv"
 	"time"
 
+	"github.com/tomasen/realip"
 	"github.com/walkccc/greenlight/internal/data"
+	"github.com/walkccc/greenlight/internal/dto"
 	"github.com/walkccc/greenlight/internal/validator"
 )
 
 func (app *application) createUserHandler(w http.ResponseWriter, r *http.Request) {
-	var input struct {
-		Name     string `json:"name"`
-		Email    string `json:"email"`
-		Password string `json:"password"`
-	}
+	var input dto.CreateUserRequest
 
 	err := app.readJSON(w, r, &input)
 	if err != nil {
@@ -22,6 +25,30 @@ func (app *application) createUserHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	// Every attempt counts towards the client's signup limit, including the invalid ones, which
+	// the bots make plenty of.
+	if !app.signups.allowIP(realip.FromRequest(r)) {
+		app.rateLimitExceededResponse(w, r)
+		return
+	}
+
+	v := validator.New()
+
+	if v.Struct(input); !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	err = app.verifyCaptcha(r, v, input.CaptchaToken)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
 	user := &data.User{
 		Name:      input.Name,
 		Email:     input.Email,
@@ -34,41 +61,71 @@ func (app *application) createUserHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	v := validator.New()
+	data.ValidateUser(v, user)
+	app.validateEmailDomain(r.Context(), v, user.Email)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
 
-	if data.ValidateUser(v, user); !v.Valid() {
-		app.failedValidationResponse(w, r, v.Errors)
+	if !app.signups.allowDomain(validator.EmailDomain(user.Email)) {
+		app.rateLimitExceededResponse(w, r)
 		return
 	}
 
-	err = app.models.Users.Create(user)
+	err = app.models.Users.Create(r.Context(), user)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrDuplicateEmail):
-			v.AddError("email", "a user with this email address already exists")
-			app.failedValidationResponse(w, r, v.Errors)
+			v.AddError(
+				"email",
+				validator.CodeAlreadyExists,
+				"a user with this email address already exists",
+			)
+			app.failedValidationResponse(w, r, v)
 		default:
 			app.serverErrorResponse(w, r, err)
 		}
 		return
 	}
 
-	err = app.models.Permissions.AddForUser(user.ID, "movies:read")
+	err = app.models.Permissions.AddForUser(r.Context(), user.ID, "movies:read")
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
 
-	token, err := app.models.Tokens.New(user.ID, 3*24*time.Hour, data.ScopeActivation)
+	err = app.models.Organizations.SetMember(
+		r.Context(),
+		data.DefaultOrganizationID,
+		user.ID,
+		data.RoleMember,
+	)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
 
+	token, err := app.models.Tokens.New(
+		r.Context(),
+		user.ID,
+		app.config.tokens.activationTTL,
+		data.ScopeActivation,
+	)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	activationURL := app.feedBaseURL(r) + app.link(r, http.MethodGet, "/users/activate").Href +
+		"?token=" + url.QueryEscape(token.Plaintext)
+
 	app.background(func() {
 		data := map[string]any{
-			"activationToken": token.Plaintext,
-			"userID":          user.ID,
+			"activationToken":  token.Plaintext,
+			"activationURL":    activationURL,
+			"activationExpiry": token.Expiry.Format(time.RFC1123),
+			"userID":           user.ID,
 		}
 
 		err = app.mailer.Send(user.Email, "user_welcome.tmpl", data)
@@ -78,16 +135,14 @@ func (app *application) createUserHandler(w http.ResponseWriter, r *http.Request
 		}
 	})
 
-	err = app.writeJSON(w, http.StatusAccepted, envelope{"user": user}, nil)
+	err = app.writeUser(w, r, http.StatusAccepted, user)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
 }
 
 func (app *application) activateUserHandler(w http.ResponseWriter, r *http.Request) {
-	var input struct {
-		TokenPlaintext string `json:"token"`
-	}
+	var input dto.ActivateUserRequest
 
 	err := app.readJSON(w, r, &input)
 	if err != nil {
@@ -97,44 +152,173 @@ func (app *application) activateUserHandler(w http.ResponseWriter, r *http.Reque
 
 	v := validator.New()
 
-	if data.ValidateTokenPlaintext(v, input.TokenPlaintext); !v.Valid() {
-		app.failedValidationResponse(w, r, v.Errors)
+	if v.Struct(input); !v.Valid() {
+		app.failedValidationResponse(w, r, v)
 		return
 	}
 
-	user, err := app.models.Users.GetForToken(data.ScopeActivation, input.TokenPlaintext)
+	if data.ValidateTokenPlaintext(v, input.Token); !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	user, err := app.activateUser(r.Context(), input.Token)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
-			v.AddError("token", "invalid or expired activation token")
-			app.failedValidationResponse(w, r, v.Errors)
+			v.AddError("token", validator.CodeInvalid, "invalid or expired activation token")
+			app.failedValidationResponse(w, r, v)
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
 		default:
 			app.serverErrorResponse(w, r, err)
 		}
 		return
 	}
 
+	err = app.writeUser(w, r, http.StatusOK, user)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// activateUser activates the user that the activation token was issued to, and deletes their
+// activation tokens. It returns data.ErrRecordNotFound if the token is invalid or expired.
+func (app *application) activateUser(ctx context.Context, token string) (*data.User, error) {
+	user, err := app.models.Users.GetForToken(ctx, data.ScopeActivation, token)
+	if err != nil {
+		return nil, err
+	}
+
 	user.Activated = true
 
-	err = app.models.Users.Update(user)
+	err = app.models.Users.Update(ctx, user)
 	if err != nil {
+		return nil, err
+	}
+
+	err = app.models.Tokens.DeleteAllForUser(ctx, data.ScopeActivation, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// activateUserLinkHandler handles requests for "GET /v1/users/activate", which the link in the
+// welcome email points to. Since it's opened in a browser, it redirects to the frontend if
+// there's one (with an error parameter if the token is invalid), or renders a minimal page.
+func (app *application) activateUserLinkHandler(w http.ResponseWriter, r *http.Request) {
+	var input dto.ActivateUserQuery
+
+	v := validator.New()
+	app.readQuery(r.URL.Query(), &input, v)
+	data.ValidateTokenPlaintext(v, input.Token)
+
+	if v.Valid() {
+		_, err := app.activateUser(r.Context(), input.Token)
 		switch {
-		case errors.Is(err, data.ErrEditConflict):
-			app.editConflictResponse(w, r)
-		default:
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("token", validator.CodeInvalid, "invalid or expired activation token")
+		case err != nil:
 			app.serverErrorResponse(w, r, err)
+			return
 		}
-		return
 	}
 
-	err = app.models.Tokens.DeleteAllForUser(data.ScopeActivation, user.ID)
-	if err != nil {
-		app.serverErrorResponse(w, r, err)
+	if app.config.activation.redirectURL != "" {
+		target, err := url.Parse(app.config.activation.redirectURL)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		if !v.Valid() {
+			query := target.Query()
+			query.Set("error", "invalid_token")
+			target.RawQuery = query.Encode()
+		}
+
+		http.Redirect(w, r, target.String(), http.StatusSeeOther)
 		return
 	}
 
-	err = app.writeJSON(w, http.StatusOK, envelope{"user": user}, nil)
+	status, message := http.StatusOK, "Your account has been activated. You can close this page."
+	if !v.Valid() {
+		status, message = http.StatusBadRequest, "This activation link is invalid or has expired."
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	fmt.Fprintf(w, activationPage, html.EscapeString(message))
+}
+
+// activationPage is the page that activateUserLinkHandler renders when there's no frontend to
+// redirect to.
+const activationPage = `<!DOCTYPE html>
+<html>
+  <head>
+    <meta name="viewport" content="width=device-width" />
+    <title>Greenlight</title>
+  </head>
+  <body>
+    <p>%s</p>
+  </body>
+</html>
+`
+
+// writeUser sends a user, either as a JSON:API document or in the user envelope.
+func (app *application) writeUser(
+	w http.ResponseWriter,
+	r *http.Request,
+	statusCode int,
+	user *data.User,
+) error {
+	w.Header().Add("Vary", "Accept")
+	app.addUserLinks(r, user)
+
+	if !app.acceptsJSONAPI(r) {
+		return app.writeJSON(w, statusCode, envelope{"user": user}, nil)
+	}
+
+	resource, err := newJSONAPIResource("users", user.ID, user.Links, user)
 	if err != nil {
-		app.serverErrorResponse(w, r, err)
+		return err
+	}
+
+	// The user's links are all actions, so pass them on as the document's meta instead.
+	return app.writeJSONAPI(
+		w,
+		statusCode,
+		envelope{"data": resource, "meta": envelope{"links": user.Links}},
+		nil,
+	)
+}
+
+// encryptEmails encrypts the users' emails that are still in plaintext, or encrypted with an older
+// key, in batches until a batch comes back short. If the emails are being decrypted, it decrypts
+// the encrypted ones instead.
+func (app *application) encryptEmails() {
+	const batchSize = 500
+	var total int
+
+	for {
+		rewritten, err := app.models.Users.EncryptEmails(context.Background(), batchSize)
+		if err != nil {
+			app.logger.PrintError(err, nil)
+			return
+		}
+		total += rewritten
+
+		if rewritten < batchSize {
+			break
+		}
+	}
+
+	if total > 0 {
+		app.logger.PrintInfo("rewrote the users' emails", map[string]string{
+			"users":   strconv.Itoa(total),
+			"decrypt": strconv.FormatBool(app.config.email.decrypt),
+		})
 	}
 }
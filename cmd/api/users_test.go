@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/walkccc/greenlight/internal/data"
+)
+
+// stubUserModel returns a user for the valid activation token, and panics on the other methods.
+type stubUserModel struct {
+	data.UserModelInterface
+	token string
+}
+
+func (m stubUserModel) GetForToken(ctx context.Context, scope, token string) (*data.User, error) {
+	if token != m.token {
+		return nil, data.ErrRecordNotFound
+	}
+	return &data.User{ID: 1}, nil
+}
+
+func (m stubUserModel) Update(ctx context.Context, user *data.User) error {
+	return nil
+}
+
+type stubTokenModel struct {
+	data.TokenModelInterface
+}
+
+func (m stubTokenModel) DeleteAllForUser(ctx context.Context, scope string, userID int64) error {
+	return nil
+}
+
+func TestActivateUserLinkHandler(t *testing.T) {
+	const token = "Y3QMGX3PJ3WLRL2YRTQGQ6KRHU"
+
+	app := &application{models: data.Models{
+		Users:  stubUserModel{token: token},
+		Tokens: stubTokenModel{},
+	}}
+
+	request := func(token string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/v1/users/activate?token="+token, nil)
+		rr := httptest.NewRecorder()
+		app.activateUserLinkHandler(rr, r)
+		return rr
+	}
+
+	// Without a frontend, a minimal page is rendered.
+	rr := request(token)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), "Your account has been activated")
+
+	rr = request("ABCDEFGHIJKLMNOPQRSTUVWXYZ")
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Contains(t, rr.Body.String(), "invalid or has expired")
+
+	// With a frontend, the link redirects to it, with an error if the token is invalid.
+	app.config.activation.redirectURL = "https://app.example.com/activated?lang=en"
+
+	rr = request(token)
+	assert.Equal(t, http.StatusSeeOther, rr.Code)
+	assert.Equal(t, "https://app.example.com/activated?lang=en", rr.Header().Get("Location"))
+
+	rr = request("short")
+	assert.Equal(t, http.StatusSeeOther, rr.Code)
+	assert.Equal(
+		t,
+		"https://app.example.com/activated?error=invalid_token&lang=en",
+		rr.Header().Get("Location"),
+	)
+}
+
+type stubVerifier struct {
+	solved string
+}
+
+func (v stubVerifier) Verify(ctx context.Context, token, remoteIP string) (bool, error) {
+	return token == v.solved, nil
+}
+
+func TestCreateUserHandlerAbuseProtection(t *testing.T) {
+	app := &application{
+		captcha: stubVerifier{solved: "solved"},
+		signups: newSignupLimiter(2, 0),
+	}
+
+	request := func(body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/v1/users", strings.NewReader(body))
+		r.RemoteAddr = "203.0.113.7:4321"
+		rr := httptest.NewRecorder()
+		app.createUserHandler(rr, r)
+		return rr
+	}
+
+	rr := request(`{"name": "Bot", "email": "bot@example.com", "password": "pa55word"}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+	assert.Contains(t, rr.Body.String(), `"captcha_token.required"`)
+
+	body := `{"name": "Bot", "email": "bot@example.com", "password": "pa55word", ` +
+		`"captcha_token": "forged"}`
+	rr = request(body)
+	assert.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+	assert.Contains(t, rr.Body.String(), `"captcha_token.invalid"`)
+
+	// The IP address has used up its signups, whether they succeeded or not.
+	rr = request(body)
+	assert.Equal(t, http.StatusTooManyRequests, rr.Code)
+
+	limiter := newSignupLimiter(0, 1)
+	assert.True(t, limiter.allowIP("203.0.113.7"))
+	assert.True(t, limiter.allowDomain("example.com"))
+	assert.False(t, limiter.allowDomain("example.com"))
+	assert.True(t, limiter.allowDomain("example.org"))
+	assert.Nil(t, newSignupLimiter(0, 0))
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/walkccc/greenlight/internal/reqctx"
+)
+
+// Constants for the API versions. The versions share their handlers until one of them needs to
+// change in a way that would break existing clients.
+const (
+	apiV1 = "v1"
+	apiV2 = "v2"
+)
+
+var apiVersionContextKey = reqctx.NewKey[string]("api_version")
+
+// deprecationSchedule holds when an API version is deprecated and when it will be removed. A zero
+// time means that date hasn't been announced yet.
+type deprecationSchedule struct {
+	deprecation time.Time
+	sunset      time.Time
+	link        string // documentation about the deprecation, e.g. a migration guide
+}
+
+// parseScheduleDate parses a date for the deprecation schedule, given either as a plain date
+// (e.g. 2026-12-31, taken as midnight UTC) or as an RFC 3339 timestamp.
+func parseScheduleDate(val string) (time.Time, error) {
+	if t, err := time.Parse(time.DateOnly, val); err == nil {
+		return t, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, val)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date %q: must be YYYY-MM-DD or RFC 3339", val)
+	}
+	return t, nil
+}
+
+// contextSetAPIVersion returns a new copy of the request with the API version added to the
+// context.
+func (app *application) contextSetAPIVersion(r *http.Request, version string) *http.Request {
+	return r.WithContext(apiVersionContextKey.Set(r.Context(), version))
+}
+
+// contextGetAPIVersion retrieves the API version the request was made against, e.g. to build the
+// URLs in the response. It defaults to v1 for requests that aren't versioned.
+func (app *application) contextGetAPIVersion(r *http.Request) string {
+	version, ok := apiVersionContextKey.Get(r.Context())
+	if !ok {
+		return apiV1
+	}
+	return version
+}
+
+// versioned wraps a route's handler so that it records the API version on the request and, if the
+// version has a deprecation schedule, sends the Deprecation and Sunset headers (RFC 9745 and RFC
+// 8594) announcing it.
+func (app *application) versioned(version string, next http.HandlerFunc) http.HandlerFunc {
+	schedule, deprecated := app.config.deprecations[version]
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		if deprecated {
+			if !schedule.deprecation.IsZero() {
+				w.Header().Set("Deprecation", fmt.Sprintf("@%d", schedule.deprecation.Unix()))
+			}
+			if !schedule.sunset.IsZero() {
+				w.Header().Set("Sunset", schedule.sunset.UTC().Format(http.TimeFormat))
+			}
+			if schedule.link != "" {
+				w.Header().Add("Link", fmt.Sprintf(`<%s>; rel="deprecation"`, schedule.link))
+			}
+		}
+
+		next(w, app.contextSetAPIVersion(r, version))
+	}
+}
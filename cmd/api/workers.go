@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// workerPool runs the queued jobs with a fixed number of workers, so that a burst of them doesn't
+// hold the requests that enqueue them open, or run unbounded, e.g. the catalog updates.
+type workerPool[J any] struct {
+	jobs chan J
+}
+
+// startWorkerPool starts the pool's workers, which run each job with run. A shutdown hook stops
+// them once they've run the jobs left in the queue; the server has stopped accepting requests by
+// then, so no more jobs are enqueued. A panicking job is logged, and doesn't take its worker down.
+func startWorkerPool[J any](
+	app *application,
+	name string,
+	workers, queueSize int,
+	run func(job J),
+) *workerPool[J] {
+	pool := &workerPool[J]{jobs: make(chan J, queueSize)}
+
+	runJob := func(job J) {
+		defer func() {
+			if err := recover(); err != nil {
+				app.logger.PrintError(fmt.Errorf("%s", err), map[string]string{"pool": name})
+			}
+		}()
+		run(job)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range pool.jobs {
+				runJob(job)
+			}
+		}()
+	}
+
+	done := make(chan struct{})
+	app.onShutdown(name, func(ctx context.Context) error {
+		close(pool.jobs)
+		go func() {
+			wg.Wait()
+			close(done)
+		}()
+		select {
+		case <-done:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+
+	return pool
+}
+
+// enqueue queues the job, unless the queue is full.
+func (p *workerPool[J]) enqueue(job J) bool {
+	select {
+	case p.jobs <- job:
+		return true
+	default:
+		return false
+	}
+}
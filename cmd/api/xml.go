@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"mime"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/walkccc/greenlight/internal/data"
+	"github.com/walkccc/greenlight/internal/validator"
+)
+
+// The XML forms of the envelopes, for the integrators that can only consume XML. Like the JSON
+// envelopes, their root element is a response holding the envelope's keys. For example:
+//
+//	<response>
+//		<movies>
+//			<movie><id>1</id><title>Casablanca</title>...</movie>
+//		</movies>
+//		<metadata><current_page>1</current_page>...</metadata>
+//	</response>
+type (
+	xmlMovieEnvelope struct {
+		XMLName       xml.Name    `xml:"response"`
+		Movie         *data.Movie `xml:"movie"`
+		ChangedFields []string    `xml:"changed_fields>field,omitempty"`
+	}
+
+	xmlMoviesEnvelope struct {
+		XMLName  xml.Name          `xml:"response"`
+		Movies   []*data.Movie     `xml:"movies>movie"`
+		Metadata data.Metadata     `xml:"metadata"`
+		Facets   *data.MovieFacets `xml:"facets,omitempty"`
+	}
+
+	xmlErrorEnvelope struct {
+		XMLName xml.Name   `xml:"response"`
+		Errors  []xmlError `xml:"error"`
+	}
+)
+
+// xmlError is an error element. Failed validations have an error per field, e.g.
+// <error field="title" code="title.required">must be provided</error>.
+type xmlError struct {
+	Field   string `xml:"field,attr,omitempty"`
+	Code    string `xml:"code,attr,omitempty"`
+	Message string `xml:",chardata"`
+}
+
+// acceptsXML reports whether the client asked for XML.
+func (app *application) acceptsXML(r *http.Request) bool {
+	for _, mediaRange := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, _, err := mime.ParseMediaType(mediaRange)
+		if err == nil && (mediaType == "application/xml" || mediaType == "text/xml") {
+			return true
+		}
+	}
+	return false
+}
+
+// writeXML is like writeJSON(), but encodes an XML envelope.
+func (app *application) writeXML(
+	w http.ResponseWriter,
+	statusCode int,
+	data any,
+	headers http.Header,
+) error {
+	buf := bufferPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	defer func() {
+		if buf.Cap() <= maxPooledBufferSize {
+			bufferPool.Put(buf)
+		}
+	}()
+
+	buf.WriteString(xml.Header)
+
+	encoder := xml.NewEncoder(buf)
+	if app.config.env == "development" {
+		encoder.Indent("", "\t")
+	}
+
+	err := encoder.Encode(data)
+	if err != nil {
+		return err
+	}
+	buf.WriteByte('\n')
+
+	for key, value := range headers {
+		w.Header()[key] = value
+	}
+
+	// The headers can override the content type, e.g. for feeds.
+	if w.Header().Get("Content-Type") == "" {
+		w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	}
+	w.WriteHeader(statusCode)
+	w.Write(buf.Bytes())
+	return nil
+}
+
+// xmlValidationErrors returns the error elements of the failed validation, sorted by field.
+func xmlValidationErrors(v *validator.Validator) []xmlError {
+	errs := make([]xmlError, 0, len(v.Errors))
+	for key, message := range v.Errors {
+		errs = append(errs, xmlError{Field: key, Code: v.Codes[key], Message: message})
+	}
+	sort.Slice(errs, func(i, j int) bool { return errs[i].Field < errs[j].Field })
+	return errs
+}
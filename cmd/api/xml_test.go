@@ -0,0 +1,75 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/walkccc/greenlight/internal/data"
+	"github.com/walkccc/greenlight/internal/validator"
+)
+
+func TestWriteMovies_XML(t *testing.T) {
+	app := &application{}
+	createdAt := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	movies := []*data.Movie{{
+		ID:        1,
+		CreatedAt: createdAt,
+		UpdatedAt: createdAt,
+		Title:     "Casablanca",
+		Year:      1942,
+		Runtime:   102,
+		Genres:    []string{"drama", "romance"},
+		Version:   1,
+	}}
+
+	r := httptest.NewRequest(http.MethodGet, "/v1/movies", nil)
+	r.Header.Set("Accept", "application/xml")
+	rr := httptest.NewRecorder()
+
+	facets := &data.MovieFacets{
+		Genres:  []data.FacetCount{{Value: "drama", Count: 1}, {Value: "romance", Count: 1}},
+		Decades: []data.FacetCount{{Value: "1940s", Count: 1}},
+	}
+
+	err := app.writeMovies(rr, r, movies, data.Metadata{CurrentPage: 1, PageSize: 20}, facets)
+	require.NoError(t, err)
+
+	assert.Equal(t, "application/xml; charset=utf-8", rr.Header().Get("Content-Type"))
+	assert.Equal(t, `<?xml version="1.0" encoding="UTF-8"?>`+"\n"+
+		`<response><movies><movie><id>1</id>`+
+		`<created_at>2022-01-01T00:00:00Z</created_at>`+
+		`<updated_at>2022-01-01T00:00:00Z</updated_at>`+
+		`<title>Casablanca</title><year>1942</year>`+
+		`<genres><genre>drama</genre><genre>romance</genre></genres>`+
+		`<version>1</version><runtime>102 mins</runtime></movie></movies>`+
+		`<metadata><current_page>1</current_page><page_size>20</page_size></metadata>`+
+		`<facets><genres><facet value="drama" count="1"></facet>`+
+		`<facet value="romance" count="1"></facet></genres>`+
+		`<decades><facet value="1940s" count="1"></facet></decades></facets>`+
+		`</response>`+"\n", rr.Body.String())
+}
+
+func TestFailedValidationResponse_XML(t *testing.T) {
+	app := &application{}
+
+	v := validator.New()
+	v.AddError("title", validator.CodeRequired, "must be provided")
+	v.AddError("year", validator.CodeTooSmall, "must be greater than 1894")
+
+	r := httptest.NewRequest(http.MethodPost, "/v1/movies", nil)
+	r.Header.Set("Accept", "text/xml")
+	rr := httptest.NewRecorder()
+
+	app.failedValidationResponse(rr, r, v)
+
+	assert.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+	assert.Equal(t, `<?xml version="1.0" encoding="UTF-8"?>`+"\n"+
+		`<response>`+
+		`<error field="title" code="title.required">must be provided</error>`+
+		`<error field="year" code="year.too_small">must be greater than 1894</error>`+
+		`</response>`+"\n", rr.Body.String())
+}
@@ -0,0 +1,129 @@
+package greenlighttest
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// update makes AssertGolden rewrite the golden files with the responses rather than compare them,
+// e.g. once a change to a response is intended: go test ./... -update
+var update = flag.Bool("update", false, "rewrite the golden files with the responses")
+
+// GoldenDir is the directory of the golden files, relative to the test's package.
+const GoldenDir = "testdata/golden"
+
+// The placeholders of the values that Normalize replaces.
+const (
+	PlaceholderID        = "<id>"
+	PlaceholderTimestamp = "<timestamp>"
+)
+
+// numericSegment matches the numeric segments of a path or URL, e.g. the 42 of /v1/movies/42.
+var numericSegment = regexp.MustCompile(`/[0-9]+(/|\?|#|$)`)
+
+// Normalize returns the canonical form of a JSON body, which is the same for the responses that
+// only differ by the values that change from run to run: the members are sorted and indented, the
+// IDs (the "id" and "*_id" members, and the numeric segments of the paths and URLs) are replaced
+// with "<id>", and the RFC 3339 timestamps with "<timestamp>".
+func Normalize(body []byte) ([]byte, error) {
+	if len(bytes.TrimSpace(body)) == 0 {
+		return nil, nil
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+
+	var v any
+	err := decoder.Decode(&v)
+	if err != nil {
+		return nil, err
+	}
+
+	// The placeholders aren't escaped, so that the golden files read well.
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "\t")
+	err = encoder.Encode(normalize("", v))
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func normalize(key string, v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, member := range v {
+			v[k] = normalize(k, member)
+		}
+		return v
+	case []any:
+		for i, element := range v {
+			v[i] = normalize(key, element)
+		}
+		return v
+	}
+
+	if key == "id" || strings.HasSuffix(key, "_id") {
+		return PlaceholderID
+	}
+	if s, ok := v.(string); ok {
+		if _, err := time.Parse(time.RFC3339Nano, s); err == nil {
+			return PlaceholderTimestamp
+		}
+		if strings.HasPrefix(s, "/") || strings.HasPrefix(s, "http") {
+			return numericSegment.ReplaceAllString(s, "/"+PlaceholderID+"$1")
+		}
+	}
+	return v
+}
+
+// AssertGolden fails the test if the normalized body differs from the golden file of the name,
+// testdata/golden/<name>.json, or if there's no such file. With -update, it writes the file
+// instead.
+func (r *Response) AssertGolden(name string) *Response {
+	r.t.Helper()
+
+	got, err := Normalize(r.Body)
+	if err != nil {
+		r.t.Fatalf("greenlighttest: %s %s: the body isn't JSON: %v\n%s",
+			r.Method, r.Path, err, r.Body)
+	}
+
+	path := filepath.Join(GoldenDir, name+".json")
+	if *update {
+		err := os.MkdirAll(filepath.Dir(path), 0o755)
+		if err == nil {
+			err = os.WriteFile(path, got, 0o644)
+		}
+		if err != nil {
+			r.t.Fatalf("greenlighttest: %v", err)
+		}
+		return r
+	}
+
+	want, err := os.ReadFile(path)
+	if err != nil {
+		r.t.Fatalf("greenlighttest: %v (run the test with -update to create it)", err)
+	}
+	if !bytes.Equal(got, want) {
+		r.t.Errorf("greenlighttest: %s %s: the response differs from %s (run the test with "+
+			"-update if the change is intended)\ngot:\n%s\nwant:\n%s",
+			r.Method, r.Path, path, got, want)
+	}
+	return r
+}
+
+// GoldenName returns the name of the golden file of a route, e.g. GET_movies_id for
+// "GET /movies/:id", or GET_openapi_json for "GET /openapi.json".
+func GoldenName(method, pattern string) string {
+	name := method + strings.NewReplacer(":", "", "*", "", "/", "_", ".", "_").Replace(pattern)
+	return strings.TrimSuffix(name, "_")
+}
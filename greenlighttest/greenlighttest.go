@@ -0,0 +1,225 @@
+// Package greenlighttest helps test the Greenlight API over HTTP. A Client issues requests to a
+// handler serving the API, or to a running server, authenticated with a bearer token if need be,
+// and the Response it returns decodes the JSON envelope of the body and asserts on it:
+//
+//	client := greenlighttest.New(t, handler).WithToken(token)
+//	var movie struct{ ID int64 `json:"id"` }
+//	client.Post("/v1/movies", map[string]any{"title": "Moana", "year": 2016}).
+//		AssertStatus(http.StatusCreated).
+//		Decode("movie", &movie)
+//
+// The failed assertions fail the test, via the testing.TB the client was created with.
+package greenlighttest
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// Client issues the requests of a test. Its With methods return a copy of the client, so that a
+// base client can be shared by the test's cases.
+type Client struct {
+	t       testing.TB
+	handler http.Handler // nil for a remote server
+	baseURL string
+	client  *http.Client
+	header  http.Header
+}
+
+// New returns a client of the handler, which the requests are served by in-process.
+func New(t testing.TB, handler http.Handler) *Client {
+	return &Client{t: t, handler: handler, header: make(http.Header)}
+}
+
+// NewRemote returns a client of the server at the base URL, e.g. http://localhost:4000.
+func NewRemote(t testing.TB, baseURL string) *Client {
+	return &Client{
+		t:       t,
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		client:  &http.Client{},
+		header:  make(http.Header),
+	}
+}
+
+// WithHeader returns a copy of the client which sends the header with every request.
+func (c *Client) WithHeader(key, value string) *Client {
+	clone := *c
+	clone.header = c.header.Clone()
+	clone.header.Set(key, value)
+	return &clone
+}
+
+// WithT returns a copy of the client which reports the failures to t, e.g. a subtest's.
+func (c *Client) WithT(t testing.TB) *Client {
+	clone := *c
+	clone.t = t
+	return &clone
+}
+
+// WithToken returns a copy of the client which authenticates the requests with the bearer token.
+func (c *Client) WithToken(token string) *Client {
+	return c.WithHeader("Authorization", "Bearer "+token)
+}
+
+// Get issues a GET request.
+func (c *Client) Get(path string) *Response {
+	return c.Do(http.MethodGet, path, nil)
+}
+
+// Post issues a POST request with the body, as Do does.
+func (c *Client) Post(path string, body any) *Response {
+	return c.Do(http.MethodPost, path, body)
+}
+
+// Put issues a PUT request with the body, as Do does.
+func (c *Client) Put(path string, body any) *Response {
+	return c.Do(http.MethodPut, path, body)
+}
+
+// Patch issues a PATCH request with the body, as Do does.
+func (c *Client) Patch(path string, body any) *Response {
+	return c.Do(http.MethodPatch, path, body)
+}
+
+// Delete issues a DELETE request.
+func (c *Client) Delete(path string) *Response {
+	return c.Do(http.MethodDelete, path, nil)
+}
+
+// Do issues a request, with the body encoded as JSON unless it's nil, a string or a []byte, which
+// are sent as they are.
+func (c *Client) Do(method, path string, body any) *Response {
+	c.t.Helper()
+
+	var reader io.Reader
+	switch body := body.(type) {
+	case nil:
+	case string:
+		reader = strings.NewReader(body)
+	case []byte:
+		reader = bytes.NewReader(body)
+	default:
+		js, err := json.Marshal(body)
+		if err != nil {
+			c.t.Fatalf("greenlighttest: encoding the body of %s %s: %v", method, path, err)
+		}
+		reader = bytes.NewReader(js)
+	}
+
+	r, err := http.NewRequest(method, c.baseURL+path, reader)
+	if err != nil {
+		c.t.Fatalf("greenlighttest: %v", err)
+	}
+	for key, values := range c.header {
+		r.Header[key] = values
+	}
+	if reader != nil && r.Header.Get("Content-Type") == "" {
+		r.Header.Set("Content-Type", "application/json")
+	}
+
+	response := &Response{t: c.t, Method: method, Path: path}
+	if c.handler != nil {
+		rr := httptest.NewRecorder()
+		c.handler.ServeHTTP(rr, r)
+		response.StatusCode, response.Header, response.Body = rr.Code, rr.Header(), rr.Body.Bytes()
+		return response
+	}
+
+	resp, err := c.client.Do(r)
+	if err != nil {
+		c.t.Fatalf("greenlighttest: %s %s: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+
+	response.StatusCode, response.Header = resp.StatusCode, resp.Header
+	response.Body, err = io.ReadAll(resp.Body)
+	if err != nil {
+		c.t.Fatalf("greenlighttest: reading the body of %s %s: %v", method, path, err)
+	}
+	return response
+}
+
+// Response is the response to a request issued by a Client.
+type Response struct {
+	t          testing.TB
+	Method     string
+	Path       string
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+}
+
+// Envelope returns the members of the JSON object the body holds. It fails the test if the body
+// isn't one.
+func (r *Response) Envelope() map[string]json.RawMessage {
+	r.t.Helper()
+
+	var envelope map[string]json.RawMessage
+	err := json.Unmarshal(r.Body, &envelope)
+	if err != nil {
+		r.t.Fatalf("greenlighttest: %s %s: the body isn't a JSON object: %v\n%s",
+			r.Method, r.Path, err, r.Body)
+	}
+	return envelope
+}
+
+// Decode decodes the member of the envelope into dst, e.g. Decode("movie", &movie). It fails the
+// test if the envelope has no such member.
+func (r *Response) Decode(key string, dst any) *Response {
+	r.t.Helper()
+
+	member, ok := r.Envelope()[key]
+	if !ok {
+		r.t.Fatalf("greenlighttest: %s %s: the envelope has no %q member\n%s",
+			r.Method, r.Path, key, r.Body)
+	}
+	err := json.Unmarshal(member, dst)
+	if err != nil {
+		r.t.Fatalf("greenlighttest: %s %s: decoding %q: %v", r.Method, r.Path, key, err)
+	}
+	return r
+}
+
+// AssertStatus fails the test if the response doesn't have the status code.
+func (r *Response) AssertStatus(want int) *Response {
+	r.t.Helper()
+
+	if r.StatusCode != want {
+		r.t.Errorf("greenlighttest: %s %s: got status %d, want %d\n%s",
+			r.Method, r.Path, r.StatusCode, want, r.Body)
+	}
+	return r
+}
+
+// AssertError fails the test if the envelope's error isn't the message.
+func (r *Response) AssertError(message string) *Response {
+	r.t.Helper()
+
+	var got string
+	r.Decode("error", &got)
+	if got != message {
+		r.t.Errorf("greenlighttest: %s %s: got error %q, want %q", r.Method, r.Path, got, message)
+	}
+	return r
+}
+
+// AssertValidationError fails the test if the response isn't a validation error with the code for
+// the field, e.g. AssertValidationError("title", "required").
+func (r *Response) AssertValidationError(field, code string) *Response {
+	r.t.Helper()
+
+	r.AssertStatus(http.StatusUnprocessableEntity)
+
+	var codes map[string]string
+	r.Decode("error_codes", &codes)
+	if want := field + "." + code; codes[field] != want {
+		r.t.Errorf("greenlighttest: %s %s: got error code %q for %s, want %q",
+			r.Method, r.Path, codes[field], field, want)
+	}
+	return r
+}
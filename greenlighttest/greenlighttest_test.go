@@ -0,0 +1,127 @@
+package greenlighttest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// api answers like the Greenlight API does: POST /v1/movies requires a token and a title.
+var api = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Header.Get("Authorization") != "Bearer token" {
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprint(w, `{"error": "you must be authenticated to access this resource"}`)
+		return
+	}
+
+	var input struct{ Title string }
+	json.NewDecoder(r.Body).Decode(&input)
+	if input.Title == "" {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		fmt.Fprint(w, `{"error": {"title": "must be provided"},`+
+			` "error_codes": {"title": "title.required"}}`)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	fmt.Fprintf(w, `{"movie": {"id": 1, "title": %q}}`, input.Title)
+})
+
+// recorder records the failures of the assertions instead of failing the test.
+type recorder struct {
+	testing.TB
+	failures []string
+}
+
+func (r *recorder) Helper() {}
+
+func (r *recorder) Errorf(format string, args ...any) {
+	r.failures = append(r.failures, fmt.Sprintf(format, args...))
+}
+
+func TestClient(t *testing.T) {
+	client := New(t, api)
+
+	client.Post("/v1/movies", map[string]any{"title": "Moana"}).
+		AssertStatus(http.StatusUnauthorized).
+		AssertError("you must be authenticated to access this resource")
+
+	authenticated := client.WithToken("token")
+	authenticated.Post("/v1/movies", map[string]any{}).AssertValidationError("title", "required")
+
+	var movie struct {
+		ID    int64  `json:"id"`
+		Title string `json:"title"`
+	}
+	authenticated.Post("/v1/movies", `{"title": "Moana"}`).
+		AssertStatus(http.StatusCreated).
+		Decode("movie", &movie)
+	assert.Equal(t, int64(1), movie.ID)
+	assert.Equal(t, "Moana", movie.Title)
+
+	// The copies don't share their headers.
+	client.Post("/v1/movies", nil).AssertStatus(http.StatusUnauthorized)
+}
+
+func TestNewRemote(t *testing.T) {
+	server := httptest.NewServer(api)
+	defer server.Close()
+
+	response := NewRemote(t, server.URL+"/").WithToken("token").
+		Post("/v1/movies", map[string]any{"title": "Moana"}).
+		AssertStatus(http.StatusCreated)
+	assert.Equal(t, "application/json", response.Header.Get("Content-Type"))
+	assert.Contains(t, response.Envelope(), "movie")
+}
+
+func TestAssertionFailures(t *testing.T) {
+	r := &recorder{TB: t}
+
+	New(r, api).Get("/v1/movies").
+		AssertStatus(http.StatusOK).
+		AssertError("the requested resource could not be found")
+
+	assert.Len(t, r.failures, 2)
+	assert.Contains(t, r.failures[0], "GET /v1/movies: got status 401, want 200")
+	assert.Contains(t, r.failures[1], `want "the requested resource could not be found"`)
+}
+
+func TestNormalize(t *testing.T) {
+	got, err := Normalize([]byte(`{
+		"movie": {"title": "Moana", "id": 42, "year": 2016, "created_at": "2024-05-01T10:00:00Z"},
+		"_links": {"self": {"href": "/v1/movies/42?fields=title"}},
+		"owners": [{"user_id": 7, "role": "owner"}],
+		"runtime": "107 mins"
+	}`))
+	assert.NoError(t, err)
+	assert.Equal(t, `{
+	"_links": {
+		"self": {
+			"href": "/v1/movies/<id>?fields=title"
+		}
+	},
+	"movie": {
+		"created_at": "<timestamp>",
+		"id": "<id>",
+		"title": "Moana",
+		"year": 2016
+	},
+	"owners": [
+		{
+			"role": "owner",
+			"user_id": "<id>"
+		}
+	],
+	"runtime": "107 mins"
+}
+`, string(got))
+
+	_, err = Normalize([]byte(`{"movie":`))
+	assert.Error(t, err)
+}
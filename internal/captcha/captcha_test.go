@@ -0,0 +1,47 @@
+package captcha
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSiteVerify(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		assert.Equal(t, "203.0.113.7", r.PostForm.Get("remoteip"))
+
+		switch {
+		case r.PostForm.Get("secret") != "secret":
+			w.Write([]byte(`{"success": false, "error-codes": ["invalid-input-secret"]}`))
+		case r.PostForm.Get("response") == "solved":
+			w.Write([]byte(`{"success": true}`))
+		default:
+			w.Write([]byte(`{"success": false, "error-codes": ["invalid-input-response"]}`))
+		}
+	}))
+	defer server.Close()
+
+	verifier, err := New("turnstile", "secret")
+	assert.Nil(t, err)
+	verifier.url = server.URL
+
+	ok, err := verifier.Verify(context.Background(), "solved", "203.0.113.7")
+	assert.Nil(t, err)
+	assert.True(t, ok)
+
+	ok, err = verifier.Verify(context.Background(), "forged", "203.0.113.7")
+	assert.Nil(t, err)
+	assert.False(t, ok)
+
+	// A misconfigured secret is an error rather than an invalid token.
+	verifier.secret = "wrong"
+	_, err = verifier.Verify(context.Background(), "solved", "203.0.113.7")
+	assert.ErrorContains(t, err, "invalid-input-secret")
+
+	_, err = New("recaptcha", "secret")
+	assert.NotNil(t, err)
+}
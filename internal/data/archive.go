@@ -0,0 +1,127 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// archiveTimeout bounds the statement moving a batch of rows to an archive table.
+const archiveTimeout = 30 * time.Second
+
+type ArchiveModelInterface interface {
+	ArchiveMovies(ctx context.Context, olderThan time.Duration, limit int) (int64, []string, error)
+	ArchiveTokens(ctx context.Context, olderThan time.Duration, limit int) (int64, error)
+}
+
+type ArchiveModel struct {
+	DB      *sql.DB
+	breaker *breaker
+	retry   *retryPolicy
+}
+
+// ArchiveMovies moves up to limit of the movies that were soft-deleted more than olderThan ago to
+// the movies_archive table, and returns how many were moved, along with the keys of their
+// posters. Their notifications, revisions and posters are deleted along with them, while their
+// redirects are kept so that the old links still work. The posters' files are left in the
+// storage, for the caller to delete.
+func (m ArchiveModel) ArchiveMovies(
+	ctx context.Context,
+	olderThan time.Duration,
+	limit int,
+) (int64, []string, error) {
+	query := `
+		WITH expired AS (
+			SELECT id
+			FROM movies
+			WHERE deleted_at < now() - make_interval(secs => $1)
+			ORDER BY deleted_at
+			LIMIT $2
+			FOR UPDATE SKIP LOCKED
+		), posters AS (
+			DELETE FROM movie_posters
+			WHERE movie_id IN (SELECT id FROM expired)
+			RETURNING key
+		), archived AS (
+			DELETE FROM movies
+			WHERE id IN (SELECT id FROM expired)
+			RETURNING id, organization_id, created_at, updated_at, deleted_at, title, year,
+				runtime, genres, version, attributes
+		), inserted AS (
+			INSERT INTO movies_archive (id, organization_id, created_at, updated_at, deleted_at,
+				title, year, runtime, genres, version, attributes)
+			SELECT *
+			FROM archived
+			RETURNING id
+		)
+		SELECT (SELECT count(*) FROM inserted), ARRAY(SELECT key FROM posters)
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, archiveTimeout)
+	defer cancel()
+
+	var moved int64
+	var keys []string
+	err := m.retry.do(ctx, m.breaker, func() error {
+		return m.DB.QueryRowContext(ctx, query, olderThan.Seconds(), limit).
+			Scan(&moved, pq.Array(&keys))
+	})
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return moved, keys, nil
+}
+
+// ArchiveTokens moves up to limit of the tokens that expired more than olderThan ago to the
+// tokens_archive table, and returns how many were moved.
+func (m ArchiveModel) ArchiveTokens(
+	ctx context.Context,
+	olderThan time.Duration,
+	limit int,
+) (int64, error) {
+	query := `
+		WITH archived AS (
+			DELETE FROM tokens
+			WHERE hash IN (
+				SELECT hash
+				FROM tokens
+				WHERE expiry < now() - make_interval(secs => $1)
+				ORDER BY expiry
+				LIMIT $2
+				FOR UPDATE SKIP LOCKED
+			)
+			RETURNING hash, user_id, organization_id, expiry, scope
+		)
+		INSERT INTO tokens_archive (hash, user_id, organization_id, expiry, scope)
+		SELECT *
+		FROM archived
+	`
+
+	return m.archive(ctx, query, olderThan, limit)
+}
+
+// archive runs a query moving a batch of rows to an archive table, and returns how many rows it
+// moved. Moving them is a single statement, so the rows are never lost or in both tables.
+func (m ArchiveModel) archive(
+	ctx context.Context,
+	query string,
+	olderThan time.Duration,
+	limit int,
+) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, archiveTimeout)
+	defer cancel()
+
+	var result sql.Result
+	err := m.retry.do(ctx, m.breaker, func() (err error) {
+		result, err = m.DB.ExecContext(ctx, query, olderThan.Seconds(), limit)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
@@ -0,0 +1,41 @@
+package data
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestArchiveModel(t *testing.T) {
+	db, mock := NewMock(t)
+	defer db.Close()
+	model := ArchiveModel{DB: db}
+
+	// The posters are deleted along with the movies, and their keys returned.
+	mock.ExpectQuery(`WITH expired AS \( SELECT id FROM movies `+
+		`WHERE deleted_at < now\(\) - make_interval\(secs => \$1\) .+ FOR UPDATE SKIP LOCKED \), `+
+		`posters AS \( DELETE FROM movie_posters WHERE movie_id IN \(SELECT id FROM expired\) `+
+		`RETURNING key \), archived AS \( DELETE FROM movies .+ INSERT INTO movies_archive .+ `+
+		`SELECT \(SELECT count\(\*\) FROM inserted\), ARRAY\(SELECT key FROM posters\)`).
+		WithArgs(float64(3600), 100).
+		WillReturnRows(sqlmock.NewRows([]string{"count", "array"}).
+			AddRow(42, "{posters/7/1/a/original}"))
+	mock.ExpectExec(`WITH archived AS \( DELETE FROM tokens .+ `+
+		`WHERE expiry < now\(\) - make_interval\(secs => \$1\) .+ INSERT INTO tokens_archive`).
+		WithArgs(float64(60), 10).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	moved, keys, err := model.ArchiveMovies(context.Background(), time.Hour, 100)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(42), moved)
+	assert.Equal(t, []string{"posters/7/1/a/original"}, keys)
+
+	moved, err = model.ArchiveTokens(context.Background(), time.Minute, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), moved)
+
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,326 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/walkccc/greenlight/internal/validator"
+)
+
+var (
+	ErrDuplicateAttribute = errors.New("duplicate attribute name")
+)
+
+// The types of value that an attribute can hold, as they're decoded from JSON.
+const (
+	AttributeString  = "string"
+	AttributeNumber  = "number"
+	AttributeBoolean = "boolean"
+)
+
+// attributeRules holds the validation rules that apply to each type of attribute. The others
+// would either panic on its values (e.g. gt on a string) or never fail (unique).
+var attributeRules = map[string][]string{
+	AttributeString:  {"required", "min", "max", "oneof", "email"},
+	AttributeNumber:  {"required", "min", "max", "gt", "lt", "oneof"},
+	AttributeBoolean: {"required"},
+}
+
+var attributeNameRX = regexp.MustCompile(`^[a-z][a-z0-9_]{0,62}$`)
+
+// Attribute is the definition of a custom movie attribute, which the operators register to extend
+// the movies with fields of their own, e.g. a studio. Rules holds the validation rules that its
+// values must pass, in the syntax of the `validate` tags, e.g. "required,max=100". The movies can
+// only be filtered by the Searchable attributes.
+type Attribute struct {
+	Name       string    `json:"name"`
+	Type       string    `json:"type"`
+	Rules      string    `json:"rules"`
+	Searchable bool      `json:"searchable"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+func ValidateAttribute(v *validator.Validator, attribute *Attribute) {
+	v.Check(
+		validator.Matches(attribute.Name, attributeNameRX),
+		"name",
+		validator.CodeInvalid,
+		"must start with a lowercase letter, and only contain lowercase letters, digits and "+
+			"underscores",
+	)
+
+	permitted, ok := attributeRules[attribute.Type]
+	if !ok {
+		v.AddError("type", validator.CodeNotPermitted, "must be one of string, number, boolean")
+		return
+	}
+
+	rules, err := validator.ParseUserRules(attribute.Rules)
+	if err != nil {
+		v.AddError("rules", validator.CodeInvalid, err.Error())
+		return
+	}
+	for _, rule := range rules {
+		if !validator.PermittedValue(rule.Name, permitted...) {
+			v.AddError("rules", validator.CodeNotPermitted, fmt.Sprintf(
+				"can't use %s on a %s attribute, only %s",
+				rule.Name,
+				attribute.Type,
+				strings.Join(permitted, ", "),
+			))
+			return
+		}
+	}
+}
+
+// accepts reports whether the value, as decoded from JSON, is of the attribute's type.
+func (a *Attribute) accepts(value any) bool {
+	switch value.(type) {
+	case string:
+		return a.Type == AttributeString
+	case float64:
+		return a.Type == AttributeNumber
+	case bool:
+		return a.Type == AttributeBoolean
+	default:
+		return false
+	}
+}
+
+// ParseValue parses a value of the attribute from a query string, e.g. for ?attr.rating=4.5.
+func (a *Attribute) ParseValue(s string) (any, bool) {
+	switch a.Type {
+	case AttributeNumber:
+		f, err := strconv.ParseFloat(s, 64)
+		return f, err == nil
+	case AttributeBoolean:
+		b, err := strconv.ParseBool(s)
+		return b, err == nil
+	default:
+		return s, true
+	}
+}
+
+// Attributes holds the values of a movie's custom attributes, keyed by their names. It's stored
+// in the movies' attributes JSONB column.
+type Attributes map[string]any
+
+// Value implements driver.Valuer, encoding the attributes as a JSON object.
+func (a Attributes) Value() (driver.Value, error) {
+	if a == nil {
+		return "{}", nil
+	}
+	js, err := json.Marshal(map[string]any(a))
+	if err != nil {
+		return nil, err
+	}
+	return string(js), nil
+}
+
+// Scan implements sql.Scanner, decoding the attributes from a JSON object.
+func (a *Attributes) Scan(src any) error {
+	var js []byte
+	switch src := src.(type) {
+	case []byte:
+		js = src
+	case string:
+		js = []byte(src)
+	case nil:
+		*a = nil
+		return nil
+	default:
+		return fmt.Errorf("attributes: can't scan a %T", src)
+	}
+
+	// The previous row's attributes must not be merged into, since the scanners reuse the movie.
+	*a = nil
+	return json.Unmarshal(js, a)
+}
+
+// Merge applies a PATCH of the attributes: the attributes in the patch replace the movie's, and
+// those that are null are removed.
+func (a Attributes) Merge(patch Attributes) Attributes {
+	merged := make(Attributes, len(a)+len(patch))
+	for name, value := range a {
+		merged[name] = value
+	}
+	for name, value := range patch {
+		if value == nil {
+			delete(merged, name)
+		} else {
+			merged[name] = value
+		}
+	}
+	return merged
+}
+
+// ValidateMovieAttributes checks that a movie's attributes are registered, hold values of their
+// types which pass their rules, and that none of the required attributes is missing.
+func ValidateMovieAttributes(
+	v *validator.Validator,
+	definitions []*Attribute,
+	attributes Attributes,
+) {
+	byName := make(map[string]*Attribute, len(definitions))
+	for _, definition := range definitions {
+		byName[definition.Name] = definition
+	}
+
+	for name, value := range attributes {
+		key := validator.Path("attributes", name)
+
+		definition, ok := byName[name]
+		if !ok {
+			v.AddError(key, validator.CodeNotPermitted, "is not a registered attribute")
+			continue
+		}
+		if !definition.accepts(value) {
+			v.AddError(key, validator.CodeInvalid, "must be a "+definition.Type)
+			continue
+		}
+		v.Value(key, value, validator.ParseRules(definition.Rules))
+	}
+
+	for _, definition := range definitions {
+		if _, ok := attributes[definition.Name]; !ok {
+			for _, rule := range validator.ParseRules(definition.Rules) {
+				if rule.Name == "required" {
+					key := validator.Path("attributes", definition.Name)
+					v.AddError(key, validator.CodeRequired, "must be provided")
+				}
+			}
+		}
+	}
+}
+
+// AttributeFilter restricts a movie listing to the movies whose attributes hold the given values,
+// e.g. {"studio": "A24"} for ?attr.studio=A24.
+type AttributeFilter map[string]any
+
+// conditions returns the SQL condition of the filter, if any, to append to moviesWhereClause, with
+// its value appended to args. It's a containment query, which the GIN index on the attributes
+// covers.
+func (f AttributeFilter) conditions(args []any) (string, []any) {
+	if len(f) == 0 {
+		return "", args
+	}
+
+	// The values were parsed from the query string, so they're strings, numbers or booleans,
+	// which always encode.
+	js, _ := json.Marshal(map[string]any(f))
+	args = append(args, string(js))
+	return fmt.Sprintf(" AND attributes @> $%d::jsonb", len(args)), args
+}
+
+type AttributeModelInterface interface {
+	Insert(ctx context.Context, attribute *Attribute) error
+	GetAll(ctx context.Context) ([]*Attribute, error)
+	Delete(ctx context.Context, name string) error
+}
+
+type AttributeModel struct {
+	DB      *sql.DB
+	breaker *breaker
+	retry   *retryPolicy
+	timeout time.Duration
+}
+
+// Insert registers the attribute. It returns ErrDuplicateAttribute if an attribute with the same
+// name is already registered.
+func (m AttributeModel) Insert(ctx context.Context, attribute *Attribute) error {
+	query := `
+		INSERT INTO movie_attributes (name, type, rules, searchable)
+		VALUES ($1, $2, $3, $4)
+		RETURNING created_at
+	`
+	args := []any{attribute.Name, attribute.Type, attribute.Rules, attribute.Searchable}
+
+	ctx, cancel := queryContext(ctx, m.timeout)
+	defer cancel()
+
+	err := m.retry.do(ctx, m.breaker, func() error {
+		return m.DB.QueryRowContext(ctx, query, args...).Scan(utc(&attribute.CreatedAt))
+	})
+	if err != nil {
+		var pqErr *pq.Error
+		switch {
+		case errors.As(err, &pqErr) && pqErr.Constraint == "movie_attributes_pkey":
+			return ErrDuplicateAttribute
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// GetAll returns the registered attributes, sorted by name.
+func (m AttributeModel) GetAll(ctx context.Context) ([]*Attribute, error) {
+	query := `
+		SELECT name, type, rules, searchable, created_at
+		FROM movie_attributes
+		ORDER BY name
+	`
+
+	c := conn{db: m.DB, breaker: m.breaker, retry: m.retry, timeout: m.timeout}
+	records, err := queryMany(ctx, c, query, nil, func(a *Attribute) []any {
+		return []any{&a.Name, &a.Type, &a.Rules, &a.Searchable, utc(&a.CreatedAt)}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	attributes := make([]*Attribute, len(records))
+	for i := range records {
+		attributes[i] = &records[i]
+	}
+	return attributes, nil
+}
+
+// Delete unregisters the attribute, and removes its values from the movies in the same
+// transaction, so that the movies holding one don't fail validation on their next update. An
+// external search index keeps the values until the movies are indexed again. It returns
+// ErrRecordNotFound if the attribute isn't registered.
+func (m AttributeModel) Delete(ctx context.Context, name string) error {
+	query := `
+		DELETE FROM movie_attributes
+		WHERE name = $1
+	`
+	moviesQuery := `
+		UPDATE movies
+		SET attributes = attributes - $1::text
+		WHERE attributes ? $1::text
+	`
+
+	ctx, cancel := queryContext(ctx, m.timeout)
+	defer cancel()
+
+	return m.retry.do(ctx, m.breaker, func() error {
+		return withTx(ctx, m.DB, func(tx *sql.Tx) error {
+			result, err := tx.ExecContext(ctx, query, name)
+			if err != nil {
+				return err
+			}
+
+			rowsAffected, err := result.RowsAffected()
+			if err != nil {
+				return err
+			}
+			if rowsAffected == 0 {
+				return ErrRecordNotFound
+			}
+
+			_, err = tx.ExecContext(ctx, moviesQuery, name)
+			return err
+		})
+	})
+}
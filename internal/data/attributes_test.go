@@ -0,0 +1,64 @@
+package data
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/walkccc/greenlight/internal/validator"
+)
+
+func TestValidateAttribute(t *testing.T) {
+	v := validator.New()
+	ValidateAttribute(v, &Attribute{Name: "studio", Type: AttributeString, Rules: "max=100"})
+	assert.True(t, v.Valid())
+
+	v = validator.New()
+	ValidateAttribute(v, &Attribute{Name: "Studio", Type: AttributeBoolean, Rules: "max=1"})
+	assert.Equal(t, map[string]string{
+		"name":  "name.invalid",
+		"rules": "rules.not_permitted",
+	}, v.Codes)
+
+	v = validator.New()
+	ValidateAttribute(v, &Attribute{Name: "rating", Type: AttributeNumber, Rules: "max=ten"})
+	assert.Equal(t, map[string]string{"rules": "rules.invalid"}, v.Codes)
+}
+
+func TestValidateMovieAttributes(t *testing.T) {
+	definitions := []*Attribute{
+		{Name: "studio", Type: AttributeString, Rules: "required,max=10"},
+		{Name: "rating", Type: AttributeNumber, Rules: "min=0,max=5"},
+		{Name: "restored", Type: AttributeBoolean},
+	}
+
+	v := validator.New()
+	ValidateMovieAttributes(v, definitions, Attributes{"studio": "A24", "rating": 4.5})
+	assert.True(t, v.Valid())
+
+	v = validator.New()
+	attributes := Attributes{"rating": 7.0, "restored": "yes", "color": 1}
+	ValidateMovieAttributes(v, definitions, attributes)
+	assert.Equal(t, map[string]string{
+		"attributes.studio":   "attributes.studio.required",
+		"attributes.rating":   "attributes.rating.too_large",
+		"attributes.restored": "attributes.restored.invalid",
+		"attributes.color":    "attributes.color.not_permitted",
+	}, v.Codes)
+}
+
+func TestAttributes_Merge(t *testing.T) {
+	attributes := Attributes{"studio": "A24", "rating": 4.5}
+	merged := attributes.Merge(Attributes{"studio": nil, "restored": true})
+	assert.Equal(t, Attributes{"rating": 4.5, "restored": true}, merged)
+	assert.Equal(t, "A24", attributes["studio"])
+}
+
+func TestAttributeFilter_Conditions(t *testing.T) {
+	condition, args := AttributeFilter{"studio": "A24"}.conditions([]any{7})
+	assert.Equal(t, " AND attributes @> $2::jsonb", condition)
+	assert.Equal(t, []any{7, `{"studio":"A24"}`}, args)
+
+	condition, args = AttributeFilter(nil).conditions([]any{7})
+	assert.Empty(t, condition)
+	assert.Equal(t, []any{7}, args)
+}
@@ -0,0 +1,161 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// ErrDatabaseUnavailable is returned by the models (instead of running the query) while the
+// circuit breaker is open, i.e. after the database failed too many times in a row.
+var ErrDatabaseUnavailable = errors.New("database unavailable")
+
+// Constants for the circuit breaker states.
+const (
+	BreakerClosed   = "closed"
+	BreakerOpen     = "open"
+	BreakerHalfOpen = "half-open"
+)
+
+// breaker is a circuit breaker around the database. It starts closed and lets every query
+// through. After threshold consecutive failures that look like the database being down or timing
+// out, it opens and fails every query immediately with ErrDatabaseUnavailable, rather than letting
+// each request wait for its full context timeout. Once the cooldown has passed, it goes half-open
+// and lets a single trial query through: if that succeeds the breaker closes again, otherwise it
+// re-opens for another cooldown.
+//
+// A nil *breaker is valid and never opens.
+type breaker struct {
+	threshold int
+	cooldown  time.Duration
+
+	mtx      sync.Mutex
+	state    string
+	failures int
+	openedAt time.Time
+	trialing bool
+}
+
+// newBreaker returns a closed circuit breaker. It returns nil (i.e. a disabled breaker) if the
+// threshold isn't positive.
+func newBreaker(threshold int, cooldown time.Duration) *breaker {
+	if threshold <= 0 {
+		return nil
+	}
+	return &breaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+		state:     BreakerClosed,
+	}
+}
+
+// do runs fn if the breaker allows it and records whether it failed.
+func (b *breaker) do(fn func() error) error {
+	if b == nil {
+		return fn()
+	}
+
+	if !b.allow() {
+		return ErrDatabaseUnavailable
+	}
+
+	err := fn()
+	b.record(err)
+	return err
+}
+
+// allow reports whether a query may run.
+func (b *breaker) allow() bool {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	switch b.state {
+	case BreakerOpen:
+		if time.Since(b.openedAt) < b.cooldown {
+			return false
+		}
+		b.state = BreakerHalfOpen
+		b.trialing = true
+		return true
+	case BreakerHalfOpen:
+		// Only a single trial query is allowed while half-open.
+		if b.trialing {
+			return false
+		}
+		b.trialing = true
+		return true
+	default:
+		return true
+	}
+}
+
+// record updates the breaker with the outcome of a query.
+func (b *breaker) record(err error) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	b.trialing = false
+
+	if !isUnavailableError(err) {
+		b.state = BreakerClosed
+		b.failures = 0
+		return
+	}
+
+	b.failures++
+	if b.state == BreakerHalfOpen || b.failures >= b.threshold {
+		b.state = BreakerOpen
+		b.openedAt = time.Now()
+	}
+}
+
+// State returns the current state of the breaker.
+func (b *breaker) State() string {
+	if b == nil {
+		return BreakerClosed
+	}
+
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	return b.state
+}
+
+// isUnavailableError reports whether err suggests the database itself is unreachable or
+// overloaded, as opposed to an error with a particular query (e.g. no rows or a constraint
+// violation), which shouldn't trip the breaker.
+func isUnavailableError(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, driver.ErrBadConn) ||
+		errors.Is(err, sql.ErrConnDone) {
+		return true
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		// Class 08 is "Connection Exception", 53 is "Insufficient Resources" (e.g. too many
+		// connections) and 57P01 to 57P03 cover the server shutting down or starting up.
+		switch {
+		case pqErr.Code.Class() == "08", pqErr.Code.Class() == "53":
+			return true
+		case pqErr.Code == "57P01", pqErr.Code == "57P02", pqErr.Code == "57P03":
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,54 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBreaker(t *testing.T) {
+	b := newBreaker(2, 50*time.Millisecond)
+
+	// Errors with a particular query don't count as failures.
+	for i := 0; i < 5; i++ {
+		assert.Equal(t, sql.ErrNoRows, b.do(func() error { return sql.ErrNoRows }))
+	}
+	assert.Equal(t, BreakerClosed, b.State())
+
+	// Two consecutive timeouts open the breaker...
+	b.do(func() error { return context.DeadlineExceeded })
+	assert.Equal(t, BreakerClosed, b.State())
+	b.do(func() error { return context.DeadlineExceeded })
+	assert.Equal(t, BreakerOpen, b.State())
+
+	// ...after which queries fail fast without running.
+	ran := false
+	err := b.do(func() error { ran = true; return nil })
+	assert.Equal(t, ErrDatabaseUnavailable, err)
+	assert.False(t, ran)
+
+	// Once the cooldown has passed, a successful trial query closes the breaker again.
+	time.Sleep(60 * time.Millisecond)
+	assert.Nil(t, b.do(func() error { return nil }))
+	assert.Equal(t, BreakerClosed, b.State())
+
+	// A failed trial query re-opens it straight away.
+	b.do(func() error { return sql.ErrConnDone })
+	b.do(func() error { return sql.ErrConnDone })
+	time.Sleep(60 * time.Millisecond)
+	b.do(func() error { return sql.ErrConnDone })
+	assert.Equal(t, BreakerOpen, b.State())
+}
+
+func TestBreaker_Disabled(t *testing.T) {
+	b := newBreaker(0, time.Second)
+	assert.Nil(t, b)
+
+	for i := 0; i < 10; i++ {
+		b.do(func() error { return context.DeadlineExceeded })
+	}
+	assert.Equal(t, BreakerClosed, b.State())
+}
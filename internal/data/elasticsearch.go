@@ -0,0 +1,399 @@
+package data
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// elasticsearchMapping is the mapping of the movies index. The title is analyzed for the relevance
+// ranked searches, and has a keyword subfield to sort on. The attributes are flattened, so that
+// registering one doesn't add a field to the mapping, and their values are matched exactly.
+const elasticsearchMapping = `{
+	"mappings": {
+		"properties": {
+			"id": {"type": "long"},
+			"organization_id": {"type": "long"},
+			"created_at": {"type": "date"},
+			"updated_at": {"type": "date"},
+			"title": {"type": "text", "fields": {"keyword": {"type": "keyword"}}},
+			"year": {"type": "integer"},
+			"runtime": {"type": "integer"},
+			"genres": {"type": "keyword"},
+			"version": {"type": "integer"},
+			"attributes": {"type": "flattened"}
+		}
+	}
+}`
+
+// ElasticsearchSearchIndex is the SearchIndex backed by an Elasticsearch (or OpenSearch) index of
+// the movies, which can be searched without loading the database. The index has to be kept up to
+// date with IndexMovie() and DeleteMovie() as the movies are written.
+type ElasticsearchSearchIndex struct {
+	baseURL string // the index's URL, e.g. http://localhost:9200/movies
+	client  *http.Client
+}
+
+// elasticsearchMovie is a movie's document in the index.
+type elasticsearchMovie struct {
+	ID             int64      `json:"id"`
+	OrganizationID int64      `json:"organization_id"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+	Title          string     `json:"title"`
+	Year           int32      `json:"year"`
+	Runtime        int32      `json:"runtime"`
+	Genres         []string   `json:"genres"`
+	Version        int32      `json:"version"`
+	Attributes     Attributes `json:"attributes"`
+}
+
+// elasticsearchResponse holds the parts of a search response that we use.
+type elasticsearchResponse struct {
+	Hits struct {
+		Total struct {
+			Value int `json:"value"`
+		} `json:"total"`
+		Hits []struct {
+			Score     *float64            `json:"_score"`
+			Source    elasticsearchMovie  `json:"_source"`
+			Highlight map[string][]string `json:"highlight"`
+		} `json:"hits"`
+	} `json:"hits"`
+}
+
+// NewElasticsearchSearchIndex returns the SearchIndex for the named index on the cluster at
+// rawURL, e.g. http://localhost:9200.
+func NewElasticsearchSearchIndex(rawURL, index string) (*ElasticsearchSearchIndex, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("invalid elasticsearch url %q", rawURL)
+	}
+	if index == "" {
+		return nil, fmt.Errorf("elasticsearch index must be provided")
+	}
+
+	return &ElasticsearchSearchIndex{
+		baseURL: strings.TrimSuffix(rawURL, "/") + "/" + url.PathEscape(index),
+		client:  &http.Client{Timeout: 5 * time.Second},
+	}, nil
+}
+
+// CreateIndex creates the index with its mapping, unless it already exists.
+func (s *ElasticsearchSearchIndex) CreateIndex(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	status, body, err := s.do(ctx, http.MethodPut, "", []byte(elasticsearchMapping))
+	if err != nil {
+		return err
+	}
+	if status == http.StatusBadRequest &&
+		bytes.Contains(body, []byte("resource_already_exists_exception")) {
+		return nil
+	}
+	return s.checkStatus(status, body)
+}
+
+// Search runs a relevance ranked query for the title, if any. The movies are sorted by the filters'
+// sort, with the relevance breaking the ties unless they're sorted by relevance, and their titles
+// are highlighted.
+func (s *ElasticsearchSearchIndex) Search(
+	ctx context.Context,
+	organizationID int64,
+	title string,
+	genres []string,
+	years YearRange,
+	attributes AttributeFilter,
+	filters Filters,
+) ([]*Movie, Metadata, error) {
+	sortField := filters.sortColumn()
+	switch sortField {
+	case "title":
+		sortField = "title.keyword"
+	case "relevance":
+		sortField = "_score"
+	}
+
+	strategy := filters.countStrategy()
+
+	request := map[string]any{
+		"from":  filters.offset(),
+		"size":  filters.limit(),
+		"query": searchQuery(organizationID, title, genres, years, attributes),
+		"sort": []any{
+			map[string]any{sortField: strings.ToLower(filters.sortDirection())},
+			"_score",
+			map[string]any{"id": "asc"},
+		},
+		"track_total_hits": strategy != CountNone,
+	}
+	if title != "" {
+		request["track_scores"] = true
+		request["highlight"] = map[string]any{
+			"fields":    map[string]any{"title": map[string]any{"number_of_fragments": 0}},
+			"pre_tags":  []string{"<mark>"},
+			"post_tags": []string{"</mark>"},
+			"encoder":   "html",
+		}
+	}
+
+	var response elasticsearchResponse
+	err := s.search(ctx, request, &response)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	movies := []*Movie{}
+
+	for _, hit := range response.Hits.Hits {
+		doc := hit.Source
+		movie := &Movie{
+			ID:             doc.ID,
+			OrganizationID: doc.OrganizationID,
+			CreatedAt:      doc.CreatedAt.UTC(),
+			UpdatedAt:      doc.UpdatedAt.UTC(),
+			Title:          doc.Title,
+			Year:           doc.Year,
+			Runtime:        Runtime(doc.Runtime),
+			Genres:         doc.Genres,
+			Version:        doc.Version,
+			Attributes:     doc.Attributes,
+		}
+		if title != "" && hit.Score != nil {
+			movie.Match = &MovieMatch{Score: *hit.Score}
+			if fragments := hit.Highlight["title"]; len(fragments) > 0 {
+				movie.Match.TitleHighlight = fragments[0]
+			}
+		}
+		movies = append(movies, movie)
+	}
+
+	if strategy == CountNone {
+		return movies, calculateUncountedMetadata(filters.Page, filters.PageSize), nil
+	}
+
+	return movies, calculateMetadata(response.Hits.Total.Value, filters.Page, filters.PageSize), nil
+}
+
+// Facets counts the matching movies per genre and per decade, with a terms and a histogram
+// aggregation.
+func (s *ElasticsearchSearchIndex) Facets(
+	ctx context.Context,
+	organizationID int64,
+	title string,
+	genres []string,
+) (*MovieFacets, error) {
+	request := map[string]any{
+		"size":             0,
+		"track_total_hits": false,
+		"query":            searchQuery(organizationID, title, genres, YearRange{}, nil),
+		"aggs": map[string]any{
+			"genres": map[string]any{"terms": map[string]any{"field": "genres", "size": 100}},
+			"decades": map[string]any{
+				"histogram": map[string]any{"field": "year", "interval": 10, "min_doc_count": 1},
+			},
+		},
+	}
+
+	var response struct {
+		Aggregations struct {
+			Genres struct {
+				Buckets []struct {
+					Key      string `json:"key"`
+					DocCount int    `json:"doc_count"`
+				} `json:"buckets"`
+			} `json:"genres"`
+			Decades struct {
+				Buckets []struct {
+					Key      float64 `json:"key"`
+					DocCount int     `json:"doc_count"`
+				} `json:"buckets"`
+			} `json:"decades"`
+		} `json:"aggregations"`
+	}
+	err := s.search(ctx, request, &response)
+	if err != nil {
+		return nil, err
+	}
+
+	facets := MovieFacets{Genres: []FacetCount{}, Decades: []FacetCount{}}
+	for _, bucket := range response.Aggregations.Genres.Buckets {
+		facets.Genres = append(facets.Genres, FacetCount{Value: bucket.Key, Count: bucket.DocCount})
+	}
+	for _, bucket := range response.Aggregations.Decades.Buckets {
+		facets.Decades = append(facets.Decades, FacetCount{
+			Value: strconv.Itoa(int(bucket.Key)) + "s",
+			Count: bucket.DocCount,
+		})
+	}
+
+	return &facets, nil
+}
+
+// IndexMovie adds the movie to the index, or replaces it if it's already there.
+func (s *ElasticsearchSearchIndex) IndexMovie(ctx context.Context, movie *Movie) error {
+	js, err := json.Marshal(elasticsearchMovie{
+		ID:             movie.ID,
+		OrganizationID: movie.OrganizationID,
+		CreatedAt:      movie.CreatedAt,
+		UpdatedAt:      movie.UpdatedAt,
+		Title:          movie.Title,
+		Year:           movie.Year,
+		Runtime:        int32(movie.Runtime),
+		Genres:         movie.Genres,
+		Version:        movie.Version,
+		Attributes:     movie.Attributes,
+	})
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	status, body, err := s.do(ctx, http.MethodPut, s.docPath(movie.ID), js)
+	if err != nil {
+		return err
+	}
+	return s.checkStatus(status, body)
+}
+
+// DeleteMovie removes the movie from the index. Movies that aren't indexed are ignored.
+func (s *ElasticsearchSearchIndex) DeleteMovie(
+	ctx context.Context,
+	organizationID, id int64,
+) error {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	status, body, err := s.do(ctx, http.MethodDelete, s.docPath(id), nil)
+	if err != nil {
+		return err
+	}
+	if status == http.StatusNotFound {
+		return nil
+	}
+	return s.checkStatus(status, body)
+}
+
+// search sends the search request, and decodes the response into dst.
+func (s *ElasticsearchSearchIndex) search(
+	ctx context.Context,
+	request map[string]any,
+	dst any,
+) error {
+	js, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	status, body, err := s.do(ctx, http.MethodPost, "/_search", js)
+	if err != nil {
+		return err
+	}
+	if err := s.checkStatus(status, body); err != nil {
+		return err
+	}
+
+	return json.Unmarshal(body, dst)
+}
+
+// searchQuery returns the query for the organization's movies matching the title, genres, years
+// and attributes.
+func searchQuery(
+	organizationID int64,
+	title string,
+	genres []string,
+	years YearRange,
+	attributes AttributeFilter,
+) map[string]any {
+	filter := []any{
+		map[string]any{"term": map[string]any{"organization_id": organizationID}},
+	}
+	// The movies must contain all the genres, like the genres @> $3 condition of the movies table.
+	for _, genre := range genres {
+		filter = append(filter, map[string]any{"term": map[string]any{"genres": genre}})
+	}
+	if years != (YearRange{}) {
+		bounds := map[string]any{}
+		if years.From != 0 {
+			bounds["gte"] = years.From
+		}
+		if years.To != 0 {
+			bounds["lte"] = years.To
+		}
+		filter = append(filter, map[string]any{"range": map[string]any{"year": bounds}})
+	}
+	for name, value := range attributes {
+		field := "attributes." + name
+		filter = append(filter, map[string]any{"term": map[string]any{field: value}})
+	}
+
+	boolQuery := map[string]any{"filter": filter}
+	if title != "" {
+		boolQuery["must"] = map[string]any{
+			"match": map[string]any{"title": map[string]any{"query": title, "operator": "and"}},
+		}
+	}
+
+	return map[string]any{"bool": boolQuery}
+}
+
+// docPath returns the path of the movie's document, relative to the index. The movie IDs are
+// unique across the organizations, so they're used as the document IDs.
+func (s *ElasticsearchSearchIndex) docPath(id int64) string {
+	return "/_doc/" + strconv.FormatInt(id, 10)
+}
+
+// do sends a request with the JSON body, if any, to the path relative to the index, and returns
+// the response's status code and body.
+func (s *ElasticsearchSearchIndex) do(
+	ctx context.Context,
+	method, path string,
+	js []byte,
+) (int, []byte, error) {
+	var body io.Reader
+	if js != nil {
+		body = bytes.NewReader(js)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, s.baseURL+path, body)
+	if err != nil {
+		return 0, nil, err
+	}
+	if js != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, 10<<20))
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return resp.StatusCode, respBody, nil
+}
+
+// checkStatus returns an error holding the response body if the status code isn't a 2xx one.
+func (s *ElasticsearchSearchIndex) checkStatus(status int, body []byte) error {
+	if status >= 200 && status < 300 {
+		return nil
+	}
+	return fmt.Errorf("elasticsearch: unexpected status %d: %s", status, bytes.TrimSpace(body))
+}
@@ -0,0 +1,92 @@
+package data
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestElasticsearchSearchIndex_Search(t *testing.T) {
+	var path string
+	var request map[string]any
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		json.NewDecoder(r.Body).Decode(&request)
+
+		w.Write([]byte(`{"hits": {"total": {"value": 21}, "hits": [{
+			"_score": 1.5,
+			"_source": {"id": 1, "organization_id": 7, "title": "Black Panther", "year": 2018,
+				"runtime": 134, "genres": ["action"], "version": 1},
+			"highlight": {"title": ["<mark>Black</mark> Panther"]}
+		}]}}`))
+	}))
+	defer ts.Close()
+
+	index, err := NewElasticsearchSearchIndex(ts.URL, "movies")
+	assert.Nil(t, err)
+
+	filters := Filters{Page: 2, PageSize: 10, Sort: "-title", SortSafeValues: MovieSortSafeValues}
+	movies, metadata, err := index.Search(
+		context.Background(),
+		7,
+		"black",
+		[]string{"action"},
+		YearRange{},
+		nil,
+		filters,
+	)
+	assert.Nil(t, err)
+
+	assert.Equal(t, "/movies/_search", path)
+	assert.EqualValues(t, 10, request["from"])
+	assert.EqualValues(t, 10, request["size"])
+	assert.Equal(t, []any{
+		map[string]any{"title.keyword": "desc"},
+		"_score",
+		map[string]any{"id": "asc"},
+	}, request["sort"])
+	assert.Equal(t, map[string]any{
+		"filter": []any{
+			map[string]any{"term": map[string]any{"organization_id": float64(7)}},
+			map[string]any{"term": map[string]any{"genres": "action"}},
+		},
+		"must": map[string]any{
+			"match": map[string]any{"title": map[string]any{"query": "black", "operator": "and"}},
+		},
+	}, request["query"].(map[string]any)["bool"])
+
+	assert.Len(t, movies, 1)
+	assert.Equal(t, "Black Panther", movies[0].Title)
+	assert.Equal(t, Runtime(134), movies[0].Runtime)
+	assert.Equal(
+		t,
+		&MovieMatch{Score: 1.5, TitleHighlight: "<mark>Black</mark> Panther"},
+		movies[0].Match,
+	)
+	assert.Equal(t, calculateMetadata(21, 2, 10), metadata)
+}
+
+func TestElasticsearchSearchIndex_DeleteMovie(t *testing.T) {
+	statusCode := http.StatusNotFound
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodDelete, r.Method)
+		assert.Equal(t, "/movies/_doc/3", r.URL.Path)
+		w.WriteHeader(statusCode)
+	}))
+	defer ts.Close()
+
+	index, err := NewElasticsearchSearchIndex(ts.URL, "movies")
+	assert.Nil(t, err)
+
+	// Movies that were never indexed are ignored.
+	assert.Nil(t, index.DeleteMovie(context.Background(), 7, 3))
+
+	statusCode = http.StatusInternalServerError
+	assert.Error(t, index.DeleteMovie(context.Background(), 7, 3))
+}
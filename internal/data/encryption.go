@@ -0,0 +1,366 @@
+package data
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrUnknownKey = errors.New("encryption: unknown key")
+	ErrNoKeyring  = errors.New("encryption: the email is encrypted but no keys are configured")
+)
+
+// sealedVersion is the first byte of a sealed value, which leaves room for changing the format.
+const sealedVersion = 1
+
+// Keyring encrypts the users' emails with envelope encryption: each email is encrypted with its
+// own random data key, which is in turn encrypted with a key-encryption key. The key-encryption
+// keys are numbered, and the newest one encrypts the new values, while the older ones are kept to
+// decrypt the values that haven't been re-encrypted yet. Rotating a key is adding a key with a
+// higher number.
+//
+// Since the ciphertexts are random, the emails are looked up by their blind index instead: an HMAC
+// of the normalized email, with a separate key that doesn't rotate.
+//
+// The signing keys' secrets are encrypted the same way. They're looked up by the key's ID, so
+// they need no blind index.
+//
+// A nil *Keyring is valid and leaves the emails and the secrets in plaintext.
+type Keyring struct {
+	keys     map[uint32]cipher.AEAD
+	current  uint32
+	indexKey []byte
+
+	// decrypt makes the keyring write the emails in plaintext, while still decrypting the ones that
+	// are encrypted, so that the encryption can be turned off.
+	decrypt bool
+}
+
+// NewKeyring returns a keyring with the given 32-byte key-encryption keys, the highest-numbered of
+// which encrypts the new values, and the blind index key.
+func NewKeyring(keys map[uint32][]byte, indexKey []byte) (*Keyring, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("encryption: at least one key is required")
+	}
+	if len(indexKey) < 32 {
+		return nil, errors.New("encryption: the index key must be at least 32 bytes long")
+	}
+
+	k := &Keyring{keys: make(map[uint32]cipher.AEAD, len(keys)), indexKey: indexKey}
+	for id, key := range keys {
+		if len(key) != 32 {
+			return nil, fmt.Errorf("encryption: key %d must be 32 bytes long", id)
+		}
+
+		aead, err := newAEAD(key)
+		if err != nil {
+			return nil, err
+		}
+		k.keys[id] = aead
+
+		if id > k.current {
+			k.current = id
+		}
+	}
+
+	return k, nil
+}
+
+// ParseKeyring parses a keyring from a comma-separated list of "id:key" pairs and an index key,
+// with the keys encoded in base64, e.g. "1:<key>,2:<key>". It returns nil if keys is empty.
+func ParseKeyring(keys, indexKey string) (*Keyring, error) {
+	if keys == "" {
+		return nil, nil
+	}
+
+	parsed := make(map[uint32][]byte)
+	for _, pair := range strings.Split(keys, ",") {
+		id, key, ok := strings.Cut(strings.TrimSpace(pair), ":")
+		if !ok {
+			return nil, fmt.Errorf("encryption: invalid key %q, expected id:key", pair)
+		}
+
+		n, err := strconv.ParseUint(id, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("encryption: invalid key id %q", id)
+		}
+		if _, ok := parsed[uint32(n)]; ok {
+			return nil, fmt.Errorf("encryption: duplicate key id %d", n)
+		}
+
+		parsed[uint32(n)], err = base64.StdEncoding.DecodeString(key)
+		if err != nil {
+			return nil, fmt.Errorf("encryption: key %d isn't valid base64", n)
+		}
+	}
+
+	index, err := base64.StdEncoding.DecodeString(indexKey)
+	if err != nil {
+		return nil, errors.New("encryption: the index key isn't valid base64")
+	}
+
+	return NewKeyring(parsed, index)
+}
+
+// Decrypting returns a copy of the keyring that writes the emails in plaintext, which
+// UserModel.EncryptEmails() then uses to decrypt the encrypted ones.
+func (k *Keyring) Decrypting() *Keyring {
+	decrypting := *k
+	decrypting.decrypt = true
+	return &decrypting
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// seal encrypts the plaintext with a new data key, and returns the version, the key-encryption
+// key's ID, the encrypted data key and the encrypted plaintext, each prefixed with its nonce.
+func (k *Keyring) seal(plaintext string) ([]byte, error) {
+	dataKey := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, dataKey); err != nil {
+		return nil, err
+	}
+	dataAEAD, err := newAEAD(dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, 5)
+	header[0] = sealedVersion
+	binary.BigEndian.PutUint32(header[1:], k.current)
+
+	// The header is authenticated along with the data key, so that it can't be swapped.
+	sealed, err := sealWith(k.keys[k.current], header, dataKey, header)
+	if err != nil {
+		return nil, err
+	}
+	return sealWith(dataAEAD, sealed, []byte(plaintext), nil)
+}
+
+// sealWith appends a random nonce and the encrypted plaintext to dst.
+func sealWith(aead cipher.AEAD, dst, plaintext, additionalData []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	dst = append(dst, nonce...)
+	return aead.Seal(dst, nonce, plaintext, additionalData), nil
+}
+
+// open decrypts a value sealed by seal(), with whichever key encrypted it.
+func (k *Keyring) open(sealed []byte) (string, error) {
+	if k == nil {
+		return "", ErrNoKeyring
+	}
+
+	invalid := errors.New("encryption: invalid ciphertext")
+
+	if len(sealed) < 5 || sealed[0] != sealedVersion {
+		return "", invalid
+	}
+	header, rest := sealed[:5], sealed[5:]
+
+	keyAEAD, ok := k.keys[binary.BigEndian.Uint32(header[1:])]
+	if !ok {
+		return "", ErrUnknownKey
+	}
+
+	wrappedSize := keyAEAD.NonceSize() + 32 + keyAEAD.Overhead()
+	if len(rest) < wrappedSize {
+		return "", invalid
+	}
+	dataKey, err := openWith(keyAEAD, rest[:wrappedSize], header)
+	if err != nil {
+		return "", invalid
+	}
+
+	dataAEAD, err := newAEAD(dataKey)
+	if err != nil {
+		return "", err
+	}
+	plaintext, err := openWith(dataAEAD, rest[wrappedSize:], nil)
+	if err != nil {
+		return "", invalid
+	}
+
+	return string(plaintext), nil
+}
+
+func openWith(aead cipher.AEAD, sealed, additionalData []byte) ([]byte, error) {
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New("encryption: invalid ciphertext")
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	return aead.Open(nil, nonce, ciphertext, additionalData)
+}
+
+// blindIndex returns the blind index of the email, which is case-insensitive like the citext email
+// column. It returns nil for a nil keyring, which matches no row.
+func (k *Keyring) blindIndex(email string) []byte {
+	if k == nil {
+		return nil
+	}
+
+	mac := hmac.New(sha256.New, k.indexKey)
+	mac.Write([]byte(strings.ToLower(email)))
+	return mac.Sum(nil)
+}
+
+// emailColumns holds the values written to the users' email columns: either the plaintext email,
+// or its ciphertext, blind index and key ID. The others are nil, and so written as NULL.
+type emailColumns struct {
+	plaintext  any
+	ciphertext any
+	index      any
+	keyID      any
+}
+
+// sealEmail returns the values of the email columns for the email, which is encrypted unless the
+// keyring is nil.
+func (k *Keyring) sealEmail(email string) (emailColumns, error) {
+	if k == nil || k.decrypt {
+		return emailColumns{plaintext: email}, nil
+	}
+
+	ciphertext, err := k.seal(email)
+	if err != nil {
+		return emailColumns{}, err
+	}
+
+	return emailColumns{
+		ciphertext: ciphertext,
+		index:      k.blindIndex(email),
+		keyID:      int64(k.current),
+	}, nil
+}
+
+// emailDests returns the scan destinations of the users' email and email_ciphertext columns, in
+// this order, which set the email from whichever of the two isn't null.
+func (k *Keyring) emailDests(email *string) []any {
+	return []any{plaintextEmail{email}, sealedEmail{k, email}}
+}
+
+type plaintextEmail struct {
+	email *string
+}
+
+func (e plaintextEmail) Scan(src any) error {
+	switch src := src.(type) {
+	case nil:
+		return nil
+	case string:
+		*e.email = src
+	case []byte:
+		*e.email = string(src)
+	default:
+		return fmt.Errorf("encryption: can't scan %T into an email", src)
+	}
+	return nil
+}
+
+type sealedEmail struct {
+	keys  *Keyring
+	email *string
+}
+
+func (e sealedEmail) Scan(src any) error {
+	if src == nil {
+		return nil
+	}
+
+	sealed, ok := src.([]byte)
+	if !ok {
+		return fmt.Errorf("encryption: can't scan %T into an encrypted email", src)
+	}
+
+	email, err := e.keys.open(sealed)
+	if err != nil {
+		return err
+	}
+	*e.email = email
+	return nil
+}
+
+// secretColumns holds the values written to the signing keys' secret columns: either the plaintext
+// secret, or its ciphertext and key ID. The others are nil, which is written as NULL (unlike a nil
+// []byte, which lib/pq writes as an empty bytea).
+type secretColumns struct {
+	plaintext  any
+	ciphertext any
+	keyID      any
+}
+
+// sealSecret returns the values of the secret columns for the signing key's secret, which is
+// encrypted unless the keyring is nil.
+func (k *Keyring) sealSecret(secret []byte) (secretColumns, error) {
+	if k == nil || k.decrypt {
+		return secretColumns{plaintext: secret}, nil
+	}
+
+	ciphertext, err := k.seal(string(secret))
+	if err != nil {
+		return secretColumns{}, err
+	}
+
+	return secretColumns{ciphertext: ciphertext, keyID: int64(k.current)}, nil
+}
+
+// secretDests returns the scan destinations of the signing keys' secret and secret_ciphertext
+// columns, in this order, which set the secret from whichever of the two isn't null.
+func (k *Keyring) secretDests(secret *[]byte) []any {
+	return []any{plaintextSecret{secret}, sealedSecret{k, secret}}
+}
+
+type plaintextSecret struct {
+	secret *[]byte
+}
+
+func (s plaintextSecret) Scan(src any) error {
+	switch src := src.(type) {
+	case nil:
+		return nil
+	case []byte:
+		*s.secret = append([]byte(nil), src...)
+	default:
+		return fmt.Errorf("encryption: can't scan %T into a secret", src)
+	}
+	return nil
+}
+
+type sealedSecret struct {
+	keys   *Keyring
+	secret *[]byte
+}
+
+func (s sealedSecret) Scan(src any) error {
+	if src == nil {
+		return nil
+	}
+
+	sealed, ok := src.([]byte)
+	if !ok {
+		return fmt.Errorf("encryption: can't scan %T into an encrypted secret", src)
+	}
+
+	secret, err := s.keys.open(sealed)
+	if err != nil {
+		return err
+	}
+	*s.secret = []byte(secret)
+	return nil
+}
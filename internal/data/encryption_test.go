@@ -0,0 +1,59 @@
+package data
+
+import (
+	"bytes"
+	"encoding/base64"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeyring(t *testing.T) {
+	key := func(b byte) string {
+		return base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{b}, 32))
+	}
+
+	old, err := ParseKeyring("1:"+key(1), key(9))
+	assert.Nil(t, err)
+	rotated, err := ParseKeyring("1:"+key(1)+", 2:"+key(2), key(9))
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(2), rotated.current)
+
+	sealed, err := old.seal("alice@example.com")
+	assert.Nil(t, err)
+	assert.NotContains(t, string(sealed), "alice")
+
+	// The rotated keyring still decrypts the values encrypted with the older key, but the older
+	// keyring can't decrypt the values encrypted with the new one.
+	email, err := rotated.open(sealed)
+	assert.Nil(t, err)
+	assert.Equal(t, "alice@example.com", email)
+
+	sealed, err = rotated.seal("alice@example.com")
+	assert.Nil(t, err)
+	_, err = old.open(sealed)
+	assert.ErrorIs(t, err, ErrUnknownKey)
+
+	// Tampering with the ciphertext is detected.
+	sealed[len(sealed)-1] ^= 1
+	_, err = rotated.open(sealed)
+	assert.NotNil(t, err)
+
+	// The blind index doesn't depend on the key, nor on the email's case.
+	assert.Equal(t, old.blindIndex("alice@example.com"), rotated.blindIndex("Alice@Example.com"))
+	assert.NotEqual(t, old.blindIndex("alice@example.com"), old.blindIndex("bob@example.com"))
+
+	columns, err := rotated.Decrypting().sealEmail("alice@example.com")
+	assert.Nil(t, err)
+	assert.Equal(t, emailColumns{plaintext: "alice@example.com"}, columns)
+
+	invalid := []string{"1", "x:" + key(1), "1:" + key(1) + ",1:" + key(2), "1:c2hvcnQ="}
+	for _, keys := range invalid {
+		_, err := ParseKeyring(keys, key(9))
+		assert.NotNil(t, err, keys)
+	}
+
+	keys, err := ParseKeyring("", "")
+	assert.Nil(t, err)
+	assert.Nil(t, keys)
+}
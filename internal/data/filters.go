@@ -1,16 +1,51 @@
 package data
 
 import (
+	"fmt"
 	"strings"
 
 	"github.com/walkccc/greenlight/internal/validator"
 )
 
+// Constants for the strategies used to count the total number of records matching a listing.
+//   - CountExact counts every matching row with a count(*) OVER() window (the default).
+//   - CountEstimated reads the planner's row estimate from pg_class.reltuples, which is close to
+//     free but only meaningful for unfiltered listings.
+//   - CountParallel runs a separate count(*) query concurrently with the page query, on a second
+//     pooled connection, instead of paying for the window function on every returned row.
+//   - CountNone skips the count entirely, so the metadata won't include the last page or the total
+//     number of records.
+const (
+	CountExact     = "exact"
+	CountEstimated = "estimated"
+	CountParallel  = "parallel"
+	CountNone      = "none"
+)
+
+// CountStrategies holds every supported count strategy.
+var CountStrategies = []string{CountExact, CountEstimated, CountParallel, CountNone}
+
+// Defaults for the pagination limits of the filters that don't set their own.
+const (
+	DefaultMaxPage     = 10_000_000
+	DefaultMaxPageSize = 100
+)
+
+// PageSizeCap is the largest page size that any listing can be configured with, which keeps a
+// single page from loading too many rows out of the database.
+const PageSizeCap = 1000
+
 type Filters struct {
 	Page           int
 	PageSize       int
 	Sort           string
 	SortSafeValues []string
+	CountStrategy  string
+
+	// MaxPage and MaxPageSize are the largest page and page size allowed, or zero for the
+	// defaults. The page size is never allowed over PageSizeCap.
+	MaxPage     int
+	MaxPageSize int
 }
 
 // sortColumn extracts the column name from the Sort field if it matches one of the entries in
@@ -35,6 +70,35 @@ func (f Filters) sortDirection() string {
 	return "ASC"
 }
 
+// countStrategy returns the CountStrategy field, falling back to CountExact if it isn't set.
+func (f Filters) countStrategy() string {
+	if f.CountStrategy == "" {
+		return CountExact
+	}
+	return f.CountStrategy
+}
+
+// maxPage returns the MaxPage field, falling back to DefaultMaxPage if it isn't set.
+func (f Filters) maxPage() int {
+	if f.MaxPage <= 0 {
+		return DefaultMaxPage
+	}
+	return f.MaxPage
+}
+
+// maxPageSize returns the MaxPageSize field, falling back to DefaultMaxPageSize if it isn't set,
+// and capped at PageSizeCap.
+func (f Filters) maxPageSize() int {
+	switch {
+	case f.MaxPageSize <= 0:
+		return DefaultMaxPageSize
+	case f.MaxPageSize > PageSizeCap:
+		return PageSizeCap
+	default:
+		return f.MaxPageSize
+	}
+}
+
 func (f Filters) limit() int {
 	return f.PageSize
 }
@@ -44,19 +108,44 @@ func (f Filters) offset() int {
 }
 
 func ValidateFilters(v *validator.Validator, f Filters) {
-	v.Check(f.Page > 0, "page", "must be greater than zero")
-	v.Check(f.Page <= 10_000_000, "page", "must be a maximum of 10 million")
-	v.Check(f.PageSize > 0, "page_size", "must be greater than 0")
-	v.Check(f.PageSize <= 100, "page_size", "must be a maximum of 100")
-	v.Check(validator.PermittedValue(f.Sort, f.SortSafeValues...), "sort", "invalid sort value")
+	v.Check(f.Page > 0, "page", validator.CodeTooSmall, "must be greater than zero")
+	v.Check(
+		f.Page <= f.maxPage(),
+		"page",
+		validator.CodeTooLarge,
+		fmt.Sprintf("must be a maximum of %d", f.maxPage()),
+	)
+	v.Check(f.PageSize > 0, "page_size", validator.CodeTooSmall, "must be greater than 0")
+	v.Check(
+		f.PageSize <= f.maxPageSize(),
+		"page_size",
+		validator.CodeTooLarge,
+		fmt.Sprintf("must be a maximum of %d", f.maxPageSize()),
+	)
+	v.Check(
+		validator.PermittedValue(f.Sort, f.SortSafeValues...),
+		"sort",
+		validator.CodeNotPermitted,
+		"invalid sort value",
+	)
+	v.Check(
+		validator.PermittedValue(f.countStrategy(), CountStrategies...),
+		"count",
+		validator.CodeNotPermitted,
+		"invalid count value",
+	)
 }
 
 type Metadata struct {
-	CurrentPage  int `json:"current_page,omitempty"`
-	PageSize     int `json:"page_size,omitempty"`
-	FirstPage    int `json:"first_page,omitempty"`
-	LastPage     int `json:"last_page,omitempty"`
-	TotalRecords int `json:"total_records,omitempty"`
+	CurrentPage  int  `json:"current_page,omitempty" xml:"current_page,omitempty"`
+	PageSize     int  `json:"page_size,omitempty" xml:"page_size,omitempty"`
+	FirstPage    int  `json:"first_page,omitempty" xml:"first_page,omitempty"`
+	LastPage     int  `json:"last_page,omitempty" xml:"last_page,omitempty"`
+	TotalRecords int  `json:"total_records,omitempty" xml:"total_records,omitempty"`
+	Estimated    bool `json:"estimated,omitempty" xml:"estimated,omitempty"`
+
+	// Suggestions holds the titles that a title search without any results may have meant.
+	Suggestions []string `json:"suggestions,omitempty" xml:"suggestion,omitempty"`
 }
 
 // calculateMetadata calculates the appropriate pagination metadata values given the total number of
@@ -74,3 +163,13 @@ func calculateMetadata(totalRecords, page, pageSize int) Metadata {
 		TotalRecords: totalRecords,
 	}
 }
+
+// calculateUncountedMetadata returns the pagination metadata for a listing whose total number of
+// records is unknown (i.e. when the CountNone strategy is used).
+func calculateUncountedMetadata(page, pageSize int) Metadata {
+	return Metadata{
+		CurrentPage: page,
+		PageSize:    pageSize,
+		FirstPage:   1,
+	}
+}
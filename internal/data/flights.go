@@ -0,0 +1,102 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+)
+
+// flightGroup coalesces the concurrent calls for the same key: while a call is in flight, the
+// calls for its key wait for it and share its result rather than running again, so that a burst
+// of reads of the same row makes one query.
+//
+// A nil *flightGroup is valid and coalesces nothing.
+type flightGroup[K comparable, V any] struct {
+	mtx     sync.Mutex
+	flights map[K]*flight[V]
+
+	shared atomic.Int64 // the calls that shared another call's result
+}
+
+type flight[V any] struct {
+	done  chan struct{}
+	value V
+	err   error
+}
+
+func newFlightGroup[K comparable, V any]() *flightGroup[K, V] {
+	return &flightGroup[K, V]{flights: make(map[K]*flight[V])}
+}
+
+// do runs fn for the key, unless a call for it is in flight already, in which case it waits for
+// that call's result until ctx is done. The result is shared, so the callers mustn't modify it.
+//
+// The call in flight runs with its caller's context. If that caller goes away, its call fails
+// with the context's error, and the callers waiting for it retry instead of failing with it.
+func (g *flightGroup[K, V]) do(
+	ctx context.Context,
+	key K,
+	fn func(ctx context.Context) (V, error),
+) (V, error) {
+	if g == nil {
+		return fn(ctx)
+	}
+
+	for {
+		g.mtx.Lock()
+		f, found := g.flights[key]
+		if !found {
+			f = &flight[V]{done: make(chan struct{})}
+			g.flights[key] = f
+			g.mtx.Unlock()
+
+			f.value, f.err = fn(ctx)
+
+			g.mtx.Lock()
+			if g.flights[key] == f {
+				delete(g.flights, key)
+			}
+			g.mtx.Unlock()
+			close(f.done)
+
+			return f.value, f.err
+		}
+		g.mtx.Unlock()
+
+		select {
+		case <-f.done:
+		case <-ctx.Done():
+			var zero V
+			return zero, ctx.Err()
+		}
+
+		if errors.Is(f.err, context.Canceled) || errors.Is(f.err, context.DeadlineExceeded) {
+			continue
+		}
+		g.shared.Add(1)
+		return f.value, f.err
+	}
+}
+
+// forget makes the next call for the key run, rather than wait for the call in flight, e.g. once
+// the row has changed, so that the reads made after a write don't get a result read before it.
+func (g *flightGroup[K, V]) forget(key K) {
+	if g == nil {
+		return
+	}
+
+	g.mtx.Lock()
+	defer g.mtx.Unlock()
+
+	delete(g.flights, key)
+}
+
+// Shared returns how many calls shared the result of another one. It's safe to call on a nil
+// *flightGroup.
+func (g *flightGroup[K, V]) Shared() int64 {
+	if g == nil {
+		return 0
+	}
+	return g.shared.Load()
+}
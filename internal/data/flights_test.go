@@ -0,0 +1,110 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFlightGroup_Do(t *testing.T) {
+	g := newFlightGroup[int64, string]()
+
+	var calls atomic.Int64
+	started := make(chan struct{})
+	release := make(chan struct{})
+	fn := func(ctx context.Context) (string, error) {
+		if calls.Add(1) == 1 {
+			close(started)
+		}
+		<-release
+		return "movie", nil
+	}
+
+	results := make([]string, 10)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		results[0], _ = g.do(context.Background(), 1, fn)
+	}()
+	<-started
+
+	for i := 1; i < len(results); i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], _ = g.do(context.Background(), 1, fn)
+		}(i)
+	}
+
+	// The other calls join the one in flight before it returns.
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	assert.Equal(t, int64(1), calls.Load())
+	assert.Equal(t, int64(9), g.Shared())
+	for _, result := range results {
+		assert.Equal(t, "movie", result)
+	}
+
+	// The call is over, so the next one runs again.
+	_, err := g.do(context.Background(), 1, fn)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), calls.Load())
+}
+
+func TestFlightGroup_DoCanceled(t *testing.T) {
+	g := newFlightGroup[int64, string]()
+
+	started := make(chan struct{})
+	leader, cancel := context.WithCancel(context.Background())
+	go func() {
+		_, err := g.do(leader, 1, func(ctx context.Context) (string, error) {
+			close(started)
+			<-ctx.Done()
+			return "", ctx.Err()
+		})
+		assert.ErrorIs(t, err, context.Canceled)
+	}()
+	<-started
+
+	done := make(chan string)
+	go func() {
+		result, err := g.do(context.Background(), 1, func(ctx context.Context) (string, error) {
+			return "movie", nil
+		})
+		assert.NoError(t, err)
+		done <- result
+	}()
+
+	// The waiting call runs itself once the call in flight fails with its caller's context.
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+	assert.Equal(t, "movie", <-done)
+
+	// A nil group runs every call.
+	var nilGroup *flightGroup[int64, string]
+	_, err := nilGroup.do(context.Background(), 1, func(ctx context.Context) (string, error) {
+		return "", errors.New("boom")
+	})
+	assert.EqualError(t, err, "boom")
+	assert.Zero(t, nilGroup.Shared())
+}
+
+func TestMovie_clone(t *testing.T) {
+	movie := &Movie{ID: 1, Genres: []string{"drama"}, Attributes: Attributes{"studio": "A24"}}
+
+	c := movie.clone()
+	c.Genres[0] = "comedy"
+	c.Attributes["studio"] = "Neon"
+
+	assert.Equal(t, []string{"drama"}, movie.Genres)
+	assert.Equal(t, Attributes{"studio": "A24"}, movie.Attributes)
+}
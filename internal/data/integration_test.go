@@ -0,0 +1,110 @@
+//go:build integration
+
+package data_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/walkccc/greenlight/internal/data"
+	"github.com/walkccc/greenlight/internal/testdb"
+)
+
+func TestMovieModelIntegration(t *testing.T) {
+	fixtures := testdb.New(t)
+	movies := fixtures.Models.Movies
+	ctx := context.Background()
+
+	moana := fixtures.Movie("Moana")
+	fixtures.Movie("Casablanca")
+
+	movie, err := movies.Get(ctx, data.DefaultOrganizationID, moana.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Moana", movie.Title)
+	assert.Equal(t, []string{"animation", "adventure"}, movie.Genres)
+	assert.Equal(t, int32(1), movie.Version)
+
+	// The movies of the other organizations are out of reach.
+	_, err = movies.Get(ctx, data.DefaultOrganizationID+1, moana.ID)
+	assert.ErrorIs(t, err, data.ErrRecordNotFound)
+
+	listed, metadata, err := movies.GetAll(
+		ctx,
+		data.DefaultOrganizationID,
+		"moana",
+		nil,
+		data.YearRange{},
+		nil,
+		data.Filters{Page: 1, PageSize: 20, Sort: "id", SortSafeValues: []string{"id"}},
+	)
+	require.NoError(t, err)
+	require.Len(t, listed, 1)
+	assert.Equal(t, moana.ID, listed[0].ID)
+	assert.Equal(t, 1, metadata.TotalRecords)
+
+	movie.Year = 2017
+	changed, err := movies.Update(ctx, movie)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"year"}, changed)
+	assert.Equal(t, int32(2), movie.Version)
+
+	// An update of the version that was just replaced conflicts.
+	stale := *moana
+	stale.Title = "Moana 2"
+	_, err = movies.Update(ctx, &stale)
+	assert.True(t, errors.Is(err, data.ErrEditConflict), err)
+
+	err = movies.Delete(ctx, data.DefaultOrganizationID, moana.ID, movie.Version)
+	require.NoError(t, err)
+	_, err = movies.Get(ctx, data.DefaultOrganizationID, moana.ID)
+	assert.ErrorIs(t, err, data.ErrRecordNotFound)
+}
+
+func TestUserModelIntegration(t *testing.T) {
+	fixtures := testdb.New(t)
+	ctx := context.Background()
+
+	alice := fixtures.User("movies:read")
+	token := fixtures.Token(alice)
+
+	user, err := fixtures.Models.Users.GetForToken(ctx, data.ScopeAuthentication, token)
+	require.NoError(t, err)
+	assert.Equal(t, alice.ID, user.ID)
+	assert.Equal(t, int64(data.DefaultOrganizationID), user.OrganizationID)
+
+	_, err = fixtures.Models.Users.GetForToken(ctx, data.ScopeActivation, token)
+	assert.ErrorIs(t, err, data.ErrRecordNotFound)
+
+	// The emails are unique.
+	duplicate := &data.User{Name: "Bob", Email: alice.Email}
+	require.NoError(t, duplicate.Password.Set("pa55word"))
+	assert.ErrorIs(t, fixtures.Models.Users.Create(ctx, duplicate), data.ErrDuplicateEmail)
+
+	permissions, err := fixtures.Models.Permissions.GetAllForUser(ctx, alice.ID)
+	require.NoError(t, err)
+	assert.True(t, permissions.Include("movies:read"))
+	assert.False(t, permissions.Include("movies:write"))
+}
+
+func TestPermissionModelIntegration(t *testing.T) {
+	fixtures := testdb.New(t)
+	permissions := fixtures.Models.Permissions
+	ctx := context.Background()
+
+	// A wildcard code implies every code with its prefix, and nothing else.
+	editor := fixtures.User("movies:*")
+	granted, err := permissions.GetAllForUser(ctx, editor.ID)
+	require.NoError(t, err)
+	assert.True(t, granted.Include("movies:read"))
+	assert.True(t, granted.Include("movies:write"))
+	assert.False(t, granted.Include("admin:read"))
+
+	// A plain code resolves only to itself.
+	reader := fixtures.User("movies:read")
+	granted, err = permissions.GetAllForUser(ctx, reader.ID)
+	require.NoError(t, err)
+	assert.Equal(t, data.Permissions{"movies:read"}, granted)
+}
@@ -0,0 +1,246 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/walkccc/greenlight/internal/validator"
+)
+
+// OrganizationLimits holds the per-organization limits. A zero value means the organization isn't
+// limited beyond the global limits.
+type OrganizationLimits struct {
+	OrganizationID    int64   `json:"-"`
+	RequestsPerSecond float64 `json:"requests_per_second,omitempty"`
+	Burst             int     `json:"burst,omitempty"`
+	DailyRequestQuota int64   `json:"daily_request_quota,omitempty"`
+	MaxMovies         int64   `json:"max_movies,omitempty"`
+}
+
+// Usage holds an organization's current consumption, along with its limits.
+type Usage struct {
+	Date     string             `json:"date"` // the UTC day the requests are counted for
+	Requests int64              `json:"requests"`
+	Movies   int64              `json:"movies"`
+	Limits   OrganizationLimits `json:"limits"`
+}
+
+func ValidateOrganizationLimits(v *validator.Validator, limits *OrganizationLimits) {
+	v.Check(
+		limits.RequestsPerSecond >= 0,
+		"requests_per_second",
+		validator.CodeTooSmall,
+		"must not be negative",
+	)
+	v.Check(limits.Burst >= 0, "burst", validator.CodeTooSmall, "must not be negative")
+	v.Check(
+		limits.RequestsPerSecond == 0 || limits.Burst > 0,
+		"burst",
+		validator.CodeRequired,
+		"must be provided with requests_per_second",
+	)
+	v.Check(
+		limits.DailyRequestQuota >= 0,
+		"daily_request_quota",
+		validator.CodeTooSmall,
+		"must not be negative",
+	)
+	v.Check(limits.MaxMovies >= 0, "max_movies", validator.CodeTooSmall, "must not be negative")
+}
+
+// nullIfZero converts an unset limit to NULL.
+func nullIfZero[T int | int64 | float64](v T) any {
+	if v == 0 {
+		return nil
+	}
+	return v
+}
+
+// GetLimits returns the organization's limits. An organization without any limits gets the zero
+// value rather than ErrRecordNotFound.
+func (m OrganizationModel) GetLimits(
+	ctx context.Context,
+	organizationID int64,
+) (*OrganizationLimits, error) {
+	query := `
+		SELECT COALESCE(requests_per_second, 0),
+			COALESCE(burst, 0),
+			COALESCE(daily_request_quota, 0),
+			COALESCE(max_movies, 0)
+		FROM organization_limits
+		WHERE organization_id = $1
+	`
+
+	limits := OrganizationLimits{OrganizationID: organizationID}
+
+	ctx, cancel := queryContext(ctx, m.timeout)
+	defer cancel()
+
+	err := m.retry.do(ctx, m.breaker, func() error {
+		return m.DB.QueryRowContext(ctx, query, organizationID).Scan(
+			&limits.RequestsPerSecond,
+			&limits.Burst,
+			&limits.DailyRequestQuota,
+			&limits.MaxMovies,
+		)
+	})
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	return &limits, nil
+}
+
+// SetLimits replaces the organization's limits.
+func (m OrganizationModel) SetLimits(ctx context.Context, limits *OrganizationLimits) error {
+	query := `
+		INSERT INTO organization_limits (
+			organization_id, requests_per_second, burst, daily_request_quota, max_movies
+		)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (organization_id) DO UPDATE
+		SET requests_per_second = EXCLUDED.requests_per_second,
+			burst = EXCLUDED.burst,
+			daily_request_quota = EXCLUDED.daily_request_quota,
+			max_movies = EXCLUDED.max_movies,
+			version = organization_limits.version + 1
+	`
+	args := []any{
+		limits.OrganizationID,
+		nullIfZero(limits.RequestsPerSecond),
+		nullIfZero(limits.Burst),
+		nullIfZero(limits.DailyRequestQuota),
+		nullIfZero(limits.MaxMovies),
+	}
+
+	ctx, cancel := queryContext(ctx, m.timeout)
+	defer cancel()
+
+	return m.retry.do(ctx, m.breaker, func() error {
+		_, err := m.DB.ExecContext(ctx, query, args...)
+		return err
+	})
+}
+
+// AddRequests counts n requests against the organization's usage for the UTC day, given as
+// YYYY-MM-DD, and returns the number of requests made that day by then. The requests are counted
+// in memory and added in batches, so that the usage row isn't written on every request.
+func (m OrganizationModel) AddRequests(
+	ctx context.Context,
+	organizationID int64,
+	day string,
+	n int64,
+) (int64, error) {
+	query := `
+		INSERT INTO organization_usage (organization_id, day, requests)
+		VALUES ($1, $2::date, $3)
+		ON CONFLICT (organization_id, day) DO UPDATE
+		SET requests = organization_usage.requests + EXCLUDED.requests
+		RETURNING requests
+	`
+
+	ctx, cancel := queryContext(ctx, m.timeout)
+	defer cancel()
+
+	var requests int64
+	err := m.retry.do(ctx, m.breaker, func() error {
+		return m.DB.QueryRowContext(ctx, query, organizationID, day, n).Scan(&requests)
+	})
+	return requests, err
+}
+
+// MovieLimitError is returned when the organization's movies would exceed its max_movies limit.
+type MovieLimitError struct {
+	MaxMovies int64
+}
+
+func (e *MovieLimitError) Error() string {
+	return fmt.Sprintf("models: the organization has reached its limit of %d movies", e.MaxMovies)
+}
+
+// reserveMovies returns how many of n new movies fit under the organization's max_movies limit,
+// along with the limit (zero if there's none, in which case they all fit). It locks the
+// organization's limits until the transaction ends, so that the concurrent inserts into the
+// organization wait for each other and can't overshoot the limit between them.
+func reserveMovies(
+	ctx context.Context,
+	tx *sql.Tx,
+	organizationID int64,
+	n int,
+) (int, int64, error) {
+	lockQuery := `
+		SELECT max_movies
+		FROM organization_limits
+		WHERE organization_id = $1
+			AND max_movies IS NOT NULL
+		FOR UPDATE
+	`
+	countQuery := `
+		SELECT count(*)
+		FROM movies
+		WHERE organization_id = $1
+			AND deleted_at IS NULL
+	`
+
+	var maxMovies int64
+	err := tx.QueryRowContext(ctx, lockQuery, organizationID).Scan(&maxMovies)
+	if errors.Is(err, sql.ErrNoRows) {
+		return n, 0, nil
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+
+	// The count runs once the lock is held, so it sees the movies of the inserts it waited for.
+	var movies int64
+	err = tx.QueryRowContext(ctx, countQuery, organizationID).Scan(&movies)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	remaining := maxMovies - movies
+	switch {
+	case remaining <= 0:
+		return 0, maxMovies, nil
+	case remaining < int64(n):
+		return int(remaining), maxMovies, nil
+	default:
+		return n, maxMovies, nil
+	}
+}
+
+// GetUsage returns the organization's consumption for the current UTC day, along with its limits.
+func (m OrganizationModel) GetUsage(ctx context.Context, organizationID int64) (*Usage, error) {
+	limits, err := m.GetLimits(ctx, organizationID)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+		SELECT to_char((now() AT TIME ZONE 'UTC')::date, 'YYYY-MM-DD'),
+			COALESCE((
+				SELECT requests
+				FROM organization_usage
+				WHERE organization_id = $1
+					AND day = (now() AT TIME ZONE 'UTC')::date
+			), 0),
+			(SELECT count(*) FROM movies WHERE organization_id = $1 AND deleted_at IS NULL)
+	`
+
+	usage := Usage{Limits: *limits}
+
+	ctx, cancel := queryContext(ctx, m.timeout)
+	defer cancel()
+
+	err = m.retry.do(ctx, m.breaker, func() error {
+		return m.DB.QueryRowContext(ctx, query, organizationID).
+			Scan(&usage.Date, &usage.Requests, &usage.Movies)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &usage, nil
+}
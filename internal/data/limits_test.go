@@ -0,0 +1,131 @@
+package data
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	movieLimitQuery = `SELECT max_movies FROM organization_limits WHERE organization_id = \$1 ` +
+		`AND max_movies IS NOT NULL FOR UPDATE`
+	movieCountQuery = `SELECT count\(\*\) FROM movies WHERE organization_id = \$1 ` +
+		`AND deleted_at IS NULL`
+)
+
+// expectNoMovieLimit expects the organization's limits to be locked, and it to have no movie
+// limit.
+func expectNoMovieLimit(mock sqlmock.Sqlmock, organizationID int64) {
+	mock.ExpectQuery(movieLimitQuery).
+		WithArgs(organizationID).
+		WillReturnRows(sqlmock.NewRows([]string{"max_movies"}))
+}
+
+// expectMovieLimit expects the organization's limits to be locked, and it to have maxMovies as its
+// movie limit and the given number of movies.
+func expectMovieLimit(mock sqlmock.Sqlmock, organizationID, maxMovies, movies int64) {
+	mock.ExpectQuery(movieLimitQuery).
+		WithArgs(organizationID).
+		WillReturnRows(sqlmock.NewRows([]string{"max_movies"}).AddRow(maxMovies))
+	mock.ExpectQuery(movieCountQuery).
+		WithArgs(organizationID).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(movies))
+}
+
+func TestOrganizationModel_AddRequests(t *testing.T) {
+	db, mock := NewMock(t)
+	defer db.Close()
+
+	mock.ExpectQuery(`INSERT INTO organization_usage \(organization_id, day, requests\) `+
+		`VALUES \(\$1, \$2::date, \$3\) ON CONFLICT \(organization_id, day\) DO UPDATE `+
+		`SET requests = organization_usage.requests \+ EXCLUDED.requests RETURNING requests`).
+		WithArgs(7, "2022-01-01", 25).
+		WillReturnRows(sqlmock.NewRows([]string{"requests"}).AddRow(125))
+
+	model := OrganizationModel{DB: db}
+	requests, err := model.AddRequests(context.Background(), 7, "2022-01-01", 25)
+	require.NoError(t, err)
+	assert.Equal(t, int64(125), requests)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMovieModel_Create_MovieLimit(t *testing.T) {
+	movie := &Movie{OrganizationID: 7, Title: "Moana", Year: 2016, Runtime: 107}
+
+	t.Run("UnderTheLimit", func(t *testing.T) {
+		db, mock := NewMock(t)
+		defer db.Close()
+
+		mock.ExpectBegin()
+		expectMovieLimit(mock, 7, 10, 9)
+		mock.ExpectQuery(`INSERT INTO movies`).
+			WithArgs(7, "Moana", 2016, 107, pq.Array([]string(nil)), Attributes(nil)).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "updated_at", "version"}).
+				AddRow(1, time.Now(), time.Now(), 1))
+		mock.ExpectExec(`INSERT INTO outbox`).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		err := MovieModel{DB: db}.Create(context.Background(), movie)
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), movie.ID)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("LimitReached", func(t *testing.T) {
+		db, mock := NewMock(t)
+		defer db.Close()
+
+		// The movie isn't inserted, and the lock is released with the transaction.
+		mock.ExpectBegin()
+		expectMovieLimit(mock, 7, 10, 10)
+		mock.ExpectRollback()
+
+		err := MovieModel{DB: db}.Create(context.Background(), movie)
+		var limitErr *MovieLimitError
+		require.ErrorAs(t, err, &limitErr)
+		assert.Equal(t, int64(10), limitErr.MaxMovies)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestMovieModel_InsertMany_MovieLimit(t *testing.T) {
+	defaultChunkSize := copyChunkSize
+	copyChunkSize = 2
+	defer func() { copyChunkSize = defaultChunkSize }()
+
+	movies := []*Movie{
+		{OrganizationID: 7, Title: "Movie 1", Year: 2001, Runtime: 90},
+		{OrganizationID: 7, Title: "Movie 2", Year: 2002, Runtime: 91},
+		{OrganizationID: 7, Title: "Movie 3", Year: 2003, Runtime: 92},
+	}
+
+	db, mock := NewMock(t)
+	defer db.Close()
+
+	// One movie fits under the limit, so the first chunk is cut short, and the second one isn't
+	// copied at all.
+	mock.ExpectBegin()
+	expectMovieLimit(mock, 7, 5, 4)
+	prep := mock.ExpectPrepare(`COPY "movies"`)
+	prep.ExpectExec().
+		WithArgs(7, "Movie 1", 2001, 90, pq.Array([]string(nil)), Attributes(nil)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	prep.ExpectExec().WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+
+	mock.ExpectBegin()
+	expectMovieLimit(mock, 7, 5, 5)
+	mock.ExpectRollback()
+
+	inserted, err := MovieModel{DB: db}.InsertMany(context.Background(), movies)
+	assert.Equal(t, 1, inserted)
+	var limitErr *MovieLimitError
+	require.ErrorAs(t, err, &limitErr)
+	assert.Equal(t, int64(5), limitErr.MaxMovies)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
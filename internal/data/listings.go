@@ -0,0 +1,81 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// servedByListings reports whether a listing can be served by the movie_listings table, i.e. it
+// isn't filtered and it's sorted by ID or title, which the table's indexes cover.
+func (m MovieModel) servedByListings(
+	title string,
+	genres []string,
+	years YearRange,
+	attributes AttributeFilter,
+	filters Filters,
+) bool {
+	if !m.listings || title != "" || len(genres) > 0 || years != (YearRange{}) {
+		return false
+	}
+	if len(attributes) > 0 {
+		return false
+	}
+
+	switch filters.sortColumn() {
+	case "id", "title":
+		return true
+	default:
+		return false
+	}
+}
+
+// getListing returns a page of the organization's movies from the movie_listings table, whose
+// total comes from the movie_listing_counts table rather than from counting the movies, whatever
+// the count strategy (except CountNone).
+func (m MovieModel) getListing(
+	ctx context.Context,
+	organizationID int64,
+	filters Filters,
+) ([]*Movie, Metadata, error) {
+	query := fmt.Sprintf(`
+		SELECT id, organization_id, created_at, updated_at, title, year, runtime, genres,
+			attributes, version
+		FROM movie_listings
+		WHERE organization_id = $1
+		ORDER BY %s %s, id ASC
+		LIMIT $2 OFFSET $3
+	`, filters.sortColumn(), filters.sortDirection())
+	args := []any{organizationID, filters.limit(), filters.offset()}
+
+	records, err := queryMany(ctx, m.conn(), query, args, movieDests)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	movies := make([]*Movie, len(records))
+	for i := range records {
+		movies[i] = &records[i]
+	}
+
+	if filters.countStrategy() == CountNone {
+		return movies, calculateUncountedMetadata(filters.Page, filters.PageSize), nil
+	}
+
+	total, err := queryOne(
+		ctx,
+		m.conn(),
+		`SELECT total FROM movie_listing_counts WHERE organization_id = $1`,
+		[]any{organizationID},
+		func(total *int) []any { return []any{total} },
+	)
+	switch {
+	case errors.Is(err, ErrRecordNotFound):
+		// The organization has never had any movies.
+		return movies, Metadata{}, nil
+	case err != nil:
+		return nil, Metadata{}, err
+	}
+
+	return movies, calculateMetadata(*total, filters.Page, filters.PageSize), nil
+}
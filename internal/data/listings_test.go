@@ -0,0 +1,60 @@
+package data
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMovieModel_GetAll_Listings(t *testing.T) {
+	db, mock := NewMock(t)
+	defer db.Close()
+
+	model := MovieModel{DB: db, listings: true}
+	filters := Filters{
+		Page:           2,
+		PageSize:       1,
+		Sort:           "-title",
+		SortSafeValues: MovieSortSafeValues,
+	}
+	createdAt := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	mock.ExpectQuery(`FROM movie_listings WHERE organization_id = \$1 `+
+		`ORDER BY title DESC, id ASC LIMIT \$2 OFFSET \$3`).
+		WithArgs(1, 1, 1).
+		WillReturnRows(sqlmock.NewRows(
+			[]string{
+				"id", "organization_id", "created_at", "updated_at", "title", "year", "runtime",
+				"genres", "attributes", "version",
+			},
+		).AddRow(2, 1, createdAt, createdAt, "Moana", 2016, 107, "{animation}", "{}", 1))
+	mock.ExpectQuery(`SELECT total FROM movie_listing_counts WHERE organization_id = \$1`).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"total"}).AddRow(3))
+
+	movies, metadata, err := model.GetAll(
+		context.Background(),
+		1,
+		"",
+		[]string{},
+		YearRange{},
+		nil,
+		filters,
+	)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(movies))
+	assert.Equal(t, "Moana", movies[0].Title)
+	assert.Equal(t, 3, metadata.TotalRecords)
+	assert.Equal(t, 3, metadata.LastPage)
+
+	// The filtered listings still query the movies table.
+	assert.False(t, model.servedByListings("moana", []string{}, YearRange{}, nil, filters))
+	assert.False(t, model.servedByListings("", []string{}, YearRange{From: 1990}, nil, filters))
+	attributes := AttributeFilter{"studio": "A24"}
+	assert.False(t, model.servedByListings("", []string{}, YearRange{}, attributes, filters))
+
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
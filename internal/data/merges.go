@@ -0,0 +1,87 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+)
+
+// Merge merges the duplicate movie into the canonical one: the notifications about the duplicate
+// are moved over to the canonical movie, the duplicate is soft-deleted, and its ID is redirected
+// to the canonical movie's. It returns ErrRecordNotFound unless both movies exist in the
+// organization.
+func (m MovieModel) Merge(
+	ctx context.Context,
+	organizationID, duplicateID, canonicalID int64,
+) error {
+	lockQuery := `
+		SELECT count(*)
+		FROM (
+			SELECT id
+			FROM movies
+			WHERE id IN ($1, $2)
+				AND organization_id = $3
+				AND deleted_at IS NULL
+			FOR UPDATE
+		) AS locked
+	`
+	notificationsQuery := `
+		UPDATE notifications
+		SET movie_id = $2
+		WHERE movie_id = $1
+	`
+	deleteQuery := `
+		UPDATE movies
+		SET deleted_at = now(),
+			version = version + 1
+		WHERE id = $1
+	`
+
+	if duplicateID < 1 || canonicalID < 1 || duplicateID == canonicalID {
+		return ErrRecordNotFound
+	}
+
+	ctx, cancel := queryContext(ctx, m.timeout)
+	defer cancel()
+
+	defer m.gets.forget(movieKey{organizationID: organizationID, id: duplicateID})
+
+	return m.retry.do(ctx, m.breaker, func() error {
+		return withTx(ctx, m.DB, func(tx *sql.Tx) error {
+			var locked int
+			err := tx.QueryRowContext(ctx, lockQuery, duplicateID, canonicalID, organizationID).
+				Scan(&locked)
+			if err != nil {
+				return err
+			}
+			if locked != 2 {
+				return ErrRecordNotFound
+			}
+
+			_, err = tx.ExecContext(ctx, notificationsQuery, duplicateID, canonicalID)
+			if err != nil {
+				return err
+			}
+
+			_, err = tx.ExecContext(ctx, deleteQuery, duplicateID)
+			if err != nil {
+				return err
+			}
+
+			err = insertRedirect(ctx, tx, ResourceMovies, organizationID, duplicateID, canonicalID)
+			if err != nil {
+				return err
+			}
+
+			return insertOutboxEvent(ctx, tx, EventMovieMerged, duplicateID, movieMerged{
+				ID:         duplicateID,
+				MergedInto: canonicalID,
+			})
+		})
+	})
+}
+
+// movieMerged is the payload of the movie.merged events.
+type movieMerged struct {
+	ID         int64 `json:"id"`
+	MergedInto int64 `json:"merged_into"`
+}
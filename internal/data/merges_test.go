@@ -0,0 +1,60 @@
+package data
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMovieModel_Merge(t *testing.T) {
+	lockQuery := `SELECT count\(\*\) FROM \( SELECT id FROM movies WHERE id IN \(\$1, \$2\)`
+
+	t.Run("Success", func(t *testing.T) {
+		db, mock := NewMock(t)
+		defer db.Close()
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(lockQuery).
+			WithArgs(2, 1, 1).
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
+		mock.ExpectExec(`UPDATE notifications SET movie_id = \$2 WHERE movie_id = \$1`).
+			WithArgs(2, 1).
+			WillReturnResult(sqlmock.NewResult(0, 3))
+		mock.ExpectExec(`UPDATE movies SET deleted_at = now\(\)`).
+			WithArgs(2).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(`UPDATE resource_redirects SET new_id = \$4`).
+			WithArgs(ResourceMovies, 1, 2, 1).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec(`INSERT INTO resource_redirects`).
+			WithArgs(ResourceMovies, 1, 2, 1).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(`INSERT INTO outbox`).
+			WithArgs(EventMovieMerged, 2, []byte(`{"id":2,"merged_into":1}`)).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+
+		assert.Nil(t, MovieModel{DB: db}.Merge(context.Background(), 1, 2, 1))
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("NotFound", func(t *testing.T) {
+		db, mock := NewMock(t)
+		defer db.Close()
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(lockQuery).
+			WithArgs(2, 1, 1).
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+		mock.ExpectRollback()
+
+		assert.Equal(t, ErrRecordNotFound, MovieModel{DB: db}.Merge(context.Background(), 1, 2, 1))
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Itself", func(t *testing.T) {
+		assert.Equal(t, ErrRecordNotFound, MovieModel{}.Merge(context.Background(), 1, 1, 1))
+	})
+}
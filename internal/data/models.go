@@ -3,6 +3,8 @@ package data
 import (
 	"database/sql"
 	"errors"
+	"fmt"
+	"time"
 )
 
 var (
@@ -10,18 +12,245 @@ var (
 	ErrEditConflict   = errors.New("edit conflict")
 )
 
+// Config holds the settings that control how the models talk to the database.
+type Config struct {
+	// PrepareStatements enables caching prepared statements for the hot queries. Disable it when
+	// running behind a pooler that doesn't support prepared statements (e.g. PgBouncer in
+	// transaction mode).
+	PrepareStatements bool
+
+	// QueryTimeout is how long a query may run, unless the caller's context expires first. Zero
+	// means DefaultQueryTimeout.
+	QueryTimeout time.Duration
+
+	// Listings enables serving the unfiltered movie listings sorted by ID or title from the
+	// movie_listings table, which a trigger keeps in sync with the movies, rather than from the
+	// movies table. Their totals come from a per-organization count instead of counting the
+	// movies.
+	Listings bool
+
+	// BreakerThreshold is the number of consecutive failures (connection errors or timeouts) after
+	// which the circuit breaker opens and the models fail fast with ErrDatabaseUnavailable. Zero
+	// disables the breaker.
+	BreakerThreshold int
+	// BreakerCooldown is how long the breaker stays open before letting a trial query through.
+	BreakerCooldown time.Duration
+
+	// MaxRetries is the number of times a query is run again after a transient error, such as a
+	// serialization failure or a failover. Zero disables the retries.
+	MaxRetries int
+	// RetryBackoff is the most the first retry waits for. The backoff doubles with every retry.
+	RetryBackoff time.Duration
+
+	// EmailKeys encrypts the users' emails and the signing keys' secrets. If it's nil, they're
+	// stored in plaintext.
+	EmailKeys *Keyring
+
+	// TokenSecret is the server secret that the new tokens are hashed with (see TokenHashHMAC). If
+	// it's nil, they're hashed with SHA-256. The tokens hashed with SHA-256 keep working once it's
+	// set, and they're rehashed with it when they're used.
+	TokenSecret []byte
+
+	// PermissionCacheTTL is how long the users' permissions are cached for. Zero disables the
+	// cache.
+	PermissionCacheTTL time.Duration
+}
+
 type Models struct {
-	Movies      MovieModelInterface
-	Users       UserModelInterface
-	Tokens      TokenModelInterface
-	Permissions PermissionModelInterface
+	Movies          MovieModelInterface
+	Users           UserModelInterface
+	Tokens          TokenModelInterface
+	Permissions     PermissionModelInterface
+	Organizations   OrganizationModelInterface
+	SavedSearches   SavedSearchModelInterface
+	Notifications   NotificationModelInterface
+	Outbox          OutboxModelInterface
+	Redirects       RedirectModelInterface
+	Archive         ArchiveModelInterface
+	SigningKeys     SigningKeyModelInterface
+	ServiceAccounts ServiceAccountModelInterface
+	Attributes      AttributeModelInterface
+	Posters         PosterModelInterface
+
+	// Search runs the movie searches. It queries the movies table unless it's replaced by another
+	// backend, such as an ElasticsearchSearchIndex.
+	Search SearchIndex
+
+	stmts   *statements
+	breaker *breaker
+	retry   *retryPolicy
+	stats   *queryStats
+	perms   *permissionCache
+	gets    *flightGroup[movieKey, *Movie]
 }
 
-func NewModels(db *sql.DB) Models {
+func NewModels(db *sql.DB, cfg Config) Models {
+	var stmts *statements
+	if cfg.PrepareStatements {
+		stmts = newStatements(db)
+	}
+
+	// The breaker and the retry budget are shared by all the models, since they all depend on the
+	// same database.
+	breaker := newBreaker(cfg.BreakerThreshold, cfg.BreakerCooldown)
+	retry := newRetryPolicy(cfg.MaxRetries, cfg.RetryBackoff)
+	timeout := cfg.QueryTimeout
+	stats := newQueryStats()
+	perms := newPermissionCache(cfg.PermissionCacheTTL)
+
+	movies := MovieModel{
+		DB:       db,
+		stmts:    stmts,
+		breaker:  breaker,
+		retry:    retry,
+		timeout:  timeout,
+		stats:    stats,
+		listings: cfg.Listings,
+		gets:     newFlightGroup[movieKey, *Movie](),
+	}
+	keys := cfg.EmailKeys
+	hasher := tokenHasher{secret: cfg.TokenSecret}
+	users := UserModel{
+		DB:      db,
+		stmts:   stmts,
+		breaker: breaker,
+		retry:   retry,
+		timeout: timeout,
+		keys:    keys,
+		hasher:  hasher,
+	}
+	tokens := TokenModel{
+		DB:      db,
+		breaker: breaker,
+		retry:   retry,
+		timeout: timeout,
+		hasher:  hasher,
+	}
+	organizations := OrganizationModel{
+		DB:      db,
+		breaker: breaker,
+		retry:   retry,
+		timeout: timeout,
+		keys:    keys,
+	}
+	searches := SavedSearchModel{
+		DB:      db,
+		breaker: breaker,
+		retry:   retry,
+		timeout: timeout,
+		keys:    keys,
+	}
+	var permissions PermissionModelInterface = PermissionModel{
+		DB:      db,
+		breaker: breaker,
+		retry:   retry,
+		timeout: timeout,
+	}
+	if perms != nil {
+		permissions = cachedPermissionModel{PermissionModelInterface: permissions, cache: perms}
+	}
+	notifications := NotificationModel{
+		DB:      db,
+		breaker: breaker,
+		retry:   retry,
+		timeout: timeout,
+		keys:    keys,
+	}
+	signingKeys := SigningKeyModel{
+		DB:      db,
+		breaker: breaker,
+		retry:   retry,
+		timeout: timeout,
+		keys:    keys,
+	}
+	serviceAccounts := ServiceAccountModel{
+		DB:      db,
+		breaker: breaker,
+		retry:   retry,
+		timeout: timeout,
+	}
+
 	return Models{
-		Movies:      MovieModel{DB: db},
-		Users:       UserModel{DB: db},
-		Tokens:      TokenModel{DB: db},
-		Permissions: PermissionModel{DB: db},
+		Movies:          movies,
+		Users:           users,
+		Tokens:          tokens,
+		Permissions:     permissions,
+		Organizations:   organizations,
+		SavedSearches:   searches,
+		Notifications:   notifications,
+		Outbox:          OutboxModel{DB: db, breaker: breaker},
+		Redirects:       RedirectModel{DB: db, breaker: breaker, retry: retry, timeout: timeout},
+		Archive:         ArchiveModel{DB: db, breaker: breaker, retry: retry},
+		SigningKeys:     signingKeys,
+		ServiceAccounts: serviceAccounts,
+		Attributes:      AttributeModel{DB: db, breaker: breaker, retry: retry, timeout: timeout},
+		Posters:         PosterModel{DB: db, breaker: breaker, retry: retry, timeout: timeout},
+		Search:          PostgresSearchIndex{Movies: movies},
+		stmts:           stmts,
+		breaker:         breaker,
+		retry:           retry,
+		stats:           stats,
+		perms:           perms,
+		gets:            movies.gets,
 	}
 }
+
+// BreakerState returns the current state of the database circuit breaker (BreakerClosed,
+// BreakerOpen or BreakerHalfOpen).
+func (m Models) BreakerState() string {
+	return m.breaker.State()
+}
+
+// RetryStats returns the counters of the query retries.
+func (m Models) RetryStats() RetryStats {
+	return m.retry.Stats()
+}
+
+// QueryOutcomes returns how the movie listing queries ended, per kind of filter.
+func (m Models) QueryOutcomes() map[string]QueryOutcomes {
+	return m.stats.snapshot()
+}
+
+// PermissionCacheStats returns the counters of the permission cache.
+func (m Models) PermissionCacheStats() PermissionCacheStats {
+	return m.perms.Stats()
+}
+
+// CoalescedMovieReads returns how many reads of a movie shared the query of a concurrent one.
+func (m Models) CoalescedMovieReads() int64 {
+	return m.gets.Shared()
+}
+
+// Close releases the resources held by the models, such as the cached prepared statements. It
+// should be called before closing the underlying connection pool.
+func (m Models) Close() error {
+	return m.stmts.Close()
+}
+
+// utcTime scans a timestamp in UTC, whatever the connection's time zone is, so that the API always
+// returns RFC 3339 timestamps in UTC.
+type utcTime time.Time
+
+func (t *utcTime) Scan(src any) error {
+	v, ok := src.(time.Time)
+	if !ok {
+		return fmt.Errorf("cannot scan %T into a timestamp", src)
+	}
+	*t = utcTime(v.UTC())
+	return nil
+}
+
+// utc returns a scan destination that stores the timestamp in t, in UTC.
+func utc(t *time.Time) sql.Scanner {
+	return (*utcTime)(t)
+}
+
+// Link is a hypermedia link from a resource to a related endpoint.
+type Link struct {
+	Href   string `json:"href"`
+	Method string `json:"method,omitempty"` // omitted for GET
+}
+
+// Links holds a resource's links, keyed by their relation (e.g. self). They depend on the request
+// (e.g. its API version), so they're set per response and never stored.
+type Links map[string]Link
@@ -3,212 +3,1110 @@ package data
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
+	"encoding/xml"
 	"errors"
 	"fmt"
+	"html"
+	"reflect"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/lib/pq"
+	"github.com/walkccc/greenlight/internal/msgpack"
 	"github.com/walkccc/greenlight/internal/validator"
 )
 
 type Movie struct {
-	ID        int64     `json:"id"`
-	CreatedAt time.Time `json:"-"`
-	Title     string    `json:"title"`
-	Year      int32     `json:"year,omitempty"`
-	Runtime   Runtime   `json:"runtime,omitempty"`
-	Genres    []string  `json:"genres,omitempty"`
-	Version   int32     `json:"version"`
+	ID             int64     `json:"id" xml:"id"`
+	OrganizationID int64     `json:"-" xml:"-"`
+	CreatedAt      time.Time `json:"created_at" xml:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at" xml:"updated_at"`
+	Title          string    `json:"title" xml:"title"`
+	Year           int32     `json:"year" xml:"year,omitempty"`
+	Runtime        Runtime   `json:"runtime" xml:"runtime,omitempty"`
+	Genres         []string  `json:"genres" xml:"genres>genre,omitempty"`
+	Version        int32     `json:"version" xml:"version"`
+
+	// Attributes holds the values of the custom attributes. They aren't encoded as XML, whose
+	// elements would have to be named after them.
+	Attributes Attributes `json:"attributes" xml:"-"`
+
+	// Poster is set on the responses holding a single movie, if it has one, to describe its
+	// variants. They're downloaded from "GET /v1/movies/:id/poster".
+	Poster *Poster `json:"poster,omitempty" xml:"-"`
+
+	// RuntimeFormat is the format the runtime is encoded in. It's chosen per response, so it isn't
+	// stored, and the zero value means RuntimeMins.
+	RuntimeFormat RuntimeFormat `json:"-" xml:"-"`
+
+	// Match is set by the search backends that rank and highlight the movies matching a title
+	// search.
+	Match *MovieMatch `json:"match,omitempty" xml:"match,omitempty"`
+
+	// Links aren't encoded as XML, whose elements can't be keyed by the relation.
+	Links Links `json:"_links,omitempty" xml:"-"`
+}
+
+// MovieMatch describes how well a movie matched a title search.
+type MovieMatch struct {
+	Score          float64 `json:"score" xml:"score"`
+	TitleHighlight string  `json:"title_highlight,omitempty" xml:"title_highlight,omitempty"`
+}
+
+// MarshalJSON encodes the movie with its runtime in the movie's RuntimeFormat.
+func (m Movie) MarshalJSON() ([]byte, error) {
+	return json.Marshal(m.encodable())
+}
+
+// MarshalMsgpack is like MarshalJSON, but encodes the movie as MessagePack.
+func (m Movie) MarshalMsgpack() ([]byte, error) {
+	return msgpack.Marshal(m.encodable())
+}
+
+// MarshalXML is like MarshalJSON, but encodes the movie as XML.
+func (m Movie) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	return e.EncodeElement(m.encodable(), start)
+}
+
+// encodable returns a value that encodes like the movie, but with its runtime in the movie's
+// RuntimeFormat. Every movie has a year, runtime and genres, so they're encoded even when they're
+// zero, e.g. for a movie that failed validation, rather than left out as if they were optional.
+func (m Movie) encodable() any {
+	// The movie type has the same fields as Movie, but not its methods, so encoding it doesn't
+	// recurse. Its Runtime field is shadowed by the less deeply nested one below.
+	type movie Movie
+
+	aux := struct {
+		movie
+		Runtime any `json:"runtime" xml:"runtime,omitempty"`
+	}{movie: movie(m)}
+
+	aux.Runtime = m.Runtime.formatValue(m.RuntimeFormat)
+	if aux.Genres == nil {
+		aux.Genres = []string{}
+	}
+	if aux.Attributes == nil {
+		aux.Attributes = Attributes{}
+	}
+
+	return aux
+}
+
+// MovieSortSafeValues holds the values that movie listings can be sorted by.
+var MovieSortSafeValues = []string{
+	"id",
+	"title",
+	"year",
+	"runtime",
+	"-id",
+	"-title",
+	"-year",
+	"-runtime",
+	"relevance",
+	"-relevance",
 }
 
 func ValidateMovie(v *validator.Validator, movie *Movie) {
-	v.Check(movie.Title != "", "title", "must be provided")
-	v.Check(len(movie.Title) <= 500, "title", "must not be more than 500 bytes long")
+	v.Check(movie.Title != "", "title", validator.CodeRequired, "must be provided")
+	v.Check(
+		len(movie.Title) <= 500,
+		"title",
+		validator.CodeTooLong,
+		"must not be more than 500 bytes long",
+	)
 
-	v.Check(movie.Year != 0, "year", "must be provided")
-	v.Check(movie.Year > 1894, "year", "must be greater than 1894")
-	v.Check(movie.Year <= int32(time.Now().Year()), "year", "must not be in the future")
+	v.Check(movie.Year != 0, "year", validator.CodeRequired, "must be provided")
+	v.Check(movie.Year > 1894, "year", validator.CodeTooSmall, "must be greater than 1894")
+	v.Check(
+		movie.Year <= int32(time.Now().Year()),
+		"year",
+		validator.CodeTooLarge,
+		"must not be in the future",
+	)
 
-	v.Check(movie.Runtime != 0, "runtime", "must be provided")
-	v.Check(movie.Runtime > 0, "runtime", "must be a positive integer")
+	v.Check(movie.Runtime != 0, "runtime", validator.CodeRequired, "must be provided")
+	v.Check(movie.Runtime > 0, "runtime", validator.CodeTooSmall, "must be a positive integer")
 
-	v.Check(movie.Genres != nil, "genres", "must be provided")
-	v.Check(len(movie.Genres) >= 1, "genres", "must contain at least 1 genre")
-	v.Check(len(movie.Genres) <= 5, "genres", "must not contain more than 5 genres")
-	v.Check(validator.Unique(movie.Genres), "genres", "must not contain duplicate values")
+	v.Check(movie.Genres != nil, "genres", validator.CodeRequired, "must be provided")
+	v.Check(len(movie.Genres) >= 1, "genres", validator.CodeTooFew, "must contain at least 1 genre")
+	v.Check(
+		len(movie.Genres) <= 5,
+		"genres",
+		validator.CodeTooMany,
+		"must not contain more than 5 genres",
+	)
+	v.Check(
+		validator.Unique(movie.Genres),
+		"genres",
+		validator.CodeDuplicate,
+		"must not contain duplicate values",
+	)
 }
 
+// MovieModelInterface is scoped by organization: every method only reads or changes the movies
+// of a single organization, either passed explicitly or taken from the movies' OrganizationID.
 type MovieModelInterface interface {
-	GetAll(title string, genres []string, filters Filters) ([]*Movie, Metadata, error)
-	Create(movie *Movie) error
-	Get(id int64) (*Movie, error)
-	Update(movie *Movie) error
-	Delete(id int64) error
+	GetAll(
+		ctx context.Context,
+		organizationID int64,
+		title string,
+		genres []string,
+		years YearRange,
+		attributes AttributeFilter,
+		filters Filters,
+	) ([]*Movie, Metadata, error)
+	Create(ctx context.Context, movie *Movie) error
+	InsertMany(ctx context.Context, movies []*Movie) (int, error)
+	Get(ctx context.Context, organizationID, id int64) (*Movie, error)
+	Update(ctx context.Context, movie *Movie) ([]string, error)
+	GetRevision(ctx context.Context, organizationID, id int64, version int32) (*Movie, error)
+	Revert(ctx context.Context, movie *Movie, to int32) ([]string, error)
+	Merge(ctx context.Context, organizationID, duplicateID, canonicalID int64) error
+	Delete(ctx context.Context, organizationID, id int64, version int32) error
+	GetFacets(
+		ctx context.Context,
+		organizationID int64,
+		title string,
+		genres []string,
+	) (*MovieFacets, error)
+	SuggestTitles(ctx context.Context, organizationID int64, title string) ([]string, error)
 }
 
 type MovieModel struct {
-	DB *sql.DB
+	DB      *sql.DB
+	stmts   *statements
+	breaker *breaker
+	retry   *retryPolicy
+	timeout time.Duration
+	stats   *queryStats
+
+	// listings enables serving the unfiltered listings from the movie_listings table.
+	listings bool
+
+	// gets coalesces the concurrent reads of the same movie by Get(). The writes forget the
+	// movie's read in flight, if any, since it may have started before them.
+	gets *flightGroup[movieKey, *Movie]
+}
+
+// movieKey identifies a movie read by Get().
+type movieKey struct {
+	organizationID int64
+	id             int64
+}
+
+func (m MovieModel) conn() conn {
+	return conn{db: m.DB, stmts: m.stmts, breaker: m.breaker, retry: m.retry, timeout: m.timeout}
+}
+
+// moviesWhereClause holds the conditions shared by the listing and count queries, where $1 is the
+// organization, $2 the title to search for and $3 the genres a movie must contain.
+const moviesWhereClause = `organization_id = $1
+			AND deleted_at IS NULL
+			AND (to_tsvector('simple', title) @@ plainto_tsquery('simple', $2) OR $2 = '')
+			AND (genres @> $3 OR $3 = '{}')`
+
+// movieMatchColumns holds the relevance and the highlighted title of the movies matching a title
+// search ($2), where $6 holds the highlight options. The matches are wrapped in the
+// headlineStartSel and headlineStopSel control characters, which highlightTitle() replaces once
+// the rest of the title is HTML-escaped.
+const movieMatchColumns = `
+			ts_rank(to_tsvector('simple', title), plainto_tsquery('simple', $2)) AS relevance,
+			ts_headline('simple', title, plainto_tsquery('simple', $2), $6) AS title_highlight`
+
+const (
+	headlineStartSel = "\x02"
+	headlineStopSel  = "\x03"
+	headlineOptions  = `StartSel="` + headlineStartSel + `", StopSel="` + headlineStopSel +
+		`", HighlightAll=true`
+)
+
+var headlineReplacer = strings.NewReplacer(
+	headlineStartSel, "<mark>",
+	headlineStopSel, "</mark>",
+)
+
+// highlightTitle returns the HTML of the ts_headline() output, with its matches in <mark> elements.
+func highlightTitle(headline string) string {
+	return headlineReplacer.Replace(html.EscapeString(headline))
+}
+
+// YearRange restricts a movie listing to the movies released between From and To, inclusive. A
+// zero bound leaves that side of the range open.
+type YearRange struct {
+	From int32
+	To   int32
+}
+
+// conditions returns the SQL conditions of the range, if any, to append to moviesWhereClause, with
+// their values appended to args. The bounds are compared to the year column directly (rather than
+// with, say, ($6 = 0 OR year >= $6)), so that the planner can prune the partitions of the movies
+// table when it's partitioned by year.
+func (r YearRange) conditions(args []any) (string, []any) {
+	var conditions string
+	if r.From != 0 {
+		args = append(args, r.From)
+		conditions += fmt.Sprintf(" AND year >= $%d", len(args))
+	}
+	if r.To != 0 {
+		args = append(args, r.To)
+		conditions += fmt.Sprintf(" AND year <= $%d", len(args))
+	}
+	return conditions, args
+}
+
+// ValidateYearRange checks the bounds of a year range, and that they're in order.
+func ValidateYearRange(v *validator.Validator, r YearRange) {
+	if r.From != 0 && r.To != 0 {
+		v.Check(r.From <= r.To, "year_to", validator.CodeTooSmall, "must not be before year_from")
+	}
 }
 
+// GetAll returns a page of the organization's movies matching the title, genres, years and
+// attributes. When a title is searched for, the movies' Match holds their ts_rank() relevance and
+// highlighted title, and they can be sorted by relevance.
 func (m MovieModel) GetAll(
+	ctx context.Context,
+	organizationID int64,
 	title string,
 	genres []string,
+	years YearRange,
+	attributes AttributeFilter,
 	filters Filters,
 ) ([]*Movie, Metadata, error) {
-	query := fmt.Sprintf(`
-		SELECT
-			count(*) OVER(), id, created_at, title, year, runtime, genres, version
-		FROM movies
-		WHERE
-			(to_tsvector('simple', title) @@ plainto_tsquery('simple', $1) OR $1 = '')
-			AND (genres @> $2 OR $2 = '{}')
-		ORDER BY %s %s, id ASC
-		LIMIT $3 OFFSET $4
-	`, filters.sortColumn(), filters.sortDirection())
+	movies, metadata, err := m.getAll(
+		ctx,
+		organizationID,
+		title,
+		genres,
+		years,
+		attributes,
+		filters,
+	)
+	kind := movieQueryKind("list", title, genres, years, attributes, filters.Sort)
+	m.stats.record(kind, err)
+	return movies, metadata, err
+}
+
+func (m MovieModel) getAll(
+	ctx context.Context,
+	organizationID int64,
+	title string,
+	genres []string,
+	years YearRange,
+	attributes AttributeFilter,
+	filters Filters,
+) ([]*Movie, Metadata, error) {
+	if m.servedByListings(title, genres, years, attributes, filters) {
+		return m.getListing(ctx, organizationID, filters)
+	}
+
+	strategy := filters.countStrategy()
+
+	// The planner's estimate is only any good for the organization filter, which it keeps column
+	// statistics for. Listings filtered by title, genres, years or attributes always fall back to
+	// an exact count.
+	filtered := title != "" || len(genres) > 0 || years != YearRange{} || len(attributes) > 0
+	if strategy == CountEstimated && filtered {
+		strategy = CountExact
+	}
+
+	searching := title != ""
+
+	columns := "id, created_at, updated_at, title, year, runtime, genres, attributes, version"
+	if strategy == CountExact {
+		columns = "count(*) OVER(), " + columns
+	}
+	if searching {
+		columns += "," + movieMatchColumns
+	}
+
+	// Every movie is as relevant as the others without a title search, so they're sorted by ID.
+	orderBy := fmt.Sprintf("%s %s, id ASC", filters.sortColumn(), filters.sortDirection())
+	if filters.sortColumn() == "relevance" && !searching {
+		orderBy = "id ASC"
+	}
+
 	args := []any{
+		organizationID,
 		title,
 		pq.Array(genres),
 		filters.limit(),
 		filters.offset(),
 	}
+	if searching {
+		args = append(args, headlineOptions)
+	}
+	yearConditions, args := years.conditions(args)
+	attributeConditions, args := attributes.conditions(args)
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	query := fmt.Sprintf(`
+		SELECT
+			%s
+		FROM movies
+		WHERE
+			%s%s%s
+		ORDER BY %s
+		LIMIT $4 OFFSET $5
+	`, columns, moviesWhereClause, yearConditions, attributeConditions, orderBy)
+
+	ctx, cancel := queryContext(ctx, m.timeout)
 	defer cancel()
 
-	rows, err := m.DB.QueryContext(ctx, query, args...)
+	// Start counting the matching records in the background, so that the count and the page
+	// query run at the same time on two separate connections. The channel is buffered so that the
+	// goroutine never blocks (and leaks) if we return early because the page query failed.
+	type countResult struct {
+		total int
+		err   error
+	}
+	countCh := make(chan countResult, 1)
+	if strategy == CountParallel {
+		go func() {
+			total, err := m.countMatching(ctx, organizationID, title, genres, years, attributes)
+			countCh <- countResult{total: total, err: err}
+		}()
+	}
+
+	var rows *sql.Rows
+	err := m.retry.do(ctx, m.breaker, func() (err error) {
+		rows, err = m.DB.QueryContext(ctx, query, args...)
+		return err
+	})
 	if err != nil {
 		return nil, Metadata{}, err
 	}
 	defer rows.Close()
 
-	totalRecord := 0
-	movies := []*Movie{}
+	scanner := newMovieRowScanner(strategy == CountExact, searching, filters.limit())
+	movies, err := scanner.scanAll(rows)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	totalRecord := scanner.total
 
-	for rows.Next() {
-		var movie Movie
-		err := rows.Scan(
-			&totalRecord,
-			&movie.ID,
-			&movie.CreatedAt,
-			&movie.Title,
-			&movie.Year,
-			&movie.Runtime,
-			pq.Array(&movie.Genres),
-			&movie.Version,
-		)
+	switch strategy {
+	case CountEstimated:
+		totalRecord, err = m.estimateCount(ctx, organizationID)
 		if err != nil {
 			return nil, Metadata{}, err
 		}
-		movies = append(movies, &movie)
-	}
-	if err = rows.Err(); err != nil {
-		return nil, Metadata{}, err
+		metadata := calculateMetadata(totalRecord, filters.Page, filters.PageSize)
+		metadata.Estimated = totalRecord > 0
+		return movies, metadata, nil
+	case CountParallel:
+		result := <-countCh
+		if result.err != nil {
+			return nil, Metadata{}, result.err
+		}
+		totalRecord = result.total
+	case CountNone:
+		return movies, calculateUncountedMetadata(filters.Page, filters.PageSize), nil
 	}
 
 	metadata := calculateMetadata(totalRecord, filters.Page, filters.PageSize)
 	return movies, metadata, nil
 }
 
-func (m MovieModel) Create(movie *Movie) error {
+// movieRowScanner scans the rows of the movie listings: the listing's columns, preceded by the
+// count(*) OVER() window if the listing is counted, and followed by the match columns if it's a
+// title search. Its scan destinations are built once and reused for every row, and the movies are
+// allocated in blocks of the page size, rather than each row allocating its movie and
+// destinations (and wrapping the genres with pq.Array again).
+type movieRowScanner struct {
+	row      Movie
+	score    float64
+	headline string
+	total    int
+
+	searching bool
+	dest      []any
+	block     []Movie
+	matches   []MovieMatch
+	size      int
+}
+
+func newMovieRowScanner(counted, searching bool, size int) *movieRowScanner {
+	if size < 1 || size > PageSizeCap {
+		size = PageSizeCap
+	}
+
+	s := &movieRowScanner{searching: searching, size: size}
+	if counted {
+		s.dest = append(s.dest, &s.total)
+	}
+	s.dest = append(s.dest,
+		&s.row.ID,
+		utc(&s.row.CreatedAt),
+		utc(&s.row.UpdatedAt),
+		&s.row.Title,
+		&s.row.Year,
+		&s.row.Runtime,
+		pq.Array(&s.row.Genres),
+		&s.row.Attributes,
+		&s.row.Version,
+	)
+	if searching {
+		s.dest = append(s.dest, &s.score, &s.headline)
+	}
+	return s
+}
+
+// scanAll scans the remaining rows, and returns their movies.
+func (s *movieRowScanner) scanAll(rows *sql.Rows) ([]*Movie, error) {
+	movies := make([]*Movie, 0, s.size)
+	for rows.Next() {
+		movie, err := s.scan(rows)
+		if err != nil {
+			return nil, err
+		}
+		movies = append(movies, movie)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return movies, nil
+}
+
+func (s *movieRowScanner) scan(rows *sql.Rows) (*Movie, error) {
+	// The genres are reset, since the scan reuses the previous row's array when it's empty.
+	s.row.Genres = nil
+
+	err := rows.Scan(s.dest...)
+	if err != nil {
+		return nil, err
+	}
+
+	// A new block is allocated once the current one is full, so that the movies already returned
+	// keep their address.
+	if len(s.block) == cap(s.block) {
+		s.block = make([]Movie, 0, s.size)
+	}
+	s.block = append(s.block, s.row)
+	movie := &s.block[len(s.block)-1]
+
+	if s.searching {
+		if len(s.matches) == cap(s.matches) {
+			s.matches = make([]MovieMatch, 0, s.size)
+		}
+		s.matches = append(s.matches, MovieMatch{
+			Score:          s.score,
+			TitleHighlight: highlightTitle(s.headline),
+		})
+		movie.Match = &s.matches[len(s.matches)-1]
+	}
+
+	return movie, nil
+}
+
+// countMatching returns the exact number of the organization's movies matching the title, genres,
+// years and attributes filters.
+func (m MovieModel) countMatching(
+	ctx context.Context,
+	organizationID int64,
+	title string,
+	genres []string,
+	years YearRange,
+	attributes AttributeFilter,
+) (int, error) {
+	yearConditions, args := years.conditions([]any{organizationID, title, pq.Array(genres)})
+	attributeConditions, args := attributes.conditions(args)
+
+	query := fmt.Sprintf(`
+		SELECT count(*)
+		FROM movies
+		WHERE
+			%s%s%s
+	`, moviesWhereClause, yearConditions, attributeConditions)
+
+	var total int
+	err := m.retry.do(ctx, m.breaker, func() error {
+		return m.DB.QueryRowContext(ctx, query, args...).Scan(&total)
+	})
+	return total, err
+}
+
+// GetFacets counts the movies matching the title and genres per genre and per decade, with grouped
+// queries over the same conditions as GetAll().
+func (m MovieModel) GetFacets(
+	ctx context.Context,
+	organizationID int64,
+	title string,
+	genres []string,
+) (*MovieFacets, error) {
+	facets, err := m.getFacets(ctx, organizationID, title, genres)
+	m.stats.record(movieQueryKind("facets", title, genres, YearRange{}, nil, ""), err)
+	return facets, err
+}
+
+func (m MovieModel) getFacets(
+	ctx context.Context,
+	organizationID int64,
+	title string,
+	genres []string,
+) (*MovieFacets, error) {
+	genresQuery := fmt.Sprintf(`
+		SELECT genre, count(*)
+		FROM movies, unnest(genres) AS genre
+		WHERE
+			%s
+		GROUP BY genre
+		ORDER BY count(*) DESC, genre
+	`, moviesWhereClause)
+	decadesQuery := fmt.Sprintf(`
+		SELECT ((year / 10) * 10)::text || 's' AS decade, count(*)
+		FROM movies
+		WHERE
+			%s
+		GROUP BY year / 10
+		ORDER BY year / 10
+	`, moviesWhereClause)
+	args := []any{organizationID, title, pq.Array(genres)}
+
+	var facets MovieFacets
+	var err error
+
+	facets.Genres, err = m.queryFacets(ctx, genresQuery, args)
+	if err != nil {
+		return nil, err
+	}
+
+	facets.Decades, err = m.queryFacets(ctx, decadesQuery, args)
+	if err != nil {
+		return nil, err
+	}
+
+	return &facets, nil
+}
+
+// queryFacets runs a grouped query whose rows hold a facet's value and count.
+func (m MovieModel) queryFacets(
+	ctx context.Context,
+	query string,
+	args []any,
+) ([]FacetCount, error) {
+	return queryMany(ctx, m.conn(), query, args, func(count *FacetCount) []any {
+		return []any{&count.Value, &count.Count}
+	})
+}
+
+// maxTitleSuggestions is the number of titles that SuggestTitles() returns at most.
+const maxTitleSuggestions = 5
+
+// SuggestTitles returns the organization's distinct movie titles that are spelled most like the
+// searched title, for a "did you mean" prompt when the search has no results. The titles are
+// compared with pg_trgm's word similarity, so a misspelled word matches the titles containing it.
+func (m MovieModel) SuggestTitles(
+	ctx context.Context,
+	organizationID int64,
+	title string,
+) ([]string, error) {
 	query := `
-		INSERT INTO movies (title, year, runtime, genres)
-		VALUES ($1, $2, $3, $4)
+		SELECT title
+		FROM movies
+		WHERE organization_id = $1
+			AND deleted_at IS NULL
+			AND $2 <% title
+		GROUP BY title
+		ORDER BY max(word_similarity($2, title)) DESC, title
+		LIMIT $3
+	`
+
+	args := []any{organizationID, title, maxTitleSuggestions}
+
+	return queryMany(ctx, m.conn(), query, args, func(suggestion *string) []any {
+		return []any{suggestion}
+	})
+}
+
+// estimateCount returns the planner's estimate of the number of movies in the organization, which
+// it derives from the statistics ANALYZE keeps on the organization_id column. EXPLAIN doesn't
+// accept bind parameters, so the ID (an integer) is formatted into the query.
+func (m MovieModel) estimateCount(ctx context.Context, organizationID int64) (int, error) {
+	query := fmt.Sprintf(`
+		EXPLAIN (FORMAT JSON)
+		SELECT 1
+		FROM movies
+		WHERE organization_id = %d
+	`, organizationID)
+
+	var js []byte
+	err := m.retry.do(ctx, m.breaker, func() error {
+		return m.DB.QueryRowContext(ctx, query).Scan(&js)
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	var plans []struct {
+		Plan struct {
+			Rows float64 `json:"Plan Rows"`
+		} `json:"Plan"`
+	}
+	err = json.Unmarshal(js, &plans)
+	if err != nil {
+		return 0, err
+	}
+	if len(plans) == 0 {
+		return 0, errors.New("empty query plan")
+	}
+
+	return int(plans[0].Plan.Rows), nil
+}
+
+// Create inserts the movie, unless its organization has reached its max_movies limit, in which
+// case it returns a *MovieLimitError.
+func (m MovieModel) Create(ctx context.Context, movie *Movie) error {
+	query := `
+		INSERT INTO movies (organization_id, title, year, runtime, genres, attributes)
+		VALUES ($1, $2, $3, $4, $5, $6)
 		RETURNING id,
 			created_at,
+			updated_at,
 			version
 	`
 	args := []any{
+		movie.OrganizationID,
 		movie.Title,
 		movie.Year,
 		movie.Runtime,
 		pq.Array(movie.Genres),
+		movie.Attributes,
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := queryContext(ctx, m.timeout)
 	defer cancel()
 
-	return m.DB.QueryRowContext(ctx, query, args...).
-		Scan(&movie.ID, &movie.CreatedAt, &movie.Version)
+	return m.retry.do(ctx, m.breaker, func() error {
+		return withTx(ctx, m.DB, func(tx *sql.Tx) error {
+			allowed, maxMovies, err := reserveMovies(ctx, tx, movie.OrganizationID, 1)
+			if err != nil {
+				return err
+			}
+			if allowed == 0 {
+				return &MovieLimitError{MaxMovies: maxMovies}
+			}
+
+			err = m.stmts.txQueryRowContext(ctx, tx, query, args...).
+				Scan(&movie.ID, utc(&movie.CreatedAt), utc(&movie.UpdatedAt), &movie.Version)
+			if err != nil {
+				return err
+			}
+
+			return insertOutboxEvent(ctx, tx, EventMovieCreated, movie.ID, movie)
+		})
+	})
+}
+
+// copyChunkSize is the number of movies InsertMany() copies in a single transaction.
+var copyChunkSize = 1000
+
+// ChunkError describes a chunk of movies that InsertMany() couldn't insert. Offset is the index of
+// the chunk's first movie in the slice passed to InsertMany().
+type ChunkError struct {
+	Offset int
+	Count  int
+	Err    error
+}
+
+// BulkInsertError is returned by InsertMany() when one or more chunks couldn't be inserted. The
+// chunks that aren't listed were committed successfully.
+type BulkInsertError struct {
+	Chunks []ChunkError
+}
+
+func (e *BulkInsertError) Error() string {
+	return fmt.Sprintf(
+		"failed to insert %d chunk(s) of movies, first error at offset %d: %s",
+		len(e.Chunks),
+		e.Chunks[0].Offset,
+		e.Chunks[0].Err,
+	)
+}
+
+// InsertMany inserts the movies using PostgreSQL's COPY FROM, which is considerably faster than
+// individual INSERT statements for high-volume ingestion such as CSV imports or seeding. The movies
+// are copied in chunks of copyChunkSize, each in its own transaction, so a bad row only fails its
+// own chunk. It returns the number of movies inserted and, if any chunk failed, a
+// *BulkInsertError. Note that COPY doesn't return the generated IDs, so the movies' ID, CreatedAt,
+// UpdatedAt and Version fields are left untouched.
+//
+// The movies beyond their organization's max_movies limit are left out, the earliest ones being
+// inserted, and a *MovieLimitError is returned unless a chunk failed too.
+func (m MovieModel) InsertMany(ctx context.Context, movies []*Movie) (int, error) {
+	inserted := 0
+	var chunkErrors []ChunkError
+	var limitErr *MovieLimitError
+
+	for offset := 0; offset < len(movies); offset += copyChunkSize {
+		end := offset + copyChunkSize
+		if end > len(movies) {
+			end = len(movies)
+		}
+
+		chunk := movies[offset:end]
+		var copied int
+		var maxMovies int64
+		err := m.retry.do(ctx, m.breaker, func() (err error) {
+			copied, maxMovies, err = m.copyChunk(ctx, chunk)
+			return err
+		})
+		if err != nil {
+			chunkErrors = append(chunkErrors, ChunkError{
+				Offset: offset,
+				Count:  len(chunk),
+				Err:    err,
+			})
+			continue
+		}
+		inserted += copied
+		if copied < len(chunk) {
+			limitErr = &MovieLimitError{MaxMovies: maxMovies}
+		}
+	}
+
+	if len(chunkErrors) > 0 {
+		return inserted, &BulkInsertError{Chunks: chunkErrors}
+	}
+	if limitErr != nil {
+		return inserted, limitErr
+	}
+	return inserted, nil
+}
+
+// copyChunk copies a single chunk of movies inside a transaction, leaving out those beyond their
+// organization's max_movies limit. It returns how many it copied, along with the limit of the last
+// organization that had one.
+func (m MovieModel) copyChunk(ctx context.Context, movies []*Movie) (int, int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, 0, err
+	}
+	// Rollback() is a no-op once the transaction has been committed.
+	defer tx.Rollback()
+
+	// The organizations' limits are locked in the order of their IDs, so that two imports into
+	// the same organizations can't deadlock.
+	counts := make(map[int64]int)
+	for _, movie := range movies {
+		counts[movie.OrganizationID]++
+	}
+	organizationIDs := make([]int64, 0, len(counts))
+	for organizationID := range counts {
+		organizationIDs = append(organizationIDs, organizationID)
+	}
+	sort.Slice(organizationIDs, func(i, j int) bool {
+		return organizationIDs[i] < organizationIDs[j]
+	})
+
+	var maxMovies int64
+	total := 0
+	for _, organizationID := range organizationIDs {
+		allowed, limit, err := reserveMovies(ctx, tx, organizationID, counts[organizationID])
+		if err != nil {
+			return 0, 0, err
+		}
+		counts[organizationID] = allowed
+		total += allowed
+		if limit != 0 {
+			maxMovies = limit
+		}
+	}
+	if total == 0 {
+		return 0, maxMovies, nil
+	}
+
+	stmt, err := tx.PrepareContext(
+		ctx,
+		pq.CopyIn(
+			"movies",
+			"organization_id",
+			"title",
+			"year",
+			"runtime",
+			"genres",
+			"attributes",
+		),
+	)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer stmt.Close()
+
+	copied := 0
+	for _, movie := range movies {
+		if counts[movie.OrganizationID] == 0 {
+			continue
+		}
+		counts[movie.OrganizationID]--
+
+		_, err = stmt.ExecContext(
+			ctx,
+			movie.OrganizationID,
+			movie.Title,
+			movie.Year,
+			movie.Runtime,
+			pq.Array(movie.Genres),
+			movie.Attributes,
+		)
+		if err != nil {
+			return 0, 0, err
+		}
+		copied++
+	}
+
+	// Calling Exec() with no arguments flushes the buffered rows to the server.
+	_, err = stmt.ExecContext(ctx)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return copied, maxMovies, tx.Commit()
 }
 
-func (m MovieModel) Get(id int64) (*Movie, error) {
+func (m MovieModel) Get(ctx context.Context, organizationID, id int64) (*Movie, error) {
 	if id < 1 {
 		return nil, ErrRecordNotFound
 	}
 
 	query := `
-		SELECT id, created_at, title, year, runtime, genres, version
+		SELECT id, organization_id, created_at, updated_at, title, year, runtime, genres,
+			attributes, version
 		FROM movies
 		WHERE id = $1
+			AND organization_id = $2
+			AND deleted_at IS NULL
 	`
 
-	var movie Movie
+	key := movieKey{organizationID: organizationID, id: id}
+	movie, err := m.gets.do(ctx, key, func(ctx context.Context) (*Movie, error) {
+		return queryOne(ctx, m.conn(), query, []any{id, organizationID}, movieDests)
+	})
+	if err != nil {
+		return nil, err
+	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
+	// The read may be shared, and the callers modify the movie, e.g. to update it.
+	return movie.clone(), nil
+}
 
-	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+// clone returns a copy of the movie that shares nothing with it that could be modified in place.
+func (movie *Movie) clone() *Movie {
+	c := *movie
+	if movie.Genres != nil {
+		c.Genres = append([]string{}, movie.Genres...)
+	}
+	if movie.Attributes != nil {
+		c.Attributes = make(Attributes, len(movie.Attributes))
+		for name, value := range movie.Attributes {
+			c.Attributes[name] = value
+		}
+	}
+	return &c
+}
+
+// movieDests returns the scan destinations of the columns selected by Get(), in order.
+func movieDests(movie *Movie) []any {
+	return []any{
 		&movie.ID,
-		&movie.CreatedAt,
+		&movie.OrganizationID,
+		utc(&movie.CreatedAt),
+		utc(&movie.UpdatedAt),
 		&movie.Title,
 		&movie.Year,
 		&movie.Runtime,
 		pq.Array(&movie.Genres),
+		&movie.Attributes,
 		&movie.Version,
-	)
-	if err != nil {
-		switch {
-		case errors.Is(err, sql.ErrNoRows):
-			return nil, ErrRecordNotFound
-		default:
-			return nil, err
+	}
+}
+
+// Update saves the changes made to the movie, provided it's still at the version it was read at,
+// and records the version it replaces as a revision. It returns the JSON names of the fields that
+// changed; if none did, nothing is saved and the movie keeps its version.
+func (m MovieModel) Update(ctx context.Context, movie *Movie) ([]string, error) {
+	return m.update(ctx, movie, EventMovieUpdated, 0)
+}
+
+// Revert restores the movie to the revision it was at the given version, as a new version. The
+// revision's fields are expected to have been copied onto the movie, see GetRevision(). The revert
+// is recorded in the outbox as a movie.reverted event. It returns the fields that changed, like
+// Update().
+func (m MovieModel) Revert(ctx context.Context, movie *Movie, to int32) ([]string, error) {
+	return m.update(ctx, movie, EventMovieReverted, to)
+}
+
+// movieChanged is the payload of the movie.updated and movie.reverted events, which only hold the
+// new values of the fields that changed.
+type movieChanged struct {
+	ID         int64          `json:"id"`
+	Version    int32          `json:"version"`
+	UpdatedAt  time.Time      `json:"updated_at"`
+	Changes    map[string]any `json:"changes"`
+	RevertedTo int32          `json:"reverted_to,omitempty"`
+}
+
+// changedFields compares the fields that can be updated between two states of a movie, and returns
+// the new values of those that differ keyed by their JSON names, along with the names in the order
+// the fields are declared.
+func changedFields(before, after *Movie) ([]string, map[string]any) {
+	fields := []string{}
+	changes := map[string]any{}
+
+	add := func(changed bool, field string, value any) {
+		if changed {
+			fields = append(fields, field)
+			changes[field] = value
 		}
 	}
 
-	return &movie, nil
+	add(before.Title != after.Title, "title", after.Title)
+	add(before.Year != after.Year, "year", after.Year)
+	add(before.Runtime != after.Runtime, "runtime", after.Runtime)
+	add(!equalGenres(before.Genres, after.Genres), "genres", after.Genres)
+	add(!equalAttributes(before.Attributes, after.Attributes), "attributes", after.Attributes)
+
+	return fields, changes
 }
 
-func (m MovieModel) Update(movie *Movie) error {
+func equalGenres(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// equalAttributes reports whether the movies' attributes hold the same values. A movie without
+// attributes equals one with an empty set of them.
+func equalAttributes(a, b Attributes) bool {
+	return len(a) == 0 && len(b) == 0 || reflect.DeepEqual(a, b)
+}
+
+// update saves the movie like Update(), with an outbox event of the given kind. revertedTo is the
+// version restored, if it's a revert.
+func (m MovieModel) update(
+	ctx context.Context,
+	movie *Movie,
+	eventKind string,
+	revertedTo int32,
+) ([]string, error) {
+	currentQuery := `
+		SELECT title, year, runtime, genres, attributes
+		FROM movies
+		WHERE id = $1
+			AND organization_id = $2
+			AND version = $3
+			AND deleted_at IS NULL
+		FOR UPDATE
+	`
 	query := `
 		UPDATE movies
 		SET title = $1,
 			year = $2,
 			runtime = $3,
 			genres = $4,
+			attributes = $5,
+			updated_at = now(),
 			version = version + 1
-		WHERE id = $5
-			AND version = $6
-		RETURNING version
+		WHERE id = $6
+			AND organization_id = $7
+			AND version = $8
+			AND deleted_at IS NULL
+		RETURNING updated_at,
+			version
 	`
 	args := []any{
 		movie.Title,
 		movie.Year,
 		movie.Runtime,
 		pq.Array(movie.Genres),
+		movie.Attributes,
 		movie.ID,
+		movie.OrganizationID,
 		movie.Version,
 	}
 
 	fmt.Println(args)
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := queryContext(ctx, m.timeout)
 	defer cancel()
 
-	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&movie.Version)
+	defer m.gets.forget(movieKey{organizationID: movie.OrganizationID, id: movie.ID})
+
+	var fields []string
+
+	err := m.retry.do(ctx, m.breaker, func() error {
+		return withTx(ctx, m.DB, func(tx *sql.Tx) error {
+			var current Movie
+
+			err := tx.QueryRowContext(
+				ctx,
+				currentQuery,
+				movie.ID,
+				movie.OrganizationID,
+				movie.Version,
+			).Scan(
+				&current.Title,
+				&current.Year,
+				&current.Runtime,
+				pq.Array(&current.Genres),
+				&current.Attributes,
+			)
+			if err != nil {
+				return err
+			}
+
+			var changes map[string]any
+			fields, changes = changedFields(&current, movie)
+			if len(fields) == 0 {
+				return nil
+			}
+
+			err = insertMovieRevision(ctx, tx, movie.OrganizationID, movie.ID, movie.Version)
+			if err != nil {
+				return err
+			}
+
+			err = m.stmts.txQueryRowContext(ctx, tx, query, args...).
+				Scan(utc(&movie.UpdatedAt), &movie.Version)
+			if err != nil {
+				return err
+			}
+
+			return insertOutboxEvent(ctx, tx, eventKind, movie.ID, movieChanged{
+				ID:         movie.ID,
+				Version:    movie.Version,
+				UpdatedAt:  movie.UpdatedAt,
+				Changes:    changes,
+				RevertedTo: revertedTo,
+			})
+		})
+	})
 	if err != nil {
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
-			return ErrEditConflict
+			return nil, ErrEditConflict
 		default:
 			fmt.Println("Line 203")
-			return err
+			return nil, err
 		}
 	}
 
-	return nil
+	return fields, nil
 }
 
-func (m MovieModel) Delete(id int64) error {
+// Delete deletes the movie, provided it's still at the given version, unless version is 0. It
+// returns ErrEditConflict if the movie exists but is at another version.
+func (m MovieModel) Delete(ctx context.Context, organizationID, id int64, version int32) error {
 	if id < 1 {
 		return ErrRecordNotFound
 	}
@@ -216,24 +1114,21 @@ func (m MovieModel) Delete(id int64) error {
 	query := `
 		DELETE FROM movies
 		WHERE id = $1
+			AND organization_id = $2
+			AND ($3 = 0 OR version = $3)
+			AND deleted_at IS NULL
 	`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
-
-	result, err := m.DB.ExecContext(ctx, query, id)
-	if err != nil {
+	err := execExpectingRows(ctx, m.conn(), query, id, organizationID, version)
+	m.gets.forget(movieKey{organizationID: organizationID, id: id})
+	if !errors.Is(err, ErrRecordNotFound) || version == 0 {
 		return err
 	}
 
-	rowsAffected, err := result.RowsAffected()
+	// Tell a movie that doesn't exist from one that was updated since the client last read it.
+	_, err = m.Get(ctx, organizationID, id)
 	if err != nil {
 		return err
 	}
-
-	if rowsAffected == 0 {
-		return ErrRecordNotFound
-	}
-
-	return nil
+	return ErrEditConflict
 }
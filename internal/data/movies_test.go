@@ -1,7 +1,10 @@
 package data
 
 import (
+	"context"
 	"database/sql"
+	"os"
+	"strings"
 	"testing"
 	"time"
 
@@ -69,9 +72,12 @@ func NewMock(t *testing.T) (*sql.DB, sqlmock.Sqlmock) {
 func TestMovieModel_Get(t *testing.T) {
 	createdAt, _ := time.Parse("2006-01-02", "2022-01-01")
 	query := `
-		SELECT id, created_at, title, year, runtime, genres, version
+		SELECT id, organization_id, created_at, updated_at, title, year, runtime, genres,
+			attributes, version
 		FROM movies
 		WHERE id = \$1
+			AND organization_id = \$2
+			AND deleted_at IS NULL
 	`
 
 	tests := []struct {
@@ -86,27 +92,35 @@ func TestMovieModel_Get(t *testing.T) {
 					NewRows(
 						[]string{
 							"id",
+							"organization_id",
 							"created_at",
+							"updated_at",
 							"title",
 							"year",
 							"runtime",
 							"genres",
+							"attributes",
 							"version",
 						},
 					).
-					AddRow(1, createdAt, "Test Movie 1", 2022, 120, "{}", 1)
-				mock.ExpectQuery(query).WithArgs(1).WillReturnRows(rows)
+					AddRow(
+						1, 1, createdAt, createdAt, "Test Movie 1", 2022, 120, "{}",
+						`{"studio": "A24"}`, 1,
+					)
+				mock.ExpectQuery(query).WithArgs(1, 1).WillReturnRows(rows)
 			},
 			checkModel: func(model MovieModel) {
-				movie, err := model.Get(1)
+				movie, err := model.Get(context.Background(), 1, 1)
 				assert.NotNil(t, movie)
 				assert.Nil(t, err)
 				assert.Equal(t, int64(1), movie.ID, "wrong id")
+				assert.Equal(t, int64(1), movie.OrganizationID, "wrong organization_id")
 				assert.Equal(t, createdAt, movie.CreatedAt, "wrong created_at")
 				assert.Equal(t, "Test Movie 1", movie.Title, "wrong title")
 				assert.Equal(t, int32(2022), movie.Year, "wrong year")
 				assert.Equal(t, int32(120), int32(movie.Runtime), "wrong runtime")
 				assert.Equal(t, []string{}, movie.Genres, "wrong genres")
+				assert.Equal(t, Attributes{"studio": "A24"}, movie.Attributes, "wrong attributes")
 				assert.Equal(t, int32(1), movie.Version, "wrong version")
 			},
 		},
@@ -114,7 +128,7 @@ func TestMovieModel_Get(t *testing.T) {
 			name:      "InvalidID",
 			buildMock: func(mock sqlmock.Sqlmock) {},
 			checkModel: func(model MovieModel) {
-				movie, err := model.Get(0)
+				movie, err := model.Get(context.Background(), 1, 0)
 				assert.Nil(t, movie)
 				assert.Equal(t, ErrRecordNotFound, err)
 			},
@@ -122,10 +136,10 @@ func TestMovieModel_Get(t *testing.T) {
 		{
 			name: "ErrNoRows",
 			buildMock: func(mock sqlmock.Sqlmock) {
-				mock.ExpectQuery(query).WithArgs(1).WillReturnError(sql.ErrNoRows)
+				mock.ExpectQuery(query).WithArgs(1, 1).WillReturnError(sql.ErrNoRows)
 			},
 			checkModel: func(model MovieModel) {
-				movie, err := model.Get(1)
+				movie, err := model.Get(context.Background(), 1, 1)
 				assert.Nil(t, movie)
 				assert.Equal(t, ErrRecordNotFound, err)
 			},
@@ -133,10 +147,10 @@ func TestMovieModel_Get(t *testing.T) {
 		{
 			name: "ErrConnDone",
 			buildMock: func(mock sqlmock.Sqlmock) {
-				mock.ExpectQuery(query).WithArgs(1).WillReturnError(sql.ErrConnDone)
+				mock.ExpectQuery(query).WithArgs(1, 1).WillReturnError(sql.ErrConnDone)
 			},
 			checkModel: func(model MovieModel) {
-				movie, err := model.Get(1)
+				movie, err := model.Get(context.Background(), 1, 1)
 				assert.Nil(t, movie)
 				assert.Equal(t, sql.ErrConnDone, err)
 			},
@@ -164,13 +178,19 @@ func TestMovieModel_GetAll(t *testing.T) {
 	}
 	query := `
 		SELECT
-			count\(\*\) OVER\(\), id, created_at, title, year, runtime, genres, version
+			count\(\*\) OVER\(\), id, created_at, updated_at, title, year, runtime, genres,
+			attributes, version,
+			ts_rank\(to_tsvector\('simple', title\),
+				plainto_tsquery\('simple', \$2\)\) AS relevance,
+			ts_headline\('simple', title, plainto_tsquery\('simple', \$2\), \$6\) AS title_highlight
 		FROM movies
 		WHERE
-			\(to_tsvector\('simple', title\) @@ plainto_tsquery\('simple', \$1\) OR \$1 = ''\)
-			AND \(genres @> \$2 OR \$2 = '{}'\)
+			organization_id = \$1
+			AND deleted_at IS NULL
+			AND \(to_tsvector\('simple', title\) @@ plainto_tsquery\('simple', \$2\) OR \$2 = ''\)
+			AND \(genres @> \$3 OR \$3 = '{}'\)
 		ORDER BY title DESC, id ASC
-		LIMIT \$3 OFFSET \$4
+		LIMIT \$4 OFFSET \$5
 	`
 
 	tests := []struct {
@@ -187,43 +207,106 @@ func TestMovieModel_GetAll(t *testing.T) {
 							"total_records",
 							"id",
 							"created_at",
+							"updated_at",
 							"title",
 							"year",
 							"runtime",
 							"genres",
+							"attributes",
 							"version",
+							"relevance",
+							"title_highlight",
 						},
 					).
-					AddRow(2, 2, createdAt, "Test Funny Movie", 2022, 99, "{}", 1).
-					AddRow(2, 1, createdAt, "Test Boring Movie", 2020, 99, "{}", 1)
+					AddRow(
+						2, 2, createdAt, createdAt, "Test Funny Movie", 2022, 99, "{}", "{}", 1,
+						0.06, "Test Funny \x02Movie\x03",
+					).
+					AddRow(
+						2, 1, createdAt, createdAt, "Test <Boring> Movie", 2020, 99, "{}", "{}", 1,
+						0.06, "Test <Boring> \x02Movie\x03",
+					)
 				mock.ExpectQuery(query).
-					WithArgs("Movie", pq.Array([]string{}), 20, 0).
+					WithArgs(1, "Movie", pq.Array([]string{}), 20, 0, headlineOptions).
 					WillReturnRows(rows)
 			},
 			checkModel: func(model MovieModel) {
-				movies, metadata, err := model.GetAll("Movie", []string{}, filters)
+				movies, metadata, err := model.GetAll(
+					context.Background(),
+					1,
+					"Movie",
+					[]string{},
+					YearRange{},
+					nil,
+					filters,
+				)
 				assert.Nil(t, err)
 				assert.NotNil(t, movies)
 				assert.NotNil(t, metadata)
 				assert.Equal(t, 2, len(movies))
 				assert.Equal(t, "Test Funny Movie", movies[0].Title)
-				assert.Equal(t, "Test Boring Movie", movies[1].Title)
+				assert.Equal(t, "Test <Boring> Movie", movies[1].Title)
+				assert.Equal(
+					t,
+					&MovieMatch{Score: 0.06, TitleHighlight: "Test Funny <mark>Movie</mark>"},
+					movies[0].Match,
+				)
+				assert.Equal(
+					t,
+					"Test &lt;Boring&gt; <mark>Movie</mark>",
+					movies[1].Match.TitleHighlight,
+				)
 			},
 		},
 		{
 			name: "ErrConnDone",
 			buildMock: func(mock sqlmock.Sqlmock) {
 				mock.ExpectQuery(query).
-					WithArgs("Movie", pq.Array([]string{}), 20, 0).
+					WithArgs(1, "Movie", pq.Array([]string{}), 20, 0, headlineOptions).
 					WillReturnError(sql.ErrConnDone)
 			},
 			checkModel: func(model MovieModel) {
-				movies, metadata, err := model.GetAll("Movie", []string{}, filters)
+				movies, metadata, err := model.GetAll(
+					context.Background(),
+					1,
+					"Movie",
+					[]string{},
+					YearRange{},
+					nil,
+					filters,
+				)
 				assert.Nil(t, movies)
 				assert.Equal(t, Metadata{}, metadata)
 				assert.Equal(t, sql.ErrConnDone, err)
 			},
 		},
+		{
+			name: "YearRange",
+			buildMock: func(mock sqlmock.Sqlmock) {
+				yearsQuery := strings.Replace(
+					query,
+					`ORDER BY`,
+					`AND year >= \$7 AND year <= \$8 ORDER BY`,
+					1,
+				)
+				mock.ExpectQuery(yearsQuery).
+					WithArgs(1, "Movie", pq.Array([]string{}), 20, 0, headlineOptions, 1990, 1999).
+					WillReturnRows(sqlmock.NewRows([]string{"total_records"}))
+			},
+			checkModel: func(model MovieModel) {
+				movies, _, err := model.GetAll(
+					context.Background(),
+					1,
+					"Movie",
+					[]string{},
+					YearRange{From: 1990, To: 1999},
+					nil,
+					filters,
+				)
+				assert.Nil(t, err)
+				assert.Empty(t, movies)
+			},
+		},
 	}
 
 	for _, test := range tests {
@@ -239,17 +322,28 @@ func TestMovieModel_GetAll(t *testing.T) {
 
 func TestMovielModel_Update(t *testing.T) {
 	createdAt, _ := time.Parse("2006-01-02", "2022-01-01")
+	updatedAt := time.Date(2022, 1, 2, 3, 4, 5, 0, time.FixedZone("UTC+8", 8*60*60))
 	query := `
 		UPDATE movies
 		SET title = \$1,
 			year = \$2,
 			runtime = \$3,
 			genres = \$4,
+			attributes = \$5,
+			updated_at = now\(\),
 			version = version \+ 1
-		WHERE id = \$5
-			AND version = \$6
-		RETURNING version
+		WHERE id = \$6
+			AND organization_id = \$7
+			AND version = \$8
+			AND deleted_at IS NULL
+		RETURNING updated_at,
+			version
 	`
+	currentQuery := `SELECT title, year, runtime, genres, attributes FROM movies`
+	currentRows := func() *sqlmock.Rows {
+		return sqlmock.NewRows([]string{"title", "year", "runtime", "genres", "attributes"}).
+			AddRow("Movie", 2022, 99, "{Sci-fi}", "{}")
+	}
 
 	tests := []struct {
 		name       string
@@ -259,23 +353,318 @@ func TestMovielModel_Update(t *testing.T) {
 		{
 			name: "UpdateTitle",
 			buildMock: func(mock sqlmock.Sqlmock) {
-				rows := sqlmock.NewRows([]string{"version"}).AddRow(2)
+				rows := sqlmock.NewRows([]string{"updated_at", "version"}).AddRow(updatedAt, 2)
+				mock.ExpectBegin()
+				mock.ExpectQuery(currentQuery).WithArgs(1, 1, 1).WillReturnRows(currentRows())
+				mock.ExpectExec(`INSERT INTO movie_revisions`).
+					WithArgs(1, 1, 1).
+					WillReturnResult(sqlmock.NewResult(0, 1))
 				mock.ExpectQuery(query).
-					WithArgs("Updated Movie", 2022, 99, pq.Array([]string{"Sci-fi"}), 1, 1).
+					WithArgs(
+						"Updated Movie",
+						2022,
+						99,
+						pq.Array([]string{"Sci-fi"}),
+						Attributes(nil),
+						1,
+						1,
+						1,
+					).
 					WillReturnRows(rows)
+				mock.ExpectExec(`INSERT INTO outbox \(kind, aggregate_id, payload\)`).
+					WithArgs(EventMovieUpdated, 1, sqlmock.AnyArg()).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectCommit()
 			},
 			checkModel: func(model MovieModel) {
 				movie := &Movie{
-					ID:        1,
-					CreatedAt: createdAt,
-					Title:     "Updated Movie",
-					Year:      2022,
-					Runtime:   99,
-					Genres:    []string{"Sci-fi"},
-					Version:   1,
+					ID:             1,
+					OrganizationID: 1,
+					CreatedAt:      createdAt,
+					Title:          "Updated Movie",
+					Year:           2022,
+					Runtime:        99,
+					Genres:         []string{"Sci-fi"},
+					Version:        1,
+				}
+				changedFields, err := model.Update(context.Background(), movie)
+				assert.Nil(t, err)
+				assert.Equal(t, []string{"title"}, changedFields)
+				assert.Equal(t, updatedAt.UTC(), movie.UpdatedAt, "wrong updated_at")
+				assert.Equal(t, int32(2), movie.Version, "wrong version")
+			},
+		},
+		{
+			name: "NoChanges",
+			buildMock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(currentQuery).WithArgs(1, 1, 1).WillReturnRows(currentRows())
+				mock.ExpectCommit()
+			},
+			checkModel: func(model MovieModel) {
+				movie := &Movie{
+					ID:             1,
+					OrganizationID: 1,
+					Title:          "Movie",
+					Year:           2022,
+					Runtime:        99,
+					Genres:         []string{"Sci-fi"},
+					Version:        1,
+				}
+				changedFields, err := model.Update(context.Background(), movie)
+				assert.Nil(t, err)
+				assert.Equal(t, []string{}, changedFields)
+				assert.Equal(t, int32(1), movie.Version, "wrong version")
+			},
+		},
+		{
+			name: "EditConflict",
+			buildMock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(currentQuery).WithArgs(1, 1, 1).WillReturnError(sql.ErrNoRows)
+				mock.ExpectRollback()
+			},
+			checkModel: func(model MovieModel) {
+				movie := &Movie{ID: 1, OrganizationID: 1, Genres: []string{}, Version: 1}
+				_, err := model.Update(context.Background(), movie)
+				assert.Equal(t, ErrEditConflict, err)
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			db, mock := NewMock(t)
+			model := MovieModel{DB: db}
+			defer model.DB.Close()
+			test.buildMock(mock)
+			test.checkModel(model)
+			assert.Nil(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestMovieModel_Delete(t *testing.T) {
+	query := `
+		DELETE FROM movies
+		WHERE id = \$1
+			AND organization_id = \$2
+			AND \(\$3 = 0 OR version = \$3\)
+			AND deleted_at IS NULL
+	`
+	getQuery := `SELECT id, organization_id, created_at, updated_at, title, year, runtime, genres`
+
+	tests := []struct {
+		name      string
+		buildMock func(mock sqlmock.Sqlmock)
+		version   int32
+		want      error
+	}{
+		{
+			name: "Unconditional",
+			buildMock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(query).WithArgs(1, 1, 0).WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+		},
+		{
+			name: "NotFound",
+			buildMock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(query).WithArgs(1, 1, 0).WillReturnResult(sqlmock.NewResult(0, 0))
+			},
+			want: ErrRecordNotFound,
+		},
+		{
+			name:    "MatchingVersion",
+			version: 2,
+			buildMock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(query).WithArgs(1, 1, 2).WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+		},
+		{
+			name:    "OtherVersion",
+			version: 2,
+			buildMock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(query).WithArgs(1, 1, 2).WillReturnResult(sqlmock.NewResult(0, 0))
+				rows := sqlmock.NewRows([]string{
+					"id",
+					"organization_id",
+					"created_at",
+					"updated_at",
+					"title",
+					"year",
+					"runtime",
+					"genres",
+					"attributes",
+					"version",
+				}).AddRow(1, 1, time.Now(), time.Now(), "Test Movie", 2022, 120, "{}", "{}", 3)
+				mock.ExpectQuery(getQuery).WithArgs(1, 1).WillReturnRows(rows)
+			},
+			want: ErrEditConflict,
+		},
+		{
+			name:    "DeletedSince",
+			version: 2,
+			buildMock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(query).WithArgs(1, 1, 2).WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectQuery(getQuery).WithArgs(1, 1).WillReturnError(sql.ErrNoRows)
+			},
+			want: ErrRecordNotFound,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			db, mock := NewMock(t)
+			model := MovieModel{DB: db}
+			defer model.DB.Close()
+			test.buildMock(mock)
+			assert.Equal(t, test.want, model.Delete(context.Background(), 1, 1, test.version))
+			assert.Nil(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestMovieModel_GetAll_CountStrategy(t *testing.T) {
+	createdAt, _ := time.Parse("2006-01-02", "2022-01-01")
+	query := `
+		SELECT
+			id, created_at, updated_at, title, year, runtime, genres, attributes, version
+		FROM movies
+		WHERE
+			organization_id = \$1
+			AND deleted_at IS NULL
+			AND \(to_tsvector\('simple', title\) @@ plainto_tsquery\('simple', \$2\) OR \$2 = ''\)
+			AND \(genres @> \$3 OR \$3 = '{}'\)
+		ORDER BY id ASC, id ASC
+		LIMIT \$4 OFFSET \$5
+	`
+	estimateQuery := `
+		EXPLAIN \(FORMAT JSON\)
+		SELECT 1
+		FROM movies
+		WHERE organization_id = 1
+	`
+	columns := []string{
+		"id",
+		"created_at",
+		"updated_at",
+		"title",
+		"year",
+		"runtime",
+		"genres",
+		"attributes",
+		"version",
+	}
+
+	tests := []struct {
+		name       string
+		buildMock  func(mock sqlmock.Sqlmock)
+		checkModel func(model MovieModel)
+	}{
+		{
+			name: "Estimated",
+			buildMock: func(mock sqlmock.Sqlmock) {
+				rows := sqlmock.NewRows(columns).
+					AddRow(1, createdAt, createdAt, "Test Movie", 2022, 99, "{}", "{}", 1)
+				mock.ExpectQuery(query).
+					WithArgs(1, "", pq.Array([]string{}), 20, 0).
+					WillReturnRows(rows)
+				mock.ExpectQuery(estimateQuery).
+					WillReturnRows(
+						sqlmock.NewRows([]string{"QUERY PLAN"}).AddRow(`[{"Plan": {"Plan Rows": 41}}]`),
+					)
+			},
+			checkModel: func(model MovieModel) {
+				filters := Filters{
+					Page:           1,
+					PageSize:       20,
+					Sort:           "id",
+					SortSafeValues: []string{"id"},
+					CountStrategy:  CountEstimated,
+				}
+				movies, metadata, err := model.GetAll(
+					context.Background(),
+					1,
+					"",
+					[]string{},
+					YearRange{},
+					nil,
+					filters,
+				)
+				assert.Nil(t, err)
+				assert.Equal(t, 1, len(movies))
+				assert.Equal(t, 41, metadata.TotalRecords)
+				assert.Equal(t, 3, metadata.LastPage)
+				assert.True(t, metadata.Estimated)
+			},
+		},
+		{
+			name: "Parallel",
+			buildMock: func(mock sqlmock.Sqlmock) {
+				// The count and page queries run concurrently, so they may arrive in any order.
+				mock.MatchExpectationsInOrder(false)
+				rows := sqlmock.NewRows(columns).
+					AddRow(1, createdAt, createdAt, "Test Movie", 2022, 99, "{}", "{}", 1)
+				mock.ExpectQuery(query).
+					WithArgs(1, "", pq.Array([]string{}), 20, 0).
+					WillReturnRows(rows)
+				mock.ExpectQuery(`SELECT count\(\*\)\s+FROM movies`).
+					WithArgs(1, "", pq.Array([]string{})).
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(21))
+			},
+			checkModel: func(model MovieModel) {
+				filters := Filters{
+					Page:           1,
+					PageSize:       20,
+					Sort:           "id",
+					SortSafeValues: []string{"id"},
+					CountStrategy:  CountParallel,
 				}
-				err := model.Update(movie)
+				movies, metadata, err := model.GetAll(
+					context.Background(),
+					1,
+					"",
+					[]string{},
+					YearRange{},
+					nil,
+					filters,
+				)
 				assert.Nil(t, err)
+				assert.Equal(t, 1, len(movies))
+				assert.Equal(t, 21, metadata.TotalRecords)
+				assert.Equal(t, 2, metadata.LastPage)
+				assert.False(t, metadata.Estimated)
+			},
+		},
+		{
+			name: "None",
+			buildMock: func(mock sqlmock.Sqlmock) {
+				rows := sqlmock.NewRows(columns).
+					AddRow(1, createdAt, createdAt, "Test Movie", 2022, 99, "{}", "{}", 1)
+				mock.ExpectQuery(query).
+					WithArgs(1, "", pq.Array([]string{}), 20, 20).
+					WillReturnRows(rows)
+			},
+			checkModel: func(model MovieModel) {
+				filters := Filters{
+					Page:           2,
+					PageSize:       20,
+					Sort:           "id",
+					SortSafeValues: []string{"id"},
+					CountStrategy:  CountNone,
+				}
+				movies, metadata, err := model.GetAll(
+					context.Background(),
+					1,
+					"",
+					[]string{},
+					YearRange{},
+					nil,
+					filters,
+				)
+				assert.Nil(t, err)
+				assert.Equal(t, 1, len(movies))
+				assert.Equal(t, Metadata{CurrentPage: 2, PageSize: 20, FirstPage: 1}, metadata)
 			},
 		},
 	}
@@ -287,6 +676,275 @@ func TestMovielModel_Update(t *testing.T) {
 			defer model.DB.Close()
 			test.buildMock(mock)
 			test.checkModel(model)
+			assert.Nil(t, mock.ExpectationsWereMet())
 		})
 	}
 }
+
+func TestMovieModel_InsertMany(t *testing.T) {
+	chunkSize := copyChunkSize
+	copyChunkSize = 2
+	defer func() { copyChunkSize = chunkSize }()
+
+	query := `COPY "movies" \("organization_id", "title", "year", "runtime", "genres", ` +
+		`"attributes"\) FROM STDIN`
+	movies := []*Movie{
+		{OrganizationID: 1, Title: "Movie 1", Year: 2001, Runtime: 90, Genres: []string{"drama"}},
+		{OrganizationID: 1, Title: "Movie 2", Year: 2002, Runtime: 91, Genres: []string{"drama"}},
+		{OrganizationID: 1, Title: "Movie 3", Year: 2003, Runtime: 92, Genres: []string{"comedy"}},
+	}
+
+	tests := []struct {
+		name       string
+		buildMock  func(mock sqlmock.Sqlmock)
+		checkModel func(model MovieModel)
+	}{
+		{
+			name: "Success",
+			buildMock: func(mock sqlmock.Sqlmock) {
+				for _, chunk := range [][]*Movie{movies[:2], movies[2:]} {
+					mock.ExpectBegin()
+					expectNoMovieLimit(mock, 1)
+					prep := mock.ExpectPrepare(query)
+					for _, movie := range chunk {
+						prep.ExpectExec().
+							WithArgs(
+								movie.OrganizationID,
+								movie.Title,
+								movie.Year,
+								movie.Runtime,
+								pq.Array(movie.Genres),
+								movie.Attributes,
+							).
+							WillReturnResult(sqlmock.NewResult(0, 1))
+					}
+					prep.ExpectExec().WillReturnResult(sqlmock.NewResult(0, 0))
+					mock.ExpectCommit()
+				}
+			},
+			checkModel: func(model MovieModel) {
+				inserted, err := model.InsertMany(context.Background(), movies)
+				assert.Nil(t, err)
+				assert.Equal(t, 3, inserted)
+			},
+		},
+		{
+			name: "ChunkError",
+			buildMock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				expectNoMovieLimit(mock, 1)
+				mock.ExpectPrepare(query).WillReturnError(sql.ErrConnDone)
+				mock.ExpectRollback()
+
+				mock.ExpectBegin()
+				expectNoMovieLimit(mock, 1)
+				prep := mock.ExpectPrepare(query)
+				prep.ExpectExec().
+					WithArgs(
+						int64(1),
+						"Movie 3",
+						int32(2003),
+						Runtime(92),
+						pq.Array([]string{"comedy"}),
+						Attributes(nil),
+					).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				prep.ExpectExec().WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectCommit()
+			},
+			checkModel: func(model MovieModel) {
+				inserted, err := model.InsertMany(context.Background(), movies)
+				assert.Equal(t, 1, inserted)
+
+				bulkErr, ok := err.(*BulkInsertError)
+				assert.True(t, ok)
+				assert.Equal(
+					t,
+					[]ChunkError{{Offset: 0, Count: 2, Err: sql.ErrConnDone}},
+					bulkErr.Chunks,
+				)
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			db, mock := NewMock(t)
+			model := MovieModel{DB: db}
+			defer model.DB.Close()
+			test.buildMock(mock)
+			test.checkModel(model)
+			assert.Nil(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestMovieModel_SuggestTitles(t *testing.T) {
+	query := `
+		SELECT title
+		FROM movies
+		WHERE organization_id = \$1
+			AND deleted_at IS NULL
+			AND \$2 <% title
+		GROUP BY title
+		ORDER BY max\(word_similarity\(\$2, title\)\) DESC, title
+		LIMIT \$3
+	`
+
+	db, mock := NewMock(t)
+	model := MovieModel{DB: db}
+	defer model.DB.Close()
+
+	rows := sqlmock.NewRows([]string{"title"}).AddRow("Casablanca").AddRow("Casanova")
+	mock.ExpectQuery(query).WithArgs(1, "Casablanka", maxTitleSuggestions).WillReturnRows(rows)
+
+	suggestions, err := model.SuggestTitles(context.Background(), 1, "Casablanka")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"Casablanca", "Casanova"}, suggestions)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+// BenchmarkMovieModel_GetAllByYear measures the listings filtered by a decade, against the ones
+// that aren't, to compare the movies table before and after it's partitioned by year (see
+// migrations/optional/partition_movies_by_year.up.sql). Point GREENLIGHT_TEST_DB_DSN to a migrated
+// database with a representative catalog to run it:
+//
+//	GREENLIGHT_TEST_DB_DSN=$GREENLIGHT_DB_DSN go test -run=^$ -bench=GetAllByYear ./internal/data
+func BenchmarkMovieModel_GetAllByYear(b *testing.B) {
+	dsn := os.Getenv("GREENLIGHT_TEST_DB_DSN")
+	if dsn == "" {
+		b.Skip("GREENLIGHT_TEST_DB_DSN is not set")
+	}
+
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer db.Close()
+
+	model := MovieModel{DB: db}
+	filters := Filters{
+		Page:           1,
+		PageSize:       20,
+		Sort:           "-year",
+		SortSafeValues: MovieSortSafeValues,
+		CountStrategy:  CountExact,
+	}
+
+	benchmarks := []struct {
+		name  string
+		years YearRange
+	}{
+		{name: "AllYears", years: YearRange{}},
+		{name: "Decade", years: YearRange{From: 1990, To: 1999}},
+	}
+
+	for _, bm := range benchmarks {
+		b.Run(bm.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				_, _, err := model.GetAll(
+					context.Background(),
+					DefaultOrganizationID,
+					"",
+					[]string{},
+					bm.years,
+					nil,
+					filters,
+				)
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// scanMoviesPerRow is how the listings' rows were scanned before movieRowScanner, which
+// BenchmarkMovieRowScanner compares it with: each row allocated its movie and its destinations.
+func scanMoviesPerRow(rows *sql.Rows) ([]*Movie, int, error) {
+	totalRecord := 0
+	movies := []*Movie{}
+
+	for rows.Next() {
+		var movie Movie
+		dest := []any{
+			&movie.ID,
+			utc(&movie.CreatedAt),
+			utc(&movie.UpdatedAt),
+			&movie.Title,
+			&movie.Year,
+			&movie.Runtime,
+			pq.Array(&movie.Genres),
+			&movie.Attributes,
+			&movie.Version,
+		}
+		dest = append([]any{&totalRecord}, dest...)
+
+		err := rows.Scan(dest...)
+		if err != nil {
+			return nil, 0, err
+		}
+		movies = append(movies, &movie)
+	}
+	return movies, totalRecord, rows.Err()
+}
+
+// BenchmarkMovieRowScanner measures scanning a counted page of 100 movies, before (PerRow) and
+// after (Scanner) the destinations and the movies were allocated once per page:
+//
+//	go test -run=^$ -bench=MovieRowScanner -benchmem ./internal/data
+func BenchmarkMovieRowScanner(b *testing.B) {
+	const pageSize = 100
+	now := time.Date(2024, time.January, 1, 12, 0, 0, 0, time.UTC)
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer db.Close()
+
+	query := func(b *testing.B) *sql.Rows {
+		b.StopTimer()
+		rows := sqlmock.NewRows([]string{
+			"count", "id", "created_at", "updated_at", "title", "year", "runtime", "genres",
+			"attributes", "version",
+		})
+		for i := 0; i < pageSize; i++ {
+			rows.AddRow(
+				1000, i+1, now, now, "Moana", 2016, 107, `{animation,adventure}`, `{}`, 1,
+			)
+		}
+		mock.ExpectQuery("SELECT").WillReturnRows(rows)
+
+		result, err := db.Query("SELECT")
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.StartTimer()
+		return result
+	}
+
+	b.Run("PerRow", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			rows := query(b)
+			movies, _, err := scanMoviesPerRow(rows)
+			rows.Close()
+			if err != nil || len(movies) != pageSize {
+				b.Fatal(err, len(movies))
+			}
+		}
+	})
+
+	b.Run("Scanner", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			rows := query(b)
+			movies, err := newMovieRowScanner(true, false, pageSize).scanAll(rows)
+			rows.Close()
+			if err != nil || len(movies) != pageSize {
+				b.Fatal(err, len(movies))
+			}
+		}
+	})
+}
@@ -0,0 +1,398 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/walkccc/greenlight/internal/validator"
+)
+
+// Constants for the kinds of notifications, i.e. the domain events that generate them.
+const (
+	NotificationMovieAdded = "movie_added"
+)
+
+// Notification tells a user about a domain event, e.g. a movie added in one of their watched
+// genres. It's unread until ReadAt is set.
+type Notification struct {
+	ID             int64      `json:"id"`
+	UserID         int64      `json:"-"`
+	OrganizationID int64      `json:"-"`
+	CreatedAt      time.Time  `json:"created_at"`
+	Kind           string     `json:"kind"`
+	Message        string     `json:"message"`
+	MovieID        *int64     `json:"movie_id,omitempty"`
+	Read           bool       `json:"read"`
+	ReadAt         *time.Time `json:"read_at"`
+}
+
+// NotificationPreferences holds the channels a user is notified on, and the genres whose new movies
+// they're notified of. The security alerts (e.g. about a new sign-in) are sent by text message to
+// the phone number, if the user asked for them.
+type NotificationPreferences struct {
+	UserID        int64    `json:"-"`
+	InApp         bool     `json:"in_app"`
+	Email         bool     `json:"email"`
+	WatchedGenres []string `json:"watched_genres" validate:"max=20,unique"`
+	Phone         string   `json:"phone,omitempty"`
+	SMSAlerts     bool     `json:"sms_alerts"`
+	Version       int32    `json:"version"`
+}
+
+// DefaultNotificationPreferences returns the preferences of a user who hasn't set any.
+func DefaultNotificationPreferences(userID int64) *NotificationPreferences {
+	return &NotificationPreferences{
+		UserID:        userID,
+		InApp:         true,
+		WatchedGenres: []string{},
+	}
+}
+
+// NotificationRecipient is a user to notify of an event, with the channels they asked for.
+type NotificationRecipient struct {
+	UserID    int64
+	UserName  string
+	UserEmail string
+	InApp     bool
+	Email     bool
+}
+
+func ValidateNotificationPreferences(v *validator.Validator, preferences *NotificationPreferences) {
+	v.Struct(preferences)
+
+	if preferences.Phone != "" {
+		v.Check(
+			validator.Matches(preferences.Phone, validator.PhoneRX),
+			"phone",
+			validator.CodeInvalid,
+			"must be a phone number in the E.164 format, e.g. +14155552671",
+		)
+	}
+	v.Check(
+		!preferences.SMSAlerts || preferences.Phone != "",
+		"sms_alerts",
+		validator.CodeRequired,
+		"requires a phone number",
+	)
+}
+
+type NotificationModelInterface interface {
+	Insert(ctx context.Context, notification *Notification) error
+	GetAllForUser(
+		ctx context.Context,
+		userID, organizationID int64,
+		unreadOnly bool,
+		filters Filters,
+	) ([]*Notification, Metadata, error)
+	SetRead(ctx context.Context, userID, organizationID, id int64, read bool) (*Notification, error)
+	GetPreferences(ctx context.Context, userID int64) (*NotificationPreferences, error)
+	UpdatePreferences(ctx context.Context, preferences *NotificationPreferences) error
+	GetWatchersForMovie(
+		ctx context.Context,
+		movie *Movie,
+		excludeUserID int64,
+	) ([]*NotificationRecipient, error)
+}
+
+type NotificationModel struct {
+	DB      *sql.DB
+	breaker *breaker
+	retry   *retryPolicy
+	timeout time.Duration
+	keys    *Keyring
+}
+
+func (m NotificationModel) Insert(ctx context.Context, notification *Notification) error {
+	query := `
+		INSERT INTO notifications (user_id, organization_id, kind, message, movie_id)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id,
+			created_at
+	`
+	args := []any{
+		notification.UserID,
+		notification.OrganizationID,
+		notification.Kind,
+		notification.Message,
+		notification.MovieID,
+	}
+
+	ctx, cancel := queryContext(ctx, m.timeout)
+	defer cancel()
+
+	return m.retry.do(ctx, m.breaker, func() error {
+		return m.DB.QueryRowContext(ctx, query, args...).
+			Scan(&notification.ID, utc(&notification.CreatedAt))
+	})
+}
+
+// GetAllForUser returns a page of the user's notifications in the organization, newest first. The
+// filters' sort is ignored.
+func (m NotificationModel) GetAllForUser(
+	ctx context.Context,
+	userID, organizationID int64,
+	unreadOnly bool,
+	filters Filters,
+) ([]*Notification, Metadata, error) {
+	query := `
+		SELECT count(*) OVER(), id, user_id, organization_id, created_at, kind, message, movie_id,
+			read_at
+		FROM notifications
+		WHERE user_id = $1
+			AND organization_id = $2
+			AND (read_at IS NULL OR NOT $3)
+		ORDER BY id DESC
+		LIMIT $4 OFFSET $5
+	`
+	args := []any{userID, organizationID, unreadOnly, filters.limit(), filters.offset()}
+
+	ctx, cancel := queryContext(ctx, m.timeout)
+	defer cancel()
+
+	var rows *sql.Rows
+	err := m.retry.do(ctx, m.breaker, func() (err error) {
+		rows, err = m.DB.QueryContext(ctx, query, args...)
+		return err
+	})
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	notifications := []*Notification{}
+
+	for rows.Next() {
+		var notification Notification
+		dest := append([]any{&totalRecords}, notificationDest(&notification)...)
+		err := rows.Scan(dest...)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		notifications = append(notifications, &notification)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return notifications, metadata, nil
+}
+
+// SetRead marks the user's notification in the organization as read or unread. Marking a read
+// notification as read again keeps the time it was first read.
+func (m NotificationModel) SetRead(
+	ctx context.Context,
+	userID, organizationID, id int64,
+	read bool,
+) (*Notification, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+		UPDATE notifications
+		SET read_at = CASE WHEN $4 THEN coalesce(read_at, now()) END
+		WHERE id = $1
+			AND user_id = $2
+			AND organization_id = $3
+		RETURNING id, user_id, organization_id, created_at, kind, message, movie_id, read_at
+	`
+
+	ctx, cancel := queryContext(ctx, m.timeout)
+	defer cancel()
+
+	var notification Notification
+	err := m.retry.do(ctx, m.breaker, func() error {
+		return m.DB.QueryRowContext(ctx, query, id, userID, organizationID, read).
+			Scan(notificationDest(&notification)...)
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &notification, nil
+}
+
+// GetPreferences returns the user's notification preferences, or the defaults if they haven't set
+// any.
+func (m NotificationModel) GetPreferences(
+	ctx context.Context,
+	userID int64,
+) (*NotificationPreferences, error) {
+	query := `
+		SELECT in_app, email, watched_genres, COALESCE(phone, ''), sms_alerts, version
+		FROM notification_preferences
+		WHERE user_id = $1
+	`
+
+	ctx, cancel := queryContext(ctx, m.timeout)
+	defer cancel()
+
+	preferences := NotificationPreferences{UserID: userID}
+	err := m.retry.do(ctx, m.breaker, func() error {
+		return m.DB.QueryRowContext(ctx, query, userID).Scan(
+			&preferences.InApp,
+			&preferences.Email,
+			pq.Array(&preferences.WatchedGenres),
+			&preferences.Phone,
+			&preferences.SMSAlerts,
+			&preferences.Version,
+		)
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return DefaultNotificationPreferences(userID), nil
+		default:
+			return nil, err
+		}
+	}
+
+	return &preferences, nil
+}
+
+// UpdatePreferences saves the user's notification preferences, creating them on the first update.
+func (m NotificationModel) UpdatePreferences(
+	ctx context.Context,
+	preferences *NotificationPreferences,
+) error {
+	query := `
+		INSERT INTO notification_preferences (
+			user_id,
+			in_app,
+			email,
+			watched_genres,
+			phone,
+			sms_alerts
+		)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (user_id) DO UPDATE
+		SET in_app = EXCLUDED.in_app,
+			email = EXCLUDED.email,
+			watched_genres = EXCLUDED.watched_genres,
+			phone = EXCLUDED.phone,
+			sms_alerts = EXCLUDED.sms_alerts,
+			version = notification_preferences.version + 1
+		RETURNING version
+	`
+	args := []any{
+		preferences.UserID,
+		preferences.InApp,
+		preferences.Email,
+		pq.Array(preferences.WatchedGenres),
+		sql.NullString{String: preferences.Phone, Valid: preferences.Phone != ""},
+		preferences.SMSAlerts,
+	}
+
+	ctx, cancel := queryContext(ctx, m.timeout)
+	defer cancel()
+
+	return m.retry.do(ctx, m.breaker, func() error {
+		return m.DB.QueryRowContext(ctx, query, args...).Scan(&preferences.Version)
+	})
+}
+
+// GetWatchersForMovie returns the members of the movie's organization who watch one of its genres
+// on at least one channel, except for the given user (usually the one who added the movie). Users
+// who aren't activated are left out.
+func (m NotificationModel) GetWatchersForMovie(
+	ctx context.Context,
+	movie *Movie,
+	excludeUserID int64,
+) ([]*NotificationRecipient, error) {
+	query := `
+		SELECT users.id,
+			users.name,
+			users.email,
+			users.email_ciphertext,
+			notification_preferences.in_app,
+			notification_preferences.email
+		FROM notification_preferences
+			INNER JOIN users ON users.id = notification_preferences.user_id
+			INNER JOIN organizations_users ON organizations_users.user_id = users.id
+		WHERE organizations_users.organization_id = $1
+			AND users.id <> $2
+			AND users.activated
+			AND notification_preferences.watched_genres && $3
+			AND (notification_preferences.in_app OR notification_preferences.email)
+		ORDER BY users.id
+	`
+	args := []any{movie.OrganizationID, excludeUserID, pq.Array(movie.Genres)}
+
+	ctx, cancel := queryContext(ctx, m.timeout)
+	defer cancel()
+
+	var rows *sql.Rows
+	err := m.retry.do(ctx, m.breaker, func() (err error) {
+		rows, err = m.DB.QueryContext(ctx, query, args...)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	recipients := []*NotificationRecipient{}
+
+	for rows.Next() {
+		var recipient NotificationRecipient
+		dests := []any{&recipient.UserID, &recipient.UserName}
+		dests = append(dests, m.keys.emailDests(&recipient.UserEmail)...)
+		dests = append(dests, &recipient.InApp, &recipient.Email)
+		err := rows.Scan(dests...)
+		if err != nil {
+			return nil, err
+		}
+		recipients = append(recipients, &recipient)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return recipients, nil
+}
+
+// notificationDest returns the scan destinations of a notifications row's columns, in the order
+// the queries select them.
+func notificationDest(notification *Notification) []any {
+	return []any{
+		&notification.ID,
+		&notification.UserID,
+		&notification.OrganizationID,
+		utc(&notification.CreatedAt),
+		&notification.Kind,
+		&notification.Message,
+		&notification.MovieID,
+		readAtScanner{notification: notification},
+	}
+}
+
+// readAtScanner scans the nullable read_at column, and sets Read to whether it's set.
+type readAtScanner struct {
+	notification *Notification
+}
+
+func (s readAtScanner) Scan(src any) error {
+	s.notification.ReadAt = nil
+	s.notification.Read = src != nil
+	if src == nil {
+		return nil
+	}
+
+	var readAt time.Time
+	if err := utc(&readAt).Scan(src); err != nil {
+		return err
+	}
+	s.notification.ReadAt = &readAt
+	return nil
+}
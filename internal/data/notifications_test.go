@@ -0,0 +1,159 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var notificationColumns = []string{
+	"id", "user_id", "organization_id", "created_at", "kind", "message", "movie_id", "read_at",
+}
+
+func TestNotificationModel_SetRead(t *testing.T) {
+	// Marking a notification as read keeps the time it was first read, and marking it as unread
+	// clears it.
+	query := `UPDATE notifications SET read_at = CASE WHEN \$4 THEN coalesce\(read_at, now\(\)\) ` +
+		`END WHERE id = \$1 AND user_id = \$2 AND organization_id = \$3 RETURNING`
+	createdAt := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	readAt := time.Date(2022, 1, 2, 0, 0, 0, 0, time.UTC)
+
+	db, mock := NewMock(t)
+	defer db.Close()
+	model := NotificationModel{DB: db}
+
+	mock.ExpectQuery(query).
+		WithArgs(3, 1, 7, true).
+		WillReturnRows(sqlmock.NewRows(notificationColumns).
+			AddRow(3, 1, 7, createdAt, NotificationMovieAdded, "Moana was added", 5, readAt))
+	notification, err := model.SetRead(context.Background(), 1, 7, 3, true)
+	require.NoError(t, err)
+	assert.True(t, notification.Read)
+	assert.Equal(t, readAt, *notification.ReadAt)
+	assert.Equal(t, int64(5), *notification.MovieID)
+
+	mock.ExpectQuery(query).
+		WithArgs(3, 1, 7, false).
+		WillReturnRows(sqlmock.NewRows(notificationColumns).
+			AddRow(3, 1, 7, createdAt, NotificationMovieAdded, "Moana was added", 5, nil))
+	notification, err = model.SetRead(context.Background(), 1, 7, 3, false)
+	require.NoError(t, err)
+	assert.False(t, notification.Read)
+	assert.Nil(t, notification.ReadAt)
+
+	// Another user's notification isn't found.
+	mock.ExpectQuery(query).
+		WithArgs(3, 2, 7, true).
+		WillReturnRows(sqlmock.NewRows(notificationColumns))
+	_, err = model.SetRead(context.Background(), 2, 7, 3, true)
+	assert.ErrorIs(t, err, ErrRecordNotFound)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestNotificationModel_GetAllForUser(t *testing.T) {
+	query := `FROM notifications WHERE user_id = \$1 AND organization_id = \$2 ` +
+		`AND \(read_at IS NULL OR NOT \$3\) ORDER BY id DESC LIMIT \$4 OFFSET \$5`
+	columns := append([]string{"count"}, notificationColumns...)
+	createdAt := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	filters := Filters{Page: 2, PageSize: 10}
+
+	db, mock := NewMock(t)
+	defer db.Close()
+	model := NotificationModel{DB: db}
+
+	// The unread filter is passed as $3, which the query ignores when it's false.
+	for _, unread := range []bool{true, false} {
+		mock.ExpectQuery(query).
+			WithArgs(1, 7, unread, 10, 10).
+			WillReturnRows(sqlmock.NewRows(columns).
+				AddRow(11, 4, 1, 7, createdAt, NotificationMovieAdded, "Up was added", nil, nil))
+
+		notifications, metadata, err := model.GetAllForUser(
+			context.Background(),
+			1,
+			7,
+			unread,
+			filters,
+		)
+		require.NoError(t, err)
+		require.Len(t, notifications, 1)
+		assert.False(t, notifications[0].Read)
+		assert.Nil(t, notifications[0].MovieID)
+		assert.Equal(t, 11, metadata.TotalRecords)
+		assert.Equal(t, 2, metadata.LastPage)
+	}
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestNotificationModel_Preferences(t *testing.T) {
+	selectQuery := `SELECT in_app, email, watched_genres, COALESCE\(phone, ''\), sms_alerts, ` +
+		`version FROM notification_preferences WHERE user_id = \$1`
+	upsertQuery := `INSERT INTO notification_preferences \( user_id, in_app, email, ` +
+		`watched_genres, phone, sms_alerts \) VALUES \(\$1, \$2, \$3, \$4, \$5, \$6\) ` +
+		`ON CONFLICT \(user_id\) DO UPDATE SET .* ` +
+		`version = notification_preferences.version \+ 1 RETURNING version`
+
+	db, mock := NewMock(t)
+	defer db.Close()
+	model := NotificationModel{DB: db}
+
+	// A user who hasn't set any preferences gets the defaults.
+	mock.ExpectQuery(selectQuery).WithArgs(1).WillReturnError(sql.ErrNoRows)
+	preferences, err := model.GetPreferences(context.Background(), 1)
+	require.NoError(t, err)
+	assert.Equal(t, DefaultNotificationPreferences(1), preferences)
+
+	// The first update creates them, and the next ones bump their version.
+	preferences.WatchedGenres = []string{"drama"}
+	mock.ExpectQuery(upsertQuery).
+		WithArgs(1, true, false, pq.Array([]string{"drama"}), sql.NullString{}, false).
+		WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(1))
+	require.NoError(t, model.UpdatePreferences(context.Background(), preferences))
+	assert.Equal(t, int32(1), preferences.Version)
+
+	preferences.Phone = "+14155552671"
+	preferences.SMSAlerts = true
+	phone := sql.NullString{String: "+14155552671", Valid: true}
+	mock.ExpectQuery(upsertQuery).
+		WithArgs(1, true, false, pq.Array([]string{"drama"}), phone, true).
+		WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(2))
+	require.NoError(t, model.UpdatePreferences(context.Background(), preferences))
+	assert.Equal(t, int32(2), preferences.Version)
+
+	mock.ExpectQuery(selectQuery).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows(
+			[]string{"in_app", "email", "watched_genres", "phone", "sms_alerts", "version"},
+		).AddRow(true, false, "{drama}", "+14155552671", true, 2))
+	preferences, err = model.GetPreferences(context.Background(), 1)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"drama"}, preferences.WatchedGenres)
+	assert.Equal(t, int32(2), preferences.Version)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestReadAtScanner(t *testing.T) {
+	readAt := time.Date(2022, 1, 2, 3, 4, 5, 0, time.FixedZone("CET", 3600))
+
+	notification := &Notification{}
+	require.NoError(t, readAtScanner{notification: notification}.Scan(readAt))
+	assert.True(t, notification.Read)
+	assert.Equal(t, readAt.UTC(), *notification.ReadAt)
+	assert.Equal(t, time.UTC, notification.ReadAt.Location())
+
+	// A NULL read_at clears what a previous scan set.
+	require.NoError(t, readAtScanner{notification: notification}.Scan(nil))
+	assert.False(t, notification.Read)
+	assert.Nil(t, notification.ReadAt)
+
+	assert.Error(t, readAtScanner{notification: notification}.Scan("yesterday"))
+}
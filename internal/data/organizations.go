@@ -0,0 +1,305 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/walkccc/greenlight/internal/validator"
+)
+
+// DefaultOrganizationID is the ID of the organization created by the migrations. The users and
+// movies that existed before organizations were introduced belong to it, and new users join it
+// when they sign up.
+const DefaultOrganizationID = 1
+
+// Constants for the roles a user can have in an organization.
+const (
+	RoleOwner  = "owner"
+	RoleMember = "member"
+)
+
+// Roles holds the valid organization roles.
+var Roles = []string{RoleOwner, RoleMember}
+
+// Organization holds the data for an organization (a tenant). Every movie belongs to exactly one
+// organization, and users only see the movies of the organization their token was issued for.
+type Organization struct {
+	ID        int64     `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	Name      string    `json:"name" validate:"required,max=500"`
+	Version   int32     `json:"version"`
+}
+
+// Member holds the details of a user's membership of an organization.
+type Member struct {
+	UserID   int64     `json:"user_id"`
+	Name     string    `json:"name"`
+	Email    string    `json:"email"`
+	Role     string    `json:"role"`
+	JoinedAt time.Time `json:"joined_at"`
+}
+
+func ValidateOrganization(v *validator.Validator, organization *Organization) {
+	v.Struct(organization)
+}
+
+func ValidateRole(v *validator.Validator, role string) {
+	v.Check(
+		validator.PermittedValue(role, Roles...),
+		"role",
+		validator.CodeNotPermitted,
+		"must be owner or member",
+	)
+}
+
+type OrganizationModelInterface interface {
+	Create(ctx context.Context, organization *Organization) error
+	Get(ctx context.Context, id int64) (*Organization, error)
+	GetAllForUser(ctx context.Context, userID int64) ([]*Organization, error)
+	GetMembers(ctx context.Context, organizationID int64) ([]*Member, error)
+	SetMember(ctx context.Context, organizationID, userID int64, role string) error
+	RemoveMember(ctx context.Context, organizationID, userID int64) error
+	GetLimits(ctx context.Context, organizationID int64) (*OrganizationLimits, error)
+	SetLimits(ctx context.Context, limits *OrganizationLimits) error
+	AddRequests(ctx context.Context, organizationID int64, day string, n int64) (int64, error)
+	GetUsage(ctx context.Context, organizationID int64) (*Usage, error)
+}
+
+type OrganizationModel struct {
+	DB      *sql.DB
+	breaker *breaker
+	retry   *retryPolicy
+	timeout time.Duration
+	keys    *Keyring
+}
+
+func (m OrganizationModel) Create(ctx context.Context, organization *Organization) error {
+	query := `
+		INSERT INTO organizations (name)
+		VALUES ($1)
+		RETURNING id,
+			created_at,
+			version
+	`
+
+	ctx, cancel := queryContext(ctx, m.timeout)
+	defer cancel()
+
+	return m.retry.do(ctx, m.breaker, func() error {
+		return m.DB.QueryRowContext(ctx, query, organization.Name).
+			Scan(&organization.ID, utc(&organization.CreatedAt), &organization.Version)
+	})
+}
+
+func (m OrganizationModel) Get(ctx context.Context, id int64) (*Organization, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+		SELECT id, created_at, name, version
+		FROM organizations
+		WHERE id = $1
+	`
+
+	var organization Organization
+
+	ctx, cancel := queryContext(ctx, m.timeout)
+	defer cancel()
+
+	err := m.retry.do(ctx, m.breaker, func() error {
+		return m.DB.QueryRowContext(ctx, query, id).Scan(
+			&organization.ID,
+			utc(&organization.CreatedAt),
+			&organization.Name,
+			&organization.Version,
+		)
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &organization, nil
+}
+
+// GetAllForUser returns the organizations the user is a member of, oldest first.
+func (m OrganizationModel) GetAllForUser(
+	ctx context.Context,
+	userID int64,
+) ([]*Organization, error) {
+	query := `
+		SELECT organizations.id,
+			organizations.created_at,
+			organizations.name,
+			organizations.version
+		FROM organizations
+			INNER JOIN organizations_users ON organizations_users.organization_id = organizations.id
+		WHERE organizations_users.user_id = $1
+		ORDER BY organizations.id
+	`
+
+	ctx, cancel := queryContext(ctx, m.timeout)
+	defer cancel()
+
+	var rows *sql.Rows
+	err := m.retry.do(ctx, m.breaker, func() (err error) {
+		rows, err = m.DB.QueryContext(ctx, query, userID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	organizations := []*Organization{}
+
+	for rows.Next() {
+		var organization Organization
+		err := rows.Scan(
+			&organization.ID,
+			utc(&organization.CreatedAt),
+			&organization.Name,
+			&organization.Version,
+		)
+		if err != nil {
+			return nil, err
+		}
+		organizations = append(organizations, &organization)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return organizations, nil
+}
+
+// GetMembers returns the members of the organization, in the order they joined.
+func (m OrganizationModel) GetMembers(
+	ctx context.Context,
+	organizationID int64,
+) ([]*Member, error) {
+	query := `
+		SELECT users.id,
+			users.name,
+			users.email,
+			users.email_ciphertext,
+			organizations_users.role,
+			organizations_users.created_at
+		FROM organizations_users
+			INNER JOIN users ON users.id = organizations_users.user_id
+		WHERE organizations_users.organization_id = $1
+		ORDER BY organizations_users.created_at, users.id
+	`
+
+	ctx, cancel := queryContext(ctx, m.timeout)
+	defer cancel()
+
+	var rows *sql.Rows
+	err := m.retry.do(ctx, m.breaker, func() (err error) {
+		rows, err = m.DB.QueryContext(ctx, query, organizationID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := []*Member{}
+
+	for rows.Next() {
+		var member Member
+		dests := []any{&member.UserID, &member.Name}
+		dests = append(dests, m.keys.emailDests(&member.Email)...)
+		dests = append(dests, &member.Role, utc(&member.JoinedAt))
+		err := rows.Scan(dests...)
+		if err != nil {
+			return nil, err
+		}
+		members = append(members, &member)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return members, nil
+}
+
+// SetMember adds the user to the organization with the given role, or changes their role if they
+// already are a member. It returns ErrRecordNotFound if the user doesn't exist.
+func (m OrganizationModel) SetMember(
+	ctx context.Context,
+	organizationID, userID int64,
+	role string,
+) error {
+	query := `
+		INSERT INTO organizations_users (organization_id, user_id, role)
+		SELECT $1, users.id, $3
+		FROM users
+		WHERE users.id = $2
+		ON CONFLICT (organization_id, user_id) DO UPDATE
+		SET role = EXCLUDED.role
+	`
+
+	ctx, cancel := queryContext(ctx, m.timeout)
+	defer cancel()
+
+	var result sql.Result
+	err := m.retry.do(ctx, m.breaker, func() (err error) {
+		result, err = m.DB.ExecContext(ctx, query, organizationID, userID, role)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// RemoveMember removes the user from the organization. Their authentication tokens for the
+// organization stop working straight away, since GetForToken() checks the membership.
+func (m OrganizationModel) RemoveMember(ctx context.Context, organizationID, userID int64) error {
+	query := `
+		DELETE FROM organizations_users
+		WHERE organization_id = $1
+			AND user_id = $2
+	`
+
+	ctx, cancel := queryContext(ctx, m.timeout)
+	defer cancel()
+
+	var result sql.Result
+	err := m.retry.do(ctx, m.breaker, func() (err error) {
+		result, err = m.DB.ExecContext(ctx, query, organizationID, userID)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
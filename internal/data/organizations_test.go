@@ -0,0 +1,118 @@
+package data
+
+import (
+	"context"
+	"database/sql/driver"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestUserModel_GetForToken_Membership checks that a token scoped to an organization only
+// authenticates its user while they're still a member of it, and resolves to that organization.
+func TestUserModel_GetForToken_Membership(t *testing.T) {
+	query := `INNER JOIN tokens ON users.id = tokens.user_id ` +
+		`WHERE tokens.hash = ANY\(\$1\) AND tokens.scope = \$2 AND tokens.expiry > \$3 ` +
+		`AND \( tokens.organization_id IS NULL OR EXISTS \( SELECT 1 FROM organizations_users ` +
+		`WHERE organizations_users.organization_id = tokens.organization_id ` +
+		`AND organizations_users.user_id = users.id \) \)`
+	columns := []string{
+		"id", "created_at", "name", "email", "email_ciphertext", "password_hash", "activated",
+		"version", "organization_id", "hash", "hash_version",
+	}
+	plaintext := "Y3QMGX3PJ3WLRL2YRTQGQ6KRHU"
+	hasher := tokenHasher{}
+	args := []driver.Value{
+		pq.Array(hasher.candidates(plaintext)),
+		ScopeAuthentication,
+		sqlmock.AnyArg(),
+	}
+
+	t.Run("Member", func(t *testing.T) {
+		db, mock := NewMock(t)
+		defer db.Close()
+
+		mock.ExpectQuery(query).WithArgs(args...).WillReturnRows(sqlmock.NewRows(columns).AddRow(
+			1, time.Now(), "Alice", "alice@example.com", nil, []byte("hash"), true, 1, 7,
+			hasher.hash(TokenHashSHA256, plaintext), TokenHashSHA256,
+		))
+
+		model := UserModel{DB: db}
+		user, err := model.GetForToken(context.Background(), ScopeAuthentication, plaintext)
+		require.NoError(t, err)
+		assert.Equal(t, int64(7), user.OrganizationID)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("NoLongerAMember", func(t *testing.T) {
+		db, mock := NewMock(t)
+		defer db.Close()
+
+		mock.ExpectQuery(query).WithArgs(args...).WillReturnRows(sqlmock.NewRows(columns))
+
+		model := UserModel{DB: db}
+		_, err := model.GetForToken(context.Background(), ScopeAuthentication, plaintext)
+		assert.ErrorIs(t, err, ErrRecordNotFound)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestOrganizationModel_GetAllForUser(t *testing.T) {
+	db, mock := NewMock(t)
+	defer db.Close()
+
+	createdAt := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	mock.ExpectQuery(`INNER JOIN organizations_users ` +
+		`ON organizations_users.organization_id = organizations.id ` +
+		`WHERE organizations_users.user_id = \$1 ORDER BY organizations.id`).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "name", "version"}).
+			AddRow(1, createdAt, "Default", 1).
+			AddRow(7, createdAt, "Acme", 1))
+
+	organizations, err := OrganizationModel{DB: db}.GetAllForUser(context.Background(), 1)
+	require.NoError(t, err)
+	require.Len(t, organizations, 2)
+	assert.Equal(t, int64(7), organizations[1].ID)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestOrganizationModel_SetMember(t *testing.T) {
+	query := `INSERT INTO organizations_users \(organization_id, user_id, role\) ` +
+		`SELECT \$1, users.id, \$3 FROM users WHERE users.id = \$2 ` +
+		`ON CONFLICT \(organization_id, user_id\) DO UPDATE SET role = EXCLUDED.role`
+
+	db, mock := NewMock(t)
+	defer db.Close()
+	model := OrganizationModel{DB: db}
+
+	mock.ExpectExec(query).WithArgs(7, 2, RoleOwner).WillReturnResult(sqlmock.NewResult(0, 1))
+	assert.NoError(t, model.SetMember(context.Background(), 7, 2, RoleOwner))
+
+	// The user doesn't exist.
+	mock.ExpectExec(query).WithArgs(7, 3, RoleMember).WillReturnResult(sqlmock.NewResult(0, 0))
+	assert.ErrorIs(t, model.SetMember(context.Background(), 7, 3, RoleMember), ErrRecordNotFound)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestOrganizationModel_RemoveMember(t *testing.T) {
+	query := `DELETE FROM organizations_users WHERE organization_id = \$1 AND user_id = \$2`
+
+	db, mock := NewMock(t)
+	defer db.Close()
+	model := OrganizationModel{DB: db}
+
+	mock.ExpectExec(query).WithArgs(7, 2).WillReturnResult(sqlmock.NewResult(0, 1))
+	assert.NoError(t, model.RemoveMember(context.Background(), 7, 2))
+
+	// The user isn't a member of the organization.
+	mock.ExpectExec(query).WithArgs(8, 2).WillReturnResult(sqlmock.NewResult(0, 0))
+	assert.ErrorIs(t, model.RemoveMember(context.Background(), 8, 2), ErrRecordNotFound)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
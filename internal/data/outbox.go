@@ -0,0 +1,219 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+)
+
+// Constants for the kinds of domain events written to the outbox.
+const (
+	EventMovieCreated   = "movie.created"
+	EventMovieUpdated   = "movie.updated"
+	EventMovieReverted  = "movie.reverted"
+	EventMovieMerged    = "movie.merged"
+	EventUserRegistered = "user.registered"
+)
+
+// outboxMaxBackoff caps the delay before an event that failed to be published is retried.
+const outboxMaxBackoff = time.Hour
+
+// OutboxEvent is a domain event waiting in the outbox to be published. AggregateID is the ID of
+// the movie or user the event is about, and Payload its JSON representation after the change.
+type OutboxEvent struct {
+	ID          int64           `json:"id"`
+	CreatedAt   time.Time       `json:"created_at"`
+	Kind        string          `json:"kind"`
+	AggregateID int64           `json:"aggregate_id"`
+	Payload     json.RawMessage `json:"payload"`
+	Attempts    int             `json:"-"`
+}
+
+type OutboxModelInterface interface {
+	Relay(ctx context.Context, limit int, publish func(event *OutboxEvent) error) (int, error)
+	DeleteDelivered(ctx context.Context, olderThan time.Duration) (int64, error)
+}
+
+type OutboxModel struct {
+	DB      *sql.DB
+	breaker *breaker
+}
+
+// withTx runs fn within a transaction, which is committed if fn succeeds and rolled back otherwise.
+func withTx(ctx context.Context, db *sql.DB, fn func(tx *sql.Tx) error) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	// Rollback() is a no-op once the transaction has been committed.
+	defer tx.Rollback()
+
+	err = fn(tx)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// insertOutboxEvent writes an event to the outbox within the transaction making the change it
+// describes, so that the event is recorded if and only if the change is committed.
+func insertOutboxEvent(
+	ctx context.Context,
+	tx *sql.Tx,
+	kind string,
+	aggregateID int64,
+	payload any,
+) error {
+	js, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO outbox (kind, aggregate_id, payload)
+		VALUES ($1, $2, $3)
+	`
+
+	_, err = tx.ExecContext(ctx, query, kind, aggregateID, js)
+	return err
+}
+
+// Relay publishes up to limit of the oldest undelivered events that are due, and marks them as
+// delivered. The events are locked for the duration, so that several relays can run side by side
+// without publishing the same events. An event that fails to be published has its error recorded,
+// and is retried after an exponential backoff. It returns the number of events delivered.
+//
+// Delivery is at-least-once: if the transaction fails after an event was published, the event is
+// published again by the next relay, so consumers should deduplicate on the event's ID.
+func (m OutboxModel) Relay(
+	ctx context.Context,
+	limit int,
+	publish func(event *OutboxEvent) error,
+) (int, error) {
+	selectQuery := `
+		SELECT id, created_at, kind, aggregate_id, payload, attempts
+		FROM outbox
+		WHERE delivered_at IS NULL
+			AND next_attempt_at <= now()
+		ORDER BY id
+		LIMIT $1
+		FOR UPDATE SKIP LOCKED
+	`
+	deliveredQuery := `
+		UPDATE outbox
+		SET delivered_at = now(),
+			attempts = attempts + 1
+		WHERE id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	delivered := 0
+
+	err := m.breaker.do(func() error {
+		return withTx(ctx, m.DB, func(tx *sql.Tx) error {
+			rows, err := tx.QueryContext(ctx, selectQuery, limit)
+			if err != nil {
+				return err
+			}
+			defer rows.Close()
+
+			events := []*OutboxEvent{}
+
+			for rows.Next() {
+				var event OutboxEvent
+
+				err := rows.Scan(
+					&event.ID,
+					utc(&event.CreatedAt),
+					&event.Kind,
+					&event.AggregateID,
+					&event.Payload,
+					&event.Attempts,
+				)
+				if err != nil {
+					return err
+				}
+
+				events = append(events, &event)
+			}
+			if err = rows.Err(); err != nil {
+				return err
+			}
+
+			for _, event := range events {
+				if err := publish(event); err != nil {
+					err = m.markFailed(ctx, tx, event, err)
+					if err != nil {
+						return err
+					}
+					continue
+				}
+
+				_, err = tx.ExecContext(ctx, deliveredQuery, event.ID)
+				if err != nil {
+					return err
+				}
+				delivered++
+			}
+
+			return nil
+		})
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return delivered, nil
+}
+
+// markFailed records the error of a failed publication, and postpones the event's next attempt.
+func (m OutboxModel) markFailed(
+	ctx context.Context,
+	tx *sql.Tx,
+	event *OutboxEvent,
+	publishErr error,
+) error {
+	// The delay doubles with every attempt (1s, 2s, 4s, etc.), up to outboxMaxBackoff.
+	backoff := outboxMaxBackoff
+	if delay := time.Second << event.Attempts; event.Attempts < 12 && delay < backoff {
+		backoff = delay
+	}
+
+	query := `
+		UPDATE outbox
+		SET attempts = attempts + 1,
+			last_error = $2,
+			next_attempt_at = now() + make_interval(secs => $3)
+		WHERE id = $1
+	`
+
+	_, err := tx.ExecContext(ctx, query, event.ID, publishErr.Error(), backoff.Seconds())
+	return err
+}
+
+// DeleteDelivered deletes the events that were delivered more than olderThan ago, and returns how
+// many were deleted.
+func (m OutboxModel) DeleteDelivered(ctx context.Context, olderThan time.Duration) (int64, error) {
+	query := `
+		DELETE FROM outbox
+		WHERE delivered_at < now() - make_interval(secs => $1)
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	var result sql.Result
+	err := m.breaker.do(func() (err error) {
+		result, err = m.DB.ExecContext(ctx, query, olderThan.Seconds())
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
@@ -0,0 +1,61 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOutboxModel_Relay(t *testing.T) {
+	createdAt := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	db, mock := NewMock(t)
+	defer db.Close()
+	model := OutboxModel{DB: db}
+
+	rows := sqlmock.NewRows(
+		[]string{"id", "created_at", "kind", "aggregate_id", "payload", "attempts"},
+	).
+		AddRow(1, createdAt, EventMovieCreated, 7, []byte(`{"id": 7}`), 0).
+		AddRow(2, createdAt, EventUserRegistered, 3, []byte(`{"id": 3}`), 3)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT id, created_at, kind, aggregate_id, payload, attempts FROM outbox ` +
+		`.+ FOR UPDATE SKIP LOCKED`).
+		WithArgs(10).
+		WillReturnRows(rows)
+	mock.ExpectExec(`UPDATE outbox SET delivered_at = now\(\)`).
+		WithArgs(1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	// The second event has failed three times already, so it's retried in 8 seconds.
+	mock.ExpectExec(`UPDATE outbox SET attempts = attempts \+ 1, last_error = \$2`).
+		WithArgs(2, "webhook is down", float64(8)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	var published []*OutboxEvent
+	delivered, err := model.Relay(context.Background(), 10, func(event *OutboxEvent) error {
+		published = append(published, event)
+		if event.Kind == EventUserRegistered {
+			return errors.New("webhook is down")
+		}
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, delivered)
+
+	assert.Len(t, published, 2)
+	assert.Equal(t, &OutboxEvent{
+		ID:          1,
+		CreatedAt:   createdAt,
+		Kind:        EventMovieCreated,
+		AggregateID: 7,
+		Payload:     []byte(`{"id": 7}`),
+	}, published[0])
+
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
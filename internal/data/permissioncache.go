@@ -0,0 +1,152 @@
+package data
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// permissionCacheMaxEntries is how many users' permissions the cache holds before it drops the
+// expired ones, or all of them if none has expired.
+const permissionCacheMaxEntries = 10000
+
+// PermissionCacheStats holds the counters of the permission cache.
+type PermissionCacheStats struct {
+	Hits    int64   `json:"hits"`
+	Misses  int64   `json:"misses"`
+	Entries int     `json:"entries"`
+	HitRate float64 `json:"hit_rate"`
+}
+
+// permissionCache caches the users' permissions (with their wildcards resolved), since they're
+// checked on every protected request. The entries expire after the TTL, which bounds how long a
+// change made by another instance takes to apply, while the changes made through this instance
+// invalidate the user's entry straight away.
+//
+// A nil *permissionCache is valid and caches nothing.
+type permissionCache struct {
+	ttl time.Duration
+
+	mtx        sync.Mutex
+	entries    map[int64]permissionCacheEntry
+	generation uint64 // incremented by every invalidation
+
+	hits   atomic.Int64
+	misses atomic.Int64
+}
+
+type permissionCacheEntry struct {
+	permissions Permissions
+	expiresAt   time.Time
+}
+
+// newPermissionCache returns a cache whose entries expire after the TTL, or nil if the TTL is zero.
+func newPermissionCache(ttl time.Duration) *permissionCache {
+	if ttl <= 0 {
+		return nil
+	}
+	return &permissionCache{ttl: ttl, entries: make(map[int64]permissionCacheEntry)}
+}
+
+// get returns the user's cached permissions, along with the generation to pass to put() if they
+// weren't cached.
+func (c *permissionCache) get(userID int64) (Permissions, uint64, bool) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	entry, found := c.entries[userID]
+	if found && time.Now().Before(entry.expiresAt) {
+		c.hits.Add(1)
+		return entry.permissions, 0, true
+	}
+
+	c.misses.Add(1)
+	return nil, c.generation, false
+}
+
+// put caches the user's permissions, unless an invalidation happened since the generation was
+// read, in which case the permissions may be out of date already.
+func (c *permissionCache) put(userID int64, permissions Permissions, generation uint64) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if generation != c.generation {
+		return
+	}
+
+	now := time.Now()
+	if len(c.entries) >= permissionCacheMaxEntries {
+		for id, entry := range c.entries {
+			if !now.Before(entry.expiresAt) {
+				delete(c.entries, id)
+			}
+		}
+		if len(c.entries) >= permissionCacheMaxEntries {
+			c.entries = make(map[int64]permissionCacheEntry)
+		}
+	}
+
+	c.entries[userID] = permissionCacheEntry{permissions: permissions, expiresAt: now.Add(c.ttl)}
+}
+
+// invalidate drops the user's cached permissions.
+func (c *permissionCache) invalidate(userID int64) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	delete(c.entries, userID)
+	c.generation++
+}
+
+// Stats returns the cache's counters. It's safe to call on a nil *permissionCache.
+func (c *permissionCache) Stats() PermissionCacheStats {
+	if c == nil {
+		return PermissionCacheStats{}
+	}
+
+	c.mtx.Lock()
+	entries := len(c.entries)
+	c.mtx.Unlock()
+
+	stats := PermissionCacheStats{Hits: c.hits.Load(), Misses: c.misses.Load(), Entries: entries}
+	if total := stats.Hits + stats.Misses; total > 0 {
+		stats.HitRate = float64(stats.Hits) / float64(total)
+	}
+	return stats
+}
+
+// cachedPermissionModel serves the users' permissions from a permissionCache, and invalidates a
+// user's entry when they're granted new permissions.
+type cachedPermissionModel struct {
+	PermissionModelInterface
+	cache *permissionCache
+}
+
+func (m cachedPermissionModel) AddForUser(
+	ctx context.Context,
+	userID int64,
+	codes ...string,
+) error {
+	err := m.PermissionModelInterface.AddForUser(ctx, userID, codes...)
+	m.cache.invalidate(userID)
+	return err
+}
+
+func (m cachedPermissionModel) GetAllForUser(
+	ctx context.Context,
+	userID int64,
+) (Permissions, error) {
+	permissions, generation, found := m.cache.get(userID)
+	if found {
+		return permissions, nil
+	}
+
+	permissions, err := m.PermissionModelInterface.GetAllForUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	m.cache.put(userID, permissions, generation)
+	return permissions, nil
+}
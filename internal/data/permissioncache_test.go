@@ -0,0 +1,76 @@
+package data
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// countingPermissionModel returns the same permissions for every user, and counts the lookups.
+type countingPermissionModel struct {
+	PermissionModelInterface
+	permissions Permissions
+	lookups     *int
+}
+
+func (m countingPermissionModel) AddForUser(
+	ctx context.Context,
+	userID int64,
+	codes ...string,
+) error {
+	return nil
+}
+
+func (m countingPermissionModel) GetAllForUser(
+	ctx context.Context,
+	userID int64,
+) (Permissions, error) {
+	*m.lookups++
+	return m.permissions, nil
+}
+
+func TestCachedPermissionModel(t *testing.T) {
+	ctx := context.Background()
+	var lookups int
+	cache := newPermissionCache(time.Minute)
+	model := cachedPermissionModel{
+		PermissionModelInterface: countingPermissionModel{
+			permissions: Permissions{"movies:read"},
+			lookups:     &lookups,
+		},
+		cache: cache,
+	}
+
+	for i := 0; i < 3; i++ {
+		permissions, err := model.GetAllForUser(ctx, 1)
+		assert.Nil(t, err)
+		assert.Equal(t, Permissions{"movies:read"}, permissions)
+	}
+	assert.Equal(t, 1, lookups)
+
+	// Granting a permission invalidates the user's entry, but not the others'.
+	model.GetAllForUser(ctx, 2)
+	assert.Nil(t, model.AddForUser(ctx, 1, "movies:write"))
+	model.GetAllForUser(ctx, 1)
+	model.GetAllForUser(ctx, 2)
+	assert.Equal(t, 3, lookups)
+
+	// A lookup that started before an invalidation isn't cached, since it may be out of date.
+	_, generation, found := cache.get(3)
+	assert.False(t, found)
+	cache.invalidate(4)
+	cache.put(3, Permissions{"movies:read"}, generation)
+	_, _, found = cache.get(3)
+	assert.False(t, found)
+
+	stats := cache.Stats()
+	assert.Equal(t, int64(3), stats.Hits)
+	assert.Equal(t, int64(5), stats.Misses)
+	assert.Equal(t, 2, stats.Entries)
+	assert.InDelta(t, 0.375, stats.HitRate, 0.001)
+
+	assert.Nil(t, newPermissionCache(0))
+	assert.Equal(t, PermissionCacheStats{}, (*permissionCache)(nil).Stats())
+}
@@ -23,15 +23,18 @@ func (p Permissions) Include(code string) bool {
 }
 
 type PermissionModelInterface interface {
-	AddForUser(userId int64, codes ...string) error
-	GetAllForUser(userID int64) (Permissions, error)
+	AddForUser(ctx context.Context, userId int64, codes ...string) error
+	GetAllForUser(ctx context.Context, userID int64) (Permissions, error)
 }
 
 type PermissionModel struct {
-	DB *sql.DB
+	DB      *sql.DB
+	breaker *breaker
+	retry   *retryPolicy
+	timeout time.Duration
 }
 
-func (m PermissionModel) AddForUser(userID int64, codes ...string) error {
+func (m PermissionModel) AddForUser(ctx context.Context, userID int64, codes ...string) error {
 	query := `
 		INSERT INTO users_permissions
 		SELECT $1,
@@ -44,26 +47,39 @@ func (m PermissionModel) AddForUser(userID int64, codes ...string) error {
 		pq.Array(codes),
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := queryContext(ctx, m.timeout)
 	defer cancel()
 
-	_, err := m.DB.ExecContext(ctx, query, args...)
-	return err
+	return m.retry.do(ctx, m.breaker, func() error {
+		_, err := m.DB.ExecContext(ctx, query, args...)
+		return err
+	})
 }
 
-func (m PermissionModel) GetAllForUser(userID int64) (Permissions, error) {
+// GetAllForUser returns the user's permission codes, along with the codes implied by their
+// wildcard codes: "movies:*" implies every "movies:" code (e.g. "movies:read"), and "*" implies
+// every code. The wildcards are resolved here, so that checking a permission stays a lookup.
+func (m PermissionModel) GetAllForUser(ctx context.Context, userID int64) (Permissions, error) {
 	query := `
-		SELECT permissions.code
-		FROM permissions
-			INNER JOIN users_permissions ON users_permissions.permission_id = permissions.id
-			INNER JOIN users ON users_permissions.user_id = users.id
-		WHERE users.id = $1
+		SELECT DISTINCT implied.code
+		FROM users_permissions
+			INNER JOIN permissions granted ON granted.id = users_permissions.permission_id
+			INNER JOIN permissions implied ON implied.code = granted.code
+				OR (
+					granted.code LIKE '%*'
+					AND starts_with(implied.code, rtrim(granted.code, '*'))
+				)
+		WHERE users_permissions.user_id = $1
 	`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := queryContext(ctx, m.timeout)
 	defer cancel()
 
-	rows, err := m.DB.QueryContext(ctx, query, userID)
+	var rows *sql.Rows
+	err := m.retry.do(ctx, m.breaker, func() (err error) {
+		rows, err = m.DB.QueryContext(ctx, query, userID)
+		return err
+	})
 	if err != nil {
 		return nil, err
 	}
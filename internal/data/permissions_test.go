@@ -0,0 +1,36 @@
+package data
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPermissionModel_GetAllForUser(t *testing.T) {
+	db, mock := NewMock(t)
+	defer db.Close()
+
+	// The granted codes are joined to the codes they imply: themselves, and for a wildcard code,
+	// the codes starting with its prefix.
+	mock.ExpectQuery(`SELECT DISTINCT implied.code FROM users_permissions ` +
+		`INNER JOIN permissions granted ON granted.id = users_permissions.permission_id ` +
+		`INNER JOIN permissions implied ON implied.code = granted.code OR \( ` +
+		`granted.code LIKE '%\*' ` +
+		`AND starts_with\(implied.code, rtrim\(granted.code, '\*'\)\) \) ` +
+		`WHERE users_permissions.user_id = \$1`).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"code"}).
+			AddRow("movies:*").
+			AddRow("movies:read").
+			AddRow("movies:write"))
+
+	permissions, err := PermissionModel{DB: db}.GetAllForUser(context.Background(), 1)
+	require.NoError(t, err)
+	assert.Equal(t, Permissions{"movies:*", "movies:read", "movies:write"}, permissions)
+	assert.True(t, permissions.Include("movies:write"))
+	assert.False(t, permissions.Include("admin:read"))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
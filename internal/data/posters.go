@@ -0,0 +1,207 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"time"
+)
+
+// The statuses of a poster's variants.
+const (
+	PosterProcessing = "processing"
+	PosterReady      = "ready"
+	PosterFailed     = "failed"
+)
+
+// PosterOriginal names the variant of a poster that is the uploaded image, as it was uploaded.
+const PosterOriginal = "original"
+
+// Poster records a movie's poster, which is stored in the object storage. Key is the original's
+// key, and the other variants are stored next to it, under their names.
+type Poster struct {
+	MovieID        int64          `json:"-"`
+	OrganizationID int64          `json:"-"`
+	Key            string         `json:"-"`
+	ContentType    string         `json:"-"` // the original's
+	Status         string         `json:"status"`
+	Variants       PosterVariants `json:"variants"`
+	CreatedAt      time.Time      `json:"created_at"`
+}
+
+// VariantKey returns the key of the poster's variant.
+func (p *Poster) VariantKey(name string) string {
+	if name == PosterOriginal {
+		return p.Key
+	}
+	return path.Join(path.Dir(p.Key), name)
+}
+
+// Variant returns the poster's variant of the name, if it has one.
+func (p *Poster) Variant(name string) (PosterVariant, bool) {
+	for _, variant := range p.Variants {
+		if variant.Name == name {
+			return variant, true
+		}
+	}
+	return PosterVariant{}, false
+}
+
+// PosterVariant describes a size of a poster, e.g. its thumbnail.
+type PosterVariant struct {
+	Name        string `json:"name"`
+	Width       int    `json:"width"`
+	Height      int    `json:"height"`
+	ContentType string `json:"content_type"`
+}
+
+// PosterVariants is stored in the variants JSONB column of movie_posters.
+type PosterVariants []PosterVariant
+
+// Value implements driver.Valuer, encoding the variants as a JSON array.
+func (v PosterVariants) Value() (driver.Value, error) {
+	if v == nil {
+		return "[]", nil
+	}
+	js, err := json.Marshal([]PosterVariant(v))
+	if err != nil {
+		return nil, err
+	}
+	return string(js), nil
+}
+
+// Scan implements sql.Scanner, decoding the variants from a JSON array.
+func (v *PosterVariants) Scan(src any) error {
+	switch src := src.(type) {
+	case []byte:
+		*v = nil
+		return json.Unmarshal(src, v)
+	case string:
+		*v = nil
+		return json.Unmarshal([]byte(src), v)
+	default:
+		return fmt.Errorf("poster variants: can't scan a %T", src)
+	}
+}
+
+type PosterModelInterface interface {
+	Get(ctx context.Context, organizationID, movieID int64) (*Poster, error)
+	Put(ctx context.Context, poster *Poster) error
+	Update(ctx context.Context, poster *Poster) error
+}
+
+type PosterModel struct {
+	DB      *sql.DB
+	breaker *breaker
+	retry   *retryPolicy
+	timeout time.Duration
+}
+
+// Get returns the poster of the organization's movie, or ErrRecordNotFound if the movie has none,
+// or is deleted.
+func (m PosterModel) Get(ctx context.Context, organizationID, movieID int64) (*Poster, error) {
+	query := `
+		SELECT p.movie_id, p.organization_id, p.key, p.content_type, p.status, p.variants,
+			p.created_at
+		FROM movie_posters p
+		INNER JOIN movies m ON m.id = p.movie_id
+		WHERE p.movie_id = $1
+			AND p.organization_id = $2
+			AND m.deleted_at IS NULL
+	`
+
+	ctx, cancel := queryContext(ctx, m.timeout)
+	defer cancel()
+
+	var poster Poster
+	err := m.retry.do(ctx, m.breaker, func() error {
+		return m.DB.QueryRowContext(ctx, query, movieID, organizationID).Scan(
+			&poster.MovieID,
+			&poster.OrganizationID,
+			&poster.Key,
+			&poster.ContentType,
+			&poster.Status,
+			&poster.Variants,
+			utc(&poster.CreatedAt),
+		)
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &poster, nil
+}
+
+// Put records the poster of the movie, replacing the previous one, if any.
+func (m PosterModel) Put(ctx context.Context, poster *Poster) error {
+	query := `
+		INSERT INTO movie_posters (movie_id, organization_id, key, content_type, status, variants)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (movie_id) DO UPDATE
+		SET key = EXCLUDED.key,
+			content_type = EXCLUDED.content_type,
+			status = EXCLUDED.status,
+			variants = EXCLUDED.variants,
+			created_at = NOW()
+		RETURNING created_at
+	`
+	args := []any{
+		poster.MovieID,
+		poster.OrganizationID,
+		poster.Key,
+		poster.ContentType,
+		poster.Status,
+		poster.Variants,
+	}
+
+	ctx, cancel := queryContext(ctx, m.timeout)
+	defer cancel()
+
+	return m.retry.do(ctx, m.breaker, func() error {
+		return m.DB.QueryRowContext(ctx, query, args...).Scan(utc(&poster.CreatedAt))
+	})
+}
+
+// Update records the poster's status and variants once they're processed. It returns
+// ErrRecordNotFound if the poster has been replaced by another one since, whose variants are
+// processed separately.
+func (m PosterModel) Update(ctx context.Context, poster *Poster) error {
+	query := `
+		UPDATE movie_posters
+		SET status = $3, variants = $4
+		WHERE movie_id = $1
+			AND key = $2
+	`
+	args := []any{poster.MovieID, poster.Key, poster.Status, poster.Variants}
+
+	ctx, cancel := queryContext(ctx, m.timeout)
+	defer cancel()
+
+	var result sql.Result
+	err := m.retry.do(ctx, m.breaker, func() (err error) {
+		result, err = m.DB.ExecContext(ctx, query, args...)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,130 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// DefaultQueryTimeout is how long a query may run when the models aren't configured otherwise.
+const DefaultQueryTimeout = 3 * time.Second
+
+// queryContext derives the context of a query from the caller's, with the given timeout, or
+// DefaultQueryTimeout if it's zero. The caller's deadline still applies if it's sooner, e.g. when
+// the client of the request being handled has gone away.
+func queryContext(
+	ctx context.Context,
+	timeout time.Duration,
+) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		timeout = DefaultQueryTimeout
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// conn holds what the query helpers need to run a model's queries: the connection pool, the cache
+// of prepared statements (nil if statements aren't prepared), the circuit breaker, the retry policy
+// and the query timeout.
+type conn struct {
+	db      *sql.DB
+	stmts   *statements
+	breaker *breaker
+	retry   *retryPolicy
+	timeout time.Duration
+}
+
+// queryOne runs a query that returns at most one row, and scans it into a new T through the
+// destinations that dests returns for it, e.g. func(u *User) []any { return []any{&u.ID} }. It
+// returns ErrRecordNotFound if there's no row.
+func queryOne[T any](
+	ctx context.Context,
+	c conn,
+	query string,
+	args []any,
+	dests func(*T) []any,
+) (*T, error) {
+	ctx, cancel := queryContext(ctx, c.timeout)
+	defer cancel()
+
+	var record T
+	err := c.retry.do(ctx, c.breaker, func() error {
+		return c.stmts.queryRowContext(ctx, c.db, query, args...).Scan(dests(&record)...)
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &record, nil
+}
+
+// queryMany runs a query and scans each of its rows into a T like queryOne. It returns an empty
+// slice if there are no rows.
+func queryMany[T any](
+	ctx context.Context,
+	c conn,
+	query string,
+	args []any,
+	dests func(*T) []any,
+) ([]T, error) {
+	ctx, cancel := queryContext(ctx, c.timeout)
+	defer cancel()
+
+	var rows *sql.Rows
+	err := c.retry.do(ctx, c.breaker, func() (err error) {
+		rows, err = c.db.QueryContext(ctx, query, args...)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	records := []T{}
+
+	for rows.Next() {
+		var record T
+		err := rows.Scan(dests(&record)...)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return records, nil
+}
+
+// execExpectingRows runs a query that changes rows, such as an UPDATE or a DELETE, and returns
+// ErrRecordNotFound if it didn't change any.
+func execExpectingRows(ctx context.Context, c conn, query string, args ...any) error {
+	ctx, cancel := queryContext(ctx, c.timeout)
+	defer cancel()
+
+	var result sql.Result
+	err := c.retry.do(ctx, c.breaker, func() (err error) {
+		result, err = c.stmts.execContext(ctx, c.db, query, args...)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,46 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQueryHelpers(t *testing.T) {
+	db, mock := NewMock(t)
+	defer db.Close()
+	c := conn{db: db}
+	ctx := context.Background()
+
+	dests := func(title *string) []any { return []any{title} }
+
+	mock.ExpectQuery(`SELECT title FROM movies WHERE id = \$1`).
+		WithArgs(1).
+		WillReturnError(sql.ErrNoRows)
+	title, err := queryOne(ctx, c, `SELECT title FROM movies WHERE id = $1`, []any{1}, dests)
+	assert.Nil(t, title)
+	assert.Equal(t, ErrRecordNotFound, err)
+
+	mock.ExpectQuery(`SELECT title FROM movies`).
+		WillReturnRows(sqlmock.NewRows([]string{"title"}).AddRow("Moana").AddRow("Up"))
+	titles, err := queryMany(ctx, c, `SELECT title FROM movies`, nil, dests)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"Moana", "Up"}, titles)
+
+	mock.ExpectQuery(`SELECT title FROM movies`).
+		WillReturnRows(sqlmock.NewRows([]string{"title"}))
+	titles, err = queryMany(ctx, c, `SELECT title FROM movies`, nil, dests)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{}, titles)
+
+	mock.ExpectExec(`DELETE FROM movies WHERE id = \$1`).
+		WithArgs(1).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	err = execExpectingRows(ctx, c, `DELETE FROM movies WHERE id = $1`, 1)
+	assert.Equal(t, ErrRecordNotFound, err)
+
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
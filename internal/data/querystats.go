@@ -0,0 +1,115 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+
+	"github.com/lib/pq"
+)
+
+// QueryOutcomes counts how the queries of a kind ended.
+type QueryOutcomes struct {
+	// Completed is the number of queries that returned, successfully or with an error other than
+	// a timeout or a cancellation.
+	Completed int64 `json:"completed"`
+	// TimedOut is the number of queries that ran out of time, either because the context's
+	// deadline passed or because the server's statement_timeout canceled them.
+	TimedOut int64 `json:"timed_out"`
+	// Canceled is the number of queries whose context was canceled, e.g. because the client of the
+	// request went away.
+	Canceled int64 `json:"canceled"`
+}
+
+// queryStats counts the outcomes of the movie listing queries per kind of filter, e.g. "list
+// title+genres sort=-year", so that the filters whose queries chronically time out stand out.
+// The kinds are bounded by the sort safelists, so the map doesn't grow with the traffic.
+//
+// A nil *queryStats is valid and records nothing.
+type queryStats struct {
+	mtx      sync.Mutex
+	outcomes map[string]*QueryOutcomes
+}
+
+func newQueryStats() *queryStats {
+	return &queryStats{outcomes: make(map[string]*QueryOutcomes)}
+}
+
+// record counts the outcome of a query of the given kind.
+func (s *queryStats) record(kind string, err error) {
+	if s == nil {
+		return
+	}
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	outcomes, found := s.outcomes[kind]
+	if !found {
+		outcomes = &QueryOutcomes{}
+		s.outcomes[kind] = outcomes
+	}
+
+	var pqErr *pq.Error
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		outcomes.TimedOut++
+	case errors.As(err, &pqErr) && pqErr.Code == "57014":
+		// 57014 is "query_canceled", which is what statement_timeout cancels queries with.
+		outcomes.TimedOut++
+	case errors.Is(err, context.Canceled):
+		outcomes.Canceled++
+	default:
+		outcomes.Completed++
+	}
+}
+
+// snapshot returns a copy of the outcomes.
+func (s *queryStats) snapshot() map[string]QueryOutcomes {
+	snapshot := make(map[string]QueryOutcomes)
+	if s == nil {
+		return snapshot
+	}
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	for kind, outcomes := range s.outcomes {
+		snapshot[kind] = *outcomes
+	}
+	return snapshot
+}
+
+// movieQueryKind returns the kind of a movie listing query (e.g. "list" or "facets") with the
+// given filters, which omits their values.
+func movieQueryKind(
+	query, title string,
+	genres []string,
+	years YearRange,
+	attributes AttributeFilter,
+	sort string,
+) string {
+	var filters []string
+	if title != "" {
+		filters = append(filters, "title")
+	}
+	if len(genres) > 0 {
+		filters = append(filters, "genres")
+	}
+	if years != (YearRange{}) {
+		filters = append(filters, "years")
+	}
+	if len(attributes) > 0 {
+		filters = append(filters, "attributes")
+	}
+	if len(filters) == 0 {
+		filters = append(filters, "all")
+	}
+
+	kind := query + " " + strings.Join(filters, "+")
+	if sort != "" {
+		kind += " sort=" + sort
+	}
+	return kind
+}
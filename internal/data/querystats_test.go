@@ -0,0 +1,29 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQueryStats(t *testing.T) {
+	s := newQueryStats()
+
+	kind := movieQueryKind("list", "moana", []string{"animation"}, YearRange{}, nil, "-year")
+	assert.Equal(t, "list title+genres sort=-year", kind)
+
+	s.record(kind, nil)
+	s.record(kind, ErrRecordNotFound)
+	s.record(kind, fmt.Errorf("count: %w", context.DeadlineExceeded))
+	s.record(kind, &pq.Error{Code: "57014"})
+	s.record(kind, context.Canceled)
+	s.record(movieQueryKind("facets", "", nil, YearRange{From: 1990}, nil, ""), nil)
+
+	assert.Equal(t, map[string]QueryOutcomes{
+		"list title+genres sort=-year": {Completed: 2, TimedOut: 2, Canceled: 1},
+		"facets years":                 {Completed: 1},
+	}, s.snapshot())
+}
@@ -0,0 +1,90 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// Constants for the kinds of resources that can be redirected, named like their routes.
+const (
+	ResourceMovies = "movies"
+)
+
+type RedirectModelInterface interface {
+	Get(ctx context.Context, resource string, organizationID, oldID int64) (int64, error)
+}
+
+type RedirectModel struct {
+	DB      *sql.DB
+	breaker *breaker
+	retry   *retryPolicy
+	timeout time.Duration
+}
+
+// insertRedirect redirects the resource's old ID to its new ID, within the transaction moving it.
+// The redirects to the old ID are pointed at the new ID as well, so that clients are never
+// redirected more than once.
+func insertRedirect(
+	ctx context.Context,
+	tx *sql.Tx,
+	resource string,
+	organizationID, oldID, newID int64,
+) error {
+	chainsQuery := `
+		UPDATE resource_redirects
+		SET new_id = $4
+		WHERE resource = $1
+			AND organization_id = $2
+			AND new_id = $3
+	`
+	insertQuery := `
+		INSERT INTO resource_redirects (resource, organization_id, old_id, new_id)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (resource, organization_id, old_id) DO UPDATE
+		SET new_id = EXCLUDED.new_id
+	`
+
+	for _, query := range []string{chainsQuery, insertQuery} {
+		_, err := tx.ExecContext(ctx, query, resource, organizationID, oldID, newID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Get returns the ID that the resource's old ID redirects to, or ErrRecordNotFound if it doesn't
+// redirect.
+func (m RedirectModel) Get(
+	ctx context.Context,
+	resource string,
+	organizationID, oldID int64,
+) (int64, error) {
+	query := `
+		SELECT new_id
+		FROM resource_redirects
+		WHERE resource = $1
+			AND organization_id = $2
+			AND old_id = $3
+	`
+
+	ctx, cancel := queryContext(ctx, m.timeout)
+	defer cancel()
+
+	var newID int64
+	err := m.retry.do(ctx, m.breaker, func() error {
+		return m.DB.QueryRowContext(ctx, query, resource, organizationID, oldID).Scan(&newID)
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return 0, ErrRecordNotFound
+		default:
+			return 0, err
+		}
+	}
+
+	return newID, nil
+}
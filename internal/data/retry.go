@@ -0,0 +1,181 @@
+package data
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"math/rand"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Constants for the retry budget: every query earns retryBudgetRatio of a retry, and the budget
+// holds at most retryBudgetMax retries, which is also what it starts with. During an outage the
+// retries stop once the budget is spent, so that they add at most a tenth to the database's load.
+const (
+	retryBudgetRatio = 0.1
+	retryBudgetMax   = 10
+)
+
+// RetryStats holds the counters of the query retries, which are published as metrics.
+type RetryStats struct {
+	// Retries is the number of queries that were run again after a transient error.
+	Retries int64 `json:"retries"`
+	// Exhausted is the number of transient errors that were returned because the query was out of
+	// attempts or the retry budget was spent.
+	Exhausted int64 `json:"exhausted"`
+	// Budget is the number of retries currently left in the budget.
+	Budget float64 `json:"budget"`
+}
+
+// retryPolicy runs the queries again after transient errors, i.e. the serialization failures,
+// deadlocks and dropped connections that are likely to go away on their own, such as during a
+// failover. Each retry waits for an exponential backoff with full jitter, so that the retries of
+// concurrent requests don't line up. The retries are capped by a budget shared by all the models,
+// so that they can't pile onto a database that's actually down.
+//
+// A nil *retryPolicy is valid and never retries.
+type retryPolicy struct {
+	maxRetries int
+	backoff    time.Duration
+
+	mtx    sync.Mutex
+	budget float64
+
+	retries   atomic.Int64
+	exhausted atomic.Int64
+}
+
+// newRetryPolicy returns a policy retrying each query up to maxRetries times, the first one after
+// up to backoff. It returns nil (i.e. no retries) if maxRetries isn't positive.
+func newRetryPolicy(maxRetries int, backoff time.Duration) *retryPolicy {
+	if maxRetries <= 0 {
+		return nil
+	}
+	return &retryPolicy{
+		maxRetries: maxRetries,
+		backoff:    backoff,
+		budget:     retryBudgetMax,
+	}
+}
+
+// do runs fn through the breaker, and runs it again while it fails with a transient error and
+// there are attempts and budget left. fn must be safe to run again, i.e. a read or a whole
+// transaction. The backoff is cut short if ctx is done, in which case the last error is returned.
+func (p *retryPolicy) do(ctx context.Context, b *breaker, fn func() error) error {
+	if p == nil {
+		return b.do(fn)
+	}
+
+	p.deposit()
+
+	for attempt := 0; ; attempt++ {
+		err := b.do(fn)
+		if !isTransientError(err) {
+			return err
+		}
+
+		if attempt == p.maxRetries || !p.withdraw() {
+			p.exhausted.Add(1)
+			return err
+		}
+
+		timer := time.NewTimer(p.delay(attempt))
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			p.exhausted.Add(1)
+			return err
+		}
+
+		p.retries.Add(1)
+	}
+}
+
+// delay returns how long to wait before the retry following the given attempt: a random duration
+// up to the backoff, which doubles with every attempt.
+func (p *retryPolicy) delay(attempt int) time.Duration {
+	ceiling := p.backoff << attempt
+	if ceiling <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(ceiling)))
+}
+
+// deposit adds a query's share of a retry to the budget.
+func (p *retryPolicy) deposit() {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	p.budget += retryBudgetRatio
+	if p.budget > retryBudgetMax {
+		p.budget = retryBudgetMax
+	}
+}
+
+// withdraw takes a retry out of the budget, and reports whether there was one left.
+func (p *retryPolicy) withdraw() bool {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	if p.budget < 1 {
+		return false
+	}
+	p.budget--
+	return true
+}
+
+// Stats returns the policy's counters.
+func (p *retryPolicy) Stats() RetryStats {
+	if p == nil {
+		return RetryStats{}
+	}
+
+	p.mtx.Lock()
+	budget := p.budget
+	p.mtx.Unlock()
+
+	return RetryStats{
+		Retries:   p.retries.Load(),
+		Exhausted: p.exhausted.Load(),
+		Budget:    budget,
+	}
+}
+
+// isTransientError reports whether err is likely to go away if the query is run again, and whether
+// it's safe to do so: either the server rolled the query back, or it never received it. A
+// connection lost in the middle of a query isn't retried (unless database/sql reports it as
+// driver.ErrBadConn, i.e. before anything was sent), since a write may have been committed.
+func isTransientError(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	if errors.Is(err, driver.ErrBadConn) {
+		return true
+	}
+
+	// Connections refused while the primary is failing over.
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return true
+	}
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		// 40001 is "serialization_failure" and 40P01 "deadlock_detected", after which the
+		// transaction has been rolled back. 57P01 to 57P03 cover the server shutting down or
+		// starting up, and 08001 and 08004 the connection being rejected before it was set up.
+		switch pqErr.Code {
+		case "40001", "40P01", "57P01", "57P02", "57P03", "08001", "08004":
+			return true
+		}
+	}
+
+	return false
+}
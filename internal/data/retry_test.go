@@ -0,0 +1,61 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetryPolicy(t *testing.T) {
+	p := newRetryPolicy(2, time.Millisecond)
+	ctx := context.Background()
+
+	// Transient errors are retried until the query succeeds...
+	attempts := 0
+	err := p.do(ctx, nil, func() error {
+		attempts++
+		if attempts < 3 {
+			return &pq.Error{Code: "40001"}
+		}
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 3, attempts)
+
+	// ...or it's out of attempts.
+	attempts = 0
+	err = p.do(ctx, nil, func() error { attempts++; return driver.ErrBadConn })
+	assert.Equal(t, driver.ErrBadConn, err)
+	assert.Equal(t, 3, attempts)
+
+	// Other errors aren't retried.
+	attempts = 0
+	err = p.do(ctx, nil, func() error { attempts++; return sql.ErrNoRows })
+	assert.Equal(t, sql.ErrNoRows, err)
+	assert.Equal(t, 1, attempts)
+
+	stats := p.Stats()
+	assert.Equal(t, int64(4), stats.Retries)
+	assert.Equal(t, int64(1), stats.Exhausted)
+
+	// Once the budget is spent, the transient errors are returned straight away.
+	for p.withdraw() {
+	}
+	attempts = 0
+	err = p.do(ctx, nil, func() error { attempts++; return driver.ErrBadConn })
+	assert.Equal(t, driver.ErrBadConn, err)
+	assert.Equal(t, 1, attempts)
+}
+
+func TestIsTransientError(t *testing.T) {
+	assert.True(t, isTransientError(&pq.Error{Code: "40P01"}))
+	assert.True(t, isTransientError(&pq.Error{Code: "57P01"}))
+	assert.False(t, isTransientError(&pq.Error{Code: "23505"}))
+	assert.False(t, isTransientError(context.DeadlineExceeded))
+	assert.False(t, isTransientError(nil))
+}
@@ -0,0 +1,54 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+)
+
+// insertMovieRevision records the movie as it is at the given version, within the transaction of
+// the update replacing it. Nothing is recorded if the movie has moved on from that version, in
+// which case the update fails with an edit conflict anyway.
+func insertMovieRevision(
+	ctx context.Context,
+	tx *sql.Tx,
+	organizationID, id int64,
+	version int32,
+) error {
+	query := `
+		INSERT INTO movie_revisions (movie_id, version, created_at, title, year, runtime, genres,
+			attributes)
+		SELECT id, version, updated_at, title, year, runtime, genres, attributes
+		FROM movies
+		WHERE id = $1
+			AND organization_id = $2
+			AND version = $3
+		ON CONFLICT DO NOTHING
+	`
+
+	_, err := tx.ExecContext(ctx, query, id, organizationID, version)
+	return err
+}
+
+// GetRevision returns the movie as it was at the given version, which must have been superseded.
+// Its UpdatedAt is when that version was saved.
+func (m MovieModel) GetRevision(
+	ctx context.Context,
+	organizationID, id int64,
+	version int32,
+) (*Movie, error) {
+	if id < 1 || version < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+		SELECT m.id, m.organization_id, m.created_at, r.created_at, r.title, r.year, r.runtime,
+			r.genres, r.attributes, r.version
+		FROM movie_revisions r
+		INNER JOIN movies m ON m.id = r.movie_id
+		WHERE r.movie_id = $1
+			AND m.organization_id = $2
+			AND r.version = $3
+	`
+
+	return queryOne(ctx, m.conn(), query, []any{id, organizationID, version}, movieDests)
+}
@@ -0,0 +1,55 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMovieModel_GetRevision(t *testing.T) {
+	createdAt, _ := time.Parse("2006-01-02", "2022-01-01")
+	revisedAt, _ := time.Parse("2006-01-02", "2022-02-01")
+	query := `FROM movie_revisions r INNER JOIN movies m ON m.id = r.movie_id`
+
+	t.Run("Success", func(t *testing.T) {
+		db, mock := NewMock(t)
+		defer db.Close()
+
+		rows := sqlmock.NewRows([]string{
+			"id",
+			"organization_id",
+			"created_at",
+			"created_at",
+			"title",
+			"year",
+			"runtime",
+			"genres",
+			"attributes",
+			"version",
+		}).AddRow(1, 1, createdAt, revisedAt, "Old Title", 2022, 120, "{Drama}", "{}", 2)
+		mock.ExpectQuery(query).WithArgs(1, 1, 2).WillReturnRows(rows)
+
+		movie, err := MovieModel{DB: db}.GetRevision(context.Background(), 1, 1, 2)
+		assert.Nil(t, err)
+		assert.Equal(t, "Old Title", movie.Title)
+		assert.Equal(t, []string{"Drama"}, movie.Genres)
+		assert.Equal(t, revisedAt, movie.UpdatedAt)
+		assert.Equal(t, int32(2), movie.Version)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("NotFound", func(t *testing.T) {
+		db, mock := NewMock(t)
+		defer db.Close()
+
+		mock.ExpectQuery(query).WithArgs(1, 1, 2).WillReturnError(sql.ErrNoRows)
+
+		movie, err := MovieModel{DB: db}.GetRevision(context.Background(), 1, 1, 2)
+		assert.Nil(t, movie)
+		assert.Equal(t, ErrRecordNotFound, err)
+	})
+}
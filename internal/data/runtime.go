@@ -1,46 +1,169 @@
 package data
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
+	"math"
+	"regexp"
 	"strconv"
 	"strings"
+	"time"
 )
 
 // ErrInvalidRuntimeFormat is an error that UnmarshalJSON() can return if we're unable to parse or
 // convert the JSON string.
 var ErrInvalidRuntimeFormat = errors.New("invalid runtime format")
 
+// RuntimeFormat is a format that a Runtime can be encoded in.
+type RuntimeFormat string
+
+// Constants for the runtime formats, using a runtime of 107 minutes as the example.
+//   - RuntimeMins encodes it as "107 mins" (the default).
+//   - RuntimeMinutes encodes it as the integer 107.
+//   - RuntimeDuration encodes it as a Go duration string, "1h47m".
+//   - RuntimeISO8601 encodes it as an ISO 8601 duration, "PT1H47M".
+const (
+	RuntimeMins     RuntimeFormat = "mins"
+	RuntimeMinutes  RuntimeFormat = "minutes"
+	RuntimeDuration RuntimeFormat = "duration"
+	RuntimeISO8601  RuntimeFormat = "iso8601"
+)
+
+// RuntimeFormats holds every supported runtime format.
+var RuntimeFormats = []RuntimeFormat{RuntimeMins, RuntimeMinutes, RuntimeDuration, RuntimeISO8601}
+
+// iso8601DurationRX matches the ISO 8601 durations that a runtime can be given as, i.e. those with
+// days, hours, minutes and seconds, but not years, months or weeks, whose length varies.
+var iso8601DurationRX = regexp.MustCompile(`^P(?:(\d+)D)?(?:T(?:(\d+)H)?(?:(\d+)M)?(?:(\d+)S)?)?$`)
+
+// maxRuntimeLength is the length of the longest JSON value that UnmarshalJSON() tries to parse.
+// It's ample for every format, and rejects a huge value before it's unquoted or matched.
+const maxRuntimeLength = 64
+
+// maxRuntime is the longest runtime, in either direction, that UnmarshalJSON() accepts. It's the
+// longest that every format can encode, since the Go durations are capped at about 292 years.
+const maxRuntime = int64(math.MaxInt64 / time.Minute)
+
+// Runtime is a movie's runtime in minutes.
 type Runtime int32
 
 // MarshalJSON returns a string in the format "<runtime> mins". Implement a MarshalJSON() method on
 // Runtime type so that it satisfies the json.Marshaler interface.
 func (r Runtime) MarshalJSON() ([]byte, error) {
-	jsonValue := fmt.Sprintf("%d mins", r)
-	quotedJSONValue := strconv.Quote(jsonValue)
-	return []byte(quotedJSONValue), nil
+	return r.MarshalJSONFormat(RuntimeMins)
+}
+
+// MarshalJSONFormat returns the runtime encoded in the given format. An unknown format falls back
+// to RuntimeMins.
+func (r Runtime) MarshalJSONFormat(format RuntimeFormat) ([]byte, error) {
+	// The default and the integer formats, which every movie of a listing is encoded in, are
+	// appended directly rather than going through fmt and json.Marshal.
+	switch format {
+	case RuntimeMinutes:
+		return strconv.AppendInt(make([]byte, 0, 11), int64(r), 10), nil
+	case RuntimeMins, "":
+		b := append(make([]byte, 0, 18), '"')
+		b = strconv.AppendInt(b, int64(r), 10)
+		return append(b, ` mins"`...), nil
+	}
+	return json.Marshal(r.formatValue(format))
 }
 
-// UnmarshalJSON ensures that Runtime satisfies the json.Unmarshaler interface. IMPORTANT: because
-// UnmarshalJSON() needs to modify the receiver (our Runtime type), we must use a pointer receiver
-// for this to work correctly. Otherwise, we will only be modifying a copy (which is then discarded
-// when this method returns).
+// formatValue returns the value the runtime is encoded as in the given format: the number of
+// minutes for RuntimeMinutes, and a string otherwise.
+func (r Runtime) formatValue(format RuntimeFormat) any {
+	hours, minutes := r/60, r%60
+
+	switch format {
+	case RuntimeMinutes:
+		return int32(r)
+	case RuntimeDuration:
+		if hours != 0 {
+			return fmt.Sprintf("%dh%dm", hours, minutes)
+		}
+		return fmt.Sprintf("%dm", minutes)
+	case RuntimeISO8601:
+		switch {
+		case hours != 0 && minutes != 0:
+			return fmt.Sprintf("PT%dH%dM", hours, minutes)
+		case hours != 0:
+			return fmt.Sprintf("PT%dH", hours)
+		default:
+			return fmt.Sprintf("PT%dM", minutes)
+		}
+	default:
+		return fmt.Sprintf("%d mins", r)
+	}
+}
+
+// UnmarshalJSON ensures that Runtime satisfies the json.Unmarshaler interface. It accepts every
+// format that MarshalJSONFormat() can produce: an integer number of minutes, "107 mins", a Go
+// duration such as "1h47m" and an ISO 8601 duration such as "PT1H47M". Durations must be a whole
+// number of minutes. IMPORTANT: because UnmarshalJSON() needs to modify the receiver (our Runtime
+// type), we must use a pointer receiver for this to work correctly. Otherwise, we will only be
+// modifying a copy (which is then discarded when this method returns).
 func (r *Runtime) UnmarshalJSON(jsonValue []byte) error {
+	if len(jsonValue) > maxRuntimeLength {
+		return ErrInvalidRuntimeFormat
+	}
+
+	// A plain integer is a number of minutes.
+	if num, err := strconv.ParseInt(string(jsonValue), 10, 32); err == nil {
+		if num > maxRuntime || num < -maxRuntime {
+			return ErrInvalidRuntimeFormat
+		}
+		*r = Runtime(num)
+		return nil
+	}
+
 	unquotedJSONValue, err := strconv.Unquote(string(jsonValue))
 	if err != nil {
 		return ErrInvalidRuntimeFormat
 	}
 
-	parts := strings.Split(unquotedJSONValue, " ")
-	if len(parts) != 2 || parts[1] != "mins" {
-		return ErrInvalidRuntimeFormat
+	var minutes int64
+	switch {
+	case strings.HasSuffix(unquotedJSONValue, " mins"):
+		minutes, err = strconv.ParseInt(strings.TrimSuffix(unquotedJSONValue, " mins"), 10, 32)
+		if err != nil {
+			return ErrInvalidRuntimeFormat
+		}
+	case strings.HasPrefix(unquotedJSONValue, "P"):
+		matches := iso8601DurationRX.FindStringSubmatch(unquotedJSONValue)
+		if matches == nil || unquotedJSONValue == "P" || strings.HasSuffix(unquotedJSONValue, "T") {
+			return ErrInvalidRuntimeFormat
+		}
+
+		// Add up the days, hours, minutes and seconds as seconds.
+		var seconds int64
+		for i, scale := range []int64{24 * 60 * 60, 60 * 60, 60, 1} {
+			if matches[i+1] == "" {
+				continue
+			}
+			num, err := strconv.ParseInt(matches[i+1], 10, 32)
+			if err != nil {
+				return ErrInvalidRuntimeFormat
+			}
+			seconds += num * scale
+		}
+
+		if seconds%60 != 0 {
+			return ErrInvalidRuntimeFormat
+		}
+		minutes = seconds / 60
+	default:
+		d, err := time.ParseDuration(unquotedJSONValue)
+		if err != nil || d%time.Minute != 0 {
+			return ErrInvalidRuntimeFormat
+		}
+		minutes = int64(d / time.Minute)
 	}
 
-	num, err := strconv.ParseInt(parts[0], 10, 32)
-	if err != nil {
+	if minutes > maxRuntime || minutes < -maxRuntime {
 		return ErrInvalidRuntimeFormat
 	}
 
-	*r = Runtime(num)
+	*r = Runtime(minutes)
 	return nil
 }
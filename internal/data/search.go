@@ -0,0 +1,87 @@
+package data
+
+import "context"
+
+// Constants for the backends that movie searches can run on.
+//   - SearchPostgres uses PostgreSQL's full-text search on the movies table (the default).
+//   - SearchElasticsearch uses an Elasticsearch or OpenSearch index, which is kept up to date as
+//     the movies are written.
+const (
+	SearchPostgres      = "postgres"
+	SearchElasticsearch = "elasticsearch"
+)
+
+// SearchBackends holds every supported search backend.
+var SearchBackends = []string{SearchPostgres, SearchElasticsearch}
+
+// FacetCount is the number of movies with a facet's value, e.g. the genre drama or the decade
+// 1990s.
+type FacetCount struct {
+	Value string `json:"value" xml:"value,attr"`
+	Count int    `json:"count" xml:"count,attr"`
+}
+
+// MovieFacets holds the facet counts of the movies matching a search, so that clients can show
+// how many movies each filter would leave. The counts run from the most common genre, and from
+// the oldest decade.
+type MovieFacets struct {
+	Genres  []FacetCount `json:"genres" xml:"genres>facet"`
+	Decades []FacetCount `json:"decades" xml:"decades>facet"`
+}
+
+// SearchIndex searches the movies of an organization by title and genres. Backends other than
+// PostgreSQL keep their own copy of the movies, so they're told about every write.
+type SearchIndex interface {
+	Search(
+		ctx context.Context,
+		organizationID int64,
+		title string,
+		genres []string,
+		years YearRange,
+		attributes AttributeFilter,
+		filters Filters,
+	) ([]*Movie, Metadata, error)
+	Facets(
+		ctx context.Context,
+		organizationID int64,
+		title string,
+		genres []string,
+	) (*MovieFacets, error)
+	IndexMovie(ctx context.Context, movie *Movie) error
+	DeleteMovie(ctx context.Context, organizationID, id int64) error
+}
+
+// PostgresSearchIndex is the SearchIndex that queries the movies table directly, so there's
+// nothing to index.
+type PostgresSearchIndex struct {
+	Movies MovieModelInterface
+}
+
+func (s PostgresSearchIndex) Search(
+	ctx context.Context,
+	organizationID int64,
+	title string,
+	genres []string,
+	years YearRange,
+	attributes AttributeFilter,
+	filters Filters,
+) ([]*Movie, Metadata, error) {
+	return s.Movies.GetAll(ctx, organizationID, title, genres, years, attributes, filters)
+}
+
+func (s PostgresSearchIndex) Facets(
+	ctx context.Context,
+	organizationID int64,
+	title string,
+	genres []string,
+) (*MovieFacets, error) {
+	return s.Movies.GetFacets(ctx, organizationID, title, genres)
+}
+
+func (s PostgresSearchIndex) IndexMovie(ctx context.Context, movie *Movie) error {
+	return nil
+}
+
+func (s PostgresSearchIndex) DeleteMovie(ctx context.Context, organizationID, id int64) error {
+	return nil
+}
@@ -0,0 +1,308 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/walkccc/greenlight/internal/validator"
+)
+
+var (
+	ErrDuplicateSearchName = errors.New("duplicate saved search name")
+)
+
+// SavedSearch is a named set of movie filters that a user saved, to re-run it later. If Notify is
+// set, the user is emailed whenever a new movie matches it.
+type SavedSearch struct {
+	ID             int64     `json:"id"`
+	UserID         int64     `json:"-"`
+	OrganizationID int64     `json:"-"`
+	CreatedAt      time.Time `json:"created_at"`
+	Name           string    `json:"name" validate:"required,max=100"`
+	Title          string    `json:"title" validate:"max=500"`
+	Genres         []string  `json:"genres" validate:"max=5,unique"`
+	Sort           string    `json:"sort"`
+	Notify         bool      `json:"notify"`
+	Version        int32     `json:"version"`
+}
+
+// SearchSubscription is a saved search that asked for notifications, with the details of the user
+// to notify.
+type SearchSubscription struct {
+	Search    *SavedSearch
+	UserName  string
+	UserEmail string
+}
+
+func ValidateSavedSearch(v *validator.Validator, search *SavedSearch) {
+	v.Struct(search)
+	v.Check(
+		validator.PermittedValue(search.Sort, MovieSortSafeValues...),
+		"sort",
+		validator.CodeNotPermitted,
+		"invalid sort value",
+	)
+}
+
+type SavedSearchModelInterface interface {
+	Insert(ctx context.Context, search *SavedSearch) error
+	Get(ctx context.Context, userID, organizationID, id int64) (*SavedSearch, error)
+	GetAllForUser(ctx context.Context, userID, organizationID int64) ([]*SavedSearch, error)
+	Delete(ctx context.Context, userID, organizationID, id int64) error
+	GetSubscriptionsForMovie(ctx context.Context, movie *Movie) ([]*SearchSubscription, error)
+}
+
+type SavedSearchModel struct {
+	DB      *sql.DB
+	breaker *breaker
+	retry   *retryPolicy
+	timeout time.Duration
+	keys    *Keyring
+}
+
+// Insert saves the search. It returns ErrDuplicateSearchName if the user already has a search with
+// the same name in the organization.
+func (m SavedSearchModel) Insert(ctx context.Context, search *SavedSearch) error {
+	query := `
+		INSERT INTO saved_searches (user_id, organization_id, name, title, genres, sort, notify)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id,
+			created_at,
+			version
+	`
+	args := []any{
+		search.UserID,
+		search.OrganizationID,
+		search.Name,
+		search.Title,
+		pq.Array(search.Genres),
+		search.Sort,
+		search.Notify,
+	}
+
+	ctx, cancel := queryContext(ctx, m.timeout)
+	defer cancel()
+
+	err := m.retry.do(ctx, m.breaker, func() error {
+		return m.DB.QueryRowContext(ctx, query, args...).
+			Scan(&search.ID, utc(&search.CreatedAt), &search.Version)
+	})
+	if err != nil {
+		var pqErr *pq.Error
+		switch {
+		case errors.As(err, &pqErr) && pqErr.Constraint == "saved_searches_name_key":
+			return ErrDuplicateSearchName
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Get returns the user's saved search in the organization.
+func (m SavedSearchModel) Get(
+	ctx context.Context,
+	userID, organizationID, id int64,
+) (*SavedSearch, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+		SELECT id, user_id, organization_id, created_at, name, title, genres, sort, notify, version
+		FROM saved_searches
+		WHERE id = $1
+			AND user_id = $2
+			AND organization_id = $3
+	`
+
+	ctx, cancel := queryContext(ctx, m.timeout)
+	defer cancel()
+
+	var search SavedSearch
+	err := m.retry.do(ctx, m.breaker, func() error {
+		return m.DB.QueryRowContext(ctx, query, id, userID, organizationID).
+			Scan(searchDest(&search)...)
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &search, nil
+}
+
+// GetAllForUser returns the user's saved searches in the organization, oldest first.
+func (m SavedSearchModel) GetAllForUser(
+	ctx context.Context,
+	userID, organizationID int64,
+) ([]*SavedSearch, error) {
+	query := `
+		SELECT id, user_id, organization_id, created_at, name, title, genres, sort, notify, version
+		FROM saved_searches
+		WHERE user_id = $1
+			AND organization_id = $2
+		ORDER BY id
+	`
+
+	ctx, cancel := queryContext(ctx, m.timeout)
+	defer cancel()
+
+	var rows *sql.Rows
+	err := m.retry.do(ctx, m.breaker, func() (err error) {
+		rows, err = m.DB.QueryContext(ctx, query, userID, organizationID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	searches := []*SavedSearch{}
+
+	for rows.Next() {
+		var search SavedSearch
+		err := rows.Scan(searchDest(&search)...)
+		if err != nil {
+			return nil, err
+		}
+		searches = append(searches, &search)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return searches, nil
+}
+
+func (m SavedSearchModel) Delete(ctx context.Context, userID, organizationID, id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	query := `
+		DELETE FROM saved_searches
+		WHERE id = $1
+			AND user_id = $2
+			AND organization_id = $3
+	`
+
+	ctx, cancel := queryContext(ctx, m.timeout)
+	defer cancel()
+
+	var result sql.Result
+	err := m.retry.do(ctx, m.breaker, func() (err error) {
+		result, err = m.DB.ExecContext(ctx, query, id, userID, organizationID)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// GetSubscriptionsForMovie returns the saved searches, in the movie's organization, that asked for
+// notifications and match the movie. The searches of users who aren't activated, or are no longer
+// members of the organization, are left out.
+func (m SavedSearchModel) GetSubscriptionsForMovie(
+	ctx context.Context,
+	movie *Movie,
+) ([]*SearchSubscription, error) {
+	query := `
+		SELECT saved_searches.id,
+			saved_searches.user_id,
+			saved_searches.organization_id,
+			saved_searches.created_at,
+			saved_searches.name,
+			saved_searches.title,
+			saved_searches.genres,
+			saved_searches.sort,
+			saved_searches.notify,
+			saved_searches.version,
+			users.name,
+			users.email,
+			users.email_ciphertext
+		FROM saved_searches
+			INNER JOIN users ON users.id = saved_searches.user_id
+			INNER JOIN organizations_users
+				ON organizations_users.organization_id = saved_searches.organization_id
+				AND organizations_users.user_id = saved_searches.user_id
+		WHERE saved_searches.organization_id = $1
+			AND saved_searches.notify
+			AND users.activated
+			AND (
+				to_tsvector('simple', $2) @@ plainto_tsquery('simple', saved_searches.title)
+				OR saved_searches.title = ''
+			)
+			AND $3 @> saved_searches.genres
+		ORDER BY saved_searches.id
+	`
+	args := []any{movie.OrganizationID, movie.Title, pq.Array(movie.Genres)}
+
+	ctx, cancel := queryContext(ctx, m.timeout)
+	defer cancel()
+
+	var rows *sql.Rows
+	err := m.retry.do(ctx, m.breaker, func() (err error) {
+		rows, err = m.DB.QueryContext(ctx, query, args...)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	subscriptions := []*SearchSubscription{}
+
+	for rows.Next() {
+		subscription := SearchSubscription{Search: &SavedSearch{}}
+		dest := searchDest(subscription.Search)
+		dest = append(dest, &subscription.UserName)
+		dest = append(dest, m.keys.emailDests(&subscription.UserEmail)...)
+		err := rows.Scan(dest...)
+		if err != nil {
+			return nil, err
+		}
+		subscriptions = append(subscriptions, &subscription)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return subscriptions, nil
+}
+
+// searchDest returns the scan destinations of a saved_searches row's columns, in the order the
+// queries select them.
+func searchDest(search *SavedSearch) []any {
+	return []any{
+		&search.ID,
+		&search.UserID,
+		&search.OrganizationID,
+		utc(&search.CreatedAt),
+		&search.Name,
+		&search.Title,
+		pq.Array(&search.Genres),
+		&search.Sort,
+		&search.Notify,
+		&search.Version,
+	}
+}
@@ -0,0 +1,171 @@
+package data
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var savedSearchColumns = []string{
+	"id", "user_id", "organization_id", "created_at", "name", "title", "genres", "sort", "notify",
+	"version",
+}
+
+func TestSavedSearchModel_Insert(t *testing.T) {
+	query := `INSERT INTO saved_searches \(user_id, organization_id, name, title, genres, sort, ` +
+		`notify\) VALUES \(\$1, \$2, \$3, \$4, \$5, \$6, \$7\) RETURNING id, created_at, version`
+	search := &SavedSearch{
+		UserID:         1,
+		OrganizationID: 7,
+		Name:           "New dramas",
+		Title:          "night",
+		Genres:         []string{"drama"},
+		Sort:           "-year",
+		Notify:         true,
+	}
+	args := []driver.Value{1, 7, "New dramas", "night", pq.Array([]string{"drama"}), "-year", true}
+
+	db, mock := NewMock(t)
+	defer db.Close()
+	model := SavedSearchModel{DB: db}
+
+	mock.ExpectQuery(query).
+		WithArgs(args...).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "version"}).
+			AddRow(3, time.Now(), 1))
+	require.NoError(t, model.Insert(context.Background(), search))
+	assert.Equal(t, int64(3), search.ID)
+
+	// The user already has a search with this name in the organization.
+	mock.ExpectQuery(query).
+		WithArgs(args...).
+		WillReturnError(&pq.Error{Code: "23505", Constraint: "saved_searches_name_key"})
+	err := model.Insert(context.Background(), search)
+	assert.ErrorIs(t, err, ErrDuplicateSearchName)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSavedSearchModel_Get(t *testing.T) {
+	query := `FROM saved_searches WHERE id = \$1 AND user_id = \$2 AND organization_id = \$3`
+
+	db, mock := NewMock(t)
+	defer db.Close()
+	model := SavedSearchModel{DB: db}
+
+	mock.ExpectQuery(query).
+		WithArgs(3, 1, 7).
+		WillReturnRows(sqlmock.NewRows(savedSearchColumns).AddRow(
+			3, 1, 7, time.Now(), "New dramas", "night", "{drama}", "-year", true, 1,
+		))
+	search, err := model.Get(context.Background(), 1, 7, 3)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"drama"}, search.Genres)
+	assert.True(t, search.Notify)
+
+	// Another user's search, or one in another organization, isn't found.
+	mock.ExpectQuery(query).WithArgs(3, 2, 7).WillReturnRows(sqlmock.NewRows(savedSearchColumns))
+	_, err = model.Get(context.Background(), 2, 7, 3)
+	assert.ErrorIs(t, err, ErrRecordNotFound)
+
+	_, err = model.Get(context.Background(), 1, 7, 0)
+	assert.ErrorIs(t, err, ErrRecordNotFound)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSavedSearchModel_GetAllForUser(t *testing.T) {
+	query := `FROM saved_searches WHERE user_id = \$1 AND organization_id = \$2 ORDER BY id`
+
+	db, mock := NewMock(t)
+	defer db.Close()
+
+	mock.ExpectQuery(query).
+		WithArgs(1, 7).
+		WillReturnRows(sqlmock.NewRows(savedSearchColumns).
+			AddRow(3, 1, 7, time.Now(), "New dramas", "night", "{drama}", "-year", true, 1).
+			AddRow(4, 1, 7, time.Now(), "Everything", "", "{}", "id", false, 1))
+
+	searches, err := SavedSearchModel{DB: db}.GetAllForUser(context.Background(), 1, 7)
+	require.NoError(t, err)
+	require.Len(t, searches, 2)
+	assert.Equal(t, "Everything", searches[1].Name)
+	assert.Empty(t, searches[1].Genres)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSavedSearchModel_Delete(t *testing.T) {
+	query := `DELETE FROM saved_searches WHERE id = \$1 AND user_id = \$2 AND organization_id = \$3`
+
+	db, mock := NewMock(t)
+	defer db.Close()
+	model := SavedSearchModel{DB: db}
+
+	mock.ExpectExec(query).WithArgs(3, 1, 7).WillReturnResult(sqlmock.NewResult(0, 1))
+	assert.NoError(t, model.Delete(context.Background(), 1, 7, 3))
+
+	mock.ExpectExec(query).WithArgs(3, 1, 7).WillReturnResult(sqlmock.NewResult(0, 0))
+	assert.ErrorIs(t, model.Delete(context.Background(), 1, 7, 3), ErrRecordNotFound)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSavedSearchModel_GetSubscriptionsForMovie(t *testing.T) {
+	// The searches match on the movie's title and genres, and only those of the organization's
+	// activated members who asked for notifications are returned.
+	query := `INNER JOIN users ON users.id = saved_searches.user_id ` +
+		`INNER JOIN organizations_users ` +
+		`ON organizations_users.organization_id = saved_searches.organization_id ` +
+		`AND organizations_users.user_id = saved_searches.user_id ` +
+		`WHERE saved_searches.organization_id = \$1 AND saved_searches.notify ` +
+		`AND users.activated ` +
+		`AND \( to_tsvector\('simple', \$2\) ` +
+		`@@ plainto_tsquery\('simple', saved_searches.title\) ` +
+		`OR saved_searches.title = '' \) ` +
+		`AND \$3 @> saved_searches.genres ORDER BY saved_searches.id`
+	columns := append(append([]string(nil), savedSearchColumns...),
+		"name", "email", "email_ciphertext")
+	movie := &Movie{OrganizationID: 7, Title: "Night of the Hunter", Genres: []string{"drama"}}
+
+	t.Run("Matches", func(t *testing.T) {
+		db, mock := NewMock(t)
+		defer db.Close()
+
+		mock.ExpectQuery(query).
+			WithArgs(7, "Night of the Hunter", pq.Array([]string{"drama"})).
+			WillReturnRows(sqlmock.NewRows(columns).
+				AddRow(3, 1, 7, time.Now(), "New dramas", "night", "{drama}", "-year", true, 1,
+					"Alice", "alice@example.com", nil).
+				AddRow(5, 2, 7, time.Now(), "Everything", "", "{}", "id", true, 1,
+					"Bob", "bob@example.com", nil))
+
+		subscriptions, err := SavedSearchModel{DB: db}.GetSubscriptionsForMovie(
+			context.Background(),
+			movie,
+		)
+		require.NoError(t, err)
+		require.Len(t, subscriptions, 2)
+		assert.Equal(t, "New dramas", subscriptions[0].Search.Name)
+		assert.Equal(t, "Alice", subscriptions[0].UserName)
+		assert.Equal(t, "bob@example.com", subscriptions[1].UserEmail)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Error", func(t *testing.T) {
+		db, mock := NewMock(t)
+		defer db.Close()
+
+		mock.ExpectQuery(query).WillReturnError(errors.New("boom"))
+
+		_, err := SavedSearchModel{DB: db}.GetSubscriptionsForMovie(context.Background(), movie)
+		assert.EqualError(t, err, "boom")
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
@@ -0,0 +1,104 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// ServiceAccount maps the identity of a client certificate to the user that the requests
+// authenticated by the certificate are made as, in the organization, if any.
+type ServiceAccount struct {
+	Identity       string    `json:"identity"`
+	UserID         int64     `json:"user_id"`
+	OrganizationID int64     `json:"organization_id,omitempty"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+type ServiceAccountModelInterface interface {
+	Set(ctx context.Context, account *ServiceAccount) error
+	Delete(ctx context.Context, identity string) error
+}
+
+type ServiceAccountModel struct {
+	DB      *sql.DB
+	breaker *breaker
+	retry   *retryPolicy
+	timeout time.Duration
+}
+
+// Set maps the account's identity to its user and organization, replacing the identity's previous
+// mapping, if any. It returns ErrRecordNotFound if the user doesn't exist, or isn't a member of the
+// organization.
+func (m ServiceAccountModel) Set(ctx context.Context, account *ServiceAccount) error {
+	query := `
+		INSERT INTO service_accounts (identity, user_id, organization_id)
+		SELECT $1, users.id, NULLIF($3, 0)
+		FROM users
+		WHERE users.id = $2
+			AND (
+				$3 = 0
+				OR EXISTS (
+					SELECT 1
+					FROM organizations_users
+					WHERE organizations_users.organization_id = $3
+						AND organizations_users.user_id = users.id
+				)
+			)
+		ON CONFLICT (identity) DO UPDATE
+		SET user_id = EXCLUDED.user_id,
+			organization_id = EXCLUDED.organization_id
+		RETURNING created_at
+	`
+	args := []any{account.Identity, account.UserID, account.OrganizationID}
+
+	ctx, cancel := queryContext(ctx, m.timeout)
+	defer cancel()
+
+	err := m.retry.do(ctx, m.breaker, func() error {
+		return m.DB.QueryRowContext(ctx, query, args...).Scan(utc(&account.CreatedAt))
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Delete removes the identity's mapping, after which its certificate no longer authenticates the
+// requests. It returns ErrRecordNotFound if the identity isn't mapped.
+func (m ServiceAccountModel) Delete(ctx context.Context, identity string) error {
+	query := `
+		DELETE FROM service_accounts
+		WHERE identity = $1
+	`
+
+	ctx, cancel := queryContext(ctx, m.timeout)
+	defer cancel()
+
+	var result sql.Result
+	err := m.retry.do(ctx, m.breaker, func() (err error) {
+		result, err = m.DB.ExecContext(ctx, query, identity)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,152 @@
+package data
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base32"
+	"encoding/base64"
+	"time"
+)
+
+// SigningKey is a key that a server integration signs its requests with, as the user who created
+// it and in the organization it's scoped to, if any. The secret is only returned when the key is
+// created, and it's stored encrypted if the keyring is configured.
+type SigningKey struct {
+	ID             string    `json:"id"`
+	UserID         int64     `json:"-"`
+	OrganizationID int64     `json:"organization_id,omitempty"`
+	CreatedAt      time.Time `json:"created_at"`
+	Secret         string    `json:"secret,omitempty"` // base64
+}
+
+type SigningKeyModelInterface interface {
+	New(ctx context.Context, userID, organizationID int64) (*SigningKey, error)
+	GetAllForUser(ctx context.Context, userID int64) ([]*SigningKey, error)
+	Delete(ctx context.Context, userID int64, id string) error
+}
+
+type SigningKeyModel struct {
+	DB      *sql.DB
+	breaker *breaker
+	retry   *retryPolicy
+	timeout time.Duration
+	keys    *Keyring
+}
+
+func (m SigningKeyModel) conn() conn {
+	return conn{db: m.DB, breaker: m.breaker, retry: m.retry, timeout: m.timeout}
+}
+
+// New creates a signing key for the user, scoped to the organization unless organizationID is zero,
+// with a random ID and a random 32-byte secret.
+func (m SigningKeyModel) New(
+	ctx context.Context,
+	userID, organizationID int64,
+) (*SigningKey, error) {
+	id := make([]byte, 10)
+	secret := make([]byte, 32)
+	for _, b := range [][]byte{id, secret} {
+		_, err := rand.Read(b)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	key := &SigningKey{
+		ID:             "sk_" + base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(id),
+		UserID:         userID,
+		OrganizationID: organizationID,
+		Secret:         base64.StdEncoding.EncodeToString(secret),
+	}
+
+	columns, err := m.keys.sealSecret(secret)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+		INSERT INTO signing_keys (id, user_id, organization_id, secret, secret_ciphertext,
+			secret_key_id)
+		VALUES ($1, $2, NULLIF($3, 0), $4, $5, $6)
+		RETURNING created_at
+	`
+	args := []any{
+		key.ID,
+		userID,
+		organizationID,
+		columns.plaintext,
+		columns.ciphertext,
+		columns.keyID,
+	}
+
+	ctx, cancel := queryContext(ctx, m.timeout)
+	defer cancel()
+
+	err = m.retry.do(ctx, m.breaker, func() error {
+		return m.DB.QueryRowContext(ctx, query, args...).Scan(utc(&key.CreatedAt))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+// GetAllForUser returns the user's signing keys, without their secrets, oldest first.
+func (m SigningKeyModel) GetAllForUser(ctx context.Context, userID int64) ([]*SigningKey, error) {
+	query := `
+		SELECT id,
+			user_id,
+			COALESCE(organization_id, 0),
+			created_at
+		FROM signing_keys
+		WHERE user_id = $1
+		ORDER BY created_at, id
+	`
+
+	keys, err := queryMany(ctx, m.conn(), query, []any{userID}, func(key *SigningKey) []any {
+		return []any{&key.ID, &key.UserID, &key.OrganizationID, utc(&key.CreatedAt)}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]*SigningKey, len(keys))
+	for i := range keys {
+		result[i] = &keys[i]
+	}
+	return result, nil
+}
+
+// Delete revokes the user's signing key. It returns ErrRecordNotFound if the user has no such key.
+func (m SigningKeyModel) Delete(ctx context.Context, userID int64, id string) error {
+	query := `
+		DELETE FROM signing_keys
+		WHERE id = $1
+			AND user_id = $2
+	`
+
+	ctx, cancel := queryContext(ctx, m.timeout)
+	defer cancel()
+
+	var result sql.Result
+	err := m.retry.do(ctx, m.breaker, func() (err error) {
+		result, err = m.DB.ExecContext(ctx, query, id, userID)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,108 @@
+package data
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/base64"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// sealedArg matches a secret sealed by the keyring, and records it.
+type sealedArg struct {
+	keys   *Keyring
+	sealed *[]byte
+}
+
+func (a sealedArg) Match(v driver.Value) bool {
+	b, ok := v.([]byte)
+	if !ok {
+		return false
+	}
+	if _, err := a.keys.open(b); err != nil {
+		return false
+	}
+	*a.sealed = b
+	return true
+}
+
+func TestSigningKeyModel_SealedSecret(t *testing.T) {
+	insertQuery := `INSERT INTO signing_keys \(id, user_id, organization_id, secret, ` +
+		`secret_ciphertext, secret_key_id\) VALUES \(\$1, \$2, NULLIF\(\$3, 0\), \$4, \$5, \$6\)`
+	selectQuery := `signing_keys.secret, signing_keys.secret_ciphertext FROM users ` +
+		`INNER JOIN signing_keys ON users.id = signing_keys.user_id WHERE signing_keys.id = \$1`
+	keys, err := NewKeyring(map[uint32][]byte{1: bytes.Repeat([]byte{1}, 32)}, make([]byte, 32))
+	require.NoError(t, err)
+
+	db, mock := NewMock(t)
+	defer db.Close()
+
+	// The secret is only written encrypted.
+	var sealed []byte
+	mock.ExpectQuery(insertQuery).
+		WithArgs(sqlmock.AnyArg(), 1, 7, nil, sealedArg{keys: keys, sealed: &sealed}, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"created_at"}).AddRow(time.Now()))
+
+	key, err := SigningKeyModel{DB: db, keys: keys}.New(context.Background(), 1, 7)
+	require.NoError(t, err)
+	secret, err := base64.StdEncoding.DecodeString(key.Secret)
+	require.NoError(t, err)
+	assert.NotContains(t, string(sealed), string(secret))
+
+	// It's decrypted when the key is looked up.
+	mock.ExpectQuery(selectQuery).
+		WithArgs(key.ID).
+		WillReturnRows(sqlmock.NewRows([]string{
+			"id", "created_at", "name", "email", "email_ciphertext", "password_hash", "activated",
+			"version", "organization_id", "secret", "secret_ciphertext",
+		}).AddRow(
+			1, time.Now(), "Alice", "alice@example.com", nil, []byte("hash"), true, 1, 7, nil,
+			sealed,
+		))
+
+	user, got, err := UserModel{DB: db, keys: keys}.GetForSigningKey(context.Background(), key.ID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(7), user.OrganizationID)
+	assert.Equal(t, secret, got)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestKeyring_SecretDests(t *testing.T) {
+	keys, err := NewKeyring(map[uint32][]byte{1: bytes.Repeat([]byte{1}, 32)}, make([]byte, 32))
+	require.NoError(t, err)
+	secret := []byte("0123456789abcdef0123456789abcdef")
+	scan := func(dest, src any) error { return dest.(sql.Scanner).Scan(src) }
+
+	// Without a keyring, the secrets are stored, and read, in plaintext.
+	var nilKeyring *Keyring
+	columns, err := nilKeyring.sealSecret(secret)
+	require.NoError(t, err)
+	assert.Equal(t, secretColumns{plaintext: secret}, columns)
+
+	var got []byte
+	dests := nilKeyring.secretDests(&got)
+	require.NoError(t, scan(dests[0], secret))
+	require.NoError(t, scan(dests[1], nil))
+	assert.Equal(t, secret, got)
+
+	columns, err = keys.sealSecret(secret)
+	require.NoError(t, err)
+	assert.Nil(t, columns.plaintext)
+	assert.Equal(t, int64(1), columns.keyID)
+
+	got = nil
+	dests = keys.secretDests(&got)
+	require.NoError(t, scan(dests[0], nil))
+	require.NoError(t, scan(dests[1], columns.ciphertext))
+	assert.Equal(t, secret, got)
+
+	// An encrypted secret can't be read without the keyring.
+	dests = nilKeyring.secretDests(&got)
+	assert.ErrorIs(t, scan(dests[1], columns.ciphertext), ErrNoKeyring)
+}
@@ -0,0 +1,130 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+)
+
+// statements is a cache of prepared statements keyed by their SQL text. Each statement is prepared
+// the first time it's used and then reused for the lifetime of the connection pool, sparing
+// PostgreSQL from parsing and planning the same SQL on every call. Note that a sql.Stmt is safe for
+// concurrent use, and database/sql transparently re-prepares it on other connections as needed.
+//
+// A nil *statements is valid and simply runs every query unprepared.
+type statements struct {
+	db    *sql.DB
+	mtx   sync.RWMutex
+	cache map[string]*sql.Stmt
+}
+
+// newStatements returns an empty statement cache for the connection pool.
+func newStatements(db *sql.DB) *statements {
+	return &statements{
+		db:    db,
+		cache: make(map[string]*sql.Stmt),
+	}
+}
+
+// prepare returns the cached statement for the query, preparing it if this is the first time the
+// query is used.
+func (s *statements) prepare(ctx context.Context, query string) (*sql.Stmt, error) {
+	s.mtx.RLock()
+	stmt, found := s.cache[query]
+	s.mtx.RUnlock()
+	if found {
+		return stmt, nil
+	}
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	// Another goroutine may have prepared the statement while we were waiting for the lock.
+	if stmt, found := s.cache[query]; found {
+		return stmt, nil
+	}
+
+	stmt, err := s.db.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	s.cache[query] = stmt
+	return stmt, nil
+}
+
+// queryRowContext executes a query that is expected to return at most one row. If the statement
+// can't be prepared, we fall back to running the query unprepared, so that the caller receives the
+// underlying error from Scan() as usual.
+func (s *statements) queryRowContext(
+	ctx context.Context,
+	db *sql.DB,
+	query string,
+	args ...any,
+) *sql.Row {
+	if s == nil {
+		return db.QueryRowContext(ctx, query, args...)
+	}
+
+	stmt, err := s.prepare(ctx, query)
+	if err != nil {
+		return db.QueryRowContext(ctx, query, args...)
+	}
+	return stmt.QueryRowContext(ctx, args...)
+}
+
+// txQueryRowContext is like queryRowContext, but runs the query within the transaction.
+func (s *statements) txQueryRowContext(
+	ctx context.Context,
+	tx *sql.Tx,
+	query string,
+	args ...any,
+) *sql.Row {
+	if s == nil {
+		return tx.QueryRowContext(ctx, query, args...)
+	}
+
+	stmt, err := s.prepare(ctx, query)
+	if err != nil {
+		return tx.QueryRowContext(ctx, query, args...)
+	}
+	// The transaction's copy of the statement is closed along with the transaction.
+	return tx.StmtContext(ctx, stmt).QueryRowContext(ctx, args...)
+}
+
+// execContext executes a query without returning any rows.
+func (s *statements) execContext(
+	ctx context.Context,
+	db *sql.DB,
+	query string,
+	args ...any,
+) (sql.Result, error) {
+	if s == nil {
+		return db.ExecContext(ctx, query, args...)
+	}
+
+	stmt, err := s.prepare(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	return stmt.ExecContext(ctx, args...)
+}
+
+// Close closes all the cached statements.
+func (s *statements) Close() error {
+	if s == nil {
+		return nil
+	}
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	var firstErr error
+	for query, stmt := range s.cache {
+		if err := stmt.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		delete(s.cache, query)
+	}
+	return firstErr
+}
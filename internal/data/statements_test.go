@@ -0,0 +1,116 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStatements_PrepareOnce(t *testing.T) {
+	createdAt, _ := time.Parse("2006-01-02", "2022-01-01")
+	query := `
+		SELECT id, organization_id, created_at, updated_at, title, year, runtime, genres,
+			attributes, version
+		FROM movies
+		WHERE id = \$1
+			AND organization_id = \$2
+			AND deleted_at IS NULL
+	`
+	columns := []string{
+		"id",
+		"organization_id",
+		"created_at",
+		"updated_at",
+		"title",
+		"year",
+		"runtime",
+		"genres",
+		"attributes",
+		"version",
+	}
+
+	db, mock := NewMock(t)
+	defer db.Close()
+
+	prep := mock.ExpectPrepare(query)
+	prep.ExpectQuery().
+		WithArgs(1, 1).
+		WillReturnRows(sqlmock.NewRows(columns).AddRow(
+			1, 1, createdAt, createdAt, "Movie 1", 2022, 99, "{}", "{}", 1,
+		))
+	prep.ExpectQuery().
+		WithArgs(2, 1).
+		WillReturnRows(sqlmock.NewRows(columns).AddRow(
+			2, 1, createdAt, createdAt, "Movie 2", 2022, 99, "{}", "{}", 1,
+		))
+
+	model := MovieModel{DB: db, stmts: newStatements(db)}
+
+	movie, err := model.Get(context.Background(), 1, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, "Movie 1", movie.Title)
+
+	movie, err = model.Get(context.Background(), 1, 2)
+	assert.Nil(t, err)
+	assert.Equal(t, "Movie 2", movie.Title)
+
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+// BenchmarkMovieModel_Get compares unprepared and prepared lookups against a real database, since
+// the cost we're saving is PostgreSQL parsing and planning the query. Point GREENLIGHT_TEST_DB_DSN
+// to a migrated database to run it:
+//
+//	GREENLIGHT_TEST_DB_DSN=$GREENLIGHT_DB_DSN go test -run=^$ -bench=MovieModel_Get ./internal/data
+func BenchmarkMovieModel_Get(b *testing.B) {
+	dsn := os.Getenv("GREENLIGHT_TEST_DB_DSN")
+	if dsn == "" {
+		b.Skip("GREENLIGHT_TEST_DB_DSN is not set")
+	}
+
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer db.Close()
+
+	movie := &Movie{
+		OrganizationID: DefaultOrganizationID,
+		Title:          "Benchmark Movie",
+		Year:           2000,
+		Runtime:        100,
+		Genres:         []string{"drama"},
+	}
+	if err := (MovieModel{DB: db}).Create(context.Background(), movie); err != nil {
+		b.Fatal(err)
+	}
+	defer MovieModel{DB: db}.Delete(context.Background(), movie.OrganizationID, movie.ID, 0)
+
+	benchmarks := []struct {
+		name  string
+		model MovieModel
+	}{
+		{name: "Unprepared", model: MovieModel{DB: db}},
+		{name: "Prepared", model: MovieModel{DB: db, stmts: newStatements(db)}},
+	}
+
+	for _, bm := range benchmarks {
+		b.Run(bm.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := bm.model.Get(
+					context.Background(),
+					movie.OrganizationID,
+					movie.ID,
+				); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+		bm.model.stmts.Close()
+	}
+}
@@ -2,6 +2,7 @@ package data
 
 import (
 	"context"
+	"crypto/hmac"
 	"crypto/rand"
 	"crypto/sha256"
 	"database/sql"
@@ -17,19 +18,76 @@ const (
 	ScopeAuthentication = "authentication"
 )
 
+// The versions of the schemes the tokens are hashed with. A token's version is stored along with
+// its hash, so that the tokens hashed with an older scheme still work, and are rehashed with the
+// current one the next time they're used.
+const (
+	// TokenHashSHA256 is the SHA-256 hash of the plaintext.
+	TokenHashSHA256 = 1
+	// TokenHashHMAC is the HMAC-SHA256 of the plaintext with a server secret, so that a leaked
+	// tokens table can't be used to check guesses without the secret as well.
+	TokenHashHMAC = 2
+)
+
+// tokenHasher hashes the tokens with the current scheme, which is TokenHashHMAC if it has a
+// secret, or TokenHashSHA256 otherwise.
+type tokenHasher struct {
+	secret []byte
+}
+
+func (h tokenHasher) current() int {
+	if h.secret != nil {
+		return TokenHashHMAC
+	}
+	return TokenHashSHA256
+}
+
+// hash returns the hash of the plaintext with the given scheme.
+func (h tokenHasher) hash(version int, plaintext string) []byte {
+	switch version {
+	case TokenHashHMAC:
+		mac := hmac.New(sha256.New, h.secret)
+		mac.Write([]byte(plaintext))
+		return mac.Sum(nil)
+	default:
+		hash := sha256.Sum256([]byte(plaintext))
+		return hash[:]
+	}
+}
+
+// candidates returns the plaintext's hashes with each of the schemes the hasher supports, which
+// are the hashes that the token may be stored with.
+func (h tokenHasher) candidates(plaintext string) [][]byte {
+	hashes := [][]byte{h.hash(TokenHashSHA256, plaintext)}
+	if h.secret != nil {
+		hashes = append(hashes, h.hash(TokenHashHMAC, plaintext))
+	}
+	return hashes
+}
+
 // Token holds the data for an individual token.
 type Token struct {
-	Plaintext string    `json:"token"`
-	Hash      []byte    `json:"-"`
-	UserID    int64     `json:"-"`
-	Expiry    time.Time `json:"expiry"`
-	Scope     string    `json:"-"`
+	Plaintext   string    `json:"token"`
+	Hash        []byte    `json:"-"`
+	HashVersion int       `json:"-"` // the scheme the hash was made with, e.g. TokenHashHMAC
+	UserID      int64     `json:"-"`
+	Expiry      time.Time `json:"expiry"`
+	Scope       string    `json:"-"`
+
+	// OrganizationID is the organization an authentication token is scoped to, or zero for
+	// tokens that aren't scoped to one (e.g. activation tokens).
+	OrganizationID int64 `json:"organization_id,omitempty"`
 }
 
-func generateToken(userID int64, ttl time.Duration, scope string) (*Token, error) {
+func generateToken(
+	userID int64,
+	ttl time.Duration,
+	scope string,
+	hasher tokenHasher,
+) (*Token, error) {
 	token := &Token{
 		UserID: userID,
-		Expiry: time.Now().Add(ttl),
+		Expiry: time.Now().Add(ttl).UTC(),
 		Scope:  scope,
 	}
 
@@ -47,61 +105,93 @@ func generateToken(userID int64, ttl time.Duration, scope string) (*Token, error
 	// similar to this: Y3QMGX3PJ3WLRL2YRTQGQ6KRHU.
 	token.Plaintext = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(randomBytes)
 
-	// Generate a SHA-256 hash of the plaintext token string. This will be the value stored in the
-	// db. Note that the sha256.Sum256() function returns an ARRAY of length 32, so to make it
-	// easier to work with we convert it to a slice using the [:] operator befor storing it.
-	hash := sha256.Sum256([]byte(token.Plaintext))
-	token.Hash = hash[:]
+	// Hash the plaintext token string with the current scheme. This will be the value stored in the
+	// db.
+	token.HashVersion = hasher.current()
+	token.Hash = hasher.hash(token.HashVersion, token.Plaintext)
 	return token, nil
 }
 
 func ValidateTokenPlaintext(v *validator.Validator, tokenPlaintext string) {
-	v.Check(tokenPlaintext != "", "token", "must be provided")
-	v.Check(len(tokenPlaintext) == 26, "token", "must be 26 bytes long")
+	v.Check(tokenPlaintext != "", "token", validator.CodeRequired, "must be provided")
+	v.Check(len(tokenPlaintext) == 26, "token", validator.CodeInvalid, "must be 26 bytes long")
 }
 
 type TokenModelInterface interface {
-	New(userID int64, ttl time.Duration, scope string) (*Token, error)
-	Create(token *Token) error
-	DeleteAllForUser(scope string, userID int64) error
+	New(ctx context.Context, userID int64, ttl time.Duration, scope string) (*Token, error)
+	NewForOrganization(
+		ctx context.Context,
+		userID int64,
+		organizationID int64,
+		ttl time.Duration,
+		scope string,
+	) (*Token, error)
+	Create(ctx context.Context, token *Token) error
+	DeleteAllForUser(ctx context.Context, scope string, userID int64) error
 }
 
 type TokenModel struct {
-	DB *sql.DB
+	DB      *sql.DB
+	breaker *breaker
+	retry   *retryPolicy
+	timeout time.Duration
+	hasher  tokenHasher
 }
 
 // New creates a new Token struct and then inserts the data in the tokens table.
-func (m TokenModel) New(userID int64, ttl time.Duration, scope string) (*Token, error) {
-	token, err := generateToken(userID, ttl, scope)
+func (m TokenModel) New(
+	ctx context.Context,
+	userID int64,
+	ttl time.Duration,
+	scope string,
+) (*Token, error) {
+	return m.NewForOrganization(ctx, userID, 0, ttl, scope)
+}
+
+// NewForOrganization is like New, but scopes the token to an organization. The caller is
+// responsible for checking that the user is a member of it.
+func (m TokenModel) NewForOrganization(
+	ctx context.Context,
+	userID int64,
+	organizationID int64,
+	ttl time.Duration,
+	scope string,
+) (*Token, error) {
+	token, err := generateToken(userID, ttl, scope, m.hasher)
 	if err != nil {
 		return nil, err
 	}
+	token.OrganizationID = organizationID
 
-	err = m.Create(token)
+	err = m.Create(ctx, token)
 	return token, err
 }
 
-func (m TokenModel) Create(token *Token) error {
+func (m TokenModel) Create(ctx context.Context, token *Token) error {
 	query := `
-		INSERT INTO tokens (hash, user_id, expiry, scope)
-		VALUES ($1, $2, $3, $4)
+		INSERT INTO tokens (hash, hash_version, user_id, expiry, scope, organization_id)
+		VALUES ($1, $2, $3, $4, $5, $6)
 	`
 	args := []any{
 		token.Hash,
+		token.HashVersion,
 		token.UserID,
 		token.Expiry,
 		token.Scope,
+		sql.NullInt64{Int64: token.OrganizationID, Valid: token.OrganizationID != 0},
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := queryContext(ctx, m.timeout)
 	defer cancel()
 
-	_, err := m.DB.ExecContext(ctx, query, args...)
-	return err
+	return m.retry.do(ctx, m.breaker, func() error {
+		_, err := m.DB.ExecContext(ctx, query, args...)
+		return err
+	})
 }
 
 // DeleteAllForUsers deletes all tokens for a specific user and scope.
-func (m TokenModel) DeleteAllForUser(scope string, userID int64) error {
+func (m TokenModel) DeleteAllForUser(ctx context.Context, scope string, userID int64) error {
 	query := `
 		DELETE FROM tokens
 		WHERE scope = $1
@@ -112,9 +202,38 @@ func (m TokenModel) DeleteAllForUser(scope string, userID int64) error {
 		userID,
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := queryContext(ctx, m.timeout)
+	defer cancel()
+
+	return m.retry.do(ctx, m.breaker, func() error {
+		_, err := m.DB.ExecContext(ctx, query, args...)
+		return err
+	})
+}
+
+// rehashToken replaces the hash of a token that was hashed with an older scheme by its hash with
+// the current one.
+func rehashToken(
+	ctx context.Context,
+	c conn,
+	hasher tokenHasher,
+	oldHash []byte,
+	plaintext string,
+) error {
+	query := `
+		UPDATE tokens
+		SET hash = $1,
+			hash_version = $2
+		WHERE hash = $3
+	`
+	version := hasher.current()
+	args := []any{hasher.hash(version, plaintext), version, oldHash}
+
+	ctx, cancel := queryContext(ctx, c.timeout)
 	defer cancel()
 
-	_, err := m.DB.ExecContext(ctx, query, args...)
-	return err
+	return c.retry.do(ctx, c.breaker, func() error {
+		_, err := c.db.ExecContext(ctx, query, args...)
+		return err
+	})
 }
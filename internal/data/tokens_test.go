@@ -0,0 +1,50 @@
+package data
+
+import (
+	"context"
+	"crypto/sha256"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUserModel_GetForToken_Rehash(t *testing.T) {
+	db, mock := NewMock(t)
+	defer db.Close()
+
+	hasher := tokenHasher{secret: []byte("0123456789abcdef0123456789abcdef")}
+	model := UserModel{DB: db, hasher: hasher}
+	plaintext := "Y3QMGX3PJ3WLRL2YRTQGQ6KRHU"
+	oldHash := sha256.Sum256([]byte(plaintext))
+	createdAt := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// The token is looked up by its hashes with both schemes, and it was hashed with SHA-256, so
+	// it's rehashed with the secret.
+	mock.ExpectQuery(`INNER JOIN tokens ON users.id = tokens.user_id `+
+		`WHERE tokens.hash = ANY\(\$1\)`).
+		WithArgs(pq.Array(hasher.candidates(plaintext)), ScopeAuthentication, sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{
+			"id", "created_at", "name", "email", "email_ciphertext", "password_hash", "activated",
+			"version", "organization_id", "hash", "hash_version",
+		}).AddRow(
+			1, createdAt, "Alice", "alice@example.com", nil, []byte("hash"), true, 1, 0,
+			oldHash[:], TokenHashSHA256,
+		))
+	mock.ExpectExec(`UPDATE tokens SET hash = \$1, hash_version = \$2 WHERE hash = \$3`).
+		WithArgs(hasher.hash(TokenHashHMAC, plaintext), TokenHashHMAC, oldHash[:]).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	user, err := model.GetForToken(context.Background(), ScopeAuthentication, plaintext)
+	assert.Nil(t, err)
+	assert.Equal(t, "alice@example.com", user.Email)
+
+	assert.Nil(t, mock.ExpectationsWereMet())
+
+	// Without a secret, the tokens are hashed with SHA-256 and only looked up by that hash.
+	assert.Equal(t, TokenHashSHA256, tokenHasher{}.current())
+	assert.Equal(t, [][]byte{oldHash[:]}, tokenHasher{}.candidates(plaintext))
+	assert.NotEqual(t, oldHash[:], hasher.hash(TokenHashHMAC, plaintext))
+}
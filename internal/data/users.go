@@ -2,11 +2,11 @@ package data
 
 import (
 	"context"
-	"crypto/sha256"
 	"database/sql"
 	"errors"
 	"time"
 
+	"github.com/lib/pq"
 	"github.com/walkccc/greenlight/internal/validator"
 	"golang.org/x/crypto/bcrypt"
 )
@@ -27,6 +27,12 @@ type User struct {
 	Password  password  `json:"-"`
 	Activated bool      `json:"activated"`
 	Version   int       `json:"-"`
+
+	// OrganizationID is the organization the user is acting in, resolved from their authentication
+	// token. It's zero for users that weren't loaded from an organization-scoped token.
+	OrganizationID int64 `json:"-"`
+
+	Links Links `json:"_links,omitempty"`
 }
 
 func (u *User) IsAnonymous() bool {
@@ -69,19 +75,34 @@ func (p *password) Matches(plaintextPassword string) (bool, error) {
 }
 
 func ValidateEmail(v *validator.Validator, email string) {
-	v.Check(email != "", "email", "must be provided")
-	v.Check(validator.Matches(email, validator.EmailRX), "email", "must be a valid email address")
+	v.Check(email != "", "email", validator.CodeRequired, "must be provided")
+	v.Check(
+		validator.ValidEmail(email),
+		"email",
+		validator.CodeInvalid,
+		"must be a valid email address",
+	)
 }
 
 func ValidatePasswordPlaintext(v *validator.Validator, password string) {
-	v.Check(password != "", "password", "must be provided")
-	v.Check(len(password) >= 8, "password", "must be at least 8 bytes long")
-	v.Check(len(password) <= 72, "password", "must not be more than 72 bytes long")
+	v.Check(password != "", "password", validator.CodeRequired, "must be provided")
+	v.Check(len(password) >= 8, "password", validator.CodeTooShort, "must be at least 8 bytes long")
+	v.Check(
+		len(password) <= 72,
+		"password",
+		validator.CodeTooLong,
+		"must not be more than 72 bytes long",
+	)
 }
 
 func ValidateUser(v *validator.Validator, user *User) {
-	v.Check(user.Name != "", "name", "must be provided")
-	v.Check(len(user.Name) < 500, "name", "must not be more than 500 bytes long")
+	v.Check(user.Name != "", "name", validator.CodeRequired, "must be provided")
+	v.Check(
+		len(user.Name) < 500,
+		"name",
+		validator.CodeTooLong,
+		"must not be more than 500 bytes long",
+	)
 
 	ValidateEmail(v, user.Email)
 
@@ -99,39 +120,77 @@ func ValidateUser(v *validator.Validator, user *User) {
 }
 
 type UserModelInterface interface {
-	Create(user *User) error
-	GetByEmail(email string) (*User, error)
-	GetForToken(scope, tokenPlaintext string) (*User, error)
-	Update(user *User) error
+	Create(ctx context.Context, user *User) error
+	GetByEmail(ctx context.Context, email string) (*User, error)
+	GetForToken(ctx context.Context, scope, tokenPlaintext string) (*User, error)
+	GetForSigningKey(ctx context.Context, keyID string) (*User, []byte, error)
+	GetForCertificate(ctx context.Context, identity string) (*User, error)
+	Update(ctx context.Context, user *User) error
+	EncryptEmails(ctx context.Context, limit int) (int, error)
 }
 
 type UserModel struct {
-	DB *sql.DB
+	DB      *sql.DB
+	stmts   *statements
+	breaker *breaker
+	retry   *retryPolicy
+	timeout time.Duration
+	keys    *Keyring
+	hasher  tokenHasher
 }
 
-func (m UserModel) Create(user *User) error {
+func (m UserModel) conn() conn {
+	return conn{db: m.DB, stmts: m.stmts, breaker: m.breaker, retry: m.retry, timeout: m.timeout}
+}
+
+func (m UserModel) Create(ctx context.Context, user *User) error {
 	query := `
-		INSERT INTO users (name, email, password_hash, activated)
-		VALUES ($1, $2, $3, $4)
+		INSERT INTO users (
+			name,
+			email,
+			email_ciphertext,
+			email_index,
+			email_key_id,
+			password_hash,
+			activated
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
 		RETURNING id,
 			created_at,
 			version
 	`
+
+	email, err := m.keys.sealEmail(user.Email)
+	if err != nil {
+		return err
+	}
 	args := []any{
 		user.Name,
-		user.Email,
+		email.plaintext,
+		email.ciphertext,
+		email.index,
+		email.keyID,
 		user.Password.hash,
 		user.Activated,
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := queryContext(ctx, m.timeout)
 	defer cancel()
 
-	err := m.DB.QueryRowContext(ctx, query, args...).
-		Scan(&user.ID, &user.CreatedAt, &user.Version)
+	err = m.retry.do(ctx, m.breaker, func() error {
+		return withTx(ctx, m.DB, func(tx *sql.Tx) error {
+			err := tx.QueryRowContext(ctx, query, args...).
+				Scan(&user.ID, utc(&user.CreatedAt), &user.Version)
+			if err != nil {
+				return err
+			}
+
+			return insertOutboxEvent(ctx, tx, EventUserRegistered, user.ID, user)
+		})
+	})
 	if err != nil {
 		switch {
-		case err.Error() == `pq: duplicate key value violates unique constraint "users_email_key"`:
+		case isDuplicateEmail(err):
 			return ErrDuplicateEmail
 		default:
 			return err
@@ -141,121 +200,221 @@ func (m UserModel) Create(user *User) error {
 	return nil
 }
 
-func (m UserModel) GetByEmail(email string) (*User, error) {
+// isDuplicateEmail reports whether the error is a violation of the unique constraint on either the
+// plaintext emails or the blind indexes of the encrypted ones.
+func isDuplicateEmail(err error) bool {
+	switch err.Error() {
+	case `pq: duplicate key value violates unique constraint "users_email_key"`,
+		`pq: duplicate key value violates unique constraint "users_email_index_key"`:
+		return true
+	default:
+		return false
+	}
+}
+
+// GetByEmail returns the user with the email, which is looked up by its blind index if the emails
+// are encrypted. The plaintext emails are checked as well, for the users whose email hasn't been
+// encrypted yet.
+func (m UserModel) GetByEmail(ctx context.Context, email string) (*User, error) {
 	query := `
 		SELECT id,
 			created_at,
 			name,
 			email,
+			email_ciphertext,
 			password_hash,
 			activated,
 			version
 		FROM users
 		WHERE email = $1
+			OR email_index = $2
 	`
 
-	var user User
-
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
-
-	err := m.DB.QueryRowContext(ctx, query, email).Scan(
-		&user.ID,
-		&user.CreatedAt,
-		&user.Name,
-		&user.Email,
-		&user.Password.hash,
-		&user.Activated,
-		&user.Version,
-	)
-	if err != nil {
-		switch {
-		case errors.Is(err, sql.ErrNoRows):
-			return nil, ErrRecordNotFound
-		default:
-			return nil, err
-		}
-	}
-
-	return &user, nil
+	return queryOne(ctx, m.conn(), query, []any{email, m.keys.blindIndex(email)}, m.userDests)
 }
 
-func (m UserModel) GetForToken(tokenScope, tokenPlaintext string) (*User, error) {
-	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
+// userDests returns the scan destinations of the users' columns selected by GetByEmail(), in order.
+func (m UserModel) userDests(user *User) []any {
+	dests := []any{&user.ID, utc(&user.CreatedAt), &user.Name}
+	dests = append(dests, m.keys.emailDests(&user.Email)...)
+	return append(dests, &user.Password.hash, &user.Activated, &user.Version)
+}
 
+// GetForToken returns the user that the token was issued to. The token may have been hashed with
+// any of the supported schemes, and if it wasn't hashed with the current one, it's rehashed with
+// it.
+func (m UserModel) GetForToken(
+	ctx context.Context,
+	tokenScope, tokenPlaintext string,
+) (*User, error) {
 	query := `
 		SELECT users.id,
 			users.created_at,
 			users.name,
 			users.email,
+			users.email_ciphertext,
 			users.password_hash,
 			users.activated,
-			users.version
+			users.version,
+			COALESCE(tokens.organization_id, 0),
+			tokens.hash,
+			tokens.hash_version
 		FROM users
 			INNER JOIN tokens ON users.id = tokens.user_id
-		WHERE tokens.hash = $1
+		WHERE tokens.hash = ANY($1)
 			AND tokens.scope = $2
 			AND tokens.expiry > $3
+			AND (
+				tokens.organization_id IS NULL
+				OR EXISTS (
+					SELECT 1
+					FROM organizations_users
+					WHERE organizations_users.organization_id = tokens.organization_id
+						AND organizations_users.user_id = users.id
+				)
+			)
 	`
 	args := []any{
-		tokenHash[:],
+		pq.Array(m.hasher.candidates(tokenPlaintext)),
 		tokenScope,
 		time.Now(),
 	}
 
-	var user User
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
-
-	err := m.DB.QueryRowContext(ctx, query, args...).Scan(
-		&user.ID,
-		&user.CreatedAt,
-		&user.Name,
-		&user.Email,
-		&user.Password.hash,
-		&user.Activated,
-		&user.Version,
+	var (
+		hash    []byte
+		version int
 	)
+	user, err := queryOne(ctx, m.conn(), query, args, func(user *User) []any {
+		return append(m.userDests(user), &user.OrganizationID, &hash, &version)
+	})
 	if err != nil {
-		switch {
-		case errors.Is(err, sql.ErrNoRows):
-			return nil, ErrRecordNotFound
-		default:
-			return nil, err
-		}
+		return nil, err
+	}
+
+	// The token still works if it can't be rehashed, and it'll be rehashed the next time instead.
+	if version != m.hasher.current() {
+		_ = rehashToken(ctx, m.conn(), m.hasher, hash, tokenPlaintext)
+	}
+
+	return user, nil
+}
+
+// GetForSigningKey returns the user that created the signing key, with the organization the key is
+// scoped to, along with the key's secret, which is decrypted if it's encrypted. Like with the
+// tokens, a key scoped to an organization that the user has since left isn't found.
+func (m UserModel) GetForSigningKey(ctx context.Context, keyID string) (*User, []byte, error) {
+	query := `
+		SELECT users.id,
+			users.created_at,
+			users.name,
+			users.email,
+			users.email_ciphertext,
+			users.password_hash,
+			users.activated,
+			users.version,
+			COALESCE(signing_keys.organization_id, 0),
+			signing_keys.secret,
+			signing_keys.secret_ciphertext
+		FROM users
+			INNER JOIN signing_keys ON users.id = signing_keys.user_id
+		WHERE signing_keys.id = $1
+			AND (
+				signing_keys.organization_id IS NULL
+				OR EXISTS (
+					SELECT 1
+					FROM organizations_users
+					WHERE organizations_users.organization_id = signing_keys.organization_id
+						AND organizations_users.user_id = users.id
+				)
+			)
+	`
+
+	var secret []byte
+	user, err := queryOne(ctx, m.conn(), query, []any{keyID}, func(user *User) []any {
+		dests := append(m.userDests(user), &user.OrganizationID)
+		return append(dests, m.keys.secretDests(&secret)...)
+	})
+	if err != nil {
+		return nil, nil, err
 	}
 
-	return &user, nil
+	return user, secret, nil
+}
+
+// GetForCertificate returns the user of the service account that the client certificate's identity
+// is mapped to, with the account's organization. Like with the tokens, an account scoped to an
+// organization that the user has since left isn't found.
+func (m UserModel) GetForCertificate(ctx context.Context, identity string) (*User, error) {
+	query := `
+		SELECT users.id,
+			users.created_at,
+			users.name,
+			users.email,
+			users.email_ciphertext,
+			users.password_hash,
+			users.activated,
+			users.version,
+			COALESCE(service_accounts.organization_id, 0)
+		FROM users
+			INNER JOIN service_accounts ON users.id = service_accounts.user_id
+		WHERE service_accounts.identity = $1
+			AND (
+				service_accounts.organization_id IS NULL
+				OR EXISTS (
+					SELECT 1
+					FROM organizations_users
+					WHERE organizations_users.organization_id = service_accounts.organization_id
+						AND organizations_users.user_id = users.id
+				)
+			)
+	`
+
+	return queryOne(ctx, m.conn(), query, []any{identity}, func(user *User) []any {
+		return append(m.userDests(user), &user.OrganizationID)
+	})
 }
 
-func (m UserModel) Update(user *User) error {
+func (m UserModel) Update(ctx context.Context, user *User) error {
 	query := `
 		UPDATE users
 		SET name = $1,
 			email = $2,
-			password_hash = $3,
-			activated = $4,
+			email_ciphertext = $3,
+			email_index = $4,
+			email_key_id = $5,
+			password_hash = $6,
+			activated = $7,
 			version = version + 1
-		WHERE id = $5
-			AND version = $6
+		WHERE id = $8
+			AND version = $9
 		RETURNING version
 	`
+
+	email, err := m.keys.sealEmail(user.Email)
+	if err != nil {
+		return err
+	}
 	args := []any{
 		user.Name,
-		user.Email,
+		email.plaintext,
+		email.ciphertext,
+		email.index,
+		email.keyID,
 		user.Password.hash,
 		user.Activated,
 		user.ID,
 		user.Version,
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := queryContext(ctx, m.timeout)
 	defer cancel()
 
-	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&user.Version)
+	err = m.retry.do(ctx, m.breaker, func() error {
+		return m.DB.QueryRowContext(ctx, query, args...).Scan(&user.Version)
+	})
 	if err != nil {
 		switch {
-		case err.Error() == `pq: duplicate key value violates unique constraint "users_email_key"`:
+		case isDuplicateEmail(err):
 			return ErrDuplicateEmail
 		case errors.Is(err, sql.ErrNoRows):
 			return ErrEditConflict
@@ -266,3 +425,99 @@ func (m UserModel) Update(user *User) error {
 
 	return nil
 }
+
+// EncryptEmails rewrites up to limit of the users' emails that aren't encrypted with the current
+// key, or that are encrypted if the keyring is decrypting them, and returns how many it rewrote.
+// The users' versions are left alone, since their emails don't change. It does nothing if the
+// emails aren't encrypted.
+func (m UserModel) EncryptEmails(ctx context.Context, limit int) (int, error) {
+	if m.keys == nil {
+		return 0, nil
+	}
+
+	query := `
+		SELECT id, email, email_ciphertext
+		FROM users
+		WHERE email IS NOT NULL
+			OR email_key_id IS DISTINCT FROM $1
+		ORDER BY id
+		LIMIT $2
+		FOR UPDATE SKIP LOCKED
+	`
+	args := []any{int64(m.keys.current), limit}
+	if m.keys.decrypt {
+		query = `
+			SELECT id, email, email_ciphertext
+			FROM users
+			WHERE email IS NULL
+			ORDER BY id
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		`
+		args = []any{limit}
+	}
+
+	update := `
+		UPDATE users
+		SET email = $2,
+			email_ciphertext = $3,
+			email_index = $4,
+			email_key_id = $5
+		WHERE id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	var rewritten int
+	err := m.retry.do(ctx, m.breaker, func() error {
+		rewritten = 0
+
+		return withTx(ctx, m.DB, func(tx *sql.Tx) error {
+			rows, err := tx.QueryContext(ctx, query, args...)
+			if err != nil {
+				return err
+			}
+			defer rows.Close()
+
+			users := []*User{}
+			for rows.Next() {
+				var user User
+				dests := append([]any{&user.ID}, m.keys.emailDests(&user.Email)...)
+				if err := rows.Scan(dests...); err != nil {
+					return err
+				}
+				users = append(users, &user)
+			}
+			if err := rows.Err(); err != nil {
+				return err
+			}
+			rows.Close()
+
+			for _, user := range users {
+				email, err := m.keys.sealEmail(user.Email)
+				if err != nil {
+					return err
+				}
+
+				_, err = tx.ExecContext(
+					ctx,
+					update,
+					user.ID,
+					email.plaintext,
+					email.ciphertext,
+					email.index,
+					email.keyID,
+				)
+				if err != nil {
+					return err
+				}
+				rewritten++
+			}
+
+			return nil
+		})
+	})
+
+	return rewritten, err
+}
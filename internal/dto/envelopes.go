@@ -0,0 +1,144 @@
+package dto
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// PaginationHeader is the header that a listing's pagination metadata is sent in, as JSON, when
+// the listing's envelope is dropped.
+const PaginationHeader = "X-Pagination"
+
+// metadataKey is the member of the listings' envelopes holding their pagination metadata.
+const metadataKey = "metadata"
+
+// EnvelopeShape customizes the envelopes of the successful JSON responses, i.e. the objects that
+// the members such as "movie", or "movies" and "metadata", are the top-level keys of. A deployment
+// can rename the keys, or drop the envelopes, for the client generators that can't cope with them.
+// The zero value leaves the envelopes as they are.
+type EnvelopeShape struct {
+	// Keys renames the members, e.g. {"movies": "data"}.
+	Keys map[string]string
+
+	// Bare drops the envelopes holding a single member, answering with the member's value, e.g.
+	// the array of movies rather than {"movies": [...]}. A listing's metadata is moved to the
+	// PaginationHeader to leave a single member.
+	Bare bool
+}
+
+// IsZero reports whether the shape leaves the envelopes as they are.
+func (s EnvelopeShape) IsZero() bool {
+	return len(s.Keys) == 0 && !s.Bare
+}
+
+// Reshape returns the body of a response with the envelope's members. The metadata is the member
+// to send in the PaginationHeader instead, or nil.
+func (s EnvelopeShape) Reshape(members map[string]any) (body, metadata any) {
+	if s.IsZero() {
+		return members, nil
+	}
+
+	keys := make([]string, 0, len(members))
+	for key := range members {
+		keys = append(keys, key)
+	}
+	if key, moved, ok := s.bareKey(keys); ok {
+		if moved {
+			metadata = members[metadataKey]
+		}
+		return members[key], metadata
+	}
+
+	renamed := make(map[string]any, len(members))
+	for key, member := range members {
+		renamed[s.key(key)] = member
+	}
+	return renamed, nil
+}
+
+// schema returns the schema of a response's body, with the envelope reshaped as Reshape()
+// reshapes it. An envelope that's only bare without its omitempty members, such as a listing's
+// facets, is either. It reports whether the metadata is moved to the PaginationHeader.
+func (s EnvelopeShape) schema(body any) (*Schema, bool) {
+	schema := SchemaOf(body)
+	if s.IsZero() || schema.Type != "object" || len(schema.Properties) == 0 {
+		return schema, false
+	}
+
+	var keys, always []string
+	optional := omitemptyMembers(reflect.TypeOf(body))
+	for key := range schema.Properties {
+		keys = append(keys, key)
+		if !optional[key] {
+			always = append(always, key)
+		}
+	}
+	if key, moved, ok := s.bareKey(keys); ok {
+		return schema.Properties[key], moved
+	}
+	if key, moved, ok := s.bareKey(always); ok {
+		return &Schema{OneOf: []*Schema{schema.Properties[key], s.renamed(schema)}}, moved
+	}
+
+	return s.renamed(schema), false
+}
+
+// omitemptyMembers returns the JSON names of the struct's omitempty fields.
+func omitemptyMembers(t reflect.Type) map[string]bool {
+	members := make(map[string]bool)
+	if t.Kind() != reflect.Struct {
+		return members
+	}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		_, options, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if strings.Contains(options, "omitempty") {
+			members[jsonName(f)] = true
+		}
+	}
+	return members
+}
+
+// renamed returns the schema of the envelope with its members renamed.
+func (s EnvelopeShape) renamed(schema *Schema) *Schema {
+	reshaped := *schema
+	reshaped.Properties = make(map[string]*Schema, len(schema.Properties))
+	for key, property := range schema.Properties {
+		reshaped.Properties[s.key(key)] = property
+	}
+	reshaped.Required = nil
+	for _, key := range schema.Required {
+		reshaped.Required = append(reshaped.Required, s.key(key))
+	}
+	return &reshaped
+}
+
+// key returns the name of the member under the shape.
+func (s EnvelopeShape) key(key string) string {
+	if renamed, ok := s.Keys[key]; ok {
+		return renamed
+	}
+	return key
+}
+
+// bareKey returns the member whose value is the whole body of a bare response with the envelope's
+// keys, and whether the metadata is moved out of the envelope to leave it. It's false if the
+// envelope is kept, because the shape isn't bare or the envelope holds several members besides
+// the metadata.
+func (s EnvelopeShape) bareKey(keys []string) (key string, moved, ok bool) {
+	if !s.Bare {
+		return "", false, false
+	}
+
+	sort.Strings(keys)
+	switch {
+	case len(keys) == 1:
+		return keys[0], false, true
+	case len(keys) == 2 && keys[0] == metadataKey:
+		return keys[1], true, true
+	case len(keys) == 2 && keys[1] == metadataKey:
+		return keys[0], true, true
+	}
+	return "", false, false
+}
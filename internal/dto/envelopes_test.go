@@ -0,0 +1,98 @@
+package dto
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEnvelopeShape_Reshape(t *testing.T) {
+	movies := []string{"Moana", "Heat"}
+	metadata := map[string]int{"current_page": 1}
+
+	tests := []struct {
+		name         string
+		shape        EnvelopeShape
+		members      map[string]any
+		wantBody     any
+		wantMetadata any
+	}{
+		{
+			name:     "Zero",
+			members:  map[string]any{"movies": movies, "metadata": metadata},
+			wantBody: map[string]any{"movies": movies, "metadata": metadata},
+		},
+		{
+			name:     "Keys",
+			shape:    EnvelopeShape{Keys: map[string]string{"movies": "data", "metadata": "meta"}},
+			members:  map[string]any{"movies": movies, "metadata": metadata},
+			wantBody: map[string]any{"data": movies, "meta": metadata},
+		},
+		{
+			name:     "Bare",
+			shape:    EnvelopeShape{Bare: true},
+			members:  map[string]any{"movie": "Moana"},
+			wantBody: "Moana",
+		},
+		{
+			name:         "BareListing",
+			shape:        EnvelopeShape{Bare: true},
+			members:      map[string]any{"movies": movies, "metadata": metadata},
+			wantBody:     movies,
+			wantMetadata: metadata,
+		},
+		{
+			name:  "BareSeveralMembers",
+			shape: EnvelopeShape{Bare: true, Keys: map[string]string{"movie": "data"}},
+			members: map[string]any{
+				"movie":          "Moana",
+				"changed_fields": []string{"title"},
+			},
+			wantBody: map[string]any{"data": "Moana", "changed_fields": []string{"title"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, metadata := tt.shape.Reshape(tt.members)
+			assert.Equal(t, tt.wantBody, body)
+			assert.Equal(t, tt.wantMetadata, metadata)
+		})
+	}
+}
+
+func TestOpenAPI_EnvelopeShape(t *testing.T) {
+	get := func(path string, response any) Endpoint {
+		return Endpoint{
+			Method:   http.MethodGet,
+			Path:     path,
+			Status:   http.StatusOK,
+			Response: response,
+		}
+	}
+	endpoints := []Endpoint{get("/movies", MoviesResponse{}), get("/movies/:id", MovieResponse{})}
+
+	components := func(document map[string]any) map[string]*Schema {
+		return document["components"].(map[string]any)["schemas"].(map[string]*Schema)
+	}
+
+	shape := EnvelopeShape{Keys: map[string]string{"movie": "data"}}
+	schemas := components(OpenAPI("1.0.0", "v1", endpoints, shape))
+	assert.Contains(t, schemas["MovieResponse"].Properties, "data")
+	assert.NotContains(t, schemas["MovieResponse"].Properties, "movie")
+	assert.Contains(t, schemas["ErrorResponse"].Properties, "error")
+
+	document := OpenAPI("1.0.0", "v1", endpoints, EnvelopeShape{Bare: true})
+	schemas = components(document)
+	if assert.Len(t, schemas["MoviesResponse"].OneOf, 2) {
+		assert.Equal(t, "array", schemas["MoviesResponse"].OneOf[0].Type)
+		assert.Contains(t, schemas["MoviesResponse"].OneOf[1].Properties, "facets")
+	}
+	assert.Equal(t, "object", schemas["MovieResponse"].Type)
+	assert.NotContains(t, schemas["MovieResponse"].Properties, "movie")
+
+	response := document["paths"].(map[string]map[string]any)["/movies"]["get"].(map[string]any)
+	ok := response["responses"].(map[string]any)["200"].(map[string]any)
+	assert.Contains(t, ok["headers"], PaginationHeader)
+}
@@ -0,0 +1,96 @@
+package dto
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/walkccc/greenlight/internal/data"
+)
+
+// exampleTime is the time of every example, so that the examples are the same on every run.
+var exampleTime = time.Date(2024, time.January, 1, 12, 0, 0, 0, time.UTC)
+
+// maxExampleDepth bounds how deep the examples of recursive types go.
+const maxExampleDepth = 6
+
+// knownExamples holds the examples of the types that don't encode as their kind suggests.
+var knownExamples = map[reflect.Type]func() any{
+	reflect.TypeOf(time.Time{}):       func() any { return exampleTime },
+	reflect.TypeOf(time.Duration(0)):  func() any { return time.Minute },
+	reflect.TypeOf(json.RawMessage{}): func() any { return json.RawMessage(`{}`) },
+	reflect.TypeOf(data.Runtime(0)):   func() any { return data.Runtime(107) },
+	reflect.TypeOf(data.Attributes(nil)): func() any {
+		return data.Attributes{"studio": "A24"}
+	},
+}
+
+// Example returns a deterministic example of v's type, e.g. to answer requests with fixture data:
+// the strings hold their property's name, the numbers are 1, the booleans are true, and the slices
+// and maps have a single element.
+func Example(v any) any {
+	t := reflect.TypeOf(v)
+	if t == nil {
+		return nil
+	}
+	return exampleOf(t, "", 0).Interface()
+}
+
+func exampleOf(t reflect.Type, name string, depth int) reflect.Value {
+	value := reflect.New(t).Elem()
+	if depth > maxExampleDepth {
+		return value
+	}
+
+	if known, ok := knownExamples[t]; ok {
+		value.Set(reflect.ValueOf(known()))
+		return value
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		value.Set(exampleOf(t.Elem(), name, depth+1).Addr())
+	case reflect.String:
+		value.SetString(exampleString(name))
+	case reflect.Bool:
+		value.SetBool(true)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		value.SetInt(1)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		value.SetUint(1)
+	case reflect.Float32, reflect.Float64:
+		value.SetFloat(1)
+	case reflect.Slice:
+		value.Set(reflect.Append(value, exampleOf(t.Elem(), name, depth+1)))
+	case reflect.Map:
+		value.Set(reflect.MakeMap(t))
+		key := exampleOf(t.Key(), "key", depth+1)
+		value.SetMapIndex(key, exampleOf(t.Elem(), name, depth+1))
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if !f.IsExported() || jsonName(f) == "-" {
+				continue
+			}
+			value.Field(i).Set(exampleOf(f.Type, jsonName(f), depth+1))
+		}
+	}
+	// Anything else, e.g. an interface, is left zero.
+
+	return value
+}
+
+// exampleString returns the example of a string property, which is the property's name, or a
+// well-formed value for the properties whose name says what they hold.
+func exampleString(name string) string {
+	switch {
+	case name == "":
+		return "string"
+	case strings.Contains(name, "email"):
+		return "alice@example.com"
+	case strings.HasSuffix(name, "url") || name == "href":
+		return "https://example.com"
+	}
+	return name
+}
@@ -0,0 +1,31 @@
+package dto
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExample(t *testing.T) {
+	js, err := json.Marshal(Example(MovieResponse{}))
+	require.NoError(t, err)
+
+	var body struct {
+		Movie map[string]any `json:"movie"`
+	}
+	require.NoError(t, json.Unmarshal(js, &body))
+	assert.Equal(t, 1.0, body.Movie["id"])
+	assert.Equal(t, "title", body.Movie["title"])
+	assert.Equal(t, []any{"genres"}, body.Movie["genres"])
+	assert.Equal(t, "2024-01-01T12:00:00Z", body.Movie["created_at"])
+
+	// Every documented response has an example.
+	for _, endpoint := range Endpoints {
+		if endpoint.Response != nil {
+			_, err := json.Marshal(Example(endpoint.Response))
+			assert.NoError(t, err, endpoint.Method+" "+endpoint.Path)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package dto
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+
+	"github.com/walkccc/greenlight/internal/validator"
+)
+
+// Nulls holds the JSON names of the fields of a PATCH request that were explicitly null. A pointer
+// field can't tell them apart from the absent fields, which are left as they are: a null field is
+// cleared if it's tagged `nullable:"true"`, and rejected otherwise. The OpenAPI schemas of the
+// nullable fields accept null, and those of the others don't.
+type Nulls map[string]bool
+
+// Check adds a not_nullable error to v for each of the null fields of the request that isn't
+// nullable.
+func (n Nulls) Check(v *validator.Validator, req any) {
+	if len(n) == 0 {
+		return
+	}
+
+	t := reflect.TypeOf(req)
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if name := jsonName(f); n[name] && !nullable(f) {
+			v.AddError(name, validator.CodeNotNullable, "must not be null")
+		}
+	}
+}
+
+// nullable reports whether a PATCH request's field can be cleared with null.
+func nullable(f reflect.StructField) bool {
+	return f.Tag.Get("nullable") == "true"
+}
+
+// unmarshalPatch decodes the JSON object of a PATCH request into dst, a pointer to the request's
+// fields without its UnmarshalJSON() method, and returns its null members. Unknown fields are
+// rejected, as readJSON() rejects them from the bodies that don't implement json.Unmarshaler.
+func unmarshalPatch(js []byte, dst any) (Nulls, error) {
+	decoder := json.NewDecoder(bytes.NewReader(js))
+	decoder.DisallowUnknownFields()
+	err := decoder.Decode(dst)
+	if err != nil {
+		return nil, err
+	}
+
+	var members map[string]json.RawMessage
+	err = json.Unmarshal(js, &members)
+	if err != nil {
+		return nil, err
+	}
+
+	var nulls Nulls
+	for name, member := range members {
+		if string(member) == "null" {
+			if nulls == nil {
+				nulls = make(Nulls)
+			}
+			nulls[name] = true
+		}
+	}
+	return nulls, nil
+}
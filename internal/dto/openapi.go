@@ -0,0 +1,567 @@
+package dto
+
+import (
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Endpoint describes an API endpoint for the OpenAPI document. The path uses the router's syntax
+// (e.g. /movies/:id) and is relative to the version's prefix.
+type Endpoint struct {
+	Method     string
+	Path       string
+	Summary    string
+	Permission string // the permission code required, if any
+	Auth       bool   // whether an authenticated, activated user is required
+	Query      any    // a struct with `query` tags, if the endpoint reads the query string
+	Request    any    // the request body, if any
+	Status     int    // the status code of a successful response
+	Response   any    // the body of a successful response, or nil if it isn't JSON (e.g. a page)
+}
+
+// Endpoints holds every versioned API endpoint.
+var Endpoints = []Endpoint{
+	{
+		Method:   http.MethodGet,
+		Path:     "/healthcheck",
+		Summary:  "Report the application's status and version",
+		Status:   http.StatusOK,
+		Response: HealthcheckResponse{},
+	},
+	{
+		Method:   http.MethodGet,
+		Path:     "/readyz",
+		Summary:  "Report whether the server is ready to handle traffic",
+		Status:   http.StatusOK,
+		Response: ReadinessResponse{},
+	},
+	{
+		Method:   http.MethodGet,
+		Path:     "/openapi.json",
+		Summary:  "Get this OpenAPI document",
+		Status:   http.StatusOK,
+		Response: map[string]any{},
+	},
+	{
+		Method:     http.MethodGet,
+		Path:       "/movies",
+		Summary:    "List the organization's movies, e.g. with attr.studio=A24 for an attribute",
+		Permission: "movies:read",
+		Query:      ListMoviesQuery{},
+		Status:     http.StatusOK,
+		Response:   MoviesResponse{},
+	},
+	{
+		Method:     http.MethodGet,
+		Path:       "/attributes",
+		Summary:    "List the custom movie attributes",
+		Permission: "movies:read",
+		Status:     http.StatusOK,
+		Response:   AttributesResponse{},
+	},
+	{
+		Method:     http.MethodPost,
+		Path:       "/movies",
+		Summary:    "Create a movie",
+		Permission: "movies:write",
+		Request:    CreateMovieRequest{},
+		Status:     http.StatusCreated,
+		Response:   MovieResponse{},
+	},
+	{
+		Method:     http.MethodPost,
+		Path:       "/imports/movies",
+		Summary:    "Import movies from a JSON array, or a CSV file with the text/csv content type",
+		Permission: "movies:write",
+		Request:    ImportMoviesRequest{},
+		Status:     http.StatusOK,
+		Response:   ImportMoviesResponse{},
+	},
+	{
+		Method:     http.MethodGet,
+		Path:       "/movies/:id",
+		Summary:    "Get a movie",
+		Permission: "movies:read",
+		Status:     http.StatusOK,
+		Response:   MovieResponse{},
+	},
+	{
+		Method:     http.MethodPatch,
+		Path:       "/movies/:id",
+		Summary:    "Update a movie",
+		Permission: "movies:write",
+		Request:    UpdateMovieRequest{},
+		Status:     http.StatusOK,
+		Response:   ChangedMovieResponse{},
+	},
+	{
+		Method:     http.MethodDelete,
+		Path:       "/movies/:id",
+		Summary:    "Delete a movie",
+		Permission: "movies:write",
+		Status:     http.StatusOK,
+		Response:   MessageResponse{},
+	},
+	{
+		Method:     http.MethodGet,
+		Path:       "/movies/:id/poster",
+		Summary:    "Redirect to a signed, time-limited URL of a movie's poster",
+		Permission: "movies:read",
+		Query:      MoviePosterQuery{},
+		Status:     http.StatusFound,
+	},
+	{
+		Method:     http.MethodPut,
+		Path:       "/movies/:id/poster",
+		Summary:    "Upload a JPEG or PNG poster, resized into its variants in the background",
+		Permission: "movies:write",
+		Status:     http.StatusAccepted,
+		Response:   PosterResponse{},
+	},
+	{
+		Method:     http.MethodPost,
+		Path:       "/movies/:id/revert",
+		Summary:    "Restore a previous version of a movie as a new version",
+		Permission: "movies:write",
+		Query:      RevertMovieQuery{},
+		Status:     http.StatusOK,
+		Response:   ChangedMovieResponse{},
+	},
+	{
+		Method:     http.MethodPost,
+		Path:       "/movies/:id/merge",
+		Summary:    "Merge a duplicate movie into a movie",
+		Permission: "admin:write",
+		Request:    MergeMovieRequest{},
+		Status:     http.StatusOK,
+		Response:   MovieResponse{},
+	},
+	{
+		Method:   http.MethodPost,
+		Path:     "/users",
+		Summary:  "Register a user",
+		Request:  CreateUserRequest{},
+		Status:   http.StatusAccepted,
+		Response: UserResponse{},
+	},
+	{
+		Method:  http.MethodGet,
+		Path:    "/users/activate",
+		Summary: "Activate a user from the link in their welcome email",
+		Query:   ActivateUserQuery{},
+		Status:  http.StatusOK,
+	},
+	{
+		Method:   http.MethodPut,
+		Path:     "/users/activated",
+		Summary:  "Activate a user",
+		Request:  ActivateUserRequest{},
+		Status:   http.StatusOK,
+		Response: UserResponse{},
+	},
+	{
+		Method:     http.MethodGet,
+		Path:       "/users/me/searches",
+		Summary:    "List the user's saved searches",
+		Permission: "movies:read",
+		Status:     http.StatusOK,
+		Response:   SavedSearchesResponse{},
+	},
+	{
+		Method:     http.MethodPost,
+		Path:       "/users/me/searches",
+		Summary:    "Save a search, optionally subscribing to new movies that match it",
+		Permission: "movies:read",
+		Request:    CreateSavedSearchRequest{},
+		Status:     http.StatusCreated,
+		Response:   SavedSearchResponse{},
+	},
+	{
+		Method:     http.MethodGet,
+		Path:       "/users/me/searches/:id",
+		Summary:    "Get a saved search",
+		Permission: "movies:read",
+		Status:     http.StatusOK,
+		Response:   SavedSearchResponse{},
+	},
+	{
+		Method:     http.MethodDelete,
+		Path:       "/users/me/searches/:id",
+		Summary:    "Delete a saved search",
+		Permission: "movies:read",
+		Status:     http.StatusOK,
+		Response:   MessageResponse{},
+	},
+	{
+		Method:     http.MethodGet,
+		Path:       "/users/me/searches/:id/movies",
+		Summary:    "Run a saved search",
+		Permission: "movies:read",
+		Query:      RunSavedSearchQuery{},
+		Status:     http.StatusOK,
+		Response:   MoviesResponse{},
+	},
+	{
+		Method:   http.MethodGet,
+		Path:     "/users/me/notifications",
+		Summary:  "List the user's notifications, newest first",
+		Auth:     true,
+		Query:    ListNotificationsQuery{},
+		Status:   http.StatusOK,
+		Response: NotificationsResponse{},
+	},
+	{
+		Method:   http.MethodPatch,
+		Path:     "/users/me/notifications/:id",
+		Summary:  "Mark a notification as read or unread",
+		Auth:     true,
+		Request:  UpdateNotificationRequest{},
+		Status:   http.StatusOK,
+		Response: NotificationResponse{},
+	},
+	{
+		Method:   http.MethodGet,
+		Path:     "/users/me/notification-preferences",
+		Summary:  "Get the user's notification channels and watched genres",
+		Auth:     true,
+		Status:   http.StatusOK,
+		Response: NotificationPreferencesResponse{},
+	},
+	{
+		Method:   http.MethodPatch,
+		Path:     "/users/me/notification-preferences",
+		Summary:  "Update the user's notification channels and watched genres",
+		Auth:     true,
+		Request:  UpdateNotificationPreferencesRequest{},
+		Status:   http.StatusOK,
+		Response: NotificationPreferencesResponse{},
+	},
+	{
+		Method:   http.MethodGet,
+		Path:     "/users/me/signing-keys",
+		Summary:  "List the keys the user's server integrations sign their requests with",
+		Auth:     true,
+		Status:   http.StatusOK,
+		Response: SigningKeysResponse{},
+	},
+	{
+		Method:   http.MethodPost,
+		Path:     "/users/me/signing-keys",
+		Summary:  "Create a signing key, whose secret is only returned in this response",
+		Auth:     true,
+		Status:   http.StatusCreated,
+		Response: SigningKeyResponse{},
+	},
+	{
+		Method:   http.MethodDelete,
+		Path:     "/users/me/signing-keys/:id",
+		Summary:  "Revoke a signing key",
+		Auth:     true,
+		Status:   http.StatusOK,
+		Response: MessageResponse{},
+	},
+	{
+		Method:   http.MethodPost,
+		Path:     "/tokens/authentication",
+		Summary:  "Create an authentication token",
+		Request:  CreateAuthenticationTokenRequest{},
+		Status:   http.StatusCreated,
+		Response: AuthenticationTokenResponse{},
+	},
+	{
+		Method:   http.MethodPost,
+		Path:     "/batch",
+		Summary:  "Run several requests, one after another, in a single round trip",
+		Request:  BatchRequest{},
+		Status:   http.StatusOK,
+		Response: BatchResponse{},
+	},
+	{
+		Method:   http.MethodPost,
+		Path:     "/webhooks/catalog/:source",
+		Summary:  "Receive a signed catalog update from an upstream provider, and queue it",
+		Request:  CatalogUpdateRequest{},
+		Status:   http.StatusAccepted,
+		Response: CatalogUpdateResponse{},
+	},
+	{
+		Method:     http.MethodPost,
+		Path:       "/admin/drain",
+		Summary:    "Drain and shut down the server",
+		Permission: "admin:write",
+		Status:     http.StatusAccepted,
+		Response:   DrainResponse{},
+	},
+	{
+		Method:     http.MethodPost,
+		Path:       "/admin/webhooks/test",
+		Summary:    "Send a signed sample event to the outbox's webhook",
+		Permission: "admin:write",
+		Status:     http.StatusOK,
+		Response:   WebhookTestResponse{},
+	},
+	{
+		Method:   http.MethodGet,
+		Path:     "/organization/usage",
+		Summary:  "Get the organization's usage and limits",
+		Auth:     true,
+		Status:   http.StatusOK,
+		Response: UsageResponse{},
+	},
+	{
+		Method:     http.MethodPost,
+		Path:       "/admin/organizations",
+		Summary:    "Create an organization",
+		Permission: "admin:write",
+		Request:    CreateOrganizationRequest{},
+		Status:     http.StatusCreated,
+		Response:   OrganizationResponse{},
+	},
+	{
+		Method:     http.MethodPut,
+		Path:       "/admin/organizations/:id/limits",
+		Summary:    "Replace an organization's limits",
+		Permission: "admin:write",
+		Request:    SetOrganizationLimitsRequest{},
+		Status:     http.StatusOK,
+		Response:   LimitsResponse{},
+	},
+	{
+		Method:     http.MethodGet,
+		Path:       "/admin/organizations/:id/members",
+		Summary:    "List an organization's members",
+		Permission: "admin:read",
+		Status:     http.StatusOK,
+		Response:   MembersResponse{},
+	},
+	{
+		Method:     http.MethodPut,
+		Path:       "/admin/organizations/:id/members/:user_id",
+		Summary:    "Add a user to an organization, or change their role",
+		Permission: "admin:write",
+		Request:    SetOrganizationMemberRequest{},
+		Status:     http.StatusOK,
+		Response:   MessageResponse{},
+	},
+	{
+		Method:     http.MethodDelete,
+		Path:       "/admin/organizations/:id/members/:user_id",
+		Summary:    "Remove a user from an organization",
+		Permission: "admin:write",
+		Status:     http.StatusOK,
+		Response:   MessageResponse{},
+	},
+	{
+		Method:     http.MethodPut,
+		Path:       "/admin/service-accounts",
+		Summary:    "Map a client certificate identity to the user its mTLS requests are made as",
+		Permission: "admin:write",
+		Request:    SetServiceAccountRequest{},
+		Status:     http.StatusOK,
+		Response:   ServiceAccountResponse{},
+	},
+	{
+		Method:     http.MethodDelete,
+		Path:       "/admin/service-accounts",
+		Summary:    "Remove the mapping of a client certificate identity",
+		Permission: "admin:write",
+		Query:      ServiceAccountQuery{},
+		Status:     http.StatusOK,
+		Response:   MessageResponse{},
+	},
+	{
+		Method:     http.MethodPost,
+		Path:       "/admin/attributes",
+		Summary:    "Register a custom movie attribute",
+		Permission: "admin:write",
+		Request:    CreateAttributeRequest{},
+		Status:     http.StatusCreated,
+		Response:   AttributeResponse{},
+	},
+	{
+		Method:     http.MethodDelete,
+		Path:       "/admin/attributes/:name",
+		Summary:    "Unregister a custom movie attribute, removing it from the movies",
+		Permission: "admin:write",
+		Status:     http.StatusOK,
+		Response:   MessageResponse{},
+	},
+}
+
+// OpenAPI returns the OpenAPI 3.1 document describing the endpoints, served under the given API
+// version's prefix (e.g. "v1"), with the successful responses' envelopes in the given shape. The
+// request and response bodies are published as components, named after their types.
+func OpenAPI(
+	appVersion, apiVersion string,
+	endpoints []Endpoint,
+	shape EnvelopeShape,
+) map[string]any {
+	schemas := make(map[string]*Schema)
+
+	// component adds the schema of the body to the components, returning a reference to it.
+	component := func(body any, schema *Schema) map[string]any {
+		name := reflect.TypeOf(body).Name()
+		if name == "" {
+			return map[string]any{"type": "object"}
+		}
+		schemas[name] = schema
+		return map[string]any{"$ref": "#/components/schemas/" + name}
+	}
+
+	// ref adds the body's schema to the components, returning a reference to it.
+	ref := func(body any) map[string]any {
+		return component(body, SchemaOf(body))
+	}
+
+	content := func(description string, schema map[string]any) map[string]any {
+		return map[string]any{
+			"description": description,
+			"content":     map[string]any{"application/json": map[string]any{"schema": schema}},
+		}
+	}
+
+	errorResponse := content("error", ref(ErrorResponse{}))
+
+	paths := make(map[string]map[string]any)
+	for _, endpoint := range endpoints {
+		path, parameters := pathParameters(endpoint.Path)
+
+		responses := map[string]any{"default": errorResponse}
+		if endpoint.Response != nil {
+			schema, moved := shape.schema(endpoint.Response)
+			response := content(
+				http.StatusText(endpoint.Status),
+				component(endpoint.Response, schema),
+			)
+			if moved {
+				response["headers"] = map[string]any{
+					PaginationHeader: map[string]any{
+						"description": "the pagination metadata, as JSON",
+						"schema":      map[string]string{"type": "string"},
+					},
+				}
+			}
+			responses[strconv.Itoa(endpoint.Status)] = response
+		} else {
+			responses[strconv.Itoa(endpoint.Status)] = map[string]any{
+				"description": http.StatusText(endpoint.Status),
+			}
+		}
+
+		operation := map[string]any{
+			"summary":   endpoint.Summary,
+			"responses": responses,
+		}
+
+		if endpoint.Query != nil {
+			parameters = append(parameters, queryParameters(endpoint.Query)...)
+		}
+		if len(parameters) > 0 {
+			operation["parameters"] = parameters
+		}
+
+		if endpoint.Request != nil {
+			operation["requestBody"] = map[string]any{
+				"required": true,
+				"content": map[string]any{
+					"application/json": map[string]any{"schema": ref(endpoint.Request)},
+				},
+			}
+		}
+		if endpoint.Request != nil || endpoint.Query != nil {
+			responses["422"] = content("failed validation", ref(ValidationErrorResponse{}))
+		}
+
+		if endpoint.Permission != "" || endpoint.Auth {
+			operation["security"] = []map[string][]string{{"bearerAuth": {}}}
+			responses["401"] = errorResponse
+			responses["403"] = errorResponse
+		}
+		if endpoint.Permission != "" {
+			operation["description"] = "Requires the " + endpoint.Permission + " permission."
+		}
+
+		if paths[path] == nil {
+			paths[path] = make(map[string]any)
+		}
+		paths[path][strings.ToLower(endpoint.Method)] = operation
+	}
+
+	return map[string]any{
+		"openapi": "3.1.0",
+		"info": map[string]any{
+			"title":   "Greenlight API",
+			"version": appVersion,
+		},
+		"servers": []map[string]string{{"url": "/" + apiVersion}},
+		"paths":   paths,
+		"components": map[string]any{
+			"schemas": schemas,
+			"securitySchemes": map[string]any{
+				"bearerAuth": map[string]string{"type": "http", "scheme": "bearer"},
+			},
+		},
+	}
+}
+
+// pathParameters converts a router path (e.g. /movies/:id) to an OpenAPI path (/movies/{id}),
+// returning the parameters in it.
+func pathParameters(path string) (string, []map[string]any) {
+	var parameters []map[string]any
+	minimum := 1.0
+
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if name, ok := strings.CutPrefix(segment, ":"); ok {
+			segments[i] = "{" + name + "}"
+			parameters = append(parameters, map[string]any{
+				"name":     name,
+				"in":       "path",
+				"required": true,
+				"schema":   &Schema{Type: "integer", Minimum: &minimum},
+			})
+		}
+	}
+
+	return strings.Join(segments, "/"), parameters
+}
+
+// queryParameters returns the parameters of a struct with `query` tags.
+func queryParameters(query any) []map[string]any {
+	t := reflect.TypeOf(query)
+	schema := structSchema(t)
+
+	var parameters []map[string]any
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, ok := f.Tag.Lookup("query")
+		if !ok {
+			continue
+		}
+
+		parameter := map[string]any{
+			"name":   name,
+			"in":     "query",
+			"schema": schema.Properties[jsonName(f)],
+		}
+		if schema.Properties[jsonName(f)].Type == "array" {
+			// Slices are read as comma separated values.
+			parameter["style"] = "form"
+			parameter["explode"] = false
+		}
+		parameters = append(parameters, parameter)
+	}
+
+	return parameters
+}
+
+// jsonName returns the name of the field's property, or "-" if the field isn't encoded.
+func jsonName(f reflect.StructField) string {
+	name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+	if name == "" {
+		return f.Name
+	}
+	return name
+}
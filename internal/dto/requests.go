@@ -0,0 +1,412 @@
+// Package dto defines the request and response bodies of the API's endpoints, separately from the
+// data models they're mapped to and from. The `validate` tags on the request types are the single
+// source of their rules: handlers check them with validator.Struct(), and SchemaOf() turns them
+// into the JSON Schemas published in the OpenAPI document. Rules that need more than the request
+// itself (e.g. a movie's year not being in the future) stay in the data package's Validate
+// functions.
+package dto
+
+import (
+	"encoding/json"
+	"reflect"
+
+	"github.com/walkccc/greenlight/internal/data"
+)
+
+// ListMoviesQuery holds the query parameters of "GET /v1/movies".
+type ListMoviesQuery struct {
+	Title    string   `query:"title"`
+	Genres   []string `query:"genres"`
+	YearFrom int32    `query:"year_from" validate:"omitempty,gt=1894"`
+	YearTo   int32    `query:"year_to" validate:"omitempty,gt=1894"`
+	Page     int      `query:"page" validate:"gt=0"`
+	PageSize int      `query:"page_size" validate:"gt=0"`
+	Sort     string   `query:"sort" validate:"oneof=id title year runtime -id -title -year -runtime relevance -relevance"`
+	Count    string   `query:"count" validate:"oneof=exact estimated parallel none"`
+	Facets   bool     `query:"facets"`
+}
+
+// Filters returns the data.Filters for the query.
+func (q ListMoviesQuery) Filters() data.Filters {
+	return data.Filters{
+		Page:           q.Page,
+		PageSize:       q.PageSize,
+		Sort:           q.Sort,
+		SortSafeValues: data.MovieSortSafeValues,
+		CountStrategy:  q.Count,
+	}
+}
+
+// Years returns the data.YearRange for the query.
+func (q ListMoviesQuery) Years() data.YearRange {
+	return data.YearRange{From: q.YearFrom, To: q.YearTo}
+}
+
+// MergeMovieRequest is the body of "POST /v1/movies/:id/merge", which merges the duplicate into
+// the movie.
+type MergeMovieRequest struct {
+	DuplicateID int64 `json:"duplicate_id" validate:"required,gt=0"`
+}
+
+// MoviePosterQuery holds the query parameters of "GET /v1/movies/:id/poster".
+type MoviePosterQuery struct {
+	Variant string `query:"variant" validate:"oneof=original thumb medium"`
+}
+
+// RevertMovieQuery holds the query parameters of "POST /v1/movies/:id/revert".
+type RevertMovieQuery struct {
+	To int32 `query:"to" validate:"required,gt=0"` // the version to restore
+}
+
+// RunSavedSearchQuery holds the query parameters of "GET /v1/users/me/searches/:id/movies". The
+// filters and the sort come from the saved search.
+type RunSavedSearchQuery struct {
+	Page     int    `query:"page" validate:"gt=0"`
+	PageSize int    `query:"page_size" validate:"gt=0"`
+	Count    string `query:"count" validate:"oneof=exact estimated parallel none"`
+}
+
+// Filters returns the data.Filters for the query, sorted like the saved search.
+func (q RunSavedSearchQuery) Filters(search *data.SavedSearch) data.Filters {
+	return data.Filters{
+		Page:           q.Page,
+		PageSize:       q.PageSize,
+		Sort:           search.Sort,
+		SortSafeValues: data.MovieSortSafeValues,
+		CountStrategy:  q.Count,
+	}
+}
+
+// CreateMovieRequest is the body of "POST /v1/movies". The attributes are checked against the
+// registered ones by data.ValidateMovieAttributes().
+type CreateMovieRequest struct {
+	Title      string          `json:"title" validate:"required,max=500"`
+	Year       int32           `json:"year" validate:"required,gt=1894"`
+	Runtime    data.Runtime    `json:"runtime" validate:"required,gt=0"`
+	Genres     []string        `json:"genres" validate:"required,min=1,max=5,unique"`
+	Attributes data.Attributes `json:"attributes"`
+}
+
+// Movie returns a new movie, belonging to the organization, from the request.
+func (req CreateMovieRequest) Movie(organizationID int64) *data.Movie {
+	return &data.Movie{
+		OrganizationID: organizationID,
+		Title:          req.Title,
+		Year:           req.Year,
+		Runtime:        req.Runtime,
+		Genres:         req.Genres,
+		Attributes:     req.Attributes,
+	}
+}
+
+// ImportMoviesRequest is the body of "POST /v1/imports/movies", when it's JSON rather than CSV.
+type ImportMoviesRequest []CreateMovieRequest
+
+// UpdateMovieRequest is the body of "PATCH /v1/movies/:id". Only the fields that are present are
+// updated. If the version the client's edit is based on is given, the update is rejected with an
+// edit conflict when the movie has changed since. Every movie has a title, year, runtime and
+// genres, so they can't be cleared with null, while a null version is the same as an absent one.
+// The attributes are merged into the movie's, where a null attribute is removed, and null
+// attributes remove them all.
+type UpdateMovieRequest struct {
+	Title      *string         `json:"title" validate:"omitempty,max=500"`
+	Year       *int32          `json:"year" validate:"omitempty,gt=1894"`
+	Runtime    *data.Runtime   `json:"runtime" validate:"omitempty,gt=0"`
+	Genres     []string        `json:"genres" validate:"omitempty,min=1,max=5,unique"`
+	Attributes data.Attributes `json:"attributes" nullable:"true"`
+	Version    *int32          `json:"version" validate:"omitempty,gt=0" nullable:"true"`
+
+	Nulls Nulls `json:"-"`
+}
+
+// UnmarshalJSON decodes the request, recording its null fields.
+func (req *UpdateMovieRequest) UnmarshalJSON(js []byte) error {
+	type fields UpdateMovieRequest
+	nulls, err := unmarshalPatch(js, (*fields)(req))
+	req.Nulls = nulls
+	return err
+}
+
+// Apply copies the fields that are present in the request to the movie.
+func (req UpdateMovieRequest) Apply(movie *data.Movie) {
+	if req.Title != nil {
+		movie.Title = *req.Title
+	}
+	if req.Year != nil {
+		movie.Year = *req.Year
+	}
+	if req.Runtime != nil {
+		movie.Runtime = *req.Runtime
+	}
+	if req.Genres != nil {
+		movie.Genres = req.Genres
+	}
+	if req.Nulls["attributes"] {
+		movie.Attributes = data.Attributes{}
+	} else if req.Attributes != nil {
+		movie.Attributes = movie.Attributes.Merge(req.Attributes)
+	}
+}
+
+// FieldConflict is a field whose value in an update request differs from the current one.
+type FieldConflict struct {
+	Requested any `json:"requested"`
+	Current   any `json:"current"`
+}
+
+// Conflicts returns the fields of the request whose values differ from the current movie's, keyed
+// by their JSON names. The fields that aren't present, or already hold the requested values, don't
+// conflict.
+func (req UpdateMovieRequest) Conflicts(current *data.Movie) map[string]FieldConflict {
+	conflicts := map[string]FieldConflict{}
+
+	if req.Title != nil && *req.Title != current.Title {
+		conflicts["title"] = FieldConflict{Requested: *req.Title, Current: current.Title}
+	}
+	if req.Year != nil && *req.Year != current.Year {
+		conflicts["year"] = FieldConflict{Requested: *req.Year, Current: current.Year}
+	}
+	if req.Runtime != nil && *req.Runtime != current.Runtime {
+		conflicts["runtime"] = FieldConflict{Requested: *req.Runtime, Current: current.Runtime}
+	}
+	if req.Genres != nil && !equalStrings(req.Genres, current.Genres) {
+		conflicts["genres"] = FieldConflict{Requested: req.Genres, Current: current.Genres}
+	}
+	for name, value := range req.Attributes {
+		if !reflect.DeepEqual(value, current.Attributes[name]) {
+			conflicts["attributes"] = FieldConflict{
+				Requested: req.Attributes,
+				Current:   current.Attributes,
+			}
+			break
+		}
+	}
+
+	return conflicts
+}
+
+// equalStrings reports whether the slices hold the same strings in the same order.
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// CreateUserRequest is the body of "POST /v1/users".
+type CreateUserRequest struct {
+	Name     string `json:"name" validate:"required,max=500"`
+	Email    string `json:"email" validate:"required,email"`
+	Password string `json:"password" validate:"required,min=8,max=72"`
+
+	// CaptchaToken is the token of the solved CAPTCHA, if the server requires one.
+	CaptchaToken string `json:"captcha_token"`
+}
+
+// ActivateUserRequest is the body of "PUT /v1/users/activated".
+type ActivateUserRequest struct {
+	Token string `json:"token" validate:"required"`
+}
+
+// ActivateUserQuery holds the query parameters of "GET /v1/users/activate".
+type ActivateUserQuery struct {
+	Token string `query:"token"`
+}
+
+// CreateAuthenticationTokenRequest is the body of "POST /v1/tokens/authentication".
+type CreateAuthenticationTokenRequest struct {
+	Email          string `json:"email" validate:"required,email"`
+	Password       string `json:"password" validate:"required,min=8,max=72"`
+	OrganizationID int64  `json:"organization_id" validate:"omitempty,gt=0"`
+}
+
+// CreateOrganizationRequest is the body of "POST /v1/admin/organizations".
+type CreateOrganizationRequest struct {
+	Name string `json:"name" validate:"required,max=500"`
+}
+
+// SetOrganizationMemberRequest is the body of "PUT /v1/admin/organizations/:id/members/:user_id".
+// The role defaults to member.
+type SetOrganizationMemberRequest struct {
+	Role string `json:"role" validate:"omitempty,oneof=owner member"`
+}
+
+// SetServiceAccountRequest is the body of "PUT /v1/admin/service-accounts". The organization is
+// optional.
+type SetServiceAccountRequest struct {
+	Identity       string `json:"identity" validate:"required,max=500"`
+	UserID         int64  `json:"user_id" validate:"required,gt=0"`
+	OrganizationID int64  `json:"organization_id" validate:"omitempty,gt=0"`
+}
+
+// ServiceAccountQuery holds the query parameters of "DELETE /v1/admin/service-accounts".
+type ServiceAccountQuery struct {
+	Identity string `query:"identity" validate:"required"`
+}
+
+// CreateAttributeRequest is the body of "POST /v1/admin/attributes". The rules use the syntax of
+// the `validate` tags, e.g. "required,max=100".
+type CreateAttributeRequest struct {
+	Name       string `json:"name" validate:"required,max=63"`
+	Type       string `json:"type" validate:"required,oneof=string number boolean"`
+	Rules      string `json:"rules" validate:"max=500"`
+	Searchable bool   `json:"searchable"`
+}
+
+// Attribute returns the attribute's definition from the request.
+func (req CreateAttributeRequest) Attribute() *data.Attribute {
+	return &data.Attribute{
+		Name:       req.Name,
+		Type:       req.Type,
+		Rules:      req.Rules,
+		Searchable: req.Searchable,
+	}
+}
+
+// SetOrganizationLimitsRequest is the body of "PUT /v1/admin/organizations/:id/limits". An omitted
+// (or zero) limit removes it.
+type SetOrganizationLimitsRequest struct {
+	RequestsPerSecond float64 `json:"requests_per_second" validate:"min=0"`
+	Burst             int     `json:"burst" validate:"min=0"`
+	DailyRequestQuota int64   `json:"daily_request_quota" validate:"min=0"`
+	MaxMovies         int64   `json:"max_movies" validate:"min=0"`
+}
+
+// Limits returns the organization's limits from the request.
+func (req SetOrganizationLimitsRequest) Limits(organizationID int64) *data.OrganizationLimits {
+	return &data.OrganizationLimits{
+		OrganizationID:    organizationID,
+		RequestsPerSecond: req.RequestsPerSecond,
+		Burst:             req.Burst,
+		DailyRequestQuota: req.DailyRequestQuota,
+		MaxMovies:         req.MaxMovies,
+	}
+}
+
+// CreateSavedSearchRequest is the body of "POST /v1/users/me/searches". The sort defaults to id.
+type CreateSavedSearchRequest struct {
+	Name   string   `json:"name" validate:"required,max=100"`
+	Title  string   `json:"title" validate:"max=500"`
+	Genres []string `json:"genres" validate:"max=5,unique"`
+	Sort   string   `json:"sort"`
+	Notify bool     `json:"notify"`
+}
+
+// SavedSearch returns the user's new saved search, in the organization, from the request.
+func (req CreateSavedSearchRequest) SavedSearch(userID, organizationID int64) *data.SavedSearch {
+	search := &data.SavedSearch{
+		UserID:         userID,
+		OrganizationID: organizationID,
+		Name:           req.Name,
+		Title:          req.Title,
+		Genres:         req.Genres,
+		Sort:           req.Sort,
+		Notify:         req.Notify,
+	}
+	if search.Genres == nil {
+		search.Genres = []string{}
+	}
+	if search.Sort == "" {
+		search.Sort = "id"
+	}
+	return search
+}
+
+// ListNotificationsQuery holds the query parameters of "GET /v1/users/me/notifications".
+type ListNotificationsQuery struct {
+	Unread   bool `query:"unread"`
+	Page     int  `query:"page" validate:"gt=0"`
+	PageSize int  `query:"page_size" validate:"gt=0"`
+}
+
+// Filters returns the data.Filters for the query. Notifications are always listed newest first.
+func (q ListNotificationsQuery) Filters() data.Filters {
+	return data.Filters{
+		Page:           q.Page,
+		PageSize:       q.PageSize,
+		Sort:           "-id",
+		SortSafeValues: []string{"-id"},
+	}
+}
+
+// UpdateNotificationRequest is the body of "PATCH /v1/users/me/notifications/:id".
+type UpdateNotificationRequest struct {
+	Read *bool `json:"read" validate:"required"`
+}
+
+// UpdateNotificationPreferencesRequest is the body of
+// "PATCH /v1/users/me/notification-preferences". Only the fields that are present are updated. A
+// null phone number or list of watched genres removes it, like an empty one, while the channels
+// can't be null.
+type UpdateNotificationPreferencesRequest struct {
+	InApp         *bool    `json:"in_app"`
+	Email         *bool    `json:"email"`
+	WatchedGenres []string `json:"watched_genres" validate:"max=20,unique" nullable:"true"`
+	Phone         *string  `json:"phone" nullable:"true"` // an empty phone number removes it
+	SMSAlerts     *bool    `json:"sms_alerts"`
+
+	Nulls Nulls `json:"-"`
+}
+
+// UnmarshalJSON decodes the request, recording its null fields.
+func (req *UpdateNotificationPreferencesRequest) UnmarshalJSON(js []byte) error {
+	type fields UpdateNotificationPreferencesRequest
+	nulls, err := unmarshalPatch(js, (*fields)(req))
+	req.Nulls = nulls
+	return err
+}
+
+// Apply copies the fields that are present in the request to the preferences.
+func (req UpdateNotificationPreferencesRequest) Apply(preferences *data.NotificationPreferences) {
+	if req.InApp != nil {
+		preferences.InApp = *req.InApp
+	}
+	if req.Email != nil {
+		preferences.Email = *req.Email
+	}
+	if req.WatchedGenres != nil {
+		preferences.WatchedGenres = req.WatchedGenres
+	} else if req.Nulls["watched_genres"] {
+		preferences.WatchedGenres = []string{}
+	}
+	if req.Phone != nil {
+		preferences.Phone = *req.Phone
+	} else if req.Nulls["phone"] {
+		preferences.Phone = ""
+	}
+	if req.SMSAlerts != nil {
+		preferences.SMSAlerts = *req.SMSAlerts
+	}
+}
+
+// BatchRequest is the body of "POST /v1/batch".
+type BatchRequest struct {
+	Requests []BatchSubRequest `json:"requests" validate:"required,min=1,max=20"`
+}
+
+// BatchSubRequest is one of the requests of a batch. Its path includes the API version and the
+// query string, if any, e.g. /v1/movies?page=2.
+type BatchSubRequest struct {
+	Method string          `json:"method" validate:"required,oneof=GET POST PUT PATCH DELETE"`
+	Path   string          `json:"path" validate:"required,max=2048"`
+	Body   json.RawMessage `json:"body"`
+}
+
+// CatalogUpdateRequest is the body of "POST /v1/webhooks/catalog/:source", which an upstream
+// provider posts once entries of its catalog have changed.
+type CatalogUpdateRequest struct {
+	Events []CatalogEvent `json:"events" validate:"required,min=1,max=100"`
+}
+
+// CatalogEvent is a change to an entry of a provider's catalog. The ID is the provider's ID of
+// the event, if it has one, and ExternalID its ID of the entry, e.g. a TMDB movie ID.
+type CatalogEvent struct {
+	ID         string `json:"id" validate:"max=200"`
+	Kind       string `json:"kind" validate:"required,oneof=movie.created movie.updated movie.deleted"`
+	ExternalID string `json:"external_id" validate:"required,max=200"`
+}
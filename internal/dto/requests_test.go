@@ -0,0 +1,83 @@
+package dto
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/walkccc/greenlight/internal/data"
+	"github.com/walkccc/greenlight/internal/validator"
+)
+
+func TestUpdateMovieRequest_Conflicts(t *testing.T) {
+	title, year, runtime := "Moana", int32(2016), data.Runtime(107)
+	current := &data.Movie{
+		Title:   "Moana",
+		Year:    2017,
+		Runtime: 105,
+		Genres:  []string{"animation", "adventure"},
+		Version: 3,
+	}
+
+	req := UpdateMovieRequest{
+		Title:   &title,
+		Year:    &year,
+		Runtime: &runtime,
+		Genres:  []string{"animation", "adventure"},
+	}
+
+	// The title and genres already hold the requested values, so only the year and runtime
+	// conflict.
+	assert.Equal(t, map[string]FieldConflict{
+		"year":    {Requested: int32(2016), Current: int32(2017)},
+		"runtime": {Requested: data.Runtime(107), Current: data.Runtime(105)},
+	}, req.Conflicts(current))
+
+	assert.Empty(t, UpdateMovieRequest{}.Conflicts(current))
+}
+
+func TestUpdateMovieRequest_Nulls(t *testing.T) {
+	var req UpdateMovieRequest
+	body := `{"title": "Moana", "year": null, "genres": null, "version": null}`
+	err := json.Unmarshal([]byte(body), &req)
+	require.NoError(t, err)
+	assert.Equal(t, "Moana", *req.Title)
+	assert.Equal(t, Nulls{"year": true, "genres": true, "version": true}, req.Nulls)
+
+	// The year and genres can't be cleared, while a null version is the same as an absent one.
+	v := validator.New()
+	req.Nulls.Check(v, req)
+	assert.Equal(t, map[string]string{
+		"year":   "year.not_nullable",
+		"genres": "genres.not_nullable",
+	}, v.Codes)
+
+	err = json.Unmarshal([]byte(`{"title": "Moana", "rating": 5}`), &req)
+	assert.EqualError(t, err, `json: unknown field "rating"`)
+}
+
+func TestUpdateNotificationPreferencesRequest_Nulls(t *testing.T) {
+	var req UpdateNotificationPreferencesRequest
+	err := json.Unmarshal([]byte(`{"phone": null, "watched_genres": null}`), &req)
+	require.NoError(t, err)
+
+	v := validator.New()
+	req.Nulls.Check(v, req)
+	assert.True(t, v.Valid())
+
+	preferences := &data.NotificationPreferences{
+		Phone:         "+15555550100",
+		WatchedGenres: []string{"drama"},
+	}
+	req.Apply(preferences)
+	assert.Empty(t, preferences.Phone)
+	assert.Equal(t, []string{}, preferences.WatchedGenres)
+}
+
+func TestSchemaOf_Nullable(t *testing.T) {
+	schema := SchemaOf(UpdateNotificationPreferencesRequest{})
+	assert.Equal(t, []*Schema{{Type: "string"}, {Type: "null"}}, schema.Properties["phone"].OneOf)
+	assert.Equal(t, "boolean", schema.Properties["email"].Type)
+	assert.NotContains(t, schema.Properties, "Nulls")
+}
@@ -0,0 +1,198 @@
+package dto
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/walkccc/greenlight/internal/data"
+	"github.com/walkccc/greenlight/internal/mailer"
+	"github.com/walkccc/greenlight/internal/storage"
+)
+
+// MovieResponse is the body of the responses holding a single movie.
+type MovieResponse struct {
+	Movie *data.Movie `json:"movie"`
+}
+
+// ChangedMovieResponse is the body of the responses holding a movie that was changed, e.g. by
+// "PATCH /v1/movies/:id", along with the JSON names of the fields whose values changed.
+type ChangedMovieResponse struct {
+	Movie         *data.Movie `json:"movie"`
+	ChangedFields []string    `json:"changed_fields"`
+}
+
+// PosterResponse is the body of "PUT /v1/movies/:id/poster".
+type PosterResponse struct {
+	Poster *data.Poster `json:"poster"`
+}
+
+// MoviesResponse is the body of "GET /v1/movies".
+type MoviesResponse struct {
+	Movies   []*data.Movie     `json:"movies"`
+	Metadata data.Metadata     `json:"metadata"`
+	Facets   *data.MovieFacets `json:"facets,omitempty"` // with ?facets=true
+}
+
+// ImportMoviesResponse is the body of "POST /v1/imports/movies".
+type ImportMoviesResponse struct {
+	Import ImportResult `json:"import"`
+}
+
+// ImportResult is the outcome of an import: how many movies were imported and rejected, and why
+// the first of the rejected ones were.
+type ImportResult struct {
+	Imported int           `json:"imported"`
+	Rejected int           `json:"rejected"`
+	Errors   []ImportError `json:"errors"`
+}
+
+// ImportError is why a movie of an import was rejected. Row is the movie's position in the body,
+// from 1, not counting a CSV file's header.
+type ImportError struct {
+	Row        int               `json:"row"`
+	Error      map[string]string `json:"error"`
+	ErrorCodes map[string]string `json:"error_codes"`
+}
+
+// UserResponse is the body of the responses holding a single user.
+type UserResponse struct {
+	User *data.User `json:"user"`
+}
+
+// SavedSearchResponse is the body of the responses holding a single saved search.
+type SavedSearchResponse struct {
+	Search *data.SavedSearch `json:"search"`
+}
+
+// SavedSearchesResponse is the body of "GET /v1/users/me/searches".
+type SavedSearchesResponse struct {
+	Searches []*data.SavedSearch `json:"searches"`
+}
+
+// NotificationsResponse is the body of "GET /v1/users/me/notifications".
+type NotificationsResponse struct {
+	Notifications []*data.Notification `json:"notifications"`
+	Metadata      data.Metadata        `json:"metadata"`
+}
+
+// NotificationResponse is the body of "PATCH /v1/users/me/notifications/:id".
+type NotificationResponse struct {
+	Notification *data.Notification `json:"notification"`
+}
+
+// SigningKeysResponse is the body of "GET /v1/users/me/signing-keys".
+type SigningKeysResponse struct {
+	SigningKeys []*data.SigningKey `json:"signing_keys"`
+}
+
+// SigningKeyResponse is the body of "POST /v1/users/me/signing-keys".
+type SigningKeyResponse struct {
+	SigningKey *data.SigningKey `json:"signing_key"`
+}
+
+// NotificationPreferencesResponse is the body of the responses holding the user's notification
+// preferences.
+type NotificationPreferencesResponse struct {
+	Preferences *data.NotificationPreferences `json:"preferences"`
+}
+
+// AuthenticationTokenResponse is the body of "POST /v1/tokens/authentication".
+type AuthenticationTokenResponse struct {
+	AuthenticationToken *data.Token `json:"authentication_token"`
+}
+
+// OrganizationResponse is the body of "POST /v1/admin/organizations".
+type OrganizationResponse struct {
+	Organization *data.Organization `json:"organization"`
+}
+
+// MembersResponse is the body of "GET /v1/admin/organizations/:id/members".
+type MembersResponse struct {
+	Organization *data.Organization `json:"organization"`
+	Members      []*data.Member     `json:"members"`
+}
+
+// ServiceAccountResponse is the body of "PUT /v1/admin/service-accounts".
+type ServiceAccountResponse struct {
+	ServiceAccount *data.ServiceAccount `json:"service_account"`
+}
+
+// AttributeResponse is the body of "POST /v1/admin/attributes".
+type AttributeResponse struct {
+	Attribute *data.Attribute `json:"attribute"`
+}
+
+// AttributesResponse is the body of "GET /v1/attributes".
+type AttributesResponse struct {
+	Attributes []*data.Attribute `json:"attributes"`
+}
+
+// LimitsResponse is the body of "PUT /v1/admin/organizations/:id/limits".
+type LimitsResponse struct {
+	Limits *data.OrganizationLimits `json:"limits"`
+}
+
+// UsageResponse is the body of "GET /v1/organization/usage".
+type UsageResponse struct {
+	Usage *data.Usage `json:"usage"`
+}
+
+// MessageResponse is the body of the responses that only confirm an action.
+type MessageResponse struct {
+	Message string `json:"message"`
+}
+
+// HealthcheckResponse is the body of "GET /v1/healthcheck".
+type HealthcheckResponse struct {
+	Status     string            `json:"status"`
+	SystemInfo map[string]string `json:"system_info"`
+}
+
+// ReadinessResponse is the body of "GET /v1/readyz".
+type ReadinessResponse struct {
+	Status  string          `json:"status"`
+	Mailer  mailer.Health   `json:"mailer"`
+	Storage *storage.Health `json:"storage,omitempty"` // if a storage backend is configured
+}
+
+// CatalogUpdateResponse is the body of "POST /v1/webhooks/catalog/:source".
+type CatalogUpdateResponse struct {
+	Accepted int `json:"accepted"` // the number of events queued for reconciliation
+}
+
+// DrainResponse is the body of "POST /v1/admin/drain".
+type DrainResponse struct {
+	Message string `json:"message"`
+	Delay   string `json:"delay"`
+}
+
+// WebhookTestResponse is the body of "POST /v1/admin/webhooks/test".
+type WebhookTestResponse struct {
+	Kind   string `json:"kind"`   // the sample event's kind
+	Status int    `json:"status"` // the receiver's status code
+}
+
+// ErrorResponse is the body of the error responses, other than the failed validations.
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+// ValidationErrorResponse is the body of the 422 Unprocessable Entity responses. Both maps are
+// keyed by the field, e.g. {"title": "must be provided"} and {"title": "title.required"}.
+type ValidationErrorResponse struct {
+	Error      map[string]string `json:"error"`
+	ErrorCodes map[string]string `json:"error_codes"`
+}
+
+// BatchResponse is the body of "POST /v1/batch", with the responses in the order of the requests.
+type BatchResponse struct {
+	Responses []BatchSubResponse `json:"responses"`
+}
+
+// BatchSubResponse is the response to one of the requests of a batch. JSON bodies are embedded as
+// they are, and other bodies as strings.
+type BatchSubResponse struct {
+	Status  int             `json:"status"`
+	Headers http.Header     `json:"headers"`
+	Body    json.RawMessage `json:"body,omitempty"`
+}
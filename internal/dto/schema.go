@@ -0,0 +1,174 @@
+package dto
+
+import (
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/walkccc/greenlight/internal/data"
+	"github.com/walkccc/greenlight/internal/validator"
+)
+
+// Schema is the subset of JSON Schema that the API's bodies need. It's also a valid OpenAPI 3.1
+// schema object.
+type Schema struct {
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Pattern              string             `json:"pattern,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Enum                 []string           `json:"enum,omitempty"`
+	OneOf                []*Schema          `json:"oneOf,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	MinLength            *float64           `json:"minLength,omitempty"`
+	MaxLength            *float64           `json:"maxLength,omitempty"`
+	MinItems             *float64           `json:"minItems,omitempty"`
+	MaxItems             *float64           `json:"maxItems,omitempty"`
+	MinProperties        *float64           `json:"minProperties,omitempty"`
+	MaxProperties        *float64           `json:"maxProperties,omitempty"`
+	UniqueItems          bool               `json:"uniqueItems,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Maximum              *float64           `json:"maximum,omitempty"`
+	ExclusiveMinimum     *float64           `json:"exclusiveMinimum,omitempty"`
+	ExclusiveMaximum     *float64           `json:"exclusiveMaximum,omitempty"`
+}
+
+// knownSchemas holds the schemas of the types that don't encode as their kind suggests.
+var knownSchemas = map[reflect.Type]func() *Schema{
+	reflect.TypeOf(time.Time{}): func() *Schema {
+		return &Schema{Type: "string", Format: "date-time"}
+	},
+	reflect.TypeOf(time.Duration(0)): func() *Schema {
+		return &Schema{Type: "string", Description: "a duration, e.g. 90s or 1h30m"}
+	},
+	reflect.TypeOf(json.RawMessage{}): func() *Schema {
+		return &Schema{Description: "any JSON value"}
+	},
+	reflect.TypeOf(data.Attributes(nil)): func() *Schema {
+		return &Schema{
+			Type:        "object",
+			Description: "the values of the custom attributes, keyed by their names",
+			AdditionalProperties: &Schema{
+				OneOf: []*Schema{{Type: "string"}, {Type: "number"}, {Type: "boolean"}},
+			},
+		}
+	},
+	reflect.TypeOf(data.Runtime(0)): func() *Schema {
+		return &Schema{
+			Description: `the runtime in minutes, e.g. 107, "107 mins", "1h47m" or "PT1H47M"`,
+			OneOf:       []*Schema{{Type: "integer"}, {Type: "string"}},
+		}
+	},
+}
+
+// SchemaOf returns the JSON Schema of v's type, derived from the `json` and `validate` tags of
+// its fields.
+func SchemaOf(v any) *Schema {
+	return schemaOf(reflect.TypeOf(v))
+}
+
+func schemaOf(t reflect.Type) *Schema {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	if known, ok := knownSchemas[t]; ok {
+		return known()
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.Slice, reflect.Array:
+		return &Schema{Type: "array", Items: schemaOf(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: schemaOf(t.Elem())}
+	case reflect.Struct:
+		return structSchema(t)
+	default:
+		// E.g. an interface, which can hold any value.
+		return &Schema{}
+	}
+}
+
+func structSchema(t reflect.Type) *Schema {
+	schema := &Schema{Type: "object", Properties: make(map[string]*Schema)}
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+
+		name := jsonName(f)
+		if name == "-" {
+			continue
+		}
+
+		property := schemaOf(f.Type)
+		if applyRules(property, validator.ParseRules(f.Tag.Get("validate"))) {
+			schema.Required = append(schema.Required, name)
+		}
+		if nullable(f) {
+			property = &Schema{OneOf: []*Schema{property, {Type: "null"}}}
+		}
+		schema.Properties[name] = property
+	}
+
+	return schema
+}
+
+// applyRules adds a field's validation rules to its schema, and reports whether the field is
+// required. Numeric rules on types that aren't encoded as numbers (e.g. a Runtime) are left out.
+func applyRules(schema *Schema, rules []validator.Rule) bool {
+	required := false
+	numeric := schema.Type == "integer" || schema.Type == "number"
+
+	for _, rule := range rules {
+		n, _ := strconv.ParseFloat(rule.Param, 64)
+
+		switch {
+		case rule.Name == "required":
+			required = true
+		case rule.Name == "min" && schema.Type == "string":
+			schema.MinLength = &n
+		case rule.Name == "max" && schema.Type == "string":
+			schema.MaxLength = &n
+		case rule.Name == "min" && schema.Type == "array":
+			schema.MinItems = &n
+		case rule.Name == "max" && schema.Type == "array":
+			schema.MaxItems = &n
+		case rule.Name == "min" && schema.Type == "object":
+			schema.MinProperties = &n
+		case rule.Name == "max" && schema.Type == "object":
+			schema.MaxProperties = &n
+		case rule.Name == "min" && numeric:
+			schema.Minimum = &n
+		case rule.Name == "max" && numeric:
+			schema.Maximum = &n
+		case rule.Name == "gt" && numeric:
+			schema.ExclusiveMinimum = &n
+		case rule.Name == "lt" && numeric:
+			schema.ExclusiveMaximum = &n
+		case rule.Name == "oneof":
+			schema.Enum = strings.Fields(rule.Param)
+		case rule.Name == "email":
+			schema.Format = "email"
+		case rule.Name == "unique":
+			schema.UniqueItems = true
+		}
+	}
+
+	return required
+}
@@ -0,0 +1,65 @@
+package dto
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/walkccc/greenlight/internal/data"
+)
+
+func TestSchemaOf_CreateMovieRequest(t *testing.T) {
+	schema := SchemaOf(CreateMovieRequest{})
+	assert.Contains(t, schema.Properties["runtime"].Description, "PT1H47M")
+	schema.Properties["runtime"].Description = ""
+
+	js, err := json.Marshal(schema)
+	require.NoError(t, err)
+
+	assert.JSONEq(t, `{
+		"type": "object",
+		"properties": {
+			"title": {"type": "string", "maxLength": 500},
+			"year": {"type": "integer", "exclusiveMinimum": 1894},
+			"runtime": {"oneOf": [{"type": "integer"}, {"type": "string"}]},
+			"genres": {
+				"type": "array",
+				"items": {"type": "string"},
+				"minItems": 1,
+				"maxItems": 5,
+				"uniqueItems": true
+			},
+			"attributes": {
+				"type": "object",
+				"description": "the values of the custom attributes, keyed by their names",
+				"additionalProperties": {
+					"oneOf": [{"type": "string"}, {"type": "number"}, {"type": "boolean"}]
+				}
+			}
+		},
+		"required": ["title", "year", "runtime", "genres"]
+	}`, string(js))
+}
+
+func TestListMoviesQuery_CountStrategies(t *testing.T) {
+	schema := SchemaOf(ListMoviesQuery{})
+	assert.ElementsMatch(t, data.CountStrategies, schema.Properties["Count"].Enum)
+}
+
+func TestSchemaOf_MapLimits(t *testing.T) {
+	schema := SchemaOf(struct {
+		Labels map[string]string `json:"labels" validate:"min=1,max=10"`
+	}{})
+
+	js, err := json.Marshal(schema.Properties["labels"])
+	require.NoError(t, err)
+
+	// A map is counted in properties, not items.
+	assert.JSONEq(t, `{
+		"type": "object",
+		"additionalProperties": {"type": "string"},
+		"minProperties": 1,
+		"maxProperties": 10
+	}`, string(js))
+}
@@ -0,0 +1,195 @@
+// Package geoip resolves the country and the autonomous system (ASN) of the clients' IP addresses,
+// so that the requests can be blocked or broken down by where they come from.
+//
+// The Resolver interface is the extension point: a Table is read from a CSV file, and any other
+// database, such as a MaxMind GeoIP2 reader, can be plugged in by wrapping it in a Resolver.
+package geoip
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// Location is where an IP address is registered. Its fields are zero when they're unknown.
+type Location struct {
+	Country string `json:"country,omitempty"` // ISO 3166-1 alpha-2 code, e.g. "FR"
+	ASN     uint32 `json:"asn,omitempty"`
+}
+
+// Resolver returns the location of an IP address. An address it knows nothing about isn't an
+// error: its location is just empty.
+type Resolver interface {
+	Lookup(ip net.IP) (Location, error)
+}
+
+// ResolverFunc is an adapter to use an ordinary function as a Resolver.
+type ResolverFunc func(ip net.IP) (Location, error)
+
+func (f ResolverFunc) Lookup(ip net.IP) (Location, error) {
+	return f(ip)
+}
+
+// Table resolves the IP addresses from a list of networks, the most specific network containing
+// the address winning.
+type Table struct {
+	// networks holds the networks keyed by their masked address, for each prefix length in use,
+	// from the longest.
+	networks []tableNetworks
+}
+
+type tableNetworks struct {
+	ones, bits int
+	locations  map[string]Location
+}
+
+// ParseTable reads a table from CSV records of network, country and ASN, e.g.
+//
+//	network,country,asn
+//	192.0.2.0/24,FR,AS64496
+//	2001:db8::/32,DE,
+//
+// The header, the blank lines and the lines starting with # are skipped. The country and the ASN
+// may be empty, and the ASN may be written with or without its "AS" prefix.
+func ParseTable(r io.Reader) (*Table, error) {
+	reader := csv.NewReader(r)
+	reader.Comment = '#'
+	reader.FieldsPerRecord = 3
+	reader.TrimLeadingSpace = true
+
+	t := &Table{}
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if record[0] == "network" {
+			continue
+		}
+
+		_, network, err := net.ParseCIDR(record[0])
+		if err != nil {
+			return nil, err
+		}
+		asn, err := ParseASN(record[2])
+		if err != nil {
+			return nil, err
+		}
+		t.add(network, Location{Country: strings.ToUpper(record[1]), ASN: asn})
+	}
+
+	return t, nil
+}
+
+func (t *Table) add(network *net.IPNet, location Location) {
+	ones, bits := network.Mask.Size()
+
+	i := 0
+	for ; i < len(t.networks); i++ {
+		n := t.networks[i]
+		if n.ones == ones && n.bits == bits {
+			n.locations[string(network.IP)] = location
+			return
+		}
+		if n.ones < ones {
+			break
+		}
+	}
+
+	n := tableNetworks{ones: ones, bits: bits, locations: map[string]Location{
+		string(network.IP): location,
+	}}
+	t.networks = append(t.networks[:i], append([]tableNetworks{n}, t.networks[i:]...)...)
+}
+
+func (t *Table) Lookup(ip net.IP) (Location, error) {
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+
+	for _, n := range t.networks {
+		if len(ip)*8 != n.bits {
+			continue
+		}
+		masked := ip.Mask(net.CIDRMask(n.ones, n.bits))
+		if location, ok := n.locations[string(masked)]; ok {
+			return location, nil
+		}
+	}
+	return Location{}, nil
+}
+
+// ParseASN parses an autonomous system number, e.g. "AS64496" or "64496". An empty string is the
+// unknown ASN, zero.
+func ParseASN(s string) (uint32, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, nil
+	}
+
+	digits := strings.TrimPrefix(strings.ToUpper(s), "AS")
+	asn, err := strconv.ParseUint(digits, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("geoip: invalid ASN %q", s)
+	}
+	return uint32(asn), nil
+}
+
+// Blocklist holds the countries and the autonomous systems whose requests are rejected.
+type Blocklist struct {
+	countries map[string]bool
+	asns      map[uint32]bool
+}
+
+// ParseBlocklist returns the blocklist of the comma-separated country codes and ASNs, e.g. "KP,IR"
+// and "AS64496,64511".
+func ParseBlocklist(countries, asns string) (Blocklist, error) {
+	b := Blocklist{countries: make(map[string]bool), asns: make(map[uint32]bool)}
+
+	for _, country := range strings.Split(countries, ",") {
+		country = strings.ToUpper(strings.TrimSpace(country))
+		if country == "" {
+			continue
+		}
+		if len(country) != 2 {
+			return Blocklist{}, fmt.Errorf("geoip: invalid country code %q", country)
+		}
+		b.countries[country] = true
+	}
+
+	for _, s := range strings.Split(asns, ",") {
+		asn, err := ParseASN(s)
+		if err != nil {
+			return Blocklist{}, err
+		}
+		if asn != 0 {
+			b.asns[asn] = true
+		}
+	}
+
+	return b, nil
+}
+
+// Empty returns true if the blocklist doesn't block anything.
+func (b Blocklist) Empty() bool {
+	return len(b.countries) == 0 && len(b.asns) == 0
+}
+
+// Blocks returns the rule that blocks the location, e.g. "country:KP" or "asn:AS64496", and false
+// if none does.
+func (b Blocklist) Blocks(location Location) (string, bool) {
+	if location.Country != "" && b.countries[location.Country] {
+		return "country:" + location.Country, true
+	}
+	if location.ASN != 0 && b.asns[location.ASN] {
+		return "asn:AS" + strconv.FormatUint(uint64(location.ASN), 10), true
+	}
+	return "", false
+}
@@ -0,0 +1,76 @@
+package geoip
+
+import (
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTable(t *testing.T) {
+	table, err := ParseTable(strings.NewReader(`network,country,asn
+# documentation ranges
+192.0.2.0/24,fr,AS64496
+192.0.2.128/25,DE,64497
+198.51.100.0/24,,AS64498
+2001:db8::/32,NL,
+`))
+	require.NoError(t, err)
+
+	tests := []struct {
+		ip   string
+		want Location
+	}{
+		{"192.0.2.1", Location{Country: "FR", ASN: 64496}},
+		{"192.0.2.200", Location{Country: "DE", ASN: 64497}},
+		{"::ffff:192.0.2.1", Location{Country: "FR", ASN: 64496}},
+		{"198.51.100.7", Location{ASN: 64498}},
+		{"2001:db8::1", Location{Country: "NL"}},
+		{"203.0.113.1", Location{}},
+		{"not an ip", Location{}},
+	}
+	for _, tt := range tests {
+		location, err := table.Lookup(net.ParseIP(tt.ip))
+		require.NoError(t, err)
+		assert.Equal(t, tt.want, location, tt.ip)
+	}
+
+	for _, csv := range []string{
+		"192.0.2.0,FR,AS64496\n",
+		"192.0.2.0/24,FR,ASN64496\n",
+		"192.0.2.0/24,FR\n",
+	} {
+		_, err := ParseTable(strings.NewReader(csv))
+		assert.Error(t, err, csv)
+	}
+}
+
+func TestBlocklist(t *testing.T) {
+	blocklist, err := ParseBlocklist("kp, IR", "AS64496,64511")
+	require.NoError(t, err)
+	assert.False(t, blocklist.Empty())
+
+	rule, blocked := blocklist.Blocks(Location{Country: "KP"})
+	assert.True(t, blocked)
+	assert.Equal(t, "country:KP", rule)
+
+	rule, blocked = blocklist.Blocks(Location{Country: "FR", ASN: 64511})
+	assert.True(t, blocked)
+	assert.Equal(t, "asn:AS64511", rule)
+
+	_, blocked = blocklist.Blocks(Location{Country: "FR", ASN: 64497})
+	assert.False(t, blocked)
+	_, blocked = blocklist.Blocks(Location{})
+	assert.False(t, blocked)
+
+	empty, err := ParseBlocklist("", "")
+	require.NoError(t, err)
+	assert.True(t, empty.Empty())
+
+	_, err = ParseBlocklist("France", "")
+	assert.Error(t, err)
+	_, err = ParseBlocklist("", "AS-1")
+	assert.Error(t, err)
+}
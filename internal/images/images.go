@@ -0,0 +1,142 @@
+// Package images decodes the uploaded images and produces their resized variants, e.g. the
+// thumbnails of the posters. It only relies on the standard library, so it decodes JPEG and PNG,
+// and encodes the variants as JPEG or, with an encoder of its own, as lossless WebP.
+package images
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	_ "image/png" // registers the PNG decoder
+	"io"
+)
+
+// MaxPixels is the largest image that Decode decodes, which bounds the memory that an upload can
+// make the server allocate, since a small, highly compressed file can hold a huge image.
+const MaxPixels = 50_000_000
+
+var (
+	ErrUnsupported = errors.New("images: the image must be a JPEG or a PNG")
+	ErrTooLarge    = errors.New("images: the image has too many pixels")
+)
+
+// contentTypes maps the formats registered with the image package to their media types.
+var contentTypes = map[string]string{
+	"jpeg": "image/jpeg",
+	"png":  "image/png",
+}
+
+// Info describes an image, without decoding its pixels.
+type Info struct {
+	Width       int
+	Height      int
+	ContentType string
+}
+
+// Inspect reads the image's header, and checks that it's a JPEG or a PNG of MaxPixels at most.
+func Inspect(content []byte) (Info, error) {
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(content))
+	if err != nil {
+		return Info{}, ErrUnsupported
+	}
+
+	contentType, ok := contentTypes[format]
+	if !ok {
+		return Info{}, ErrUnsupported
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 || int64(cfg.Width)*int64(cfg.Height) > MaxPixels {
+		return Info{}, ErrTooLarge
+	}
+
+	return Info{Width: cfg.Width, Height: cfg.Height, ContentType: contentType}, nil
+}
+
+// Decode decodes the image, once Inspect has checked it.
+func Decode(content []byte) (image.Image, error) {
+	if _, err := Inspect(content); err != nil {
+		return nil, err
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(content))
+	return img, err
+}
+
+// Fit returns the image scaled down to maxWidth, keeping its aspect ratio. The images that are
+// already narrower are returned as they are, on a white background like the scaled ones, so that
+// the variants look the same whether they're encoded as WebP or as JPEG, which can't be
+// transparent.
+func Fit(img image.Image, maxWidth int) *image.RGBA {
+	bounds := img.Bounds()
+
+	// The transparent pixels would come out black otherwise.
+	src := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(src, src.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.Draw(src, src.Bounds(), img, bounds.Min, draw.Over)
+
+	if bounds.Dx() <= maxWidth {
+		return src
+	}
+
+	width := maxWidth
+	height := bounds.Dy() * maxWidth / bounds.Dx()
+	if height < 1 {
+		height = 1
+	}
+	return shrink(src, width, height)
+}
+
+// shrink scales the image down with a box filter: each pixel of the result is the average of the
+// source pixels it covers, which is as sharp as the resizing of an image down needs to be.
+func shrink(src *image.RGBA, width, height int) *image.RGBA {
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	sw, sh := src.Bounds().Dx(), src.Bounds().Dy()
+
+	for y := 0; y < height; y++ {
+		y0, y1 := y*sh/height, (y+1)*sh/height
+		if y1 == y0 {
+			y1 = y0 + 1
+		}
+
+		for x := 0; x < width; x++ {
+			x0, x1 := x*sw/width, (x+1)*sw/width
+			if x1 == x0 {
+				x1 = x0 + 1
+			}
+
+			var r, g, b, a, n int
+			for sy := y0; sy < y1; sy++ {
+				row := src.Pix[sy*src.Stride:]
+				for sx := x0; sx < x1; sx++ {
+					p := row[sx*4 : sx*4+4]
+					r, g, b, a = r+int(p[0]), g+int(p[1]), b+int(p[2]), a+int(p[3])
+					n++
+				}
+			}
+
+			i := dst.PixOffset(x, y)
+			dst.Pix[i+0] = uint8(r / n)
+			dst.Pix[i+1] = uint8(g / n)
+			dst.Pix[i+2] = uint8(b / n)
+			dst.Pix[i+3] = uint8(a / n)
+		}
+	}
+
+	return dst
+}
+
+// Encoder encodes the variants of an image, and names their media type.
+type Encoder struct {
+	ContentType string
+	Encode      func(w io.Writer, img image.Image) error
+}
+
+// JPEG encodes the variants as JPEG, at a quality that doesn't show at the sizes of a variant.
+var JPEG = Encoder{
+	ContentType: "image/jpeg",
+	Encode: func(w io.Writer, img image.Image) error {
+		return jpeg.Encode(w, img, &jpeg.Options{Quality: 85})
+	},
+}
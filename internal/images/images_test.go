@@ -0,0 +1,42 @@
+package images
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFit(t *testing.T) {
+	// The left half is red, and the right half transparent.
+	img := image.NewNRGBA(image.Rect(0, 0, 400, 600))
+	for y := 0; y < 600; y++ {
+		for x := 0; x < 200; x++ {
+			img.Set(x, y, color.NRGBA{R: 255, A: 255})
+		}
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, img))
+
+	info, err := Inspect(buf.Bytes())
+	require.NoError(t, err)
+	assert.Equal(t, Info{Width: 400, Height: 600, ContentType: "image/png"}, info)
+
+	decoded, err := Decode(buf.Bytes())
+	require.NoError(t, err)
+
+	thumb := Fit(decoded, 100)
+	assert.Equal(t, image.Rect(0, 0, 100, 150), thumb.Bounds())
+	assert.Equal(t, color.RGBA{R: 255, A: 255}, thumb.RGBAAt(10, 10))
+	assert.Equal(t, color.RGBA{R: 255, G: 255, B: 255, A: 255}, thumb.RGBAAt(90, 10))
+
+	assert.Equal(t, image.Rect(0, 0, 400, 600), Fit(decoded, 640).Bounds())
+
+	_, err = Inspect([]byte("GIF89a"))
+	assert.ErrorIs(t, err, ErrUnsupported)
+}
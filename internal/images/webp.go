@@ -0,0 +1,540 @@
+package images
+
+import (
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/draw"
+	"io"
+	"sort"
+)
+
+// WebP encodes the variants as lossless WebP, which every current browser displays. Lossless
+// rather than lossy, since the lossy format needs a much larger encoder than the lossless one.
+var WebP = Encoder{
+	ContentType: "image/webp",
+	Encode:      EncodeWebP,
+}
+
+// maxWebPSize is the largest width and height of a WebP image.
+const maxWebPSize = 1 << 14
+
+var ErrWebPTooLarge = errors.New("images: a WebP image is at most 16384 pixels wide and high")
+
+// The parameters of the lossless bitstream, as RFC 9649 names them.
+const (
+	vp8lSignature = 0x2f
+
+	transformPredictor     = 0
+	transformSubtractGreen = 2
+
+	// predictorBits is the log2 of the size of the blocks that share a predictor.
+	predictorBits = 4
+
+	numLiteralCodes  = 256
+	numLengthCodes   = 24
+	numDistanceCodes = 40
+
+	maxCodeLength           = 15
+	maxCodeLengthCodeLength = 7
+)
+
+// codeLengthCodeOrder is the order in which the code lengths of the code length code are written.
+var codeLengthCodeOrder = [19]int{17, 18, 0, 1, 2, 3, 4, 5, 16, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}
+
+// predictorModes are the predictors that the blocks choose from: the left pixel, the top pixel,
+// their average, and the gradient (L + T - TL).
+var predictorModes = []int{1, 2, 7, 12}
+
+// EncodeWebP writes the image to w as a lossless WebP. The green channel is subtracted from the
+// red and blue ones, and each block of pixels is predicted from its neighbours, so that the
+// prefix codes only have the residuals to compress. There are no backward references, which
+// keeps the encoder small at the cost of a larger file.
+func EncodeWebP(w io.Writer, img image.Image) error {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width <= 0 || height <= 0 {
+		return errors.New("images: the image is empty")
+	}
+	if width > maxWebPSize || height > maxWebPSize {
+		return ErrWebPTooLarge
+	}
+
+	nrgba := image.NewNRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(nrgba, nrgba.Bounds(), img, bounds.Min, draw.Src)
+
+	pixels := make([]uint32, width*height)
+	alphaUsed := false
+	for i := range pixels {
+		p := nrgba.Pix[i*4 : i*4+4]
+		r, g, b, a := uint32(p[0]), uint32(p[1]), uint32(p[2]), uint32(p[3])
+		if a != 0xff {
+			alphaUsed = true
+		}
+
+		// The subtract green transform.
+		r, b = (r-g)&0xff, (b-g)&0xff
+		pixels[i] = a<<24 | r<<16 | g<<8 | b
+	}
+
+	modes, residuals := predict(pixels, width, height)
+
+	bw := &bitWriter{}
+	bw.writeBits(vp8lSignature, 8)
+	bw.writeBits(uint32(width-1), 14)
+	bw.writeBits(uint32(height-1), 14)
+	if alphaUsed {
+		bw.writeBits(1, 1)
+	} else {
+		bw.writeBits(0, 1)
+	}
+	bw.writeBits(0, 3)
+
+	// The transforms are written in the order they were applied, and undone in reverse.
+	bw.writeBits(1, 1)
+	bw.writeBits(transformSubtractGreen, 2)
+	bw.writeBits(1, 1)
+	bw.writeBits(transformPredictor, 2)
+	bw.writeBits(predictorBits-2, 3)
+	writeImage(bw, modes, false)
+	bw.writeBits(0, 1)
+
+	writeImage(bw, residuals, true)
+
+	return writeRIFF(w, bw.bytes())
+}
+
+// predict chooses the predictor of each block of the image, and returns the predictors, as the
+// green channel of the pixels of a sub-image with a pixel per block, along with the residuals of
+// the image's pixels.
+func predict(pixels []uint32, width, height int) ([]uint32, []uint32) {
+	blockSize := 1 << predictorBits
+	blocksX := (width + blockSize - 1) >> predictorBits
+	blocksY := (height + blockSize - 1) >> predictorBits
+
+	modes := make([]uint32, blocksX*blocksY)
+	residuals := make([]uint32, len(pixels))
+
+	for by := 0; by < blocksY; by++ {
+		for bx := 0; bx < blocksX; bx++ {
+			x0, y0 := bx*blockSize, by*blockSize
+			x1, y1 := x0+blockSize, y0+blockSize
+			if x1 > width {
+				x1 = width
+			}
+			if y1 > height {
+				y1 = height
+			}
+
+			// The block uses the predictor whose residuals are the smallest.
+			best, bestCost := predictorModes[0], -1
+			for _, mode := range predictorModes {
+				cost := 0
+				for y := y0; y < y1; y++ {
+					for x := x0; x < x1; x++ {
+						i := y*width + x
+						prediction := predictPixel(pixels, width, x, y, mode)
+						cost += residualCost(subPixels(pixels[i], prediction))
+					}
+				}
+				if bestCost < 0 || cost < bestCost {
+					best, bestCost = mode, cost
+				}
+			}
+
+			modes[by*blocksX+bx] = 0xff000000 | uint32(best)<<8
+			for y := y0; y < y1; y++ {
+				for x := x0; x < x1; x++ {
+					i := y*width + x
+					residuals[i] = subPixels(pixels[i], predictPixel(pixels, width, x, y, best))
+				}
+			}
+		}
+	}
+
+	return modes, residuals
+}
+
+// predictPixel returns the prediction of the pixel at x, y. The pixels of the top row are
+// predicted by their left neighbour, and those of the left column by their top one, whatever the
+// mode of their block.
+func predictPixel(pixels []uint32, width, x, y, mode int) uint32 {
+	i := y*width + x
+	switch {
+	case x == 0 && y == 0:
+		return 0xff000000
+	case y == 0:
+		return pixels[i-1]
+	case x == 0:
+		return pixels[i-width]
+	}
+
+	left, top, topLeft := pixels[i-1], pixels[i-width], pixels[i-width-1]
+	switch mode {
+	case 1:
+		return left
+	case 2:
+		return top
+	case 7:
+		return average2(left, top)
+	default:
+		return clampAddSubtractFull(left, top, topLeft)
+	}
+}
+
+// average2 returns the average of each channel of the pixels, rounded down.
+func average2(a, b uint32) uint32 {
+	return (((a ^ b) & 0xfefefefe) >> 1) + (a & b)
+}
+
+// clampAddSubtractFull returns a + b - c for each channel of the pixels, clamped to 0..255.
+func clampAddSubtractFull(a, b, c uint32) uint32 {
+	var p uint32
+	for shift := 0; shift < 32; shift += 8 {
+		v := int(a>>shift&0xff) + int(b>>shift&0xff) - int(c>>shift&0xff)
+		if v < 0 {
+			v = 0
+		} else if v > 0xff {
+			v = 0xff
+		}
+		p |= uint32(v) << shift
+	}
+	return p
+}
+
+// subPixels returns a - b for each channel of the pixels, modulo 256.
+func subPixels(a, b uint32) uint32 {
+	alphaGreen := 0x00ff00ff + (a & 0xff00ff00) - (b & 0xff00ff00)
+	redBlue := 0xff00ff00 + (a & 0x00ff00ff) - (b & 0x00ff00ff)
+	return (alphaGreen & 0xff00ff00) | (redBlue & 0x00ff00ff)
+}
+
+// residualCost estimates the cost of coding the residual: the sum of its channels as signed
+// values, since the small residuals get the short codes.
+func residualCost(residual uint32) int {
+	cost := 0
+	for shift := 0; shift < 32; shift += 8 {
+		v := int(int8(residual >> shift))
+		if v < 0 {
+			v = -v
+		}
+		cost += v
+	}
+	return cost
+}
+
+// writeImage writes the pixels as literals, with a prefix code per channel. Only the ARGB image
+// itself, as opposed to the sub-images of the transforms, has the meta prefix codes bit.
+func writeImage(bw *bitWriter, pixels []uint32, argb bool) {
+	// No color cache.
+	bw.writeBits(0, 1)
+	if argb {
+		// A single group of prefix codes for the whole image.
+		bw.writeBits(0, 1)
+	}
+
+	green := make([]int, numLiteralCodes+numLengthCodes)
+	red := make([]int, numLiteralCodes)
+	blue := make([]int, numLiteralCodes)
+	alpha := make([]int, numLiteralCodes)
+	for _, p := range pixels {
+		green[p>>8&0xff]++
+		red[p>>16&0xff]++
+		blue[p&0xff]++
+		alpha[p>>24]++
+	}
+
+	greenCode := writePrefixCode(bw, green)
+	redCode := writePrefixCode(bw, red)
+	blueCode := writePrefixCode(bw, blue)
+	alphaCode := writePrefixCode(bw, alpha)
+	writePrefixCode(bw, make([]int, numDistanceCodes))
+
+	for _, p := range pixels {
+		greenCode.write(bw, int(p>>8&0xff))
+		redCode.write(bw, int(p>>16&0xff))
+		blueCode.write(bw, int(p&0xff))
+		alphaCode.write(bw, int(p>>24))
+	}
+}
+
+// prefixCode is a canonical prefix code, whose codes are bit reversed since the bitstream is
+// read from the least significant bit.
+type prefixCode struct {
+	lengths []uint8
+	codes   []uint32
+}
+
+func newPrefixCode(lengths []uint8) prefixCode {
+	var counts [maxCodeLength + 1]uint32
+	for _, length := range lengths {
+		counts[length]++
+	}
+	counts[0] = 0
+
+	var next [maxCodeLength + 1]uint32
+	code := uint32(0)
+	for length := 1; length <= maxCodeLength; length++ {
+		code = (code + counts[length-1]) << 1
+		next[length] = code
+	}
+
+	codes := make([]uint32, len(lengths))
+	for symbol, length := range lengths {
+		if length == 0 {
+			continue
+		}
+		code := next[length]
+		next[length]++
+
+		var reversed uint32
+		for i := uint8(0); i < length; i++ {
+			reversed = reversed<<1 | code>>i&1
+		}
+		codes[symbol] = reversed
+	}
+
+	return prefixCode{lengths: lengths, codes: codes}
+}
+
+func (c prefixCode) write(bw *bitWriter, symbol int) {
+	bw.writeBits(c.codes[symbol], int(c.lengths[symbol]))
+}
+
+// writePrefixCode writes the prefix code of the symbols' counts, and returns it. The codes of up
+// to two literals are written as simple codes, and the others as the code lengths of their
+// symbols, themselves prefix coded.
+func writePrefixCode(bw *bitWriter, counts []int) prefixCode {
+	var used []int
+	for symbol, count := range counts {
+		if count > 0 {
+			used = append(used, symbol)
+		}
+	}
+
+	if len(used) <= 2 && (len(used) == 0 || used[len(used)-1] < numLiteralCodes) {
+		if len(used) == 0 {
+			used = []int{0}
+		}
+
+		bw.writeBits(1, 1)
+		bw.writeBits(uint32(len(used)-1), 1)
+		if used[0] <= 1 {
+			bw.writeBits(0, 1)
+			bw.writeBits(uint32(used[0]), 1)
+		} else {
+			bw.writeBits(1, 1)
+			bw.writeBits(uint32(used[0]), 8)
+		}
+
+		// A single symbol takes no bits.
+		lengths := make([]uint8, len(counts))
+		if len(used) == 2 {
+			bw.writeBits(uint32(used[1]), 8)
+			lengths[used[0]], lengths[used[1]] = 1, 1
+		}
+		return newPrefixCode(lengths)
+	}
+
+	lengths := codeLengths(counts, maxCodeLength)
+	bw.writeBits(0, 1)
+	writeCodeLengths(bw, lengths)
+	return newPrefixCode(lengths)
+}
+
+// codeLengthToken is a symbol of the code length code, with its repeat count, if any.
+type codeLengthToken struct {
+	symbol int
+	extra  uint32
+}
+
+// writeCodeLengths writes the code lengths with the code length code, in which the runs of zeros
+// (code 17 for 3 to 10 zeros, code 18 for 11 to 138) are single symbols.
+func writeCodeLengths(bw *bitWriter, lengths []uint8) {
+	var tokens []codeLengthToken
+	for i := 0; i < len(lengths); {
+		if lengths[i] != 0 {
+			tokens = append(tokens, codeLengthToken{symbol: int(lengths[i])})
+			i++
+			continue
+		}
+
+		run := 0
+		for i+run < len(lengths) && lengths[i+run] == 0 {
+			run++
+		}
+		i += run
+
+		for run >= 11 {
+			n := run
+			if n > 138 {
+				n = 138
+			}
+			tokens = append(tokens, codeLengthToken{symbol: 18, extra: uint32(n - 11)})
+			run -= n
+		}
+		if run >= 3 {
+			tokens = append(tokens, codeLengthToken{symbol: 17, extra: uint32(run - 3)})
+			run = 0
+		}
+		for ; run > 0; run-- {
+			tokens = append(tokens, codeLengthToken{symbol: 0})
+		}
+	}
+
+	counts := make([]int, len(codeLengthCodeOrder))
+	for _, token := range tokens {
+		counts[token.symbol]++
+	}
+	code := newPrefixCode(codeLengths(counts, maxCodeLengthCodeLength))
+
+	n := len(codeLengthCodeOrder)
+	for n > 4 && code.lengths[codeLengthCodeOrder[n-1]] == 0 {
+		n--
+	}
+	bw.writeBits(uint32(n-4), 4)
+	for _, symbol := range codeLengthCodeOrder[:n] {
+		bw.writeBits(uint32(code.lengths[symbol]), 3)
+	}
+
+	// The code lengths of every symbol of the alphabet follow.
+	bw.writeBits(0, 1)
+	for _, token := range tokens {
+		code.write(bw, token.symbol)
+		switch token.symbol {
+		case 17:
+			bw.writeBits(token.extra, 3)
+		case 18:
+			bw.writeBits(token.extra, 7)
+		}
+	}
+}
+
+// codeLengths returns the lengths of the Huffman code of the symbols' counts, limited to
+// maxLength. The counts are halved until the code fits, which keeps it complete. A single symbol
+// is given a sibling, since a code of one symbol has no bits.
+func codeLengths(counts []int, maxLength int) []uint8 {
+	var used []int
+	for symbol, count := range counts {
+		if count > 0 {
+			used = append(used, symbol)
+		}
+	}
+
+	lengths := make([]uint8, len(counts))
+	switch len(used) {
+	case 0:
+		return lengths
+	case 1:
+		sibling := 0
+		if used[0] == 0 {
+			sibling = 1
+		}
+		lengths[used[0]], lengths[sibling] = 1, 1
+		return lengths
+	}
+
+	for shift := 0; ; shift++ {
+		weights := make([]int, len(used))
+		for i, symbol := range used {
+			weights[i] = counts[symbol]>>shift | 1
+		}
+
+		depths := huffmanDepths(weights)
+		fits := true
+		for _, depth := range depths {
+			if depth > maxLength {
+				fits = false
+			}
+		}
+		if fits {
+			for i, symbol := range used {
+				lengths[symbol] = uint8(depths[i])
+			}
+			return lengths
+		}
+	}
+}
+
+// huffmanDepths returns the depths of the leaves of the Huffman tree of the weights.
+func huffmanDepths(weights []int) []int {
+	// The nodes are the leaves, followed by the internal nodes as they're made.
+	nodeWeights := append([]int(nil), weights...)
+	parents := make([]int, len(weights), 2*len(weights)-1)
+	for i := range parents {
+		parents[i] = -1
+	}
+
+	roots := make([]int, len(weights))
+	for i := range roots {
+		roots[i] = i
+	}
+	for len(roots) > 1 {
+		sort.Slice(roots, func(i, j int) bool {
+			a, b := roots[i], roots[j]
+			if nodeWeights[a] != nodeWeights[b] {
+				return nodeWeights[a] < nodeWeights[b]
+			}
+			return a < b
+		})
+
+		node := len(nodeWeights)
+		nodeWeights = append(nodeWeights, nodeWeights[roots[0]]+nodeWeights[roots[1]])
+		parents = append(parents, -1)
+		parents[roots[0]], parents[roots[1]] = node, node
+		roots = append(roots[2:], node)
+	}
+
+	depths := make([]int, len(weights))
+	for i := range depths {
+		for node := i; parents[node] >= 0; node = parents[node] {
+			depths[i]++
+		}
+	}
+	return depths
+}
+
+// writeRIFF wraps the lossless bitstream in the RIFF container of a WebP file.
+func writeRIFF(w io.Writer, bitstream []byte) error {
+	padded := len(bitstream) + len(bitstream)&1
+
+	header := make([]byte, 20)
+	copy(header[0:], "RIFF")
+	binary.LittleEndian.PutUint32(header[4:], uint32(4+8+padded))
+	copy(header[8:], "WEBPVP8L")
+	binary.LittleEndian.PutUint32(header[16:], uint32(len(bitstream)))
+
+	_, err := w.Write(header)
+	if err == nil {
+		_, err = w.Write(bitstream)
+	}
+	if err == nil && padded > len(bitstream) {
+		_, err = w.Write([]byte{0})
+	}
+	return err
+}
+
+// bitWriter writes the bitstream from the least significant bit of each byte.
+type bitWriter struct {
+	buf   []byte
+	acc   uint64
+	nbits int
+}
+
+func (bw *bitWriter) writeBits(value uint32, n int) {
+	bw.acc |= uint64(value) << bw.nbits
+	bw.nbits += n
+	for bw.nbits >= 8 {
+		bw.buf = append(bw.buf, byte(bw.acc))
+		bw.acc >>= 8
+		bw.nbits -= 8
+	}
+}
+
+// bytes returns the bitstream, padded with zeros to a whole byte.
+func (bw *bitWriter) bytes() []byte {
+	if bw.nbits > 0 {
+		return append(bw.buf, byte(bw.acc))
+	}
+	return bw.buf
+}
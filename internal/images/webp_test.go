@@ -0,0 +1,409 @@
+package images
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncodeWebP(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+
+	// A gradient with some noise, and a translucent corner.
+	gradient := image.NewNRGBA(image.Rect(0, 0, 83, 47))
+	for y := 0; y < 47; y++ {
+		for x := 0; x < 83; x++ {
+			c := color.NRGBA{R: uint8(x * 3), G: uint8(y * 5), B: uint8(x + y), A: 255}
+			if rng.Intn(10) == 0 {
+				c.G = uint8(rng.Intn(256))
+			}
+			if x > 60 && y > 30 {
+				c.A = uint8(rng.Intn(256))
+			}
+			gradient.SetNRGBA(x, y, c)
+		}
+	}
+
+	noise := image.NewNRGBA(image.Rect(0, 0, 64, 64))
+	rng.Read(noise.Pix)
+
+	uniform := image.NewNRGBA(image.Rect(0, 0, 40, 40))
+	for i := range uniform.Pix {
+		uniform.Pix[i] = 0xff
+	}
+
+	tests := map[string]*image.NRGBA{
+		"Gradient": gradient,
+		"Noise":    noise,
+		"Uniform":  uniform,
+		"Pixel":    image.NewNRGBA(image.Rect(0, 0, 1, 1)),
+		"Column":   image.NewNRGBA(image.Rect(0, 0, 1, 33)),
+		"Thumb":    toNRGBA(Fit(gradient, 20)),
+	}
+	for name, img := range tests {
+		t.Run(name, func(t *testing.T) {
+			var buf bytes.Buffer
+			require.NoError(t, WebP.Encode(&buf, img))
+
+			decoded, err := decodeWebP(buf.Bytes())
+			require.NoError(t, err)
+			assert.Equal(t, img.Bounds(), decoded.Bounds())
+			assert.Equal(t, img.Pix, decoded.Pix)
+		})
+	}
+
+	// The predictors leave little of the flat images to code.
+	var buf bytes.Buffer
+	require.NoError(t, EncodeWebP(&buf, uniform))
+	assert.Less(t, buf.Len(), len(uniform.Pix)/20)
+
+	err := EncodeWebP(&buf, image.NewNRGBA(image.Rect(0, 0, 1, maxWebPSize+1)))
+	assert.ErrorIs(t, err, ErrWebPTooLarge)
+}
+
+func toNRGBA(img image.Image) *image.NRGBA {
+	nrgba := image.NewNRGBA(img.Bounds())
+	for y := img.Bounds().Min.Y; y < img.Bounds().Max.Y; y++ {
+		for x := img.Bounds().Min.X; x < img.Bounds().Max.X; x++ {
+			nrgba.Set(x, y, img.At(x, y))
+		}
+	}
+	return nrgba
+}
+
+// decodeWebP decodes the lossless WebP files that EncodeWebP writes, following RFC 9649 rather
+// than the encoder's code. It supports the subtract green and predictor transforms, and the
+// images without a color cache, meta prefix codes or backward references.
+func decodeWebP(file []byte) (*image.NRGBA, error) {
+	if len(file) < 20 || string(file[0:4]) != "RIFF" || string(file[8:16]) != "WEBPVP8L" {
+		return nil, errors.New("not a lossless WebP")
+	}
+	if int(binary.LittleEndian.Uint32(file[4:])) != len(file)-8 {
+		return nil, errors.New("wrong RIFF size")
+	}
+	size := int(binary.LittleEndian.Uint32(file[16:]))
+	if size+size&1 != len(file)-20 {
+		return nil, errors.New("wrong chunk size")
+	}
+
+	br := &bitReader{data: file[20 : 20+size]}
+	if br.read(8) != vp8lSignature {
+		return nil, errors.New("wrong signature")
+	}
+	width, height := int(br.read(14))+1, int(br.read(14))+1
+	br.read(1)
+	if br.read(3) != 0 {
+		return nil, errors.New("wrong version")
+	}
+
+	type transform struct {
+		kind  uint32
+		bits  int
+		modes []uint32
+	}
+	var transforms []transform
+	for br.read(1) == 1 {
+		tr := transform{kind: br.read(2)}
+		switch tr.kind {
+		case transformSubtractGreen:
+		case transformPredictor:
+			tr.bits = int(br.read(3)) + 2
+			blocksX, blocksY := blocks(width, tr.bits), blocks(height, tr.bits)
+			var err error
+			tr.modes, err = readImage(br, blocksX*blocksY, false)
+			if err != nil {
+				return nil, err
+			}
+		default:
+			return nil, fmt.Errorf("unsupported transform %d", tr.kind)
+		}
+		transforms = append(transforms, tr)
+	}
+
+	pixels, err := readImage(br, width*height, true)
+	if err != nil {
+		return nil, err
+	}
+	if br.err != nil {
+		return nil, br.err
+	}
+
+	for i := len(transforms) - 1; i >= 0; i-- {
+		tr := transforms[i]
+		if tr.kind == transformSubtractGreen {
+			for i, p := range pixels {
+				g := p >> 8 & 0xff
+				r, b := (p>>16+g)&0xff, (p+g)&0xff
+				pixels[i] = p&0xff00ff00 | r<<16 | b
+			}
+			continue
+		}
+
+		blocksX := blocks(width, tr.bits)
+		for y := 0; y < height; y++ {
+			for x := 0; x < width; x++ {
+				block := tr.modes[(y>>tr.bits)*blocksX+(x>>tr.bits)]
+				mode := (block >> 8) & 0xf
+				prediction, err := decodePrediction(pixels, width, x, y, mode)
+				if err != nil {
+					return nil, err
+				}
+				i := y*width + x
+				pixels[i] = addChannels(pixels[i], prediction)
+			}
+		}
+	}
+
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for i, p := range pixels {
+		img.Pix[i*4+0] = uint8(p >> 16)
+		img.Pix[i*4+1] = uint8(p >> 8)
+		img.Pix[i*4+2] = uint8(p)
+		img.Pix[i*4+3] = uint8(p >> 24)
+	}
+	return img, nil
+}
+
+// blocks returns the number of blocks of 1<<bits pixels that cover the size.
+func blocks(size, bits int) int {
+	return (size + 1<<bits - 1) >> bits
+}
+
+func decodePrediction(pixels []uint32, width, x, y int, mode uint32) (uint32, error) {
+	i := y*width + x
+	switch {
+	case x == 0 && y == 0:
+		return 0xff000000, nil
+	case y == 0:
+		return pixels[i-1], nil
+	case x == 0:
+		return pixels[i-width], nil
+	}
+
+	// The top right pixel of the rightmost column is the leftmost of the current row, which is
+	// where it is in memory.
+	l, t, tl, tr := pixels[i-1], pixels[i-width], pixels[i-width-1], pixels[i-width+1]
+	avg := func(a, b uint32) uint32 {
+		return perChannel(a, b, 0, func(a, b, _ int) int { return (a + b) / 2 })
+	}
+	switch mode {
+	case 0:
+		return 0xff000000, nil
+	case 1:
+		return l, nil
+	case 2:
+		return t, nil
+	case 3:
+		return tr, nil
+	case 4:
+		return tl, nil
+	case 5:
+		return avg(avg(l, tr), t), nil
+	case 6:
+		return avg(l, tl), nil
+	case 7:
+		return avg(l, t), nil
+	case 8:
+		return avg(tl, t), nil
+	case 9:
+		return avg(t, tr), nil
+	case 10:
+		return avg(avg(l, tl), avg(t, tr)), nil
+	case 12:
+		return perChannel(l, t, tl, func(a, b, c int) int {
+			v := a + b - c
+			if v < 0 {
+				return 0
+			}
+			if v > 255 {
+				return 255
+			}
+			return v
+		}), nil
+	}
+	return 0, fmt.Errorf("unsupported predictor %d", mode)
+}
+
+func perChannel(a, b, c uint32, f func(a, b, c int) int) uint32 {
+	var p uint32
+	for shift := 0; shift < 32; shift += 8 {
+		v := f(int(a>>shift&0xff), int(b>>shift&0xff), int(c>>shift&0xff))
+		p |= uint32(v&0xff) << shift
+	}
+	return p
+}
+
+func addChannels(a, b uint32) uint32 {
+	return perChannel(a, b, 0, func(a, b, _ int) int { return a + b })
+}
+
+// readImage reads n pixels of an image coded with a single group of prefix codes.
+func readImage(br *bitReader, n int, argb bool) ([]uint32, error) {
+	if br.read(1) != 0 {
+		return nil, errors.New("unsupported color cache")
+	}
+	if argb && br.read(1) != 0 {
+		return nil, errors.New("unsupported meta prefix codes")
+	}
+
+	var codes [5]*huffmanDecoder
+	for i, size := range []int{numLiteralCodes + numLengthCodes, 256, 256, 256, numDistanceCodes} {
+		var err error
+		codes[i], err = readPrefixCode(br, size)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	pixels := make([]uint32, n)
+	for i := range pixels {
+		g := codes[0].decode(br)
+		if g >= numLiteralCodes {
+			return nil, errors.New("unsupported backward reference")
+		}
+		r, b, a := codes[1].decode(br), codes[2].decode(br), codes[3].decode(br)
+		pixels[i] = uint32(a)<<24 | uint32(r)<<16 | uint32(g)<<8 | uint32(b)
+	}
+	return pixels, br.err
+}
+
+func readPrefixCode(br *bitReader, alphabetSize int) (*huffmanDecoder, error) {
+	lengths := make([]int, alphabetSize)
+
+	if br.read(1) == 1 {
+		n := br.read(1) + 1
+		first := br.read(1 + 7*br.read(1))
+		if n == 1 {
+			return &huffmanDecoder{single: int(first)}, nil
+		}
+		lengths[first] = 1
+		lengths[br.read(8)] = 1
+		return newHuffmanDecoder(lengths)
+	}
+
+	codeLengthLengths := make([]int, len(codeLengthCodeOrder))
+	n := int(br.read(4)) + 4
+	for _, symbol := range codeLengthCodeOrder[:n] {
+		codeLengthLengths[symbol] = int(br.read(3))
+	}
+	codeLengthCode, err := newHuffmanDecoder(codeLengthLengths)
+	if err != nil {
+		return nil, err
+	}
+
+	maxSymbol := alphabetSize
+	if br.read(1) == 1 {
+		maxSymbol = 2 + int(br.read(2+2*br.read(3)))
+	}
+
+	previous := 8
+	for symbol := 0; symbol < alphabetSize && maxSymbol > 0; maxSymbol-- {
+		code := codeLengthCode.decode(br)
+		repeat, length := 1, code
+		switch code {
+		case 16:
+			repeat, length = 3+int(br.read(2)), previous
+		case 17:
+			repeat, length = 3+int(br.read(3)), 0
+		case 18:
+			repeat, length = 11+int(br.read(7)), 0
+		default:
+			if code != 0 {
+				previous = code
+			}
+		}
+		if symbol+repeat > alphabetSize {
+			return nil, errors.New("too many code lengths")
+		}
+		for ; repeat > 0; repeat-- {
+			lengths[symbol] = length
+			symbol++
+		}
+	}
+
+	return newHuffmanDecoder(lengths)
+}
+
+// huffmanDecoder decodes the symbols of a canonical prefix code, or a single symbol in no bits.
+type huffmanDecoder struct {
+	single  int
+	symbols map[[2]int]int
+}
+
+func newHuffmanDecoder(lengths []int) (*huffmanDecoder, error) {
+	var counts [maxCodeLength + 1]int
+	var used []int
+	for symbol, length := range lengths {
+		if length > 0 {
+			counts[length]++
+			used = append(used, symbol)
+		}
+	}
+	if len(used) == 1 {
+		return &huffmanDecoder{single: used[0]}, nil
+	}
+
+	// The code must be complete.
+	kraft := 0
+	for length := 1; length <= maxCodeLength; length++ {
+		kraft += counts[length] << (maxCodeLength - length)
+	}
+	if kraft != 1<<maxCodeLength {
+		return nil, errors.New("incomplete prefix code")
+	}
+
+	var next [maxCodeLength + 2]int
+	for length := 1; length <= maxCodeLength; length++ {
+		next[length+1] = (next[length] + counts[length]) << 1
+	}
+	d := &huffmanDecoder{symbols: make(map[[2]int]int)}
+	for _, symbol := range used {
+		length := lengths[symbol]
+		d.symbols[[2]int{length, next[length]}] = symbol
+		next[length]++
+	}
+	return d, nil
+}
+
+func (d *huffmanDecoder) decode(br *bitReader) int {
+	if d.symbols == nil {
+		return d.single
+	}
+	code := 0
+	for length := 1; length <= maxCodeLength; length++ {
+		code = code<<1 | int(br.read(1))
+		if symbol, ok := d.symbols[[2]int{length, code}]; ok {
+			return symbol
+		}
+	}
+	br.err = errors.New("invalid code")
+	return 0
+}
+
+// bitReader reads the bitstream from the least significant bit of each byte.
+type bitReader struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+func (br *bitReader) read(n uint32) uint32 {
+	var v uint32
+	for i := uint32(0); i < n; i++ {
+		if br.pos >= len(br.data)*8 {
+			br.err = errors.New("unexpected end of the bitstream")
+			return 0
+		}
+		v |= uint32(br.data[br.pos>>3]>>(br.pos&7)&1) << i
+		br.pos++
+	}
+	return v
+}
@@ -35,11 +35,25 @@ func (l Level) String() string {
 	}
 }
 
+// Entry holds the details of an ERROR or FATAL level log entry passed to the hooks.
+type Entry struct {
+	Level      Level
+	Time       time.Time
+	Message    string
+	Properties map[string]string
+	Trace      string
+}
+
+// Hook is a function that's called with every entry at the ERROR level or above, e.g. to forward
+// it to an error tracker.
+type Hook func(entry Entry)
+
 // Logger is a custom logger.
 type Logger struct {
 	out      io.Writer  // the output destination that the log entries will be written to
 	minLevel Level      // the minimum severity level that the log entries will be written for
 	mtx      sync.Mutex // a mutex for coordinating the writes
+	hooks    []Hook     // the hooks called for entries at the ERROR level or above
 }
 
 // New returns a new Logger instance which writes log entries at or above a minimum severity level
@@ -51,6 +65,12 @@ func New(out io.Writer, minLevel Level) *Logger {
 	}
 }
 
+// AddHook registers a hook to be called with every entry at the ERROR level or above. Hooks should
+// be added before the logger is used concurrently.
+func (l *Logger) AddHook(hook Hook) {
+	l.hooks = append(l.hooks, hook)
+}
+
 // PrintInfo is a helper that writes INFO level log entries.
 func (l *Logger) PrintInfo(message string, properties map[string]string) {
 	l.print(LevelInfo, message, properties)
@@ -94,6 +114,23 @@ func (l *Logger) print(level Level, message string, properties map[string]string
 		aux.Trace = string(debug.Stack())
 	}
 
+	// Call the hooks once we're done, so that a slow hook doesn't hold the mutex. Note that for
+	// FATAL entries this still happens before PrintFatal() terminates the application.
+	if level >= LevelError && len(l.hooks) > 0 {
+		entry := Entry{
+			Level:      level,
+			Time:       time.Now().UTC(),
+			Message:    message,
+			Properties: properties,
+			Trace:      aux.Trace,
+		}
+		defer func() {
+			for _, hook := range l.hooks {
+				hook(entry)
+			}
+		}()
+	}
+
 	// line holds the actual log entry text.
 	var line []byte
 
@@ -0,0 +1,329 @@
+package loadgen
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// Config holds the settings of a load test run.
+type Config struct {
+	Target      string // the base URL of the instance, e.g. http://localhost:4000
+	Scenario    Scenario
+	Concurrency int           // the number of workers sending requests
+	Duration    time.Duration // how long the run lasts, unless Requests is reached first
+	Requests    int           // the number of requests to send, or zero for no limit
+	Token       string        // the bearer token of the requests, if any
+	Email       string        // the credentials of the logins, for the auth-churn scenario
+	Password    string
+	Seed        int64 // seeds the workers' random choices, so that runs can be replayed
+	Client      *http.Client
+}
+
+// maxPicks is how many times a worker tries to pick an operation that can be built before it
+// gives up on the iteration.
+const maxPicks = 100
+
+// Run replays the scenario against the target until the duration elapses, the number of requests
+// is sent or the context is done, and reports the latencies of each operation.
+func Run(ctx context.Context, cfg Config) (*Report, error) {
+	switch {
+	case cfg.Target == "":
+		return nil, errors.New("the target must be provided")
+	case cfg.Concurrency < 1:
+		return nil, errors.New("the concurrency must be at least 1")
+	case cfg.Duration <= 0 && cfg.Requests <= 0:
+		return nil, errors.New("either the duration or the number of requests must be provided")
+	case len(cfg.Scenario.Operations) == 0:
+		return nil, errors.New("the scenario has no operations")
+	}
+	for _, op := range cfg.Scenario.Operations {
+		if op.Name == authenticate.Name && (cfg.Email == "" || cfg.Password == "") {
+			return nil, fmt.Errorf(
+				"the %s scenario needs an email and a password",
+				cfg.Scenario.Name,
+			)
+		}
+	}
+	if cfg.Client == nil {
+		cfg.Client = &http.Client{Timeout: 30 * time.Second}
+	}
+	cfg.Target = strings.TrimSuffix(cfg.Target, "/")
+
+	if cfg.Duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cfg.Duration)
+		defer cancel()
+	}
+
+	state := &State{Email: cfg.Email, Password: cfg.Password}
+	recorder := newRecorder()
+
+	// The requests are handed out by a counter, so that the limit is exact across the workers.
+	var (
+		mu   sync.Mutex
+		sent int
+	)
+	next := func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		if ctx.Err() != nil || (cfg.Requests > 0 && sent == cfg.Requests) {
+			return false
+		}
+		sent++
+		return true
+	}
+
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < cfg.Concurrency; i++ {
+		rnd := rand.New(rand.NewSource(cfg.Seed + int64(i)))
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for next() {
+				op, req, ok := pick(cfg.Scenario, state, rnd)
+				if !ok {
+					continue
+				}
+				recorder.record(op.Name, send(ctx, cfg, state, op, req))
+			}
+		}()
+	}
+	wg.Wait()
+
+	return recorder.report(cfg.Scenario.Name, time.Since(start)), nil
+}
+
+// pick picks an operation of the scenario in proportion to the weights, and builds its request.
+func pick(scenario Scenario, state *State, rnd *rand.Rand) (Operation, Request, bool) {
+	total := 0
+	for _, op := range scenario.Operations {
+		total += op.Weight
+	}
+
+	for i := 0; i < maxPicks; i++ {
+		n := rnd.Intn(total)
+		for _, op := range scenario.Operations {
+			if n -= op.Weight; n < 0 {
+				req, ok := op.Build(state, rnd)
+				if ok {
+					return op, req, true
+				}
+				break
+			}
+		}
+	}
+	return Operation{}, Request{}, false
+}
+
+// outcome is the outcome of a request: its latency, and its status code or its error.
+type outcome struct {
+	latency time.Duration
+	status  int
+	err     error
+}
+
+func send(ctx context.Context, cfg Config, state *State, op Operation, req Request) outcome {
+	var body io.Reader
+	if req.Body != nil {
+		js, err := json.Marshal(req.Body)
+		if err != nil {
+			return outcome{err: err}
+		}
+		body = bytes.NewReader(js)
+	}
+
+	r, err := http.NewRequestWithContext(ctx, req.Method, cfg.Target+req.Path, body)
+	if err != nil {
+		return outcome{err: err}
+	}
+	if body != nil {
+		r.Header.Set("Content-Type", "application/json")
+	}
+	token := req.Token
+	if token == "" {
+		token = cfg.Token
+	}
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	start := time.Now()
+	resp, err := cfg.Client.Do(r)
+	if err != nil {
+		// The requests cut short by the end of the run aren't counted.
+		if ctx.Err() != nil {
+			return outcome{err: context.Canceled}
+		}
+		return outcome{latency: time.Since(start), err: err}
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	latency := time.Since(start)
+	if err != nil {
+		return outcome{latency: latency, err: err}
+	}
+	if op.Handle != nil {
+		op.Handle(state, resp.StatusCode, respBody)
+	}
+
+	return outcome{latency: latency, status: resp.StatusCode}
+}
+
+// recorder collects the outcomes of the requests, by operation.
+type recorder struct {
+	mu         sync.Mutex
+	operations map[string]*operationOutcomes
+}
+
+type operationOutcomes struct {
+	latencies []time.Duration
+	statuses  map[int]int
+	errors    int
+}
+
+func newRecorder() *recorder {
+	return &recorder{operations: make(map[string]*operationOutcomes)}
+}
+
+func (r *recorder) record(operation string, o outcome) {
+	if errors.Is(o.err, context.Canceled) {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	outcomes, ok := r.operations[operation]
+	if !ok {
+		outcomes = &operationOutcomes{statuses: make(map[int]int)}
+		r.operations[operation] = outcomes
+	}
+	outcomes.latencies = append(outcomes.latencies, o.latency)
+	if o.err != nil {
+		outcomes.errors++
+	} else {
+		outcomes.statuses[o.status]++
+	}
+}
+
+// Report holds the results of a run.
+type Report struct {
+	Scenario   string            `json:"scenario"`
+	Elapsed    time.Duration     `json:"elapsed"`
+	Requests   int               `json:"requests"`
+	Throughput float64           `json:"throughput"` // requests per second
+	Operations []OperationReport `json:"operations"`
+}
+
+// OperationReport holds the results of an operation's requests.
+type OperationReport struct {
+	Name     string        `json:"name"`
+	Requests int           `json:"requests"`
+	Errors   int           `json:"errors"` // the transport errors and the 5xx responses
+	Statuses map[int]int   `json:"statuses"`
+	P50      time.Duration `json:"p50"`
+	P90      time.Duration `json:"p90"`
+	P95      time.Duration `json:"p95"`
+	P99      time.Duration `json:"p99"`
+	Max      time.Duration `json:"max"`
+}
+
+func (r *recorder) report(scenario string, elapsed time.Duration) *Report {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	report := &Report{Scenario: scenario, Elapsed: elapsed}
+	for name, outcomes := range r.operations {
+		latencies := outcomes.latencies
+		sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+
+		op := OperationReport{
+			Name:     name,
+			Requests: len(latencies),
+			Errors:   outcomes.errors,
+			Statuses: outcomes.statuses,
+			P50:      Percentile(latencies, 50),
+			P90:      Percentile(latencies, 90),
+			P95:      Percentile(latencies, 95),
+			P99:      Percentile(latencies, 99),
+			Max:      latencies[len(latencies)-1],
+		}
+		for status, count := range outcomes.statuses {
+			if status >= http.StatusInternalServerError {
+				op.Errors += count
+			}
+		}
+
+		report.Requests += op.Requests
+		report.Operations = append(report.Operations, op)
+	}
+	sort.Slice(report.Operations, func(i, j int) bool {
+		return report.Operations[i].Name < report.Operations[j].Name
+	})
+	if elapsed > 0 {
+		report.Throughput = float64(report.Requests) / elapsed.Seconds()
+	}
+
+	return report
+}
+
+// Percentile returns the pth percentile of the sorted latencies, by the nearest-rank method. It
+// returns zero if there are no latencies.
+func Percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p/100*float64(len(sorted)))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	return sorted[rank]
+}
+
+// WriteTo writes the report as a table, one row per operation.
+func (r *Report) WriteTo(w io.Writer) (int64, error) {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "scenario %s: %d requests in %s (%.1f req/s)\n\n",
+		r.Scenario, r.Requests, r.Elapsed.Round(time.Millisecond), r.Throughput)
+
+	tw := tabwriter.NewWriter(&buf, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "OPERATION\tREQUESTS\tERRORS\tP50\tP90\tP95\tP99\tMAX\tSTATUSES")
+	for _, op := range r.Operations {
+		statuses := make([]int, 0, len(op.Statuses))
+		for status := range op.Statuses {
+			statuses = append(statuses, status)
+		}
+		sort.Ints(statuses)
+		counts := make([]string, len(statuses))
+		for i, status := range statuses {
+			counts[i] = fmt.Sprintf("%d:%d", status, op.Statuses[status])
+		}
+
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			op.Name, op.Requests, op.Errors,
+			round(op.P50), round(op.P90), round(op.P95), round(op.P99), round(op.Max),
+			strings.Join(counts, " "))
+	}
+	tw.Flush()
+
+	n, err := w.Write(buf.Bytes())
+	return int64(n), err
+}
+
+func round(d time.Duration) time.Duration {
+	return d.Round(10 * time.Microsecond)
+}
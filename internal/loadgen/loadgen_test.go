@@ -0,0 +1,102 @@
+package loadgen
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPercentile(t *testing.T) {
+	var latencies []time.Duration
+	for i := 1; i <= 100; i++ {
+		latencies = append(latencies, time.Duration(i)*time.Millisecond)
+	}
+
+	assert.Equal(t, 50*time.Millisecond, Percentile(latencies, 50))
+	assert.Equal(t, 99*time.Millisecond, Percentile(latencies, 99))
+	assert.Equal(t, 100*time.Millisecond, Percentile(latencies, 100))
+	assert.Equal(t, time.Millisecond, Percentile(latencies, 0))
+	assert.Equal(t, 3*time.Millisecond, Percentile(latencies[:3], 90))
+	assert.Zero(t, Percentile(nil, 50))
+}
+
+func TestRun(t *testing.T) {
+	var ids, tokens atomic.Int64
+	var authorized atomic.Int64
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.Header.Get("Authorization"), "Bearer ") {
+			authorized.Add(1)
+		}
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/v1/movies":
+			w.WriteHeader(http.StatusCreated)
+			fmt.Fprintf(w, `{"movie": {"id": %d}}`, ids.Add(1))
+		case r.Method == http.MethodPost && r.URL.Path == "/v1/tokens/authentication":
+			w.WriteHeader(http.StatusCreated)
+			fmt.Fprintf(w, `{"authentication_token": {"token": "T%d"}}`, tokens.Add(1))
+		case r.Method == http.MethodDelete:
+			w.WriteHeader(http.StatusInternalServerError)
+		default:
+			fmt.Fprint(w, `{}`)
+		}
+	}))
+	defer api.Close()
+
+	report, err := Run(context.Background(), Config{
+		Target:      api.URL,
+		Scenario:    Scenarios["write-heavy"],
+		Concurrency: 4,
+		Duration:    time.Minute,
+		Requests:    200,
+		Token:       "token",
+		Seed:        1,
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, 200, report.Requests)
+	assert.Equal(t, int64(200), authorized.Load())
+	requests := make(map[string]OperationReport)
+	for _, op := range report.Operations {
+		requests[op.Name] = op
+		assert.LessOrEqual(t, op.P50, op.P99)
+		assert.LessOrEqual(t, op.P99, op.Max)
+	}
+	assert.Equal(t, int(ids.Load()), requests["create movie"].Requests)
+	assert.Equal(t, requests["update movie"].Requests, requests["update movie"].Statuses[200])
+	assert.Equal(t, requests["delete movie"].Requests, requests["delete movie"].Errors)
+
+	var buf bytes.Buffer
+	_, err = report.WriteTo(&buf)
+	require.NoError(t, err)
+	assert.Contains(t, buf.String(), "scenario write-heavy: 200 requests")
+	assert.Contains(t, buf.String(), "create movie")
+
+	// The logins issue the tokens of the other requests.
+	report, err = Run(context.Background(), Config{
+		Target:      api.URL,
+		Scenario:    Scenarios["auth-churn"],
+		Concurrency: 2,
+		Requests:    50,
+		Email:       "alice@example.com",
+		Password:    "pa55word",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 50, report.Requests)
+
+	_, err = Run(context.Background(), Config{
+		Target:      api.URL,
+		Scenario:    Scenarios["auth-churn"],
+		Concurrency: 1,
+		Requests:    1,
+	})
+	assert.EqualError(t, err, "the auth-churn scenario needs an email and a password")
+}
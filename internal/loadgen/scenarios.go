@@ -0,0 +1,227 @@
+package loadgen
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"sync"
+)
+
+// Operation is a kind of request of a scenario, which is picked in proportion to its weight.
+type Operation struct {
+	Name   string
+	Weight int
+	// Build returns the request to send. It returns ok false if it can't be built yet, e.g. an
+	// update before any movie was created, in which case another operation is picked.
+	Build func(s *State, rnd *rand.Rand) (req Request, ok bool)
+	// Handle, if set, records what the successful responses return, e.g. the created movies' IDs.
+	Handle func(s *State, status int, body []byte)
+}
+
+// Request is a request of an operation.
+type Request struct {
+	Method string
+	Path   string
+	Body   any    // encoded as JSON, unless it's nil
+	Token  string // the bearer token, or empty for the run's token
+}
+
+// Scenario is a mix of operations, replayed by the workers.
+type Scenario struct {
+	Name        string
+	Description string
+	Operations  []Operation
+}
+
+// State is what the workers of a run share: the movies created so far and the tokens issued.
+type State struct {
+	Email    string
+	Password string
+
+	mu       sync.Mutex
+	movieIDs []int64
+	tokens   []string
+}
+
+// maxTracked bounds how many movie IDs and tokens the state keeps, replacing the oldest ones.
+const maxTracked = 1000
+
+func (s *State) addMovie(id int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.movieIDs = track(s.movieIDs, id)
+}
+
+func (s *State) removeMovie(id int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, movieID := range s.movieIDs {
+		if movieID == id {
+			s.movieIDs = append(s.movieIDs[:i], s.movieIDs[i+1:]...)
+			return
+		}
+	}
+}
+
+func (s *State) randomMovie(rnd *rand.Rand) (int64, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.movieIDs) == 0 {
+		return 0, false
+	}
+	return s.movieIDs[rnd.Intn(len(s.movieIDs))], true
+}
+
+func (s *State) addToken(token string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tokens = track(s.tokens, token)
+}
+
+func (s *State) randomToken(rnd *rand.Rand) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.tokens) == 0 {
+		return "", false
+	}
+	return s.tokens[rnd.Intn(len(s.tokens))], true
+}
+
+func track[T any](values []T, v T) []T {
+	if len(values) == maxTracked {
+		values = values[1:]
+	}
+	return append(values, v)
+}
+
+// The operations the scenarios are made of.
+var (
+	listMovies = Operation{
+		Name: "list movies",
+		Build: func(s *State, rnd *rand.Rand) (Request, bool) {
+			path := fmt.Sprintf("/v1/movies?page=%d&page_size=20", 1+rnd.Intn(5))
+			return Request{Method: http.MethodGet, Path: path}, true
+		},
+	}
+	showMovie = Operation{
+		Name: "show movie",
+		Build: func(s *State, rnd *rand.Rand) (Request, bool) {
+			id, ok := s.randomMovie(rnd)
+			return Request{Method: http.MethodGet, Path: fmt.Sprintf("/v1/movies/%d", id)}, ok
+		},
+	}
+	createMovie = Operation{
+		Name: "create movie",
+		Build: func(s *State, rnd *rand.Rand) (Request, bool) {
+			return Request{
+				Method: http.MethodPost,
+				Path:   "/v1/movies",
+				Body: map[string]any{
+					"title":   fmt.Sprintf("Load test %d", rnd.Int63()),
+					"year":    1950 + rnd.Intn(75),
+					"runtime": fmt.Sprintf("%d mins", 80+rnd.Intn(100)),
+					"genres":  []string{genres[rnd.Intn(len(genres))]},
+				},
+			}, true
+		},
+		Handle: func(s *State, status int, body []byte) {
+			var response struct {
+				Movie struct {
+					ID int64 `json:"id"`
+				} `json:"movie"`
+			}
+			if status == http.StatusCreated && json.Unmarshal(body, &response) == nil {
+				s.addMovie(response.Movie.ID)
+			}
+		},
+	}
+	updateMovie = Operation{
+		Name: "update movie",
+		Build: func(s *State, rnd *rand.Rand) (Request, bool) {
+			id, ok := s.randomMovie(rnd)
+			return Request{
+				Method: http.MethodPatch,
+				Path:   fmt.Sprintf("/v1/movies/%d", id),
+				Body:   map[string]any{"year": 1950 + rnd.Intn(75)},
+			}, ok
+		},
+	}
+	deleteMovie = Operation{
+		Name: "delete movie",
+		Build: func(s *State, rnd *rand.Rand) (Request, bool) {
+			id, ok := s.randomMovie(rnd)
+			if ok {
+				// The movie is forgotten right away, so that the other workers stop picking it.
+				s.removeMovie(id)
+			}
+			return Request{Method: http.MethodDelete, Path: fmt.Sprintf("/v1/movies/%d", id)}, ok
+		},
+	}
+	authenticate = Operation{
+		Name: "authenticate",
+		Build: func(s *State, rnd *rand.Rand) (Request, bool) {
+			return Request{
+				Method: http.MethodPost,
+				Path:   "/v1/tokens/authentication",
+				Body:   map[string]string{"email": s.Email, "password": s.Password},
+			}, s.Email != ""
+		},
+		Handle: func(s *State, status int, body []byte) {
+			var response struct {
+				Token struct {
+					Token string `json:"token"`
+				} `json:"authentication_token"`
+			}
+			if status == http.StatusCreated && json.Unmarshal(body, &response) == nil {
+				s.addToken(response.Token.Token)
+			}
+		},
+	}
+	listWithNewToken = Operation{
+		Name: "list movies (new token)",
+		Build: func(s *State, rnd *rand.Rand) (Request, bool) {
+			token, ok := s.randomToken(rnd)
+			return Request{Method: http.MethodGet, Path: "/v1/movies", Token: token}, ok
+		},
+	}
+)
+
+var genres = []string{"action", "adventure", "animation", "comedy", "drama", "horror", "sci-fi"}
+
+func weighted(op Operation, weight int) Operation {
+	op.Weight = weight
+	return op
+}
+
+// Scenarios holds the traffic mixes, by name.
+var Scenarios = map[string]Scenario{
+	"list-heavy": {
+		Name:        "list-heavy",
+		Description: "mostly listings and reads, with a trickle of writes",
+		Operations: []Operation{
+			weighted(listMovies, 75),
+			weighted(showMovie, 20),
+			weighted(createMovie, 5),
+		},
+	},
+	"write-heavy": {
+		Name:        "write-heavy",
+		Description: "mostly creates and updates, with some reads and deletes",
+		Operations: []Operation{
+			weighted(listMovies, 15),
+			weighted(showMovie, 20),
+			weighted(createMovie, 35),
+			weighted(updateMovie, 25),
+			weighted(deleteMovie, 5),
+		},
+	},
+	"auth-churn": {
+		Name:        "auth-churn",
+		Description: "logins, and requests with the tokens they issue (needs the credentials)",
+		Operations: []Operation{
+			weighted(authenticate, 40),
+			weighted(listWithNewToken, 60),
+		},
+	},
+}
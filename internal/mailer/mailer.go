@@ -3,6 +3,10 @@ package mailer
 import (
 	"bytes"
 	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
 	"text/template"
 	"time"
 
@@ -12,29 +16,144 @@ import (
 //go:embed "templates"
 var templateFS embed.FS
 
+// Branding holds the values that the templates can refer to with the brandName, supportEmail and
+// frontendURL functions, e.g. {{ brandName }}. The empty ones are left out of the emails.
+type Branding struct {
+	Name         string
+	SupportEmail string
+	FrontendURL  string
+}
+
 // Mailer holds a mail.Dialer instance (used to connect to a SMTP server) and the sender information
 // for your emails (the name and address you want the email to be from, such as "Peng-Yu Chen
 // <me@pengyuc.com>")>
+//
+// The copies of a Mailer share its pool of connections.
 type Mailer struct {
-	dialer *mail.Dialer
-	sender string
+	dialer    *mail.Dialer
+	pool      *pool
+	sender    string
+	templates fs.FS
+	branding  Branding
 }
 
-// New returns a Mailer instance containing the dialer and sender information.
+// New returns a Mailer instance containing the dialer and sender information. It sends the
+// embedded templates, with the Greenlight branding, and keeps up to two connections open for 30
+// seconds between the emails.
 func New(host string, port int, username, password, sender string) Mailer {
 	dialer := mail.NewDialer(host, port, username, password)
 	dialer.Timeout = 5 * time.Second
+
+	templates, err := fs.Sub(templateFS, "templates")
+	if err != nil {
+		panic(err)
+	}
+
 	return Mailer{
-		dialer: dialer,
-		sender: sender,
+		dialer:    dialer,
+		pool:      newPool(dialer.Dial, 2, 30*time.Second),
+		sender:    sender,
+		templates: templates,
+		branding:  Branding{Name: "Greenlight"},
+	}
+}
+
+// WithPool returns a copy of the mailer that keeps up to maxIdle connections open, for up to
+// idleTimeout between the emails. A maxIdle of zero opens a new connection for every email.
+func (m Mailer) WithPool(maxIdle int, idleTimeout time.Duration) Mailer {
+	m.pool = newPool(m.dialer.Dial, maxIdle, idleTimeout)
+	return m
+}
+
+// Close closes the mailer's idle connections.
+func (m Mailer) Close() error {
+	return m.pool.close()
+}
+
+// Health returns whether the mailer could connect to the SMTP server the last time it tried.
+func (m Mailer) Health() Health {
+	return m.pool.status()
+}
+
+// Stats returns the counters of the emails sent by the mailer.
+func (m Mailer) Stats() Stats {
+	return m.pool.stats()
+}
+
+// WithBranding returns a copy of the mailer whose templates use the branding.
+func (m Mailer) WithBranding(branding Branding) Mailer {
+	m.branding = branding
+	return m
+}
+
+// WithTemplateDir returns a copy of the mailer whose templates are read from the directory, or
+// from the embedded ones if the directory doesn't have them. The templates are read again for
+// every email, so they can be edited without a restart. Every template is checked up front,
+// so that a broken one is reported at startup rather than when the email is sent.
+func (m Mailer) WithTemplateDir(dir string) (Mailer, error) {
+	m.templates = overlayFS{top: os.DirFS(dir), bottom: m.templates}
+
+	err := m.Validate()
+	if err != nil {
+		return Mailer{}, err
+	}
+	return m, nil
+}
+
+// Validate checks that each of the embedded templates (or the template that shadows it) parses,
+// and defines the subject, plainBody and htmlBody templates.
+func (m Mailer) Validate() error {
+	entries, err := fs.ReadDir(templateFS, "templates")
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		tmpl, err := m.parse(entry.Name())
+		if err != nil {
+			return err
+		}
+
+		for _, name := range []string{"subject", "plainBody", "htmlBody"} {
+			if tmpl.Lookup(name) == nil {
+				return fmt.Errorf("mailer: %s doesn't define the %q template", entry.Name(), name)
+			}
+		}
+	}
+
+	return nil
+}
+
+// parse parses the template file, with the branding functions.
+func (m Mailer) parse(templateFile string) (*template.Template, error) {
+	funcs := template.FuncMap{
+		"brandName":    func() string { return m.branding.Name },
+		"supportEmail": func() string { return m.branding.SupportEmail },
+		"frontendURL":  func() string { return m.branding.FrontendURL },
+	}
+
+	return template.New("email").Funcs(funcs).ParseFS(m.templates, templateFile)
+}
+
+// overlayFS opens the files from the top file system, or from the bottom one if the top one
+// doesn't have them.
+type overlayFS struct {
+	top, bottom fs.FS
+}
+
+func (o overlayFS) Open(name string) (fs.File, error) {
+	f, err := o.top.Open(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return o.bottom.Open(name)
 	}
+	return f, err
 }
 
 // Send takes the recipient email address, the name of the file containing the templates, and any
 // dynamic data for the templates as an any parameter.
 func (m Mailer) Send(recipient, templateFile string, data any) error {
-	// Use ParseFS() to marse the required template file from the embedded file system.
-	tmpl, err := template.New("email").ParseFS(templateFS, "templates/"+templateFile)
+	// Parse the required template file from the template file system.
+	tmpl, err := m.parse(templateFile)
 	if err != nil {
 		return err
 	}
@@ -69,8 +188,7 @@ func (m Mailer) Send(recipient, templateFile string, data any) error {
 	msg.SetBody("text/plain", plainBody.String())
 	msg.AddAlternative("text/html", htmlBody.String())
 
-	// Call DialAndSend() on the dialer, passing in the message to send. This opens a connection to
-	// the SMTP server, sends the message, then closes the connection. If there's a timeout, it'll
-	// return a "dial tcp: i/o timeout" error.
-	return m.dialer.DialAndSend(msg)
+	// Send the message over one of the pooled connections, or a new one if they're all in use. If
+	// there's a timeout, it'll return a "dial tcp: i/o timeout" error.
+	return m.pool.send(msg)
 }
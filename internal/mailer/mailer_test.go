@@ -0,0 +1,53 @@
+package mailer
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMailerTemplates(t *testing.T) {
+	m := New("localhost", 25, "", "", "Greenlight <no-reply@example.com>")
+	assert.Nil(t, m.Validate())
+
+	dir := t.TempDir()
+	welcome := `{{ define "subject" }}Welcome to {{ brandName }}, user {{ .userID }}{{ end }}
+{{ define "plainBody" }}Write to {{ supportEmail }}{{ end }}
+{{ define "htmlBody" }}<a href="{{ frontendURL }}">{{ brandName }}</a>{{ end }}`
+	err := os.WriteFile(filepath.Join(dir, "user_welcome.tmpl"), []byte(welcome), 0o644)
+	assert.Nil(t, err)
+
+	m, err = m.WithBranding(Branding{
+		Name:         "Acme",
+		SupportEmail: "help@acme.example",
+		FrontendURL:  "https://acme.example",
+	}).WithTemplateDir(dir)
+	assert.Nil(t, err)
+
+	// The overridden template is read from the directory, and the others still come from the
+	// embedded ones.
+	tmpl, err := m.parse("user_welcome.tmpl")
+	assert.Nil(t, err)
+	subject := new(bytes.Buffer)
+	assert.Nil(t, tmpl.ExecuteTemplate(subject, "subject", map[string]any{"userID": 7}))
+	assert.Equal(t, "Welcome to Acme, user 7", subject.String())
+
+	tmpl, err = m.parse("movie_added.tmpl")
+	assert.Nil(t, err)
+	assert.NotNil(t, tmpl.Lookup("htmlBody"))
+
+	// A template that doesn't parse, or that lacks one of the parts, is rejected.
+	for _, broken := range []string{
+		`{{ define "subject" }}{{ .name {{ end }}`,
+		`{{ define "subject" }}Hi{{ end }}{{ define "plainBody" }}Hi{{ end }}`,
+	} {
+		err := os.WriteFile(filepath.Join(dir, "movie_added.tmpl"), []byte(broken), 0o644)
+		assert.Nil(t, err)
+
+		_, err = New("localhost", 25, "", "", "").WithTemplateDir(dir)
+		assert.NotNil(t, err)
+	}
+}
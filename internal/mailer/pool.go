@@ -0,0 +1,224 @@
+package mailer
+
+import (
+	"errors"
+	"net/textproto"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-mail/mail/v2"
+)
+
+// healthCheckInterval is how long the mailer's health is reported from the last connection to the
+// SMTP server before it's checked again.
+const healthCheckInterval = 30 * time.Second
+
+// Stats holds the counters of the emails sent by the mailer, and of its connections.
+type Stats struct {
+	Sent    int64 `json:"sent"`
+	Failed  int64 `json:"failed"`
+	Retried int64 `json:"retried"`
+	Dials   int64 `json:"dials"`
+	Idle    int   `json:"idle"`
+}
+
+// Health reports whether the mailer could connect to the SMTP server the last time it tried. It's
+// "unknown" until the first connection.
+type Health struct {
+	Status    string     `json:"status"`
+	Error     string     `json:"error,omitempty"`
+	CheckedAt *time.Time `json:"checked_at,omitempty"`
+}
+
+// pool keeps the SMTP connections open between the emails, so that sending an email doesn't cost a
+// TCP and TLS handshake and an authentication every time. Up to maxIdle connections are kept, and
+// the ones idle for longer than idleTimeout are closed rather than reused, since the SMTP servers
+// drop them after a while.
+type pool struct {
+	dial        func() (mail.SendCloser, error)
+	maxIdle     int
+	idleTimeout time.Duration
+
+	mtx  sync.Mutex
+	idle []idleConn // the most recently used last
+
+	sent    atomic.Int64
+	failed  atomic.Int64
+	retried atomic.Int64
+	dials   atomic.Int64
+
+	healthMtx sync.Mutex
+	health    Health
+	checking  atomic.Bool
+}
+
+type idleConn struct {
+	sender mail.SendCloser
+	since  time.Time
+}
+
+func newPool(dial func() (mail.SendCloser, error), maxIdle int, idleTimeout time.Duration) *pool {
+	return &pool{
+		dial:        dial,
+		maxIdle:     maxIdle,
+		idleTimeout: idleTimeout,
+		health:      Health{Status: "unknown"},
+	}
+}
+
+// get returns an idle connection, or a new one if there's none, and whether it was reused.
+func (p *pool) get() (mail.SendCloser, bool, error) {
+	p.mtx.Lock()
+	for len(p.idle) > 0 {
+		conn := p.idle[len(p.idle)-1]
+		p.idle = p.idle[:len(p.idle)-1]
+
+		if time.Since(conn.since) < p.idleTimeout {
+			p.mtx.Unlock()
+			return conn.sender, true, nil
+		}
+		conn.sender.Close()
+	}
+	p.mtx.Unlock()
+
+	sender, err := p.connect()
+	return sender, false, err
+}
+
+// connect opens a new connection, and records the outcome as the mailer's health.
+func (p *pool) connect() (mail.SendCloser, error) {
+	p.dials.Add(1)
+	sender, err := p.dial()
+	p.setHealth(err)
+	return sender, err
+}
+
+// put returns the connection to the pool, or closes it if the pool is full.
+func (p *pool) put(sender mail.SendCloser) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	if len(p.idle) >= p.maxIdle {
+		sender.Close()
+		return
+	}
+	p.idle = append(p.idle, idleConn{sender: sender, since: time.Now()})
+}
+
+// send sends the message over a pooled connection. If a reused connection fails, which is usually
+// because the server dropped it, the message is sent again over a new one, unless the server
+// rejected the message itself.
+func (p *pool) send(msg *mail.Message) error {
+	sender, reused, err := p.get()
+	if err == nil {
+		err = mail.Send(sender, msg)
+		if err != nil && reused && retryable(err) {
+			sender.Close()
+			p.retried.Add(1)
+
+			sender, err = p.connect()
+			if err == nil {
+				err = mail.Send(sender, msg)
+			}
+		}
+	}
+
+	if err != nil {
+		if sender != nil {
+			sender.Close()
+		}
+		p.failed.Add(1)
+		return err
+	}
+
+	p.put(sender)
+	p.sent.Add(1)
+	p.setHealth(nil)
+	return nil
+}
+
+// retryable reports whether the error is from the connection rather than a reply of the server,
+// except for the 421 reply, which the servers send before closing an idle connection.
+func retryable(err error) bool {
+	var sendErr *mail.SendError
+	if errors.As(err, &sendErr) {
+		err = sendErr.Cause
+	}
+
+	var protoErr *textproto.Error
+	if errors.As(err, &protoErr) {
+		return protoErr.Code == 421
+	}
+	return true
+}
+
+// close closes the idle connections.
+func (p *pool) close() error {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	var err error
+	for _, conn := range p.idle {
+		if cerr := conn.sender.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	p.idle = nil
+	return err
+}
+
+func (p *pool) setHealth(err error) {
+	now := time.Now()
+	health := Health{Status: "ok", CheckedAt: &now}
+	if err != nil {
+		health.Status = "unavailable"
+		health.Error = err.Error()
+	}
+
+	p.healthMtx.Lock()
+	p.health = health
+	p.healthMtx.Unlock()
+}
+
+// status returns the mailer's last known health. If it's older than the health check interval, a
+// connection is opened in the background to refresh it, so that the callers aren't held up by a
+// slow SMTP server. An idle connection counts as a successful check, since it was used recently.
+func (p *pool) status() Health {
+	p.healthMtx.Lock()
+	health := p.health
+	p.healthMtx.Unlock()
+
+	stale := health.CheckedAt == nil || time.Since(*health.CheckedAt) > healthCheckInterval
+	if stale && p.checking.CompareAndSwap(false, true) {
+		go func() {
+			defer p.checking.Store(false)
+
+			sender, reused, err := p.get()
+			if err != nil {
+				return
+			}
+			if reused {
+				p.setHealth(nil)
+			}
+			p.put(sender)
+		}()
+	}
+
+	return health
+}
+
+// stats returns the pool's counters.
+func (p *pool) stats() Stats {
+	p.mtx.Lock()
+	idle := len(p.idle)
+	p.mtx.Unlock()
+
+	return Stats{
+		Sent:    p.sent.Load(),
+		Failed:  p.failed.Load(),
+		Retried: p.retried.Load(),
+		Dials:   p.dials.Load(),
+		Idle:    idle,
+	}
+}
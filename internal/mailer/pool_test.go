@@ -0,0 +1,90 @@
+package mailer
+
+import (
+	"errors"
+	"io"
+	"net/textproto"
+	"testing"
+	"time"
+
+	"github.com/go-mail/mail/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeSender struct {
+	errs   []error // returned by the successive sends
+	sent   int
+	closed bool
+}
+
+func (s *fakeSender) Send(from string, to []string, msg io.WriterTo) error {
+	s.sent++
+	if len(s.errs) > 0 {
+		err := s.errs[0]
+		s.errs = s.errs[1:]
+		return err
+	}
+	return nil
+}
+
+func (s *fakeSender) Close() error {
+	s.closed = true
+	return nil
+}
+
+func TestPool(t *testing.T) {
+	var senders []*fakeSender
+	var dialErr error
+	dial := func() (mail.SendCloser, error) {
+		if dialErr != nil {
+			return nil, dialErr
+		}
+		s := &fakeSender{}
+		senders = append(senders, s)
+		return s, nil
+	}
+
+	msg := mail.NewMessage()
+	msg.SetHeader("From", "no-reply@example.com")
+	msg.SetHeader("To", "alice@example.com")
+
+	p := newPool(dial, 1, time.Minute)
+	assert.Equal(t, "unknown", p.health.Status)
+
+	// The connection is reused for the second email.
+	assert.Nil(t, p.send(msg))
+	assert.Nil(t, p.send(msg))
+	assert.Len(t, senders, 1)
+	assert.Equal(t, 2, senders[0].sent)
+	assert.Equal(t, "ok", p.status().Status)
+
+	// A dropped connection is replaced, and the email sent again.
+	senders[0].errs = []error{io.EOF}
+	assert.Nil(t, p.send(msg))
+	assert.Len(t, senders, 2)
+	assert.True(t, senders[0].closed)
+
+	// A rejected email isn't sent again.
+	senders[1].errs = []error{&textproto.Error{Code: 550, Msg: "mailbox unavailable"}}
+	assert.NotNil(t, p.send(msg))
+	assert.Len(t, senders, 2)
+	assert.True(t, senders[1].closed)
+
+	// A failed connection makes the mailer unavailable.
+	dialErr = errors.New("connection refused")
+	assert.NotNil(t, p.send(msg))
+	assert.Equal(t, "unavailable", p.status().Status)
+	assert.Equal(t, "connection refused", p.status().Error)
+
+	assert.Equal(t, Stats{Sent: 3, Failed: 2, Retried: 1, Dials: 3}, p.stats())
+
+	// The connections idle for longer than the timeout aren't reused.
+	dialErr = nil
+	p = newPool(dial, 1, time.Nanosecond)
+	assert.Nil(t, p.send(msg))
+	time.Sleep(time.Millisecond)
+	assert.Nil(t, p.send(msg))
+	assert.True(t, senders[len(senders)-2].closed)
+	assert.Nil(t, p.close())
+	assert.True(t, senders[len(senders)-1].closed)
+}
@@ -0,0 +1,116 @@
+package metrics
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// DefaultLatencyBuckets are the upper bounds, in seconds, of the buckets used for request
+// durations.
+var DefaultLatencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Histogram counts observations into buckets with fixed upper bounds. It's safe for concurrent
+// use.
+type Histogram struct {
+	bounds []float64
+
+	mtx    sync.Mutex
+	counts []int64 // counts[i] is the number of observations in (bounds[i-1], bounds[i]]
+	count  int64
+	sum    float64
+}
+
+// HistogramSnapshot holds the values of a histogram at a point in time. The buckets are
+// cumulative and keyed by their upper bound, with "+Inf" holding every observation.
+type HistogramSnapshot struct {
+	Count   int64            `json:"count"`
+	Sum     float64          `json:"sum"`
+	Buckets map[string]int64 `json:"buckets"`
+}
+
+// NewHistogram returns a Histogram with the given bucket upper bounds.
+func NewHistogram(bounds []float64) *Histogram {
+	b := append([]float64(nil), bounds...)
+	sort.Float64s(b)
+
+	return &Histogram{
+		bounds: b,
+		counts: make([]int64, len(b)+1),
+	}
+}
+
+// Observe adds a single observation to the histogram.
+func (h *Histogram) Observe(v float64) {
+	i := sort.SearchFloat64s(h.bounds, v)
+
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+
+	h.counts[i]++
+	h.count++
+	h.sum += v
+}
+
+// Snapshot returns the current values of the histogram.
+func (h *Histogram) Snapshot() HistogramSnapshot {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+
+	s := HistogramSnapshot{
+		Count:   h.count,
+		Sum:     h.sum,
+		Buckets: make(map[string]int64, len(h.counts)),
+	}
+
+	var cumulative int64
+	for i, bound := range h.bounds {
+		cumulative += h.counts[i]
+		s.Buckets[strconv.FormatFloat(bound, 'g', -1, 64)] = cumulative
+	}
+	s.Buckets["+Inf"] = h.count
+
+	return s
+}
+
+// Summary tracks the count, sum, minimum and maximum of observations, e.g. payload sizes. It's safe
+// for concurrent use.
+type Summary struct {
+	mtx   sync.Mutex
+	count int64
+	sum   float64
+	min   float64
+	max   float64
+}
+
+// SummarySnapshot holds the values of a summary at a point in time.
+type SummarySnapshot struct {
+	Count int64   `json:"count"`
+	Sum   float64 `json:"sum"`
+	Min   float64 `json:"min"`
+	Max   float64 `json:"max"`
+}
+
+// Observe adds a single observation to the summary.
+func (s *Summary) Observe(v float64) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if s.count == 0 {
+		s.min, s.max = v, v
+	} else {
+		s.min = math.Min(s.min, v)
+		s.max = math.Max(s.max, v)
+	}
+	s.count++
+	s.sum += v
+}
+
+// Snapshot returns the current values of the summary.
+func (s *Summary) Snapshot() SummarySnapshot {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	return SummarySnapshot{Count: s.count, Sum: s.sum, Min: s.min, Max: s.max}
+}
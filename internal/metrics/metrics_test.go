@@ -0,0 +1,35 @@
+package metrics
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHistogram(t *testing.T) {
+	h := NewHistogram([]float64{1, 0.1, 0.5})
+
+	for _, v := range []float64{0.05, 0.1, 0.3, 0.7, 2} {
+		h.Observe(v)
+	}
+
+	s := h.Snapshot()
+	assert.Equal(t, int64(5), s.Count)
+	assert.InDelta(t, 3.15, s.Sum, 1e-9)
+	assert.Equal(t, map[string]int64{
+		"0.1":  2,
+		"0.5":  3,
+		"1":    4,
+		"+Inf": 5,
+	}, s.Buckets)
+}
+
+func TestSummary(t *testing.T) {
+	var s Summary
+	assert.Equal(t, SummarySnapshot{}, s.Snapshot())
+
+	for _, v := range []float64{300, 100, 200} {
+		s.Observe(v)
+	}
+	assert.Equal(t, SummarySnapshot{Count: 3, Sum: 600, Min: 100, Max: 300}, s.Snapshot())
+}
@@ -0,0 +1,60 @@
+package msgpack
+
+import (
+	"encoding/hex"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type runtime int
+
+func (r runtime) MarshalJSON() ([]byte, error) {
+	return []byte(`"107 mins"`), nil
+}
+
+func TestMarshal(t *testing.T) {
+	type embedded struct {
+		ID int64 `json:"id"`
+	}
+
+	tests := []struct {
+		name  string
+		value any
+		want  string // hex
+	}{
+		{"nil", nil, "c0"},
+		{"bool", true, "c3"},
+		{"fixint", 7, "07"},
+		{"negative fixint", -1, "ff"},
+		{"uint16", 1000, "cd03e8"},
+		{"int32", -100000, "d2fffe7960"},
+		{"float64", 1.5, "cb3ff8000000000000"},
+		{"fixstr", "abc", "a3616263"},
+		{"array", []string{"a"}, "91a161"},
+		{"map", map[string]int{"b": 2, "a": 1}, "82a16101a16202"},
+		{"timestamp32", time.Unix(1640995200, 0), "d6ff61cf9980"},
+		{"json marshaler", runtime(107), "a8313037206d696e73"},
+		{
+			"struct",
+			struct {
+				embedded
+				Title   string `json:"title"`
+				Year    int    `json:"year,omitempty"`
+				Secret  string `json:"-"`
+				private int
+			}{embedded: embedded{ID: 1}, Title: "x", Secret: "s"},
+			"82a2696401a57469746c65a178",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			b, err := Marshal(test.value)
+			require.NoError(t, err)
+			assert.Equal(t, test.want, hex.EncodeToString(b))
+		})
+	}
+}
@@ -0,0 +1,147 @@
+package ratelimit
+
+import (
+	"container/list"
+	"hash/fnv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// shardCount is the number of shards the clients are spread over. Each shard has its own mutex, so
+// concurrent requests from different clients rarely contend for the same lock.
+const shardCount = 32
+
+// Stats holds the counters exposed by the metrics endpoint.
+type Stats struct {
+	Clients     int   `json:"clients"`
+	Evictions   int64 `json:"evictions"`
+	Expirations int64 `json:"expirations"`
+}
+
+// Store holds a token-bucket rate limiter for each client key (usually an IP address). The number
+// of clients is bounded: once a shard is full, the least recently seen client in that shard is
+// evicted to make room for the new one, so a flood of unique IP addresses can't grow the map
+// without limit.
+type Store struct {
+	rps    rate.Limit
+	burst  int
+	shards [shardCount]*shard
+
+	evictions   atomic.Int64
+	expirations atomic.Int64
+}
+
+type shard struct {
+	mtx     sync.Mutex
+	clients map[string]*list.Element
+	lru     *list.List // the front holds the most recently seen client
+	max     int
+}
+
+type client struct {
+	key      string
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// New returns a Store which allows an average of rps requests per second, with a maximum of burst
+// requests in a single 'burst', for each of up to maxClients clients.
+func New(rps float64, burst, maxClients int) *Store {
+	perShard := maxClients / shardCount
+	if perShard < 1 {
+		perShard = 1
+	}
+
+	s := &Store{
+		rps:   rate.Limit(rps),
+		burst: burst,
+	}
+	for i := range s.shards {
+		s.shards[i] = &shard{
+			clients: make(map[string]*list.Element),
+			lru:     list.New(),
+			max:     perShard,
+		}
+	}
+	return s
+}
+
+// shardFor returns the shard that holds the client key.
+func (s *Store) shardFor(key string) *shard {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return s.shards[h.Sum32()%shardCount]
+}
+
+// Allow reports whether the client may make a request now, consuming a token if so.
+func (s *Store) Allow(key string) bool {
+	sh := s.shardFor(key)
+
+	sh.mtx.Lock()
+	defer sh.mtx.Unlock()
+
+	now := time.Now()
+
+	if elem, found := sh.clients[key]; found {
+		c := elem.Value.(*client)
+		c.lastSeen = now
+		sh.lru.MoveToFront(elem)
+		return c.limiter.AllowN(now, 1)
+	}
+
+	// Make room for the new client by evicting the least recently seen one.
+	if sh.lru.Len() >= sh.max {
+		oldest := sh.lru.Back()
+		sh.lru.Remove(oldest)
+		delete(sh.clients, oldest.Value.(*client).key)
+		s.evictions.Add(1)
+	}
+
+	c := &client{
+		key:      key,
+		limiter:  rate.NewLimiter(s.rps, s.burst),
+		lastSeen: now,
+	}
+	sh.clients[key] = sh.lru.PushFront(c)
+	return c.limiter.AllowN(now, 1)
+}
+
+// Cleanup removes the clients that haven't been seen within maxAge.
+func (s *Store) Cleanup(maxAge time.Duration) {
+	cutoff := time.Now().Add(-maxAge)
+
+	for _, sh := range s.shards {
+		sh.mtx.Lock()
+		// Walk from the back of the list, where the least recently seen clients are, and stop at
+		// the first client that's still active.
+		for elem := sh.lru.Back(); elem != nil; elem = sh.lru.Back() {
+			c := elem.Value.(*client)
+			if c.lastSeen.After(cutoff) {
+				break
+			}
+			sh.lru.Remove(elem)
+			delete(sh.clients, c.key)
+			s.expirations.Add(1)
+		}
+		sh.mtx.Unlock()
+	}
+}
+
+// Stats returns the current number of clients along with the eviction counters.
+func (s *Store) Stats() Stats {
+	clients := 0
+	for _, sh := range s.shards {
+		sh.mtx.Lock()
+		clients += sh.lru.Len()
+		sh.mtx.Unlock()
+	}
+
+	return Stats{
+		Clients:     clients,
+		Evictions:   s.evictions.Load(),
+		Expirations: s.expirations.Load(),
+	}
+}
@@ -0,0 +1,45 @@
+package ratelimit
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStore_Allow(t *testing.T) {
+	s := New(1, 2, 100)
+
+	assert.True(t, s.Allow("1.1.1.1"))
+	assert.True(t, s.Allow("1.1.1.1"))
+	assert.False(t, s.Allow("1.1.1.1"), "burst should be exhausted")
+
+	// Other clients have their own limiter.
+	assert.True(t, s.Allow("2.2.2.2"))
+}
+
+func TestStore_Evictions(t *testing.T) {
+	// With fewer clients than shards, each shard holds a single client.
+	s := New(1, 1, 1)
+
+	for i := 0; i < 1000; i++ {
+		s.Allow(fmt.Sprintf("10.0.%d.%d", i/256, i%256))
+	}
+
+	stats := s.Stats()
+	assert.LessOrEqual(t, stats.Clients, shardCount)
+	assert.Equal(t, int64(1000-stats.Clients), stats.Evictions)
+}
+
+func TestStore_Cleanup(t *testing.T) {
+	s := New(1, 1, 100)
+	s.Allow("1.1.1.1")
+	s.Allow("2.2.2.2")
+
+	s.Cleanup(time.Hour)
+	assert.Equal(t, 2, s.Stats().Clients)
+
+	s.Cleanup(0)
+	assert.Equal(t, Stats{Clients: 0, Expirations: 2}, s.Stats())
+}
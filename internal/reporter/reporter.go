@@ -0,0 +1,33 @@
+package reporter
+
+import (
+	"context"
+	"time"
+)
+
+// Event holds the details of an error to report.
+type Event struct {
+	Level      string // "error" or "fatal"
+	Time       time.Time
+	Message    string
+	Properties map[string]string // e.g. request_method, request_url and user_id
+	Trace      string
+}
+
+// Reporter forwards errors to an error tracker such as Sentry.
+type Reporter interface {
+	// Report sends the event. It shouldn't block the caller for long, so implementations are
+	// expected to queue the events and send them in the background.
+	Report(event Event)
+	// Flush waits for the queued events to be sent, or until the context is done.
+	Flush(ctx context.Context) error
+}
+
+// Nop is a Reporter that discards every event.
+type Nop struct{}
+
+// Report discards the event.
+func (Nop) Report(Event) {}
+
+// Flush returns immediately.
+func (Nop) Flush(context.Context) error { return nil }
@@ -0,0 +1,215 @@
+package reporter
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// sentryQueueSize is the number of events that can be waiting to be sent. Events reported while the
+// queue is full are dropped, so that a burst of errors can't pile up goroutines or memory.
+const sentryQueueSize = 100
+
+// Sentry is a Reporter which sends events to Sentry's store endpoint.
+type Sentry struct {
+	endpoint    string
+	auth        string
+	environment string
+	release     string
+	client      *http.Client
+
+	mtx    sync.Mutex
+	queue  chan sentryEvent
+	closed bool
+	wg     sync.WaitGroup
+}
+
+// sentryEvent is the JSON payload of a Sentry event.
+type sentryEvent struct {
+	EventID     string            `json:"event_id"`
+	Timestamp   string            `json:"timestamp"`
+	Level       string            `json:"level"`
+	Logger      string            `json:"logger"`
+	Platform    string            `json:"platform"`
+	Message     string            `json:"message"`
+	Environment string            `json:"environment,omitempty"`
+	Release     string            `json:"release,omitempty"`
+	Fingerprint []string          `json:"fingerprint,omitempty"`
+	Tags        map[string]string `json:"tags,omitempty"`
+	Extra       map[string]string `json:"extra,omitempty"`
+	User        *sentryUser       `json:"user,omitempty"`
+	Request     *sentryRequest    `json:"request,omitempty"`
+}
+
+type sentryUser struct {
+	ID string `json:"id"`
+}
+
+type sentryRequest struct {
+	Method string `json:"method"`
+	URL    string `json:"url"`
+}
+
+// NewSentry returns a Sentry reporter for the DSN, which has the form
+// https://<public key>@<host>/<project ID>. It starts a goroutine that sends the queued events.
+func NewSentry(dsn, environment, release string) (*Sentry, error) {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sentry dsn: %w", err)
+	}
+
+	projectID := strings.Trim(u.Path, "/")
+	if u.User == nil || u.User.Username() == "" || projectID == "" {
+		return nil, errors.New("invalid sentry dsn: must include the public key and project ID")
+	}
+
+	s := &Sentry{
+		endpoint: fmt.Sprintf("%s://%s/api/%s/store/", u.Scheme, u.Host, projectID),
+		auth: fmt.Sprintf(
+			"Sentry sentry_version=7, sentry_client=greenlight/%s, sentry_key=%s",
+			release, u.User.Username(),
+		),
+		environment: environment,
+		release:     release,
+		client:      &http.Client{Timeout: 5 * time.Second},
+		queue:       make(chan sentryEvent, sentryQueueSize),
+	}
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		for event := range s.queue {
+			s.send(event)
+		}
+	}()
+
+	return s, nil
+}
+
+// Report queues the event to be sent. FATAL events, and events reported after Flush, are sent
+// straight away instead, as the application is about to exit.
+func (s *Sentry) Report(event Event) {
+	e := s.newEvent(event)
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if event.Level == "fatal" || s.closed {
+		s.send(e)
+		return
+	}
+
+	select {
+	case s.queue <- e:
+	default:
+		// The queue is full, so drop the event.
+	}
+}
+
+// Flush stops queueing events and waits for the queued ones to be sent, or until the context is
+// done.
+func (s *Sentry) Flush(ctx context.Context) error {
+	s.mtx.Lock()
+	if !s.closed {
+		s.closed = true
+		close(s.queue)
+	}
+	s.mtx.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// newEvent converts the event into a Sentry payload. The request and user properties are mapped to
+// Sentry's own fields so that they're searchable in its UI; the stack trace goes in the extra data.
+func (s *Sentry) newEvent(event Event) sentryEvent {
+	e := sentryEvent{
+		EventID:     newEventID(),
+		Timestamp:   event.Time.UTC().Format(time.RFC3339),
+		Level:       event.Level,
+		Logger:      "greenlight",
+		Platform:    "go",
+		Message:     event.Message,
+		Environment: s.environment,
+		Release:     s.release,
+		Tags:        make(map[string]string),
+		Extra:       make(map[string]string),
+	}
+
+	for key, value := range event.Properties {
+		switch key {
+		case "user_id":
+			e.User = &sentryUser{ID: value}
+		case "request_method", "request_url":
+			if e.Request == nil {
+				e.Request = &sentryRequest{}
+			}
+			if key == "request_method" {
+				e.Request.Method = value
+			} else {
+				e.Request.URL = value
+			}
+		case "fingerprint":
+			// Group the events by our own fingerprint (e.g. of a recovered panic), rather than
+			// by Sentry's guess from the message.
+			e.Fingerprint = []string{value}
+			e.Tags[key] = value
+		default:
+			e.Tags[key] = value
+		}
+	}
+
+	if event.Trace != "" {
+		e.Extra["stacktrace"] = event.Trace
+	}
+
+	return e
+}
+
+// send posts the event to Sentry. Errors are ignored: there's nowhere sensible to report them
+// without ending up in a loop.
+func (s *Sentry) send(event sentryEvent) {
+	js, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+
+	req, err := http.NewRequest(http.MethodPost, s.endpoint, bytes.NewReader(js))
+	if err != nil {
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Sentry-Auth", s.auth)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return
+	}
+	resp.Body.Close()
+}
+
+// newEventID returns a random 32 character hex string, as Sentry expects.
+func newEventID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,67 @@
+package reporter
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewSentry_InvalidDSN(t *testing.T) {
+	for _, dsn := range []string{"https://sentry.example.com/1", "https://key@sentry.example.com"} {
+		_, err := NewSentry(dsn, "test", "v1")
+		assert.Error(t, err, dsn)
+	}
+}
+
+func TestSentry_Report(t *testing.T) {
+	events := make(chan sentryEvent, 1)
+	var path, auth string
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		auth = r.Header.Get("X-Sentry-Auth")
+
+		var e sentryEvent
+		json.NewDecoder(r.Body).Decode(&e)
+		events <- e
+	}))
+	defer ts.Close()
+
+	dsn := strings.Replace(ts.URL, "http://", "http://public@", 1) + "/42"
+	s, err := NewSentry(dsn, "test", "v1")
+	assert.Nil(t, err)
+
+	s.Report(Event{
+		Level:   "error",
+		Time:    time.Now(),
+		Message: "boom",
+		Properties: map[string]string{
+			"request_method": http.MethodGet,
+			"request_url":    "/v1/movies/1",
+			"user_id":        "7",
+			"hook":           "database",
+		},
+		Trace: "goroutine 1 [running]:",
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	assert.Nil(t, s.Flush(ctx))
+
+	e := <-events
+	assert.Equal(t, "/api/42/store/", path)
+	assert.Contains(t, auth, "sentry_key=public")
+	assert.Equal(t, "boom", e.Message)
+	assert.Equal(t, "error", e.Level)
+	assert.Equal(t, "test", e.Environment)
+	assert.Equal(t, &sentryUser{ID: "7"}, e.User)
+	assert.Equal(t, &sentryRequest{Method: http.MethodGet, URL: "/v1/movies/1"}, e.Request)
+	assert.Equal(t, map[string]string{"hook": "database"}, e.Tags)
+	assert.Equal(t, "goroutine 1 [running]:", e.Extra["stacktrace"])
+}
@@ -0,0 +1,104 @@
+// Package reqctx carries the request-scoped values, such as the authenticated user and the
+// request's ID, in the request's context.
+//
+// Each value has a typed Key, so that a value can't be stored or read with the wrong type, and
+// the keys of different packages can't collide. New middleware should declare a Key, or add a
+// SetX/X helper pair here, rather than use context.WithValue() with an ad-hoc key.
+package reqctx
+
+import (
+	"context"
+	"time"
+
+	"github.com/walkccc/greenlight/internal/data"
+)
+
+// Key is the key of a request-scoped value of type T. Keys are compared by identity, so each one
+// has to be created once, with NewKey, and kept in a package-level variable.
+type Key[T any] struct {
+	name string
+}
+
+// NewKey returns a new key. The name is only used to describe the key, e.g. when printing a
+// context.
+func NewKey[T any](name string) *Key[T] {
+	return &Key[T]{name: name}
+}
+
+func (k *Key[T]) String() string {
+	return "reqctx." + k.name
+}
+
+// Set returns a copy of the context carrying the value.
+func (k *Key[T]) Set(ctx context.Context, value T) context.Context {
+	return context.WithValue(ctx, k, value)
+}
+
+// Get returns the value carried by the context, and false if it doesn't carry one.
+func (k *Key[T]) Get(ctx context.Context) (T, bool) {
+	value, ok := ctx.Value(k).(T)
+	return value, ok
+}
+
+var (
+	userKey      = NewKey[*data.User]("user")
+	requestIDKey = NewKey[string]("request_id")
+	tenantKey    = NewKey[int64]("tenant")
+	localeKey    = NewKey[string]("locale")
+)
+
+// SetUser returns a copy of the context carrying the authenticated user, or the anonymous one. It
+// also carries the organization the user's token is scoped to, if any, as the tenant.
+func SetUser(ctx context.Context, user *data.User) context.Context {
+	ctx = userKey.Set(ctx, user)
+	if user.OrganizationID != 0 {
+		ctx = tenantKey.Set(ctx, user.OrganizationID)
+	}
+	return ctx
+}
+
+// User returns the user carried by the context, and false if the request hasn't been
+// authenticated yet.
+func User(ctx context.Context) (*data.User, bool) {
+	return userKey.Get(ctx)
+}
+
+// SetRequestID returns a copy of the context carrying the request's ID.
+func SetRequestID(ctx context.Context, id string) context.Context {
+	return requestIDKey.Set(ctx, id)
+}
+
+// RequestID returns the request's ID, or an empty string if it hasn't been given one.
+func RequestID(ctx context.Context) string {
+	id, _ := requestIDKey.Get(ctx)
+	return id
+}
+
+// Tenant returns the ID of the organization the request is made in, or 0 if it isn't made in one.
+func Tenant(ctx context.Context) int64 {
+	id, _ := tenantKey.Get(ctx)
+	return id
+}
+
+// SetLocale returns a copy of the context carrying the locale the response should use, as a
+// BCP 47 language tag, e.g. "fr-CA".
+func SetLocale(ctx context.Context, locale string) context.Context {
+	return localeKey.Set(ctx, locale)
+}
+
+// Locale returns the locale carried by the context, or an empty string if the client didn't ask
+// for one.
+func Locale(ctx context.Context) string {
+	locale, _ := localeKey.Get(ctx)
+	return locale
+}
+
+// Remaining returns how long the request has left before its context's deadline, and false if
+// the context has no deadline.
+func Remaining(ctx context.Context) (time.Duration, bool) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return 0, false
+	}
+	return time.Until(deadline), true
+}
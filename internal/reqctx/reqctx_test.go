@@ -0,0 +1,57 @@
+package reqctx
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/walkccc/greenlight/internal/data"
+)
+
+func TestKey(t *testing.T) {
+	count := NewKey[int]("count")
+	other := NewKey[int]("count")
+
+	ctx := count.Set(context.Background(), 3)
+
+	value, ok := count.Get(ctx)
+	assert.True(t, ok)
+	assert.Equal(t, 3, value)
+
+	// Keys are told apart by identity, not by name.
+	_, ok = other.Get(ctx)
+	assert.False(t, ok)
+	assert.Equal(t, "reqctx.count", count.String())
+}
+
+func TestHelpers(t *testing.T) {
+	ctx := context.Background()
+
+	_, ok := User(ctx)
+	assert.False(t, ok)
+	assert.Empty(t, RequestID(ctx))
+	assert.Zero(t, Tenant(ctx))
+	assert.Empty(t, Locale(ctx))
+	_, ok = Remaining(ctx)
+	assert.False(t, ok)
+
+	ctx = SetUser(ctx, &data.User{ID: 7, OrganizationID: 2})
+	ctx = SetRequestID(ctx, "abc")
+	ctx = SetLocale(ctx, "fr-CA")
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+
+	user, ok := User(ctx)
+	assert.True(t, ok)
+	assert.Equal(t, int64(7), user.ID)
+	assert.Equal(t, "abc", RequestID(ctx))
+	assert.Equal(t, int64(2), Tenant(ctx))
+	assert.Equal(t, "fr-CA", Locale(ctx))
+	remaining, ok := Remaining(ctx)
+	assert.True(t, ok)
+	assert.InDelta(t, time.Minute, remaining, float64(time.Second))
+
+	// An anonymous user isn't made in any organization.
+	assert.Zero(t, Tenant(SetUser(context.Background(), data.AnonymousUser)))
+}
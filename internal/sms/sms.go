@@ -0,0 +1,77 @@
+// Package sms sends text messages, e.g. the security alerts of the users who asked for them.
+package sms
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Sender sends a text message to a phone number in the E.164 format, e.g. "+14155552671".
+type Sender interface {
+	Send(ctx context.Context, to, body string) error
+}
+
+// twilioAPI is the base URL of Twilio's REST API.
+const twilioAPI = "https://api.twilio.com/2010-04-01"
+
+// Twilio sends the messages through Twilio's Messages API. Send the messages to a WhatsApp number
+// by prefixing both the sender and the recipient with "whatsapp:".
+type Twilio struct {
+	accountSID string
+	authToken  string
+	from       string
+	baseURL    string
+	client     *http.Client
+}
+
+// NewTwilio returns a Twilio sender for the account, which sends the messages from the given
+// number (or messaging service SID).
+func NewTwilio(accountSID, authToken, from string) *Twilio {
+	return &Twilio{
+		accountSID: accountSID,
+		authToken:  authToken,
+		from:       from,
+		baseURL:    twilioAPI,
+		client:     &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (t *Twilio) Send(ctx context.Context, to, body string) error {
+	form := url.Values{"To": {to}, "Body": {body}}
+	if strings.HasPrefix(t.from, "MG") {
+		form.Set("MessagingServiceSid", t.from)
+	} else {
+		form.Set("From", t.from)
+	}
+
+	endpoint := t.baseURL + "/Accounts/" + url.PathEscape(t.accountSID) + "/Messages.json"
+	req, err := http.NewRequestWithContext(
+		ctx,
+		http.MethodPost,
+		endpoint,
+		strings.NewReader(form.Encode()),
+	)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(t.accountSID, t.authToken)
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		// Twilio explains the error in the body, e.g. that the number isn't valid.
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("twilio: unexpected status %d: %s", resp.StatusCode, detail)
+	}
+	return nil
+}
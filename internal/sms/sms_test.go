@@ -0,0 +1,44 @@
+package sms
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTwilioSend(t *testing.T) {
+	var form map[string][]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/Accounts/AC123/Messages.json", r.URL.Path)
+		user, password, ok := r.BasicAuth()
+		assert.True(t, ok)
+		assert.Equal(t, "AC123", user)
+		assert.Equal(t, "secret", password)
+
+		r.ParseForm()
+		form = r.PostForm
+
+		if r.PostForm.Get("To") == "+10000000000" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"message": "invalid number"}`))
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+
+	twilio := NewTwilio("AC123", "secret", "+14155550000")
+	twilio.baseURL = server.URL
+
+	err := twilio.Send(context.Background(), "+14155552671", "Hello")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"+14155552671"}, form["To"])
+	assert.Equal(t, []string{"+14155550000"}, form["From"])
+	assert.Equal(t, []string{"Hello"}, form["Body"])
+
+	err = twilio.Send(context.Background(), "+10000000000", "Hello")
+	assert.ErrorContains(t, err, "invalid number")
+}
@@ -0,0 +1,364 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// unsignedPayload stands for the body's hash in the signed URLs, whose body isn't known.
+const unsignedPayload = "UNSIGNED-PAYLOAD"
+
+// Bucket stores the files in an S3 or GCS bucket, through their XML APIs. The requests are signed
+// with Signature Version 4, which GCS supports with HMAC keys under its own names, and address the
+// bucket in the path, so that an S3-compatible server such as MinIO can stand in for S3.
+type Bucket struct {
+	provider string // "s3" or "gcs", in the errors
+	endpoint string
+	bucket   string
+	signer   signer
+	client   *http.Client
+}
+
+// NewS3 returns a store of the files in an S3 bucket. The endpoint defaults to the region's.
+func NewS3(bucket, region, endpoint, accessKey, secretKey string) (*Bucket, error) {
+	if bucket == "" || region == "" || accessKey == "" || secretKey == "" {
+		return nil, errors.New("storage: s3 needs a bucket, a region and an access key")
+	}
+	if endpoint == "" {
+		endpoint = "https://s3." + region + ".amazonaws.com"
+	}
+
+	return &Bucket{
+		provider: "s3",
+		endpoint: strings.TrimSuffix(endpoint, "/"),
+		bucket:   bucket,
+		signer: signer{
+			scheme:    "AWS4",
+			headers:   "X-Amz-",
+			service:   "s3",
+			region:    region,
+			accessKey: accessKey,
+			secretKey: secretKey,
+		},
+		client: &http.Client{Timeout: 30 * time.Second},
+	}, nil
+}
+
+// NewGCS returns a store of the files in a GCS bucket, with an HMAC key of a service account.
+func NewGCS(bucket, endpoint, accessKey, secretKey string) (*Bucket, error) {
+	if bucket == "" || accessKey == "" || secretKey == "" {
+		return nil, errors.New("storage: gcs needs a bucket and an HMAC key")
+	}
+	if endpoint == "" {
+		endpoint = "https://storage.googleapis.com"
+	}
+
+	return &Bucket{
+		provider: "gcs",
+		endpoint: strings.TrimSuffix(endpoint, "/"),
+		bucket:   bucket,
+		signer: signer{
+			scheme:    "GOOG4",
+			headers:   "X-Goog-",
+			service:   "storage",
+			region:    "auto",
+			accessKey: accessKey,
+			secretKey: secretKey,
+		},
+		client: &http.Client{Timeout: 30 * time.Second},
+	}, nil
+}
+
+// url returns the URL of the object, or of the bucket itself if the key is empty.
+func (b *Bucket) url(key string) *url.URL {
+	u, _ := url.Parse(b.endpoint)
+	u.Path += "/" + b.bucket
+	u.RawPath = u.EscapedPath()
+	if key != "" {
+		u.Path += "/" + key
+		u.RawPath += "/" + escapePath(key)
+	}
+	return u
+}
+
+// do sends a signed request about the object. A 404 is returned as ErrNotFound, and any other
+// status outside 2xx as an error.
+func (b *Bucket) do(
+	ctx context.Context,
+	method, key string,
+	body []byte,
+	contentType string,
+) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, b.url(key).String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	sum := sha256.Sum256(body)
+	b.signer.sign(req, hex.EncodeToString(sum[:]), time.Now())
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, ErrNotFound
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		// The providers explain the error in an XML body, e.g. that the signature doesn't match.
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s: unexpected status %d: %s", b.provider, resp.StatusCode, detail)
+	}
+	return resp, nil
+}
+
+// Put reads the whole body before uploading it, since the providers need its length up front.
+func (b *Bucket) Put(ctx context.Context, key string, body io.Reader, contentType string) error {
+	if !validKey(key) {
+		return ErrInvalidKey
+	}
+
+	content, err := io.ReadAll(body)
+	if err != nil {
+		return err
+	}
+
+	resp, err := b.do(ctx, http.MethodPut, key, content, contentType)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func (b *Bucket) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	if !validKey(key) {
+		return nil, ErrInvalidKey
+	}
+
+	resp, err := b.do(ctx, http.MethodGet, key, nil, "")
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+func (b *Bucket) Delete(ctx context.Context, key string) error {
+	if !validKey(key) {
+		return ErrInvalidKey
+	}
+
+	resp, err := b.do(ctx, http.MethodDelete, key, nil, "")
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func (b *Bucket) SignedURL(ctx context.Context, key string, expiry time.Duration) (string, error) {
+	if !validKey(key) {
+		return "", ErrInvalidKey
+	}
+	return b.signer.presign(http.MethodGet, b.url(key), expiry, time.Now()), nil
+}
+
+// Check checks that the bucket exists and the access key may use it.
+func (b *Bucket) Check(ctx context.Context) error {
+	resp, err := b.do(ctx, http.MethodHead, "", nil, "")
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// signer signs the requests with Signature Version 4. GCS names the algorithm, the headers and
+// the query parameters after itself, but computes the signature the same way as S3.
+type signer struct {
+	scheme    string // "AWS4" or "GOOG4"
+	headers   string // the prefix of the headers and query parameters, "X-Amz-" or "X-Goog-"
+	service   string
+	region    string
+	accessKey string
+	secretKey string
+}
+
+func (s signer) algorithm() string {
+	return s.scheme + "-HMAC-SHA256"
+}
+
+func (s signer) scope(t time.Time) string {
+	return strings.Join([]string{
+		t.Format("20060102"),
+		s.region,
+		s.service,
+		strings.ToLower(s.scheme) + "_request",
+	}, "/")
+}
+
+// sign adds the date, the payload's hash and the Authorization header to the request. The host
+// and the provider's headers are signed.
+func (s signer) sign(req *http.Request, payloadHash string, now time.Time) {
+	now = now.UTC()
+	req.Header.Set(s.headers+"Date", now.Format("20060102T150405Z"))
+	req.Header.Set(s.headers+"Content-Sha256", payloadHash)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		if strings.HasPrefix(name, s.headers) {
+			headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+		}
+	}
+
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	signature := s.signature(
+		req.Method,
+		req.URL,
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+		now,
+	)
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.algorithm(),
+		s.accessKey,
+		s.scope(now),
+		signedHeaders,
+		signature,
+	))
+}
+
+// presign returns the URL with the signature in its query, valid for the expiry. Only the host
+// is signed, so that the URL works from a browser.
+func (s signer) presign(method string, u *url.URL, expiry time.Duration, now time.Time) string {
+	now = now.UTC()
+
+	query := u.Query()
+	query.Set(s.headers+"Algorithm", s.algorithm())
+	query.Set(s.headers+"Credential", s.accessKey+"/"+s.scope(now))
+	query.Set(s.headers+"Date", now.Format("20060102T150405Z"))
+	query.Set(s.headers+"Expires", strconv.Itoa(int(expiry.Seconds())))
+	query.Set(s.headers+"SignedHeaders", "host")
+
+	canonical := canonicalQuery(query)
+	signature := s.signature(
+		method,
+		u,
+		canonical,
+		"host:"+u.Host+"\n",
+		"host",
+		unsignedPayload,
+		now,
+	)
+
+	signed := *u
+	signed.RawQuery = canonical + "&" + s.headers + "Signature=" + signature
+	return signed.String()
+}
+
+// signature returns the hex signature of the canonical request.
+func (s signer) signature(
+	method string,
+	u *url.URL,
+	query, headers, signedHeaders, payloadHash string,
+	now time.Time,
+) string {
+	canonicalRequest := strings.Join([]string{
+		method,
+		u.EscapedPath(),
+		query,
+		headers,
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	hash := sha256.Sum256([]byte(canonicalRequest))
+
+	stringToSign := strings.Join([]string{
+		s.algorithm(),
+		now.Format("20060102T150405Z"),
+		s.scope(now),
+		hex.EncodeToString(hash[:]),
+	}, "\n")
+
+	key := []byte(s.scheme + s.secretKey)
+	for _, part := range strings.Split(s.scope(now), "/") {
+		key = hmacSHA256(key, part)
+	}
+	return hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// canonicalQuery returns the query sorted by name, with the names and values escaped.
+func canonicalQuery(query url.Values) string {
+	pairs := make([]string, 0, len(query))
+	for name, values := range query {
+		for _, value := range values {
+			pairs = append(pairs, escape(name, true)+"="+escape(value, true))
+		}
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, "&")
+}
+
+// escapePath escapes a key for a URL's path, leaving its slashes as they are.
+func escapePath(key string) string {
+	return escape(key, false)
+}
+
+// escape percent-encodes every byte but the unreserved characters of RFC 3986 (and the slashes,
+// unless encodeSlash), as Signature Version 4 expects. url.QueryEscape would encode the spaces as
+// plus signs.
+func escape(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
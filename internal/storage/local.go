@@ -0,0 +1,205 @@
+package storage
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Local stores the files in a directory. Its signed URLs point to the base URL, which the API
+// server serves the directory under, and carry an expiry and an HMAC-SHA256 of the key and the
+// expiry with the secret.
+type Local struct {
+	dir     string
+	baseURL string
+	secret  []byte
+}
+
+// NewLocal returns a store of the files in dir, which is created if need be.
+func NewLocal(dir, baseURL, secret string) (*Local, error) {
+	if dir == "" || secret == "" {
+		return nil, errors.New("storage: the local backend needs a directory and a secret")
+	}
+
+	err := os.MkdirAll(dir, 0o750)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Local{dir: dir, baseURL: strings.TrimSuffix(baseURL, "/"), secret: []byte(secret)}, nil
+}
+
+// path returns the file's path in the directory.
+func (l *Local) path(key string) (string, error) {
+	if !validKey(key) {
+		return "", ErrInvalidKey
+	}
+	return filepath.Join(l.dir, filepath.FromSlash(key)), nil
+}
+
+// Put writes the file to a temporary file first, and renames it, so that a reader never sees a
+// partly written file.
+func (l *Local) Put(ctx context.Context, key string, body io.Reader, contentType string) error {
+	path, err := l.path(key)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(path), 0o750)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = io.Copy(tmp, body)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+func (l *Local) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	path, err := l.path(key)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	return f, err
+}
+
+func (l *Local) Delete(ctx context.Context, key string) error {
+	path, err := l.path(key)
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+func (l *Local) SignedURL(ctx context.Context, key string, expiry time.Duration) (string, error) {
+	if !validKey(key) {
+		return "", ErrInvalidKey
+	}
+
+	expires := strconv.FormatInt(time.Now().Add(expiry).Unix(), 10)
+	return fmt.Sprintf(
+		"%s/%s?expires=%s&signature=%s",
+		l.baseURL,
+		escapePath(key),
+		expires,
+		hex.EncodeToString(l.mac(key, expires)),
+	), nil
+}
+
+// mac returns the HMAC-SHA256 of a signed URL's key and expiry.
+func (l *Local) mac(key, expires string) []byte {
+	h := hmac.New(sha256.New, l.secret)
+	h.Write([]byte(key))
+	h.Write([]byte("\n"))
+	h.Write([]byte(expires))
+	return h.Sum(nil)
+}
+
+// Verify checks the signature of a signed URL of the key, given the URL's query, and returns when
+// the URL expires.
+func (l *Local) Verify(key string, query url.Values) (time.Time, error) {
+	expires := query.Get("expires")
+	unix, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil {
+		return time.Time{}, ErrInvalidSignature
+	}
+
+	signature, err := hex.DecodeString(query.Get("signature"))
+	if err != nil || !hmac.Equal(signature, l.mac(key, expires)) {
+		return time.Time{}, ErrInvalidSignature
+	}
+
+	expiry := time.Unix(unix, 0)
+	if time.Now().After(expiry) {
+		return time.Time{}, ErrExpired
+	}
+	return expiry, nil
+}
+
+// Open opens the file for serving it, which unlike Get's body can seek. Only the regular files
+// are opened, and only if the symlinks on their path don't lead out of the directory.
+func (l *Local) Open(key string) (*os.File, fs.FileInfo, error) {
+	path, err := l.path(key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	resolved, err := filepath.EvalSymlinks(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	dir, err := filepath.EvalSymlinks(l.dir)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !strings.HasPrefix(resolved, dir+string(filepath.Separator)) {
+		return nil, nil, ErrNotFound
+	}
+
+	f, err := os.Open(resolved)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	if !info.Mode().IsRegular() {
+		f.Close()
+		return nil, nil, ErrNotFound
+	}
+	return f, info, nil
+}
+
+// Check checks that the directory is still there.
+func (l *Local) Check(ctx context.Context) error {
+	info, err := os.Stat(l.dir)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("storage: %s isn't a directory", l.dir)
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+// Package storage stores the files that are uploaded or generated, e.g. the posters and the
+// exports, in a directory of the local filesystem or in an S3 or GCS bucket. The files are
+// addressed by a key, a slash-separated path such as "posters/42.jpg", and are downloaded through
+// the time-limited URLs that SignedURL returns, rather than through the API.
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	ErrNotFound         = errors.New("storage: object not found")
+	ErrInvalidKey       = errors.New("storage: invalid key")
+	ErrInvalidSignature = errors.New("storage: invalid URL signature")
+	ErrExpired          = errors.New("storage: the signed URL has expired")
+)
+
+// Storage stores the files by key. Put replaces any file with the same key, and Delete succeeds
+// if there's no such file. Check reports whether the backend can be reached, for the readiness
+// probe.
+type Storage interface {
+	Put(ctx context.Context, key string, body io.Reader, contentType string) error
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+	SignedURL(ctx context.Context, key string, expiry time.Duration) (string, error)
+	Check(ctx context.Context) error
+}
+
+// Config configures a backend. Only the fields of the chosen backend are used.
+type Config struct {
+	Backend   string // "local", "s3" or "gcs"
+	Dir       string // local: the directory holding the files
+	BaseURL   string // local: the URL that the files are served under, e.g. /assets
+	Bucket    string // s3, gcs
+	Region    string // s3
+	Endpoint  string // s3, gcs: replaces the provider's, e.g. for MinIO
+	AccessKey string // s3, gcs: the access key ID, or the GCS HMAC key's ID
+	SecretKey string // the secret of the access key, or the key signing the local URLs
+}
+
+// New returns the configured backend.
+func New(cfg Config) (Storage, error) {
+	switch cfg.Backend {
+	case "local":
+		return NewLocal(cfg.Dir, cfg.BaseURL, cfg.SecretKey)
+	case "s3":
+		return NewS3(cfg.Bucket, cfg.Region, cfg.Endpoint, cfg.AccessKey, cfg.SecretKey)
+	case "gcs":
+		return NewGCS(cfg.Bucket, cfg.Endpoint, cfg.AccessKey, cfg.SecretKey)
+	default:
+		return nil, fmt.Errorf("storage: unknown backend %q", cfg.Backend)
+	}
+}
+
+// maxKeyLength is the longest key, which S3 and GCS both allow.
+const maxKeyLength = 1024
+
+// validKey reports whether the key is a relative, slash-separated path without empty, . or ..
+// segments, so that it can't escape the local directory or the bucket's prefix.
+func validKey(key string) bool {
+	if key == "" || len(key) > maxKeyLength {
+		return false
+	}
+	for _, segment := range strings.Split(key, "/") {
+		if segment == "" || segment == "." || segment == ".." || strings.Contains(segment, "\\") {
+			return false
+		}
+	}
+	return true
+}
+
+// Health reports whether the storage backend could be reached the last time it was checked. It's
+// "unknown" until the first check.
+type Health struct {
+	Status    string     `json:"status"`
+	Error     string     `json:"error,omitempty"`
+	CheckedAt *time.Time `json:"checked_at,omitempty"`
+}
+
+// Monitor checks a backend's health at most once per interval, in the background, so that the
+// readiness probe isn't held up by a slow backend.
+type Monitor struct {
+	store    Storage
+	interval time.Duration
+
+	mtx      sync.Mutex
+	health   Health
+	checking atomic.Bool
+}
+
+func NewMonitor(store Storage, interval time.Duration) *Monitor {
+	return &Monitor{store: store, interval: interval, health: Health{Status: "unknown"}}
+}
+
+// Health returns the backend's last known health, and starts a check if it's stale.
+func (m *Monitor) Health() Health {
+	m.mtx.Lock()
+	health := m.health
+	m.mtx.Unlock()
+
+	stale := health.CheckedAt == nil || time.Since(*health.CheckedAt) > m.interval
+	if stale && m.checking.CompareAndSwap(false, true) {
+		go func() {
+			defer m.checking.Store(false)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			err := m.store.Check(ctx)
+
+			now := time.Now()
+			health := Health{Status: "ok", CheckedAt: &now}
+			if err != nil {
+				health.Status = "unavailable"
+				health.Error = err.Error()
+			}
+
+			m.mtx.Lock()
+			m.health = health
+			m.mtx.Unlock()
+		}()
+	}
+
+	return health
+}
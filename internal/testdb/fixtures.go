@@ -0,0 +1,96 @@
+package testdb
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/walkccc/greenlight/internal/data"
+)
+
+// Fixtures creates the records the integration tests start from, through the models of a test
+// database. Every record is created in the default organization, and the failures fail the test.
+type Fixtures struct {
+	t      testing.TB
+	Models data.Models
+	users  int // how many users were created
+}
+
+// New opens a schema of the test database, as Open does, and returns the fixtures of its models.
+func New(t testing.TB) *Fixtures {
+	t.Helper()
+
+	return &Fixtures{t: t, Models: data.NewModels(Open(t), data.Config{})}
+}
+
+// User creates an activated user, who is a member of the default organization, with the
+// permissions. Their email is unique, and their password is "pa55word".
+func (f *Fixtures) User(permissions ...string) *data.User {
+	f.t.Helper()
+	ctx := context.Background()
+	f.users++
+
+	user := &data.User{
+		Name:      "Alice",
+		Email:     fmt.Sprintf("alice.%d@example.com", f.users),
+		Activated: true,
+	}
+	err := user.Password.Set("pa55word")
+	if err == nil {
+		err = f.Models.Users.Create(ctx, user)
+	}
+	if err == nil {
+		err = f.Models.Organizations.SetMember(
+			ctx,
+			data.DefaultOrganizationID,
+			user.ID,
+			data.RoleMember,
+		)
+	}
+	if err == nil && len(permissions) > 0 {
+		err = f.Models.Permissions.AddForUser(ctx, user.ID, permissions...)
+	}
+	if err != nil {
+		f.t.Fatalf("testdb: creating a user: %v", err)
+	}
+
+	user.OrganizationID = data.DefaultOrganizationID
+	return user
+}
+
+// Token returns the plaintext of a new authentication token of the user, scoped to the default
+// organization.
+func (f *Fixtures) Token(user *data.User) string {
+	f.t.Helper()
+
+	token, err := f.Models.Tokens.NewForOrganization(
+		context.Background(),
+		user.ID,
+		data.DefaultOrganizationID,
+		time.Hour,
+		data.ScopeAuthentication,
+	)
+	if err != nil {
+		f.t.Fatalf("testdb: creating a token: %v", err)
+	}
+	return token.Plaintext
+}
+
+// Movie creates a movie with the title.
+func (f *Fixtures) Movie(title string) *data.Movie {
+	f.t.Helper()
+
+	movie := &data.Movie{
+		OrganizationID: data.DefaultOrganizationID,
+		Title:          title,
+		Year:           2016,
+		Runtime:        107,
+		Genres:         []string{"animation", "adventure"},
+	}
+	err := f.Models.Movies.Create(context.Background(), movie)
+	if err != nil {
+		f.t.Fatalf("testdb: creating a movie: %v", err)
+	}
+	return movie
+}
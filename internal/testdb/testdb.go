@@ -0,0 +1,183 @@
+// Package testdb runs the integration tests against a real PostgreSQL database, which catches
+// the SQL errors that the sqlmock-based unit tests can't. Every test gets a schema of its own,
+// with the migrations applied, which is dropped when the test ends, so that the tests can run in
+// parallel against the same database. The extensions the migrations need are created once, in the
+// public schema, so they're shared by the tests and outlive their schemas.
+//
+// The database is given by the GREENLIGHT_TEST_DB_DSN environment variable, and the tests calling
+// Open are skipped if it's unset. The integration tests are built with the integration tag; to
+// run them against a throwaway PostgreSQL container:
+//
+//	make test/integration
+package testdb
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// DSNEnv is the environment variable holding the DSN of the test database.
+const DSNEnv = "GREENLIGHT_TEST_DB_DSN"
+
+// schemas numbers the schemas created by this test binary.
+var schemas atomic.Int64
+
+// extensions are the extensions the migrations need. In production they're created along with the
+// database (see db/create_extension in the Makefile).
+var extensions = []string{"citext", "pg_trgm"}
+
+// Open returns a connection pool to a new schema of the test database, with the migrations
+// applied. The schema is dropped when the test ends. It skips the test if GREENLIGHT_TEST_DB_DSN
+// is unset.
+func Open(t testing.TB) *sql.DB {
+	t.Helper()
+
+	dsn := os.Getenv(DSNEnv)
+	if dsn == "" {
+		t.Skipf("%s isn't set", DSNEnv)
+	}
+
+	admin := connect(t, dsn)
+	err := createExtensions(admin)
+	if err != nil {
+		admin.Close()
+		t.Fatalf("testdb: %v", err)
+	}
+
+	schema := fmt.Sprintf("test_%d_%d_%d", os.Getpid(), time.Now().UnixNano(), schemas.Add(1))
+	_, err = admin.Exec("CREATE SCHEMA " + schema)
+	if err != nil {
+		admin.Close()
+		t.Fatalf("testdb: creating the schema: %v", err)
+	}
+
+	// The extensions are in the public schema, so it stays in the search path.
+	db := connect(t, withSearchPath(dsn, schema+",public"))
+	t.Cleanup(func() {
+		db.Close()
+		_, err := admin.Exec("DROP SCHEMA " + schema + " CASCADE")
+		if err != nil {
+			t.Errorf("testdb: dropping the schema: %v", err)
+		}
+		admin.Close()
+	})
+
+	err = Migrate(db, migrationsDir(t))
+	if err != nil {
+		t.Fatalf("testdb: %v", err)
+	}
+
+	return db
+}
+
+// createExtensions creates the extensions in the public schema, unless they exist. The tests of
+// other packages, which run in parallel, may be creating them at the same time, in which case one
+// of them fails with a unique violation that means the extension now exists.
+func createExtensions(db *sql.DB) error {
+	for _, extension := range extensions {
+		_, err := db.Exec("CREATE EXTENSION IF NOT EXISTS " + extension + " SCHEMA public")
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("creating the %s extension: %w", extension, err)
+		}
+	}
+	return nil
+}
+
+func connect(t testing.TB, dsn string) *sql.DB {
+	t.Helper()
+
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatalf("testdb: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err = db.PingContext(ctx)
+	if err != nil {
+		db.Close()
+		t.Fatalf("testdb: connecting to the test database: %v", err)
+	}
+
+	return db
+}
+
+// withSearchPath returns the DSN, in either the URL or the key/value form, with the search path
+// set.
+func withSearchPath(dsn, searchPath string) string {
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		u, err := url.Parse(dsn)
+		if err == nil {
+			query := u.Query()
+			query.Set("search_path", searchPath)
+			u.RawQuery = query.Encode()
+			return u.String()
+		}
+	}
+	return dsn + " search_path=" + searchPath
+}
+
+// Migrate applies the up migrations in the directory, in the order of their sequence numbers. The
+// optional migrations, which are in a subdirectory, aren't applied.
+func Migrate(db *sql.DB, dir string) error {
+	files, err := filepath.Glob(filepath.Join(dir, "*.up.sql"))
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("no migrations in %s", dir)
+	}
+	sort.Strings(files)
+
+	for _, file := range files {
+		migration, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		_, err = db.Exec(string(migration))
+		if err != nil {
+			return fmt.Errorf("migration %s: %w", filepath.Base(file), err)
+		}
+	}
+
+	return nil
+}
+
+// migrationsDir returns the migrations directory of the module the test runs in.
+func migrationsDir(t testing.TB) string {
+	t.Helper()
+
+	dir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("testdb: %v", err)
+	}
+	for {
+		_, err := os.Stat(filepath.Join(dir, "go.mod"))
+		if err == nil {
+			return filepath.Join(dir, "migrations")
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			t.Fatalf("testdb: the module's root isn't above the working directory")
+		}
+		dir = parent
+	}
+}
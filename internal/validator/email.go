@@ -0,0 +1,135 @@
+package validator
+
+import (
+	"bufio"
+	"context"
+	_ "embed"
+	"errors"
+	"io"
+	"net"
+	"net/mail"
+	"regexp"
+	"strings"
+)
+
+//go:embed "disposable_domains.txt"
+var disposableDomains string
+
+// DisposableDomains holds the domains of the well-known disposable email services.
+var DisposableDomains = mustParseDenylist(disposableDomains)
+
+// labelRX matches a label of a domain name, e.g. "example" or "xn--bcher-kva".
+var labelRX = regexp.MustCompile(`^[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?$`)
+
+// ValidEmail returns true if the email is a bare address as defined by RFC 5322, e.g.
+// alice@example.com, without a display name, comments or quoting, whose domain is a fully
+// qualified domain name.
+func ValidEmail(email string) bool {
+	if len(email) > 254 {
+		return false
+	}
+
+	address, err := mail.ParseAddress(email)
+	if err != nil || address.Name != "" || address.Address != email {
+		return false
+	}
+
+	at := strings.LastIndexByte(email, '@')
+	if at > 64 {
+		return false
+	}
+
+	labels := strings.Split(email[at+1:], ".")
+	if len(labels) < 2 {
+		return false
+	}
+	for _, label := range labels {
+		if !labelRX.MatchString(label) {
+			return false
+		}
+	}
+	return true
+}
+
+// EmailDomain returns the lowercased domain of the email address.
+func EmailDomain(email string) string {
+	return strings.ToLower(email[strings.LastIndexByte(email, '@')+1:])
+}
+
+// Denylist is a set of domains. A domain is in the set if it, or any of its parent domains, was
+// added to it.
+type Denylist map[string]bool
+
+// ParseDenylist reads a denylist with one domain per line. The blank lines and the lines starting
+// with a # are ignored.
+func ParseDenylist(r io.Reader) (Denylist, error) {
+	denylist := make(Denylist)
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		denylist[strings.ToLower(line)] = true
+	}
+
+	return denylist, scanner.Err()
+}
+
+func mustParseDenylist(list string) Denylist {
+	denylist, err := ParseDenylist(strings.NewReader(list))
+	if err != nil {
+		panic(err)
+	}
+	return denylist
+}
+
+// Contains returns true if the domain or one of its parent domains is in the denylist.
+func (d Denylist) Contains(domain string) bool {
+	domain = strings.ToLower(domain)
+	for {
+		if d[domain] {
+			return true
+		}
+
+		_, parent, found := strings.Cut(domain, ".")
+		if !found {
+			return false
+		}
+		domain = parent
+	}
+}
+
+// Resolver is the subset of net.Resolver that HasMailServer uses.
+type Resolver interface {
+	LookupMX(ctx context.Context, name string) ([]*net.MX, error)
+	LookupHost(ctx context.Context, host string) ([]string, error)
+}
+
+// HasMailServer returns true if the domain accepts email: either it has MX records, other than the
+// "null MX" record of RFC 7505 that says it doesn't, or it has an address, which RFC 5321 sends the
+// email to in the absence of MX records. It returns an error if the lookup failed rather than found
+// nothing, e.g. on a timeout.
+func HasMailServer(ctx context.Context, resolver Resolver, domain string) (bool, error) {
+	mxs, err := resolver.LookupMX(ctx, domain)
+	switch {
+	case err == nil && len(mxs) == 1 && (mxs[0].Host == "." || mxs[0].Host == ""):
+		return false, nil
+	case err == nil && len(mxs) > 0:
+		return true, nil
+	case err != nil && !isNotFound(err):
+		return false, err
+	}
+
+	_, err = resolver.LookupHost(ctx, domain)
+	if isNotFound(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func isNotFound(err error) bool {
+	var dnsErr *net.DNSError
+	return errors.As(err, &dnsErr) && dnsErr.IsNotFound
+}
@@ -0,0 +1,102 @@
+package validator
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidEmail(t *testing.T) {
+	for _, email := range []string{
+		"alice@example.com",
+		"alice.o'hara+movies@mail.example.co.uk",
+		"bob@xn--bcher-kva.example",
+	} {
+		assert.True(t, ValidEmail(email), email)
+	}
+
+	for _, email := range []string{
+		"",
+		"alice",
+		"alice@localhost",
+		"alice@@example.com",
+		"alice@example..com",
+		"alice@-example.com",
+		".alice@example.com",
+		"Alice <alice@example.com>",
+		"alice@example.com (Alice)",
+		`"alice smith"@example.com`,
+		" alice@example.com",
+		strings.Repeat("a", 65) + "@example.com",
+	} {
+		assert.False(t, ValidEmail(email), email)
+	}
+}
+
+func TestDenylist(t *testing.T) {
+	denylist, err := ParseDenylist(strings.NewReader("# comment\n\nSpam.example\n"))
+	assert.Nil(t, err)
+	assert.Equal(t, Denylist{"spam.example": true}, denylist)
+
+	assert.True(t, denylist.Contains("spam.example"))
+	assert.True(t, denylist.Contains("mail.SPAM.example"))
+	assert.False(t, denylist.Contains("notspam.example"))
+	assert.False(t, Denylist(nil).Contains("spam.example"))
+
+	assert.True(t, DisposableDomains.Contains(EmailDomain("bot@Mailinator.com")))
+}
+
+type fakeResolver struct {
+	mx    map[string][]*net.MX
+	hosts map[string][]string
+	err   error
+}
+
+func (r fakeResolver) LookupMX(ctx context.Context, name string) ([]*net.MX, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+	if mxs, ok := r.mx[name]; ok {
+		return mxs, nil
+	}
+	return nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+}
+
+func (r fakeResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	if addrs, ok := r.hosts[host]; ok {
+		return addrs, nil
+	}
+	return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+}
+
+func TestHasMailServer(t *testing.T) {
+	resolver := fakeResolver{
+		mx: map[string][]*net.MX{
+			"example.com":  {{Host: "mx.example.com.", Pref: 10}},
+			"nomail.test":  {{Host: ".", Pref: 0}},
+			"implicit.org": {},
+		},
+		hosts: map[string][]string{"implicit.org": {"192.0.2.1"}},
+	}
+
+	for domain, want := range map[string]bool{
+		"example.com":  true,
+		"nomail.test":  false,
+		"implicit.org": true,
+		"missing.test": false,
+	} {
+		ok, err := HasMailServer(context.Background(), resolver, domain)
+		assert.Nil(t, err, domain)
+		assert.Equal(t, want, ok, domain)
+	}
+
+	// A failed lookup is reported rather than taken for a missing mail server.
+	resolver.err = &net.DNSError{Err: "i/o timeout", IsTimeout: true}
+	ok, err := HasMailServer(context.Background(), resolver, "example.com")
+	assert.False(t, ok)
+	assert.True(t, errors.Is(err, resolver.err))
+}
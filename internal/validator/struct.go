@@ -0,0 +1,324 @@
+package validator
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Struct validates the exported fields of s (a struct or a pointer to one) against the rules
+// declared in their `validate` tags, adding any errors to the validator under the field's JSON
+// name (or its `query` tag's name, if it has no JSON name). The rules are separated by commas:
+//
+//	required     must not be the zero value (for slices and pointers, must not be nil)
+//	omitempty    skips the remaining rules if the value is the zero value
+//	min=N        strings: at least N bytes, slices and maps: at least N items, numbers: at least N
+//	max=N        strings: at most N bytes, slices and maps: at most N items, numbers: at most N
+//	gt=N, lt=N   numbers: greater than, or less than, N
+//	oneof=a b c  must be one of the space separated values
+//	email        must be a valid email address
+//	unique       slices: must not contain duplicate values
+//
+// For example:
+//
+//	type input struct {
+//		Title  string   `json:"title" validate:"required,max=500"`
+//		Genres []string `json:"genres" validate:"required,min=1,max=5,unique"`
+//	}
+//
+// Nested structs and slices of structs are validated too, with their errors keyed by the field's
+// path, e.g. "cast[0].name". Once a rule fails, the field's remaining rules are skipped.
+func (v *Validator) Struct(s any) {
+	v.validateStruct(reflect.ValueOf(s), "")
+}
+
+// Rule is a single parsed rule from a `validate` tag, e.g. {Name: "max", Param: "500"}.
+type Rule struct {
+	Name  string
+	Param string
+}
+
+// structField holds the parsed validation details of a struct field.
+type structField struct {
+	index int
+	key   string
+	rules []Rule
+}
+
+// structFields caches the parsed fields of each struct type, keyed by reflect.Type.
+var structFields sync.Map
+
+func (v *Validator) validateStruct(rv reflect.Value, prefix string) {
+	for rv.Kind() == reflect.Pointer {
+		if rv.IsNil() {
+			return
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		panic(fmt.Sprintf("validator: Struct() called with a %s", rv.Kind()))
+	}
+
+	for _, field := range fieldsOf(rv.Type()) {
+		fv := rv.Field(field.index)
+		key := Path(prefix, field.key)
+
+		if !v.validateField(fv, key, field.rules) {
+			continue
+		}
+
+		// Only look inside the value if it's valid itself, e.g. not a missing required struct.
+		switch elem := indirect(fv); {
+		case elem.Kind() == reflect.Struct:
+			if len(fieldsOf(elem.Type())) > 0 {
+				v.validateStruct(elem, key)
+			}
+		case elem.Kind() == reflect.Slice && isStruct(elem.Type().Elem()):
+			for i := 0; i < elem.Len(); i++ {
+				v.validateStruct(elem.Index(i), Path(key, i))
+			}
+		}
+	}
+}
+
+// validateField checks the value against each rule in turn, stopping at the first that fails. It
+// returns false if a rule failed.
+func (v *Validator) validateField(fv reflect.Value, key string, rules []Rule) bool {
+	for _, r := range rules {
+		switch r.Name {
+		case "omitempty":
+			if fv.IsZero() {
+				return true
+			}
+			continue
+		case "required":
+			if isMissing(fv) {
+				v.AddError(key, CodeRequired, "must be provided")
+				return false
+			}
+			continue
+		}
+
+		// The remaining rules don't apply to nil pointers, which only "required" rejects.
+		value := indirect(fv)
+		if !value.IsValid() {
+			return true
+		}
+
+		if code, message, ok := checkRule(value, r); !ok {
+			v.AddError(key, code, message)
+			return false
+		}
+	}
+
+	return true
+}
+
+// checkRule checks a value against a single rule, returning the error code and message if it
+// fails.
+func checkRule(value reflect.Value, r Rule) (string, string, bool) {
+	switch r.Name {
+	case "min", "max":
+		n, err := strconv.ParseFloat(r.Param, 64)
+		if err != nil {
+			panic(fmt.Sprintf("validator: invalid %s parameter %q", r.Name, r.Param))
+		}
+
+		switch value.Kind() {
+		case reflect.String:
+			if r.Name == "min" && float64(value.Len()) < n {
+				return CodeTooShort, fmt.Sprintf("must be at least %s bytes long", r.Param), false
+			}
+			if r.Name == "max" && float64(value.Len()) > n {
+				return CodeTooLong, fmt.Sprintf("must not be more than %s bytes long", r.Param), false
+			}
+			return "", "", true
+		case reflect.Slice, reflect.Array, reflect.Map:
+			if r.Name == "min" && float64(value.Len()) < n {
+				return CodeTooFew, "must contain at least " + items(r.Param), false
+			}
+			if r.Name == "max" && float64(value.Len()) > n {
+				return CodeTooMany, "must not contain more than " + items(r.Param), false
+			}
+			return "", "", true
+		}
+
+		number := numberOf(value)
+		if r.Name == "min" && number < n {
+			return CodeTooSmall, "must be at least " + r.Param, false
+		}
+		if r.Name == "max" && number > n {
+			return CodeTooLarge, "must not be more than " + r.Param, false
+		}
+	case "gt", "lt":
+		n, err := strconv.ParseFloat(r.Param, 64)
+		if err != nil {
+			panic(fmt.Sprintf("validator: invalid %s parameter %q", r.Name, r.Param))
+		}
+
+		number := numberOf(value)
+		if r.Name == "gt" && number <= n {
+			return CodeTooSmall, "must be greater than " + r.Param, false
+		}
+		if r.Name == "lt" && number >= n {
+			return CodeTooLarge, "must be less than " + r.Param, false
+		}
+	case "oneof":
+		values := strings.Fields(r.Param)
+		if !PermittedValue(fmt.Sprint(value.Interface()), values...) {
+			return CodeNotPermitted, "must be one of " + strings.Join(values, ", "), false
+		}
+	case "email":
+		if !ValidEmail(value.String()) {
+			return CodeInvalid, "must be a valid email address", false
+		}
+	case "unique":
+		seen := make(map[any]bool, value.Len())
+		for i := 0; i < value.Len(); i++ {
+			item := value.Index(i).Interface()
+			if seen[item] {
+				return CodeDuplicate, "must not contain duplicate values", false
+			}
+			seen[item] = true
+		}
+	}
+
+	return "", "", true
+}
+
+// fieldsOf returns the parsed fields of the struct type: those with a `validate` tag, and those
+// holding structs (or slices of structs) that may have rules of their own.
+func fieldsOf(t reflect.Type) []structField {
+	if cached, ok := structFields.Load(t); ok {
+		return cached.([]structField)
+	}
+
+	var fields []structField
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+
+		tag, hasTag := f.Tag.Lookup("validate")
+		if !hasTag && !isStruct(f.Type) && !(f.Type.Kind() == reflect.Slice && isStruct(f.Type.Elem())) {
+			continue
+		}
+
+		fields = append(fields, structField{
+			index: i,
+			key:   jsonName(f),
+			rules: ParseRules(tag),
+		})
+	}
+
+	structFields.Store(t, fields)
+	return fields
+}
+
+// ParseRules parses a `validate` tag. Unknown rules are a programming error, so they panic.
+func ParseRules(tag string) []Rule {
+	rules, err := ParseUserRules(tag)
+	if err != nil {
+		panic("validator: " + err.Error())
+	}
+	return rules
+}
+
+// ParseUserRules is like ParseRules, but for the rules that come from the users rather than from
+// the code, such as those of the custom movie attributes: it returns an error for the unknown rules
+// and for the parameters that the rules can't use, rather than panicking.
+func ParseUserRules(tag string) ([]Rule, error) {
+	if tag == "" {
+		return nil, nil
+	}
+
+	var rules []Rule
+	for _, part := range strings.Split(tag, ",") {
+		name, param, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch name {
+		case "required", "omitempty", "oneof", "email", "unique":
+		case "min", "max", "gt", "lt":
+			if _, err := strconv.ParseFloat(param, 64); err != nil {
+				return nil, fmt.Errorf("invalid %s parameter %q", name, param)
+			}
+		default:
+			return nil, fmt.Errorf("unknown rule %q", name)
+		}
+		rules = append(rules, Rule{Name: name, Param: param})
+	}
+	return rules, nil
+}
+
+// Value validates a single value against the rules, adding any errors to the validator under the
+// key, as Struct() does for a field. The value must not be nil.
+func (v *Validator) Value(key string, value any, rules []Rule) {
+	v.validateField(reflect.ValueOf(value), key, rules)
+}
+
+// jsonName returns the name the field is decoded from, so that the errors use the same keys as
+// the request body, or as the query string for the fields bound by their `query` tag.
+func jsonName(f reflect.StructField) string {
+	name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+	if name == "" || name == "-" {
+		name = f.Tag.Get("query")
+	}
+	if name == "" {
+		return strings.ToLower(f.Name)
+	}
+	return name
+}
+
+// isMissing reports whether a value fails the "required" rule.
+func isMissing(fv reflect.Value) bool {
+	switch fv.Kind() {
+	case reflect.Pointer, reflect.Slice, reflect.Map, reflect.Interface:
+		return fv.IsNil()
+	default:
+		return fv.IsZero()
+	}
+}
+
+// indirect dereferences pointers, returning the zero Value for a nil pointer.
+func indirect(fv reflect.Value) reflect.Value {
+	for fv.Kind() == reflect.Pointer {
+		if fv.IsNil() {
+			return reflect.Value{}
+		}
+		fv = fv.Elem()
+	}
+	return fv
+}
+
+// isStruct reports whether t is a struct, or a pointer to one.
+func isStruct(t reflect.Type) bool {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return t.Kind() == reflect.Struct
+}
+
+// items formats a count of items for the messages, e.g. "1 item" or "5 items".
+func items(count string) string {
+	if count == "1" {
+		return count + " item"
+	}
+	return count + " items"
+}
+
+// numberOf converts the numeric kinds to a float64 for comparisons. Rules that compare numbers are
+// a programming error on any other kind, so they panic.
+func numberOf(value reflect.Value) float64 {
+	switch value.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(value.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return float64(value.Uint())
+	case reflect.Float32, reflect.Float64:
+		return value.Float()
+	default:
+		panic(fmt.Sprintf("validator: can't compare a %s to a number", value.Kind()))
+	}
+}
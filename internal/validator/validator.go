@@ -1,23 +1,58 @@
 package validator
 
-import "regexp"
-
-var (
-	// EmailRX is a regex for sanity checking the format of email addresses. The regex pattern is
-	// taken from https://html.spec.whatwg.org/#valid-e-mail-address.
-	EmailRX = regexp.MustCompile(
-		"^[a-zA-Z0-9.!#$%&'*+\\/=?^_`{|}~-]+@[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(?:\\.[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*$",
-	)
+import (
+	"regexp"
+	"strconv"
+	"strings"
 )
 
-// Validator contains a map of validation errors.
+// PhoneRX is a regex for checking that phone numbers are in the E.164 format, e.g. +14155552671.
+var PhoneRX = regexp.MustCompile(`^\+[1-9][0-9]{6,14}$`)
+
+// Ordered is the set of types that support the < and > operators.
+type Ordered interface {
+	~int | ~int8 | ~int16 | ~int32 | ~int64 |
+		~uint | ~uint8 | ~uint16 | ~uint32 | ~uint64 | ~uintptr |
+		~float32 | ~float64 |
+		~string
+}
+
+// Codes for the kinds of validation error. They are stable, unlike the messages, so clients can
+// map them to their own (e.g. localized) text.
+const (
+	CodeRequired      = "required"
+	CodeInvalid       = "invalid"
+	CodeTooShort      = "too_short"
+	CodeTooLong       = "too_long"
+	CodeTooSmall      = "too_small"
+	CodeTooLarge      = "too_large"
+	CodeTooFew        = "too_few"
+	CodeTooMany       = "too_many"
+	CodeDuplicate     = "duplicate"
+	CodeNotPermitted  = "not_permitted"
+	CodeNotNullable   = "not_nullable"
+	CodeAlreadyExists = "already_exists"
+	CodeDisposable    = "disposable"
+	CodeUndeliverable = "undeliverable"
+)
+
+// Validator contains a map of validation errors. Errors holds the first error for each field,
+// which is what we send to the client, while FieldErrors holds every error, in the order they
+// were added. Codes holds the code of the first error for each field, qualified by the field's
+// key, e.g. "title.required".
 type Validator struct {
-	Errors map[string]string
+	Errors      map[string]string
+	FieldErrors map[string][]string
+	Codes       map[string]string
 }
 
-// New creates a new Validator instance with an empty errors map.
+// New creates a new Validator instance with empty errors maps.
 func New() *Validator {
-	return &Validator{Errors: make(map[string]string)}
+	return &Validator{
+		Errors:      make(map[string]string),
+		FieldErrors: make(map[string][]string),
+		Codes:       make(map[string]string),
+	}
 }
 
 // Valid returns true if the errors map doesn't contain any entries.
@@ -25,18 +60,71 @@ func (v *Validator) Valid() bool {
 	return len(v.Errors) == 0
 }
 
-// AddError adds an error message to the map (so long as no entry already exists for the given key).
-func (v *Validator) AddError(key, message string) {
+// AddError adds an error message and its code to the maps (so long as no entry already exists for
+// the given key). Every message is also appended to the key's FieldErrors.
+func (v *Validator) AddError(key, code, message string) {
+	// FieldErrors and Codes are nil for a Validator that wasn't created with New().
+	if v.FieldErrors == nil {
+		v.FieldErrors = make(map[string][]string)
+	}
+	if v.Codes == nil {
+		v.Codes = make(map[string]string)
+	}
+
 	if _, exists := v.Errors[key]; !exists {
 		v.Errors[key] = message
+		v.Codes[key] = key + "." + code
 	}
+
+	v.FieldErrors[key] = append(v.FieldErrors[key], message)
 }
 
 // Check adds an error message to the map only if a validation check is not 'ok'.
-func (v *Validator) Check(ok bool, key, message string) {
+func (v *Validator) Check(ok bool, key, code, message string) {
 	if !ok {
-		v.AddError(key, message)
+		v.AddError(key, code, message)
+	}
+}
+
+// Path builds the key of a nested field from its parts: strings are joined with dots and integers
+// become indexes, e.g. Path("genres", 2) is "genres[2]" and Path("cast", 0, "name") is
+// "cast[0].name".
+func Path(parts ...any) string {
+	var b strings.Builder
+
+	for _, part := range parts {
+		switch p := part.(type) {
+		case int:
+			b.WriteString("[" + strconv.Itoa(p) + "]")
+		case string:
+			if b.Len() > 0 {
+				b.WriteByte('.')
+			}
+			b.WriteString(p)
+		}
 	}
+
+	return b.String()
+}
+
+// Min returns true if value is greater than or equal to min.
+func Min[T Ordered](value, min T) bool {
+	return value >= min
+}
+
+// Max returns true if value is less than or equal to max.
+func Max[T Ordered](value, max T) bool {
+	return value <= max
+}
+
+// Between returns true if value is between min and max, inclusive.
+func Between[T Ordered](value, min, max T) bool {
+	return value >= min && value <= max
+}
+
+// In returns true if value is one of the permitted values. It's the same as PermittedValue().
+func In[T comparable](value T, permittedValues ...T) bool {
+	return PermittedValue(value, permittedValues...)
 }
 
 // PermittedValue returns true if a specific value is in a list.
@@ -49,9 +137,10 @@ func PermittedValue[T comparable](value T, permittedValues ...T) bool {
 	return false
 }
 
-// Matches returns true if a string value matches a specific regex pattern.
-func Matches(value string, rx *regexp.Regexp) bool {
-	return rx.MatchString(value)
+// Matches returns true if a string value matches a specific regex pattern. It accepts any type
+// whose underlying type is string.
+func Matches[T ~string](value T, rx *regexp.Regexp) bool {
+	return rx.MatchString(string(value))
 }
 
 // Unique returns true if all string values in a slice are unique.
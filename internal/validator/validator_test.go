@@ -0,0 +1,135 @@
+package validator
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidator_MultipleErrors(t *testing.T) {
+	v := New()
+	v.Check(false, "title", CodeRequired, "must be provided")
+	v.Check(false, "title", CodeTooLong, "must not be more than 500 bytes long")
+	v.Check(true, "year", CodeRequired, "must be provided")
+
+	assert.False(t, v.Valid())
+	assert.Equal(t, map[string]string{"title": "must be provided"}, v.Errors)
+	assert.Equal(t, map[string]string{"title": "title.required"}, v.Codes)
+	assert.Equal(
+		t,
+		map[string][]string{"title": {"must be provided", "must not be more than 500 bytes long"}},
+		v.FieldErrors,
+	)
+}
+
+func TestValidator_ZeroValue(t *testing.T) {
+	v := &Validator{Errors: make(map[string]string)}
+	v.AddError("title", CodeRequired, "must be provided")
+	assert.Equal(t, []string{"must be provided"}, v.FieldErrors["title"])
+	assert.Equal(t, "title.required", v.Codes["title"])
+}
+
+func TestPath(t *testing.T) {
+	assert.Equal(t, "genres", Path("genres"))
+	assert.Equal(t, "genres[2]", Path("genres", 2))
+	assert.Equal(t, "cast[0].name", Path("cast", 0, "name"))
+	assert.Equal(t, "matrix[1][3]", Path("matrix", 1, 3))
+}
+
+func TestOrderedHelpers(t *testing.T) {
+	type runtime int32
+
+	assert.True(t, Min(runtime(90), 1))
+	assert.False(t, Min(0, 1))
+	assert.True(t, Max(2.5, 3))
+	assert.False(t, Max("b", "a"))
+	assert.True(t, Between(1895, 1895, 2024))
+	assert.False(t, Between(1894, 1895, 2024))
+	assert.True(t, In("drama", "comedy", "drama"))
+	assert.False(t, In(3, 1, 2))
+}
+
+func TestMatches(t *testing.T) {
+	type phone string
+
+	assert.True(t, Matches(phone("+14155552671"), PhoneRX))
+	assert.False(t, Matches("not a phone", PhoneRX))
+	assert.True(t, Matches("abc", regexp.MustCompile("^a")))
+}
+
+func TestStruct(t *testing.T) {
+	type castMember struct {
+		Name string `json:"name" validate:"required,max=10"`
+	}
+	type input struct {
+		Title   string       `json:"title" validate:"required,max=10"`
+		Year    int32        `json:"year" validate:"required,gt=1894"`
+		Runtime *int32       `json:"runtime" validate:"omitempty,min=1"`
+		Genres  []string     `json:"genres" validate:"required,min=1,max=2,unique"`
+		Rating  string       `json:"rating" validate:"omitempty,oneof=G PG R"`
+		Email   string       `validate:"omitempty,email"`
+		Cast    []castMember `json:"cast"`
+	}
+
+	v := New()
+	v.Struct(&input{Title: "Casablanca", Year: 1942, Genres: []string{"drama"}})
+	assert.True(t, v.Valid())
+
+	runtime := int32(0)
+	v = New()
+	v.Struct(input{
+		Title:   "Much too long",
+		Year:    1800,
+		Runtime: &runtime,
+		Genres:  []string{"drama", "drama"},
+		Rating:  "X",
+		Email:   "nope",
+		Cast:    []castMember{{Name: "Bogart"}, {}},
+	})
+	assert.Equal(t, map[string]string{
+		"title":        "must not be more than 10 bytes long",
+		"year":         "must be greater than 1894",
+		"runtime":      "must be at least 1",
+		"genres":       "must not contain duplicate values",
+		"rating":       "must be one of G, PG, R",
+		"email":        "must be a valid email address",
+		"cast[1].name": "must be provided",
+	}, v.Errors)
+	assert.Equal(t, "year.too_small", v.Codes["year"])
+	assert.Equal(t, "cast[1].name.required", v.Codes["cast[1].name"])
+
+	v = New()
+	v.Struct(input{Genres: []string{}})
+	assert.Equal(t, map[string]string{
+		"title":  "must be provided",
+		"year":   "must be provided",
+		"genres": "must contain at least 1 item",
+	}, v.Errors)
+
+	assert.Panics(t, func() {
+		New().Struct(struct {
+			Title string `validate:"requird"`
+		}{})
+	})
+}
+
+func TestParseUserRules(t *testing.T) {
+	rules, err := ParseUserRules("required, max=40")
+	require.NoError(t, err)
+	assert.Equal(t, []Rule{{Name: "required"}, {Name: "max", Param: "40"}}, rules)
+
+	v := New()
+	v.Value("attributes.studio", "", rules)
+	v.Value("attributes.rating", 5.5, ParseRules("min=0,max=5"))
+	assert.Equal(t, map[string]string{
+		"attributes.studio": "attributes.studio.required",
+		"attributes.rating": "attributes.rating.too_large",
+	}, v.Codes)
+
+	_, err = ParseUserRules("max=forty")
+	assert.EqualError(t, err, `invalid max parameter "forty"`)
+	_, err = ParseUserRules("requird")
+	assert.EqualError(t, err, `unknown rule "requird"`)
+}
@@ -0,0 +1,38 @@
+CREATE TABLE IF NOT EXISTS organizations (
+  id bigserial PRIMARY KEY,
+  created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+  name text NOT NULL,
+  version integer NOT NULL DEFAULT 1
+);
+
+CREATE TABLE IF NOT EXISTS organizations_users (
+  organization_id bigint NOT NULL REFERENCES organizations ON DELETE CASCADE,
+  user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+  role text NOT NULL DEFAULT 'member',
+  created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+  PRIMARY KEY (organization_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS organizations_users_user_id_idx ON organizations_users (user_id);
+
+-- The existing users and movies move into a default organization, which new users also join.
+INSERT INTO organizations (id, name)
+VALUES (1, 'Default');
+SELECT setval('organizations_id_seq', 1);
+
+INSERT INTO organizations_users (organization_id, user_id)
+SELECT 1,
+  id
+FROM users;
+
+ALTER TABLE movies
+ADD COLUMN organization_id bigint NOT NULL DEFAULT 1 REFERENCES organizations ON DELETE CASCADE;
+ALTER TABLE movies
+ALTER COLUMN organization_id DROP DEFAULT;
+
+CREATE INDEX IF NOT EXISTS movies_organization_id_idx ON movies (organization_id);
+
+-- Authentication tokens are scoped to the organization they were issued for. Activation tokens
+-- aren't scoped to any organization, so the column is nullable.
+ALTER TABLE tokens
+ADD COLUMN organization_id bigint REFERENCES organizations ON DELETE CASCADE;
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS organization_usage;
+DROP TABLE IF EXISTS organization_limits;
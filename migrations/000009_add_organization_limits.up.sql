@@ -0,0 +1,16 @@
+-- A missing row, or a NULL column, means the organization isn't limited beyond the global limits.
+CREATE TABLE IF NOT EXISTS organization_limits (
+  organization_id bigint PRIMARY KEY REFERENCES organizations ON DELETE CASCADE,
+  requests_per_second double precision CHECK (requests_per_second > 0),
+  burst integer CHECK (burst > 0),
+  daily_request_quota bigint CHECK (daily_request_quota > 0),
+  max_movies bigint CHECK (max_movies > 0),
+  version integer NOT NULL DEFAULT 1
+);
+
+CREATE TABLE IF NOT EXISTS organization_usage (
+  organization_id bigint NOT NULL REFERENCES organizations ON DELETE CASCADE,
+  day date NOT NULL,
+  requests bigint NOT NULL DEFAULT 0,
+  PRIMARY KEY (organization_id, day)
+);
@@ -0,0 +1,6 @@
+-- The models set updated_at whenever they update a movie, alongside bumping its version.
+ALTER TABLE movies
+ADD COLUMN IF NOT EXISTS updated_at timestamptz NOT NULL DEFAULT (now());
+
+UPDATE movies
+SET updated_at = created_at;
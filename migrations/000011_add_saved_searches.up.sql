@@ -0,0 +1,18 @@
+-- A user's saved searches are scoped to the organization they were saved in, like the movies they
+-- search.
+CREATE TABLE IF NOT EXISTS saved_searches (
+  id bigserial PRIMARY KEY,
+  user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+  organization_id bigint NOT NULL REFERENCES organizations ON DELETE CASCADE,
+  created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+  name text NOT NULL,
+  title text NOT NULL DEFAULT '',
+  genres text[] NOT NULL DEFAULT '{}',
+  sort text NOT NULL DEFAULT 'id',
+  notify boolean NOT NULL DEFAULT false,
+  version integer NOT NULL DEFAULT 1,
+  CONSTRAINT saved_searches_name_key UNIQUE (user_id, organization_id, name)
+);
+
+CREATE INDEX IF NOT EXISTS saved_searches_notify_idx ON saved_searches (organization_id)
+WHERE notify;
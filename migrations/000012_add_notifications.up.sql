@@ -0,0 +1,27 @@
+-- Notifications are generated by domain events (e.g. a movie added in a watched genre), and are
+-- scoped to the organization the event happened in.
+CREATE TABLE IF NOT EXISTS notifications (
+  id bigserial PRIMARY KEY,
+  user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+  organization_id bigint NOT NULL REFERENCES organizations ON DELETE CASCADE,
+  created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+  kind text NOT NULL,
+  message text NOT NULL,
+  movie_id bigint REFERENCES movies ON DELETE CASCADE,
+  read_at timestamp(0) with time zone
+);
+
+CREATE INDEX IF NOT EXISTS notifications_user_id_idx ON notifications (user_id, organization_id, id);
+
+-- The users without preferences get the defaults: in-app notifications only, and no watched
+-- genres.
+CREATE TABLE IF NOT EXISTS notification_preferences (
+  user_id bigint PRIMARY KEY REFERENCES users ON DELETE CASCADE,
+  in_app boolean NOT NULL DEFAULT true,
+  email boolean NOT NULL DEFAULT false,
+  watched_genres text[] NOT NULL DEFAULT '{}',
+  version integer NOT NULL DEFAULT 1
+);
+
+CREATE INDEX IF NOT EXISTS notification_preferences_watched_genres_idx
+ON notification_preferences USING GIN (watched_genres);
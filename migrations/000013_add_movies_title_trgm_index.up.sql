@@ -0,0 +1,4 @@
+-- The trigram index backs the spelling suggestions for title searches without any results.
+CREATE EXTENSION IF NOT EXISTS pg_trgm SCHEMA public;
+
+CREATE INDEX IF NOT EXISTS movies_title_trgm_idx ON movies USING GIN (title gin_trgm_ops);
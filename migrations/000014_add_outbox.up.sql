@@ -0,0 +1,15 @@
+-- The outbox holds the domain events, written in the same transaction as the change they describe,
+-- until the relay has published them. Failed deliveries are retried from next_attempt_at.
+CREATE TABLE IF NOT EXISTS outbox (
+  id bigserial PRIMARY KEY,
+  created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+  kind text NOT NULL,
+  aggregate_id bigint NOT NULL,
+  payload jsonb NOT NULL,
+  attempts integer NOT NULL DEFAULT 0,
+  last_error text,
+  next_attempt_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+  delivered_at timestamp(0) with time zone
+);
+
+CREATE INDEX IF NOT EXISTS outbox_undelivered_idx ON outbox (id) WHERE delivered_at IS NULL;
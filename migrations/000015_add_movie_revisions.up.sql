@@ -0,0 +1,12 @@
+-- The revisions hold the superseded versions of the movies, each recorded by the update that
+-- replaced it. A movie's current version is the one in the movies table.
+CREATE TABLE IF NOT EXISTS movie_revisions (
+  movie_id bigint NOT NULL REFERENCES movies ON DELETE CASCADE,
+  version integer NOT NULL,
+  created_at timestamp(0) with time zone NOT NULL,
+  title text NOT NULL,
+  year integer NOT NULL,
+  runtime integer NOT NULL,
+  genres text[] NOT NULL,
+  PRIMARY KEY (movie_id, version)
+);
@@ -0,0 +1,3 @@
+DELETE FROM movies WHERE deleted_at IS NOT NULL;
+ALTER TABLE movies DROP COLUMN IF EXISTS merged_into;
+ALTER TABLE movies DROP COLUMN IF EXISTS deleted_at;
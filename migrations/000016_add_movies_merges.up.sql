@@ -0,0 +1,4 @@
+-- A duplicate movie that's merged into another is soft-deleted, and keeps the ID of the movie it
+-- was merged into, so that requests for the duplicate are redirected there.
+ALTER TABLE movies ADD COLUMN IF NOT EXISTS deleted_at timestamp(0) with time zone;
+ALTER TABLE movies ADD COLUMN IF NOT EXISTS merged_into bigint REFERENCES movies ON DELETE SET NULL;
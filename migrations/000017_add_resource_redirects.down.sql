@@ -0,0 +1,10 @@
+ALTER TABLE movies ADD COLUMN IF NOT EXISTS merged_into bigint REFERENCES movies ON DELETE SET NULL;
+
+UPDATE movies
+SET merged_into = r.new_id
+FROM resource_redirects r
+WHERE r.resource = 'movies'
+  AND r.old_id = movies.id
+  AND EXISTS (SELECT 1 FROM movies m WHERE m.id = r.new_id);
+
+DROP TABLE IF EXISTS resource_redirects;
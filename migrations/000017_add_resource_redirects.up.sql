@@ -0,0 +1,19 @@
+-- The redirects map the IDs of the resources that have moved, e.g. duplicate movies merged into
+-- another one, to their new IDs, so that the old links keep working. They replace the movies'
+-- merged_into column.
+CREATE TABLE IF NOT EXISTS resource_redirects (
+  resource text NOT NULL,
+  organization_id bigint NOT NULL REFERENCES organizations ON DELETE CASCADE,
+  old_id bigint NOT NULL,
+  new_id bigint NOT NULL,
+  created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+  PRIMARY KEY (resource, organization_id, old_id)
+);
+
+INSERT INTO resource_redirects (resource, organization_id, old_id, new_id)
+SELECT 'movies', organization_id, id, merged_into
+FROM movies
+WHERE merged_into IS NOT NULL
+ON CONFLICT DO NOTHING;
+
+ALTER TABLE movies DROP COLUMN IF EXISTS merged_into;
@@ -0,0 +1,4 @@
+DROP TRIGGER IF EXISTS movie_listings_sync ON movies;
+DROP FUNCTION IF EXISTS movie_listings_sync();
+DROP TABLE IF EXISTS movie_listing_counts;
+DROP TABLE IF EXISTS movie_listings;
@@ -0,0 +1,79 @@
+-- The listings are a denormalized copy of the live movies, along with each organization's count,
+-- which serve the unfiltered listings sorted by ID or title without counting the movies table. A
+-- trigger keeps them up to date as the movies are written, within the same transactions.
+CREATE TABLE IF NOT EXISTS movie_listings (
+  id bigint PRIMARY KEY,
+  organization_id bigint NOT NULL REFERENCES organizations ON DELETE CASCADE,
+  created_at timestamptz NOT NULL,
+  updated_at timestamptz NOT NULL,
+  title text NOT NULL,
+  year int NOT NULL,
+  runtime int NOT NULL,
+  genres text [] NOT NULL,
+  version int NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS movie_listings_organization_id_idx
+ON movie_listings (organization_id, id);
+CREATE INDEX IF NOT EXISTS movie_listings_title_idx
+ON movie_listings (organization_id, title, id);
+
+CREATE TABLE IF NOT EXISTS movie_listing_counts (
+  organization_id bigint PRIMARY KEY REFERENCES organizations ON DELETE CASCADE,
+  total bigint NOT NULL DEFAULT 0
+);
+
+INSERT INTO movie_listings
+SELECT id, organization_id, created_at, updated_at, title, year, runtime, genres, version
+FROM movies
+WHERE deleted_at IS NULL;
+
+INSERT INTO movie_listing_counts (organization_id, total)
+SELECT organization_id, count(*)
+FROM movie_listings
+GROUP BY organization_id;
+
+CREATE OR REPLACE FUNCTION movie_listings_sync() RETURNS trigger AS $$
+BEGIN
+  -- Most updates leave the movie live in the same organization, so the count doesn't change.
+  IF TG_OP = 'UPDATE' AND OLD.deleted_at IS NULL AND NEW.deleted_at IS NULL
+    AND OLD.organization_id = NEW.organization_id THEN
+    UPDATE movie_listings
+    SET updated_at = NEW.updated_at,
+      title = NEW.title,
+      year = NEW.year,
+      runtime = NEW.runtime,
+      genres = NEW.genres,
+      version = NEW.version
+    WHERE id = NEW.id;
+    RETURN NULL;
+  END IF;
+
+  IF TG_OP IN ('UPDATE', 'DELETE') THEN
+    DELETE FROM movie_listings WHERE id = OLD.id;
+    IF FOUND THEN
+      UPDATE movie_listing_counts
+      SET total = total - 1
+      WHERE organization_id = OLD.organization_id;
+    END IF;
+  END IF;
+
+  IF TG_OP IN ('INSERT', 'UPDATE') AND NEW.deleted_at IS NULL THEN
+    INSERT INTO movie_listings
+    VALUES (
+      NEW.id, NEW.organization_id, NEW.created_at, NEW.updated_at, NEW.title, NEW.year,
+      NEW.runtime, NEW.genres, NEW.version
+    );
+    INSERT INTO movie_listing_counts (organization_id, total)
+    VALUES (NEW.organization_id, 1)
+    ON CONFLICT (organization_id) DO UPDATE
+    SET total = movie_listing_counts.total + 1;
+  END IF;
+
+  RETURN NULL;
+END
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER movie_listings_sync
+AFTER INSERT OR UPDATE OR DELETE ON movies
+FOR EACH ROW EXECUTE FUNCTION movie_listings_sync();
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS tokens_archive;
+DROP TABLE IF EXISTS movies_archive;
@@ -0,0 +1,25 @@
+-- The archive tables hold the soft-deleted movies and the expired tokens that the archiver moved
+-- out of the hot tables once they were past the retention period, which keeps the hot tables and
+-- their indexes small. Nothing reads them back; they're kept for audits.
+CREATE TABLE IF NOT EXISTS movies_archive (
+  id bigint PRIMARY KEY,
+  organization_id bigint NOT NULL,
+  created_at timestamptz NOT NULL,
+  updated_at timestamptz NOT NULL,
+  deleted_at timestamp(0) with time zone NOT NULL,
+  title text NOT NULL,
+  year int NOT NULL,
+  runtime int NOT NULL,
+  genres text [] NOT NULL,
+  version int NOT NULL,
+  archived_at timestamp(0) with time zone NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS tokens_archive (
+  hash bytea PRIMARY KEY,
+  user_id bigint NOT NULL,
+  organization_id bigint,
+  expiry timestamptz NOT NULL,
+  scope text NOT NULL,
+  archived_at timestamp(0) with time zone NOT NULL DEFAULT NOW()
+);
@@ -0,0 +1,17 @@
+-- The encrypted emails can only be decrypted by the application, so reverting this migration fails
+-- while there are any left. Decrypt them first, by running the application with -email-decrypt.
+DO $$
+BEGIN
+  IF EXISTS (SELECT 1 FROM users WHERE email IS NULL) THEN
+    RAISE EXCEPTION 'some users emails are still encrypted';
+  END IF;
+END
+$$;
+
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_email_check;
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_email_index_key;
+
+ALTER TABLE users DROP COLUMN IF EXISTS email_key_id;
+ALTER TABLE users DROP COLUMN IF EXISTS email_index;
+ALTER TABLE users DROP COLUMN IF EXISTS email_ciphertext;
+ALTER TABLE users ALTER COLUMN email SET NOT NULL;
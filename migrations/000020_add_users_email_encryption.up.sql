@@ -0,0 +1,11 @@
+-- The emails can be encrypted by the application, in which case the email column is null and the
+-- email_ciphertext column holds the encrypted email, along with the ID of the key that encrypted
+-- it. The email_index column holds the email's blind index, which the lookups by email use.
+ALTER TABLE users ALTER COLUMN email DROP NOT NULL;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS email_ciphertext bytea;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS email_index bytea;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS email_key_id int;
+
+ALTER TABLE users ADD CONSTRAINT users_email_index_key UNIQUE (email_index);
+ALTER TABLE users ADD CONSTRAINT users_email_check
+  CHECK (email IS NOT NULL OR (email_ciphertext IS NOT NULL AND email_index IS NOT NULL));
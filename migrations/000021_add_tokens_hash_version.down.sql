@@ -0,0 +1,4 @@
+-- The tokens hashed with another scheme than SHA-256 can't be checked without their version.
+DELETE FROM tokens WHERE hash_version <> 1;
+
+ALTER TABLE tokens DROP COLUMN IF EXISTS hash_version;
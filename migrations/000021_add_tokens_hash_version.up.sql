@@ -0,0 +1,2 @@
+-- The tokens created so far were hashed with SHA-256, which is version 1.
+ALTER TABLE tokens ADD COLUMN IF NOT EXISTS hash_version smallint NOT NULL DEFAULT 1;
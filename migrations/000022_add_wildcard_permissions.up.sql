@@ -0,0 +1,5 @@
+-- The wildcard codes imply every code with the same prefix, e.g. movies:* implies movies:read and
+-- movies:write.
+INSERT INTO permissions (code)
+VALUES ('movies:*'),
+  ('admin:*');
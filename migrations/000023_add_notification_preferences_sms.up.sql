@@ -0,0 +1,3 @@
+ALTER TABLE notification_preferences ADD COLUMN IF NOT EXISTS phone text;
+ALTER TABLE notification_preferences
+ADD COLUMN IF NOT EXISTS sms_alerts boolean NOT NULL DEFAULT false;
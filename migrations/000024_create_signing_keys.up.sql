@@ -0,0 +1,13 @@
+-- The signing keys authenticate the server integrations, which sign their requests with an HMAC of
+-- the key's secret instead of sending a bearer token. Unlike the tokens, a secret can't be stored
+-- as a hash, since verifying a signature requires it. Like the tokens, a key may be scoped to one
+-- of its user's organizations.
+CREATE TABLE IF NOT EXISTS signing_keys (
+  id text PRIMARY KEY,
+  user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+  organization_id bigint REFERENCES organizations ON DELETE CASCADE,
+  created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+  secret bytea NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS signing_keys_user_id_idx ON signing_keys (user_id);
@@ -0,0 +1,9 @@
+-- The service accounts map the identities of the client certificates presented to the mTLS
+-- listener, e.g. a SPIFFE ID, to the users the requests are made as. The user's permissions apply
+-- as for any other user, and the requests are scoped to the organization, if any.
+CREATE TABLE IF NOT EXISTS service_accounts (
+  identity text PRIMARY KEY,
+  user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+  organization_id bigint REFERENCES organizations ON DELETE CASCADE,
+  created_at timestamp(0) with time zone NOT NULL DEFAULT NOW()
+);
@@ -0,0 +1,46 @@
+CREATE OR REPLACE FUNCTION movie_listings_sync() RETURNS trigger AS $$
+BEGIN
+  IF TG_OP = 'UPDATE' AND OLD.deleted_at IS NULL AND NEW.deleted_at IS NULL
+    AND OLD.organization_id = NEW.organization_id THEN
+    UPDATE movie_listings
+    SET updated_at = NEW.updated_at,
+      title = NEW.title,
+      year = NEW.year,
+      runtime = NEW.runtime,
+      genres = NEW.genres,
+      version = NEW.version
+    WHERE id = NEW.id;
+    RETURN NULL;
+  END IF;
+
+  IF TG_OP IN ('UPDATE', 'DELETE') THEN
+    DELETE FROM movie_listings WHERE id = OLD.id;
+    IF FOUND THEN
+      UPDATE movie_listing_counts
+      SET total = total - 1
+      WHERE organization_id = OLD.organization_id;
+    END IF;
+  END IF;
+
+  IF TG_OP IN ('INSERT', 'UPDATE') AND NEW.deleted_at IS NULL THEN
+    INSERT INTO movie_listings
+    VALUES (
+      NEW.id, NEW.organization_id, NEW.created_at, NEW.updated_at, NEW.title, NEW.year,
+      NEW.runtime, NEW.genres, NEW.version
+    );
+    INSERT INTO movie_listing_counts (organization_id, total)
+    VALUES (NEW.organization_id, 1)
+    ON CONFLICT (organization_id) DO UPDATE
+    SET total = movie_listing_counts.total + 1;
+  END IF;
+
+  RETURN NULL;
+END
+$$ LANGUAGE plpgsql;
+
+DROP INDEX IF EXISTS movies_attributes_idx;
+ALTER TABLE movies_archive DROP COLUMN IF EXISTS attributes;
+ALTER TABLE movie_listings DROP COLUMN IF EXISTS attributes;
+ALTER TABLE movie_revisions DROP COLUMN IF EXISTS attributes;
+ALTER TABLE movies DROP COLUMN IF EXISTS attributes;
+DROP TABLE IF EXISTS movie_attributes;
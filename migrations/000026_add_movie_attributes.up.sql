@@ -0,0 +1,61 @@
+-- The attributes are the custom fields that the operators register, e.g. a studio or a rating,
+-- which every movie may hold without a column of its own. Their definitions say what type of value
+-- they hold, the rules the values must pass and whether the movies can be filtered by them.
+CREATE TABLE IF NOT EXISTS movie_attributes (
+  name text PRIMARY KEY,
+  type text NOT NULL,
+  rules text NOT NULL DEFAULT '',
+  searchable boolean NOT NULL DEFAULT false,
+  created_at timestamp(0) with time zone NOT NULL DEFAULT NOW()
+);
+
+ALTER TABLE movies ADD COLUMN IF NOT EXISTS attributes jsonb NOT NULL DEFAULT '{}';
+ALTER TABLE movie_revisions ADD COLUMN IF NOT EXISTS attributes jsonb NOT NULL DEFAULT '{}';
+ALTER TABLE movie_listings ADD COLUMN IF NOT EXISTS attributes jsonb NOT NULL DEFAULT '{}';
+ALTER TABLE movies_archive ADD COLUMN IF NOT EXISTS attributes jsonb NOT NULL DEFAULT '{}';
+
+-- The filters by attribute are containment queries (attributes @> '{"studio": "A24"}'), which
+-- jsonb_path_ops indexes more compactly than the default operator class.
+CREATE INDEX IF NOT EXISTS movies_attributes_idx ON movies USING GIN (attributes jsonb_path_ops);
+
+CREATE OR REPLACE FUNCTION movie_listings_sync() RETURNS trigger AS $$
+BEGIN
+  -- Most updates leave the movie live in the same organization, so the count doesn't change.
+  IF TG_OP = 'UPDATE' AND OLD.deleted_at IS NULL AND NEW.deleted_at IS NULL
+    AND OLD.organization_id = NEW.organization_id THEN
+    UPDATE movie_listings
+    SET updated_at = NEW.updated_at,
+      title = NEW.title,
+      year = NEW.year,
+      runtime = NEW.runtime,
+      genres = NEW.genres,
+      version = NEW.version,
+      attributes = NEW.attributes
+    WHERE id = NEW.id;
+    RETURN NULL;
+  END IF;
+
+  IF TG_OP IN ('UPDATE', 'DELETE') THEN
+    DELETE FROM movie_listings WHERE id = OLD.id;
+    IF FOUND THEN
+      UPDATE movie_listing_counts
+      SET total = total - 1
+      WHERE organization_id = OLD.organization_id;
+    END IF;
+  END IF;
+
+  IF TG_OP IN ('INSERT', 'UPDATE') AND NEW.deleted_at IS NULL THEN
+    INSERT INTO movie_listings
+    VALUES (
+      NEW.id, NEW.organization_id, NEW.created_at, NEW.updated_at, NEW.title, NEW.year,
+      NEW.runtime, NEW.genres, NEW.version, NEW.attributes
+    );
+    INSERT INTO movie_listing_counts (organization_id, total)
+    VALUES (NEW.organization_id, 1)
+    ON CONFLICT (organization_id) DO UPDATE
+    SET total = movie_listing_counts.total + 1;
+  END IF;
+
+  RETURN NULL;
+END
+$$ LANGUAGE plpgsql;
@@ -0,0 +1,10 @@
+-- The posters are stored in the object storage, under their key; the table records which movies
+-- have one. The organization is denormalized from the movie, so that its posters can be listed
+-- without a join.
+CREATE TABLE IF NOT EXISTS movie_posters (
+  movie_id bigint PRIMARY KEY REFERENCES movies ON DELETE CASCADE,
+  organization_id bigint NOT NULL REFERENCES organizations ON DELETE CASCADE,
+  key text NOT NULL,
+  content_type text NOT NULL,
+  created_at timestamp(0) with time zone NOT NULL DEFAULT NOW()
+);
@@ -0,0 +1,2 @@
+ALTER TABLE movie_posters DROP COLUMN IF EXISTS variants;
+ALTER TABLE movie_posters DROP COLUMN IF EXISTS status;
@@ -0,0 +1,4 @@
+-- The resized variants of a poster are produced in the background once it's uploaded. The status
+-- tells whether they're ready, and the variants describe them, along with the original.
+ALTER TABLE movie_posters ADD COLUMN IF NOT EXISTS status text NOT NULL DEFAULT 'ready';
+ALTER TABLE movie_posters ADD COLUMN IF NOT EXISTS variants jsonb NOT NULL DEFAULT '[]';
@@ -0,0 +1,9 @@
+-- The encrypted secrets can only be decrypted by the application, so the signing keys that have
+-- one are revoked; their integrations need new keys.
+DELETE FROM signing_keys WHERE secret IS NULL;
+
+ALTER TABLE signing_keys DROP CONSTRAINT IF EXISTS signing_keys_secret_check;
+
+ALTER TABLE signing_keys DROP COLUMN IF EXISTS secret_key_id;
+ALTER TABLE signing_keys DROP COLUMN IF EXISTS secret_ciphertext;
+ALTER TABLE signing_keys ALTER COLUMN secret SET NOT NULL;
@@ -0,0 +1,9 @@
+-- The signing keys' secrets are encrypted by the application with the same keys as the emails, in
+-- which case the secret column is null and the secret_ciphertext column holds the encrypted secret,
+-- along with the ID of the key that encrypted it. The keys created before stay in plaintext.
+ALTER TABLE signing_keys ALTER COLUMN secret DROP NOT NULL;
+ALTER TABLE signing_keys ADD COLUMN IF NOT EXISTS secret_ciphertext bytea;
+ALTER TABLE signing_keys ADD COLUMN IF NOT EXISTS secret_key_id int;
+
+ALTER TABLE signing_keys ADD CONSTRAINT signing_keys_secret_check
+  CHECK (secret IS NOT NULL OR secret_ciphertext IS NOT NULL);
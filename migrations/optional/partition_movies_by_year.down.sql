@@ -0,0 +1,47 @@
+-- Reverts partition_movies_by_year.up.sql, merging the partitions back into a single table.
+
+DROP TRIGGER IF EXISTS movies_delete_cascade ON movies;
+DROP FUNCTION IF EXISTS movies_delete_cascade();
+
+ALTER TABLE movies RENAME TO movies_partitioned;
+
+CREATE TABLE movies (LIKE movies_partitioned INCLUDING DEFAULTS INCLUDING CONSTRAINTS);
+
+ALTER TABLE movies
+ADD CONSTRAINT movies_organization_id_fkey FOREIGN KEY (organization_id)
+  REFERENCES organizations ON DELETE CASCADE;
+
+ALTER SEQUENCE movies_id_seq OWNED BY movies.id;
+
+INSERT INTO movies
+SELECT *
+FROM movies_partitioned;
+
+DROP TABLE movies_partitioned;
+
+-- The primary key is added once the old table, whose primary key has the same name, is gone.
+ALTER TABLE movies ADD PRIMARY KEY (id);
+
+CREATE INDEX IF NOT EXISTS movies_title_idx ON movies USING GIN (to_tsvector('simple', title));
+CREATE INDEX IF NOT EXISTS movies_genres_idx ON movies USING GIN (genres);
+CREATE INDEX IF NOT EXISTS movies_organization_id_idx ON movies (organization_id);
+CREATE INDEX IF NOT EXISTS movies_title_trgm_idx ON movies USING GIN (title gin_trgm_ops);
+
+-- The trigger kept the notifications, revisions and posters of deleted movies from dangling, so
+-- the foreign keys can be restored as they were.
+ALTER TABLE notifications
+ADD CONSTRAINT notifications_movie_id_fkey FOREIGN KEY (movie_id)
+  REFERENCES movies ON DELETE CASCADE;
+ALTER TABLE movie_revisions
+ADD CONSTRAINT movie_revisions_movie_id_fkey FOREIGN KEY (movie_id)
+  REFERENCES movies ON DELETE CASCADE;
+ALTER TABLE movie_posters
+ADD CONSTRAINT movie_posters_movie_id_fkey FOREIGN KEY (movie_id)
+  REFERENCES movies ON DELETE CASCADE;
+
+-- The triggers stay with the old table, so the one keeping the listings up to date is recreated.
+CREATE TRIGGER movie_listings_sync
+AFTER INSERT OR UPDATE OR DELETE ON movies
+FOR EACH ROW EXECUTE FUNCTION movie_listings_sync();
+
+ANALYZE movies;
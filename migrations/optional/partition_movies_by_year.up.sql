@@ -0,0 +1,85 @@
+-- Partitions the movies table by year, for very large catalogs. It isn't one of the numbered
+-- migrations, since smaller catalogs are better off with a single table: run it once the regular
+-- migrations are up to date, with `make db/partition/up`, and revert it with
+-- `make db/partition/down`. It rewrites the whole table, so run it during a maintenance window.
+--
+-- The listings with a year_from or year_to filter only scan the partitions of the decades in the
+-- range, which EXPLAIN shows as the other partitions missing from the plan:
+--
+--   EXPLAIN SELECT count(*) FROM movies WHERE year >= 1990 AND year <= 1999;
+--
+-- The lookups by ID (and the listings without a year filter) check every partition's index
+-- instead of a single one, which makes them slightly slower. Compare the two with the benchmark
+-- in internal/data/movies_test.go, before and after partitioning.
+--
+-- A partitioned table's unique constraints must include the partition key, so the primary key
+-- becomes (id, year) and the other tables can't reference movies with a foreign key any more. The
+-- deletes that used to cascade to the notifications, revisions and posters are done by a trigger
+-- instead.
+
+ALTER TABLE movies RENAME TO movies_unpartitioned;
+
+CREATE TABLE movies (LIKE movies_unpartitioned INCLUDING DEFAULTS INCLUDING CONSTRAINTS)
+PARTITION BY RANGE (year);
+
+ALTER TABLE movies
+ADD CONSTRAINT movies_organization_id_fkey FOREIGN KEY (organization_id)
+  REFERENCES organizations ON DELETE CASCADE;
+
+ALTER SEQUENCE movies_id_seq OWNED BY movies.id;
+
+-- One partition per decade, up to the next one, with a default partition for the years after.
+CREATE TABLE movies_before_1950 PARTITION OF movies FOR VALUES FROM (MINVALUE) TO (1950);
+
+DO $$
+DECLARE
+  decade int;
+BEGIN
+  FOR decade IN 1950..(date_part('year', now())::int / 10 * 10 + 10) BY 10 LOOP
+    EXECUTE format(
+      'CREATE TABLE movies_%ss PARTITION OF movies FOR VALUES FROM (%s) TO (%s)',
+      decade, decade, decade + 10
+    );
+  END LOOP;
+END
+$$;
+
+CREATE TABLE movies_default PARTITION OF movies DEFAULT;
+
+INSERT INTO movies
+SELECT *
+FROM movies_unpartitioned;
+
+ALTER TABLE notifications DROP CONSTRAINT IF EXISTS notifications_movie_id_fkey;
+ALTER TABLE movie_revisions DROP CONSTRAINT IF EXISTS movie_revisions_movie_id_fkey;
+ALTER TABLE movie_posters DROP CONSTRAINT IF EXISTS movie_posters_movie_id_fkey;
+
+DROP TABLE movies_unpartitioned;
+
+-- The primary key is added once the old table, whose primary key has the same name, is gone.
+ALTER TABLE movies ADD PRIMARY KEY (id, year);
+
+CREATE INDEX IF NOT EXISTS movies_title_idx ON movies USING GIN (to_tsvector('simple', title));
+CREATE INDEX IF NOT EXISTS movies_genres_idx ON movies USING GIN (genres);
+CREATE INDEX IF NOT EXISTS movies_organization_id_idx ON movies (organization_id);
+CREATE INDEX IF NOT EXISTS movies_title_trgm_idx ON movies USING GIN (title gin_trgm_ops);
+
+CREATE OR REPLACE FUNCTION movies_delete_cascade() RETURNS trigger AS $$
+BEGIN
+  DELETE FROM notifications WHERE movie_id = OLD.id;
+  DELETE FROM movie_revisions WHERE movie_id = OLD.id;
+  DELETE FROM movie_posters WHERE movie_id = OLD.id;
+  RETURN NULL;
+END
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER movies_delete_cascade
+AFTER DELETE ON movies
+FOR EACH ROW EXECUTE FUNCTION movies_delete_cascade();
+
+-- The triggers stay with the old table, so the one keeping the listings up to date is recreated.
+CREATE TRIGGER movie_listings_sync
+AFTER INSERT OR UPDATE OR DELETE ON movies
+FOR EACH ROW EXECUTE FUNCTION movie_listings_sync();
+
+ANALYZE movies;
@@ -0,0 +1,111 @@
+// Package webhook verifies the signatures of the events that Greenlight posts to a webhook. When
+// the webhook has a secret, each delivery carries a Greenlight-Signature header with the Unix time
+// it was signed at, and the hex HMAC-SHA256 with the secret of that time and the body, joined by a
+// period:
+//
+//	Greenlight-Signature: t=1700000000,v1=5257a869e7ecebeda32affa62cdca3f...
+//
+// A receiver checks it against the raw body, before decoding it:
+//
+//	body, err := io.ReadAll(r.Body)
+//	...
+//	header := r.Header.Get(webhook.SignatureHeader)
+//	if err := webhook.Verify(secret, header, body, webhook.DefaultTolerance); err != nil {
+//		http.Error(w, err.Error(), http.StatusUnauthorized)
+//		return
+//	}
+//
+// The timestamp is signed along with the body, so that a captured delivery can't be replayed once
+// it's older than the tolerance.
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SignatureHeader is the header of the deliveries holding their signature.
+const SignatureHeader = "Greenlight-Signature"
+
+// DefaultTolerance is how old a delivery's timestamp may be, or how far in the future, which
+// allows for the receiver's clock being off a little.
+const DefaultTolerance = 5 * time.Minute
+
+var (
+	ErrNoSignature      = errors.New("webhook: no valid signature header")
+	ErrInvalidSignature = errors.New("webhook: signature doesn't match the body")
+	ErrExpired          = errors.New("webhook: timestamp is outside the tolerance")
+)
+
+// Sign returns the signature header of a body sent at t.
+func Sign(secret []byte, t time.Time, body []byte) string {
+	timestamp := strconv.FormatInt(t.Unix(), 10)
+	return "t=" + timestamp + ",v1=" + hex.EncodeToString(mac(secret, timestamp, body))
+}
+
+// Verify checks the signature header of a delivery against its body, and that its timestamp is
+// within the tolerance of the current time. The header may hold several v1 signatures, e.g. while
+// the secret is rotated, and it's enough for one of them to match.
+func Verify(secret []byte, header string, body []byte, tolerance time.Duration) error {
+	return verifyAt(secret, header, body, tolerance, time.Now())
+}
+
+func verifyAt(
+	secret []byte,
+	header string,
+	body []byte,
+	tolerance time.Duration,
+	now time.Time,
+) error {
+	var timestamp string
+	var signatures [][]byte
+	for _, field := range strings.Split(header, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(field), "=")
+		switch key {
+		case "t":
+			timestamp = value
+		case "v1":
+			signature, err := hex.DecodeString(value)
+			if err == nil {
+				signatures = append(signatures, signature)
+			}
+		}
+	}
+
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || len(signatures) == 0 {
+		return ErrNoSignature
+	}
+
+	expected := mac(secret, timestamp, body)
+	matched := false
+	for _, signature := range signatures {
+		if hmac.Equal(signature, expected) {
+			matched = true
+		}
+	}
+	if !matched {
+		return ErrInvalidSignature
+	}
+
+	// The timestamp is only checked once it's known to be authentic.
+	skew := now.Sub(time.Unix(unix, 0))
+	if skew > tolerance || skew < -tolerance {
+		return ErrExpired
+	}
+	return nil
+}
+
+// mac returns the HMAC-SHA256 of the timestamp and the body, joined by a period.
+func mac(secret []byte, timestamp string, body []byte) []byte {
+	h := hmac.New(sha256.New, secret)
+	h.Write([]byte(timestamp))
+	h.Write([]byte("."))
+	h.Write(body)
+	return h.Sum(nil)
+}
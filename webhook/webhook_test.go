@@ -0,0 +1,46 @@
+package webhook
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVerify(t *testing.T) {
+	secret := []byte("whsec_test")
+	body := []byte(`{"id": 1, "kind": "movie.created"}`)
+	signedAt := time.Unix(1700000000, 0)
+	header := Sign(secret, signedAt, body)
+
+	assert.True(t, strings.HasPrefix(header, "t=1700000000,v1="))
+	assert.NoError(t, verifyAt(secret, header, body, DefaultTolerance, signedAt.Add(time.Minute)))
+
+	// A rotated secret's signature may come first.
+	rotated := Sign([]byte("whsec_old"), signedAt, body) + "," + strings.Split(header, ",")[1]
+	assert.NoError(t, verifyAt(secret, rotated, body, DefaultTolerance, signedAt))
+
+	tests := []struct {
+		name   string
+		secret []byte
+		header string
+		body   []byte
+		now    time.Time
+		err    error
+	}{
+		{"tampered body", secret, header, []byte(`{"id": 2}`), signedAt, ErrInvalidSignature},
+		{"wrong secret", []byte("whsec_other"), header, body, signedAt, ErrInvalidSignature},
+		{"too old", secret, header, body, signedAt.Add(6 * time.Minute), ErrExpired},
+		{"in the future", secret, header, body, signedAt.Add(-6 * time.Minute), ErrExpired},
+		{"no timestamp", secret, strings.Split(header, ",")[1], body, signedAt, ErrNoSignature},
+		{"empty", secret, "", body, signedAt, ErrNoSignature},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := verifyAt(tt.secret, tt.header, tt.body, DefaultTolerance, tt.now)
+			assert.ErrorIs(t, err, tt.err)
+		})
+	}
+}